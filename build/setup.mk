@@ -5,7 +5,7 @@ ifeq ($(GO),)
 endif
 
 # Ensure that the build tools are compiled. Go's caching makes this quick.
-$(shell cd build/manifest && $(GO) build -o ../bin/manifest)
+$(shell $(GO) build -o build/bin/manifest ./build/manifest)
 
 # Extract the plugin id from the manifest.
 PLUGIN_ID ?= $(shell build/bin/manifest id)
@@ -25,21 +25,6 @@ HAS_SERVER ?= $(shell build/bin/manifest has_server)
 # Determine if a webapp is defined in the manifest.
 HAS_WEBAPP ?= $(shell build/bin/manifest has_webapp)
 
-# Try looking for dep in $(GOPATH) in case $(GOPATH)/bin isn't in $(PATH).
-GOPATH ?= $(shell $(GO) env GOPATH)
-ifeq ($(DEP),)
-ifneq ($(wildcard $(GOPATH)/bin/dep),)
-    DEP = $(GOPATH)/bin/dep
-endif
-endif
-
-# Ensure that dep is installed.
-ifneq ($(HAS_SERVER),)
-ifeq ($(DEP),)
-    $(error "dep is not available: see https://golang.github.io/dep/docs/installation.html")
-endif
-endif
-
 # Ensure that npm (and thus node) is installed.
 ifneq ($(HAS_WEBAPP),)
 ifeq ($(NPM),)
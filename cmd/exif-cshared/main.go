@@ -0,0 +1,51 @@
+// Command exif-cshared builds the exif package as a C library, with -buildmode=c-shared or
+// -buildmode=c-archive, so that services in other languages, such as Python or Node.js upload
+// gateways, can call the same sanitizer as the plugin through FFI rather than by running
+// exif-remover. Along with the library, go build writes a C header declaring:
+//
+//	int SanitizeBuffer(unsigned char* input, size_t inputLen,
+//	                   unsigned char** output, size_t* outputLen, char** errMessage);
+//	void FreeBuffer(void* buffer);
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"unsafe"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// SanitizeBuffer removes the metadata of the inputLen bytes of input, as exif.Sanitize does with
+// its default options. On success it returns 0 and sets *output and *outputLen to the sanitized
+// copy. Otherwise it returns -1 and sets *errMessage to a message. Either is allocated with malloc, and
+// must be released with FreeBuffer. input is left unchanged and is not retained.
+//
+//export SanitizeBuffer
+func SanitizeBuffer(input *C.uchar, inputLen C.size_t, output **C.uchar, outputLen *C.size_t, errMessage **C.char) C.int {
+	raw := unsafe.Slice((*byte)(unsafe.Pointer(input)), int(inputLen))
+
+	sanitized := new(bytes.Buffer)
+	if _, err := exif.SanitizeBytes(raw, sanitized); err != nil {
+		*errMessage = C.CString(err.Error())
+		return -1
+	}
+
+	*output = (*C.uchar)(C.CBytes(sanitized.Bytes()))
+	*outputLen = C.size_t(sanitized.Len())
+	return 0
+}
+
+// FreeBuffer releases an output or error message allocated by SanitizeBuffer.
+//
+//export FreeBuffer
+func FreeBuffer(buffer unsafe.Pointer) {
+	C.free(buffer)
+}
+
+// main is required by the c-shared and c-archive build modes, and never called.
+func main() {}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// benchStrategies maps the names accepted by -bench-mode to the processing paths they measure.
+var benchStrategies = map[string]func(io.Reader, io.Writer) error{
+	// strip removes the EXIF data structurally, leaving the image data untouched.
+	"strip": exif.Discard,
+	// reencode decodes the image and encodes it back, as the plugin's naive path does.
+	"reencode": reencode,
+}
+
+func reencode(r io.Reader, w io.Writer) error {
+	im, _, err := image.Decode(r)
+	if err != nil {
+		return err
+	}
+	return jpeg.Encode(w, im, nil)
+}
+
+// benchResult holds the measurements of a single benchmark run.
+type benchResult struct {
+	mode       string
+	files      int
+	iterations int
+	bytes      int64
+	elapsed    time.Duration
+	allocs     uint64
+	allocBytes uint64
+	latencies  []time.Duration
+}
+
+// runBench processes every file in paths n times with each of the given modes and prints
+// throughput, allocation and latency figures for each mode.
+func runBench(paths []string, n int, modes []string) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("no input files given")
+	}
+	if n < 1 {
+		return fmt.Errorf("the number of iterations must be positive")
+	}
+
+	files := make([][]byte, 0, len(paths))
+	for _, path := range paths {
+		input, err := openInput(path)
+		if err != nil {
+			return err
+		}
+		raw, err := ioutil.ReadAll(input)
+		input.Close()
+		if err != nil {
+			return fmt.Errorf("reading %s: %v", path, err)
+		}
+		files = append(files, raw)
+	}
+
+	for _, mode := range modes {
+		process, ok := benchStrategies[mode]
+		if !ok {
+			return fmt.Errorf("unknown benchmark mode %q", mode)
+		}
+		result, err := benchMode(mode, process, files, n)
+		if err != nil {
+			return err
+		}
+		result.print()
+	}
+	return nil
+}
+
+func benchMode(mode string, process func(io.Reader, io.Writer) error, files [][]byte, n int) (*benchResult, error) {
+	result := &benchResult{
+		mode:       mode,
+		files:      len(files),
+		iterations: n,
+		latencies:  make([]time.Duration, 0, n*len(files)),
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	output := new(bytes.Buffer)
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		for _, raw := range files {
+			output.Reset()
+			fileStart := time.Now()
+			if err := process(bytes.NewReader(raw), output); err != nil {
+				return nil, fmt.Errorf("%s: %v", mode, err)
+			}
+			result.latencies = append(result.latencies, time.Since(fileStart))
+			result.bytes += int64(len(raw))
+		}
+	}
+	result.elapsed = time.Since(start)
+
+	runtime.ReadMemStats(&after)
+	result.allocs = after.Mallocs - before.Mallocs
+	result.allocBytes = after.TotalAlloc - before.TotalAlloc
+
+	return result, nil
+}
+
+func (r *benchResult) print() {
+	ops := len(r.latencies)
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+
+	fmt.Printf("%s: %d files x %d iterations in %v\n", r.mode, r.files, r.iterations, r.elapsed)
+	fmt.Printf("  throughput: %.2f MB/s, %.1f files/s\n",
+		float64(r.bytes)/(1<<20)/r.elapsed.Seconds(), float64(ops)/r.elapsed.Seconds())
+	fmt.Printf("  allocations: %d allocs/op, %d B/op\n", r.allocs/uint64(ops), r.allocBytes/uint64(ops))
+	fmt.Printf("  latency: p50=%v p90=%v p99=%v max=%v\n",
+		r.percentile(50), r.percentile(90), r.percentile(99), r.latencies[ops-1])
+}
+
+// percentile returns the p-th percentile of the sorted latencies.
+func (r *benchResult) percentile(p int) time.Duration {
+	i := (len(r.latencies)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return r.latencies[i]
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunBench(t *testing.T) {
+	encoded := new(bytes.Buffer)
+	if err := jpeg.Encode(encoded, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	// Both modes need an image to decode carrying EXIF data to remove.
+	input := append(append(append([]byte{}, encoded.Bytes()[:2]...), exifJPEG[2:38]...), encoded.Bytes()[2:]...)
+	path := filepath.Join(t.TempDir(), "image.jpg")
+	if err := ioutil.WriteFile(path, input, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testTable := []struct {
+		Name  string
+		Paths []string
+		N     int
+		Modes []string
+		Err   bool
+	}{
+		{Name: "both modes", Paths: []string{path}, N: 2, Modes: []string{"strip", "reencode"}},
+		{Name: "no files", N: 1, Modes: []string{"strip"}, Err: true},
+		{Name: "no iterations", Paths: []string{path}, Modes: []string{"strip"}, Err: true},
+		{Name: "unknown mode", Paths: []string{path}, N: 1, Modes: []string{"resize"}, Err: true},
+		{Name: "missing file", Paths: []string{path + ".missing"}, N: 1, Modes: []string{"strip"}, Err: true},
+	}
+
+	for _, test := range testTable {
+		if err := runBench(test.Paths, test.N, test.Modes); (err != nil) != test.Err {
+			t.Errorf("%s: expected an error %v, got %v", test.Name, test.Err, err)
+		}
+	}
+}
+
+func TestBenchResultPercentile(t *testing.T) {
+	result := &benchResult{}
+	for i := 1; i <= 100; i++ {
+		result.latencies = append(result.latencies, time.Duration(i))
+	}
+
+	testTable := []struct {
+		P       int
+		Latency time.Duration
+	}{
+		{P: 50, Latency: 50},
+		{P: 99, Latency: 99},
+		{P: 100, Latency: 100},
+		{P: 0, Latency: 1},
+	}
+
+	for _, test := range testTable {
+		if got := result.percentile(test.P); got != test.Latency {
+			t.Errorf("Expected p%d to be %v, got %v", test.P, test.Latency, got)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// runCheck implements the check subcommand, meant for CI: it lists the images among the given
+// files, directories and patterns that carry metadata, and exits with status 1 if any does or
+// cannot be read, so that repositories of web and marketing assets stay clean.
+func runCheck(args []string) {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	format := flags.String("format", "text", "Output format: text, or github for GitHub Actions annotations.")
+	useMmap := flags.Bool("mmap", false, "Map the files into memory rather than reading them, to check large files without copying them.")
+	setupLogging := logFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: exif-remover check [flags] <file, directory or pattern such as assets/**/*.jpg>...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	setupLogging()
+	if flags.NArg() == 0 || (*format != "text" && *format != "github") {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	paths, err := expandPaths(flags.Args())
+	if err != nil {
+		logs.Fatalf("%v", err)
+	}
+
+	checked, found, failed := 0, 0, 0
+	for _, path := range paths {
+		finding, ok, err := checkFile(path, *useMmap)
+		switch {
+		case err != nil:
+			failed++
+			annotate(*format, path, fmt.Sprintf("could not be checked: %v", err))
+		case ok:
+			checked++
+			if finding != "" {
+				found++
+				annotate(*format, path, finding)
+			}
+		}
+	}
+
+	fmt.Printf("%d of the %d files checked carry metadata", found, checked)
+	if failed > 0 {
+		fmt.Printf(", and %d could not be checked", failed)
+	}
+	fmt.Println(".")
+	if found > 0 || failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// annotate prints a finding about the file at path, as plain text or as a GitHub Actions error
+// annotation, which shows up on the file in pull requests.
+func annotate(format, path, message string) {
+	if format == "github" {
+		fmt.Printf("::error file=%s,title=Image metadata::%s\n", path, message)
+		return
+	}
+	fmt.Printf("%s: %s\n", path, message)
+}
+
+// checkFile describes the metadata carried by the file at path that sanitizing it with the
+// default options would remove, or returns an empty string if there is none. It returns false if
+// the file is not in a format exif-remover supports. The file is mapped into memory rather than
+// read if useMmap is set.
+func checkFile(path string, useMmap bool) (string, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+	data, release, err := loadFile(f, useMmap)
+	if err != nil {
+		return "", false, err
+	}
+	defer release()
+	return checkData(data)
+}
+
+// checkData describes the metadata carried by data, as checkFile does for files.
+func checkData(data []byte) (string, bool, error) {
+	if exif.Detect(data) == "" {
+		return "", false, nil
+	}
+
+	report, err := exif.SanitizeBytes(data, ioutil.Discard, exif.WithTrailerDetection(true), exif.WithLogger(debugLogger{logs}))
+	if err != nil {
+		return "", true, err
+	}
+	var parts []string
+	switch {
+	case report.ExifRemoved && report.Summary != nil:
+		parts = append(parts, fmt.Sprintf("EXIF data (%s)", report.Summary))
+	case report.ExifRemoved:
+		parts = append(parts, "EXIF data")
+	case report.MetadataRemoved || report.BytesRemoved > 0:
+		parts = append(parts, fmt.Sprintf("%d bytes of metadata", report.BytesRemoved))
+	}
+	if report.TrailerSize > 0 {
+		parts = append(parts, fmt.Sprintf("%d bytes of trailing data", report.TrailerSize))
+	}
+	return strings.Join(parts, ", "), true, nil
+}
+
+// expandPaths returns the files named by args, sorted: files as is, the files under directories,
+// and the files matching patterns, in which ** matches any number of directories, as shells
+// without globstar do not expand it. Hidden directories, such as .git, are not searched.
+func expandPaths(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		if !strings.ContainsAny(arg, "*?[") {
+			info, err := os.Stat(arg)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				paths = append(paths, arg)
+				continue
+			}
+		}
+
+		root, pattern := arg, ""
+		if strings.ContainsAny(arg, "*?[") {
+			root, pattern = patternRoot(arg), filepath.ToSlash(filepath.Clean(arg))
+		}
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if path != root && strings.HasPrefix(info.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if pattern == "" || matchPattern(strings.Split(pattern, "/"), strings.Split(filepath.ToSlash(path), "/")) {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// patternRoot returns the directory a pattern searches: its leading directories without
+// wildcards.
+func patternRoot(pattern string) string {
+	var root []string
+	for _, part := range strings.Split(filepath.ToSlash(filepath.Clean(pattern)), "/") {
+		if strings.ContainsAny(part, "*?[") {
+			break
+		}
+		root = append(root, part)
+	}
+	switch {
+	case len(root) == 0:
+		return "."
+	case len(root) == 1 && root[0] == "":
+		return "/"
+	}
+	return filepath.FromSlash(strings.Join(root, "/"))
+}
+
+// matchPattern reports whether the path elements match the pattern elements, where ** matches
+// any number of elements and the others match as filepath.Match does.
+func matchPattern(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchPattern(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
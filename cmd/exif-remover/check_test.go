@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// exifJPEG is a minimal JPEG image with an EXIF segment recording the camera make.
+var exifJPEG = []byte{
+	0xFF, 0xD8, // Start of image.
+	0xFF, 0xE1, // Markers
+	0x00, 0x22, // Length of the segment, including the length field.
+	'E', 'x', 'i', 'f', 0x00, 0x00, // EXIF identifier.
+	0x4d, 0x4d, // "MM" - Big Endian.
+	0x00, 0x2A, // Fixed 2-bytes.
+	0x00, 0x00, 0x00, 0x08, // Offset eight to first IFD.
+	0x00, 0x01, // One tag.
+	0x01, 0x0F, // Make.
+	0x00, 0x02, // ASCII.
+	0x00, 0x00, 0x00, 0x04, // Four characters.
+	'A', 'C', 'M', 0x00, // The value fits in the offset field.
+	0x00, 0x00, 0x00, 0x00, // No next IFD.
+	0xFF, 0xDA, // Start of scan.
+	0x00, 0x02,
+	0x00, 0x00,
+	0xFF, 0xD9, // End of image.
+}
+
+// cleanJPEG is exifJPEG without its EXIF segment.
+var cleanJPEG = []byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02, 0x00, 0x00, 0xFF, 0xD9}
+
+func TestCheckData(t *testing.T) {
+	testTable := []struct {
+		Name    string
+		Data    []byte
+		Finding string
+		OK      bool
+		Err     bool
+	}{
+		{Name: "exif", Data: exifJPEG, Finding: "EXIF data (ACM, GPS: no)", OK: true},
+		{Name: "clean", Data: cleanJPEG, OK: true},
+		{Name: "trailer", Data: append(append([]byte{}, cleanJPEG...), "video"...), Finding: "5 bytes of trailing data", OK: true},
+		{Name: "text", Data: []byte("not an image")},
+		{Name: "truncated", Data: exifJPEG[:20], OK: true, Err: true},
+	}
+
+	for _, test := range testTable {
+		finding, ok, err := checkData(test.Data)
+		if finding != test.Finding || ok != test.OK || (err != nil) != test.Err {
+			t.Errorf("%s: expected %q, %v and an error %v, got %q, %v and %v", test.Name, test.Finding, test.OK, test.Err, finding, ok, err)
+		}
+	}
+}
+
+func TestExpandPaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.png", "assets/c.jpg", "assets/icons/d.jpg", ".git/e.jpg"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, exifJPEG, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	join := func(names ...string) []string {
+		var paths []string
+		for _, name := range names {
+			paths = append(paths, filepath.Join(dir, filepath.FromSlash(name)))
+		}
+		return paths
+	}
+
+	testTable := []struct {
+		Args  []string
+		Paths []string
+		Err   bool
+	}{
+		{Args: join("b.png"), Paths: join("b.png")},
+		{Args: join("assets"), Paths: join("assets/c.jpg", "assets/icons/d.jpg")},
+		{Args: []string{dir}, Paths: join("a.jpg", "assets/c.jpg", "assets/icons/d.jpg", "b.png")},
+		{Args: join("*.jpg"), Paths: join("a.jpg")},
+		{Args: join("**/*.jpg"), Paths: join("a.jpg", "assets/c.jpg", "assets/icons/d.jpg")},
+		{Args: join("assets/**/d.jpg"), Paths: join("assets/icons/d.jpg")},
+		{Args: join("missing.jpg"), Err: true},
+	}
+
+	for _, test := range testTable {
+		paths, err := expandPaths(test.Args)
+		if (err != nil) != test.Err || !reflect.DeepEqual(paths, test.Paths) {
+			t.Errorf("%s: expected %v, got %v and %v", strings.Join(test.Args, " "), test.Paths, paths, err)
+		}
+	}
+}
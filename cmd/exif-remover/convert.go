@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/internal/heic"
+)
+
+// convertInput returns input converted to the given format if it is a HEIC image, and input
+// unchanged otherwise. Only "jpeg" is supported as a target format.
+func convertInput(input io.Reader, format string) (io.Reader, error) {
+	if format != "jpeg" {
+		return nil, fmt.Errorf("unsupported conversion format %q", format)
+	}
+
+	buffered := bufio.NewReader(input)
+	header, _ := buffered.Peek(12)
+	if !heic.Is(header) {
+		return buffered, nil
+	}
+
+	raw, err := heic.ToJPEG(buffered)
+	if err != nil {
+		return nil, err
+	}
+	logs.Infof("Converted HEIC input to JPEG")
+	return bytes.NewReader(raw), nil
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// exiftoolOptions are the exiftool options exif-remover accepts, so that scripts written for
+// exiftool, and the habits of its users, carry over:
+//
+//	exif-remover -all= [-overwrite_original] [-stats_json] <file>...
+//	exif-remover -gps:all= [-overwrite_original] [-stats_json] <file>...
+//	exif-remover -j <file>...
+//
+// -stats_json is exif-remover's own, and prints the statistics of the run as JSON.
+var exiftoolOptions = map[string]bool{
+	"-all=":               true,
+	"-gps:all=":           true,
+	"-j":                  true,
+	"-json":               true,
+	"-overwrite_original": true,
+}
+
+// exiftoolArgs are the options and files of an exiftool style invocation.
+type exiftoolArgs struct {
+	all       bool
+	gps       bool
+	json      bool
+	overwrite bool
+	statsJSON bool
+	files     []string
+}
+
+// isExiftoolStyle reports whether args use any of the exiftool options, which exiftool allows
+// anywhere among the files.
+func isExiftoolStyle(args []string) bool {
+	for _, arg := range args {
+		if exiftoolOptions[arg] {
+			return true
+		}
+	}
+	return false
+}
+
+// parseExiftoolArgs parses an exiftool style invocation, rejecting the exiftool options
+// exif-remover does not support rather than ignoring them.
+func parseExiftoolArgs(args []string) (exiftoolArgs, error) {
+	var parsed exiftoolArgs
+	for _, arg := range args {
+		switch strings.TrimPrefix(arg, "-") {
+		case "all=":
+			parsed.all = true
+		case "gps:all=":
+			parsed.gps = true
+		case "j", "json":
+			parsed.json = true
+		case "overwrite_original":
+			parsed.overwrite = true
+		case "stats_json":
+			parsed.statsJSON = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return parsed, fmt.Errorf("unsupported exiftool option %q: only -all=, -gps:all=, -j, -overwrite_original and -stats_json are supported", arg)
+			}
+			parsed.files = append(parsed.files, arg)
+		}
+	}
+	switch {
+	case len(parsed.files) == 0:
+		return parsed, fmt.Errorf("no files given")
+	case parsed.json && (parsed.all || parsed.gps):
+		return parsed, fmt.Errorf("-j cannot be combined with -all= or -gps:all=")
+	case parsed.json && parsed.statsJSON:
+		return parsed, fmt.Errorf("-stats_json only applies to -all= and -gps:all=")
+	case !parsed.json && !parsed.all && !parsed.gps:
+		return parsed, fmt.Errorf("nothing to do: use -all=, -gps:all= or -j")
+	}
+	return parsed, nil
+}
+
+// runExiftool implements the exiftool style invocation. Like exiftool, it either prints the tags
+// of the files as JSON, or removes their metadata in place, keeping each original next to it with
+// an _original suffix unless -overwrite_original is given, and prints how many files it updated,
+// followed by the statistics of the run, or only those as JSON with -stats_json.
+func runExiftool(args []string) {
+	parsed, err := parseExiftoolArgs(args)
+	if err != nil {
+		logs.Fatalf("%v", err)
+	}
+
+	if parsed.json {
+		if err := writeTagsJSON(os.Stdout, parsed.files); err != nil {
+			logs.Fatalf("%v", err)
+		}
+		return
+	}
+
+	// -all= removes the GPS tags along with everything else.
+	var opts []exif.Option
+	if parsed.gps && !parsed.all {
+		opts = append(opts, exif.WithGPSRemoval())
+	}
+	stats := sanitizeBatch(parsed.files, parsed.overwrite, opts)
+	if err := writeBatchStats(os.Stdout, stats, parsed.statsJSON); err != nil {
+		logs.Fatalf("%v", err)
+	}
+	if stats.Errors > 0 {
+		os.Exit(1)
+	}
+}
+
+// batchStats are the statistics of an exiftool style run removing metadata.
+type batchStats struct {
+	Processed int `json:"files_processed"`
+	Updated   int `json:"files_updated"`
+
+	// Clean is the number of files already free of the metadata to remove, left unchanged.
+	Clean int `json:"files_clean"`
+
+	// GPS is the number of files recording where they were taken.
+	GPS int `json:"files_with_gps"`
+
+	BytesSaved int     `json:"bytes_saved"`
+	Errors     int     `json:"errors"`
+	Elapsed    float64 `json:"elapsed_seconds"`
+}
+
+// sanitizeBatch removes the metadata of the files at paths in place, as sanitizeInPlace does, and
+// returns the statistics of the run. Files that could not be sanitized are logged.
+func sanitizeBatch(paths []string, overwrite bool, opts []exif.Option) batchStats {
+	start := time.Now()
+	var stats batchStats
+	for _, path := range paths {
+		stats.Processed++
+		report, changed, err := sanitizeInPlace(path, overwrite, opts)
+		if err != nil {
+			stats.Errors++
+			logs.Errorf("Could not sanitize %s: %v", path, err)
+			continue
+		}
+		if report.Summary != nil && report.Summary.GPS {
+			stats.GPS++
+		}
+		if !changed {
+			stats.Clean++
+			continue
+		}
+		stats.Updated++
+		stats.BytesSaved += report.BytesRemoved
+	}
+	stats.Elapsed = time.Since(start).Seconds()
+	return stats
+}
+
+// writeBatchStats writes stats to w: the counts exiftool prints followed by a summary, or a JSON
+// object if asJSON is set.
+func writeBatchStats(w io.Writer, stats batchStats, asJSON bool) error {
+	if asJSON {
+		return json.NewEncoder(w).Encode(stats)
+	}
+	fmt.Fprintf(w, "%5d image files updated\n", stats.Updated)
+	if stats.Clean > 0 {
+		fmt.Fprintf(w, "%5d image files unchanged\n", stats.Clean)
+	}
+	if stats.Errors > 0 {
+		fmt.Fprintf(w, "%5d files weren't updated due to errors\n", stats.Errors)
+	}
+	_, err := fmt.Fprintf(w, "Processed %d files in %s: %d already clean, %d with GPS data, %d bytes saved, %d errors\n",
+		stats.Processed, time.Duration(stats.Elapsed*float64(time.Second)).Round(time.Millisecond), stats.Clean, stats.GPS, stats.BytesSaved, stats.Errors)
+	return err
+}
+
+// sanitizeInPlace removes the metadata of the file at path, as opts set, and returns the report of
+// the sanitizer and whether there was any. The original is copied with an _original suffix, as exiftool does, unless
+// overwrite is set or such a backup already exists, which is kept. Files without metadata are left
+// untouched, and so is the file system if the file could not be replaced.
+func sanitizeInPlace(path string, overwrite bool, opts []exif.Option) (*exif.Report, bool, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	output := new(bytes.Buffer)
+	report, err := exif.SanitizeBytes(raw, output, opts...)
+	if err != nil {
+		return nil, false, err
+	}
+	if bytes.Equal(output.Bytes(), raw) {
+		return report, false, nil
+	}
+
+	// The sanitized copy is written next to the file and renamed over it, so that the file is
+	// never left half written.
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false, err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return nil, false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(output.Bytes()); err != nil {
+		tmp.Close()
+		return nil, false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, false, err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return nil, false, err
+	}
+
+	// The backup is written before the file is replaced, so that the original is never lost, and
+	// removed again if the file could not be, so that a later run does not keep it as the backup
+	// of what will then be another original.
+	backup := ""
+	if !overwrite {
+		if _, err := os.Stat(path + "_original"); os.IsNotExist(err) {
+			backup = path + "_original"
+			if err := ioutil.WriteFile(backup, raw, info.Mode().Perm()); err != nil {
+				os.Remove(backup)
+				return nil, false, err
+			}
+		}
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		if backup != "" {
+			os.Remove(backup)
+		}
+		return nil, false, err
+	}
+	return report, true, nil
+}
+
+// writeTagsJSON writes the EXIF tags of the files at paths to w as a JSON array with an object
+// per file, keyed by tag name along with the SourceFile key, as exiftool -j does. Tags found in
+// several IFDs, such as the thumbnail's, are reported once, from the first IFD holding them.
+func writeTagsJSON(w io.Writer, paths []string) error {
+	files := make([]map[string]string, 0, len(paths))
+	for _, path := range paths {
+		tags := map[string]string{"SourceFile": path}
+		input, err := openInput(path)
+		if err != nil {
+			return err
+		}
+		err = exif.Walk(input, func(ifd exif.IFDInfo, tag exif.Tag) error {
+			if name := exif.TagName(ifd, tag); tags[name] == "" {
+				tags[name] = exif.FormatTag(ifd, tag)
+			}
+			return nil
+		})
+		input.Close()
+		if err != nil {
+			return fmt.Errorf("could not read the EXIF data of %s: %v", path, err)
+		}
+		files = append(files, tags)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(files)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+func TestParseExiftoolArgs(t *testing.T) {
+	testTable := []struct {
+		Args     []string
+		Exiftool bool
+		Parsed   exiftoolArgs
+		Err      bool
+	}{
+		{Args: []string{"-all=", "a.jpg", "b.jpg"}, Exiftool: true, Parsed: exiftoolArgs{all: true, files: []string{"a.jpg", "b.jpg"}}},
+		{Args: []string{"a.jpg", "-gps:all=", "-overwrite_original"}, Exiftool: true, Parsed: exiftoolArgs{gps: true, overwrite: true, files: []string{"a.jpg"}}},
+		{Args: []string{"-j", "a.jpg"}, Exiftool: true, Parsed: exiftoolArgs{json: true, files: []string{"a.jpg"}}},
+		{Args: []string{"-json", "a.jpg"}, Exiftool: true, Parsed: exiftoolArgs{json: true, files: []string{"a.jpg"}}},
+		{Args: []string{"-all=", "-stats_json", "a.jpg"}, Exiftool: true, Parsed: exiftoolArgs{all: true, statsJSON: true, files: []string{"a.jpg"}}},
+		{Args: []string{"-all=", "-P", "a.jpg"}, Exiftool: true, Err: true},
+		{Args: []string{"-j", "-stats_json", "a.jpg"}, Exiftool: true, Err: true},
+		{Args: []string{"-all="}, Exiftool: true, Err: true},
+		{Args: []string{"-j", "-all=", "a.jpg"}, Exiftool: true, Err: true},
+		{Args: []string{"-overwrite_original", "a.jpg"}, Exiftool: true, Err: true},
+		{Args: []string{"-input", "a.jpg", "-jfif"}},
+	}
+
+	for _, test := range testTable {
+		if exiftool := isExiftoolStyle(test.Args); exiftool != test.Exiftool {
+			t.Errorf("%v: expected exiftool style %v, got %v", test.Args, test.Exiftool, exiftool)
+		}
+		if !test.Exiftool {
+			continue
+		}
+		parsed, err := parseExiftoolArgs(test.Args)
+		if test.Err {
+			if err == nil {
+				t.Errorf("%v: expected an error", test.Args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.Args, err)
+		} else if !reflect.DeepEqual(parsed, test.Parsed) {
+			t.Errorf("%v: expected %+v, got %+v", test.Args, test.Parsed, parsed)
+		}
+	}
+}
+
+func TestSanitizeInPlace(t *testing.T) {
+	testTable := []struct {
+		Name      string
+		Data      []byte
+		Overwrite bool
+		Changed   bool
+		Backup    bool
+	}{
+		{Name: "exif", Data: exifJPEG, Changed: true, Backup: true},
+		{Name: "overwrite", Data: exifJPEG, Overwrite: true, Changed: true},
+		{Name: "clean", Data: cleanJPEG},
+	}
+
+	for _, test := range testTable {
+		path := filepath.Join(t.TempDir(), "photo.jpg")
+		if err := ioutil.WriteFile(path, test.Data, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		_, changed, err := sanitizeInPlace(path, test.Overwrite, nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if changed != test.Changed {
+			t.Errorf("%s: expected changed %v, got %v", test.Name, test.Changed, changed)
+		}
+		if data, _ := ioutil.ReadFile(path); !bytes.Equal(data, cleanJPEG) {
+			t.Errorf("%s: expected the file to be sanitized, got %x", test.Name, data)
+		}
+		backup, err := ioutil.ReadFile(path + "_original")
+		if test.Backup && !bytes.Equal(backup, test.Data) {
+			t.Errorf("%s: expected the original to be kept, got %x, %v", test.Name, backup, err)
+		}
+		if !test.Backup && !os.IsNotExist(err) {
+			t.Errorf("%s: expected no backup, got %v", test.Name, err)
+		}
+		if entries, _ := os.ReadDir(filepath.Dir(path)); (test.Backup && len(entries) != 2) || (!test.Backup && len(entries) != 1) {
+			t.Errorf("%s: expected no temporary file to be left, got %v", test.Name, entries)
+		}
+	}
+}
+
+func TestSanitizeInPlaceGPS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	if err := ioutil.WriteFile(path, exifJPEG, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// exifJPEG has no GPS tags, so that removing them leaves it unchanged.
+	_, changed, err := sanitizeInPlace(path, false, []exif.Option{exif.WithGPSRemoval()})
+	if err != nil || changed {
+		t.Errorf("Expected the file to be left unchanged, got %v, %v", changed, err)
+	}
+	if _, err := os.Stat(path + "_original"); !os.IsNotExist(err) {
+		t.Errorf("Expected no backup of an unchanged file, got %v", err)
+	}
+}
+
+func TestSanitizeBatch(t *testing.T) {
+	dir := t.TempDir()
+	exifPath, cleanPath := filepath.Join(dir, "exif.jpg"), filepath.Join(dir, "clean.jpg")
+	ioutil.WriteFile(exifPath, exifJPEG, 0600)
+	ioutil.WriteFile(cleanPath, cleanJPEG, 0600)
+
+	stats := sanitizeBatch([]string{exifPath, cleanPath, filepath.Join(dir, "missing.jpg")}, true, nil)
+	stats.Elapsed = 0
+	expected := batchStats{Processed: 3, Updated: 1, Clean: 1, BytesSaved: len(exifJPEG) - len(cleanJPEG), Errors: 1}
+	if stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+}
+
+func TestWriteBatchStats(t *testing.T) {
+	stats := batchStats{Processed: 4, Updated: 2, Clean: 1, GPS: 2, BytesSaved: 1234, Errors: 1, Elapsed: 0.25}
+
+	output := new(bytes.Buffer)
+	if err := writeBatchStats(output, stats, false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "    2 image files updated\n" +
+		"    1 image files unchanged\n" +
+		"    1 files weren't updated due to errors\n" +
+		"Processed 4 files in 250ms: 1 already clean, 2 with GPS data, 1234 bytes saved, 1 errors\n"
+	if output.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, output.String())
+	}
+
+	output.Reset()
+	if err := writeBatchStats(output, stats, true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var decoded batchStats
+	if err := json.Unmarshal(output.Bytes(), &decoded); err != nil || decoded != stats {
+		t.Errorf("Expected %+v as JSON, got %s: %v", stats, output, err)
+	}
+	if !bytes.Contains(output.Bytes(), []byte(`"files_with_gps":2`)) {
+		t.Errorf("Expected the JSON keys to be snake case, got %s", output)
+	}
+}
+
+func TestWriteTagsJSON(t *testing.T) {
+	dir := t.TempDir()
+	exifPath, cleanPath := filepath.Join(dir, "exif.jpg"), filepath.Join(dir, "clean.jpg")
+	ioutil.WriteFile(exifPath, exifJPEG, 0600)
+	ioutil.WriteFile(cleanPath, cleanJPEG, 0600)
+
+	output := new(bytes.Buffer)
+	if err := writeTagsJSON(output, []string{exifPath, cleanPath}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var files []map[string]string
+	if err := json.Unmarshal(output.Bytes(), &files); err != nil {
+		t.Fatalf("Expected a JSON array, got %s: %v", output, err)
+	}
+	expected := []map[string]string{{"SourceFile": exifPath, "Make": "ACM"}, {"SourceFile": cleanPath}}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+}
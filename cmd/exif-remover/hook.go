@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// hookMarker identifies the pre-commit hooks written by hook install, which it may overwrite.
+const hookMarker = "# Installed by exif-remover hook install."
+
+// runHook implements the hook subcommand: hook install sets up a git pre-commit hook in the
+// repository of the working directory, which runs hook run to check the images staged for each
+// commit.
+func runHook(args []string) {
+	if len(args) == 0 || (args[0] != "install" && args[0] != "run") {
+		fmt.Fprintln(os.Stderr, "Usage: exif-remover hook install|run [flags]")
+		os.Exit(2)
+	}
+	flags := flag.NewFlagSet("hook "+args[0], flag.ExitOnError)
+	mode := flags.String("mode", "reject", "What to do with staged images carrying metadata: reject the commit, or sanitize them.")
+	force := flags.Bool("force", false, "Replace an existing pre-commit hook not installed by exif-remover.")
+	setupLogging := logFlags(flags)
+	flags.Parse(args[1:])
+	setupLogging()
+	if *mode != "reject" && *mode != "sanitize" {
+		logs.Fatalf("Unknown hook mode %q", *mode)
+	}
+
+	if args[0] == "install" {
+		path, err := installHook(*mode, *force)
+		if err != nil {
+			logs.Fatalf("Could not install the pre-commit hook: %v", err)
+		}
+		fmt.Printf("Installed the pre-commit hook %s, which will %s staged images carrying metadata.\n", path, *mode)
+		return
+	}
+
+	found, err := checkStaged(*mode == "sanitize")
+	if err != nil {
+		logs.Fatalf("Could not check the staged images: %v", err)
+	}
+	if found > 0 && *mode == "reject" {
+		fmt.Printf("%d staged images carry metadata. Remove it with exif-remover, or commit with --no-verify to keep it.\n", found)
+		os.Exit(1)
+	}
+}
+
+// installHook writes the pre-commit hook of the repository, running this executable with the
+// given mode, and returns its path. An existing hook is only replaced if it was installed by
+// exif-remover, or if force is true.
+func installHook(mode string, force bool) (string, error) {
+	dir, err := git("rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(strings.TrimSpace(string(dir)), "pre-commit")
+	if existing, err := ioutil.ReadFile(path); err == nil && !force && !bytes.Contains(existing, []byte(hookMarker)) {
+		return "", fmt.Errorf("%s already exists; run with -force to replace it", path)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	script := fmt.Sprintf("#!/bin/sh\n%s\nexec '%s' hook run -mode %s\n", hookMarker, strings.Replace(executable, "'", `'\''`, -1), mode)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	return path, ioutil.WriteFile(path, []byte(script), 0755)
+}
+
+// checkStaged checks the content staged for commit of the added, copied and modified files, and
+// lists those carrying metadata. If sanitize is true, their staged content is replaced with
+// their sanitized content, as is their working tree file if it has no unstaged changes. It
+// returns the number of files carrying metadata, sanitized or not.
+func checkStaged(sanitize bool) (int, error) {
+	names, err := git("diff", "--cached", "--name-only", "--diff-filter=ACM", "-z")
+	if err != nil {
+		return 0, err
+	}
+	top, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return 0, err
+	}
+	root := strings.TrimSpace(string(top))
+
+	found := 0
+	for _, name := range strings.Split(strings.TrimRight(string(names), "\x00"), "\x00") {
+		if name == "" {
+			continue
+		}
+		staged, err := git("cat-file", "blob", ":"+name)
+		if err != nil {
+			return found, err
+		}
+		finding, ok, err := checkData(staged)
+		switch {
+		case err != nil:
+			return found, fmt.Errorf("%s: %v", name, err)
+		case !ok || finding == "":
+			continue
+		}
+		found++
+		if !sanitize {
+			annotate("text", name, finding)
+			continue
+		}
+		if err := sanitizeStaged(root, name, staged); err != nil {
+			return found, fmt.Errorf("%s: %v", name, err)
+		}
+		annotate("text", name, "removed "+finding)
+	}
+	return found, nil
+}
+
+// sanitizeStaged replaces the staged content of the file name, relative to the root of the
+// repository, with staged sanitized, and its working tree file too if it has no unstaged changes.
+func sanitizeStaged(root, name string, staged []byte) error {
+	output := new(bytes.Buffer)
+	if _, err := exif.Sanitize(bytes.NewReader(staged), output, exif.WithTrailerRemoval(true), exif.WithLogger(debugLogger{logs})); err != nil {
+		return err
+	}
+
+	entry, err := git("ls-files", "--stage", "-z", "--", name)
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(entry))
+	if len(fields) < 1 {
+		return fmt.Errorf("the file is not in the index")
+	}
+	hash, err := gitWithInput(output.Bytes(), "hash-object", "-w", "--stdin")
+	if err != nil {
+		return err
+	}
+	cacheInfo := fmt.Sprintf("%s,%s,%s", fields[0], strings.TrimSpace(string(hash)), name)
+	if _, err := git("update-index", "--cacheinfo", cacheInfo); err != nil {
+		return err
+	}
+
+	path := filepath.Join(root, filepath.FromSlash(name))
+	if current, err := ioutil.ReadFile(path); err == nil && bytes.Equal(current, staged) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, output.Bytes(), info.Mode())
+	}
+	logs.Warnf("%s has unstaged changes, which still carry metadata", name)
+	return nil
+}
+
+// git runs git with args in the working directory and returns its output.
+func git(args ...string) ([]byte, error) {
+	return gitWithInput(nil, args...)
+}
+
+// gitWithInput runs git with args, writing input to its standard input, and returns its output.
+func gitWithInput(input []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
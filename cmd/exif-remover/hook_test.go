@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// initRepo creates a git repository in a temporary directory and makes it the working directory.
+func initRepo(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if _, err := git("init", "-q"); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestInstallHook(t *testing.T) {
+	dir := initRepo(t)
+	hook := filepath.Join(dir, ".git", "hooks", "pre-commit")
+
+	testTable := []struct {
+		Name     string
+		Existing string
+		Force    bool
+		Err      bool
+	}{
+		{Name: "new"},
+		{Name: "installed by exif-remover", Existing: "#!/bin/sh\n" + hookMarker + "\n"},
+		{Name: "foreign", Existing: "#!/bin/sh\nmake lint\n", Err: true},
+		{Name: "foreign forced", Existing: "#!/bin/sh\nmake lint\n", Force: true},
+	}
+
+	for _, test := range testTable {
+		if test.Existing != "" {
+			if err := ioutil.WriteFile(hook, []byte(test.Existing), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		path, err := installHook("sanitize", test.Force)
+		if (err != nil) != test.Err {
+			t.Errorf("%s: expected an error %v, got %v", test.Name, test.Err, err)
+			continue
+		}
+		script, _ := ioutil.ReadFile(hook)
+		if test.Err {
+			if string(script) != test.Existing {
+				t.Errorf("%s: expected the hook to be kept, got %q", test.Name, script)
+			}
+			continue
+		}
+		if !strings.HasSuffix(path, filepath.Join("hooks", "pre-commit")) || !bytes.Contains(script, []byte(hookMarker)) ||
+			!bytes.Contains(script, []byte("hook run -mode sanitize")) {
+			t.Errorf("%s: expected the hook to be installed at %s, got %q", test.Name, path, script)
+		}
+	}
+}
+
+func TestCheckStaged(t *testing.T) {
+	testTable := []struct {
+		Name     string
+		Sanitize bool
+		Unstaged bool
+		Staged   []byte
+		Working  []byte
+	}{
+		{Name: "reject", Staged: exifJPEG, Working: exifJPEG},
+		{Name: "sanitize", Sanitize: true, Staged: cleanJPEG, Working: cleanJPEG},
+		{Name: "sanitize with unstaged changes", Sanitize: true, Unstaged: true, Staged: cleanJPEG, Working: append(append([]byte{}, exifJPEG...), 0)},
+	}
+
+	for _, test := range testTable {
+		dir := initRepo(t)
+		for name, data := range map[string][]byte{"photo.jpg": exifJPEG, "clean.jpg": cleanJPEG, "notes.txt": []byte("notes")} {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := git("add", "."); err != nil {
+			t.Fatal(err)
+		}
+		if test.Unstaged {
+			ioutil.WriteFile(filepath.Join(dir, "photo.jpg"), test.Working, 0644)
+		}
+
+		found, err := checkStaged(test.Sanitize)
+		if err != nil || found != 1 {
+			t.Errorf("%s: expected 1 file carrying metadata, got %d and %v", test.Name, found, err)
+		}
+		staged, _ := git("cat-file", "blob", ":photo.jpg")
+		working, _ := ioutil.ReadFile(filepath.Join(dir, "photo.jpg"))
+		if !bytes.Equal(staged, test.Staged) || !bytes.Equal(working, test.Working) {
+			t.Errorf("%s: expected %x staged and %x in the working tree, got %x and %x", test.Name, test.Staged, test.Working, staged, working)
+		}
+	}
+}
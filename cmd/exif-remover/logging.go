@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logLevel is the severity of a log message. Messages above the logger's level are dropped.
+type logLevel int
+
+const (
+	levelError logLevel = iota
+	levelWarn
+	levelInfo
+	levelDebug
+)
+
+var levelNames = map[logLevel]string{
+	levelError: "error",
+	levelWarn:  "warn",
+	levelInfo:  "info",
+	levelDebug: "debug",
+}
+
+// logger is a leveled logger writing either plain text or JSON lines.
+type logger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	level  logLevel
+	asJSON bool
+}
+
+// logs is the logger used throughout the CLI. By default only warnings and errors are shown.
+var logs = &logger{out: os.Stderr, level: levelWarn}
+
+// configure sets the verbosity and output format of the logger.
+func (l *logger) configure(verbose, veryVerbose bool, format string) error {
+	switch {
+	case veryVerbose:
+		l.level = levelDebug
+	case verbose:
+		l.level = levelInfo
+	}
+
+	switch format {
+	case "text":
+		l.asJSON = false
+	case "json":
+		l.asJSON = true
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	return nil
+}
+
+func (l *logger) Errorf(format string, args ...interface{}) { l.logf(levelError, format, args...) }
+func (l *logger) Warnf(format string, args ...interface{})  { l.logf(levelWarn, format, args...) }
+func (l *logger) Infof(format string, args ...interface{})  { l.logf(levelInfo, format, args...) }
+func (l *logger) Debugf(format string, args ...interface{}) { l.logf(levelDebug, format, args...) }
+
+// Fatalf logs an error and exits.
+func (l *logger) Fatalf(format string, args ...interface{}) {
+	l.logf(levelError, format, args...)
+	os.Exit(1)
+}
+
+func (l *logger) logf(level logLevel, format string, args ...interface{}) {
+	if level > l.level {
+		return
+	}
+
+	now := time.Now()
+	msg := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+
+	var line []byte
+	if l.asJSON {
+		line, _ = json.Marshal(struct {
+			Time  string `json:"time"`
+			Level string `json:"level"`
+			Msg   string `json:"msg"`
+		}{now.Format(time.RFC3339Nano), levelNames[level], msg})
+	} else {
+		line = []byte(fmt.Sprintf("%s %-5s %s", now.Format("2006/01/02 15:04:05"), strings.ToUpper(levelNames[level]), msg))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(append(line, '\n'))
+}
+
+// debugLogger adapts the logger to the exif.Logger interface, logging at debug level, so that
+// the per-offset diagnostics of the exif package only show up with -vv.
+type debugLogger struct {
+	l *logger
+}
+
+func (d debugLogger) Printf(format string, args ...interface{}) {
+	d.l.Debugf(format, args...)
+}
@@ -1,35 +1,239 @@
 package main
 
 import (
-	"bytes"
+	"crypto/sha256"
 	"flag"
+	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"os"
+	"strings"
 
 	"github.com/nimrodshn/mattermost-exif-plugin/exif"
 )
 
 func main() {
-	path := flag.String("input", "", "Path to an image file with EXIF IFD.")
-	output_path := flag.String("output", "", "Path to output image.")
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServe(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "show" {
+		runShow(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		runCheck(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "hook" {
+		runHook(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		runRestore(os.Args[2:])
+		return
+	}
+	if isExiftoolStyle(os.Args[1:]) {
+		runExiftool(os.Args[1:])
+		return
+	}
+
+	path := flag.String("input", "", "Path to an image file with EXIF IFD. May also be an http(s):// URL or an s3://bucket/key path.")
+	output_path := flag.String("output", "", "Path to output image. May also be an s3://bucket/key path.")
+	bench := flag.Bool("bench", false, "Benchmark the processing of the input file and any further files given as arguments instead of writing output.")
+	benchN := flag.Int("bench-n", 100, "Number of iterations over the input files in benchmark mode.")
+	benchMode := flag.String("bench-mode", "strip,reencode", "Comma separated processing paths to benchmark: strip, reencode.")
+	convert := flag.String("convert", "", "Convert HEIC input to the given format before sanitizing it. Only jpeg is supported.")
+	stripTrailer := flag.Bool("strip-trailer", false, "Remove data appended after the end of the image, such as motion photo videos.")
+	jfif := flag.Bool("jfif", false, "Add a JFIF header to images left without any header once their EXIF data is removed.")
+	timestamps := flag.String("timestamps", "", "Keep the EXIF data and only anonymize timestamps: remove or round-to-day.")
+	deviceIDs := flag.Bool("device-ids", false, "Keep the EXIF data and only remove serial numbers, owner names, unique image IDs and maker notes.")
+	motionVideo := flag.String("motion-video", "", "Save the video of a motion photo to the given path before it is removed with --strip-trailer.")
+	icc := flag.String("icc", "preserve", "What to do with ICC color profiles: preserve, strip or replace-with-srgb.")
+	sidecars := flag.String("sidecars", "keep", "What to do with XMP sidecar files next to a local input: keep (warn only), delete or sanitize.")
+	dryRun := flag.Bool("dry-run", false, "Only report how many bytes of metadata the input carries, without writing output.")
+	verify := flag.Bool("verify", false, "Re-read the output to confirm it decodes and contains no EXIF data, and print the input and output SHA-256.")
+	useMmap := flag.Bool("mmap", false, "Map local inputs into memory rather than reading them, to sanitize and verify large files without copying them.")
+	spillThreshold := flag.Int64("spill-threshold", defaultSpillThreshold, "Size in bytes above which remote inputs are spilled to a temporary file rather than held in memory.")
+	setupLogging := logFlags(flag.CommandLine)
 	flag.Parse()
+	setupLogging()
+	// Check the sidecar mode before writing anything, rather than failing once the output is.
+	if !isSidecarMode(*sidecars) {
+		logs.Fatalf("Unknown sidecar mode %q", *sidecars)
+	}
 
-	raw, err := ioutil.ReadFile(*path)
+	if *bench {
+		paths := flag.Args()
+		if *path != "" {
+			paths = append([]string{*path}, paths...)
+		}
+		if err := runBench(paths, *benchN, strings.Split(*benchMode, ",")); err != nil {
+			logs.Fatalf("Error while benchmarking: %v", err)
+		}
+		return
+	}
 
+	input, err := openInput(*path)
 	if err != nil {
-		panic(err)
+		logs.Fatalf("Error while opening input file: %v", err)
 	}
+	defer input.Close()
 
-	input := bytes.NewReader(raw)
-	output := new(bytes.Buffer)
+	if *dryRun {
+		n, err := exif.Estimate(input)
+		if err != nil {
+			logs.Fatalf("Error while reading input file: %v", err)
+		}
+		fmt.Printf("%s: %d bytes of metadata\n", *path, n)
+		return
+	}
 
-	err = exif.Discard(input, output)
+	output, err := createOutput(*output_path)
 	if err != nil {
-		log.Fatalf("Error occured while discarding exif headers: %v", err)
+		logs.Fatalf("Error while opening output file: %v", err)
+	}
+
+	iccPolicy, ok := exif.ParseICCPolicy(*icc)
+	if !ok {
+		logs.Fatalf("Unknown ICC profile policy %q", *icc)
+	}
+	opts := []exif.Option{
+		exif.WithTrailerRemoval(*stripTrailer),
+		exif.WithTrailerDetection(true),
+		exif.WithJFIFRegeneration(*jfif),
+		exif.WithICCPolicy(iccPolicy),
+		exif.WithLogger(debugLogger{logs}),
+	}
+	if *timestamps != "" {
+		policy, ok := exif.ParseTimestampPolicy(*timestamps)
+		if !ok {
+			logs.Fatalf("Unknown timestamp policy %q", *timestamps)
+		}
+		opts = append(opts, exif.WithTimestampPolicy(policy))
+	}
+	if *deviceIDs {
+		opts = append(opts, exif.WithDeviceFingerprintRemoval())
+	}
+
+	inputHash := sha256.New()
+	var report *exif.Report
+	if *convert != "" {
+		var source io.Reader
+		source, err = convertInput(io.TeeReader(input, inputHash), *convert)
+		if err != nil {
+			logs.Fatalf("Error while converting input file: %v", err)
+		}
+		report, err = exif.Sanitize(source, output, opts...)
+	} else {
+		// Sanitizing from a ReadSeeker copies the media data of videos without reading it into
+		// memory.
+		var source readSeekCloser
+		source, err = spill(input, *spillThreshold)
+		if err != nil {
+			logs.Fatalf("Error while reading input file: %v", err)
+		}
+		defer source.Close()
+		if file := localFile(source); *useMmap && file != nil {
+			// The report may refer to the mapped input, such as for the video of a motion photo,
+			// so it is only released once done with.
+			var data []byte
+			var release func() error
+			data, release, err = loadFile(file, true)
+			if err != nil {
+				logs.Fatalf("Error while reading input file: %v", err)
+			}
+			defer release()
+			inputHash.Write(data)
+			report, err = exif.SanitizeBytes(data, output, opts...)
+		} else {
+			if err := checkSpilled(source, *spillThreshold, "mp4", "mov"); err != nil {
+				logs.Fatalf("Error while reading input file: %v; raise -spill-threshold or use -mmap", err)
+			}
+			if *verify {
+				if err := hashInput(source, inputHash); err != nil {
+					logs.Fatalf("Error while reading input file: %v", err)
+				}
+			}
+			report, err = exif.SanitizeSeeker(source, output, opts...)
+		}
 	}
-	err = ioutil.WriteFile(*output_path, output.Bytes(), os.ModePerm)
 	if err != nil {
-		log.Fatalf("Error while writing to output file: %v", err)
+		logs.Fatalf("Error occured while discarding exif headers: %v", err)
+	}
+	if report.Summary != nil {
+		logs.Infof("EXIF data: %s", report.Summary)
+	}
+	if report.ExifEdited {
+		logs.Infof("Edited %d EXIF tags", report.TagsEdited)
+	} else if !report.ExifRemoved {
+		logs.Warnf("No EXIF data found in %s", *path)
+	}
+	if report.MetadataRemoved {
+		logs.Infof("Removed XMP, comment and text metadata")
+	}
+	if report.Frames > 0 {
+		logs.Infof("Kept %d animation frames playing for %v", report.Frames, report.Duration)
+	}
+	if report.MotionPhoto {
+		logs.Infof("%s is a motion photo", *path)
+		if *motionVideo != "" {
+			if report.MotionPhotoVideo == nil {
+				logs.Fatalf("Could not find the video of the motion photo %s", *path)
+			}
+			if err := ioutil.WriteFile(*motionVideo, report.MotionPhotoVideo, 0644); err != nil {
+				logs.Fatalf("Error while writing the motion photo video: %v", err)
+			}
+			logs.Infof("Wrote the motion photo video to %s", *motionVideo)
+		}
+	}
+	if report.TrailerSize > 0 && !report.TrailerRemoved {
+		logs.Warnf("%s has %d bytes of data after the end of the image; use --strip-trailer to remove them", *path, report.TrailerSize)
+	}
+	if report.SRGBAdded {
+		logs.Infof("Replaced the ICC profile with a minimal sRGB profile")
+	} else if report.ICCRemoved {
+		logs.Infof("Removed the ICC profile")
+	}
+	logs.Infof("Removed %d bytes", report.BytesRemoved)
+	err = output.Close()
+	if err != nil {
+		logs.Fatalf("Error while writing to output file: %v", err)
+	}
+	logs.Infof("Wrote %s", *output_path)
+
+	if err := handleSidecars(*path, *sidecars); err != nil {
+		logs.Fatalf("Error while handling sidecar files: %v", err)
+	}
+
+	if *verify {
+		outputHash, err := verifyOutput(*output_path, report.ExifEdited, *useMmap)
+		if err != nil {
+			logs.Fatalf("Verification of %s failed: %v", *output_path, err)
+		}
+		fmt.Printf("%s: verified\n  input  sha256: %x\n  output sha256: %s\n", *output_path, inputHash.Sum(nil), outputHash)
+	}
+}
+
+// hashInput writes the content of input to hash, and seeks back to its start.
+func hashInput(input io.ReadSeeker, hash io.Writer) error {
+	if _, err := io.Copy(hash, input); err != nil {
+		return err
+	}
+	_, err := input.Seek(0, io.SeekStart)
+	return err
+}
+
+// logFlags registers the logging flags on flags. The returned function configures the logger
+// once the flags are parsed.
+func logFlags(flags *flag.FlagSet) func() {
+	verbose := flags.Bool("v", false, "Verbose output.")
+	veryVerbose := flags.Bool("vv", false, "Debug output, including the EXIF parser's diagnostics.")
+	format := flags.String("log-format", "text", "Log format: text or json.")
+
+	return func() {
+		if err := logs.configure(*verbose, *veryVerbose, *format); err != nil {
+			logs.Fatalf("%v", err)
+		}
 	}
 }
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+)
+
+// errMmapUnsupported is returned by mmapFile on systems it does not support.
+var errMmapUnsupported = errors.New("memory mapping is not supported on this system")
+
+// loadFile returns the content of the local file f, mapped into memory rather than read if useMmap
+// is set, so that multi-hundred-MB files are not copied before being sanitized or checked, and
+// reading them only takes the pages the sanitizer touches. Files that cannot be mapped are read.
+// The returned function releases the content, which must not be used afterwards.
+func loadFile(f *os.File, useMmap bool) ([]byte, func() error, error) {
+	if useMmap {
+		data, err := mmapFile(f)
+		if err == nil {
+			return data, func() error { return munmap(data) }, nil
+		}
+		logs.Debugf("Reading %s, as it could not be mapped into memory: %v", f.Name(), err)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+func mmapFile(f *os.File) ([]byte, error) {
+	return nil, errMmapUnsupported
+}
+
+func munmap(data []byte) error {
+	return nil
+}
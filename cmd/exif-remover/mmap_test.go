@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	testTable := []struct {
+		Name    string
+		Content []byte
+		Mmap    bool
+	}{
+		{Name: "read", Content: exifJPEG},
+		{Name: "mapped", Content: exifJPEG, Mmap: true},
+		{Name: "empty", Content: []byte{}, Mmap: true},
+	}
+
+	for _, test := range testTable {
+		path := filepath.Join(dir, test.Name)
+		if err := ioutil.WriteFile(path, test.Content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, release, err := loadFile(f, test.Mmap)
+		if err != nil || !bytes.Equal(data, test.Content) {
+			t.Errorf("%s: expected %x, got %x and %v", test.Name, test.Content, data, err)
+		}
+		if err == nil {
+			if err := release(); err != nil {
+				t.Errorf("%s: %v", test.Name, err)
+			}
+		}
+		f.Close()
+	}
+}
+
+func TestCheckFileMmap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	if err := ioutil.WriteFile(path, exifJPEG, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, useMmap := range []bool{false, true} {
+		finding, ok, err := checkFile(path, useMmap)
+		if finding != "EXIF data (ACM, GPS: no)" || !ok || err != nil {
+			t.Errorf("mmap %v: expected the EXIF data to be found, got %q, %v and %v", useMmap, finding, ok, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/internal/s3"
+)
+
+// openInput opens the image at path for reading. Besides local files, path may be an
+// http(s):// URL or an s3://bucket/key location.
+func openInput(path string) (io.ReadCloser, error) {
+	switch {
+	case strings.HasPrefix(path, "http://"), strings.HasPrefix(path, "https://"):
+		resp, err := http.Get(path)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("fetching %s: unexpected status %s", path, resp.Status)
+		}
+		return resp.Body, nil
+	case strings.HasPrefix(path, "s3://"):
+		bucket, key, err := parseS3Path(path)
+		if err != nil {
+			return nil, err
+		}
+		return s3.NewClient().Get(bucket, key)
+	default:
+		return os.Open(path)
+	}
+}
+
+// createOutput opens path for writing the sanitized image. Besides local files, path may be
+// an s3://bucket/key location, in which case the object is uploaded when the writer is closed.
+func createOutput(path string) (io.WriteCloser, error) {
+	if strings.HasPrefix(path, "s3://") {
+		bucket, key, err := parseS3Path(path)
+		if err != nil {
+			return nil, err
+		}
+		return &s3Writer{client: s3.NewClient(), bucket: bucket, key: key}, nil
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+}
+
+// s3Writer buffers the written object and uploads it on Close, since S3 requires the
+// content length up front.
+type s3Writer struct {
+	client *s3.Client
+	bucket string
+	key    string
+	buff   bytes.Buffer
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	return w.buff.Write(p)
+}
+
+func (w *s3Writer) Close() error {
+	return w.client.Put(w.bucket, w.key, w.buff.Bytes())
+}
+
+// isRemote reports whether path is an http(s):// URL or an s3://bucket/key location rather than
+// a local file.
+func isRemote(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "s3://")
+}
+
+// parseS3Path splits an s3://bucket/key location into its bucket and key.
+func parseS3Path(path string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "s3://"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid s3 path %q: expected s3://bucket/key", path)
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// runRestore implements the restore subcommand: it puts back the originals kept with an _original
+// suffix by the exiftool style invocation next to the files it sanitized in place, so that a batch
+// run over the wrong files can be undone.
+func runRestore(args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	force := flags.Bool("force", false, "Restore the originals even over files changed since they were sanitized.")
+	setupLogging := logFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: exif-remover restore [flags] <file>...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	setupLogging()
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	restored, failed := 0, 0
+	for _, path := range flags.Args() {
+		if err := restoreOriginal(path, *force); err != nil {
+			failed++
+			logs.Errorf("Could not restore %s: %v", path, err)
+			continue
+		}
+		restored++
+	}
+	fmt.Printf("%5d image files restored\n", restored)
+	if failed > 0 {
+		fmt.Printf("%5d files weren't restored due to errors\n", failed)
+		os.Exit(1)
+	}
+}
+
+// restoreOriginal replaces the file at path, or whose backup path is, with its _original backup,
+// which is removed. Unless force is set, the SHA-256 of the file must be that of the sanitized
+// copy of the backup, as -all= or -gps:all= wrote it, so that changes made to it since are not
+// lost.
+func restoreOriginal(path string, force bool) error {
+	path = strings.TrimSuffix(path, "_original")
+	backup := path + "_original"
+	original, err := ioutil.ReadFile(backup)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no backup %s to restore", backup)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !force {
+		current, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil && !sanitizedFrom(current, original) {
+			return fmt.Errorf("%s changed since it was sanitized; use -force to restore %s over it anyway", path, backup)
+		}
+	}
+	return os.Rename(backup, path)
+}
+
+// sanitizedFrom reports whether current is the copy of original sanitized in place by the exiftool
+// style invocation, with any of the options it uses.
+func sanitizedFrom(current, original []byte) bool {
+	sum := sha256.Sum256(current)
+	for _, opts := range [][]exif.Option{nil, {exif.WithGPSRemoval()}} {
+		output := new(bytes.Buffer)
+		if _, err := exif.SanitizeBytes(original, output, opts...); err == nil && sha256.Sum256(output.Bytes()) == sum {
+			return true
+		}
+	}
+	return false
+}
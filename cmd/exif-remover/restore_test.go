@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRestoreOriginal(t *testing.T) {
+	testTable := []struct {
+		Name     string
+		Current  []byte
+		Backup   bool
+		Force    bool
+		Arg      string
+		Restored bool
+	}{
+		{Name: "sanitized", Current: cleanJPEG, Backup: true, Restored: true},
+		{Name: "backup given", Current: cleanJPEG, Backup: true, Arg: "photo.jpg_original", Restored: true},
+		{Name: "removed", Backup: true, Restored: true},
+		{Name: "changed", Current: []byte("edited since"), Backup: true},
+		{Name: "changed forced", Current: []byte("edited since"), Backup: true, Force: true, Restored: true},
+		{Name: "no backup", Current: cleanJPEG},
+	}
+
+	for _, test := range testTable {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "photo.jpg")
+		if test.Current != nil {
+			if err := ioutil.WriteFile(path, test.Current, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if test.Backup {
+			if err := ioutil.WriteFile(path+"_original", exifJPEG, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		arg := path
+		if test.Arg != "" {
+			arg = filepath.Join(dir, test.Arg)
+		}
+
+		err := restoreOriginal(arg, test.Force)
+		if test.Restored != (err == nil) {
+			t.Errorf("%s: expected restored %v, got %v", test.Name, test.Restored, err)
+			continue
+		}
+		data, _ := ioutil.ReadFile(path)
+		_, backupErr := os.Stat(path + "_original")
+		if test.Restored && (!bytes.Equal(data, exifJPEG) || !os.IsNotExist(backupErr)) {
+			t.Errorf("%s: expected the original to replace the file and its backup, got %x, %v", test.Name, data, backupErr)
+		}
+		if !test.Restored && !bytes.Equal(data, test.Current) {
+			t.Errorf("%s: expected the file to be left unchanged, got %x", test.Name, data)
+		}
+	}
+}
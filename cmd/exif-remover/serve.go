@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// maxUploadSize bounds the size of images accepted by the HTTP server.
+const maxUploadSize = 64 << 20
+
+// runServe implements the serve subcommand, which runs exif-remover as an HTTP sanitization
+// service. Images POSTed to / are returned with their EXIF data removed, along with report
+// headers describing what was removed.
+func runServe(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := flags.String("listen", ":8080", "Address to listen on.")
+	spillThreshold := flags.Int64("spill-threshold", defaultSpillThreshold, "Size in bytes above which uploads and their sanitized copies are spilled to temporary files rather than held in memory.")
+	setupLogging := logFlags(flags)
+	flags.Parse(args)
+	setupLogging()
+
+	http.HandleFunc("/", handleSanitize(*spillThreshold))
+
+	logs.Infof("Listening on %s", *listen)
+	logs.Fatalf("%v", http.ListenAndServe(*listen, nil))
+}
+
+// handleSanitize returns the handler of the images POSTed to the service. Uploads larger than
+// spillThreshold bytes are spilled to a temporary file, their EXIF data removed by seeking over the
+// other segments of JPEG images, and the sanitized copy written to another temporary file, so that
+// large images need not fit in memory.
+func handleSanitize(spillThreshold int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		input := &countingReader{r: http.MaxBytesReader(w, r.Body, maxUploadSize)}
+		source, err := spill(input, spillThreshold)
+		if err != nil {
+			logs.Warnf("Could not read upload from %s: %v", r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer source.Close()
+		if err := checkSpilled(source, spillThreshold, "jpeg"); err != nil {
+			logs.Warnf("Refused upload from %s: %v", r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		output := new(bytes.Buffer)
+		var sanitized io.Writer = output
+		var spool *tempFile
+		if _, spilled := source.(*tempFile); spilled {
+			if spool, err = newTempFile(); err != nil {
+				logs.Errorf("Could not create a temporary file: %v", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			defer spool.Close()
+			sanitized = spool
+		}
+		if err := exif.DiscardSeeker(source, sanitized); err != nil {
+			logs.Warnf("Could not sanitize upload from %s: %v", r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		var body io.Reader = output
+		size := int64(output.Len())
+		if spool != nil {
+			size, err = spool.Seek(0, io.SeekCurrent)
+			if err == nil {
+				_, err = spool.Seek(0, io.SeekStart)
+			}
+			if err != nil {
+				logs.Errorf("Could not read the sanitized upload: %v", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			body = spool
+		}
+
+		if contentType := r.Header.Get("Content-Type"); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.Header().Set("X-Exif-Input-Size", strconv.FormatInt(input.n, 10))
+		w.Header().Set("X-Exif-Bytes-Removed", strconv.FormatInt(input.n-size, 10))
+		logs.Infof("Sanitized upload from %s: removed %d bytes", r.RemoteAddr, input.n-size)
+		if _, err := io.Copy(w, body); err != nil {
+			logs.Errorf("Error while writing response: %v", err)
+		}
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleSanitize(t *testing.T) {
+	testTable := []struct {
+		Name      string
+		Method    string
+		Body      []byte
+		Threshold int64
+		Status    int
+		Output    []byte
+		Removed   string
+	}{
+		{Name: "exif", Method: http.MethodPost, Body: exifJPEG, Threshold: 1 << 10, Status: http.StatusOK, Output: cleanJPEG, Removed: "36"},
+		{Name: "spilled", Method: http.MethodPost, Body: exifJPEG, Threshold: 8, Status: http.StatusOK, Output: cleanJPEG, Removed: "36"},
+		{Name: "no exif", Method: http.MethodPost, Body: cleanJPEG, Threshold: 8, Status: http.StatusUnprocessableEntity},
+		{Name: "not an image", Method: http.MethodPost, Body: []byte("not an image"), Threshold: 1 << 10, Status: http.StatusUnprocessableEntity},
+		{Name: "spilled tiff", Method: http.MethodPost, Body: []byte("II*\x00\x08\x00\x00\x00\x00\x00"), Threshold: 8, Status: http.StatusRequestEntityTooLarge},
+		{Name: "get", Method: http.MethodGet, Status: http.StatusMethodNotAllowed},
+	}
+
+	for _, test := range testTable {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(test.Method, "/", bytes.NewReader(test.Body))
+		r.Header.Set("Content-Type", "image/jpeg")
+		handleSanitize(test.Threshold)(w, r)
+
+		if w.Code != test.Status {
+			t.Errorf("%s: expected status %d, got %d", test.Name, test.Status, w.Code)
+			continue
+		}
+		if test.Status != http.StatusOK {
+			continue
+		}
+		if !bytes.Equal(w.Body.Bytes(), test.Output) {
+			t.Errorf("%s: expected %x, got %x", test.Name, test.Output, w.Body.Bytes())
+		}
+		if got := w.Header().Get("X-Exif-Bytes-Removed"); got != test.Removed {
+			t.Errorf("%s: expected %s bytes removed, got %s", test.Name, test.Removed, got)
+		}
+		if got := w.Header().Get("Content-Type"); got != "image/jpeg" {
+			t.Errorf("%s: expected the content type to be kept, got %q", test.Name, got)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// runShow implements the show subcommand, which prints the EXIF tags of an image without
+// changing it, one per line, with their values formatted as photographers expect.
+func runShow(args []string) {
+	flags := flag.NewFlagSet("show", flag.ExitOnError)
+	setupLogging := logFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: exif-remover show [flags] <image>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	setupLogging()
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	input, err := openInput(flags.Arg(0))
+	if err != nil {
+		logs.Fatalf("Could not open %s: %v", flags.Arg(0), err)
+	}
+	defer input.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	err = exif.Walk(input, func(ifd exif.IFDInfo, tag exif.Tag) error {
+		_, err := fmt.Fprintf(w, "%s\t%s\t%s\n", ifd.Name, exif.TagName(ifd, tag), exif.FormatTag(ifd, tag))
+		return err
+	})
+	if err != nil {
+		logs.Fatalf("Could not read the EXIF data of %s: %v", flags.Arg(0), err)
+	}
+	w.Flush()
+}
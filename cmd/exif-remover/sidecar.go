@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// xmpPrivateProperties matches the names of XMP properties revealing where a picture was taken or
+// what it shows: GPS coordinates, location names and keywords.
+const xmpPrivateProperties = `(?:exif:GPS\w*|photoshop:(?:City|State|Country|Location)|` +
+	`Iptc4xmpCore:(?:Location|CountryCode)|Iptc4xmpExt:LocationShown|Iptc4xmpExt:LocationCreated|` +
+	`dc:subject|lr:hierarchicalSubject|xmp:Label)`
+
+var (
+	// xmpPrivateAttribute matches private properties written as attributes of rdf:Description,
+	// quoted with either double or single quotes as XML allows.
+	xmpPrivateAttribute = regexp.MustCompile(`\s+` + xmpPrivateProperties + `\s*=\s*(?:"[^"]*"|'[^']*')`)
+
+	// xmpPrivateElement matches private properties written as elements, either empty or with
+	// their content, such as the rdf:Bag of keywords.
+	xmpPrivateElement = regexp.MustCompile(`(?s)\s*<` + xmpPrivateProperties + `\b[^>]*?/>|` +
+		`\s*<` + xmpPrivateProperties + `\b[^>]*>.*?</` + xmpPrivateProperties + `>`)
+)
+
+// findSidecars returns the XMP sidecar files accompanying the image at path, named either after
+// the image without its extension, as Lightroom does, or with .xmp appended, as darktable does.
+func findSidecars(path string) []string {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	candidates := []string{base + ".xmp", base + ".XMP", path + ".xmp", path + ".XMP"}
+
+	var found []string
+	seen := make(map[string]bool)
+	for _, candidate := range candidates {
+		info, err := os.Stat(candidate)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		// Case insensitive file systems report both spellings of the same file.
+		key := strings.ToLower(candidate)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		found = append(found, candidate)
+	}
+	return found
+}
+
+// sanitizeXMP returns the XMP packet without the properties revealing where the picture was
+// taken or what it shows. Other properties, such as development settings, are kept.
+func sanitizeXMP(packet []byte) []byte {
+	packet = xmpPrivateElement.ReplaceAll(packet, nil)
+	return xmpPrivateAttribute.ReplaceAll(packet, nil)
+}
+
+// isSidecarMode reports whether mode is one of the sidecar modes handleSidecars applies.
+func isSidecarMode(mode string) bool {
+	return mode == "keep" || mode == "delete" || mode == "sanitize"
+}
+
+// handleSidecars applies mode to the XMP sidecars of the local image at path: keep only warns
+// about them, delete removes them and sanitize rewrites them without private properties.
+func handleSidecars(path, mode string) error {
+	if !isSidecarMode(mode) {
+		return fmt.Errorf("unknown sidecar mode %q", mode)
+	}
+	if isRemote(path) {
+		return nil
+	}
+
+	for _, sidecar := range findSidecars(path) {
+		switch mode {
+		case "keep":
+			logs.Warnf("%s may carry location and keyword data; use --sidecars=sanitize or --sidecars=delete", sidecar)
+		case "delete":
+			if err := os.Remove(sidecar); err != nil {
+				return err
+			}
+			logs.Infof("Deleted %s", sidecar)
+		case "sanitize":
+			packet, err := ioutil.ReadFile(sidecar)
+			if err != nil {
+				return err
+			}
+			info, err := os.Stat(sidecar)
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(sidecar, sanitizeXMP(packet), info.Mode()); err != nil {
+				return err
+			}
+			logs.Infof("Sanitized %s", sidecar)
+		}
+	}
+	return nil
+}
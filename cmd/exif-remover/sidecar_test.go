@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// xmpSidecar is an XMP sidecar holding private properties as attributes, in both quoting styles,
+// and as elements, along with development settings.
+const xmpSidecar = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    exif:GPSLatitude="48,51.5N"
+    exif:GPSLongitude = '2,17.5E'
+    photoshop:City='Paris'
+    crs:Exposure2012="+0.50">
+   <dc:subject>
+    <rdf:Bag>
+     <rdf:li>holiday</rdf:li>
+    </rdf:Bag>
+   </dc:subject>
+   <Iptc4xmpExt:LocationShown/>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+// sanitizedSidecar is xmpSidecar without its private properties.
+const sanitizedSidecar = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    crs:Exposure2012="+0.50">
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+func TestSanitizeXMP(t *testing.T) {
+	if got := string(sanitizeXMP([]byte(xmpSidecar))); got != sanitizedSidecar {
+		t.Errorf("Expected the sidecar to be sanitized as\n%s\ngot\n%s", sanitizedSidecar, got)
+	}
+}
+
+func TestHandleSidecars(t *testing.T) {
+	testTable := []struct {
+		Mode    string
+		Path    string
+		Err     bool
+		Sidecar string
+		Deleted bool
+	}{
+		{Mode: "keep", Sidecar: xmpSidecar},
+		{Mode: "delete", Deleted: true},
+		{Mode: "sanitize", Sidecar: sanitizedSidecar},
+		{Mode: "sanitize", Path: "s3://bucket/photo.jpg", Sidecar: xmpSidecar},
+		{Mode: "shred", Err: true, Sidecar: xmpSidecar},
+	}
+
+	for _, test := range testTable {
+		dir := t.TempDir()
+		image := filepath.Join(dir, "photo.jpg")
+		sidecar := filepath.Join(dir, "photo.xmp")
+		if err := ioutil.WriteFile(sidecar, []byte(xmpSidecar), 0644); err != nil {
+			t.Fatal(err)
+		}
+		path := test.Path
+		if path == "" {
+			path = image
+		}
+
+		err := handleSidecars(path, test.Mode)
+		if (err != nil) != test.Err {
+			t.Errorf("%s %s: expected an error %v, got %v", test.Mode, path, test.Err, err)
+		}
+		data, err := ioutil.ReadFile(sidecar)
+		if test.Deleted != os.IsNotExist(err) || (!test.Deleted && string(data) != test.Sidecar) {
+			t.Errorf("%s %s: expected the sidecar to be %q, got %q and %v", test.Mode, path, test.Sidecar, data, err)
+		}
+	}
+}
+
+func TestFindSidecars(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"lightroom.xmp", "darktable.jpg.xmp"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(xmpSidecar), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Mkdir(filepath.Join(dir, "folder.xmp"), 0755)
+
+	testTable := []struct {
+		Image    string
+		Sidecars []string
+	}{
+		{Image: "lightroom.jpg", Sidecars: []string{"lightroom.xmp"}},
+		{Image: "darktable.jpg", Sidecars: []string{"darktable.jpg.xmp"}},
+		{Image: "folder.jpg"},
+		{Image: "none.jpg"},
+	}
+
+	for _, test := range testTable {
+		var want []string
+		for _, name := range test.Sidecars {
+			want = append(want, filepath.Join(dir, name))
+		}
+		if got := findSidecars(filepath.Join(dir, test.Image)); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", test.Image, want, got)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// defaultSpillThreshold is the size above which inputs that cannot be seeked are spilled to a
+// temporary file rather than held in memory.
+const defaultSpillThreshold = 32 << 20
+
+// readSeekCloser is an input that can be seeked, so that the sanitizer can copy the parts of files
+// it keeps, such as the media data of videos, without reading them into memory.
+type readSeekCloser interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// spill returns r as a readSeekCloser: local files as they are, and other inputs, such as
+// downloads and request bodies, read into memory if they are no larger than threshold bytes, or
+// spilled to a temporary file otherwise. The temporary file is removed once closed.
+func spill(r io.Reader, threshold int64) (readSeekCloser, error) {
+	if f, ok := r.(*os.File); ok {
+		if _, err := f.Seek(0, io.SeekCurrent); err == nil {
+			return f, nil
+		}
+	}
+
+	head, err := ioutil.ReadAll(io.LimitReader(r, threshold+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(head)) <= threshold {
+		return nopCloser{bytes.NewReader(head)}, nil
+	}
+
+	f, err := newTempFile()
+	if err != nil {
+		return nil, err
+	}
+	logs.Debugf("Spilling the input to %s, as it is larger than %d bytes", f.Name(), threshold)
+	if _, err := f.Write(head); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// checkSpilled returns an error if source was spilled to a temporary file, being larger than
+// threshold bytes, but is of none of the formats streamed, those its sanitizer copies from the
+// file rather than reading them into memory, which would defeat the threshold. The offset of
+// source is left at the start.
+func checkSpilled(source readSeekCloser, threshold int64, streamed ...string) error {
+	if _, spilled := source.(*tempFile); !spilled {
+		return nil
+	}
+	header := make([]byte, 512)
+	n, err := io.ReadFull(source, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	if _, err := source.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	format := exif.Detect(header[:n])
+	for _, f := range streamed {
+		if format == f {
+			return nil
+		}
+	}
+	if format == "" {
+		format = "unknown"
+	}
+	return fmt.Errorf("the input is larger than %d bytes, and only %s files that large can be sanitized without reading them into memory, not %s files",
+		threshold, strings.Join(streamed, " and "), format)
+}
+
+// localFile returns the file source reads from, if it is a local file or was spilled to one.
+func localFile(source readSeekCloser) *os.File {
+	switch f := source.(type) {
+	case *os.File:
+		return f
+	case *tempFile:
+		return f.File
+	}
+	return nil
+}
+
+// tempFile is a temporary file, removed once closed.
+type tempFile struct {
+	*os.File
+
+	// removed is set if the file was removed as soon as it was created, which systems other than
+	// Windows allow while it is open, so that it is not left behind if the CLI exits on an error.
+	removed bool
+}
+
+func newTempFile() (*tempFile, error) {
+	f, err := ioutil.TempFile("", "exif-remover-")
+	if err != nil {
+		return nil, err
+	}
+	return &tempFile{File: f, removed: os.Remove(f.Name()) == nil}, nil
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	if !f.removed {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// nopCloser adds a Close method doing nothing to a ReadSeeker.
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSpill(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "photo.jpg")
+	if err := ioutil.WriteFile(local, exifJPEG, 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	testTable := []struct {
+		Name      string
+		Input     interface{ Read([]byte) (int, error) }
+		Threshold int64
+		Content   []byte
+		Spilled   bool
+	}{
+		{Name: "local file", Input: file, Threshold: 8, Content: exifJPEG},
+		{Name: "small", Input: bytes.NewBufferString("photo"), Threshold: 8, Content: []byte("photo")},
+		{Name: "at the threshold", Input: bytes.NewBufferString("12345678"), Threshold: 8, Content: []byte("12345678")},
+		{Name: "large", Input: bytes.NewReader(exifJPEG), Threshold: 8, Content: exifJPEG, Spilled: true},
+	}
+
+	for _, test := range testTable {
+		source, err := spill(test.Input, test.Threshold)
+		if err != nil {
+			t.Fatalf("%s: %v", test.Name, err)
+		}
+		spool, spilled := source.(*tempFile)
+		if spilled != test.Spilled {
+			t.Errorf("%s: expected the input to be spilled %v, got %T", test.Name, test.Spilled, source)
+		}
+		if content, err := ioutil.ReadAll(source); err != nil || !bytes.Equal(content, test.Content) {
+			t.Errorf("%s: expected to read %q, got %q and %v", test.Name, test.Content, content, err)
+		}
+		source.Close()
+		if spilled {
+			if _, err := os.Stat(spool.Name()); !os.IsNotExist(err) {
+				t.Errorf("%s: expected the temporary file to be removed, got %v", test.Name, err)
+			}
+		}
+	}
+}
+
+func TestCheckSpilled(t *testing.T) {
+	tiff := []byte("II*\x00\x08\x00\x00\x00\x00\x00")
+
+	testTable := []struct {
+		Name      string
+		Input     []byte
+		Threshold int64
+		Error     string
+	}{
+		{Name: "held in memory", Input: tiff, Threshold: 1 << 10},
+		{Name: "streamed", Input: exifJPEG, Threshold: 8},
+		{Name: "not streamed", Input: tiff, Threshold: 8, Error: "the input is larger than 8 bytes, and only jpeg files that large can be sanitized without reading them into memory, not tiff files"},
+	}
+
+	for _, test := range testTable {
+		source, err := spill(bytes.NewReader(test.Input), test.Threshold)
+		if err != nil {
+			t.Fatalf("%s: %v", test.Name, err)
+		}
+		err = checkSpilled(source, test.Threshold, "jpeg")
+		if test.Error == "" && err != nil || test.Error != "" && (err == nil || err.Error() != test.Error) {
+			t.Errorf("%s: expected error %q, got %v", test.Name, test.Error, err)
+		}
+		// The input is read from the start all the same.
+		if content, err := ioutil.ReadAll(source); err != nil || !bytes.Equal(content, test.Input) {
+			t.Errorf("%s: expected to read %q, got %q and %v", test.Name, test.Input, content, err)
+		}
+		source.Close()
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/png"
+	"io/ioutil"
+	"os"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// verifyOutput reads back the image written to path and checks that it still decodes and, unless
+// the EXIF data was deliberately kept, carries no EXIF data. Local outputs are mapped into memory
+// rather than read if useMmap is set. It returns the SHA-256 of the output on success.
+func verifyOutput(path string, exifKept, useMmap bool) (string, error) {
+	output, err := openInput(path)
+	if err != nil {
+		return "", err
+	}
+	defer output.Close()
+
+	var raw []byte
+	if file, ok := output.(*os.File); ok {
+		var release func() error
+		raw, release, err = loadFile(file, useMmap)
+		if err == nil {
+			defer release()
+		}
+	} else {
+		raw, err = ioutil.ReadAll(output)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if _, _, err := image.Decode(bytes.NewReader(raw)); err != nil {
+		return "", fmt.Errorf("output does not decode: %v", err)
+	}
+
+	found, err := exif.Exists(bytes.NewReader(raw))
+	if err != nil {
+		return "", fmt.Errorf("output could not be parsed: %v", err)
+	}
+	if found && !exifKept {
+		return "", fmt.Errorf("output still contains EXIF data")
+	}
+
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,36 @@
+// Command exif-s3-worker removes the metadata of the images uploaded to S3 or MinIO buckets as
+// they are uploaded: it receives the bucket notifications of new objects on a webhook, and
+// sanitizes each of them in place.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/internal/s3"
+)
+
+func main() {
+	listen := flag.String("listen", ":8080", "Address to receive bucket notifications on.")
+	token := flag.String("token", os.Getenv("EXIF_S3_WORKER_TOKEN"), "Token notifications must carry, as a bearer token, such as the auth_token of a MinIO webhook target, or as the basic authentication password of an SNS subscription URL. Required unless -insecure is given.")
+	insecure := flag.Bool("insecure", false, "Accept notifications without a token, from anyone who can reach the worker.")
+	buckets := flag.String("buckets", "", "Comma separated buckets whose objects are sanitized; the objects of other buckets are left unchanged. Empty sanitizes those of every bucket notified.")
+	maxSize := flag.Int64("max-size", 64<<20, "Maximum size in bytes of the objects sanitized; larger objects are left unchanged.")
+	flag.Parse()
+
+	// Anyone sending notifications has objects rewritten, so that the worker only accepts them
+	// from anyone when told to.
+	if *token == "" && !*insecure {
+		log.Fatalf("No token given: set -token or EXIF_S3_WORKER_TOKEN, or pass -insecure to accept notifications from anyone")
+	}
+
+	w := &worker{client: s3.NewClient(), token: *token, buckets: parseBuckets(*buckets), maxSize: *maxSize}
+	http.Handle("/", w)
+
+	log.Printf("Listening on %s", *listen)
+	if err := http.ListenAndServe(*listen, nil); err != nil {
+		log.Fatalf("Error while serving: %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// maxNotificationSize bounds the size of the notifications received.
+const maxNotificationSize = 1 << 20
+
+// objectStore gets and puts the objects of buckets, as s3.Client does.
+type objectStore interface {
+	Get(bucket, key string) (io.ReadCloser, error)
+	Put(bucket, key string, body []byte) error
+}
+
+// worker receives the notifications of objects created in buckets, and sanitizes the objects.
+type worker struct {
+	client objectStore
+
+	// token is the token notifications must carry, if not empty.
+	token string
+
+	// buckets are the buckets whose objects are sanitized, or nil for every bucket.
+	buckets map[string]bool
+
+	// maxSize bounds the size of the objects sanitized.
+	maxSize int64
+}
+
+// notification is an S3 event notification, as S3 and MinIO send them, or an SNS message
+// wrapping one, as S3 sends them through SNS topics.
+type notification struct {
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key string `json:"key"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+
+	// The fields of SNS messages.
+	Type         string `json:"Type"`
+	Message      string `json:"Message"`
+	SubscribeURL string `json:"SubscribeURL"`
+}
+
+// ServeHTTP sanitizes the objects created according to the notification posted. It fails if any
+// of them could not be sanitized, so that the sender retries the notification.
+func (w *worker) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if w.token != "" && !w.authorized(r) {
+		http.Error(rw, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxNotificationSize))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var n notification
+	if err := json.Unmarshal(body, &n); err != nil {
+		http.Error(rw, "invalid notification: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch n.Type {
+	case "SubscriptionConfirmation":
+		// Subscriptions are confirmed by hand rather than by fetching a URL taken from the request.
+		log.Printf("Visit %s to confirm the subscription to the SNS topic", n.SubscribeURL)
+		return
+	case "Notification":
+		message := n.Message
+		n = notification{}
+		if err := json.Unmarshal([]byte(message), &n); err != nil {
+			http.Error(rw, "invalid notification: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	failed := 0
+	for _, record := range n.Records {
+		if !strings.Contains(record.EventName, "ObjectCreated:") {
+			continue
+		}
+		// Keys are URL encoded in notifications, with spaces as '+'.
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			key = record.S3.Object.Key
+		}
+		bucket := record.S3.Bucket.Name
+		if w.buckets != nil && !w.buckets[bucket] {
+			log.Printf("Skipping s3://%s/%s: bucket not listed in -buckets", bucket, key)
+			continue
+		}
+		if err := w.sanitize(bucket, key); err != nil {
+			log.Printf("Error while sanitizing s3://%s/%s: %v", bucket, key, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		http.Error(rw, fmt.Sprintf("failed to sanitize %d objects", failed), http.StatusInternalServerError)
+	}
+}
+
+// authorized reports whether r carries the token, as a bearer token, as MinIO sends it, or as the
+// password of basic authentication, as SNS sends the credentials of subscription URLs.
+func (w *worker) authorized(r *http.Request) bool {
+	if _, password, ok := r.BasicAuth(); ok {
+		return subtle.ConstantTimeCompare([]byte(password), []byte(w.token)) == 1
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+w.token)) == 1
+}
+
+// parseBuckets parses the -buckets flag, a comma separated list of buckets, into a set, or nil if
+// it lists none.
+func parseBuckets(list string) map[string]bool {
+	var buckets map[string]bool
+	for _, bucket := range strings.Split(list, ",") {
+		if bucket = strings.TrimSpace(bucket); bucket != "" {
+			if buckets == nil {
+				buckets = map[string]bool{}
+			}
+			buckets[bucket] = true
+		}
+	}
+	return buckets
+}
+
+// sanitize removes the metadata of the object at bucket/key in place. Objects that are not of a
+// supported format, are larger than maxSize or carry no metadata are left unchanged, so that
+// sanitized objects, whose uploads are notified in turn, are not written again.
+func (w *worker) sanitize(bucket, key string) error {
+	object, err := w.client.Get(bucket, key)
+	if err != nil {
+		return err
+	}
+	raw, err := ioutil.ReadAll(io.LimitReader(object, w.maxSize+1))
+	object.Close()
+	if err != nil {
+		return err
+	}
+	if int64(len(raw)) > w.maxSize {
+		log.Printf("Skipping s3://%s/%s: larger than %d bytes", bucket, key, w.maxSize)
+		return nil
+	}
+	if exif.Detect(raw) == "" {
+		return nil
+	}
+
+	output := new(bytes.Buffer)
+	if _, err := exif.SanitizeBytes(raw, output); err != nil {
+		return err
+	}
+	if bytes.Equal(output.Bytes(), raw) {
+		return nil
+	}
+	if err := w.client.Put(bucket, key, output.Bytes()); err != nil {
+		return err
+	}
+	log.Printf("Sanitized s3://%s/%s: removed %d bytes", bucket, key, len(raw)-output.Len())
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// exifJPEG is a minimal JPEG image with an EXIF segment recording the camera make.
+var exifJPEG = []byte{
+	0xFF, 0xD8, // Start of image.
+	0xFF, 0xE1, // Markers
+	0x00, 0x22, // Length of the segment, including the length field.
+	'E', 'x', 'i', 'f', 0x00, 0x00, // EXIF identifier.
+	0x4d, 0x4d, // "MM" - Big Endian.
+	0x00, 0x2A, // Fixed 2-bytes.
+	0x00, 0x00, 0x00, 0x08, // Offset eight to first IFD.
+	0x00, 0x01, // One tag.
+	0x01, 0x0F, // Make.
+	0x00, 0x02, // ASCII.
+	0x00, 0x00, 0x00, 0x04, // Four characters.
+	'A', 'C', 'M', 0x00, // The value fits in the offset field.
+	0x00, 0x00, 0x00, 0x00, // No next IFD.
+	0xFF, 0xDA, // Start of scan.
+	0x00, 0x02,
+	0x00, 0x00,
+	0xFF, 0xD9, // End of image.
+}
+
+// cleanJPEG is exifJPEG without its EXIF segment.
+var cleanJPEG = []byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02, 0x00, 0x00, 0xFF, 0xD9}
+
+// memoryStore is an objectStore holding objects in memory, by bucket/key, and counting puts.
+type memoryStore struct {
+	objects map[string][]byte
+	puts    int
+}
+
+func (s *memoryStore) Get(bucket, key string) (io.ReadCloser, error) {
+	object, ok := s.objects[bucket+"/"+key]
+	if !ok {
+		return nil, errors.New("NoSuchKey")
+	}
+	return ioutil.NopCloser(bytes.NewReader(object)), nil
+}
+
+func (s *memoryStore) Put(bucket, key string, body []byte) error {
+	s.objects[bucket+"/"+key] = append([]byte{}, body...)
+	s.puts++
+	return nil
+}
+
+// s3Event returns an S3 event notification of eventName for the object at bucket/key, whose key
+// is encoded as in notifications.
+func s3Event(eventName, bucket, key string) string {
+	return `{"Records":[{"eventName":"` + eventName + `","s3":{"bucket":{"name":"` + bucket + `"},"object":{"key":"` + key + `"}}}]}`
+}
+
+func TestWorker(t *testing.T) {
+	snsMessage, _ := json.Marshal(map[string]string{"Type": "Notification", "Message": s3Event("ObjectCreated:Put", "photos", "exif.jpg")})
+
+	testTable := []struct {
+		Name    string
+		Secret  string
+		Token   string
+		Buckets string
+		Body    string
+		Status  int
+		Object  string
+		Output  []byte
+		Puts    int
+	}{
+		{Name: "created object", Body: s3Event("ObjectCreated:Put", "photos", "exif.jpg"), Status: http.StatusOK, Object: "photos/exif.jpg", Output: cleanJPEG, Puts: 1},
+		{Name: "minio event", Body: s3Event("s3:ObjectCreated:CompleteMultipartUpload", "photos", "exif.jpg"), Status: http.StatusOK, Object: "photos/exif.jpg", Output: cleanJPEG, Puts: 1},
+		{Name: "encoded key", Body: s3Event("ObjectCreated:Put", "photos", "my+trip%2Fday+1.jpg"), Status: http.StatusOK, Object: "photos/my trip/day 1.jpg", Output: cleanJPEG, Puts: 1},
+		{Name: "sns notification", Body: string(snsMessage), Status: http.StatusOK, Object: "photos/exif.jpg", Output: cleanJPEG, Puts: 1},
+		{Name: "clean object", Body: s3Event("ObjectCreated:Put", "photos", "clean.jpg"), Status: http.StatusOK, Object: "photos/clean.jpg", Output: cleanJPEG},
+		{Name: "unsupported object", Body: s3Event("ObjectCreated:Put", "photos", "notes.txt"), Status: http.StatusOK, Object: "photos/notes.txt", Output: []byte("notes")},
+		{Name: "removed object", Body: s3Event("ObjectRemoved:Delete", "photos", "exif.jpg"), Status: http.StatusOK, Object: "photos/exif.jpg", Output: exifJPEG},
+		{Name: "missing object", Body: s3Event("ObjectCreated:Put", "photos", "missing.jpg"), Status: http.StatusInternalServerError},
+		{Name: "test event", Body: `{"Service":"Amazon S3","Event":"s3:TestEvent"}`, Status: http.StatusOK},
+		{Name: "invalid notification", Body: "{", Status: http.StatusBadRequest},
+		{Name: "token", Secret: "secret", Token: "Bearer secret", Body: s3Event("ObjectCreated:Put", "photos", "exif.jpg"), Status: http.StatusOK, Object: "photos/exif.jpg", Output: cleanJPEG, Puts: 1},
+		{Name: "basic authentication", Secret: "secret", Token: "Basic " + base64.StdEncoding.EncodeToString([]byte("sns:secret")), Body: s3Event("ObjectCreated:Put", "photos", "exif.jpg"), Status: http.StatusOK, Object: "photos/exif.jpg", Output: cleanJPEG, Puts: 1},
+		{Name: "missing token", Secret: "secret", Body: s3Event("ObjectCreated:Put", "photos", "exif.jpg"), Status: http.StatusUnauthorized, Object: "photos/exif.jpg", Output: exifJPEG},
+		{Name: "listed bucket", Buckets: "uploads, photos", Body: s3Event("ObjectCreated:Put", "photos", "exif.jpg"), Status: http.StatusOK, Object: "photos/exif.jpg", Output: cleanJPEG, Puts: 1},
+		{Name: "unlisted bucket", Buckets: "uploads", Body: s3Event("ObjectCreated:Put", "photos", "exif.jpg"), Status: http.StatusOK, Object: "photos/exif.jpg", Output: exifJPEG},
+		{Name: "wrong token", Secret: "secret", Token: "Bearer wrong", Body: s3Event("ObjectCreated:Put", "photos", "exif.jpg"), Status: http.StatusUnauthorized, Object: "photos/exif.jpg", Output: exifJPEG},
+	}
+
+	for _, test := range testTable {
+		store := &memoryStore{objects: map[string][]byte{
+			"photos/exif.jpg":          exifJPEG,
+			"photos/my trip/day 1.jpg": exifJPEG,
+			"photos/clean.jpg":         cleanJPEG,
+			"photos/notes.txt":         []byte("notes"),
+		}}
+		w := &worker{client: store, token: test.Secret, buckets: parseBuckets(test.Buckets), maxSize: 1 << 20}
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.Body))
+		if test.Token != "" {
+			req.Header.Set("Authorization", test.Token)
+		}
+		rec := httptest.NewRecorder()
+		w.ServeHTTP(rec, req)
+
+		if rec.Code != test.Status {
+			t.Errorf("%s: expected status %d, got %d: %s", test.Name, test.Status, rec.Code, rec.Body)
+		}
+		if test.Object != "" && !bytes.Equal(store.objects[test.Object], test.Output) {
+			t.Errorf("%s: expected %s to be %x, got %x", test.Name, test.Object, test.Output, store.objects[test.Object])
+		}
+		if store.puts != test.Puts {
+			t.Errorf("%s: expected %d objects to be written, got %d", test.Name, test.Puts, store.puts)
+		}
+	}
+}
+
+func TestWorkerSkipsLargeObjects(t *testing.T) {
+	store := &memoryStore{objects: map[string][]byte{"photos/exif.jpg": exifJPEG}}
+	w := &worker{client: store, maxSize: int64(len(exifJPEG) - 1)}
+
+	if err := w.sanitize("photos", "exif.jpg"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if store.puts != 0 {
+		t.Errorf("Expected objects over the maximum size to be left unchanged")
+	}
+}
@@ -0,0 +1,6 @@
+//go:build js || wasip1
+
+// Command exif-wasm builds the exif package as a WebAssembly module. Built for js/wasm it
+// registers a JavaScript API for browsers and Node.js; built for wasip1 it acts as a stdin to
+// stdout filter.
+package main
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"syscall/js"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+var errArgument = errors.New("expected a single Uint8Array argument")
+
+// main registers a global exifRemover object exposing the sanitizer to JavaScript, so images
+// can be stripped in the browser before they are uploaded:
+//
+//	const {output, error} = exifRemover.discard(new Uint8Array(await file.arrayBuffer()));
+//
+// discard returns the sanitized image as a Uint8Array in output, or a message in error.
+func main() {
+	js.Global().Set("exifRemover", map[string]interface{}{
+		"discard": js.FuncOf(discard),
+		"exists":  js.FuncOf(exists),
+	})
+
+	// Keep the Go runtime alive so the registered functions remain callable.
+	select {}
+}
+
+func discard(this js.Value, args []js.Value) interface{} {
+	input, err := bytesArg(args)
+	if err != nil {
+		return result(nil, err)
+	}
+
+	// The input is a copy of the caller's array, so it can be sanitized in place.
+	output, _, err := exif.DiscardBytes(input)
+	if err != nil {
+		return result(nil, err)
+	}
+
+	array := js.Global().Get("Uint8Array").New(len(output))
+	js.CopyBytesToJS(array, output)
+	return result(array, nil)
+}
+
+func exists(this js.Value, args []js.Value) interface{} {
+	input, err := bytesArg(args)
+	if err != nil {
+		return result(nil, err)
+	}
+
+	found, err := exif.Exists(bytes.NewReader(input))
+	if err != nil {
+		return result(nil, err)
+	}
+	return result(found, nil)
+}
+
+// bytesArg copies the Uint8Array passed as the single argument of a call into Go memory.
+func bytesArg(args []js.Value) ([]byte, error) {
+	if len(args) != 1 || !args[0].InstanceOf(js.Global().Get("Uint8Array")) {
+		return nil, errArgument
+	}
+	input := make([]byte, args[0].Get("length").Int())
+	js.CopyBytesToGo(input, args[0])
+	return input, nil
+}
+
+func result(output interface{}, err error) map[string]interface{} {
+	if err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+	return map[string]interface{}{"output": output}
+}
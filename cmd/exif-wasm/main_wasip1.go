@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// main reads an image from stdin and writes it to stdout without its EXIF data, so the WASI
+// module can be run as a filter by any WASI runtime:
+//
+//	wasmtime exif-remover.wasm < image.jpg > clean.jpg
+func main() {
+	if err := exif.Discard(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error occured while discarding exif headers: %v\n", err)
+		os.Exit(1)
+	}
+}
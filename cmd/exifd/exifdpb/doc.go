@@ -0,0 +1,4 @@
+// Package exifdpb holds the protocol buffer definitions of the exifd gRPC service.
+package exifdpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative exifd.proto
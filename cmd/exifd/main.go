@@ -0,0 +1,32 @@
+// Command exifd serves the EXIF sanitization engine over gRPC, so that backend services
+// other than Mattermost can share it.
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+
+	"google.golang.org/grpc"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/cmd/exifd/exifdpb"
+)
+
+func main() {
+	listen := flag.String("listen", ":9090", "Address to listen on.")
+	maxSize := flag.Int64("max-size", 64<<20, "Maximum size in bytes of a streamed file.")
+	flag.Parse()
+
+	lis, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatalf("Error while listening on %s: %v", *listen, err)
+	}
+
+	s := grpc.NewServer()
+	exifdpb.RegisterSanitizerServer(s, &server{maxSize: *maxSize})
+
+	log.Printf("Listening on %s", *listen)
+	if err := s.Serve(lis); err != nil {
+		log.Fatalf("Error while serving: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"io"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/cmd/exifd/exifdpb"
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// chunkSize is the size of the chunks files are streamed back in.
+const chunkSize = 64 << 10
+
+// server implements the exifd Sanitizer service.
+type server struct {
+	exifdpb.UnimplementedSanitizerServer
+
+	// maxSize bounds the size of the files accepted.
+	maxSize int64
+}
+
+// chunkStream is a stream of file chunks received by an RPC.
+type chunkStream interface {
+	Recv() (*exifdpb.Chunk, error)
+}
+
+// Sanitize removes the metadata of the received file as the plugin does, with the default options
+// of exif.Sanitize, and streams the sanitized copy back in chunks as it is written. The received
+// file is buffered whole, up to maxSize, as the sanitizer parses it in memory.
+func (s *server) Sanitize(stream exifdpb.Sanitizer_SanitizeServer) error {
+	raw, err := s.receive(stream)
+	if err != nil {
+		return err
+	}
+
+	if _, err := exif.Sanitize(bytes.NewReader(raw), &chunkWriter{stream: stream}); err != nil {
+		return status.Errorf(codes.InvalidArgument, "an error occurred while trying to sanitize the file: %v", err)
+	}
+	return nil
+}
+
+// Inspect reports whether the received file carries an EXIF segment, and how many bytes Sanitize
+// would remove from it. The received file is buffered whole, as by Sanitize.
+func (s *server) Inspect(stream exifdpb.Sanitizer_InspectServer) error {
+	raw, err := s.receive(stream)
+	if err != nil {
+		return err
+	}
+
+	found, err := exif.Exists(bytes.NewReader(raw))
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "an error occurred while trying to parse the file: %v", err)
+	}
+
+	output := &countingWriter{}
+	if _, err := exif.Sanitize(bytes.NewReader(raw), output); err != nil {
+		return status.Errorf(codes.InvalidArgument, "an error occurred while trying to sanitize the file: %v", err)
+	}
+
+	return stream.SendAndClose(&exifdpb.InspectResponse{
+		HasExif:      found,
+		Size:         int64(len(raw)),
+		MetadataSize: int64(len(raw)) - output.n,
+	})
+}
+
+// receive reads all chunks of a file from stream.
+func (s *server) receive(stream chunkStream) ([]byte, error) {
+	buff := new(bytes.Buffer)
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return buff.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if int64(buff.Len()+len(chunk.Data)) > s.maxSize {
+			return nil, status.Errorf(codes.ResourceExhausted, "file exceeds the maximum size of %d bytes", s.maxSize)
+		}
+		buff.Write(chunk.Data)
+	}
+}
+
+// chunkWriter sends the data written to it on stream, in chunks of at most chunkSize bytes.
+type chunkWriter struct {
+	stream exifdpb.Sanitizer_SanitizeServer
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > chunkSize {
+			n = chunkSize
+		}
+		if err := w.stream.Send(&exifdpb.Chunk{Data: p[:n]}); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// countingWriter counts the bytes written to it, and discards them.
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/cmd/exifd/exifdpb"
+)
+
+// exifJPEG is a minimal JPEG image with an EXIF segment recording the camera make.
+var exifJPEG = []byte{
+	0xFF, 0xD8, // Start of image.
+	0xFF, 0xE1, // Markers
+	0x00, 0x22, // Length of the segment, including the length field.
+	'E', 'x', 'i', 'f', 0x00, 0x00, // EXIF identifier.
+	0x4d, 0x4d, // "MM" - Big Endian.
+	0x00, 0x2A, // Fixed 2-bytes.
+	0x00, 0x00, 0x00, 0x08, // Offset eight to first IFD.
+	0x00, 0x01, // One tag.
+	0x01, 0x0F, // Make.
+	0x00, 0x02, // ASCII.
+	0x00, 0x00, 0x00, 0x04, // Four characters.
+	'A', 'C', 'M', 0x00, // The value fits in the offset field.
+	0x00, 0x00, 0x00, 0x00, // No next IFD.
+	0xFF, 0xDA, // Start of scan.
+	0x00, 0x02,
+	0x00, 0x00,
+	0xFF, 0xD9, // End of image.
+}
+
+// cleanJPEG is exifJPEG without its EXIF segment.
+var cleanJPEG = []byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02, 0x00, 0x00, 0xFF, 0xD9}
+
+// newTestClient serves a server accepting files of up to maxSize bytes over an in-memory
+// connection, and returns a client of it.
+func newTestClient(t *testing.T, maxSize int64) exifdpb.SanitizerClient {
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	exifdpb.RegisterSanitizerServer(s, &server{maxSize: maxSize})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return exifdpb.NewSanitizerClient(conn)
+}
+
+// sendChunks sends data in chunks of size bytes.
+func sendChunks(send func(*exifdpb.Chunk) error, data []byte, size int) error {
+	for len(data) > 0 {
+		n := size
+		if n > len(data) {
+			n = len(data)
+		}
+		if err := send(&exifdpb.Chunk{Data: data[:n]}); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func TestSanitize(t *testing.T) {
+	// A JPEG image larger than a chunk, to be streamed back in several.
+	large := append(append([]byte{}, exifJPEG[:len(exifJPEG)-2]...), make([]byte, 3*chunkSize)...)
+	large = append(large, 0xFF, 0xD9)
+
+	testTable := []struct {
+		Name   string
+		Input  []byte
+		Output []byte
+		Chunks int
+		Code   codes.Code
+	}{
+		{Name: "exif", Input: exifJPEG, Output: cleanJPEG, Chunks: 1},
+		{Name: "no exif", Input: cleanJPEG, Output: cleanJPEG, Chunks: 1},
+		{Name: "large", Input: large, Output: append(append([]byte{}, cleanJPEG[:8]...), large[len(exifJPEG)-2:]...), Chunks: 4},
+		{Name: "not an image", Input: []byte("not an image"), Code: codes.InvalidArgument},
+		{Name: "too large", Input: append(large, make([]byte, 1<<20)...), Code: codes.ResourceExhausted},
+	}
+
+	client := newTestClient(t, 1<<20)
+	for _, test := range testTable {
+		stream, err := client.Sanitize(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			sendChunks(stream.Send, test.Input, 1000)
+			stream.CloseSend()
+		}()
+
+		output, chunks := new(bytes.Buffer), 0
+		for {
+			var chunk *exifdpb.Chunk
+			chunk, err = stream.Recv()
+			if err != nil {
+				break
+			}
+			chunks++
+			output.Write(chunk.Data)
+		}
+		if err == io.EOF {
+			err = nil
+		}
+		if status.Code(err) != test.Code {
+			t.Errorf("%s: expected the code %v, got %v", test.Name, test.Code, err)
+			continue
+		}
+		if test.Code == codes.OK && (!bytes.Equal(output.Bytes(), test.Output) || chunks < test.Chunks) {
+			t.Errorf("%s: expected %d bytes in at least %d chunks, got %d bytes in %d", test.Name, len(test.Output), test.Chunks, output.Len(), chunks)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	testTable := []struct {
+		Name         string
+		Input        []byte
+		HasExif      bool
+		MetadataSize int64
+		Code         codes.Code
+	}{
+		{Name: "exif", Input: exifJPEG, HasExif: true, MetadataSize: int64(len(exifJPEG) - len(cleanJPEG))},
+		{Name: "no exif", Input: cleanJPEG},
+		{Name: "trailing data", Input: append(append([]byte{}, cleanJPEG...), "video"...)},
+		{Name: "not an image", Input: []byte("not an image"), Code: codes.InvalidArgument},
+		{Name: "too large", Input: make([]byte, 2<<10), Code: codes.ResourceExhausted},
+	}
+
+	client := newTestClient(t, 1<<10)
+	for _, test := range testTable {
+		stream, err := client.Inspect(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sendChunks(stream.Send, test.Input, 100)
+		var response *exifdpb.InspectResponse
+		if err == nil || err == io.EOF {
+			response, err = stream.CloseAndRecv()
+		}
+		if status.Code(err) != test.Code {
+			t.Errorf("%s: expected the code %v, got %v", test.Name, test.Code, err)
+			continue
+		}
+		if test.Code != codes.OK {
+			continue
+		}
+		if response.HasExif != test.HasExif || response.Size != int64(len(test.Input)) || response.MetadataSize != test.MetadataSize {
+			t.Errorf("%s: expected %v and %d bytes of metadata, got %v", test.Name, test.HasExif, test.MetadataSize, response)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package exif
+
+import "bytes"
+
+// APP14 marker, holding the Adobe color transform header.
+const app14Marker = 0xEE
+
+// The Adobe identifier of APP14 segments.
+var adobeIdent = []byte{'A', 'd', 'o', 'b', 'e'}
+
+// isAdobeTransform reports whether s is an Adobe APP14 segment. Its transform flag tells
+// decoders whether the components are YCbCr, YCCK or plain RGB/CMYK: CMYK images decode with
+// inverted or pink colors, or not at all, without it.
+func isAdobeTransform(raw []byte, s segment) bool {
+	return s.marker == app14Marker && bytes.HasPrefix(s.payload(raw), adobeIdent)
+}
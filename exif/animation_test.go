@@ -0,0 +1,199 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func TestSanitizeAnimatedGIF(t *testing.T) {
+	palette := color.Palette{color.Black, color.White}
+	animation := &gif.GIF{Delay: []int{10, 20, 30}, LoopCount: 0}
+	for i := 0; i < 3; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 4, 2), palette)
+		frame.SetColorIndex(i, 0, 1)
+		animation.Image = append(animation.Image, frame)
+	}
+	clean := new(bytes.Buffer)
+	if err := gif.EncodeAll(clean, animation); err != nil {
+		t.Fatalf("failed to encode the animation: %v", err)
+	}
+
+	// Insert a comment and an XMP packet after the header and global color table.
+	start := 13 + gifColorTableSize(clean.Bytes()[10])
+	comment := append([]byte{0x21, 0xFE, 0x05}, "hello\x00"...)
+	xmp := append(append([]byte{0x21, 0xFF, 0x0B}, "XMP DataXMP"...), 0x03, 'x', 'm', 'p', 0x00)
+	input := append(append(append([]byte{}, clean.Bytes()[:start]...), comment...), xmp...)
+	input = append(input, clean.Bytes()[start:]...)
+
+	output := new(bytes.Buffer)
+	report, err := Sanitize(bytes.NewReader(input), output)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(clean.Bytes(), output.Bytes()) {
+		t.Errorf("expected only the comment and XMP packet to be removed, got: %x", output.Bytes())
+	}
+	if report.Format != "gif" || !report.MetadataRemoved || report.Width != 4 || report.Height != 2 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if report.Frames != 3 || report.Duration != 600*time.Millisecond {
+		t.Errorf("expected 3 frames playing for 600ms, got %d frames playing for %v", report.Frames, report.Duration)
+	}
+
+	decoded, err := gif.DecodeAll(bytes.NewReader(output.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to decode the output: %v", err)
+	}
+	if len(decoded.Image) != 3 || decoded.LoopCount != 0 {
+		t.Errorf("expected 3 looping frames, got %d with loop count %d", len(decoded.Image), decoded.LoopCount)
+	}
+	for i, delay := range decoded.Delay {
+		if delay != animation.Delay[i] {
+			t.Errorf("expected frame %d to last %d, got %d", i, animation.Delay[i], delay)
+		}
+	}
+}
+
+// pngChunksOf returns the types of the chunks of the PNG image raw.
+func pngChunksOf(raw []byte) []string {
+	var types []string
+	for offset := len(pngSignature); offset+8 <= len(raw); {
+		types = append(types, string(raw[offset+4:offset+8]))
+		offset += 12 + int(binary.BigEndian.Uint32(raw[offset:]))
+	}
+	return types
+}
+
+func TestSanitizeAnimatedPNG(t *testing.T) {
+	still := new(bytes.Buffer)
+	if err := png.Encode(still, image.NewGray(image.Rect(0, 0, 3, 2))); err != nil {
+		t.Fatalf("failed to encode the frame: %v", err)
+	}
+	var ihdr, idat []byte
+	for offset := len(pngSignature); offset < still.Len(); {
+		length := int(binary.BigEndian.Uint32(still.Bytes()[offset:]))
+		switch string(still.Bytes()[offset+4 : offset+8]) {
+		case "IHDR":
+			ihdr = still.Bytes()[offset+8 : offset+8+length]
+		case "IDAT":
+			idat = append(idat, still.Bytes()[offset+8:offset+8+length]...)
+		}
+		offset += 12 + length
+	}
+
+	frameControl := func(sequence uint32, numerator, denominator uint16) []byte {
+		data := binary.BigEndian.AppendUint32(nil, sequence)
+		data = append(data, ihdr[:8]...) // The frame covers the whole canvas.
+		data = append(data, make([]byte, 8)...)
+		data = binary.BigEndian.AppendUint16(data, numerator)
+		data = binary.BigEndian.AppendUint16(data, denominator)
+		return pngChunk("fcTL", append(data, 0x00, 0x00))
+	}
+	tiff := exifSegmentOf([]testTag{asciiTag(tagMake, "Pixel")}, nil, nil)[4+len(exifIdent):]
+	build := func(metadata bool) []byte {
+		raw := append([]byte{}, pngSignature...)
+		raw = append(raw, pngChunk("IHDR", ihdr)...)
+		raw = append(raw, pngChunk("acTL", []byte{0, 0, 0, 2, 0, 0, 0, 0})...)
+		if metadata {
+			raw = append(raw, pngChunk("tEXt", []byte("Comment\x00secret"))...)
+			raw = append(raw, pngChunk("eXIf", tiff)...)
+		}
+		raw = append(raw, frameControl(0, 1, 10)...)
+		raw = append(raw, pngChunk("IDAT", idat)...)
+		raw = append(raw, frameControl(1, 250, 0)...)
+		raw = append(raw, pngChunk("fdAT", append([]byte{0, 0, 0, 2}, idat...))...)
+		if metadata {
+			raw = append(raw, pngChunk("tIME", []byte{0x07, 0xE8, 3, 2, 13, 45, 30})...)
+		}
+		return append(raw, pngChunk("IEND", nil)...)
+	}
+
+	output := new(bytes.Buffer)
+	report, err := Sanitize(bytes.NewReader(build(true)), output)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(build(false), output.Bytes()) {
+		t.Errorf("expected the chunks %v, got %v", pngChunksOf(build(false)), pngChunksOf(output.Bytes()))
+	}
+	if report.Format != "png" || !report.ExifRemoved || !report.MetadataRemoved || report.Width != 3 || report.Height != 2 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if report.Summary == nil || report.Summary.Make != "Pixel" {
+		t.Errorf("expected the EXIF data to be summarized, got %v", report.Summary)
+	}
+	if report.Frames != 2 || report.Duration != 2600*time.Millisecond {
+		t.Errorf("expected 2 frames playing for 2.6s, got %d frames playing for %v", report.Frames, report.Duration)
+	}
+	if _, err := png.Decode(bytes.NewReader(output.Bytes())); err != nil {
+		t.Errorf("failed to decode the output: %v", err)
+	}
+
+	t.Run("edited exif", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		report, err := Sanitize(bytes.NewReader(build(true)), output, WithTimestampPolicy(TimestampsRemove))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !report.ExifEdited || report.ExifRemoved {
+			t.Errorf("unexpected report: %+v", report)
+		}
+		if _, err := png.Decode(bytes.NewReader(output.Bytes())); err != nil {
+			t.Errorf("failed to decode the output: %v", err)
+		}
+	})
+}
+
+func TestSanitizeAnimatedWebP(t *testing.T) {
+	frame := func(milliseconds int) []byte {
+		data := make([]byte, 16)
+		data[6], data[9] = 2, 1 // A 3x2 frame.
+		data[12], data[13] = byte(milliseconds), byte(milliseconds>>8)
+		return webpChunk("ANMF", append(data, webpChunk("VP8L", []byte{0x2F, 0x02, 0x40, 0x00, 0x00})...))
+	}
+	tiff := exifSegmentOf([]testTag{asciiTag(tagMake, "Pixel")}, nil, nil)[4+len(exifIdent):]
+	build := func(flags byte, metadata bool) []byte {
+		riff := []byte("WEBP")
+		riff = append(riff, webpChunk("VP8X", []byte{flags, 0, 0, 0, 2, 0, 0, 1, 0, 0})...)
+		riff = append(riff, webpChunk("ICCP", []byte("profile"))...)
+		riff = append(riff, webpChunk("ANIM", []byte{0, 0, 0, 0, 0, 0})...)
+		riff = append(riff, frame(100)...)
+		riff = append(riff, frame(250)...)
+		if metadata {
+			riff = append(riff, webpChunk("EXIF", tiff)...)
+			riff = append(riff, webpChunk("XMP ", []byte("<x:xmpmeta/>\n"))...)
+		}
+		return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(riff)))...), riff...)
+	}
+
+	input := build(webpICCFlag|webpEXIFFlag|webpXMPFlag|webpAnimationFlag, true)
+	output := new(bytes.Buffer)
+	report, err := Sanitize(bytes.NewReader(input), output)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := build(webpICCFlag|webpAnimationFlag, false); !bytes.Equal(expected, output.Bytes()) {
+		t.Errorf("expected result to be: %x instead got: %x", expected, output.Bytes())
+	}
+	if report.Format != "webp" || !report.ExifRemoved || !report.MetadataRemoved || report.Width != 3 || report.Height != 2 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if report.Frames != 2 || report.Duration != 350*time.Millisecond {
+		t.Errorf("expected 2 frames playing for 350ms, got %d frames playing for %v", report.Frames, report.Duration)
+	}
+
+	// The sanitized animation reads back with the same frames and timing.
+	again, err := Sanitize(bytes.NewReader(output.Bytes()), new(bytes.Buffer))
+	if err != nil {
+		t.Fatalf("failed to read the output back: %v", err)
+	}
+	if again.Frames != 2 || again.Duration != 350*time.Millisecond || again.ExifRemoved {
+		t.Errorf("unexpected report of the output: %+v", again)
+	}
+}
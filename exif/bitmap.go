@@ -0,0 +1,237 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// bmpHeaderSizes are the sizes of the known BMP info headers, from the OS/2 core header to the
+// version 5 header.
+var bmpHeaderSizes = map[uint32]bool{12: true, 40: true, 52: true, 56: true, 64: true, 108: true, 124: true}
+
+func isBMP(raw []byte) bool {
+	return len(raw) >= 26 && string(raw[:2]) == "BM" && bmpHeaderSizes[binary.LittleEndian.Uint32(raw[14:])]
+}
+
+// bmpSize returns the size of the BMP image raw. Top-down images record a negative height.
+func bmpSize(raw []byte) (int, int) {
+	if binary.LittleEndian.Uint32(raw[14:]) == 12 {
+		return int(binary.LittleEndian.Uint16(raw[18:])), int(binary.LittleEndian.Uint16(raw[20:]))
+	}
+	width, height := int(int32(binary.LittleEndian.Uint32(raw[18:]))), int(int32(binary.LittleEndian.Uint32(raw[22:])))
+	if height < 0 {
+		height = -height
+	}
+	return width, height
+}
+
+// icoEntry is an image of an ICO file: its size in pixels, and where its data is in the file.
+type icoEntry struct {
+	width, height int
+	start, end    int
+}
+
+// isICO reports whether raw starts like an ICO file: a header announcing icons, and a first
+// directory entry whose reserved byte is zero and whose color planes are zero or one.
+func isICO(raw []byte) bool {
+	return len(raw) >= 22 && bytes.HasPrefix(raw, []byte{0, 0, 1, 0}) && binary.LittleEndian.Uint16(raw[4:]) > 0 &&
+		raw[9] == 0 && binary.LittleEndian.Uint16(raw[10:]) <= 1
+}
+
+// readICO returns the images of the ICO file raw.
+func readICO(raw []byte) ([]icoEntry, error) {
+	if len(raw) < 6 || !bytes.HasPrefix(raw, []byte{0, 0, 1, 0}) {
+		return nil, fmt.Errorf("not an ICO file")
+	}
+	count := int(binary.LittleEndian.Uint16(raw[4:]))
+	if count == 0 || len(raw) < 6+16*count {
+		return nil, fmt.Errorf("the ICO directory of %d images is truncated", count)
+	}
+	entries := make([]icoEntry, count)
+	for i := range entries {
+		dir := raw[6+16*i:]
+		e := icoEntry{width: int(dir[0]), height: int(dir[1])}
+		// A size of zero stands for 256 pixels.
+		if e.width == 0 {
+			e.width = 256
+		}
+		if e.height == 0 {
+			e.height = 256
+		}
+		size, offset := binary.LittleEndian.Uint32(dir[8:]), binary.LittleEndian.Uint32(dir[12:])
+		if uint64(offset) < uint64(6+16*count) || uint64(offset)+uint64(size) > uint64(len(raw)) {
+			return nil, fmt.Errorf("the ICO image %d is truncated", i)
+		}
+		e.start, e.end = int(offset), int(offset+size)
+		entries[i] = e
+	}
+	return entries, nil
+}
+
+// netpbmFormats are the formats of the PPM and PGM images of each magic number, in their plain
+// and raw variants.
+var netpbmFormats = map[string]string{"P2": "pgm", "P3": "ppm", "P5": "pgm", "P6": "ppm"}
+
+// netpbmHeader is the header of a PPM or PGM image.
+type netpbmHeader struct {
+	format                string
+	width, height, maxval int
+
+	// comments is true if the header holds comments, and end is where the raster starts.
+	comments bool
+	end      int
+}
+
+func isNetpbm(raw []byte) bool {
+	_, err := readNetpbm(raw)
+	return err == nil
+}
+
+// readNetpbm reads the header of the PPM or PGM image raw: its magic number, width, height and
+// maximum value, separated by whitespace and comments running from a # to the end of the line.
+// A single whitespace character separates the maximum value from the raster.
+func readNetpbm(raw []byte) (netpbmHeader, error) {
+	if len(raw) < 3 || !isNetpbmSpace(raw[2]) {
+		return netpbmHeader{}, fmt.Errorf("not a PPM or PGM image")
+	}
+	h := netpbmHeader{format: netpbmFormats[string(raw[:2])]}
+	if h.format == "" {
+		return netpbmHeader{}, fmt.Errorf("not a PPM or PGM image")
+	}
+	offset := 2
+	var values [3]int
+	for i := range values {
+		for offset < len(raw) && (isNetpbmSpace(raw[offset]) || raw[offset] == '#') {
+			if raw[offset] == '#' {
+				h.comments = true
+				for offset < len(raw) && raw[offset] != '\n' && raw[offset] != '\r' {
+					offset++
+				}
+				continue
+			}
+			offset++
+		}
+		start := offset
+		for offset < len(raw) && raw[offset] >= '0' && raw[offset] <= '9' {
+			offset++
+		}
+		n, err := strconv.Atoi(string(raw[start:offset]))
+		if err != nil || n <= 0 {
+			return netpbmHeader{}, fmt.Errorf("the %s header is invalid", h.format)
+		}
+		values[i] = n
+	}
+	if offset >= len(raw) || !isNetpbmSpace(raw[offset]) || values[2] > 65535 {
+		return netpbmHeader{}, fmt.Errorf("the %s header is invalid", h.format)
+	}
+	h.width, h.height, h.maxval = values[0], values[1], values[2]
+	h.end = offset + 1
+	return h, nil
+}
+
+func isNetpbmSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r'
+}
+
+// MetadataFree reports whether data is an image of a format that cannot carry metadata, which
+// Sanitize returns unchanged: a BMP image, an ICO file holding only bitmaps, or a PPM or PGM image
+// without comments. ICO files holding PNG images and PPM and PGM images with comments are
+// sanitized instead.
+func MetadataFree(data []byte) bool {
+	switch {
+	case isBMP(data):
+		return true
+	case isICO(data):
+		entries, err := readICO(data)
+		if err != nil {
+			return false
+		}
+		for _, e := range entries {
+			if bytes.HasPrefix(data[e.start:e.end], pngSignature) {
+				return false
+			}
+		}
+		return true
+	case isNetpbm(data):
+		h, _ := readNetpbm(data)
+		return !h.comments
+	}
+	return false
+}
+
+// sanitizeBMP returns the BMP image raw unchanged, as BMP images cannot carry metadata.
+func sanitizeBMP(raw []byte, o *options) ([][]byte, *Report, error) {
+	report := &Report{Format: "bmp"}
+	report.Width, report.Height = bmpSize(raw)
+	o.logf("BMP images cannot carry metadata")
+	return [][]byte{raw}, report, nil
+}
+
+// sanitizeICO sanitizes the PNG images of the ICO file raw, which may carry metadata as any PNG
+// image, and keeps its bitmaps, which cannot. The directory of the file is rewritten with the
+// new sizes and offsets of the images.
+func sanitizeICO(raw []byte, o *options) ([][]byte, *Report, error) {
+	entries, err := readICO(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	report := &Report{Format: "ico"}
+	directory := append([]byte{}, raw[:6+16*len(entries)]...)
+	parts := [][]byte{directory}
+	offset := len(directory)
+	for i, e := range entries {
+		if e.width*e.height > report.Width*report.Height {
+			report.Width, report.Height = e.width, e.height
+		}
+		image := [][]byte{raw[e.start:e.end]}
+		if bytes.HasPrefix(raw[e.start:e.end], pngSignature) {
+			png, pngReport, err := sanitizePNG(raw[e.start:e.end], o)
+			if err != nil {
+				return nil, nil, fmt.Errorf("the ICO image %d is invalid: %v", i, err)
+			}
+			image = png
+			report.ExifRemoved = report.ExifRemoved || pngReport.ExifRemoved
+			report.ExifEdited = report.ExifEdited || pngReport.ExifEdited
+			report.MetadataRemoved = report.MetadataRemoved || pngReport.MetadataRemoved
+			report.ICCRemoved = report.ICCRemoved || pngReport.ICCRemoved
+			report.SRGBAdded = report.SRGBAdded || pngReport.SRGBAdded
+			report.BytesRemoved += pngReport.BytesRemoved
+			if report.Summary == nil {
+				report.Summary = pngReport.Summary
+			}
+		}
+		size := 0
+		for _, part := range image {
+			size += len(part)
+		}
+		binary.LittleEndian.PutUint32(directory[6+16*i+8:], uint32(size))
+		binary.LittleEndian.PutUint32(directory[6+16*i+12:], uint32(offset))
+		parts = append(parts, image...)
+		offset += size
+	}
+	if !report.ExifRemoved && !report.MetadataRemoved {
+		o.logf("The ICO file holds no metadata")
+	}
+	return parts, report, nil
+}
+
+// sanitizeNetpbm removes the comments from the header of the PPM or PGM image raw, which are the
+// only metadata these images can carry, and keeps its raster.
+func sanitizeNetpbm(raw []byte, o *options) ([][]byte, *Report, error) {
+	h, err := readNetpbm(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	report := &Report{Format: h.format, Width: h.width, Height: h.height}
+	if !h.comments {
+		o.logf("The %s header holds no comments", h.format)
+		return [][]byte{raw}, report, nil
+	}
+	header := []byte(fmt.Sprintf("%s\n%d %d\n%d\n", raw[:2], h.width, h.height, h.maxval))
+	o.logf("Removing the comments of the %s header", h.format)
+	report.MetadataRemoved = true
+	report.BytesRemoved = h.end - len(header)
+	return [][]byte{header, raw[h.end:]}, report, nil
+}
@@ -0,0 +1,144 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// bmpOf returns a 3x2 BMP image with a version 3 info header and no pixels.
+func bmpOf() []byte {
+	raw := append([]byte("BM"), make([]byte, 12)...)
+	raw = binary.LittleEndian.AppendUint32(raw, 40)
+	raw = binary.LittleEndian.AppendUint32(raw, 3)
+	raw = binary.LittleEndian.AppendUint32(raw, uint32(0xFFFFFFFE)) // Top-down, 2 rows.
+	return append(raw, make([]byte, 28)...)
+}
+
+// icoOf returns an ICO file holding the given images, each announced as 16x16.
+func icoOf(images ...[]byte) []byte {
+	raw := binary.LittleEndian.AppendUint16([]byte{0, 0, 1, 0}, uint16(len(images)))
+	offset := 6 + 16*len(images)
+	for _, image := range images {
+		raw = append(raw, 16, 16, 0, 0, 1, 0, 32, 0)
+		raw = binary.LittleEndian.AppendUint32(raw, uint32(len(image)))
+		raw = binary.LittleEndian.AppendUint32(raw, uint32(offset))
+		offset += len(image)
+	}
+	for _, image := range images {
+		raw = append(raw, image...)
+	}
+	return raw
+}
+
+func TestSanitizeBitmaps(t *testing.T) {
+	bitmap := append(binary.LittleEndian.AppendUint32(nil, 40), make([]byte, 36)...)
+	textChunk := pngChunk("tEXt", []byte("Author\x00Secret"))
+
+	testTable := []struct {
+		Name         string
+		Input        []byte
+		Output       []byte
+		Format       string
+		Width        int
+		Height       int
+		MetadataFree bool
+	}{
+		{
+			Name:         "bmp",
+			Input:        bmpOf(),
+			Output:       bmpOf(),
+			Format:       "bmp",
+			Width:        3,
+			Height:       2,
+			MetadataFree: true,
+		},
+		{
+			Name:         "ico",
+			Input:        icoOf(bitmap),
+			Output:       icoOf(bitmap),
+			Format:       "ico",
+			Width:        16,
+			Height:       16,
+			MetadataFree: true,
+		},
+		{
+			Name:   "ico holding a png",
+			Input:  icoOf(bitmap, stillPNG(t, textChunk)),
+			Output: icoOf(bitmap, stillPNG(t)),
+			Format: "ico",
+			Width:  16,
+			Height: 16,
+		},
+		{
+			Name:         "raw ppm",
+			Input:        []byte("P6 1 1 255\n\x00\x0A\x20"),
+			Output:       []byte("P6 1 1 255\n\x00\x0A\x20"),
+			Format:       "ppm",
+			Width:        1,
+			Height:       1,
+			MetadataFree: true,
+		},
+		{
+			Name:         "plain pgm",
+			Input:        []byte("P2\n2 1\n15\n0 15\n"),
+			Output:       []byte("P2\n2 1\n15\n0 15\n"),
+			Format:       "pgm",
+			Width:        2,
+			Height:       1,
+			MetadataFree: true,
+		},
+		{
+			Name:   "ppm with comments",
+			Input:  []byte("P6\n# Created by Scanner 3000\n1 1 # one pixel\n255\r\x00\x0A\x20"),
+			Output: []byte("P6\n1 1\n255\n\x00\x0A\x20"),
+			Format: "ppm",
+			Width:  1,
+			Height: 1,
+		},
+	}
+
+	for _, test := range testTable {
+		output := new(bytes.Buffer)
+		report, err := Sanitize(bytes.NewReader(test.Input), output)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if !bytes.Equal(test.Output, output.Bytes()) {
+			t.Errorf("%s: expected result to be: %q instead got: %q", test.Name, test.Output, output.Bytes())
+		}
+		if report.Format != test.Format || report.Width != test.Width || report.Height != test.Height {
+			t.Errorf("%s: unexpected report: %+v", test.Name, report)
+		}
+		if report.MetadataRemoved == test.MetadataFree || report.BytesRemoved != len(test.Input)-output.Len() {
+			t.Errorf("%s: unexpected report: %+v", test.Name, report)
+		}
+		if MetadataFree(test.Input) != test.MetadataFree {
+			t.Errorf("%s: expected MetadataFree to be %v", test.Name, test.MetadataFree)
+		}
+		if Detect(test.Input) != test.Format {
+			t.Errorf("%s: expected %s to be detected, got %q", test.Name, test.Format, Detect(test.Input))
+		}
+	}
+}
+
+func TestSanitizeBitmapErrors(t *testing.T) {
+	testTable := []struct {
+		Name  string
+		Input []byte
+	}{
+		{Name: "ico truncated", Input: icoOf(make([]byte, 40))[:30]},
+		{Name: "ppm without raster separator", Input: []byte("P6 1 1 255")},
+		{Name: "ppm of zero width", Input: []byte("P6 0 1 255\n")},
+	}
+
+	for _, test := range testTable {
+		if _, err := Sanitize(bytes.NewReader(test.Input), new(bytes.Buffer)); err == nil {
+			t.Errorf("%s: expected an error", test.Name)
+		}
+		if MetadataFree(test.Input) {
+			t.Errorf("%s: expected MetadataFree to be false", test.Name)
+		}
+	}
+}
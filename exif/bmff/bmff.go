@@ -0,0 +1,142 @@
+// Package bmff reads and writes the boxes of ISO base media files: MP4 and QuickTime videos,
+// HEIF and AVIF images, and JPEG 2000 images, which share their box structure. It also reads the
+// item information, location and reference boxes of the meta boxes of HEIF and AVIF images,
+// which locate their images and metadata items. Boxes are read from files held in memory, and
+// refer to them by offset, so that their payloads can be edited in place without moving the
+// media data the files locate by offset.
+package bmff
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Box is a box of an ISO base media file.
+type Box struct {
+	// Type is the four character code of the box, such as moov or meta.
+	Type string
+
+	// Start is where the box starts in the file, Payload where its header ends and its payload
+	// starts, and End where it ends.
+	Start, Payload, End int
+}
+
+// Size returns the size of the box in the file: its header and its payload.
+func (b Box) Size() int {
+	return b.End - b.Start
+}
+
+// ReadBoxes returns the boxes of data between start and end, such as the top-level boxes of a
+// file or the children of a container box, whose payload they fill. Boxes of size 0 extend to
+// end, and boxes of size 1 have a 64 bit size following their type.
+func ReadBoxes(data []byte, start, end int) ([]Box, error) {
+	var boxes []Box
+	for offset := start; offset < end; {
+		if offset+8 > end {
+			return nil, fmt.Errorf("the box at offset %d is truncated", offset)
+		}
+		size := uint64(binary.BigEndian.Uint32(data[offset:]))
+		b := Box{Type: string(data[offset+4 : offset+8]), Start: offset, Payload: offset + 8}
+		switch size {
+		case 0:
+			// The box extends to the end of its parent.
+			size = uint64(end - offset)
+		case 1:
+			if offset+16 > end {
+				return nil, fmt.Errorf("the %q box at offset %d is truncated", b.Type, offset)
+			}
+			size = binary.BigEndian.Uint64(data[offset+8:])
+			b.Payload += 8
+		}
+		if size < uint64(b.Payload-offset) || size > uint64(end-offset) {
+			return nil, fmt.Errorf("the %q box at offset %d has invalid size %d", b.Type, offset, size)
+		}
+		b.End = offset + int(size)
+		boxes = append(boxes, b)
+		offset = b.End
+	}
+	return boxes, nil
+}
+
+// Find returns the first of boxes of the given type, or nil if there is none.
+func Find(boxes []Box, typ string) *Box {
+	for i := range boxes {
+		if boxes[i].Type == typ {
+			return &boxes[i]
+		}
+	}
+	return nil
+}
+
+// Append appends a box of the given type to dst, whose payload is the concatenation of the given
+// parts, such as child boxes, and returns the extended slice.
+func Append(dst []byte, typ string, payload ...[]byte) []byte {
+	size := 8
+	for _, part := range payload {
+		size += len(part)
+	}
+	dst = append(binary.BigEndian.AppendUint32(dst, uint32(size)), typ...)
+	for _, part := range payload {
+		dst = append(dst, part...)
+	}
+	return dst
+}
+
+// Free returns a free box of the given size, which is at least 8, blanked with zeros.
+func Free(size int) []byte {
+	box := make([]byte, size)
+	binary.BigEndian.PutUint32(box, uint32(size))
+	copy(box[4:], "free")
+	return box
+}
+
+// MakeFree turns the box b of data into a free box of the same size in place, blanking its
+// payload, so that the offsets of what follows it stay valid.
+func MakeFree(data []byte, b Box) {
+	copy(data[b.Start+4:], "free")
+	payload := data[b.Payload:b.End]
+	for i := range payload {
+		payload[i] = 0
+	}
+}
+
+// FieldReader reads the big endian fields of a payload one after the other, recording whether
+// it ran past its end.
+type FieldReader struct {
+	data []byte
+	err  error
+}
+
+// NewFieldReader returns a FieldReader reading the fields of data.
+func NewFieldReader(data []byte) *FieldReader {
+	return &FieldReader{data: data}
+}
+
+// Uint reads a field of the given size in bytes: 0, 1, 2, 4 or 8. Fields of size 0 are zero, as
+// the item location box declares absent fields. Once a field cannot be read, the following ones
+// are zero too.
+func (r *FieldReader) Uint(size int) uint64 {
+	if r.err != nil || size == 0 {
+		return 0
+	}
+	if size > len(r.data) || (size != 1 && size != 2 && size != 4 && size != 8) {
+		r.err = fmt.Errorf("the field of size %d is truncated or invalid", size)
+		return 0
+	}
+	var v uint64
+	for _, b := range r.data[:size] {
+		v = v<<8 | uint64(b)
+	}
+	r.data = r.data[size:]
+	return v
+}
+
+// Rest returns the data following the fields read.
+func (r *FieldReader) Rest() []byte {
+	return r.data
+}
+
+// Err returns the error of the first field that could not be read, if any.
+func (r *FieldReader) Err() error {
+	return r.err
+}
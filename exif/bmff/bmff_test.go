@@ -0,0 +1,160 @@
+package bmff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// boxOf returns a box of the given type holding the given children.
+func boxOf(typ string, children ...[]byte) []byte {
+	return Append(nil, typ, children...)
+}
+
+// tree returns the types of the boxes of data between start and end, and of the children of the
+// given container boxes, in the order they appear, children being indented under their parent.
+func tree(t *testing.T, data []byte, start, end int, containers map[string]int, depth int) []string {
+	t.Helper()
+	boxes, err := ReadBoxes(data, start, end)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var types []string
+	for _, b := range boxes {
+		types = append(types, strings.Repeat(" ", depth)+b.Type)
+		if skip, ok := containers[b.Type]; ok {
+			types = append(types, tree(t, data, b.Payload+skip, b.End, containers, depth+1)...)
+		}
+	}
+	return types
+}
+
+func TestReadBoxesCorpus(t *testing.T) {
+	mvhd := boxOf("mvhd", make([]byte, 100))
+	largeMdat := append(binary.BigEndian.AppendUint32(nil, 1), "mdat"...)
+	largeMdat = binary.BigEndian.AppendUint64(largeMdat, 16+6)
+	largeMdat = append(largeMdat, "frames"...)
+
+	// The corpus holds the layouts of the files of the formats the exif package handles, as
+	// written by phones, cameras and common tools.
+	testTable := []struct {
+		Name       string
+		Data       []byte
+		Containers map[string]int
+		Tree       []string
+	}{
+		{
+			Name: "mp4 video",
+			Data: bytes.Join([][]byte{
+				boxOf("ftyp", []byte("isom\x00\x00\x02\x00isomiso2mp41")),
+				boxOf("moov", mvhd, boxOf("trak", boxOf("tkhd", make([]byte, 84)), boxOf("mdia", boxOf("mdhd", make([]byte, 24)))),
+					boxOf("udta", boxOf("\xa9xyz", []byte("\x00\x12\x15\xc7+52.3700+004.8900/")))),
+				boxOf("mdat", []byte("frames")),
+			}, nil),
+			Containers: map[string]int{"moov": 0, "trak": 0, "mdia": 0, "udta": 0},
+			Tree:       []string{"ftyp", "moov", " mvhd", " trak", "  tkhd", "  mdia", "   mdhd", " udta", "  \xa9xyz", "mdat"},
+		},
+		{
+			Name: "quicktime video with a 64 bit media data box",
+			Data: bytes.Join([][]byte{
+				boxOf("ftyp", []byte("qt  \x00\x00\x00\x00qt  ")),
+				boxOf("wide"),
+				largeMdat,
+				boxOf("moov", mvhd, boxOf("meta", boxOf("hdlr", make([]byte, 24)), boxOf("keys", make([]byte, 8)), boxOf("ilst"))),
+			}, nil),
+			Containers: map[string]int{"moov": 0, "meta": 0},
+			Tree:       []string{"ftyp", "wide", "mdat", "moov", " mvhd", " meta", "  hdlr", "  keys", "  ilst"},
+		},
+		{
+			Name: "heic photo",
+			Data: bytes.Join([][]byte{
+				boxOf("ftyp", []byte("heic\x00\x00\x00\x00mif1heic")),
+				boxOf("meta", []byte{0, 0, 0, 0}, boxOf("hdlr", make([]byte, 24)), boxOf("pitm", []byte{0, 0, 0, 0, 0, 1}),
+					boxOf("iinf", []byte{0, 0, 0, 0, 0, 0}), boxOf("iloc", []byte{0, 0, 0, 0, 0x44, 0, 0, 0})),
+				boxOf("mdat", []byte("image")),
+			}, nil),
+			Containers: map[string]int{"meta": 4},
+			Tree:       []string{"ftyp", "meta", " hdlr", " pitm", " iinf", " iloc", "mdat"},
+		},
+		{
+			Name: "avif photo whose media data box extends to the end of the file",
+			Data: bytes.Join([][]byte{
+				boxOf("ftyp", []byte("avif\x00\x00\x00\x00avifmif1miaf")),
+				boxOf("meta", []byte{0, 0, 0, 0}, boxOf("hdlr", make([]byte, 24))),
+				append([]byte{0, 0, 0, 0, 'm', 'd', 'a', 't'}, "av1 frames"...),
+			}, nil),
+			Containers: map[string]int{"meta": 4},
+			Tree:       []string{"ftyp", "meta", " hdlr", "mdat"},
+		},
+		{
+			Name: "jpeg 2000 image",
+			Data: bytes.Join([][]byte{
+				{0x00, 0x00, 0x00, 0x0C, 'j', 'P', ' ', ' ', 0x0D, 0x0A, 0x87, 0x0A},
+				boxOf("ftyp", []byte("jp2 \x00\x00\x00\x00jp2 ")),
+				boxOf("jp2h", boxOf("ihdr", make([]byte, 14)), boxOf("colr", []byte{1, 0, 0, 0, 0, 0, 16})),
+				boxOf("xml ", []byte("<x:xmpmeta/>")),
+				boxOf("jp2c", []byte{0xFF, 0x4F, 0xFF, 0xD9}),
+			}, nil),
+			Containers: map[string]int{"jp2h": 0},
+			Tree:       []string{"jP  ", "ftyp", "jp2h", " ihdr", " colr", "xml ", "jp2c"},
+		},
+	}
+
+	for _, test := range testTable {
+		if types := tree(t, test.Data, 0, len(test.Data), test.Containers, 0); !reflect.DeepEqual(test.Tree, types) {
+			t.Errorf("%s: expected boxes %q, got %q", test.Name, test.Tree, types)
+		}
+	}
+}
+
+func TestReadBoxesErrors(t *testing.T) {
+	testTable := []struct {
+		Name string
+		Data []byte
+	}{
+		{Name: "truncated header", Data: []byte{0, 0, 0, 8, 'f', 't'}},
+		{Name: "past the end", Data: boxOf("ftyp", []byte("isom"))[:10]},
+		{Name: "smaller than its header", Data: []byte{0, 0, 0, 4, 'f', 'r', 'e', 'e'}},
+		{Name: "truncated 64 bit size", Data: []byte{0, 0, 0, 1, 'm', 'd', 'a', 't', 0, 0}},
+		{Name: "64 bit size past the end", Data: append([]byte{0, 0, 0, 1, 'm', 'd', 'a', 't'}, binary.BigEndian.AppendUint64(nil, 1<<40)...)},
+	}
+
+	for _, test := range testTable {
+		if _, err := ReadBoxes(test.Data, 0, len(test.Data)); err == nil {
+			t.Errorf("%s: expected an error", test.Name)
+		}
+	}
+}
+
+func TestWriteBoxes(t *testing.T) {
+	data := boxOf("moov", boxOf("udta", []byte("location")), boxOf("mvhd", []byte("header")))
+	if size := binary.BigEndian.Uint32(data); int(size) != len(data) {
+		t.Errorf("expected size %d, got %d", len(data), size)
+	}
+
+	boxes, _ := ReadBoxes(data, 8, len(data))
+	udta := Find(boxes, "udta")
+	if udta == nil || udta.Size() != 16 || Find(boxes, "trak") != nil {
+		t.Fatalf("unexpected boxes: %+v", boxes)
+	}
+	MakeFree(data, *udta)
+	expected := boxOf("moov", Free(16), boxOf("mvhd", []byte("header")))
+	if !bytes.Equal(expected, data) {
+		t.Errorf("expected %q, got %q", expected, data)
+	}
+}
+
+func TestFieldReader(t *testing.T) {
+	r := NewFieldReader([]byte{1, 0, 2, 0, 0, 0, 3, 9})
+	if a, b, c, d := r.Uint(1), r.Uint(2), r.Uint(0), r.Uint(4); a != 1 || b != 2 || c != 0 || d != 3 {
+		t.Errorf("unexpected fields: %d %d %d %d", a, b, c, d)
+	}
+	if !bytes.Equal(r.Rest(), []byte{9}) || r.Err() != nil {
+		t.Errorf("unexpected rest %v or error %v", r.Rest(), r.Err())
+	}
+	if r.Uint(2) != 0 || r.Err() == nil || r.Uint(1) != 0 {
+		t.Errorf("expected reading past the end to fail")
+	}
+}
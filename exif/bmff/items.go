@@ -0,0 +1,190 @@
+package bmff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Item is an entry of the item information box of a meta box, describing an item of a HEIF or
+// AVIF image, such as an image, its EXIF data or an XMP packet.
+type Item struct {
+	ID uint32
+
+	// Type is the item type, such as hvc1 or av01 for images, Exif for EXIF data, and mime for
+	// items whose ContentType names their type, such as application/rdf+xml for XMP packets.
+	// Entries before version 2 have no item type.
+	Type string
+
+	// Name is the name of the item, often empty.
+	Name        string
+	ContentType string
+}
+
+// Extent is a part of the data of an item, between Start and End in the file.
+type Extent struct {
+	Start, End int
+}
+
+// Items returns the entries of the item information box iinf of data.
+func Items(data []byte, iinf Box) ([]Item, error) {
+	payload := data[iinf.Payload:iinf.End]
+	if len(payload) < 6 {
+		return nil, fmt.Errorf("the iinf box at offset %d is truncated", iinf.Start)
+	}
+	start := iinf.Payload + 6
+	if payload[0] != 0 {
+		start += 2
+	}
+	entries, err := ReadBoxes(data, start, iinf.End)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []Item
+	for _, e := range entries {
+		if e.Type != "infe" || e.End-e.Payload < 4 {
+			continue
+		}
+		entry := data[e.Payload:e.End]
+		r := NewFieldReader(entry[4:])
+		var item Item
+		switch version := entry[0]; {
+		case version < 2:
+			// The item ID and protection index precede the name of the item.
+			item.ID = uint32(r.Uint(2))
+			r.Uint(2)
+		default:
+			size := 2
+			if version > 2 {
+				size = 4
+			}
+			item.ID = uint32(r.Uint(size))
+			r.Uint(2)
+			item.Type = string(binary.BigEndian.AppendUint32(nil, uint32(r.Uint(4))))
+		}
+		if r.Err() != nil {
+			continue
+		}
+		fields := bytes.SplitN(r.Rest(), []byte{0}, 3)
+		item.Name = string(fields[0])
+		if len(fields) >= 2 && (item.Type == "mime" || item.Type == "") {
+			item.ContentType = string(fields[1])
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// ItemLocations returns the extents of the items of the item location box iloc of data, by item
+// ID. Items stored in the file, or in the idat box of their meta box, are located; items built
+// from other items have no extents. Extents of length 0 run to the end of the file or of the idat
+// box.
+func ItemLocations(data []byte, iloc Box, idat *Box) (map[uint32][]Extent, error) {
+	payload := data[iloc.Payload:iloc.End]
+	truncated := fmt.Errorf("the iloc box at offset %d is truncated", iloc.Start)
+	if len(payload) < 8 {
+		return nil, truncated
+	}
+	version := payload[0]
+	offsetSize, lengthSize := int(payload[4]>>4), int(payload[4]&0x0F)
+	baseOffsetSize, indexSize := int(payload[5]>>4), 0
+	if version == 1 || version == 2 {
+		indexSize = int(payload[5] & 0x0F)
+	}
+	// Version 2 boxes have 4 byte item counts and IDs.
+	idSize := 2
+	if version == 2 {
+		idSize = 4
+	}
+	r := NewFieldReader(payload[6:])
+	count := r.Uint(idSize)
+
+	locations := make(map[uint32][]Extent)
+	for i := uint64(0); i < count && r.Err() == nil; i++ {
+		id := uint32(r.Uint(idSize))
+		method := uint64(0)
+		if version == 1 || version == 2 {
+			method = r.Uint(2) & 0x0F
+		}
+		r.Uint(2) // The data reference index.
+		base := r.Uint(baseOffsetSize)
+		extents := r.Uint(2)
+		for j := uint64(0); j < extents && r.Err() == nil; j++ {
+			r.Uint(indexSize)
+			offset, length := base+r.Uint(offsetSize), r.Uint(lengthSize)
+			var start, end uint64
+			switch method {
+			case 0:
+				start, end = offset, uint64(len(data))
+			case 1:
+				if idat == nil {
+					return nil, fmt.Errorf("item %d is stored in a missing idat box", id)
+				}
+				start, end = uint64(idat.Payload)+offset, uint64(idat.End)
+			default:
+				continue
+			}
+			if length == 0 {
+				length = end - start
+			}
+			if start > end || length > end-start {
+				return nil, fmt.Errorf("item %d is out of bounds", id)
+			}
+			locations[id] = append(locations[id], Extent{Start: int(start), End: int(start + length)})
+		}
+	}
+	if r.Err() != nil {
+		return nil, truncated
+	}
+	return locations, nil
+}
+
+// ItemReferences returns the items the references of the given type of the item reference box
+// iref of data point to, by the ID of the item they are from. The cdsc references of metadata
+// items, for instance, point to the images they describe. References that cannot be read are
+// left out.
+func ItemReferences(data []byte, iref Box, refType string) map[uint32][]uint32 {
+	references := make(map[uint32][]uint32)
+	if iref.End-iref.Payload < 4 {
+		return references
+	}
+	size := 2
+	if data[iref.Payload] != 0 {
+		size = 4
+	}
+	boxes, err := ReadBoxes(data, iref.Payload+4, iref.End)
+	if err != nil {
+		return references
+	}
+	for _, ref := range boxes {
+		if ref.Type != refType {
+			continue
+		}
+		r := NewFieldReader(data[ref.Payload:ref.End])
+		from, count := uint32(r.Uint(size)), r.Uint(2)
+		for i := uint64(0); i < count; i++ {
+			to := uint32(r.Uint(size))
+			if r.Err() != nil {
+				break
+			}
+			references[from] = append(references[from], to)
+		}
+	}
+	return references
+}
+
+// PrimaryItem returns the ID of the item of the primary item box pitm of data, or 0 if it cannot
+// be read.
+func PrimaryItem(data []byte, pitm Box) uint32 {
+	payload := data[pitm.Payload:pitm.End]
+	if len(payload) < 4 {
+		return 0
+	}
+	r := NewFieldReader(payload[4:])
+	size := 2
+	if payload[0] != 0 {
+		size = 4
+	}
+	return uint32(r.Uint(size))
+}
@@ -0,0 +1,162 @@
+package bmff
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// infeOf returns an item information entry of the given version, item ID and type, followed by
+// the given name and content type. Entries before version 2 have no item type.
+func infeOf(version byte, id uint32, itemType string, fields ...string) []byte {
+	entry := []byte{version, 0, 0, 0}
+	if version > 2 {
+		entry = binary.BigEndian.AppendUint32(entry, id)
+	} else {
+		entry = binary.BigEndian.AppendUint16(entry, uint16(id))
+	}
+	entry = append(entry, 0, 0)
+	if version >= 2 {
+		entry = append(entry, itemType...)
+	}
+	for _, field := range fields {
+		entry = append(append(entry, field...), 0)
+	}
+	return boxOf("infe", entry)
+}
+
+func TestItems(t *testing.T) {
+	iinf := boxOf("iinf", []byte{0, 0, 0, 0, 0, 4},
+		infeOf(2, 1, "hvc1", ""),
+		infeOf(2, 2, "Exif", ""),
+		infeOf(3, 70000, "mime", "XMP", "application/rdf+xml"),
+		infeOf(0, 4, "", "thumbnail", "image/jpeg"),
+		boxOf("free"),
+	)
+	boxes, _ := ReadBoxes(iinf, 0, len(iinf))
+	items, err := Items(iinf, boxes[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []Item{
+		{ID: 1, Type: "hvc1"},
+		{ID: 2, Type: "Exif"},
+		{ID: 70000, Type: "mime", Name: "XMP", ContentType: "application/rdf+xml"},
+		{ID: 4, Name: "thumbnail", ContentType: "image/jpeg"},
+	}
+	if !reflect.DeepEqual(expected, items) {
+		t.Errorf("expected items %+v, got %+v", expected, items)
+	}
+
+	if _, err := Items(iinf[:12], Box{Type: "iinf", Payload: 8, End: 12}); err == nil {
+		t.Errorf("expected a truncated box to fail")
+	}
+}
+
+func TestItemLocations(t *testing.T) {
+	// The file holds an idat box, whose payload holds "idat" at offset 2, the iloc box and the data
+	// of the items, up to 200 bytes.
+	idat := boxOf("idat", []byte("xxidat"))
+
+	testTable := []struct {
+		Name      string
+		Iloc      []byte
+		Locations map[uint32][]Extent
+		Error     bool
+	}{
+		{
+			Name: "version 0",
+			// 4 byte offsets and lengths, 2 byte base offsets.
+			Iloc: []byte{0, 0, 0, 0, 0x44, 0x20, 0, 1,
+				0, 1, 0, 0, 0, 100, 0, 2, 0, 0, 0, 10, 0, 0, 0, 5, 0, 0, 0, 20, 0, 0, 0, 0},
+			Locations: map[uint32][]Extent{1: {{Start: 110, End: 115}, {Start: 120, End: 200}}},
+		},
+		{
+			Name: "version 1 with an item in the idat box and a derived item",
+			Iloc: []byte{1, 0, 0, 0, 0x44, 0x00, 0, 3,
+				0, 1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 50, 0, 0, 0, 4,
+				0, 2, 0, 1, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 4,
+				0, 3, 0, 2, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1},
+			Locations: map[uint32][]Extent{1: {{Start: 50, End: 54}}, 2: {{Start: 10, End: 14}}},
+		},
+		{
+			Name: "version 2 with 8 byte offsets and extent indexes",
+			Iloc: []byte{2, 0, 0, 0, 0x84, 0x04, 0, 0, 0, 1,
+				0, 1, 0x11, 0x70, 0, 0, 0, 0, 0, 1, 0, 0, 0, 7, 0, 0, 0, 0, 0, 0, 0, 60, 0, 0, 0, 3},
+			Locations: map[uint32][]Extent{70000: {{Start: 60, End: 63}}},
+		},
+		{
+			Name:  "out of bounds",
+			Iloc:  []byte{0, 0, 0, 0, 0x44, 0x00, 0, 1, 0, 1, 0, 0, 0, 1, 0, 0, 0, 190, 0, 0, 0, 20},
+			Error: true,
+		},
+		{
+			Name:  "truncated",
+			Iloc:  []byte{0, 0, 0, 0, 0x44, 0x00, 0, 2, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1},
+			Error: true,
+		},
+	}
+
+	for _, test := range testTable {
+		iloc := boxOf("iloc", test.Iloc)
+		data := append(append(append([]byte{}, idat...), iloc...), make([]byte, 200-len(idat)-len(iloc))...)
+		boxes, err := ReadBoxes(data, 0, len(idat)+len(iloc))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.Name, err)
+		}
+		locations, err := ItemLocations(data, boxes[1], &boxes[0])
+		if (err != nil) != test.Error {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if !test.Error && !reflect.DeepEqual(test.Locations, locations) {
+			t.Errorf("%s: expected locations %v, got %v", test.Name, test.Locations, locations)
+		}
+	}
+
+	// Items stored in the idat box of meta boxes without one cannot be located.
+	iloc := boxOf("iloc", []byte{1, 0, 0, 0, 0x44, 0x00, 0, 1, 0, 1, 0, 1, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1})
+	if _, err := ItemLocations(iloc, Box{Type: "iloc", Payload: 8, End: len(iloc)}, nil); err == nil {
+		t.Errorf("expected an item of a missing idat box to fail")
+	}
+}
+
+func TestItemReferences(t *testing.T) {
+	iref := boxOf("iref", []byte{0, 0, 0, 0},
+		boxOf("cdsc", []byte{0, 3, 0, 1, 0, 1}),
+		boxOf("thmb", []byte{0, 5, 0, 1, 0, 1}),
+		boxOf("cdsc", []byte{0, 4, 0, 2, 0, 1, 0, 2}),
+		boxOf("cdsc", []byte{0, 6, 0, 2, 0, 1}),
+	)
+	boxes, _ := ReadBoxes(iref, 0, len(iref))
+	expected := map[uint32][]uint32{3: {1}, 4: {1, 2}, 6: {1}}
+	if references := ItemReferences(iref, boxes[0], "cdsc"); !reflect.DeepEqual(expected, references) {
+		t.Errorf("expected references %v, got %v", expected, references)
+	}
+
+	// Version 1 references have 4 byte item IDs.
+	iref = boxOf("iref", []byte{1, 0, 0, 0}, boxOf("cdsc", []byte{0, 1, 0x11, 0x70, 0, 1, 0, 0, 0, 1}))
+	boxes, _ = ReadBoxes(iref, 0, len(iref))
+	expected = map[uint32][]uint32{70000: {1}}
+	if references := ItemReferences(iref, boxes[0], "cdsc"); !reflect.DeepEqual(expected, references) {
+		t.Errorf("expected references %v, got %v", expected, references)
+	}
+}
+
+func TestPrimaryItem(t *testing.T) {
+	testTable := []struct {
+		Pitm    []byte
+		Primary uint32
+	}{
+		{Pitm: []byte{0, 0, 0, 0, 0, 7}, Primary: 7},
+		{Pitm: []byte{1, 0, 0, 0, 0, 1, 0x11, 0x70}, Primary: 70000},
+		{Pitm: []byte{0, 0, 0, 0, 0}, Primary: 0},
+	}
+
+	for _, test := range testTable {
+		pitm := boxOf("pitm", test.Pitm)
+		if primary := PrimaryItem(pitm, Box{Type: "pitm", Payload: 8, End: len(pitm)}); primary != test.Primary {
+			t.Errorf("%v: expected primary item %d, got %d", test.Pitm, test.Primary, primary)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// C2PAPolicy controls what Sanitize does with C2PA manifest stores (Content Credentials), which
+// record the provenance of an image. Cameras and generative AI tools embed them in JPEG files
+// as JUMBF boxes split across APP11 segments.
+type C2PAPolicy int
+
+const (
+	// C2PAPreserve keeps C2PA manifests, for when provenance is desirable. It is the default.
+	C2PAPreserve C2PAPolicy = iota
+
+	// C2PAStrip removes C2PA manifests.
+	C2PAStrip
+
+	// C2PAStripAndReport removes C2PA manifests and returns the removed manifest store in the
+	// Report, so that callers can log or archive it.
+	C2PAStripAndReport
+)
+
+// String returns the name of the policy as used in configuration files and flags.
+func (p C2PAPolicy) String() string {
+	switch p {
+	case C2PAPreserve:
+		return "preserve"
+	case C2PAStrip:
+		return "strip"
+	case C2PAStripAndReport:
+		return "strip-and-report"
+	}
+	return "unknown"
+}
+
+// ParseC2PAPolicy returns the policy with the given name: preserve, strip or strip-and-report.
+func ParseC2PAPolicy(name string) (C2PAPolicy, bool) {
+	for _, policy := range []C2PAPolicy{C2PAPreserve, C2PAStrip, C2PAStripAndReport} {
+		if policy.String() == name {
+			return policy, true
+		}
+	}
+	return C2PAPreserve, false
+}
+
+var (
+	// The JPEG XT common identifier opening every APP11 segment carrying a JUMBF box.
+	jumbfIdent = []byte{'J', 'P'}
+
+	// The box types of a JUMBF superbox and of its description box.
+	jumbBox = []byte{'j', 'u', 'm', 'b'}
+	jumdBox = []byte{'j', 'u', 'm', 'd'}
+
+	// The first bytes of the type UUID of a C2PA manifest store.
+	c2paType = []byte{'c', '2', 'p', 'a'}
+)
+
+const (
+	// The size of the common identifier, box instance number and packet sequence number
+	// preceding the JUMBF box data in an APP11 segment.
+	jumbfSegmentHeaderSize = 8
+
+	// The size of a box header made of its length (LBox) and type (TBox).
+	boxHeaderSize = 8
+)
+
+// jumbfPacket is the part of a JUMBF box carried by a single APP11 segment. Boxes larger than a
+// segment are split into packets sharing an instance number.
+type jumbfPacket struct {
+	instance uint16
+	sequence uint32
+	data     []byte
+}
+
+// parseJUMBFPacket parses the payload of an APP11 segment. It returns false if the segment does
+// not carry a JUMBF box.
+func parseJUMBFPacket(payload []byte) (jumbfPacket, bool) {
+	if len(payload) < jumbfSegmentHeaderSize+boxHeaderSize || !bytes.Equal(payload[:2], jumbfIdent) {
+		return jumbfPacket{}, false
+	}
+	return jumbfPacket{
+		instance: binary.BigEndian.Uint16(payload[2:]),
+		sequence: binary.BigEndian.Uint32(payload[4:]),
+		data:     payload[jumbfSegmentHeaderSize:],
+	}, true
+}
+
+// boxHeaderLen returns the size of the header of the box starting at data, which is longer when
+// the box uses an extended length (XLBox). data must hold at least boxHeaderSize bytes.
+func boxHeaderLen(data []byte) int {
+	if binary.BigEndian.Uint32(data) == 1 && len(data) >= boxHeaderSize+8 {
+		return boxHeaderSize + 8
+	}
+	return boxHeaderSize
+}
+
+// isC2PA reports whether the packet is the first of a C2PA manifest store: a JUMBF superbox
+// whose description box has the C2PA type.
+func (p jumbfPacket) isC2PA() bool {
+	if !bytes.Equal(p.data[4:8], jumbBox) {
+		return false
+	}
+	description := p.data[boxHeaderLen(p.data):]
+	return len(description) >= boxHeaderSize+len(c2paType) &&
+		bytes.Equal(description[4:8], jumdBox) &&
+		bytes.Equal(description[boxHeaderSize:boxHeaderSize+len(c2paType)], c2paType)
+}
+
+// findC2PA returns the APP11 segments carrying a C2PA manifest store, and the manifest store
+// reassembled from them.
+func findC2PA(raw []byte, segments []segment) ([]segment, []byte) {
+	var found []segment
+	var manifest []byte
+	var instance uint16
+	inManifest := false
+	for _, s := range segments {
+		if s.marker != app11Marker {
+			continue
+		}
+		packet, ok := parseJUMBFPacket(s.payload(raw))
+		if !ok {
+			continue
+		}
+
+		switch {
+		case packet.isC2PA():
+			instance, inManifest = packet.instance, true
+			manifest = append(manifest, packet.data...)
+		case inManifest && packet.instance == instance && packet.sequence > 1:
+			// Continuation packets repeat the superbox header before the rest of its data.
+			manifest = append(manifest, packet.data[boxHeaderLen(packet.data):]...)
+		default:
+			continue
+		}
+		found = append(found, s)
+	}
+	return found, manifest
+}
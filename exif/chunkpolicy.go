@@ -0,0 +1,101 @@
+package exif
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pngDisplayChunks are the public ancillary chunks of PNG images that describe how to display
+// them or their animation, and that Sanitize keeps by default. Other ancillary chunks, whether
+// public ones this list does not know or private ones of applications, are removed, besides the
+// eXIf, text, time and iCCP chunks, which have options of their own.
+var pngDisplayChunks = map[string]bool{
+	"bKGD": true, "cHRM": true, "cICP": true, "cLLI": true, "mDCV": true, "gAMA": true,
+	"hIST": true, "pHYs": true, "sBIT": true, "sPLT": true, "sRGB": true, "tRNS": true,
+	"oFFs": true, "pCAL": true, "sCAL": true, "sTER": true,
+	"acTL": true, "fcTL": true, "fdAT": true,
+}
+
+// isPNGChunkType reports whether typ is a valid PNG chunk type: four ASCII letters.
+func isPNGChunkType(typ string) bool {
+	if len(typ) != 4 {
+		return false
+	}
+	for _, c := range []byte(typ) {
+		if (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+// isCriticalChunk reports whether the PNG chunk type typ is that of a critical chunk, such as
+// IHDR, PLTE, IDAT or IEND, which images cannot be decoded without. Its first letter is uppercase.
+func isCriticalChunk(typ string) bool {
+	return typ[0]&0x20 == 0
+}
+
+// WithChunkAction sets what Sanitize does with the chunks of a type of PNG images, such as tIME,
+// pHYs, gAMA, iCCP or a private chunk, including the PNG images of ICO files. Critical chunks are
+// ignored, as images cannot be decoded without them, and so are invalid chunk types. The action
+// overrides the other options for these chunks; SegmentDefault leaves them to the options, and
+// removes the ancillary chunks Sanitize does not know.
+func WithChunkAction(typ string, action SegmentAction) Option {
+	return func(o *options) {
+		if !isPNGChunkType(typ) || isCriticalChunk(typ) {
+			return
+		}
+		if o.chunks == nil {
+			o.chunks = make(map[string]SegmentAction)
+		}
+		o.chunks[typ] = action
+	}
+}
+
+// ParseChunkPolicy returns the options applying a policy written as a comma separated list of PNG
+// chunk types and actions, such as "tIME=keep, pHYs=remove, iDOT=reject". Chunk types are case
+// sensitive, as their case carries their properties, and actions are default, keep, remove or
+// reject, as ParseSegmentAction accepts.
+func ParseChunkPolicy(policy string) ([]Option, error) {
+	var opts []Option
+	for _, rule := range strings.Split(policy, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		typ, actionName, found := strings.Cut(rule, "=")
+		if !found {
+			return nil, fmt.Errorf("expected chunk=action, got %q", rule)
+		}
+		typ = strings.TrimSpace(typ)
+		if !isPNGChunkType(typ) {
+			return nil, fmt.Errorf("invalid chunk type %q, expected four letters", typ)
+		}
+		if isCriticalChunk(typ) {
+			return nil, fmt.Errorf("the %s chunk is critical and cannot be set an action", typ)
+		}
+		action, ok := ParseSegmentAction(strings.ToLower(strings.TrimSpace(actionName)))
+		if !ok {
+			return nil, fmt.Errorf("unknown action %q for %s, expected default, keep, remove or reject", strings.TrimSpace(actionName), typ)
+		}
+		opts = append(opts, WithChunkAction(typ, action))
+	}
+	return opts, nil
+}
+
+// chunkAction returns the action set for the PNG chunks of type typ.
+func (o *options) chunkAction(typ string) SegmentAction {
+	return o.chunks[typ]
+}
+
+// ChunkRejectedError is the error of Sanitize for a PNG image carrying a chunk whose type is set
+// to SegmentReject.
+type ChunkRejectedError struct {
+	// Type is the type of the chunk, and Offset where it starts in the image.
+	Type   string
+	Offset int
+}
+
+func (e *ChunkRejectedError) Error() string {
+	return fmt.Sprintf("the PNG %s chunk at offset %d is not allowed", e.Type, e.Offset)
+}
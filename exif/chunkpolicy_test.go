@@ -0,0 +1,146 @@
+package exif
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"testing"
+)
+
+func TestSanitizeChunkPolicy(t *testing.T) {
+	tiff := exifSegmentOf([]testTag{asciiTag(tagMake, "Pixel")}, nil, nil)[4+len(exifIdent):]
+	exifChunk := pngChunk("eXIf", tiff)
+	timeChunk := pngChunk("tIME", []byte{0x07, 0xE8, 3, 2, 13, 45, 30})
+	physChunk := pngChunk("pHYs", []byte{0, 0, 0x0B, 0x13, 0, 0, 0x0B, 0x13, 1})
+	gamaChunk := pngChunk("gAMA", []byte{0, 0, 0xB1, 0x8F})
+	iccpChunk := pngChunk("iCCP", append([]byte("Display P3\x00\x00"), compressed([]byte("profile"))...))
+	privateChunk := pngChunk("prVt", []byte("Editor 3.1, user jane"))
+	input := stillPNG(t, exifChunk, timeChunk, physChunk, gamaChunk, iccpChunk, privateChunk)
+
+	testTable := []struct {
+		Name     string
+		Policy   string
+		Output   []byte
+		Exif     bool
+		ICC      bool
+		Metadata bool
+	}{
+		{
+			Name:     "default",
+			Output:   stillPNG(t, physChunk, gamaChunk, iccpChunk),
+			Exif:     true,
+			Metadata: true,
+		},
+		{
+			Name:   "keep time and private chunks",
+			Policy: "tIME=keep, prVt=keep",
+			Output: stillPNG(t, timeChunk, physChunk, gamaChunk, iccpChunk, privateChunk),
+			Exif:   true,
+		},
+		{
+			Name:   "keep everything",
+			Policy: "eXIf=keep,tIME=keep,prVt=keep",
+			Output: input,
+		},
+		{
+			Name:     "remove display chunks",
+			Policy:   "pHYs=remove, gAMA=remove, iCCP=remove",
+			Output:   stillPNG(t),
+			Exif:     true,
+			ICC:      true,
+			Metadata: true,
+		},
+		{
+			Name:     "defaults",
+			Policy:   "tIME=default, prVt=default",
+			Output:   stillPNG(t, physChunk, gamaChunk, iccpChunk),
+			Exif:     true,
+			Metadata: true,
+		},
+	}
+
+	for _, test := range testTable {
+		opts, err := ParseChunkPolicy(test.Policy)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		output := new(bytes.Buffer)
+		report, err := Sanitize(bytes.NewReader(input), output, opts...)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if !bytes.Equal(test.Output, output.Bytes()) {
+			t.Errorf("%s: expected chunks %v, got %v", test.Name, pngChunksOf(test.Output), pngChunksOf(output.Bytes()))
+		}
+		if report.ExifRemoved != test.Exif || report.ICCRemoved != test.ICC || report.MetadataRemoved != test.Metadata {
+			t.Errorf("%s: unexpected report: %+v", test.Name, report)
+		}
+		if report.BytesRemoved != len(input)-output.Len() {
+			t.Errorf("%s: expected %d bytes removed, got %d", test.Name, len(input)-output.Len(), report.BytesRemoved)
+		}
+	}
+}
+
+func TestSanitizeChunkPolicyCriticalChunks(t *testing.T) {
+	input := stillPNG(t, pngChunk("gAMA", []byte{0, 0, 0xB1, 0x8F}))
+
+	// Actions set for critical chunks are ignored: the images round-trip with their pixels.
+	var opts []Option
+	for _, typ := range []string{"IHDR", "PLTE", "IDAT", "IEND"} {
+		opts = append(opts, WithChunkAction(typ, SegmentRemove), WithChunkAction(typ, SegmentReject))
+	}
+	output := new(bytes.Buffer)
+	if _, err := Sanitize(bytes.NewReader(input), output, opts...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(input, output.Bytes()) {
+		t.Errorf("expected chunks %v, got %v", pngChunksOf(input), pngChunksOf(output.Bytes()))
+	}
+	expected, _ := png.Decode(bytes.NewReader(input))
+	decoded, err := png.Decode(bytes.NewReader(output.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to decode the output: %v", err)
+	}
+	if expected.Bounds() != decoded.Bounds() || expected.At(1, 1) != decoded.At(1, 1) {
+		t.Errorf("expected the pixels to be kept")
+	}
+}
+
+func TestSanitizeChunkRejected(t *testing.T) {
+	input := stillPNG(t, pngChunk("tIME", []byte{0x07, 0xE8, 3, 2, 13, 45, 30}))
+	_, err := Sanitize(bytes.NewReader(input), new(bytes.Buffer), WithChunkAction("tIME", SegmentReject))
+	var rejected *ChunkRejectedError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("expected the image to be rejected, got %v", err)
+	}
+	if rejected.Type != "tIME" || rejected.Offset != 33 {
+		t.Errorf("unexpected error: %+v", rejected)
+	}
+	if err.Error() != "the PNG tIME chunk at offset 33 is not allowed" {
+		t.Errorf("unexpected message: %v", err)
+	}
+}
+
+func TestParseChunkPolicy(t *testing.T) {
+	testTable := []struct {
+		Policy string
+		Error  bool
+	}{
+		{Policy: ""},
+		{Policy: "tIME=keep,pHYs=REMOVE, iDOT = reject,"},
+		{Policy: "tIME", Error: true},
+		{Policy: "tIM=keep", Error: true},
+		{Policy: "t1ME=keep", Error: true},
+		{Policy: "IDAT=remove", Error: true},
+		{Policy: "tIME=drop", Error: true},
+	}
+
+	for _, test := range testTable {
+		_, err := ParseChunkPolicy(test.Policy)
+		if (err != nil) != test.Error {
+			t.Errorf("%q: unexpected error: %v", test.Policy, err)
+		}
+	}
+}
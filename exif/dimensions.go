@@ -0,0 +1,44 @@
+package exif
+
+// Orientation tag of IFD0, values 5 to 8 of which rotate the image by a quarter turn.
+const tagOrientation = 0x0112
+
+// isFrameHeader reports whether marker starts a frame header segment, SOF0 to SOF15 except the
+// DHT, JPG and DAC markers sharing their range.
+func isFrameHeader(marker byte) bool {
+	return marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC
+}
+
+// frameSize returns the width and height of the JPEG image raw as stored in its frame header,
+// or zeros if it has none.
+func frameSize(raw []byte, segments []segment) (int, int) {
+	for _, s := range segments {
+		payload := s.payload(raw)
+		if !isFrameHeader(s.marker) || len(payload) < 5 {
+			continue
+		}
+		height := int(payload[1])<<8 | int(payload[2])
+		width := int(payload[3])<<8 | int(payload[4])
+		return width, height
+	}
+	return 0, 0
+}
+
+// orientation returns the orientation recorded in EXIF data stored as a bare TIFF structure, or
+// 1, the default orientation, if it records none or cannot be parsed.
+func orientation(data []byte) int {
+	t, err := parseTIFF(data)
+	if err != nil {
+		return 1
+	}
+	dirs, err := t.ifds()
+	if err != nil {
+		return 1
+	}
+	for _, entry := range dirs[0].entries {
+		if entry.tag == tagOrientation && entry.typ == 3 && entry.count == 1 {
+			return int(t.order.Uint16(t.data[entry.offset+8:]))
+		}
+	}
+	return 1
+}
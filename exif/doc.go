@@ -0,0 +1,47 @@
+// Package exif removes EXIF metadata from images.
+//
+// The package is a standalone Go module with no dependencies outside the standard library, so
+// it can be used by any Go program, not only by the Mattermost plugin it was written for:
+//
+//	go get github.com/nimrodshn/mattermost-exif-plugin/exif
+//
+// Discard writes a copy of an image without its EXIF data, and Exists reports whether an image
+// carries any. DiscardSeeker does the same as Discard without reading JPEG images into memory,
+// copying them straight from an io.ReadSeeker such as a file, and DiscardBytes for images already
+// in memory, in place where possible. DiscardStream does the same as Discard for JPEG images read
+// from slow storage, writing their copy while they are still being read. Sanitize does the same as
+// Discard but accepts options, such as what to do with C2PA manifests, and returns a Report of what
+// it removed, and SanitizeBytes does the same for images already in memory, without copying them.
+// SanitizeSeeker does the same as Sanitize without reading the media data of MP4 and QuickTime
+// videos into memory, copying it straight from an io.ReadSeeker such as a file. Sanitize also
+// accepts PNG, GIF and WebP images, removing their metadata chunks and blocks while keeping the
+// frames and timing of animations, HEIF and AVIF images, removing the EXIF data and XMP packets of
+// every frame of bursts and sequences, JPEG 2000 images, removing their XML boxes and the uuid
+// boxes holding EXIF data and XMP packets, TIFF images, rewriting every page of scans and faxes
+// without its metadata tags, SVG images, removing their metadata elements, comments and editor
+// data, and PDF documents, removing their document information and XMP metadata. BMP, ICO, PPM and
+// PGM images cannot carry metadata, except for the PNG images of ICO files and the comments of PPM
+// and PGM headers, and are returned unchanged; MetadataFree tells them apart, and NoMetadata tells
+// JPEG and PNG images carrying no metadata, such as plain screenshots, from their headers. Detect
+// names the formats Sanitize supports whatever the name of a file, and FindEmbedded finds JPEG and
+// PNG images and EXIF data inside files of any format, such as documents. Walk visits the tags of the EXIF
+// data of an image one at a time, for quick checks such as whether it records a location, and
+// TagName and FormatTag render them as photographers expect, such as "1/250s" or "f/2.8". GPS
+// returns the location an image records in decimal degrees, and WithGPSRemoval makes Sanitize
+// remove it while keeping the rest of the EXIF data. WithSegmentAction overrides what
+// Sanitize does with the APPn and COM segments of JPEG images, keeping, removing or rejecting them
+// whatever they hold, and ParseSegmentPolicy reads such overrides from a setting such as
+// "APP2=keep,APP13=remove". WithChunkAction and ParseChunkPolicy do the same for the ancillary
+// chunks of PNG images, which Sanitize otherwise removes when it does not know them. ComparePixels
+// decodes a JPEG, PNG or GIF image and its sanitized copy to verify that their pixels are
+// identical. The exported API follows semantic versioning: within a major version, existing
+// functions keep their signatures and behavior, and new functionality is only added.
+//
+// The exifhttp subpackage wraps an http.Handler so that JPEG uploads it receives and JPEG
+// responses it serves are stripped of EXIF data, and the jpegseg subpackage reads and writes the
+// marker segments of JPEG files, on which the handling of JPEG images builds. The bmff subpackage
+// reads and writes the boxes of ISO base media files and locates the items of HEIF and AVIF
+// images, on which the handling of videos, HEIF, AVIF and JPEG 2000 images builds. The geocode
+// subpackage names the places the locations returned by GPS are at, and the exifmobile subpackage
+// wraps Sanitize in an API gomobile can bind for mobile apps.
+package exif
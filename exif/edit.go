@@ -0,0 +1,45 @@
+package exif
+
+// exifEdit modifies the EXIF data in place and returns the number of tags it removed or changed.
+type exifEdit func(t *tiffData, dirs []*ifd) int
+
+// editTIFF returns a copy of the EXIF data, a bare TIFF structure as stored in APP1 segments
+// after their identifier and in PNG and WebP files, with the edits applied. The edited data has
+// the same size and layout as the original.
+func editTIFF(data []byte, edits []exifEdit) ([]byte, int, error) {
+	edited := append([]byte{}, data...)
+	t, err := parseTIFF(edited)
+	if err != nil {
+		return nil, 0, err
+	}
+	dirs, err := t.ifds()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	changed := 0
+	for _, edit := range edits {
+		changed += edit(t, dirs)
+	}
+	return edited, changed, nil
+}
+
+// removeTags returns an edit removing the given tags of the given IFD.
+func removeTags(kind ifdKind, tags ...uint16) exifEdit {
+	set := make(map[uint16]bool)
+	for _, tag := range tags {
+		set[tag] = true
+	}
+	return func(t *tiffData, dirs []*ifd) int {
+		removed := 0
+		for _, dir := range dirs {
+			if dir.kind != kind {
+				continue
+			}
+			removed += t.removeEntries(dir, func(entry ifdEntry) bool {
+				return set[entry.tag]
+			})
+		}
+		return removed
+	}
+}
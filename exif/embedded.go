@@ -0,0 +1,171 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// maxEmbedded bounds the number of images FindEmbedded reports.
+const maxEmbedded = 1000
+
+// Embedded describes an image found inside another file by FindEmbedded.
+type Embedded struct {
+	// Offset is where the image starts in the file.
+	Offset int
+
+	// Format is the format of the image: jpeg, png or tiff. EXIF data is stored as TIFF, so
+	// bare EXIF data is reported as tiff.
+	Format string
+
+	// Metadata is true if the image carries EXIF data, or text chunks for PNG images.
+	Metadata bool
+
+	// Summary describes the camera and capture recorded in the EXIF data, if it could be read.
+	Summary *Summary
+}
+
+// Detect returns the format of data if it is a file Sanitize supports: jpeg, png, gif, webp, heic,
+// avif, heif, jp2, jpx, tiff, bmp, ico, ppm, pgm or svg for images, mp4 or mov for videos, and pdf
+// for documents. It returns an empty string otherwise.
+func Detect(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{markerPrefix, soiMarker, markerPrefix}):
+		return "jpeg"
+	case bytes.HasPrefix(data, pngSignature):
+		return "png"
+	case isGIF(data):
+		return "gif"
+	case isWebP(data):
+		return "webp"
+	case isMP4(data):
+		if format := heifFormat(data); format != "" {
+			return format
+		}
+		if string(data[8:12]) == "qt  " {
+			return "mov"
+		}
+		return "mp4"
+	case isJP2(data):
+		return jp2Format(data)
+	case isTIFF(data):
+		return "tiff"
+	case isBMP(data):
+		return "bmp"
+	case isICO(data):
+		return "ico"
+	case isNetpbm(data):
+		h, _ := readNetpbm(data)
+		return h.format
+	case isPDF(data):
+		return "pdf"
+	case isSVG(data):
+		return "svg"
+	}
+	return ""
+}
+
+// FindEmbedded returns the JPEG and PNG images and the TIFF structures, such as EXIF data, found
+// anywhere in data, whatever its format: images inside documents and archives, or misnamed
+// files. Only structures that parse are reported, so that random bytes looking like a signature
+// are not. Images inside compressed streams cannot be found.
+func FindEmbedded(data []byte) []Embedded {
+	var found []Embedded
+	for offset := 0; offset+8 <= len(data) && len(found) < maxEmbedded; offset++ {
+		rest := data[offset:]
+		switch rest[0] {
+		case markerPrefix:
+			if embedded, end, ok := embeddedJPEG(rest); ok {
+				embedded.Offset = offset
+				found = append(found, embedded)
+				offset += end - 1
+			}
+		case pngSignature[0]:
+			if embedded, end, ok := embeddedPNG(rest); ok {
+				embedded.Offset = offset
+				found = append(found, embedded)
+				offset += end - 1
+			}
+		case 'I', 'M':
+			if summary, ok := embeddedTIFF(rest); ok {
+				found = append(found, Embedded{Offset: offset, Format: "tiff", Metadata: true, Summary: summary})
+				offset += 7
+			}
+		}
+	}
+	return found
+}
+
+// embeddedJPEG reads the JPEG image at the start of data, and returns where its headers end.
+func embeddedJPEG(data []byte) (Embedded, int, bool) {
+	if data[1] != soiMarker || data[2] != markerPrefix {
+		return Embedded{}, 0, false
+	}
+	segments, err := readSegments(data)
+	if err != nil || len(segments) == 0 {
+		return Embedded{}, 0, false
+	}
+
+	embedded := Embedded{Format: "jpeg"}
+	for _, s := range segments {
+		if s.marker != appMarker || !bytes.HasPrefix(s.payload(data), exifIdent) {
+			continue
+		}
+		embedded.Metadata = true
+		if embedded.Summary == nil {
+			embedded.Summary = summarizeTIFF(data[s.start+4+len(exifIdent) : s.end])
+		}
+	}
+	return embedded, segments[len(segments)-1].end, true
+}
+
+// embeddedPNG reads the PNG image at the start of data, and returns where it ends.
+func embeddedPNG(data []byte) (Embedded, int, bool) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return Embedded{}, 0, false
+	}
+
+	embedded := Embedded{Format: "png"}
+	for offset := len(pngSignature); offset+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		typ := string(data[offset+4 : offset+8])
+		end := offset + 12 + length
+		if length < 0 || end > len(data) {
+			return Embedded{}, 0, false
+		}
+		switch {
+		case typ == "eXIf":
+			embedded.Metadata = true
+			if embedded.Summary == nil {
+				embedded.Summary = summarizeTIFF(data[offset+8 : end-4])
+			}
+		case pngTextChunks[typ]:
+			embedded.Metadata = true
+		case typ == "IEND":
+			return embedded, end, true
+		}
+		offset = end
+	}
+	return Embedded{}, 0, false
+}
+
+// embeddedTIFF returns whether data starts with a TIFF structure whose first IFD parses, and a
+// summary of its EXIF data.
+func embeddedTIFF(data []byte) (*Summary, bool) {
+	if !bytes.HasPrefix(data, []byte("II*\x00")) && !bytes.HasPrefix(data, []byte("MM\x00*")) {
+		return nil, false
+	}
+	t, err := parseTIFF(data)
+	if err != nil {
+		return nil, false
+	}
+	dirs, err := t.ifds()
+	if err != nil || len(dirs[0].entries) == 0 {
+		return nil, false
+	}
+	for _, entry := range dirs[0].entries {
+		if _, ok := typeSizes[entry.typ]; !ok {
+			return nil, false
+		}
+	}
+	return summarizeTIFF(data), true
+}
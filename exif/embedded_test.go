@@ -0,0 +1,78 @@
+package exif
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	testTable := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"JPEG", jpegOf(exifSegment), "jpeg"},
+		{"PNG", stillPNG(t), "png"},
+		{"WebP", []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), "webp"},
+		{"MP4", []byte("\x00\x00\x00\x18ftypisom\x00\x00\x00\x00"), "mp4"},
+		{"QuickTime", []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00"), "mov"},
+		{"PDF", []byte("%PDF-1.7\n"), "pdf"},
+		{"SVG", []byte("<?xml version=\"1.0\"?>\n<!-- logo -->\n<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), "svg"},
+		{"HTML", []byte("<!DOCTYPE html>\n<html><svg/></html>"), ""},
+		{"ZIP", []byte("PK\x03\x04"), ""},
+		{"Empty", nil, ""},
+	}
+	for _, test := range testTable {
+		t.Run(test.name, func(t *testing.T) {
+			if format := Detect(test.data); format != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, format)
+			}
+		})
+	}
+}
+
+func TestFindEmbedded(t *testing.T) {
+	image := jpegOf(exifSegment)
+	textPNG := stillPNG(t, pngChunk("tEXt", []byte("Author\x00Jane")))
+	tiff := exifSegmentOf([]testTag{asciiTag(tagMake, "Pixel")}, nil, nil)[4+len(exifIdent):]
+
+	var data []byte
+	data = append(data, "%PDF-1.7\nstream\n"...)
+	jpegOffset := len(data)
+	data = append(data, image...)
+	data = append(data, "\nendstream\nII*\x00 not a TIFF structure\n"...)
+	pngOffset := len(data)
+	data = append(data, textPNG...)
+	data = append(data, "\nMM"...)
+	tiffOffset := len(data)
+	data = append(data, tiff...)
+	data = append(data, stillPNG(t)...)
+
+	found := FindEmbedded(data)
+	if len(found) != 4 {
+		t.Fatalf("expected 4 embedded images, got %+v", found)
+	}
+	if found[0].Offset != jpegOffset || found[0].Format != "jpeg" || !found[0].Metadata || found[0].Summary == nil || found[0].Summary.Make != "ACM" {
+		t.Errorf("unexpected JPEG image: %+v", found[0])
+	}
+	if found[1].Offset != pngOffset || found[1].Format != "png" || !found[1].Metadata {
+		t.Errorf("unexpected PNG image: %+v", found[1])
+	}
+	if found[2].Offset != tiffOffset || found[2].Format != "tiff" || !found[2].Metadata || found[2].Summary == nil || found[2].Summary.Make != "Pixel" {
+		t.Errorf("unexpected EXIF data: %+v", found[2])
+	}
+	if found[3].Format != "png" || found[3].Metadata {
+		t.Errorf("expected a PNG image without metadata, got %+v", found[3])
+	}
+}
+
+func TestFindEmbeddedIgnoresTruncatedImages(t *testing.T) {
+	textPNG := stillPNG(t, pngChunk("tEXt", []byte("Author\x00Jane")))
+	data := append([]byte("junk"), textPNG[:len(textPNG)-20]...)
+	if found := FindEmbedded(data); len(found) != 0 {
+		t.Errorf("expected no embedded image, got %+v", found)
+	}
+	if found := FindEmbedded(bytes.Repeat([]byte{0xFF}, 64)); len(found) != 0 {
+		t.Errorf("expected no embedded image, got %+v", found)
+	}
+}
@@ -0,0 +1,534 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// exifSegment is an APP1 segment holding an EXIF IFD with a single Make tag.
+var exifSegment = []byte{
+	0xFF, 0xE1, // Markers
+	0x00, 0x22, // Length of the segment, including the length field.
+	'E', 'x', 'i', 'f', 0x00, 0x00, // EXIF identifier.
+	0x4d, 0x4d, // "MM" - Big Endian.
+	0x00, 0x2A, // Fixed 2-bytes.
+	0x00, 0x00, 0x00, 0x08, // Offset eight to first IFD.
+	0x00, 0x01, // One tag.
+	0x01, 0x0F, // Make.
+	0x00, 0x02, // ASCII.
+	0x00, 0x00, 0x00, 0x04, // Four characters.
+	'A', 'C', 'M', 0x00, // The value fits in the offset field.
+	0x00, 0x00, 0x00, 0x00, // No next IFD.
+}
+
+// xmpSegment is an APP1 segment holding XMP data rather than EXIF.
+var xmpSegment = append([]byte{0xFF, 0xE1, 0x00, 0x0C}, []byte("http://ns\x00")...)
+
+// c2paManifest is a minimal C2PA manifest store: a JUMBF superbox holding its description box.
+var c2paManifest = append(append([]byte{
+	0x00, 0x00, 0x00, 0x2E, 'j', 'u', 'm', 'b', // Superbox.
+	0x00, 0x00, 0x00, 0x1E, 'j', 'u', 'm', 'd', // Description box.
+	'c', '2', 'p', 'a', 0x00, 0x11, 0x00, 0x10, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71, // Type.
+	0x03, // Toggles: label present.
+}, []byte("c2pa\x00")...), make([]byte, 8)...)
+
+// app11Segment returns an APP11 segment carrying the given packet of a JUMBF box.
+func app11Segment(instance uint16, sequence uint32, data []byte) []byte {
+	segment := []byte{0xFF, 0xEB, 0x00, 0x00, 'J', 'P'}
+	segment = binary.BigEndian.AppendUint16(segment, instance)
+	segment = binary.BigEndian.AppendUint32(segment, sequence)
+	segment = append(segment, data...)
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(segment)-2))
+	return segment
+}
+
+// scanData is the start of scan and end of image markers closing every test image.
+var scanData = []byte{0xFF, 0xDA, 0x00, 0x02, 0x00, 0x00, 0xFF, 0xD9}
+
+func jpegOf(segments ...[]byte) []byte {
+	raw := []byte{0xFF, 0xD8}
+	for _, segment := range segments {
+		raw = append(raw, segment...)
+	}
+	return append(raw, scanData...)
+}
+
+func TestDiscard(t *testing.T) {
+	testTable := []struct {
+		Name   string
+		Input  []byte
+		Output []byte
+	}{
+		{
+			Name:   "exif only",
+			Input:  jpegOf(exifSegment),
+			Output: jpegOf(),
+		},
+		{
+			Name:   "xmp before exif",
+			Input:  jpegOf(xmpSegment, exifSegment),
+			Output: jpegOf(xmpSegment),
+		},
+	}
+
+	for _, test := range testTable {
+		output := new(bytes.Buffer)
+		if err := Discard(bytes.NewReader(test.Input), output); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if !bytes.Equal(test.Output, output.Bytes()) {
+			t.Errorf("%s: expected result to be: %x instead got: %x", test.Name, test.Output, output.Bytes())
+		}
+		// Nothing of the EXIF segment is left behind, neither its header nor its values.
+		if bytes.Contains(output.Bytes(), exifIdent) || bytes.Contains(output.Bytes(), exifSegment[4+len(exifIdent):]) {
+			t.Errorf("%s: expected the whole EXIF segment to be removed, got %x", test.Name, output.Bytes())
+		}
+	}
+}
+
+func TestDiscardBytes(t *testing.T) {
+	testTable := []struct {
+		Name    string
+		Input   []byte
+		InPlace bool
+	}{
+		{Name: "exif only", Input: jpegOf(exifSegment), InPlace: true},
+		{Name: "xmp around exif", Input: jpegOf(xmpSegment, exifSegment, xmpSegment), InPlace: true},
+		{Name: "png", Input: stillPNG(t, pngChunk("eXIf", exifSegment[4+len(exifIdent):]))},
+	}
+
+	for _, test := range testTable {
+		expected := new(bytes.Buffer)
+		if err := Discard(bytes.NewReader(test.Input), expected); err != nil {
+			t.Fatalf("%s: unexpected error from Discard: %v", test.Name, err)
+		}
+		input := append([]byte{}, test.Input...)
+		output, report, err := DiscardBytes(input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if !bytes.Equal(expected.Bytes(), output) || !report.ExifRemoved {
+			t.Errorf("%s: expected %x, got %x and report %+v", test.Name, expected.Bytes(), output, report)
+		}
+		if test.InPlace && &output[0] != &input[0] {
+			t.Errorf("%s: expected the image to be sanitized in place", test.Name)
+		}
+	}
+
+	if _, _, err := DiscardBytes(jpegOf(xmpSegment)); !errors.Is(err, ErrNoExif) {
+		t.Errorf("expected ErrNoExif for an image without EXIF data, got %v", err)
+	}
+}
+
+func TestSanitizeBytes(t *testing.T) {
+	inputs := fuzzSeeds(t)["FuzzDiscard"]
+	inputs = append(inputs, heifBurst(exifSegment[4:], []byte("<x:xmpmeta/>")), pdfOf("<< /Type /Catalog >>", "<< /Author (Jane) >>"))
+	for i, input := range inputs {
+		expected := new(bytes.Buffer)
+		expectedReport, err := Sanitize(bytes.NewReader(input), expected, WithTimestampPolicy(TimestampsRoundToDay))
+		if err != nil {
+			t.Fatalf("%d: unexpected error from Sanitize: %v", i, err)
+		}
+		raw := append([]byte{}, input...)
+		output := new(bytes.Buffer)
+		report, err := SanitizeBytes(raw, output, WithTimestampPolicy(TimestampsRoundToDay))
+		if err != nil {
+			t.Errorf("%d: unexpected error: %v", i, err)
+			continue
+		}
+		if !bytes.Equal(expected.Bytes(), output.Bytes()) || report.BytesRemoved != expectedReport.BytesRemoved {
+			t.Errorf("%d: expected the output of Sanitize %q, got %q", i, expected.Bytes(), output.Bytes())
+		}
+		if !bytes.Equal(input, raw) {
+			t.Errorf("%d: expected the image to be left unchanged", i)
+		}
+	}
+}
+
+func TestSanitizeBytesDoesNotCopy(t *testing.T) {
+	// A large image, in memory, whose EXIF segment is removed and trailer kept.
+	input := append(jpegOf(exifSegment), make([]byte, 4<<20)...)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := SanitizeBytes(input, io.Discard); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > uint64(len(input))/4 {
+		t.Errorf("expected the image not to be copied, %d bytes were allocated", allocated)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	testTable := []struct {
+		Name  string
+		Input []byte
+		Bytes int64
+	}{
+		{Name: "exif", Input: jpegOf(exifSegment), Bytes: int64(len(exifSegment))},
+		{Name: "exif and xmp", Input: jpegOf(xmpSegment, exifSegment), Bytes: int64(len(exifSegment))},
+		{Name: "trailing data is kept", Input: append(jpegOf(exifSegment), "MotionPhoto_Data"...), Bytes: int64(len(exifSegment))},
+		{Name: "none", Input: jpegOf(xmpSegment)},
+	}
+
+	for _, test := range testTable {
+		n, err := Estimate(bytes.NewReader(test.Input))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if n != test.Bytes {
+			t.Errorf("%s: expected %d bytes, got %d", test.Name, test.Bytes, n)
+		}
+		output := new(bytes.Buffer)
+		if _, err := Sanitize(bytes.NewReader(test.Input), output); err != nil || int64(len(test.Input)-output.Len()) != n {
+			t.Errorf("%s: expected the estimate to match what Sanitize removes", test.Name)
+		}
+	}
+
+	if _, err := Estimate(bytes.NewReader([]byte{0xFF, 0xD8, 0xFF, 0xE1})); !errors.Is(err, ErrTruncated) {
+		t.Errorf("expected an error wrapping ErrTruncated for a truncated image, got %v", err)
+	}
+	if _, err := Estimate(bytes.NewReader([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x01})); !errors.Is(err, ErrMalformed) {
+		t.Errorf("expected an error wrapping ErrMalformed for a segment shorter than its length, got %v", err)
+	}
+}
+
+func TestExists(t *testing.T) {
+	testTable := []struct {
+		Name   string
+		Input  []byte
+		Exists bool
+		Err    bool
+	}{
+		{Name: "exif", Input: jpegOf(exifSegment), Exists: true},
+		{Name: "xmp only", Input: jpegOf(xmpSegment), Exists: false},
+		{Name: "no segments", Input: jpegOf(), Exists: false},
+		{Name: "truncated", Input: jpegOf(exifSegment)[:20], Err: true},
+		// An EXIF segment cannot follow the start of scan, whatever the image data looks like.
+		{Name: "exif in the image data", Input: append(jpegOf()[:6], exifSegment...), Exists: false},
+		{Name: "not a jpeg", Input: append([]byte("\x89PNG\r\n\x1a\n"), exifSegment...), Exists: false},
+	}
+
+	for _, test := range testTable {
+		exists, err := Exists(bytes.NewReader(test.Input))
+		if (err != nil) != test.Err {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+		}
+		if exists != test.Exists {
+			t.Errorf("%s: expected Exists to return %v", test.Name, test.Exists)
+		}
+	}
+}
+
+func TestExistsStopsAtStartOfScan(t *testing.T) {
+	// Reading past the start of scan segment fails.
+	input := io.MultiReader(bytes.NewReader(jpegOf(xmpSegment)[:len(jpegOf(xmpSegment))-4]), iotest.ErrReader(errors.New("read the image data")))
+	if exists, err := Exists(input); exists || err != nil {
+		t.Errorf("expected the image data not to be read, got %v and %v", exists, err)
+	}
+}
+
+func TestSanitizeC2PA(t *testing.T) {
+	// The manifest store split over two packets, the second repeating the superbox header.
+	first := app11Segment(1, 1, c2paManifest[:30])
+	second := app11Segment(1, 2, append(append([]byte{}, c2paManifest[:8]...), c2paManifest[30:]...))
+	input := jpegOf(exifSegment, first, second)
+
+	testTable := []struct {
+		Name     string
+		Policy   C2PAPolicy
+		Output   []byte
+		Removed  bool
+		Manifest []byte
+	}{
+		{Name: "preserve", Policy: C2PAPreserve, Output: jpegOf(first, second)},
+		{Name: "strip", Policy: C2PAStrip, Output: jpegOf(), Removed: true},
+		{Name: "strip and report", Policy: C2PAStripAndReport, Output: jpegOf(), Removed: true, Manifest: c2paManifest},
+	}
+
+	for _, test := range testTable {
+		output := new(bytes.Buffer)
+		report, err := Sanitize(bytes.NewReader(input), output, WithC2PAPolicy(test.Policy))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if !bytes.Equal(test.Output, output.Bytes()) {
+			t.Errorf("%s: expected result to be: %x instead got: %x", test.Name, test.Output, output.Bytes())
+		}
+		if !report.ExifRemoved || !report.C2PAFound || report.C2PARemoved != test.Removed {
+			t.Errorf("%s: unexpected report: %+v", test.Name, report)
+		}
+		if !bytes.Equal(test.Manifest, report.C2PAManifest) {
+			t.Errorf("%s: expected manifest to be: %x instead got: %x", test.Name, test.Manifest, report.C2PAManifest)
+		}
+		if report.BytesRemoved != len(input)-output.Len() {
+			t.Errorf("%s: expected %d bytes removed, got %d", test.Name, len(input)-output.Len(), report.BytesRemoved)
+		}
+	}
+}
+
+func TestSanitizeWithoutExif(t *testing.T) {
+	input := jpegOf(xmpSegment)
+	output := new(bytes.Buffer)
+	report, err := Sanitize(bytes.NewReader(input), output)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.ExifRemoved || !bytes.Equal(input, output.Bytes()) {
+		t.Errorf("expected the image to be copied unchanged, got report %+v", report)
+	}
+}
+
+func TestSanitizeLogger(t *testing.T) {
+	input := jpegOf(exifSegment)
+	var logs bytes.Buffer
+	if _, err := Sanitize(bytes.NewReader(input), new(bytes.Buffer), WithLogger(log.New(&logs, "", 0))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(logs.String(), "Found EXIF segment at offsets 2-") {
+		t.Errorf("expected the EXIF segment to be logged, got %q", logs.String())
+	}
+	// The decision taken for every segment is logged too.
+	for _, decision := range []string{"Removing the APP1 segment at offsets 2-", "Keeping the SOS segment at offsets "} {
+		if !strings.Contains(logs.String(), decision) {
+			t.Errorf("expected %q to be logged, got %q", decision, logs.String())
+		}
+	}
+
+	// Without a logger, nothing reaches the standard logger.
+	var standard bytes.Buffer
+	log.SetOutput(&standard)
+	defer log.SetOutput(os.Stderr)
+	if _, err := Sanitize(bytes.NewReader(input), new(bytes.Buffer)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := Discard(bytes.NewReader(input), new(bytes.Buffer)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if standard.Len() != 0 {
+		t.Errorf("expected nothing to be logged, got %q", standard.String())
+	}
+}
+
+func TestSanitizeTrailer(t *testing.T) {
+	trailer := []byte("MotionPhoto_Data")
+	input := append(jpegOf(exifSegment), trailer...)
+
+	testTable := []struct {
+		Name   string
+		Remove bool
+		Output []byte
+	}{
+		{Name: "keep", Remove: false, Output: append(jpegOf(), trailer...)},
+		{Name: "remove", Remove: true, Output: jpegOf()},
+	}
+
+	for _, test := range testTable {
+		output := new(bytes.Buffer)
+		report, err := Sanitize(bytes.NewReader(input), output, WithTrailerRemoval(test.Remove), WithTrailerDetection(true))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if !bytes.Equal(test.Output, output.Bytes()) {
+			t.Errorf("%s: expected result to be: %x instead got: %x", test.Name, test.Output, output.Bytes())
+		}
+		if report.TrailerSize != len(trailer) || report.TrailerRemoved != test.Remove {
+			t.Errorf("%s: unexpected report: %+v", test.Name, report)
+		}
+	}
+
+	// Without either option, the image data is copied as it is, without looking for its end.
+	output := new(bytes.Buffer)
+	report, err := Sanitize(bytes.NewReader(input), output)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(append(jpegOf(), trailer...), output.Bytes()) || report.TrailerSize != 0 {
+		t.Errorf("expected the image data to be copied without being searched, got %x and %+v", output.Bytes(), report)
+	}
+}
+
+func TestSanitizeMotionPhoto(t *testing.T) {
+	video := append([]byte{0x00, 0x00, 0x00, 0x10}, "ftypmp42\x00\x00\x00\x00moov"...)
+	packet := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF><rdf:Description dc:creator="Jane"` +
+		` GCamera:MotionPhoto="1" GCamera:MotionPhotoVersion="1" GCamera:MotionPhotoPresentationTimestampUs="968644">` +
+		`<Container:Directory><rdf:Seq><rdf:li><Container:Item Item:Semantic="MotionPhoto" Item:Length="24"/></rdf:li>` +
+		`</rdf:Seq></Container:Directory></rdf:Description></rdf:RDF></x:xmpmeta>`
+	clean := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF><rdf:Description dc:creator="Jane">` +
+		`</rdf:Description></rdf:RDF></x:xmpmeta>`
+
+	testTable := []struct {
+		Name   string
+		Input  []byte
+		Remove bool
+		Output []byte
+	}{
+		{
+			Name:   "google keep",
+			Input:  append(jpegOf(xmpSegmentOf([]byte(packet))), video...),
+			Output: append(jpegOf(xmpSegmentOf([]byte(packet))), video...),
+		},
+		{
+			Name:   "google remove",
+			Input:  append(jpegOf(xmpSegmentOf([]byte(packet))), video...),
+			Remove: true,
+			Output: jpegOf(xmpSegmentOf([]byte(clean))),
+		},
+		{
+			Name:   "samsung remove",
+			Input:  append(append(jpegOf(exifSegment), "MotionPhoto_Data"...), video...),
+			Remove: true,
+			Output: jpegOf(),
+		},
+	}
+
+	for _, test := range testTable {
+		output := new(bytes.Buffer)
+		report, err := Sanitize(bytes.NewReader(test.Input), output, WithTrailerRemoval(test.Remove), WithTrailerDetection(true))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if !bytes.Equal(test.Output, output.Bytes()) {
+			t.Errorf("%s: expected result to be: %q instead got: %q", test.Name, test.Output, output.Bytes())
+		}
+		if !report.MotionPhoto || !bytes.Equal(video, report.MotionPhotoVideo) {
+			t.Errorf("%s: expected the motion photo video to be found, got %+v", test.Name, report)
+		}
+	}
+
+	// Other trailing data is not mistaken for a motion photo.
+	report, err := Sanitize(bytes.NewReader(append(jpegOf(xmpSegment), "padding"...)), new(bytes.Buffer), WithTrailerDetection(true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.MotionPhoto || report.MotionPhotoVideo != nil {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func TestSanitizeJFIF(t *testing.T) {
+	testTable := []struct {
+		Name   string
+		Input  []byte
+		Output []byte
+		Added  bool
+	}{
+		{Name: "exif only", Input: jpegOf(exifSegment), Output: jpegOf(jfifSegment), Added: true},
+		{Name: "xmp remains", Input: jpegOf(xmpSegment, exifSegment), Output: jpegOf(xmpSegment)},
+		{Name: "jfif remains", Input: jpegOf(jfifSegment, exifSegment), Output: jpegOf(jfifSegment)},
+		{Name: "adobe transform", Input: jpegOf(exifSegment, adobeSegment(1)), Output: jpegOf(adobeSegment(1))},
+		{Name: "nothing removed", Input: jpegOf(), Output: jpegOf()},
+	}
+
+	for _, test := range testTable {
+		output := new(bytes.Buffer)
+		report, err := Sanitize(bytes.NewReader(test.Input), output, WithJFIFRegeneration(true))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if !bytes.Equal(test.Output, output.Bytes()) {
+			t.Errorf("%s: expected result to be: %x instead got: %x", test.Name, test.Output, output.Bytes())
+		}
+		if report.JFIFAdded != test.Added {
+			t.Errorf("%s: unexpected report: %+v", test.Name, report)
+		}
+	}
+}
+
+// cmykJPEG returns an 8x8 four component JPEG image, made of the given segments, of a uniform
+// color. Every block of the image has a zero DC coefficient and no AC coefficients.
+func cmykJPEG(segments ...[]byte) []byte {
+	raw := []byte{0xFF, 0xD8}
+	for _, segment := range segments {
+		raw = append(raw, segment...)
+	}
+
+	// A quantization table of ones.
+	raw = append(raw, 0xFF, 0xDB, 0x00, 0x43, 0x00)
+	raw = append(raw, bytes.Repeat([]byte{0x01}, 64)...)
+	raw = append(raw,
+		0xFF, 0xC0, 0x00, 0x14, // Baseline frame header.
+		0x08, 0x00, 0x08, 0x00, 0x08, // 8 bit samples, 8x8 pixels.
+		0x04, 0x01, 0x11, 0x00, 0x02, 0x11, 0x00, 0x03, 0x11, 0x00, 0x04, 0x11, 0x00, // Four components.
+	)
+	// DC and AC Huffman tables, each with a single one bit code for a zero DC difference and
+	// for the end of block.
+	raw = append(raw, 0xFF, 0xC4, 0x00, 0x26)
+	for _, class := range []byte{0x00, 0x10} {
+		raw = append(raw, class, 0x01)
+		raw = append(raw, make([]byte, 15)...)
+		raw = append(raw, 0x00)
+	}
+	raw = append(raw,
+		0xFF, 0xDA, 0x00, 0x0E, // Start of scan.
+		0x04, 0x01, 0x00, 0x02, 0x00, 0x03, 0x00, 0x04, 0x00, 0x00, 0x3F, 0x00,
+		0x00,       // Two zero bits for each block.
+		0xFF, 0xD9, // End of image.
+	)
+	return raw
+}
+
+// adobeSegment returns an Adobe APP14 segment with the given color transform.
+func adobeSegment(transform byte) []byte {
+	return append([]byte{0xFF, 0xEE, 0x00, 0x0E}, append([]byte("Adobe\x00\x64\x00\x00\x00\x00"), transform)...)
+}
+
+func TestSanitizePreservesAdobeTransform(t *testing.T) {
+	testTable := []struct {
+		Name      string
+		Transform byte
+	}{
+		{Name: "cmyk", Transform: 0},
+		{Name: "ycck", Transform: 2},
+	}
+
+	for _, test := range testTable {
+		input := cmykJPEG(exifSegment, adobeSegment(test.Transform))
+		want, err := jpeg.Decode(bytes.NewReader(input))
+		if err != nil {
+			t.Fatalf("%s: failed to decode the input: %v", test.Name, err)
+		}
+
+		output := new(bytes.Buffer)
+		_, err = Sanitize(bytes.NewReader(input), output,
+			WithC2PAPolicy(C2PAStrip),
+			WithTrailerRemoval(true),
+			WithJFIFRegeneration(true),
+		)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if !bytes.Equal(cmykJPEG(adobeSegment(test.Transform)), output.Bytes()) {
+			t.Errorf("%s: expected only the EXIF segment to be removed, got: %x", test.Name, output.Bytes())
+		}
+
+		got, err := jpeg.Decode(bytes.NewReader(output.Bytes()))
+		if err != nil {
+			t.Errorf("%s: failed to decode the output: %v", test.Name, err)
+			continue
+		}
+		if _, ok := got.(*image.CMYK); !ok {
+			t.Errorf("%s: expected a CMYK image, got %T", test.Name, got)
+		} else if !bytes.Equal(want.(*image.CMYK).Pix, got.(*image.CMYK).Pix) {
+			t.Errorf("%s: the colors of the image changed", test.Name)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Package exifhttp provides net/http middleware removing EXIF metadata from images, so the exif
+// package can be dropped into image proxies and upload services.
+package exifhttp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// MaxBodySize bounds the size of the image bodies the middleware buffers in order to sanitize them.
+const MaxBodySize = 64 << 20
+
+// errTooLarge is returned to handlers writing JPEG responses larger than MaxBodySize.
+var errTooLarge = errors.New("exifhttp: response body exceeds MaxBodySize")
+
+// Sanitizer returns a handler removing EXIF metadata from JPEG request bodies before they reach
+// next, and from JPEG responses written by next before they reach the client. Other bodies pass
+// through untouched.
+//
+// Requests whose images cannot be parsed are rejected with 400 Bad Request, and responses whose
+// images cannot be parsed are replaced with 500 Internal Server Error, so that metadata never
+// slips through.
+func Sanitizer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil && isJPEG(r.Header.Get("Content-Type")) {
+			raw, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxBodySize+1))
+			r.Body.Close()
+			if err != nil {
+				http.Error(w, "failed to read request body", http.StatusBadRequest)
+				return
+			}
+			if len(raw) > MaxBodySize {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			clean, err := sanitize(raw)
+			if err != nil {
+				http.Error(w, "failed to remove image metadata: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(clean))
+			r.ContentLength = int64(len(clean))
+			r.Header.Set("Content-Length", strconv.Itoa(len(clean)))
+		}
+
+		sw := &sanitizingWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		sw.finish()
+	})
+}
+
+// sanitize returns raw without its EXIF data. Images without EXIF data are returned as is.
+func sanitize(raw []byte) ([]byte, error) {
+	found, err := exif.Exists(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return raw, nil
+	}
+
+	output := new(bytes.Buffer)
+	if err := exif.Discard(bytes.NewReader(raw), output); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+func isJPEG(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return mediaType == "image/jpeg" || mediaType == "image/jpg" || mediaType == "image/pjpeg"
+}
+
+// sanitizingWriter buffers JPEG responses so their metadata can be removed once the handler is
+// done. Other responses are streamed to the underlying writer as they are written.
+type sanitizingWriter struct {
+	http.ResponseWriter
+
+	status      int
+	wroteHeader bool
+	buffering   bool
+	buff        bytes.Buffer
+	tooLarge    bool
+}
+
+func (w *sanitizingWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+
+	w.buffering = isJPEG(w.Header().Get("Content-Type"))
+	if !w.buffering {
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *sanitizingWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.buffering {
+		return w.ResponseWriter.Write(p)
+	}
+
+	if w.buff.Len()+len(p) > MaxBodySize {
+		w.tooLarge = true
+		return 0, errTooLarge
+	}
+	return w.buff.Write(p)
+}
+
+// finish sanitizes and writes out a buffered response.
+func (w *sanitizingWriter) finish() {
+	if !w.buffering {
+		return
+	}
+
+	w.Header().Del("Content-Length")
+	if w.buff.Len() == 0 && !w.tooLarge {
+		// Nothing to sanitize, e.g. in responses to HEAD requests.
+		w.ResponseWriter.WriteHeader(w.status)
+		return
+	}
+	if w.tooLarge {
+		http.Error(w.ResponseWriter, "response body too large", http.StatusInternalServerError)
+		return
+	}
+
+	clean, err := sanitize(w.buff.Bytes())
+	if err != nil {
+		http.Error(w.ResponseWriter, "failed to remove image metadata", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(clean)))
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(clean)
+}
@@ -0,0 +1,94 @@
+package exifhttp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var (
+	// withExif is a minimal JPEG carrying an EXIF segment with a single Make tag.
+	withExif = []byte{
+		0xFF, 0xD8, // Start of image.
+		0xFF, 0xE1, 0x00, 0x22, // APP1 marker and length.
+		'E', 'x', 'i', 'f', 0x00, 0x00,
+		0x4d, 0x4d, 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08,
+		0x00, 0x01,
+		0x01, 0x0F, 0x00, 0x02, 0x00, 0x00, 0x00, 0x04, 'A', 'C', 'M', 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0xFF, 0xDA, 0x00, 0x02, 0x00, 0x00, // Start of scan.
+		0xFF, 0xD9, // End of image.
+	}
+
+	// withoutExif is withExif without its EXIF segment.
+	withoutExif = []byte{
+		0xFF, 0xD8,
+		0xFF, 0xDA, 0x00, 0x02, 0x00, 0x00,
+		0xFF, 0xD9,
+	}
+)
+
+func TestSanitizerRequest(t *testing.T) {
+	var received []byte
+	handler := Sanitizer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+	}))
+
+	r := httptest.NewRequest("POST", "/", bytes.NewReader(withExif))
+	r.Header.Set("Content-Type", "image/jpeg")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if !bytes.Equal(received, withoutExif) {
+		t.Errorf("Expected the handler to receive: %x instead got: %x", withoutExif, received)
+	}
+}
+
+func TestSanitizerResponse(t *testing.T) {
+	testTable := []struct {
+		Name        string
+		ContentType string
+		Body        []byte
+		Expected    []byte
+	}{
+		{Name: "jpeg", ContentType: "image/jpeg", Body: withExif, Expected: withoutExif},
+		{Name: "sniffed jpeg", Body: withExif, Expected: withoutExif},
+		{Name: "clean jpeg", ContentType: "image/jpeg", Body: withoutExif, Expected: withoutExif},
+		{Name: "other", ContentType: "application/octet-stream", Body: withExif, Expected: withExif},
+	}
+
+	for _, test := range testTable {
+		handler := Sanitizer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if test.ContentType != "" {
+				w.Header().Set("Content-Type", test.ContentType)
+			}
+			w.Write(test.Body)
+		}))
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200 instead got: %d", test.Name, w.Code)
+		}
+		if !bytes.Equal(w.Body.Bytes(), test.Expected) {
+			t.Errorf("%s: expected body to be: %x instead got: %x", test.Name, test.Expected, w.Body.Bytes())
+		}
+	}
+}
+
+func TestSanitizerRejectsCorruptUploads(t *testing.T) {
+	handler := Sanitizer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected the handler not to be called")
+	}))
+
+	r := httptest.NewRequest("POST", "/", bytes.NewReader(withExif[:20]))
+	r.Header.Set("Content-Type", "image/jpeg")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 instead got: %d", w.Code)
+	}
+}
@@ -0,0 +1,60 @@
+// Package exifmobile wraps the exif package in an API gomobile can bind, taking and returning
+// byte arrays rather than readers, writers and options, so that mobile apps can remove the
+// metadata of images on the device before uploading them:
+//
+//	gomobile bind -target android ./exifmobile
+//
+// Each function removes metadata as the plugin does with its default settings.
+package exifmobile
+
+import (
+	"bytes"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// Result is a sanitized image along with what was removed from it.
+type Result struct {
+	// Data is the sanitized image.
+	Data []byte
+
+	// Format is the format of the image, as returned by Detect.
+	Format string
+
+	// MetadataRemoved is true if the image was changed to remove its metadata, and BytesRemoved
+	// is the total size of the removed segments and trailing data.
+	MetadataRemoved bool
+	BytesRemoved    int
+}
+
+// Sanitize returns a copy of the image data without its metadata. Images without metadata are
+// returned unchanged. data is left unchanged.
+func Sanitize(data []byte) ([]byte, error) {
+	result, err := SanitizeWithResult(data)
+	if err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
+
+// SanitizeWithResult does the same as Sanitize, and also reports what was removed, so that apps
+// can tell users.
+func SanitizeWithResult(data []byte) (*Result, error) {
+	output := new(bytes.Buffer)
+	report, err := exif.SanitizeBytes(data, output)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		Data:            output.Bytes(),
+		Format:          report.Format,
+		MetadataRemoved: !bytes.Equal(output.Bytes(), data),
+		BytesRemoved:    report.BytesRemoved,
+	}, nil
+}
+
+// Detect returns the format of data, such as "jpeg" or "heic", if Sanitize supports it, or an
+// empty string otherwise, so that apps can leave other files alone.
+func Detect(data []byte) string {
+	return exif.Detect(data)
+}
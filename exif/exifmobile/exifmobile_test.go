@@ -0,0 +1,76 @@
+package exifmobile
+
+import (
+	"bytes"
+	"testing"
+)
+
+var (
+	// withExif is a minimal JPEG carrying an EXIF segment with a single Make tag.
+	withExif = []byte{
+		0xFF, 0xD8, // Start of image.
+		0xFF, 0xE1, 0x00, 0x22, // APP1 marker and length.
+		'E', 'x', 'i', 'f', 0x00, 0x00,
+		0x4d, 0x4d, 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08,
+		0x00, 0x01, // One tag.
+		0x01, 0x0F, 0x00, 0x02, 0x00, 0x00, 0x00, 0x04, 'A', 'C', 'M', 0x00, // Make.
+		0x00, 0x00, 0x00, 0x00, // No next IFD.
+		0xFF, 0xDA, 0x00, 0x02, 0x00, 0x00, // Start of scan.
+		0xFF, 0xD9, // End of image.
+	}
+
+	// withoutExif is withExif without its EXIF segment.
+	withoutExif = []byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02, 0x00, 0x00, 0xFF, 0xD9}
+)
+
+func TestSanitizeWithResult(t *testing.T) {
+	testTable := []struct {
+		Name    string
+		Input   []byte
+		Output  []byte
+		Removed bool
+		Error   bool
+	}{
+		{Name: "with exif", Input: withExif, Output: withoutExif, Removed: true},
+		{Name: "without exif", Input: withoutExif, Output: withoutExif},
+		{Name: "not an image", Input: []byte("hello"), Error: true},
+	}
+
+	for _, test := range testTable {
+		input := append([]byte{}, test.Input...)
+		result, err := SanitizeWithResult(input)
+		if test.Error {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if !bytes.Equal(result.Data, test.Output) {
+			t.Errorf("%s: expected %x, got %x", test.Name, test.Output, result.Data)
+		}
+		if result.Format != "jpeg" || result.MetadataRemoved != test.Removed {
+			t.Errorf("%s: unexpected result %+v", test.Name, result)
+		}
+		if !bytes.Equal(input, test.Input) {
+			t.Errorf("%s: expected the input to be left unchanged", test.Name)
+		}
+
+		data, err := Sanitize(test.Input)
+		if err != nil || !bytes.Equal(data, test.Output) {
+			t.Errorf("%s: expected Sanitize to return %x, got %x, %v", test.Name, test.Output, data, err)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	if format := Detect(withExif); format != "jpeg" {
+		t.Errorf("Expected jpeg, got %q", format)
+	}
+	if format := Detect([]byte("hello")); format != "" {
+		t.Errorf("Expected no format, got %q", format)
+	}
+}
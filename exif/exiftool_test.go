@@ -0,0 +1,130 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// exiftoolXMP is an XMP packet giving the format of an image.
+const exiftoolXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+	`<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" dc:format="image/jpeg"/></rdf:RDF></x:xmpmeta>`
+
+// iptcRecord returns an IPTC record holding the caption of an image, as stored by Photoshop.
+func iptcRecord() []byte {
+	caption := []byte("Secret")
+	return append(append([]byte{0x1C, 0x02, 0x78}, binary.BigEndian.AppendUint16(nil, uint16(len(caption)))...), caption...)
+}
+
+// iptcSegment returns an APP13 segment holding an IPTC record in a Photoshop image resource.
+func iptcSegment() []byte {
+	record := iptcRecord()
+	resource := append([]byte("8BIM\x04\x04\x00\x00"), binary.BigEndian.AppendUint32(nil, uint32(len(record)))...)
+	resource = append(append(resource, record...), make([]byte, len(record)%2)...)
+	segment := append([]byte{0xFF, 0xED, 0x00, 0x00}, "Photoshop 3.0\x00"...)
+	segment = append(segment, resource...)
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(segment)-2))
+	return segment
+}
+
+// TestSanitizeExiftool checks the sanitized copies of images of each format with ExifTool, as an
+// oracle independent of the parsers of the package: it must find EXIF, XMP or IPTC tags in the
+// images, and none in their copies. It is skipped unless exiftool is installed.
+func TestSanitizeExiftool(t *testing.T) {
+	exiftool, err := exec.LookPath("exiftool")
+	if err != nil {
+		t.Skip("exiftool is not installed")
+	}
+
+	tiff := exifSegment[4+len(exifIdent):]
+	xmpPacket := append([]byte("http://ns.adobe.com/xap/1.0/\x00"), exiftoolXMP...)
+	jpegXMP := append([]byte{0xFF, 0xE1, 0x00, 0x00}, xmpPacket...)
+	binary.BigEndian.PutUint16(jpegXMP[2:], uint16(len(jpegXMP)-2))
+	gps := []testTag{{Tag: tagGPSLatitudeRef, Type: 2, Value: []byte("N\x00")}}
+
+	testTable := []struct {
+		Name    string
+		Input   []byte
+		Options []Option
+	}{
+		{Name: "jpeg", Input: jpegOf(exifSegmentOf([]testTag{asciiTag(tagMake, "Pixel")}, []testTag{asciiTag(0x9003, "2024:01:02 03:04:05")}, gps))},
+		{
+			Name:    "jpeg with xmp and iptc",
+			Input:   jpegOf(exifSegment, jpegXMP, iptcSegment()),
+			Options: []Option{WithSegmentAction(appMarker, SegmentRemove), WithSegmentAction(0xED, SegmentRemove)},
+		},
+		{Name: "png", Input: stillPNG(t, pngChunk("eXIf", tiff), pngChunk("iTXt", append([]byte(pngXMPKeyword+"\x00\x00\x00\x00\x00"), exiftoolXMP...)))},
+		{Name: "png with compressed xmp", Input: stillPNG(t, pngChunk("iTXt", append([]byte(pngXMPKeyword+"\x00\x01\x00\x00\x00"), compressed([]byte(exiftoolXMP))...)))},
+		{
+			Name: "webp",
+			Input: webpOf(vp8xOf(webpEXIFFlag|webpXMPFlag), webpChunk("VP8 ", []byte{0x30, 0x01, 0x00, 0x9D, 0x01, 0x2A, 3, 0, 2, 0}),
+				webpChunk("EXIF", tiff), webpChunk("XMP ", []byte(exiftoolXMP))),
+		},
+		{
+			Name: "jp2",
+			Input: jp2Of("jp2 ", mp4BoxOf("uuid", append(append([]byte{}, jp2ExifUUID...), tiff...)),
+				mp4BoxOf("uuid", append(append([]byte{}, jp2XMPUUID...), exiftoolXMP...)),
+				mp4BoxOf("uuid", append(append([]byte{}, jp2IPTCUUID...), iptcRecord()...))),
+		},
+		{Name: "heic", Input: heifBurst(exifSegment[4:], []byte(exiftoolXMP))},
+	}
+
+	dir := t.TempDir()
+	var inputs, outputs []string
+	for _, test := range testTable {
+		output := new(bytes.Buffer)
+		if _, err := Sanitize(bytes.NewReader(test.Input), output, test.Options...); err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.Name, err)
+		}
+		input := filepath.Join(dir, test.Name+"-input")
+		sanitized := filepath.Join(dir, test.Name+"-output")
+		if err := os.WriteFile(input, test.Input, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(sanitized, output.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		inputs, outputs = append(inputs, input), append(outputs, sanitized)
+	}
+
+	tags := exiftoolTags(t, exiftool, append(inputs, outputs...))
+	for i, test := range testTable {
+		if len(tags[inputs[i]]) == 0 {
+			t.Errorf("%s: expected exiftool to find metadata in the input", test.Name)
+		}
+		if remaining := tags[outputs[i]]; len(remaining) > 0 {
+			t.Errorf("%s: expected no EXIF, XMP or IPTC tags to be left, exiftool found %v", test.Name, remaining)
+		}
+	}
+}
+
+// exiftoolTags returns the EXIF, XMP and IPTC tags exiftool finds in each of files, with their
+// group, such as EXIF:Make, by file.
+func exiftoolTags(t *testing.T, exiftool string, files []string) map[string][]string {
+	t.Helper()
+	args := append([]string{"-json", "-G", "-EXIF:All", "-XMP:All", "-IPTC:All"}, files...)
+	// The exit status is left aside: exiftool fails on files it cannot read, which its output
+	// still lists, without tags.
+	out, err := exec.Command(exiftool, args...).Output()
+	var results []map[string]interface{}
+	if jsonErr := json.Unmarshal(out, &results); jsonErr != nil {
+		t.Fatalf("failed to read the output of exiftool: %v (%v)", jsonErr, err)
+	}
+
+	tags := make(map[string][]string)
+	for _, result := range results {
+		file, _ := result["SourceFile"].(string)
+		for name := range result {
+			if name != "SourceFile" {
+				tags[file] = append(tags[file], name)
+			}
+		}
+		sort.Strings(tags[file])
+	}
+	return tags
+}
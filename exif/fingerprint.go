@@ -0,0 +1,80 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Tags identifying the camera, lens or owner of an image.
+const (
+	tagImageUniqueID    = 0xA420
+	tagCameraOwnerName  = 0xA430
+	tagBodySerialNumber = 0xA431
+	tagLensSerialNumber = 0xA435
+	tagMakerNote        = 0x927C
+)
+
+// WithDeviceFingerprintRemoval makes Sanitize keep the EXIF data and only remove the tags that
+// identify the device and its owner: the body and lens serial numbers, the camera owner name, the
+// image unique ID and the maker note, whose vendor specific data often holds serial numbers too.
+// It can be combined with WithTimestampPolicy.
+func WithDeviceFingerprintRemoval() Option {
+	return func(o *options) {
+		o.edits = append(o.edits, removeTags(exifIFD,
+			tagImageUniqueID, tagCameraOwnerName, tagBodySerialNumber, tagLensSerialNumber, tagMakerNote))
+	}
+}
+
+// appleMakerNoteHeader starts the maker note of iPhone photos, which is followed by a version and
+// the byte order of an IFD whose offsets are relative to the start of the maker note.
+var appleMakerNoteHeader = []byte("Apple iOS\x00")
+
+// tagAppleContentIdentifier is the tag of the Apple maker note pairing a Live Photo with its video.
+const tagAppleContentIdentifier = 0x0011
+
+// WithLivePhotoPairingRemoval makes Sanitize remove the identifiers pairing Apple Live Photos with
+// their videos, which link both files to the library of the device they were taken with: the
+// content identifier of videos, and the maker note holding it in photos whose EXIF data is kept.
+// Photos whose EXIF data is removed lose it with the rest of their EXIF data.
+func WithLivePhotoPairingRemoval() Option {
+	return func(o *options) {
+		o.removePairing = true
+	}
+}
+
+// hasContentIdentifier reports whether EXIF data, stored as a bare TIFF structure, has an Apple
+// maker note holding a Live Photo content identifier.
+func hasContentIdentifier(data []byte) bool {
+	t, err := parseTIFF(data)
+	if err != nil {
+		return false
+	}
+	dirs, err := t.ifds()
+	if err != nil {
+		return false
+	}
+	for _, dir := range dirs {
+		for _, entry := range dir.entries {
+			if dir.kind != exifIFD || entry.tag != tagMakerNote {
+				continue
+			}
+			note, err := t.value(entry)
+			header := len(appleMakerNoteHeader) + 4
+			if err != nil || !bytes.HasPrefix(note, appleMakerNoteHeader) || len(note) < header+2 {
+				return false
+			}
+			order := binary.ByteOrder(binary.BigEndian)
+			if string(note[header-2:header]) == "II" {
+				order = binary.LittleEndian
+			}
+			count := int(order.Uint16(note[header:]))
+			for i := header + 2; i+2 <= len(note) && i < header+2+count*tagSize; i += tagSize {
+				if order.Uint16(note[i:]) == tagAppleContentIdentifier {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package exif
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Tags whose values FormatTag renders specially.
+const (
+	tagExposureTime          = 0x829A
+	tagFNumber               = 0x829D
+	tagISOSpeed              = 0x8827
+	tagExposureBias          = 0x9204
+	tagFocalLength           = 0x920A
+	tagFocalLengthIn35mmFilm = 0xA405
+	tagGPSAltitude           = 0x0006
+)
+
+// tagNames are the names of the common tags, by IFD name.
+var tagNames = map[string]map[uint16]string{
+	"IFD0": {
+		0x010E: "ImageDescription", tagMake: "Make", tagModel: "Model", tagOrientation: "Orientation",
+		0x011A: "XResolution", 0x011B: "YResolution", 0x0128: "ResolutionUnit", 0x0131: "Software",
+		tagDateTime: "DateTime", 0x013B: "Artist", 0x0213: "YCbCrPositioning", 0x8298: "Copyright",
+		exifIFDPointer: "ExifIFDPointer", gpsIFDPointer: "GPSInfoIFDPointer",
+	},
+	"Exif": {
+		tagExposureTime: "ExposureTime", tagFNumber: "FNumber", 0x8822: "ExposureProgram",
+		tagISOSpeed: "ISOSpeedRatings", 0x9000: "ExifVersion", tagDateTimeOriginal: "DateTimeOriginal",
+		tagDateTimeDigitized: "DateTimeDigitized", tagOffsetTime: "OffsetTime",
+		tagOffsetTimeOriginal: "OffsetTimeOriginal", tagOffsetTimeDigitized: "OffsetTimeDigitized",
+		0x9201: "ShutterSpeedValue", 0x9202: "ApertureValue", tagExposureBias: "ExposureBiasValue",
+		0x9207: "MeteringMode", 0x9209: "Flash", tagFocalLength: "FocalLength", tagMakerNote: "MakerNote",
+		0x9286: "UserComment", tagSubSecTime: "SubSecTime", tagSubSecTimeOriginal: "SubSecTimeOriginal",
+		tagSubSecTimeDigitized: "SubSecTimeDigitized", 0xA001: "ColorSpace", 0xA002: "PixelXDimension",
+		0xA003: "PixelYDimension", interopIFDPointer: "InteroperabilityIFDPointer", 0xA402: "ExposureMode",
+		0xA403: "WhiteBalance", tagFocalLengthIn35mmFilm: "FocalLengthIn35mmFilm",
+		0xA406: "SceneCaptureType", tagImageUniqueID: "ImageUniqueID", tagCameraOwnerName: "CameraOwnerName",
+		tagBodySerialNumber: "BodySerialNumber", 0xA433: "LensMake", tagLensModel: "LensModel",
+		tagLensSerialNumber: "LensSerialNumber",
+	},
+	"GPS": {
+		0x0000: "GPSVersionID", 0x0001: "GPSLatitudeRef", tagGPSLatitude: "GPSLatitude",
+		0x0003: "GPSLongitudeRef", tagGPSLongitude: "GPSLongitude", 0x0005: "GPSAltitudeRef",
+		tagGPSAltitude: "GPSAltitude", tagGPSTimeStamp: "GPSTimeStamp", 0x0010: "GPSImgDirectionRef",
+		0x0011: "GPSImgDirection", tagGPSDateStamp: "GPSDateStamp",
+	},
+	"Interop": {
+		0x0001: "InteroperabilityIndex", 0x0002: "InteroperabilityVersion",
+	},
+}
+
+// TagName returns the name of the tag as the EXIF standard spells it, such as ExposureTime, or
+// its number in hexadecimal, such as 0x9999, for tags it does not know. IFD1 tags, which describe
+// the thumbnail, are named as IFD0 tags.
+func TagName(ifd IFDInfo, tag Tag) string {
+	name := ifd.Name
+	if name == "IFD1" {
+		name = "IFD0"
+	}
+	if n, ok := tagNames[name][tag.ID]; ok {
+		return n
+	}
+	return fmt.Sprintf("0x%04X", tag.ID)
+}
+
+// FormatTag returns the value of the tag as photographers expect it: exposure times such as
+// "1/250s", apertures such as "f/2.8", "ISO 100", focal lengths such as "50mm", exposure biases
+// such as "+0.7 EV", and GPS latitudes and longitudes in decimal degrees, such as "52.520008".
+// Other strings are returned as is, numbers are separated by commas, and opaque data, such as
+// maker notes, is only described by its size.
+func FormatTag(ifd IFDInfo, tag Tag) string {
+	switch ifd.Name {
+	case "Exif":
+		if s, ok := formatExposure(tag); ok {
+			return s
+		}
+	case "GPS":
+		if s, ok := formatGPS(tag); ok {
+			return s
+		}
+	}
+	return formatValue(tag)
+}
+
+// formatExposure formats the EXIF tags describing the exposure, and returns false for the others.
+func formatExposure(tag Tag) (string, bool) {
+	switch tag.ID {
+	case tagExposureTime:
+		if v, ok := tag.float(); ok && v > 0 {
+			if v < 1 {
+				return fmt.Sprintf("1/%ds", int(math.Round(1/v))), true
+			}
+			return formatFloat(v, 1) + "s", true
+		}
+	case tagFNumber:
+		if v, ok := tag.float(); ok {
+			return "f/" + formatFloat(v, 1), true
+		}
+	case tagISOSpeed:
+		if v, ok := tag.float(); ok {
+			return "ISO " + formatFloat(v, 0), true
+		}
+	case tagFocalLength, tagFocalLengthIn35mmFilm:
+		if v, ok := tag.float(); ok {
+			return formatFloat(v, 1) + "mm", true
+		}
+	case tagExposureBias:
+		if v, ok := tag.float(); ok {
+			if v > 0 {
+				return "+" + formatFloat(v, 1) + " EV", true
+			}
+			return formatFloat(v, 1) + " EV", true
+		}
+	}
+	return "", false
+}
+
+// formatGPS formats the coordinates and altitude of GPS tags, and returns false for the others.
+func formatGPS(tag Tag) (string, bool) {
+	switch tag.ID {
+	case tagGPSLatitude, tagGPSLongitude:
+		if v, ok := tag.degrees(); ok {
+			return strconv.FormatFloat(v, 'f', 6, 64), true
+		}
+	case tagGPSAltitude:
+		if v, ok := tag.float(); ok {
+			return formatFloat(v, 1) + "m", true
+		}
+	}
+	return "", false
+}
+
+// formatValue formats the value of a tag according to its type.
+func formatValue(tag Tag) string {
+	if tag.Value == nil {
+		return ""
+	}
+	switch tag.Type {
+	case 2, 129: // ASCII and UTF-8
+		return strings.TrimSpace(strings.TrimRight(string(tag.Value), "\x00"))
+	case 7: // UNDEFINED
+		return fmt.Sprintf("%d bytes", len(tag.Value))
+	}
+	numbers := tag.numbers()
+	if numbers == nil {
+		return fmt.Sprintf("%d bytes", len(tag.Value))
+	}
+	values := make([]string, len(numbers))
+	for i, v := range numbers {
+		values[i] = formatFloat(v, 4)
+	}
+	return strings.Join(values, ", ")
+}
+
+// formatFloat formats v with at most the given number of decimals, dropping trailing zeros.
+func formatFloat(v float64, decimals int) string {
+	scale := math.Pow(10, float64(decimals))
+	return strconv.FormatFloat(math.Round(v*scale)/scale, 'f', -1, 64)
+}
+
+// numbers returns the values of a tag of a numeric type, or nil for the other types. Rationals
+// with a zero denominator are returned as NaN.
+func (t Tag) numbers() []float64 {
+	size, ok := typeSizes[t.Type]
+	if !ok || t.Type == 2 || t.Type == 7 || t.Type == 129 || t.ByteOrder == nil {
+		return nil
+	}
+	var values []float64
+	for b := t.Value; len(b) >= size; b = b[size:] {
+		var v float64
+		switch t.Type {
+		case 1: // BYTE
+			v = float64(b[0])
+		case 6: // SBYTE
+			v = float64(int8(b[0]))
+		case 3: // SHORT
+			v = float64(t.ByteOrder.Uint16(b))
+		case 8: // SSHORT
+			v = float64(int16(t.ByteOrder.Uint16(b)))
+		case 4: // LONG
+			v = float64(t.ByteOrder.Uint32(b))
+		case 9: // SLONG
+			v = float64(int32(t.ByteOrder.Uint32(b)))
+		case 5: // RATIONAL
+			v = ratio(float64(t.ByteOrder.Uint32(b)), float64(t.ByteOrder.Uint32(b[4:])))
+		case 10: // SRATIONAL
+			v = ratio(float64(int32(t.ByteOrder.Uint32(b))), float64(int32(t.ByteOrder.Uint32(b[4:]))))
+		case 11: // FLOAT
+			v = float64(math.Float32frombits(t.ByteOrder.Uint32(b)))
+		case 12: // DOUBLE
+			v = math.Float64frombits(t.ByteOrder.Uint64(b))
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// ratio returns n/d, or NaN if d is zero.
+func ratio(n, d float64) float64 {
+	if d == 0 {
+		return math.NaN()
+	}
+	return n / d
+}
+
+// float returns the first value of a numeric tag, and false if it has none or it is not a number.
+func (t Tag) float() (float64, bool) {
+	numbers := t.numbers()
+	if len(numbers) == 0 || math.IsNaN(numbers[0]) {
+		return 0, false
+	}
+	return numbers[0], true
+}
+
+// degrees returns the GPS coordinate stored as degrees, minutes and seconds in decimal degrees,
+// without its sign, which is stored separately as a N, S, E or W reference.
+func (t Tag) degrees() (float64, bool) {
+	numbers := t.numbers()
+	if len(numbers) != 3 {
+		return 0, false
+	}
+	for _, v := range numbers {
+		if math.IsNaN(v) {
+			return 0, false
+		}
+	}
+	return numbers[0] + numbers[1]/60 + numbers[2]/3600, true
+}
@@ -0,0 +1,64 @@
+package exif
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// rationalTag returns a tag of unsigned or signed rationals, given as numerator and denominator
+// pairs.
+func rationalTag(id, typ uint16, values ...int32) Tag {
+	var value []byte
+	for _, v := range values {
+		value = binary.BigEndian.AppendUint32(value, uint32(v))
+	}
+	return Tag{ID: id, Type: typ, Count: uint32(len(values) / 2), Value: value, ByteOrder: binary.BigEndian}
+}
+
+func TestFormatTag(t *testing.T) {
+	exifInfo := IFDInfo{Name: "Exif"}
+	gpsInfo := IFDInfo{Name: "GPS"}
+	testTable := []struct {
+		name  string
+		ifd   IFDInfo
+		tag   Tag
+		value string
+	}{
+		{"ExposureTime", exifInfo, rationalTag(tagExposureTime, 5, 1, 250), "1/250s"},
+		{"ExposureTime", exifInfo, rationalTag(tagExposureTime, 5, 10, 2500), "1/250s"},
+		{"ExposureTime", exifInfo, rationalTag(tagExposureTime, 5, 5, 2), "2.5s"},
+		{"FNumber", exifInfo, rationalTag(tagFNumber, 5, 28, 10), "f/2.8"},
+		{"FNumber", exifInfo, rationalTag(tagFNumber, 5, 8, 1), "f/8"},
+		{"ISOSpeedRatings", exifInfo, Tag{ID: tagISOSpeed, Type: 3, Count: 1, Value: []byte{0x00, 0x64}, ByteOrder: binary.BigEndian}, "ISO 100"},
+		{"FocalLength", exifInfo, rationalTag(tagFocalLength, 5, 50, 1), "50mm"},
+		{"ExposureBiasValue", exifInfo, rationalTag(tagExposureBias, 10, 2, 3), "+0.7 EV"},
+		{"ExposureBiasValue", exifInfo, rationalTag(tagExposureBias, 10, -1, 3), "-0.3 EV"},
+		{"GPSLatitude", gpsInfo, rationalTag(tagGPSLatitude, 5, 52, 1, 31, 1, 1224, 100), "52.520067"},
+		{"GPSAltitude", gpsInfo, rationalTag(tagGPSAltitude, 5, 345, 10), "34.5m"},
+		{"Make", IFDInfo{Name: "IFD0"}, Tag{ID: tagMake, Type: 2, Count: 6, Value: []byte("Canon\x00")}, "Canon"},
+		{"Artist", IFDInfo{Name: "IFD0"}, Tag{ID: 0x013B, Type: 129, Count: 7, Value: []byte("Zoë A\x00")}, "Zoë A"},
+		{"MakerNote", exifInfo, Tag{ID: tagMakerNote, Type: 7, Count: 3, Value: []byte{1, 2, 3}}, "3 bytes"},
+		{"0x9999", exifInfo, Tag{ID: 0x9999, Type: 3, Count: 2, Value: []byte{0, 1, 0, 2}, ByteOrder: binary.LittleEndian}, "256, 512"},
+		{"0x9999", exifInfo, rationalTag(0x9999, 5, 1, 0), "NaN"},
+	}
+
+	for _, test := range testTable {
+		if name := TagName(test.ifd, test.tag); name != test.name {
+			t.Errorf("expected tag 0x%04X to be named %s, got %s", test.tag.ID, test.name, name)
+		}
+		if value := FormatTag(test.ifd, test.tag); value != test.value {
+			t.Errorf("%s: expected %q, got %q", test.name, test.value, value)
+		}
+	}
+}
+
+func TestFormatTagOutsideItsIFD(t *testing.T) {
+	// GPS tag numbers are reused by other IFDs, such as 0x0002 for the interoperability version.
+	tag := rationalTag(tagGPSLatitude, 5, 52, 1, 31, 1, 0, 1)
+	if value := FormatTag(IFDInfo{Name: "Exif"}, tag); value != "52, 31, 0" {
+		t.Errorf("expected plain rationals, got %q", value)
+	}
+	if name := TagName(IFDInfo{Name: "IFD1"}, Tag{ID: tagMake}); name != "Make" {
+		t.Errorf("expected IFD1 tags to be named as IFD0 tags, got %s", name)
+	}
+}
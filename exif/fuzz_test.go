@@ -0,0 +1,246 @@
+package exif
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The fuzz targets below feed the parsers the untrusted uploads they handle. Run them with
+//
+//	make fuzz
+//
+// Continuous fuzzing infrastructure, such as OSS-Fuzz, builds them as libFuzzer targets, and
+// takes their seed corpus from the archives make fuzz-corpus writes.
+
+// fuzzSeeds returns the seed inputs of each fuzz target, by name.
+func fuzzSeeds(tb testing.TB) map[string][][]byte {
+	tiff := exifSegment[4+len(exifIdent):]
+	jpegs := [][]byte{
+		jpegOf(exifSegment),
+		jpegOf(xmpSegment, exifSegment, iccSegment(1, 1, []byte("profile"))),
+		append(jpegOf(app11Segment(1, 1, c2paManifest), exifSegment), "MotionPhoto_Data"...),
+		jpegOf(exifSegmentOf([]testTag{asciiTag(tagMake, "Pixel")}, []testTag{asciiTag(0x9003, "2024:01:02 03:04:05")}, []testTag{{Tag: 0x0001, Type: 2, Value: []byte("N\x00")}})),
+	}
+	pngs := [][]byte{
+		stillPNG(tb),
+		stillPNG(tb, pngChunk("eXIf", tiff), pngChunk("tEXt", []byte("Comment\x00secret"))),
+		stillPNG(tb, pngChunk("iTXt", append([]byte(pngXMPKeyword+"\x00\x00\x00\x00\x00"), "<x:xmpmeta/>"...)), pngChunk("iCCP", append([]byte("ICC\x00\x00"), compressed([]byte("profile"))...))),
+	}
+	lossy := webpChunk("VP8 ", []byte{0x30, 0x01, 0x00, 0x9D, 0x01, 0x2A, 3, 0, 2, 0})
+	lossless := webpChunk("VP8L", []byte{0x2F, 0x02, 0x40, 0x00, 0x00})
+	webps := [][]byte{
+		webpOf(lossy),
+		webpOf(vp8xOf(webpICCFlag|webpEXIFFlag|webpXMPFlag), webpChunk("ICCP", []byte("profile")), lossy, webpChunk("EXIF", tiff), webpChunk("XMP ", []byte("<x:xmpmeta/>"))),
+		webpOf(vp8xOf(0x10|webpEXIFFlag), lossless, webpChunk("EXIF", tiff)),
+	}
+
+	page := tiffTestPage{Entries: []tiffTestEntry{{0x0100, 3, shortValue(2)}, {0x0101, 3, shortValue(1)}, {tagMake, 2, []byte("Scanner\x00")}}, Strips: [][]byte{[]byte("strip")}}
+	tiffs := [][]byte{
+		tiffOf(page),
+		tiffOf(page, tiffTestPage{Entries: []tiffTestEntry{{tagICCProfile, 7, []byte("profile")}}, Strips: [][]byte{[]byte("one"), []byte("two")}}),
+	}
+	bmffs := [][]byte{
+		heifBurst(exifSegment[4:], []byte("<x:xmpmeta/>")),
+		jp2Of("jp2 ", mp4BoxOf("uuid", append(append([]byte{}, jp2ExifUUID...), tiff...)), mp4BoxOf("xml ", []byte("<scanner/>"))),
+		append(mp4BoxOf("ftyp", []byte("qt  \x00\x00\x00\x00qt  ")), mp4BoxOf("moov", mp4Header("mvhd", mp4Time),
+			quickTimeMeta("com.apple.quicktime.make", "Apple"), mp4BoxOf("udta", mp4BoxOf("\xa9xyz", []byte("\x00\x12\x15\xc7+52.3700+004.8900/"))))...),
+	}
+	pdfs := [][]byte{
+		pdfOf("<< /Type /Catalog /Pages 2 0 R >>", "<< /Type /Pages /Kids [] /Count 0 >>", "<< /Author (Jane \\(Doe\\)) /Title <4869> >>"),
+		pdfOf("<< /Type /Catalog /Metadata 2 0 R >>", "<< /Type /Metadata /Subtype /XML /Length 12 >>\nstream\n<x:xmpmeta/>\nendstream", "<< /Producer (Writer) >>"),
+	}
+	svgs := [][]byte{
+		[]byte(inkscapeSVG),
+		[]byte(`<svg xmlns="http://www.w3.org/2000/svg" xmlns:h="http://www.w3.org/1999/xhtml"><h:script>x</h:script><a href="&#106;avascript:x"><set attributeName="href" to="javascript:x"/></a></svg>`),
+	}
+	bitmaps := [][]byte{
+		bmpOf(),
+		icoOf(stillPNG(tb, pngChunk("tEXt", []byte("Author\x00Secret")))),
+		[]byte("P6\n# Created by Scanner 3000\n1 1 # one pixel\n255\r\x00\x0A\x20"),
+	}
+
+	var all, parse [][]byte
+	for _, seeds := range [][][]byte{jpegs, pngs, webps, tiffs, bmffs, pdfs, svgs, bitmaps} {
+		all = append(all, seeds...)
+	}
+	parse = append(append(append(parse, jpegs...), pngs...), tiff)
+	return map[string][][]byte{
+		"FuzzDiscard": all, "FuzzParse": parse, "FuzzPNG": pngs, "FuzzWebP": webps, "FuzzTIFF": tiffs,
+		"FuzzBMFF": bmffs, "FuzzPDF": pdfs, "FuzzSVG": svgs, "FuzzBitmap": bitmaps,
+	}
+}
+
+// TestWriteFuzzCorpus writes the seeds of the fuzz targets, and the inputs under testdata/fuzz, as
+// raw files to the directory EXIF_FUZZ_CORPUS names, in a directory per target, for make
+// fuzz-corpus to package. It is skipped unless EXIF_FUZZ_CORPUS is set.
+func TestWriteFuzzCorpus(t *testing.T) {
+	dir := os.Getenv("EXIF_FUZZ_CORPUS")
+	if dir == "" {
+		t.Skip("EXIF_FUZZ_CORPUS is not set")
+	}
+	for target, seeds := range fuzzSeeds(t) {
+		// The inputs the fuzzer found are stored as Go values, such as []byte("...").
+		files, _ := filepath.Glob(filepath.Join("testdata", "fuzz", target, "*"))
+		for _, file := range files {
+			raw, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+			value := strings.TrimSuffix(strings.TrimPrefix(lines[len(lines)-1], "[]byte("), ")")
+			seed, err := strconv.Unquote(value)
+			if err != nil {
+				t.Fatalf("%s: %v", file, err)
+			}
+			seeds = append(seeds, []byte(seed))
+		}
+
+		if err := os.MkdirAll(filepath.Join(dir, target), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for i, seed := range seeds {
+			if err := os.WriteFile(filepath.Join(dir, target, fmt.Sprintf("seed-%d", i)), seed, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// FuzzDiscard checks that removing the metadata of any input does not panic, and that
+// DiscardSeeker removes the same EXIF segments as Discard.
+func FuzzDiscard(f *testing.F) {
+	for _, seed := range fuzzSeeds(f)["FuzzDiscard"] {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		DiscardBytes(append([]byte{}, data...))
+
+		expected := new(bytes.Buffer)
+		err := Discard(bytes.NewReader(data), expected)
+		output := new(bytes.Buffer)
+		seekErr := DiscardSeeker(bytes.NewReader(data), output)
+		if err == nil && seekErr == nil && !bytes.Equal(expected.Bytes(), output.Bytes()) {
+			t.Errorf("DiscardSeeker wrote %q, Discard %q", output.Bytes(), expected.Bytes())
+		}
+	})
+}
+
+// FuzzParse checks that reading the tags, location and embedded images of any input does not
+// panic.
+func FuzzParse(f *testing.F) {
+	for _, seed := range fuzzSeeds(f)["FuzzParse"] {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Walk(bytes.NewReader(data), func(ifd IFDInfo, tag Tag) error {
+			FormatTag(ifd, tag)
+			return nil
+		})
+		GPS(bytes.NewReader(data))
+		Exists(bytes.NewReader(data))
+		Detect(data)
+		FindEmbedded(data)
+		MetadataFree(data)
+	})
+}
+
+// FuzzPNG checks that sanitizing any PNG image does not panic, and that its sanitized copy has
+// nothing left to remove.
+func FuzzPNG(f *testing.F) {
+	for _, seed := range fuzzSeeds(f)["FuzzPNG"] {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzSanitize(t, append(append([]byte{}, pngSignature...), bytes.TrimPrefix(data, pngSignature)...))
+	})
+}
+
+// FuzzWebP checks that sanitizing any WebP image does not panic, and that its sanitized copy has
+// nothing left to remove.
+func FuzzWebP(f *testing.F) {
+	for _, seed := range fuzzSeeds(f)["FuzzWebP"] {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzSanitize(t, data)
+	})
+}
+
+// FuzzTIFF checks that rewriting any TIFF image does not panic, and that its rewritten copy has
+// nothing left to remove.
+func FuzzTIFF(f *testing.F) {
+	for _, seed := range fuzzSeeds(f)["FuzzTIFF"] {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzSanitize(t, data)
+	})
+}
+
+// FuzzBMFF checks that sanitizing any file made of ISO base media boxes, such as HEIF and AVIF
+// images, JPEG 2000 images and videos, does not panic, and that its sanitized copy has nothing
+// left to remove.
+func FuzzBMFF(f *testing.F) {
+	for _, seed := range fuzzSeeds(f)["FuzzBMFF"] {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzSanitize(t, data)
+	})
+}
+
+// FuzzPDF checks that sanitizing any PDF document does not panic, and that its sanitized copy
+// has nothing left to remove.
+func FuzzPDF(f *testing.F) {
+	for _, seed := range fuzzSeeds(f)["FuzzPDF"] {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzSanitize(t, data)
+	})
+}
+
+// FuzzSVG checks that sanitizing any SVG image, removing its scripts, does not panic, and that
+// its sanitized copy has nothing left to remove.
+func FuzzSVG(f *testing.F) {
+	for _, seed := range fuzzSeeds(f)["FuzzSVG"] {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzSanitize(t, data, WithSVGScriptRemoval())
+	})
+}
+
+// FuzzBitmap checks that reading any BMP, ICO, PPM or PGM image does not panic, and that its
+// copy has nothing left to remove.
+func FuzzBitmap(f *testing.F) {
+	for _, seed := range fuzzSeeds(f)["FuzzBitmap"] {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		MetadataFree(data)
+		fuzzSanitize(t, data)
+	})
+}
+
+// fuzzSanitize sanitizes data and, if it succeeds, sanitizes the copy again, which must succeed
+// without removing anything.
+func fuzzSanitize(t *testing.T, data []byte, opts ...Option) {
+	output := new(bytes.Buffer)
+	if _, err := Sanitize(bytes.NewReader(data), output, opts...); err != nil {
+		return
+	}
+	report, err := Sanitize(bytes.NewReader(output.Bytes()), io.Discard, opts...)
+	if err != nil {
+		t.Fatalf("failed to sanitize the sanitized copy %q: %v", output.Bytes(), err)
+	}
+	if report.BytesRemoved != 0 {
+		t.Errorf("expected nothing to be left to remove from %q, %d bytes were removed", output.Bytes(), report.BytesRemoved)
+	}
+}
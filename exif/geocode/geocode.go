@@ -0,0 +1,132 @@
+// Package geocode translates the coordinates recorded in images into the names of the places
+// they were taken at, such as "Berlin, DE", for alerts and reports telling users what an image
+// reveals.
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// Resolver translates coordinates in decimal degrees into the name of a place.
+type Resolver interface {
+	// Resolve returns the name of the place at the given coordinates, or an empty string if it
+	// has none, such as at sea.
+	Resolve(ctx context.Context, latitude, longitude float64) (string, error)
+}
+
+// Nop is the default Resolver, which names no place, so that coordinates are never sent
+// anywhere unless a resolver is configured.
+type Nop struct{}
+
+// Resolve returns an empty string.
+func (Nop) Resolve(ctx context.Context, latitude, longitude float64) (string, error) {
+	return "", nil
+}
+
+// Place returns the name of the place of location as r resolves it, or an empty string if
+// location is nil.
+func Place(ctx context.Context, r Resolver, location *exif.Location) (string, error) {
+	if location == nil {
+		return "", nil
+	}
+	return r.Resolve(ctx, location.Latitude, location.Longitude)
+}
+
+// defaultClient is the HTTP client of HTTPResolvers without one.
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// HTTPResolver is an example Resolver querying a reverse geocoding service compatible with the
+// reverse endpoint of Nominatim, the geocoder of OpenStreetMap, such as a self-hosted instance.
+// Places are named by their city, or failing that their town, village, county or state, and their
+// country code. Public instances limit how often they may be queried, and coordinates sent to a
+// service disclose where the images were taken to it.
+type HTTPResolver struct {
+	// URL is the reverse endpoint, such as https://nominatim.example.com/reverse. The
+	// coordinates and format are added to its query.
+	URL string
+
+	// UserAgent identifies the application to the service, as Nominatim requires.
+	UserAgent string
+
+	// Client sends the requests, or a client with a 10 second timeout if nil.
+	Client *http.Client
+}
+
+// nominatimResponse is the part of the response of the reverse endpoint naming the place.
+type nominatimResponse struct {
+	Error   string `json:"error"`
+	Address struct {
+		City        string `json:"city"`
+		Town        string `json:"town"`
+		Village     string `json:"village"`
+		County      string `json:"county"`
+		State       string `json:"state"`
+		CountryCode string `json:"country_code"`
+	} `json:"address"`
+}
+
+// Resolve queries the service for the place at the given coordinates.
+func (h *HTTPResolver) Resolve(ctx context.Context, latitude, longitude float64) (string, error) {
+	u, err := url.Parse(h.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid reverse geocoding URL: %v", err)
+	}
+	query := u.Query()
+	query.Set("format", "jsonv2")
+	query.Set("lat", strconv.FormatFloat(latitude, 'f', 6, 64))
+	query.Set("lon", strconv.FormatFloat(longitude, 'f', 6, 64))
+	// Cities are as precise as place names in alerts need to be.
+	query.Set("zoom", "10")
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if h.UserAgent != "" {
+		req.Header.Set("User-Agent", h.UserAgent)
+	}
+	client := h.Client
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("reverse geocoding failed: unexpected status %s", resp.Status)
+	}
+
+	var result nominatimResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("invalid reverse geocoding response: %v", err)
+	}
+	if result.Error != "" {
+		// Nominatim reports coordinates without a place, such as at sea, as errors.
+		return "", nil
+	}
+
+	address := result.Address
+	var parts []string
+	for _, name := range []string{address.City, address.Town, address.Village, address.County, address.State} {
+		if name != "" {
+			parts = append(parts, name)
+			break
+		}
+	}
+	if address.CountryCode != "" {
+		parts = append(parts, strings.ToUpper(address.CountryCode))
+	}
+	return strings.Join(parts, ", "), nil
+}
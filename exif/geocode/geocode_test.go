@@ -0,0 +1,77 @@
+package geocode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+func TestHTTPResolver(t *testing.T) {
+	testTable := []struct {
+		name     string
+		response string
+		place    string
+	}{
+		{"city", `{"address": {"city": "Berlin", "state": "Berlin", "country_code": "de"}}`, "Berlin, DE"},
+		{"village", `{"address": {"village": "Hallstatt", "county": "Gmunden", "country_code": "at"}}`, "Hallstatt, AT"},
+		{"country only", `{"address": {"country_code": "aq"}}`, "AQ"},
+		{"sea", `{"error": "Unable to geocode"}`, ""},
+	}
+	for _, test := range testTable {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query := r.URL.Query()
+				if query.Get("lat") != "52.520008" || query.Get("lon") != "13.404954" || query.Get("format") != "jsonv2" || query.Get("key") != "secret" {
+					t.Errorf("unexpected query %s", r.URL.RawQuery)
+				}
+				if r.UserAgent() != "test-agent" {
+					t.Errorf("unexpected user agent %q", r.UserAgent())
+				}
+				w.Write([]byte(test.response))
+			}))
+			defer server.Close()
+
+			resolver := &HTTPResolver{URL: server.URL + "/reverse?key=secret", UserAgent: "test-agent"}
+			place, err := resolver.Resolve(context.Background(), 52.520008, 13.404954)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if place != test.place {
+				t.Errorf("expected %q, got %q", test.place, place)
+			}
+		})
+	}
+}
+
+func TestHTTPResolverErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("lat") == "1.000000" {
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("<html>"))
+	}))
+	defer server.Close()
+
+	resolver := &HTTPResolver{URL: server.URL}
+	if _, err := resolver.Resolve(context.Background(), 1, 1); err == nil {
+		t.Error("expected an error for a failed request")
+	}
+	if _, err := resolver.Resolve(context.Background(), 2, 2); err == nil {
+		t.Error("expected an error for an invalid response")
+	}
+}
+
+func TestPlace(t *testing.T) {
+	place, err := Place(context.Background(), Nop{}, &exif.Location{Latitude: 52.52, Longitude: 13.4})
+	if err != nil || place != "" {
+		t.Errorf("expected the default resolver to name no place, got %q, %v", place, err)
+	}
+	place, err = Place(context.Background(), &HTTPResolver{URL: "http://127.0.0.1:0"}, nil)
+	if err != nil || place != "" {
+		t.Errorf("expected no place without a location, got %q, %v", place, err)
+	}
+}
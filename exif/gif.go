@@ -0,0 +1,155 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// GIF block introducers and extension labels.
+const (
+	gifExtension        = 0x21
+	gifImageDescriptor  = 0x2C
+	gifTrailer          = 0x3B
+	gifGraphicControl   = 0xF9
+	gifCommentExtension = 0xFE
+	gifApplication      = 0xFF
+)
+
+// gifLoopApplications identify the application extensions holding the loop count of animations,
+// which are the only application extensions kept.
+var gifLoopApplications = [][]byte{[]byte("NETSCAPE2.0"), []byte("ANIMEXTS1.0")}
+
+// gifICCApplication identifies the application extension holding an ICC profile.
+var gifICCApplication = []byte("ICCRGBG1012")
+
+func isGIF(raw []byte) bool {
+	return bytes.HasPrefix(raw, []byte("GIF87a")) || bytes.HasPrefix(raw, []byte("GIF89a"))
+}
+
+// gifColorTableSize returns the size in bytes of the color table described by the flags of a
+// logical screen or image descriptor, or zero if there is none.
+func gifColorTableSize(flags byte) int {
+	if flags&0x80 == 0 {
+		return 0
+	}
+	return 3 << (flags&0x07 + 1)
+}
+
+// gifSubBlocks returns the offset following the data sub-blocks starting at offset, which end
+// with an empty sub-block.
+func gifSubBlocks(raw []byte, offset int) (int, error) {
+	for {
+		if offset >= len(raw) {
+			return 0, fmt.Errorf("the GIF data sub-blocks are truncated")
+		}
+		size := int(raw[offset])
+		offset++
+		if size == 0 {
+			return offset, nil
+		}
+		offset += size
+	}
+}
+
+// sanitizeGIF removes the comment extensions and the application extensions holding XMP packets
+// or other metadata from the GIF image raw. The image descriptors, the graphic control extensions
+// holding the timing of frames and the loop count of animations are kept.
+func sanitizeGIF(raw []byte, o *options) ([][]byte, *Report, error) {
+	if len(raw) < 13 {
+		return nil, nil, fmt.Errorf("the GIF header is truncated")
+	}
+	report := &Report{
+		Format: "gif",
+		Width:  int(binary.LittleEndian.Uint16(raw[6:])),
+		Height: int(binary.LittleEndian.Uint16(raw[8:])),
+	}
+
+	parts := [][]byte{}
+	start := 13 + gifColorTableSize(raw[10])
+	kept := 0
+	var delay time.Duration
+	for offset := start; ; {
+		if offset >= len(raw) {
+			return nil, nil, fmt.Errorf("the GIF image is missing its trailer")
+		}
+
+		blockStart := offset
+		remove := false
+		switch raw[offset] {
+		case gifTrailer:
+			end := trailer(raw, offset+1, o, report)
+			parts = append(parts, raw[kept:end])
+			if report.Frames < 2 {
+				report.Frames, report.Duration = 0, 0
+			}
+			return parts, report, nil
+
+		case gifImageDescriptor:
+			if offset+11 > len(raw) {
+				return nil, nil, fmt.Errorf("the GIF image descriptor is truncated")
+			}
+			offset += 10 + gifColorTableSize(raw[offset+9]) + 1 // The LZW minimum code size follows.
+			report.Frames++
+			report.Duration += delay
+			delay = 0
+
+		case gifExtension:
+			if offset+2 > len(raw) {
+				return nil, nil, fmt.Errorf("the GIF extension is truncated")
+			}
+			label := raw[offset+1]
+			offset += 2
+			switch label {
+			case gifGraphicControl:
+				if offset+4 < len(raw) {
+					delay = time.Duration(binary.LittleEndian.Uint16(raw[offset+2:])) * 10 * time.Millisecond
+				}
+			case gifCommentExtension:
+				remove = true
+				report.MetadataRemoved = true
+			case gifApplication:
+				var identifier []byte
+				if offset < len(raw) && offset+1+int(raw[offset]) <= len(raw) {
+					identifier = raw[offset+1 : offset+1+int(raw[offset])]
+				}
+				switch {
+				case isGIFLoopApplication(identifier):
+				case bytes.Equal(identifier, gifICCApplication):
+					if o.icc != ICCPreserve {
+						remove = true
+						report.ICCRemoved = true
+					}
+				default:
+					o.logf("Found GIF application extension %q", identifier)
+					remove = true
+					report.MetadataRemoved = true
+				}
+			}
+
+		default:
+			return nil, nil, fmt.Errorf("unknown GIF block 0x%02x at offset %d", raw[offset], offset)
+		}
+
+		end, err := gifSubBlocks(raw, offset)
+		if err != nil {
+			return nil, nil, err
+		}
+		if remove {
+			parts = append(parts, raw[kept:blockStart])
+			report.BytesRemoved += end - blockStart
+			kept = end
+		}
+		offset = end
+	}
+}
+
+func isGIFLoopApplication(identifier []byte) bool {
+	for _, loop := range gifLoopApplications {
+		if bytes.Equal(identifier, loop) {
+			return true
+		}
+	}
+	return false
+}
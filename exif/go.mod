@@ -0,0 +1,3 @@
+module github.com/nimrodshn/mattermost-exif-plugin/exif
+
+go 1.21
@@ -0,0 +1,103 @@
+package exif
+
+import (
+	"io"
+	"math"
+	"time"
+)
+
+// GPS tags giving the hemisphere of the coordinates and the side of sea level of the altitude.
+const (
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLongitudeRef = 0x0003
+	tagGPSAltitudeRef  = 0x0005
+)
+
+// Location is where an image was taken, as recorded in its GPS tags.
+type Location struct {
+	// Latitude and Longitude are in decimal degrees, negative south of the equator and west of
+	// the prime meridian.
+	Latitude  float64
+	Longitude float64
+
+	// Altitude is in meters, negative below sea level, if HasAltitude is true.
+	Altitude    float64
+	HasAltitude bool
+
+	// Time is when the position was recorded, in UTC, or the zero time if unknown. Unlike the
+	// date and time of the image, it comes from the satellites rather than the camera clock.
+	Time time.Time
+}
+
+// GPS returns the location recorded in the GPS tags of the EXIF data of the image read from r, or
+// nil if it records none. Like Walk, which it builds on, it supports JPEG, PNG and WebP images and
+// bare TIFF structures, and only reads the image up to its EXIF data.
+func GPS(r io.Reader) (*Location, error) {
+	tags := make(map[uint16]Tag)
+	err := Walk(r, func(ifd IFDInfo, tag Tag) error {
+		if ifd.Name == "GPS" {
+			tags[tag.ID] = tag
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return locationOf(tags), nil
+}
+
+// locationOf returns the location recorded in the given GPS tags, by number, or nil if they do not
+// hold both a latitude and a longitude.
+func locationOf(tags map[uint16]Tag) *Location {
+	latitude, ok := tags[tagGPSLatitude].degrees()
+	if !ok {
+		return nil
+	}
+	longitude, ok := tags[tagGPSLongitude].degrees()
+	if !ok {
+		return nil
+	}
+
+	location := &Location{Latitude: latitude, Longitude: longitude}
+	if formatValue(tags[tagGPSLatitudeRef]) == "S" {
+		location.Latitude = -location.Latitude
+	}
+	if formatValue(tags[tagGPSLongitudeRef]) == "W" {
+		location.Longitude = -location.Longitude
+	}
+	if altitude, ok := tags[tagGPSAltitude].float(); ok {
+		location.Altitude, location.HasAltitude = altitude, true
+		if ref, ok := tags[tagGPSAltitudeRef].float(); ok && ref == 1 {
+			location.Altitude = -altitude
+		}
+	}
+
+	// The date is a string, and the time of day three rationals: hours, minutes and seconds.
+	date, err := time.Parse("2006:01:02", formatValue(tags[tagGPSDateStamp]))
+	clock := tags[tagGPSTimeStamp].numbers()
+	if err == nil && len(clock) == 3 && !math.IsNaN(clock[0]+clock[1]+clock[2]) {
+		seconds := clock[0]*3600 + clock[1]*60 + clock[2]
+		location.Time = date.Add(time.Duration(seconds * float64(time.Second)))
+	}
+	return location
+}
+
+// WithGPSRemoval makes Sanitize keep the EXIF data and only remove its GPS tags, which record
+// where and when the image was taken. It can be combined with WithTimestampPolicy and
+// WithDeviceFingerprintRemoval.
+func WithGPSRemoval() Option {
+	return func(o *options) {
+		o.edits = append(o.edits, removeGPS)
+	}
+}
+
+// removeGPS removes every tag of the GPS IFD, leaving it empty.
+func removeGPS(t *tiffData, dirs []*ifd) int {
+	removed := 0
+	for _, dir := range dirs {
+		if dir.kind == gpsIFD {
+			removed += t.removeEntries(dir, func(ifdEntry) bool { return true })
+		}
+	}
+	return removed
+}
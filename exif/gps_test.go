@@ -0,0 +1,124 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+// rationals returns the big endian encoding of the given numerator and denominator pairs.
+func rationals(values ...uint32) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+func TestGPS(t *testing.T) {
+	segment := exifSegmentOf(
+		[]testTag{asciiTag(tagMake, "Apple")},
+		nil,
+		[]testTag{
+			asciiTag(tagGPSLatitudeRef, "S"),
+			{Tag: tagGPSLatitude, Type: 5, Value: rationals(33, 1, 52, 1, 1080, 100)},
+			asciiTag(tagGPSLongitudeRef, "E"),
+			{Tag: tagGPSLongitude, Type: 5, Value: rationals(151, 1, 12, 1, 3000, 100)},
+			{Tag: tagGPSAltitudeRef, Type: 1, Value: []byte{1}},
+			{Tag: tagGPSAltitude, Type: 5, Value: rationals(125, 10)},
+			{Tag: tagGPSTimeStamp, Type: 5, Value: rationals(13, 1, 45, 1, 3050, 100)},
+			asciiTag(tagGPSDateStamp, "2024:03:02"),
+		},
+	)
+
+	location, err := GPS(bytes.NewReader(jpegOf(segment)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if location == nil {
+		t.Fatal("expected a location")
+	}
+	if math.Abs(location.Latitude+33.8696667) > 1e-6 || math.Abs(location.Longitude-151.2083333) > 1e-6 {
+		t.Errorf("expected -33.869667, 151.208333, got %f, %f", location.Latitude, location.Longitude)
+	}
+	if !location.HasAltitude || location.Altitude != -12.5 {
+		t.Errorf("expected an altitude of -12.5m, got %v", location.Altitude)
+	}
+	if expected := time.Date(2024, 3, 2, 13, 45, 30, 500000000, time.UTC); !location.Time.Equal(expected) {
+		t.Errorf("expected time %v, got %v", expected, location.Time)
+	}
+}
+
+func TestSanitizeGPSRemoval(t *testing.T) {
+	input := jpegOf(exifSegmentOf(
+		[]testTag{asciiTag(tagMake, "Apple")},
+		nil,
+		[]testTag{
+			asciiTag(tagGPSLatitudeRef, "S"),
+			{Tag: tagGPSLatitude, Type: 5, Value: rationals(33, 1, 52, 1, 1080, 100)},
+			asciiTag(tagGPSLongitudeRef, "E"),
+			{Tag: tagGPSLongitude, Type: 5, Value: rationals(151, 1, 12, 1, 3000, 100)},
+		},
+	))
+
+	output := new(bytes.Buffer)
+	report, err := Sanitize(bytes.NewReader(input), output, WithGPSRemoval())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !report.ExifEdited || report.TagsEdited != 4 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	tags := tagsOf(t, output.Bytes())
+	if len(tags[gpsIFD]) != 0 {
+		t.Errorf("expected the GPS tags to be removed, got %v", tags[gpsIFD])
+	}
+	if string(tags[ifd0][tagMake]) != "Apple\x00" {
+		t.Errorf("expected Make to be kept, got %q", tags[ifd0][tagMake])
+	}
+	if location, err := GPS(bytes.NewReader(output.Bytes())); err != nil || location != nil {
+		t.Errorf("expected no location, got %+v, %v", location, err)
+	}
+}
+
+func TestGPSWithoutCoordinates(t *testing.T) {
+	testTable := []struct {
+		name  string
+		image []byte
+	}{
+		{"no EXIF data", jpegOf(jfifSegment)},
+		{"no GPS IFD", jpegOf(exifSegmentOf([]testTag{asciiTag(tagMake, "Apple")}, nil, nil))},
+		{"time only", jpegOf(exifSegmentOf(nil, nil, []testTag{asciiTag(tagGPSDateStamp, "2024:03:02")}))},
+		{"zero denominator", jpegOf(exifSegmentOf(nil, nil, []testTag{
+			{Tag: tagGPSLatitude, Type: 5, Value: rationals(52, 0, 31, 1, 0, 1)},
+			{Tag: tagGPSLongitude, Type: 5, Value: rationals(13, 1, 24, 1, 0, 1)},
+		}))},
+	}
+	for _, test := range testTable {
+		location, err := GPS(bytes.NewReader(test.image))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if location != nil {
+			t.Errorf("%s: expected no location, got %+v", test.name, location)
+		}
+	}
+}
+
+func TestGPSWithoutAltitudeOrTime(t *testing.T) {
+	segment := exifSegmentOf(nil, nil, []testTag{
+		{Tag: tagGPSLatitude, Type: 5, Value: rationals(52, 1, 31, 1, 0, 1)},
+		asciiTag(tagGPSLongitudeRef, "W"),
+		{Tag: tagGPSLongitude, Type: 5, Value: rationals(13, 1, 24, 1, 0, 1)},
+	})
+	location, err := GPS(bytes.NewReader(jpegOf(segment)))
+	if err != nil || location == nil {
+		t.Fatalf("expected a location, got %v, %v", location, err)
+	}
+	if location.Longitude != -13.4 || location.HasAltitude || !location.Time.IsZero() {
+		t.Errorf("unexpected location %+v", location)
+	}
+}
@@ -0,0 +1,193 @@
+package exif
+
+import (
+	"encoding/binary"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif/bmff"
+)
+
+// heicBrands are the major brands of HEIF files holding HEVC images and sequences, reported as
+// heic. Other HEIF files, such as those of the generic mif1 and msf1 brands, are reported as heif.
+var heicBrands = map[string]bool{"heic": true, "heix": true, "heim": true, "heis": true, "hevc": true, "hevx": true}
+
+// heifBrands are the major brands of the other HEIF files.
+var heifBrands = map[string]bool{"mif1": true, "msf1": true}
+
+// avifBrands are the major brands of AVIF images and image sequences, HEIF files holding AV1
+// images, reported as avif.
+var avifBrands = map[string]bool{"avif": true, "avis": true}
+
+// heifFormat returns heic, avif or heif for HEIF files, according to their major brand, and an
+// empty string for other ISO base media files.
+func heifFormat(raw []byte) string {
+	switch brand := string(raw[8:12]); {
+	case heicBrands[brand]:
+		return "heic"
+	case avifBrands[brand]:
+		return "avif"
+	case heifBrands[brand]:
+		return "heif"
+	}
+	return ""
+}
+
+// heifItems handles the items of a HEIF or AVIF meta box, whose children are boxes: its Exif
+// items, and its XMP packets, stored as items of the application/rdf+xml MIME type. Every item is
+// handled, not only those describing the primary image, as bursts, image sequences and the stills
+// of Live Photos hold an image item, and possibly an Exif item, per frame. Items are blanked in
+// place, or edited in place if the options edit EXIF data, as their offsets are recorded in the
+// iloc box.
+func (m *mp4Sanitizer) heifItems(boxes []bmff.Box) error {
+	iinf, iloc := bmff.Find(boxes, "iinf"), bmff.Find(boxes, "iloc")
+	if iinf == nil || iloc == nil {
+		return nil
+	}
+
+	items, err := bmff.Items(m.raw, *iinf)
+	if err != nil {
+		return err
+	}
+	types := make(map[uint32]string)
+	for _, item := range items {
+		switch {
+		case item.Type == "Exif":
+			types[item.ID] = "Exif"
+		case item.Type == "mime" && item.ContentType == "application/rdf+xml":
+			types[item.ID] = "xmp"
+		}
+	}
+	idat := bmff.Find(boxes, "idat")
+	extents, err := bmff.ItemLocations(m.raw, *iloc, idat)
+	if err != nil {
+		return err
+	}
+	// Items are blanked in place, so those not held by the media data could blank the boxes of
+	// the file itself.
+	stores, err := bmff.ReadBoxes(m.raw, 0, len(m.raw))
+	if err != nil {
+		return err
+	}
+	if idat != nil {
+		stores = append(stores, *idat)
+	}
+	for id := range types {
+		for _, e := range extents[id] {
+			if !inMediaData(stores, e) {
+				return malformed("item %d lies outside the media data", id)
+			}
+		}
+	}
+	described := make(map[uint32]uint32)
+	if iref := bmff.Find(boxes, "iref"); iref != nil {
+		for from, to := range bmff.ItemReferences(m.raw, *iref, "cdsc") {
+			described[from] = to[0]
+		}
+	}
+	primary := uint32(0)
+	if pitm := bmff.Find(boxes, "pitm"); pitm != nil {
+		primary = bmff.PrimaryItem(m.raw, *pitm)
+	}
+
+	// The Exif item describing the primary image is summarized rather than that of any frame.
+	ids := make([]uint32, 0, len(types))
+	for id := range types {
+		ids = append(ids, id)
+	}
+	sortItems(ids, func(id uint32) bool { return described[id] == primary })
+
+	for _, id := range ids {
+		if isBlankItem(m.raw, extents[id]) {
+			// Blanked already, such as by an earlier sanitization.
+			continue
+		}
+		data := m.itemData(extents[id])
+		switch types[id] {
+		case "Exif":
+			m.logf("Handling the Exif item %d describing item %d", id, described[id])
+			m.exifItem(data)
+		case "xmp":
+			m.logf("Removing the XMP item %d describing item %d", id, described[id])
+			for _, part := range data {
+				zero(part)
+				m.report.BytesRemoved += len(part)
+			}
+			m.report.MetadataRemoved = true
+		}
+	}
+	return nil
+}
+
+// sortItems moves the items for which first returns true to the front of ids, keeping the order
+// of the others by item ID.
+func sortItems(ids []uint32, first func(uint32) bool) {
+	for i := 1; i < len(ids); i++ {
+		for j := i; j > 0; j-- {
+			a, b := ids[j-1], ids[j]
+			if (first(b) && !first(a)) || (first(a) == first(b) && b < a) {
+				ids[j-1], ids[j] = b, a
+			}
+		}
+	}
+}
+
+// exifItem applies the options to the data of an Exif item, which starts with the offset of its
+// TIFF header after the offset itself, usually past an APP1 identifier. The EXIF data is edited in
+// place, or blanked.
+func (m *mp4Sanitizer) exifItem(data [][]byte) {
+	if len(data) == 1 && len(data[0]) >= 4 {
+		item := data[0]
+		offset := uint64(binary.BigEndian.Uint32(item)) + 4
+		if offset <= uint64(len(item)) {
+			tiff := item[offset:]
+			if edited := sanitizeTIFF(tiff, m.opts, m.report); edited != nil {
+				copy(tiff, edited)
+				return
+			}
+			zero(item)
+			m.report.BytesRemoved += len(item)
+			return
+		}
+	}
+	// Exif items split into several extents, or that cannot be read, are blanked.
+	for _, part := range data {
+		zero(part)
+		m.report.BytesRemoved += len(part)
+	}
+	m.report.ExifRemoved = true
+}
+
+// inMediaData reports whether the extent e lies within the payload of one of the mdat or idat
+// boxes of stores.
+func inMediaData(stores []bmff.Box, e bmff.Extent) bool {
+	for _, b := range stores {
+		if (b.Type == "mdat" || b.Type == "idat") && e.Start >= b.Payload && e.End <= b.End {
+			return true
+		}
+	}
+	return false
+}
+
+// isBlankItem reports whether the item stored in the given extents of raw holds only zeros.
+func isBlankItem(raw []byte, extents []bmff.Extent) bool {
+	for _, e := range extents {
+		for _, c := range raw[e.Start:e.End] {
+			if c != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// itemData returns the parts of the file holding an item, to edit. They are all requested once
+// before being returned, so that extents overlapping each other are merged first.
+func (m *mp4Sanitizer) itemData(extents []bmff.Extent) [][]byte {
+	for _, e := range extents {
+		m.edits.writable(e.Start, e.End)
+	}
+	var data [][]byte
+	for _, e := range extents {
+		data = append(data, m.edits.writable(e.Start, e.End))
+	}
+	return data
+}
@@ -0,0 +1,131 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// infeOf returns a version 2 item information entry of the given item ID and type, followed by
+// the given name and content type for MIME items.
+func infeOf(id uint16, itemType string, mime ...string) []byte {
+	entry := binary.BigEndian.AppendUint16([]byte{2, 0, 0, 0}, id)
+	entry = append(append(entry, 0, 0), itemType...)
+	for _, field := range mime {
+		entry = append(append(entry, field...), 0)
+	}
+	return mp4BoxOf("infe", entry)
+}
+
+// heifBurst returns a HEIF image of two frames, items 1 and 2, each described by an Exif item,
+// items 3 and 4, and an XMP item, item 5, describing the primary frame. Item 4 is stored in the
+// idat box of the meta box, the others in the mdat box.
+func heifBurst(exif, xmp []byte) []byte {
+	ftyp := mp4BoxOf("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+	exifItem := append(binary.BigEndian.AppendUint32(nil, 6), exif...)
+	frames := []byte("frame one frame two")
+
+	meta := func(mdat int) []byte {
+		iinf := mp4BoxOf("iinf", append([]byte{0, 0, 0, 0, 0, 5}, bytes.Join([][]byte{
+			infeOf(1, "hvc1"), infeOf(2, "hvc1"), infeOf(3, "Exif"), infeOf(4, "Exif"),
+			infeOf(5, "mime", "XMP", "application/rdf+xml"),
+		}, nil)...))
+		iref := mp4BoxOf("iref", append([]byte{0, 0, 0, 0}, bytes.Join([][]byte{
+			mp4BoxOf("cdsc", []byte{0, 3, 0, 1, 0, 1}),
+			mp4BoxOf("cdsc", []byte{0, 4, 0, 1, 0, 2}),
+			mp4BoxOf("cdsc", []byte{0, 5, 0, 1, 0, 1}),
+		}, nil)...))
+		// Version 1 locations, with 4 byte offsets and lengths and no base offsets.
+		iloc := []byte{1, 0, 0, 0, 0x44, 0x00, 0, 5}
+		location := func(id, method uint16, offset, length int) {
+			iloc = binary.BigEndian.AppendUint16(iloc, id)
+			iloc = binary.BigEndian.AppendUint16(iloc, method)
+			iloc = append(iloc, 0, 0, 0, 1)
+			iloc = binary.BigEndian.AppendUint32(iloc, uint32(offset))
+			iloc = binary.BigEndian.AppendUint32(iloc, uint32(length))
+		}
+		location(1, 0, mdat, 9)
+		location(2, 0, mdat+10, 9)
+		location(3, 0, mdat+len(frames), len(exifItem))
+		location(4, 1, 0, len(exifItem))
+		location(5, 0, mdat+len(frames)+len(exifItem), len(xmp))
+		return mp4BoxOf("meta", []byte{0, 0, 0, 0},
+			mp4BoxOf("hdlr", []byte("\x00\x00\x00\x00\x00\x00\x00\x00pict\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")),
+			mp4BoxOf("pitm", []byte{0, 0, 0, 0, 0, 1}),
+			iinf, iref, mp4BoxOf("iloc", iloc), mp4BoxOf("idat", exifItem))
+	}
+	mdat := len(ftyp) + len(meta(0)) + 8
+	return bytes.Join([][]byte{ftyp, meta(mdat), mp4BoxOf("mdat", bytes.Join([][]byte{frames, exifItem, xmp}, nil))}, nil)
+}
+
+func TestSanitizeHEIFBurst(t *testing.T) {
+	exif := exifSegment[4:]
+	xmp := []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/">Secret</x:xmpmeta>`)
+	input := heifBurst(exif, xmp)
+
+	output := new(bytes.Buffer)
+	report, err := Sanitize(bytes.NewReader(input), output)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	blank := make([]byte, 4+len(exif))
+	expected := heifBurst(blank[4:], make([]byte, len(xmp)))
+	expected = bytes.ReplaceAll(expected, append(binary.BigEndian.AppendUint32(nil, 6), blank[4:]...), blank)
+	if !bytes.Equal(expected, output.Bytes()) {
+		t.Errorf("expected result to be: %q instead got: %q", expected, output.Bytes())
+	}
+	if bytes.Count(output.Bytes(), []byte("frame")) != 2 {
+		t.Errorf("expected the frames to be kept")
+	}
+	if report.Format != "heic" || !report.ExifRemoved || !report.MetadataRemoved {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if report.BytesRemoved != 2*len(blank)+len(xmp) {
+		t.Errorf("expected %d bytes removed, got %d", 2*len(blank)+len(xmp), report.BytesRemoved)
+	}
+	if Detect(input) != "heic" {
+		t.Errorf("expected heic to be detected, got %q", Detect(input))
+	}
+
+	// The EXIF data of every frame is edited in place by options keeping it.
+	output.Reset()
+	report, err = Sanitize(bytes.NewReader(input), output, WithTimestampPolicy(TimestampsRemove))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bytes.Count(output.Bytes(), exif) != 2 || !report.ExifEdited || report.ExifRemoved {
+		t.Errorf("expected the EXIF data of both frames to be kept: %+v", report)
+	}
+	if bytes.Contains(output.Bytes(), []byte("Secret")) {
+		t.Errorf("expected the XMP item to be removed")
+	}
+}
+
+func TestSanitizeAVIF(t *testing.T) {
+	input := heifBurst(exifSegment[4:], []byte("<x:xmpmeta>Secret</x:xmpmeta>"))
+	copy(input[8:], "avif")
+
+	output := new(bytes.Buffer)
+	report, err := Sanitize(bytes.NewReader(input), output)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Format != "avif" || !report.ExifRemoved || bytes.Contains(output.Bytes(), []byte("Secret")) {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if Detect(input) != "avif" {
+		t.Errorf("expected avif to be detected, got %q", Detect(input))
+	}
+}
+
+func TestSanitizeHEIFErrors(t *testing.T) {
+	input := heifBurst(exifSegment[4:], []byte("<x:xmpmeta/>"))
+	// Point the XMP item past the end of the file.
+	iloc := bytes.Index(input, []byte("iloc"))
+	last := iloc + 4 + 8 + 4*16
+	binary.BigEndian.PutUint32(input[last+8:], uint32(len(input)))
+
+	if _, err := Sanitize(bytes.NewReader(input), new(bytes.Buffer)); err == nil {
+		t.Errorf("expected an error")
+	}
+}
@@ -0,0 +1,149 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// ICCPolicy controls what Sanitize does with embedded ICC color profiles. Besides the color
+// space, profiles may name the device or display they were calibrated for.
+type ICCPolicy int
+
+const (
+	// ICCPreserve keeps ICC profiles. It is the default.
+	ICCPreserve ICCPolicy = iota
+
+	// ICCStrip removes ICC profiles.
+	ICCStrip
+
+	// ICCReplaceWithSRGB removes ICC profiles and embeds a minimal standard sRGB profile in
+	// their place, so that strict color-managed viewers do not guess another color space.
+	ICCReplaceWithSRGB
+)
+
+// String returns the name of the policy as used in configuration files and flags.
+func (p ICCPolicy) String() string {
+	switch p {
+	case ICCPreserve:
+		return "preserve"
+	case ICCStrip:
+		return "strip"
+	case ICCReplaceWithSRGB:
+		return "replace-with-srgb"
+	}
+	return "unknown"
+}
+
+// ParseICCPolicy returns the policy with the given name: preserve, strip or replace-with-srgb.
+func ParseICCPolicy(name string) (ICCPolicy, bool) {
+	for _, policy := range []ICCPolicy{ICCPreserve, ICCStrip, ICCReplaceWithSRGB} {
+		if policy.String() == name {
+			return policy, true
+		}
+	}
+	return ICCPreserve, false
+}
+
+// WithICCPolicy sets what Sanitize does with ICC profiles. They are preserved by default.
+func WithICCPolicy(policy ICCPolicy) Option {
+	return func(o *options) {
+		o.icc = policy
+	}
+}
+
+// APP2 marker, holding ICC profiles split in chunks.
+const app2Marker = 0xE2
+
+// The identifier of APP2 segments holding an ICC profile chunk.
+var iccIdent = []byte("ICC_PROFILE\x00")
+
+// isICCProfile reports whether s is an APP2 segment holding a chunk of an ICC profile.
+func isICCProfile(raw []byte, s segment) bool {
+	return s.marker == app2Marker && bytes.HasPrefix(s.payload(raw), iccIdent)
+}
+
+// srgbSegment is an APP2 segment holding srgbProfile as its single chunk.
+var srgbSegment = func() []byte {
+	profile := srgbProfile()
+	segment := []byte{0xFF, app2Marker, 0x00, 0x00}
+	segment = append(segment, iccIdent...)
+	segment = append(segment, 0x01, 0x01) // Chunk one of one.
+	segment = append(segment, profile...)
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(segment)-2))
+	return segment
+}()
+
+// srgbProfile builds a minimal ICC version 2 display profile of the sRGB color space: the D50
+// adapted sRGB primaries and white point, and the sRGB tone curve sampled at 32 points.
+func srgbProfile() []byte {
+	s15Fixed16 := func(v float64) []byte {
+		return binary.BigEndian.AppendUint32(nil, uint32(int32(math.Round(v*65536))))
+	}
+	xyz := func(x, y, z float64) []byte {
+		data := []byte("XYZ \x00\x00\x00\x00")
+		return append(append(append(data, s15Fixed16(x)...), s15Fixed16(y)...), s15Fixed16(z)...)
+	}
+
+	description := []byte("desc\x00\x00\x00\x00")
+	description = binary.BigEndian.AppendUint32(description, uint32(len("sRGB")+1))
+	description = append(description, "sRGB\x00"...)
+	description = append(description, make([]byte, 4+4+2+1+67)...) // No Unicode or ScriptCode description.
+
+	curve := []byte("curv\x00\x00\x00\x00")
+	const points = 32
+	curve = binary.BigEndian.AppendUint32(curve, points)
+	for i := 0; i < points; i++ {
+		v := float64(i) / (points - 1)
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		curve = binary.BigEndian.AppendUint16(curve, uint16(math.Round(v*65535)))
+	}
+
+	tags := []struct {
+		signature string
+		data      []byte
+	}{
+		{"desc", description},
+		{"cprt", []byte("text\x00\x00\x00\x00No copyright, use freely\x00")},
+		{"wtpt", xyz(0.9642, 1.0, 0.8249)},
+		{"rXYZ", xyz(0.4361, 0.2225, 0.0139)},
+		{"gXYZ", xyz(0.3851, 0.7169, 0.0971)},
+		{"bXYZ", xyz(0.1431, 0.0606, 0.7141)},
+		{"rTRC", curve},
+		{"gTRC", curve},
+		{"bTRC", curve},
+	}
+
+	// Lay out the tag data after the header and tag table, sharing the data of identical tags.
+	const headerSize = 128
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	var data []byte
+	offsets := make(map[string]int)
+	for _, tag := range tags {
+		offset, ok := offsets[string(tag.data)]
+		if !ok {
+			for len(data)%4 != 0 {
+				data = append(data, 0x00)
+			}
+			offset = headerSize + 4 + len(tags)*12 + len(data)
+			offsets[string(tag.data)] = offset
+			data = append(data, tag.data...)
+		}
+		table = append(table, tag.signature...)
+		table = binary.BigEndian.AppendUint32(table, uint32(offset))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(tag.data)))
+	}
+
+	header := make([]byte, headerSize)
+	binary.BigEndian.PutUint32(header[0:], uint32(headerSize+len(table)+len(data)))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000) // Version 2.1.
+	copy(header[12:], "mntrRGB XYZ ")
+	copy(header[36:], "acsp")
+	copy(header[68:], xyz(0.9642, 1.0, 0.8249)[8:]) // The D50 illuminant of the PCS.
+
+	return append(append(header, table...), data...)
+}
@@ -0,0 +1,94 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// iccSegment returns an APP2 segment holding the given chunk of an ICC profile.
+func iccSegment(sequence, count byte, data []byte) []byte {
+	segment := []byte{0xFF, 0xE2, 0x00, 0x00}
+	segment = append(segment, iccIdent...)
+	segment = append(segment, sequence, count)
+	segment = append(segment, data...)
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(segment)-2))
+	return segment
+}
+
+func TestSRGBProfile(t *testing.T) {
+	profile := srgbProfile()
+	if int(binary.BigEndian.Uint32(profile)) != len(profile) {
+		t.Fatalf("expected the profile size %d to be recorded in its header", len(profile))
+	}
+	if string(profile[12:24]) != "mntrRGB XYZ " || string(profile[36:40]) != "acsp" {
+		t.Errorf("unexpected profile header: %x", profile[:128])
+	}
+	if len(srgbSegment) > 1024 {
+		t.Errorf("expected a tiny profile, got %d bytes", len(srgbSegment))
+	}
+
+	tags := make(map[string]bool)
+	count := int(binary.BigEndian.Uint32(profile[128:]))
+	for i := 0; i < count; i++ {
+		entry := profile[132+i*12:]
+		signature := string(entry[:4])
+		offset := binary.BigEndian.Uint32(entry[4:])
+		size := binary.BigEndian.Uint32(entry[8:])
+		if offset%4 != 0 || int(offset+size) > len(profile) {
+			t.Errorf("tag %s at offset %d with size %d is misplaced", signature, offset, size)
+		}
+		tags[signature] = true
+	}
+	for _, signature := range []string{"desc", "cprt", "wtpt", "rXYZ", "gXYZ", "bXYZ", "rTRC", "gTRC", "bTRC"} {
+		if !tags[signature] {
+			t.Errorf("expected the profile to have a %s tag", signature)
+		}
+	}
+}
+
+func TestSanitizeICC(t *testing.T) {
+	wideGamut := []byte("Display P3 profile")
+	input := jpegOf(exifSegment, iccSegment(1, 2, wideGamut[:8]), iccSegment(2, 2, wideGamut[8:]), xmpSegment)
+
+	testTable := []struct {
+		Name    string
+		Policy  ICCPolicy
+		Output  []byte
+		Removed bool
+		Added   bool
+	}{
+		{
+			Name:   "preserve",
+			Policy: ICCPreserve,
+			Output: jpegOf(iccSegment(1, 2, wideGamut[:8]), iccSegment(2, 2, wideGamut[8:]), xmpSegment),
+		},
+		{Name: "strip", Policy: ICCStrip, Output: jpegOf(xmpSegment), Removed: true},
+		{Name: "replace", Policy: ICCReplaceWithSRGB, Output: jpegOf(srgbSegment, xmpSegment), Removed: true, Added: true},
+	}
+
+	for _, test := range testTable {
+		output := new(bytes.Buffer)
+		report, err := Sanitize(bytes.NewReader(input), output, WithICCPolicy(test.Policy))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if !bytes.Equal(test.Output, output.Bytes()) {
+			t.Errorf("%s: expected result to be: %x instead got: %x", test.Name, test.Output, output.Bytes())
+		}
+		if report.ICCRemoved != test.Removed || report.SRGBAdded != test.Added {
+			t.Errorf("%s: unexpected report: %+v", test.Name, report)
+		}
+	}
+
+	// Images without a profile are left untagged.
+	output := new(bytes.Buffer)
+	report, err := Sanitize(bytes.NewReader(jpegOf(exifSegment)), output, WithICCPolicy(ICCReplaceWithSRGB))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.SRGBAdded || !bytes.Equal(jpegOf(), output.Bytes()) {
+		t.Errorf("expected no profile to be added, got %x", output.Bytes())
+	}
+}
@@ -0,0 +1,258 @@
+package exif
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif/jpegseg"
+)
+
+// ErrMalformed is wrapped by the errors of EXIF data and TIFF images whose structure cannot be
+// followed, such as IFDs lying outside the data or pointing back to themselves, and of JPEG images
+// whose segments cannot be read, with the details of what is wrong.
+var ErrMalformed = jpegseg.ErrMalformed
+
+// ErrTruncated is wrapped by the errors of JPEG images ending in the middle of their segments,
+// such as images whose segments declare lengths running past their end.
+var ErrTruncated = jpegseg.ErrTruncated
+
+// malformed returns an error wrapping ErrMalformed with the given details.
+func malformed(format string, v ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrMalformed, fmt.Sprintf(format, v...))
+}
+
+// maxIFDs bounds the IFDs read from EXIF data, which has at most five kinds of them, so that
+// crafted data pointing to many IFDs cannot make reading it slow.
+const maxIFDs = 16
+
+// Tags pointing to the sub-IFDs of the EXIF data.
+const (
+	exifIFDPointer    = 0x8769
+	gpsIFDPointer     = 0x8825
+	interopIFDPointer = 0xA005
+)
+
+// The size in bytes of a single value of each TIFF type.
+var typeSizes = map[uint16]int{
+	1:   1, // BYTE
+	2:   1, // ASCII
+	3:   2, // SHORT
+	4:   4, // LONG
+	5:   8, // RATIONAL
+	6:   1, // SBYTE
+	7:   1, // UNDEFINED
+	8:   2, // SSHORT
+	9:   4, // SLONG
+	10:  8, // SRATIONAL
+	11:  4, // FLOAT
+	12:  8, // DOUBLE
+	129: 1, // UTF-8, added by EXIF 3.0 for strings such as ImageDescription and Artist
+}
+
+// ifdKind identifies the directory an IFD entry belongs to, as tag numbers are only unique
+// within a directory.
+type ifdKind int
+
+const (
+	ifd0 ifdKind = iota
+	ifd1
+	exifIFD
+	gpsIFD
+	interopIFD
+)
+
+// tiffData is the TIFF structure holding the EXIF data of an APP1 segment. Offsets within it are
+// relative to the start of its header.
+type tiffData struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// ifdEntry is a single tag of an IFD.
+type ifdEntry struct {
+	// offset is where the entry starts in the TIFF data.
+	offset int
+	tag    uint16
+	typ    uint16
+	count  uint32
+}
+
+// ifd is an image file directory: a list of entries followed by the offset of the next IFD.
+type ifd struct {
+	kind    ifdKind
+	offset  int
+	entries []ifdEntry
+}
+
+// parseTIFF parses the TIFF header at the start of data.
+func parseTIFF(data []byte) (*tiffData, error) {
+	if len(data) < 8 {
+		return nil, malformed("the TIFF header is truncated")
+	}
+
+	t := &tiffData{data: data}
+	switch string(data[:byteOrderSize]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, malformed("could not read byte order from tiff header")
+	}
+	if t.order.Uint16(data[2:]) != 42 {
+		return nil, malformed("an error occurred while attempting to find TIFF header")
+	}
+	return t, nil
+}
+
+// readIFD reads the IFD at offset and returns it with the offset of the next IFD.
+func (t *tiffData) readIFD(kind ifdKind, offset int) (*ifd, int, error) {
+	if offset < 8 || offset+tagCountLenSize > len(t.data) {
+		return nil, 0, malformed("the IFD offset %d is out of bounds", offset)
+	}
+
+	tagCount := int(t.order.Uint16(t.data[offset:]))
+	end := offset + tagCountLenSize + tagCount*tagSize
+	if end+ifdOffsetSize > len(t.data) {
+		return nil, 0, malformed("the IFD at offset %d with %d tags exceeds the EXIF data", offset, tagCount)
+	}
+
+	dir := &ifd{kind: kind, offset: offset}
+	for i := offset + tagCountLenSize; i < end; i += tagSize {
+		dir.entries = append(dir.entries, ifdEntry{
+			offset: i,
+			tag:    t.order.Uint16(t.data[i:]),
+			typ:    t.order.Uint16(t.data[i+2:]),
+			count:  t.order.Uint32(t.data[i+4:]),
+		})
+	}
+	return dir, int(t.order.Uint32(t.data[end:])), nil
+}
+
+// ifds returns IFD0 and IFD1, and the EXIF, GPS and interoperability IFDs they point to.
+func (t *tiffData) ifds() ([]*ifd, error) {
+	first, next, err := t.readIFD(ifd0, int(t.order.Uint32(t.data[4:])))
+	if err != nil {
+		return nil, err
+	}
+	dirs := []*ifd{first}
+	visited := map[int]bool{first.offset: true}
+	if next != 0 {
+		if next == first.offset {
+			return nil, malformed("the next IFD offset of IFD0 points back to it")
+		}
+		second, _, err := t.readIFD(ifd1, next)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, second)
+		visited[next] = true
+	}
+
+	pointers := map[uint16]ifdKind{exifIFDPointer: exifIFD, gpsIFDPointer: gpsIFD, interopIFDPointer: interopIFD}
+	for i := 0; i < len(dirs); i++ {
+		for _, entry := range dirs[i].entries {
+			// The interoperability IFD hangs off the EXIF IFD, the others off IFD0.
+			kind, ok := pointers[entry.tag]
+			if !ok || (kind == interopIFD) != (dirs[i].kind == exifIFD) {
+				continue
+			}
+			offset := int(t.order.Uint32(t.data[entry.offset+8:]))
+			if visited[offset] {
+				continue
+			}
+			visited[offset] = true
+			if len(dirs) == maxIFDs {
+				return nil, malformed("the EXIF data points to more than %d IFDs", maxIFDs)
+			}
+
+			sub, _, err := t.readIFD(kind, offset)
+			if err != nil {
+				return nil, err
+			}
+			dirs = append(dirs, sub)
+		}
+	}
+	return dirs, nil
+}
+
+// value returns the value of entry, which is stored in the entry itself when it fits in four
+// bytes, or else at the offset the entry holds.
+func (t *tiffData) value(entry ifdEntry) ([]byte, error) {
+	size, ok := typeSizes[entry.typ]
+	if !ok {
+		return nil, fmt.Errorf("tag 0x%04x has unknown type %d", entry.tag, entry.typ)
+	}
+	length := uint64(size) * uint64(entry.count)
+	if length <= ifdOffsetSize {
+		return t.data[entry.offset+8 : entry.offset+8+int(length)], nil
+	}
+
+	offset := uint64(t.order.Uint32(t.data[entry.offset+8:]))
+	if offset+length > uint64(len(t.data)) {
+		return nil, malformed("the value of tag 0x%04x is out of bounds", entry.tag)
+	}
+	return t.data[offset : offset+length], nil
+}
+
+// removeEntries removes the entries of dir for which remove returns true, blanking their values
+// and compacting the remaining entries, so that the EXIF data keeps its size and layout. It
+// returns the number of entries removed.
+func (t *tiffData) removeEntries(dir *ifd, remove func(ifdEntry) bool) int {
+	var kept []ifdEntry
+	var removed []ifdEntry
+	for _, entry := range dir.entries {
+		if remove(entry) {
+			removed = append(removed, entry)
+		} else {
+			kept = append(kept, entry)
+		}
+	}
+	if len(removed) == 0 {
+		return 0
+	}
+
+	for _, entry := range removed {
+		if value, err := t.value(entry); err == nil {
+			zero(value)
+		}
+	}
+
+	// Move the kept entries and the next IFD offset up, and blank the freed space at the end.
+	start := dir.offset + tagCountLenSize
+	end := start + len(dir.entries)*tagSize
+	next := make([]byte, ifdOffsetSize)
+	copy(next, t.data[end:])
+
+	compacted := make([]byte, 0, end+ifdOffsetSize-start)
+	for i := range kept {
+		compacted = append(compacted, t.data[kept[i].offset:kept[i].offset+tagSize]...)
+		kept[i].offset = start + i*tagSize
+	}
+	compacted = append(compacted, next...)
+	zero(t.data[start : end+ifdOffsetSize])
+	copy(t.data[start:], compacted)
+	t.order.PutUint16(t.data[dir.offset:], uint16(len(kept)))
+
+	dir.entries = kept
+	return len(removed)
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// ascii returns the value of an ASCII or UTF-8 entry without its terminating NUL and padding.
+func (t *tiffData) ascii(entry ifdEntry) (string, error) {
+	if entry.typ != 2 && entry.typ != 129 {
+		return "", fmt.Errorf("tag 0x%04x is not a string", entry.tag)
+	}
+	value, err := t.value(entry)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(value), "\x00 "), nil
+}
@@ -0,0 +1,332 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// testTag is a tag of a test IFD with its raw value.
+type testTag struct {
+	Tag   uint16
+	Type  uint16
+	Value []byte
+}
+
+func asciiTag(tag uint16, value string) testTag {
+	return testTag{Tag: tag, Type: 2, Value: append([]byte(value), 0x00)}
+}
+
+// exifSegmentOf returns a big endian EXIF APP1 segment with the given IFD0 tags and, if any, EXIF
+// and GPS IFDs holding the given tags.
+func exifSegmentOf(ifd0Tags, exifTags, gpsTags []testTag) []byte {
+	type dir struct {
+		kind ifdKind
+		tags []testTag
+	}
+	dirs := []dir{{ifd0, ifd0Tags}}
+	if exifTags != nil {
+		dirs[0].tags = append(dirs[0].tags, testTag{Tag: exifIFDPointer, Type: 4, Value: make([]byte, 4)})
+		dirs = append(dirs, dir{exifIFD, exifTags})
+	}
+	if gpsTags != nil {
+		dirs[0].tags = append(dirs[0].tags, testTag{Tag: gpsIFDPointer, Type: 4, Value: make([]byte, 4)})
+		dirs = append(dirs, dir{gpsIFD, gpsTags})
+	}
+
+	// Lay out the IFDs after the header, then the values that do not fit in their entries.
+	offsets := make(map[ifdKind]int)
+	offset := 8
+	for _, d := range dirs {
+		offsets[d.kind] = offset
+		offset += tagCountLenSize + len(d.tags)*tagSize + ifdOffsetSize
+	}
+	dataOffset := offset
+
+	tiff := []byte{'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08}
+	var data []byte
+	for _, d := range dirs {
+		tiff = binary.BigEndian.AppendUint16(tiff, uint16(len(d.tags)))
+		for _, tag := range d.tags {
+			value := tag.Value
+			switch tag.Tag {
+			case exifIFDPointer:
+				value = binary.BigEndian.AppendUint32(nil, uint32(offsets[exifIFD]))
+			case gpsIFDPointer:
+				value = binary.BigEndian.AppendUint32(nil, uint32(offsets[gpsIFD]))
+			}
+
+			tiff = binary.BigEndian.AppendUint16(tiff, tag.Tag)
+			tiff = binary.BigEndian.AppendUint16(tiff, tag.Type)
+			tiff = binary.BigEndian.AppendUint32(tiff, uint32(len(value)/typeSizes[tag.Type]))
+			if len(value) <= 4 {
+				tiff = append(tiff, append(value, make([]byte, 4-len(value))...)...)
+			} else {
+				tiff = binary.BigEndian.AppendUint32(tiff, uint32(dataOffset+len(data)))
+				data = append(data, value...)
+			}
+		}
+		tiff = append(tiff, 0x00, 0x00, 0x00, 0x00)
+	}
+	tiff = append(tiff, data...)
+
+	segment := []byte{0xFF, 0xE1, 0x00, 0x00}
+	segment = append(segment, exifIdent...)
+	segment = append(segment, tiff...)
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(segment)-2))
+	return segment
+}
+
+// tagsOf returns the tags of the EXIF segment of the JPEG image raw, by IFD, with their values.
+func tagsOf(t *testing.T, raw []byte) map[ifdKind]map[uint16][]byte {
+	segments, err := readSegments(raw)
+	if err != nil {
+		t.Fatalf("failed to read segments: %v", err)
+	}
+	for _, s := range segments {
+		if s.marker != appMarker || !bytes.HasPrefix(s.payload(raw), exifIdent) {
+			continue
+		}
+		tiff, err := parseTIFF(s.payload(raw)[len(exifIdent):])
+		if err != nil {
+			t.Fatalf("failed to parse the EXIF data: %v", err)
+		}
+		dirs, err := tiff.ifds()
+		if err != nil {
+			t.Fatalf("failed to read the IFDs: %v", err)
+		}
+
+		tags := make(map[ifdKind]map[uint16][]byte)
+		for _, dir := range dirs {
+			tags[dir.kind] = make(map[uint16][]byte)
+			for _, entry := range dir.entries {
+				value, err := tiff.value(entry)
+				if err != nil {
+					t.Fatalf("failed to read tag 0x%04x: %v", entry.tag, err)
+				}
+				tags[dir.kind][entry.tag] = value
+			}
+		}
+		return tags
+	}
+	t.Fatalf("no EXIF segment found")
+	return nil
+}
+
+func TestSanitizeTimestamps(t *testing.T) {
+	gpsTime := make([]byte, 24)
+	for i, v := range []uint32{13, 1, 45, 1, 30, 1} {
+		binary.BigEndian.PutUint32(gpsTime[i*4:], v)
+	}
+	input := jpegOf(exifSegmentOf(
+		[]testTag{asciiTag(0x010F, "Canon"), asciiTag(tagDateTime, "2024:03:02 13:45:30")},
+		[]testTag{asciiTag(tagDateTimeOriginal, "2024:03:02 13:45:30"), asciiTag(tagSubSecTimeOriginal, "123")},
+		[]testTag{{Tag: tagGPSTimeStamp, Type: 5, Value: gpsTime}, asciiTag(tagGPSDateStamp, "2024:03:02")},
+	))
+
+	t.Run("remove", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		report, err := Sanitize(bytes.NewReader(input), output, WithTimestampPolicy(TimestampsRemove))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !report.ExifEdited || report.ExifRemoved || report.TagsEdited != 5 {
+			t.Errorf("unexpected report: %+v", report)
+		}
+		if output.Len() != len(input) {
+			t.Errorf("expected the image size to be unchanged, got %d bytes instead of %d", output.Len(), len(input))
+		}
+
+		tags := tagsOf(t, output.Bytes())
+		if len(tags[ifd0]) != 3 || len(tags[exifIFD]) != 0 || len(tags[gpsIFD]) != 0 {
+			t.Errorf("unexpected tags left: %v", tags)
+		}
+		if !bytes.Equal(tags[ifd0][0x010F], []byte("Canon\x00")) {
+			t.Errorf("expected Make to be kept, got %q", tags[ifd0][0x010F])
+		}
+		if bytes.Contains(output.Bytes(), []byte("2024")) {
+			t.Errorf("expected the removed values to be blanked")
+		}
+	})
+
+	t.Run("round to day", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		report, err := Sanitize(bytes.NewReader(input), output, WithTimestampPolicy(TimestampsRoundToDay))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !report.ExifEdited || report.TagsEdited != 4 {
+			t.Errorf("unexpected report: %+v", report)
+		}
+
+		tags := tagsOf(t, output.Bytes())
+		for _, value := range [][]byte{tags[ifd0][tagDateTime], tags[exifIFD][tagDateTimeOriginal]} {
+			if string(value) != "2024:03:02 00:00:00\x00" {
+				t.Errorf("expected the time to be rounded, got %q", value)
+			}
+		}
+		if _, ok := tags[exifIFD][tagSubSecTimeOriginal]; ok {
+			t.Errorf("expected SubSecTimeOriginal to be removed")
+		}
+		if string(tags[gpsIFD][tagGPSDateStamp]) != "2024:03:02\x00" {
+			t.Errorf("expected the GPS date to be kept, got %q", tags[gpsIFD][tagGPSDateStamp])
+		}
+		for i := 0; i < 24; i += 8 {
+			if binary.BigEndian.Uint32(tags[gpsIFD][tagGPSTimeStamp][i:]) != 0 {
+				t.Errorf("expected the GPS time to be zeroed, got %x", tags[gpsIFD][tagGPSTimeStamp])
+			}
+		}
+	})
+
+	t.Run("unparseable", func(t *testing.T) {
+		broken := append([]byte{0xFF, 0xE1, 0x00, 0x0C}, append(append([]byte{}, exifIdent...), 'X', 'X', 0x00, 0x00)...)
+		output := new(bytes.Buffer)
+		report, err := Sanitize(bytes.NewReader(jpegOf(broken)), output, WithTimestampPolicy(TimestampsRemove))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if report.ExifEdited || !report.ExifRemoved || !bytes.Equal(jpegOf(), output.Bytes()) {
+			t.Errorf("expected EXIF data that cannot be edited to be removed, got %+v", report)
+		}
+	})
+}
+
+func TestSanitizeDeviceFingerprint(t *testing.T) {
+	input := jpegOf(exifSegmentOf(
+		[]testTag{asciiTag(0x010F, "Canon"), asciiTag(0x0110, "EOS R5")},
+		[]testTag{
+			asciiTag(tagBodySerialNumber, "012345678901"),
+			asciiTag(tagLensSerialNumber, "9876543210"),
+			asciiTag(tagCameraOwnerName, "Jane Doe"),
+			asciiTag(tagImageUniqueID, "0123456789abcdef0123456789abcdef"),
+			{Tag: tagMakerNote, Type: 7, Value: []byte("Canon\x00SERIAL42")},
+			{Tag: 0x829A, Type: 5, Value: []byte{0, 0, 0, 1, 0, 0, 0, 250}},
+		},
+		nil,
+	))
+
+	output := new(bytes.Buffer)
+	report, err := Sanitize(bytes.NewReader(input), output, WithDeviceFingerprintRemoval(), WithTimestampPolicy(TimestampsRemove))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !report.ExifEdited || report.TagsEdited != 5 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	tags := tagsOf(t, output.Bytes())
+	if len(tags[exifIFD]) != 1 || tags[exifIFD][0x829A] == nil {
+		t.Errorf("expected only ExposureTime to be kept, got %v", tags[exifIFD])
+	}
+	if string(tags[ifd0][0x0110]) != "EOS R5\x00" {
+		t.Errorf("expected Model to be kept, got %q", tags[ifd0][0x0110])
+	}
+	for _, value := range []string{"012345678901", "9876543210", "Jane Doe", "0123456789abcdef", "SERIAL42"} {
+		if bytes.Contains(output.Bytes(), []byte(value)) {
+			t.Errorf("expected %q to be blanked", value)
+		}
+	}
+}
+
+func TestSanitizeUTF8Tags(t *testing.T) {
+	// Strings of the UTF-8 type EXIF 3.0 added, which older readers reject as of an unknown type.
+	input := jpegOf(exifSegmentOf(
+		[]testTag{{Tag: tagModel, Type: 129, Value: []byte("Caméra X\x00")}, {Tag: 0x013B, Type: 129, Value: []byte("Zoë Müller")}},
+		[]testTag{{Tag: tagCameraOwnerName, Type: 129, Value: []byte("Zoë Müller")}},
+		nil,
+	))
+
+	output := new(bytes.Buffer)
+	report, err := Sanitize(bytes.NewReader(input), output, WithDeviceFingerprintRemoval())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !report.ExifEdited || report.TagsEdited != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if report.Summary == nil || report.Summary.Model != "Caméra X" {
+		t.Errorf("expected the UTF-8 model to be summarized, got %+v", report.Summary)
+	}
+	if bytes.Count(output.Bytes(), []byte("Zoë Müller")) != 1 {
+		t.Errorf("expected the camera owner name to be blanked and the artist to be kept")
+	}
+}
+
+func TestSanitizeSummary(t *testing.T) {
+	testTable := []struct {
+		Name    string
+		Segment []byte
+		Summary string
+	}{
+		{
+			Name: "phone",
+			Segment: exifSegmentOf(
+				[]testTag{asciiTag(tagMake, "Apple"), asciiTag(tagModel, "iPhone 14 Pro"), asciiTag(tagDateTime, "2024:03:05 10:00:00")},
+				[]testTag{asciiTag(tagDateTimeOriginal, "2024:03:02 13:45:30")},
+				[]testTag{{Tag: tagGPSLatitude, Type: 5, Value: make([]byte, 24)}},
+			),
+			Summary: "iPhone 14 Pro, GPS: yes, taken 2024-03-02",
+		},
+		{
+			Name: "camera with lens",
+			Segment: exifSegmentOf(
+				[]testTag{asciiTag(tagMake, "Canon")},
+				[]testTag{asciiTag(tagLensModel, "EF50mm f/1.8 STM")},
+				nil,
+			),
+			Summary: "Canon, lens EF50mm f/1.8 STM, GPS: no",
+		},
+		{
+			Name: "exposure",
+			Segment: exifSegmentOf(
+				[]testTag{asciiTag(tagModel, "X100V")},
+				[]testTag{
+					{Tag: tagExposureTime, Type: 5, Value: []byte{0, 0, 0, 1, 0, 0, 0, 125}},
+					{Tag: tagFNumber, Type: 5, Value: []byte{0, 0, 0, 56, 0, 0, 0, 10}},
+					{Tag: tagISOSpeed, Type: 3, Value: []byte{0x01, 0x90}},
+				},
+				nil,
+			),
+			Summary: "X100V, 1/125s f/5.6 ISO 400, GPS: no",
+		},
+	}
+
+	for _, test := range testTable {
+		report, err := Sanitize(bytes.NewReader(jpegOf(test.Segment)), new(bytes.Buffer))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if report.Summary == nil || report.Summary.String() != test.Summary {
+			t.Errorf("%s: expected summary %q, got %v", test.Name, test.Summary, report.Summary)
+		}
+	}
+}
+
+func TestSanitizeDimensions(t *testing.T) {
+	frame := []byte{0xFF, 0xC0, 0x00, 0x0B, 0x08, 0x00, 0x10, 0x00, 0x20, 0x01, 0x01, 0x11, 0x00} // 32x16 pixels.
+	rotated := exifSegmentOf([]testTag{{Tag: tagOrientation, Type: 3, Value: []byte{0x00, 0x06}}}, nil, nil)
+
+	testTable := []struct {
+		Name          string
+		Input         []byte
+		Options       []Option
+		Width, Height int
+	}{
+		{Name: "no exif", Input: jpegOf(frame), Width: 32, Height: 16},
+		{Name: "orientation removed", Input: jpegOf(rotated, frame), Width: 32, Height: 16},
+		{Name: "orientation kept", Input: jpegOf(rotated, frame), Options: []Option{WithTimestampPolicy(TimestampsRemove)}, Width: 16, Height: 32},
+		{Name: "no frame header", Input: jpegOf(exifSegment)},
+	}
+
+	for _, test := range testTable {
+		report, err := Sanitize(bytes.NewReader(test.Input), new(bytes.Buffer), test.Options...)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if report.Width != test.Width || report.Height != test.Height {
+			t.Errorf("%s: expected %dx%d, got %dx%d", test.Name, test.Width, test.Height, report.Width, report.Height)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package exif
+
+// APP0 marker, holding the JFIF header.
+const app0Marker = 0xE0
+
+// jfifSegment is a minimal JFIF APP0 segment: version 1.01, a 1:1 pixel aspect ratio and no
+// thumbnail.
+var jfifSegment = []byte{
+	0xFF, 0xE0, // Markers.
+	0x00, 0x10, // Length of the segment, including the length field.
+	'J', 'F', 'I', 'F', 0x00, // JFIF identifier.
+	0x01, 0x01, // Version 1.01.
+	0x00,       // No density units, only the aspect ratio.
+	0x00, 0x01, // Horizontal density.
+	0x00, 0x01, // Vertical density.
+	0x00, 0x00, // No thumbnail.
+}
+
+// needsJFIF reports whether an image is left without any APP0 or APP1 header once the dropped
+// segments are removed. Images with an Adobe APP14 segment are excluded, as their color
+// transform may contradict the YCbCr color space implied by JFIF.
+func needsJFIF(raw []byte, segments []segment, drop map[int]bool) bool {
+	removedHeader := false
+	for _, s := range segments {
+		switch {
+		case isAdobeTransform(raw, s):
+			return false
+		case s.marker != app0Marker && s.marker != appMarker:
+			continue
+		case drop[s.start]:
+			removedHeader = true
+		default:
+			return false
+		}
+	}
+	return removedHeader
+}
@@ -0,0 +1,130 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif/bmff"
+)
+
+// jp2Signature is the signature box starting JPEG 2000 files, both JP2 and JPX.
+var jp2Signature = []byte{0x00, 0x00, 0x00, 0x0C, 'j', 'P', ' ', ' ', 0x0D, 0x0A, 0x87, 0x0A}
+
+// The identifiers of the uuid boxes of JPEG 2000 files holding metadata: EXIF data, as written by
+// ExifTool and camera raw converters, XMP packets, and IPTC records, as written by Photoshop.
+var (
+	jp2ExifUUID = []byte("JpgTiffExif->JP2")
+	jp2XMPUUID  = []byte{0xBE, 0x7A, 0xCF, 0xCB, 0x97, 0xA9, 0x42, 0xE8, 0x9C, 0x71, 0x99, 0x94, 0x91, 0xE3, 0xAF, 0xAC}
+	jp2IPTCUUID = []byte{0x33, 0xC7, 0xA4, 0xD2, 0xB8, 0x1D, 0x47, 0x23, 0xA0, 0xBA, 0xF1, 0xA3, 0xE0, 0x97, 0xAD, 0x38}
+)
+
+func isJP2(raw []byte) bool {
+	return bytes.HasPrefix(raw, jp2Signature)
+}
+
+// jp2Format returns jpx for JPEG 2000 files of the extended JPX format, as declared by the brand
+// of their file type box, and jp2 for the others.
+func jp2Format(raw []byte) string {
+	if len(raw) >= 24 && string(raw[16:20]) == "ftyp" && string(raw[20:24]) == "jpx " {
+		return "jpx"
+	}
+	return "jp2"
+}
+
+// sanitizeJP2 removes the XML boxes, which hold XMP packets and other metadata, and the uuid boxes
+// holding XMP packets and IPTC records from the JPEG 2000 image raw, and the uuid box holding
+// EXIF data, unless the options edit the EXIF data. The image header, color specification and
+// codestream are kept, and so are the uuid boxes of other vendors, such as the georeferencing of
+// GeoJP2 images. JPX files whose codestreams are split into fragments locate them by their offset
+// in the file, so their removed boxes are replaced with free boxes of the same size instead, and
+// their EXIF data is removed even if the options edit it.
+func sanitizeJP2(raw []byte, o *options) ([][]byte, *Report, error) {
+	report := &Report{Format: jp2Format(raw)}
+	if len(raw) < 20 || string(raw[16:20]) != "ftyp" {
+		return nil, nil, fmt.Errorf("the JPEG 2000 file type box is missing")
+	}
+	boxes, err := bmff.ReadBoxes(raw, 0, len(raw))
+	if err != nil {
+		return nil, nil, err
+	}
+	fragmented := false
+	for _, b := range boxes {
+		if b.Type == "ftbl" {
+			fragmented = true
+		}
+		if b.Type == "jp2h" && report.Width == 0 {
+			report.Width, report.Height = jp2Size(raw, b)
+		}
+	}
+
+	if fragmented && len(o.edits) > 0 {
+		// Edited EXIF data may not fit in the box it was read from.
+		unedited := *o
+		unedited.edits = nil
+		o = &unedited
+	}
+
+	var parts [][]byte
+	for _, b := range boxes {
+		payload := raw[b.Payload:b.End]
+		remove := false
+		switch {
+		case b.Type == "xml ":
+			remove = true
+		case b.Type == "uuid" && len(payload) >= 16:
+			switch uuid := payload[:16]; {
+			case bytes.Equal(uuid, jp2XMPUUID), bytes.Equal(uuid, jp2IPTCUUID):
+				remove = true
+			case bytes.Equal(uuid, jp2ExifUUID):
+				// Some writers keep the APP1 identifier of JPEG images before the TIFF structure.
+				data := payload[16:]
+				header := []byte{}
+				if bytes.HasPrefix(data, exifIdent) {
+					header = exifIdent
+				}
+				edited := sanitizeTIFF(data[len(header):], o, report)
+				if edited == nil {
+					o.logf("Removing the EXIF uuid box at offset %d", b.Start)
+					report.BytesRemoved += b.Size()
+					if fragmented {
+						parts = append(parts, bmff.Free(b.End-b.Start))
+					}
+					continue
+				}
+				box := bmff.Append(nil, "uuid", jp2ExifUUID, header, edited)
+				report.BytesRemoved += (b.Size()) - len(box)
+				parts = append(parts, box)
+				continue
+			}
+		}
+		if !remove {
+			parts = append(parts, raw[b.Start:b.End])
+			continue
+		}
+		o.logf("Removing the %q box at offset %d", b.Type, b.Start)
+		report.MetadataRemoved = true
+		report.BytesRemoved += b.Size()
+		if fragmented {
+			parts = append(parts, bmff.Free(b.End-b.Start))
+		}
+	}
+	return parts, report, nil
+}
+
+// jp2Size returns the size of the image recorded in the image header box of the JP2 header box b,
+// or zeros if it cannot be read.
+func jp2Size(raw []byte, b bmff.Box) (int, int) {
+	children, err := bmff.ReadBoxes(raw, b.Payload, b.End)
+	if err != nil {
+		return 0, 0
+	}
+	for _, child := range children {
+		if child.Type == "ihdr" && child.End-child.Payload >= 8 {
+			height := binary.BigEndian.Uint32(raw[child.Payload:])
+			width := binary.BigEndian.Uint32(raw[child.Payload+4:])
+			return int(width), int(height)
+		}
+	}
+	return 0, 0
+}
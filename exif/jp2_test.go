@@ -0,0 +1,119 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif/bmff"
+)
+
+// jp2Of returns a JPEG 2000 file of the given brand, with a one by two pixel image header, the
+// given boxes and a codestream.
+func jp2Of(brand string, boxes ...[]byte) []byte {
+	ihdr := binary.BigEndian.AppendUint32(nil, 2)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, 1)
+	ihdr = append(ihdr, 0, 3, 7, 7, 0, 0)
+	file := append(append([]byte{}, jp2Signature...), mp4BoxOf("ftyp", []byte(brand+"\x00\x00\x00\x00"+brand))...)
+	file = append(file, mp4BoxOf("jp2h", mp4BoxOf("ihdr", ihdr), mp4BoxOf("colr", []byte{1, 0, 0, 0, 0, 0, 0x10}))...)
+	for _, box := range boxes {
+		file = append(file, box...)
+	}
+	return append(file, mp4BoxOf("jp2c", []byte("\xFF\x4Fcodestream\xFF\xD9"))...)
+}
+
+func TestSanitizeJP2(t *testing.T) {
+	exifBox := mp4BoxOf("uuid", append(append([]byte{}, jp2ExifUUID...), exifSegment[10:]...))
+	xmpBox := mp4BoxOf("uuid", append(append([]byte{}, jp2XMPUUID...), "<x:xmpmeta>Secret</x:xmpmeta>"...))
+	xmlBox := mp4BoxOf("xml ", []byte("<scanner>Secret</scanner>"))
+	geoBox := mp4BoxOf("uuid", append(make([]byte, 16), "GeoTIFF"...))
+	fragments := mp4BoxOf("ftbl", mp4BoxOf("flst", make([]byte, 16)))
+
+	testTable := []struct {
+		Name     string
+		Input    []byte
+		Options  []Option
+		Output   []byte
+		Format   string
+		Exif     bool
+		Edited   bool
+		Metadata bool
+	}{
+		{
+			Name:     "jp2",
+			Input:    jp2Of("jp2 ", exifBox, xmpBox, xmlBox, geoBox),
+			Output:   jp2Of("jp2 ", geoBox),
+			Format:   "jp2",
+			Exif:     true,
+			Metadata: true,
+		},
+		{
+			Name:     "jpx",
+			Input:    jp2Of("jpx ", xmlBox),
+			Output:   jp2Of("jpx "),
+			Format:   "jpx",
+			Metadata: true,
+		},
+		{
+			Name:    "exif kept",
+			Input:   jp2Of("jp2 ", exifBox),
+			Options: []Option{WithTimestampPolicy(TimestampsRemove)},
+			Output:  jp2Of("jp2 ", exifBox),
+			Format:  "jp2",
+			Edited:  true,
+		},
+		{
+			Name:     "fragmented",
+			Input:    jp2Of("jpx ", fragments, exifBox, xmlBox),
+			Options:  []Option{WithTimestampPolicy(TimestampsRemove)},
+			Output:   jp2Of("jpx ", fragments, bmff.Free(len(exifBox)), bmff.Free(len(xmlBox))),
+			Format:   "jpx",
+			Exif:     true,
+			Metadata: true,
+		},
+		{
+			Name:   "no metadata",
+			Input:  jp2Of("jp2 "),
+			Output: jp2Of("jp2 "),
+			Format: "jp2",
+		},
+	}
+
+	for _, test := range testTable {
+		output := new(bytes.Buffer)
+		report, err := Sanitize(bytes.NewReader(test.Input), output, test.Options...)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if !bytes.Equal(test.Output, output.Bytes()) {
+			t.Errorf("%s: expected result to be: %q instead got: %q", test.Name, test.Output, output.Bytes())
+		}
+		if report.Format != test.Format || report.ExifRemoved != test.Exif || report.ExifEdited != test.Edited || report.MetadataRemoved != test.Metadata {
+			t.Errorf("%s: unexpected report: %+v", test.Name, report)
+		}
+		if report.Width != 1 || report.Height != 2 {
+			t.Errorf("%s: expected a 1x2 image, got %dx%d", test.Name, report.Width, report.Height)
+		}
+		if Detect(test.Input) != test.Format {
+			t.Errorf("%s: expected %s to be detected, got %q", test.Name, test.Format, Detect(test.Input))
+		}
+	}
+}
+
+func TestSanitizeJP2Errors(t *testing.T) {
+	valid := jp2Of("jp2 ")
+	testTable := []struct {
+		Name  string
+		Input []byte
+	}{
+		{Name: "no file type box", Input: append(append([]byte{}, jp2Signature...), mp4BoxOf("jp2c", nil)...)},
+		{Name: "truncated", Input: valid[:len(valid)-4]},
+	}
+
+	for _, test := range testTable {
+		if _, err := Sanitize(bytes.NewReader(test.Input), new(bytes.Buffer)); err == nil {
+			t.Errorf("%s: expected an error", test.Name)
+		}
+	}
+}
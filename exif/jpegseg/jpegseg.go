@@ -0,0 +1,242 @@
+// Package jpegseg reads and writes the marker segments of JPEG files, the headers holding EXIF
+// data, XMP packets, ICC profiles, comments and the tables needed to decode the image, one at a
+// time. It does not decode the image itself: the entropy coded data following the start of scan
+// segment is copied as is.
+package jpegseg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Markers of the segments handled specially.
+const (
+	// SOI is the start of image marker opening every JPEG file.
+	SOI = 0xD8
+
+	// EOI is the end of image marker.
+	EOI = 0xD9
+
+	// SOS is the start of scan marker, whose segment is followed by the entropy coded data.
+	SOS = 0xDA
+
+	// APP0 is the first application marker, used by JFIF headers; APP1 holds EXIF data and XMP
+	// packets, APP2 ICC profiles and APP11 JUMBF boxes such as C2PA manifests.
+	APP0  = 0xE0
+	APP1  = 0xE1
+	APP2  = 0xE2
+	APP11 = 0xEB
+
+	// COM is the comment marker.
+	COM = 0xFE
+)
+
+// ErrTruncated is wrapped by the errors of files ending before their start of scan segment, such
+// as files whose segments declare lengths running past their end.
+var ErrTruncated = errors.New("unexpected end of file")
+
+// ErrMalformed is wrapped by the errors of files whose segments cannot be read, such as segments
+// not starting with a marker or declaring a length shorter than their length field.
+var ErrMalformed = errors.New("malformed data")
+
+// MaxPayload is the largest payload a segment can hold, as its length field counts itself.
+const MaxPayload = 0xFFFF - 2
+
+// Segment is a marker segment of a JPEG file.
+type Segment struct {
+	// Marker is the marker of the segment, without its 0xFF prefix.
+	Marker byte
+
+	// Payload is the data following the length field of the segment, or nil for standalone
+	// markers, such as SOI, which have neither.
+	Payload []byte
+
+	// Offset is where the marker starts, from the start of the file, after any fill bytes
+	// preceding it.
+	Offset int64
+}
+
+// Size returns the size of the segment in the file: its marker, its length field and its
+// payload.
+func (s Segment) Size() int {
+	if IsStandalone(s.Marker) {
+		return 2
+	}
+	return 4 + len(s.Payload)
+}
+
+// IsStandalone reports whether segments of the marker have no length field or payload: the
+// start and end of image markers, the restart markers and TEM.
+func IsStandalone(marker byte) bool {
+	return marker == SOI || marker == EOI || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7)
+}
+
+// byteReader is a reader that can read single bytes efficiently.
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// Reader reads the segments of a JPEG file.
+type Reader struct {
+	r      byteReader
+	offset int64
+
+	// raw is the file read by Readers of files held in memory, whose payloads are slices of it.
+	raw []byte
+
+	// done is true once the start of scan or end of image segment has been read.
+	done bool
+}
+
+// NewReader returns a Reader reading the segments of the JPEG file read from r. Readers that do
+// not implement io.ByteReader are buffered, so the Reader may read past the segments; CopyRest
+// copies what it read ahead.
+func NewReader(r io.Reader) *Reader {
+	br, ok := r.(byteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Reader{r: br}
+}
+
+// NewBytesReader returns a Reader reading the segments of the JPEG file raw, held in memory.
+// Rather than copies, the payloads of the segments it returns are slices of raw, which must not be
+// modified while they are in use.
+func NewBytesReader(raw []byte) *Reader {
+	return &Reader{r: bytes.NewReader(raw), raw: raw}
+}
+
+// Next returns the next segment of the file, starting with the SOI segment, up to and including
+// the SOS segment, or the EOI segment of files without image data. It then returns io.EOF.
+func (r *Reader) Next() (Segment, error) {
+	if r.done {
+		return Segment{}, io.EOF
+	}
+
+	first := r.offset == 0
+	prefix, err := r.readByte()
+	if err != nil {
+		if first {
+			return Segment{}, fmt.Errorf("not a JPEG image: missing start of image marker")
+		}
+		return Segment{}, r.unexpected(err, "before the start of scan")
+	}
+	if prefix != 0xFF {
+		if first {
+			return Segment{}, fmt.Errorf("not a JPEG image: missing start of image marker")
+		}
+		return Segment{}, fmt.Errorf("%w: expected a marker at offset %d", ErrMalformed, r.offset-1)
+	}
+
+	// Markers may be preceded by any number of fill bytes.
+	s := Segment{Offset: r.offset - 1}
+	for {
+		if s.Marker, err = r.readByte(); err != nil {
+			return Segment{}, r.unexpected(err, "before the start of scan")
+		}
+		if s.Marker != 0xFF {
+			break
+		}
+		s.Offset++
+	}
+	if first != (s.Marker == SOI) {
+		if first {
+			return Segment{}, fmt.Errorf("not a JPEG image: missing start of image marker")
+		}
+		return Segment{}, fmt.Errorf("%w: unexpected start of image marker at offset %d", ErrMalformed, s.Offset)
+	}
+	if s.Marker == EOI {
+		r.done = true
+	}
+	if IsStandalone(s.Marker) {
+		return s, nil
+	}
+
+	var length [2]byte
+	for i := range length {
+		if length[i], err = r.readByte(); err != nil {
+			return Segment{}, r.unexpected(err, fmt.Sprintf("in segment at offset %d", s.Offset))
+		}
+	}
+	size := int(binary.BigEndian.Uint16(length[:]))
+	if size < 2 {
+		return Segment{}, fmt.Errorf("%w: invalid length %d of the segment at offset %d", ErrMalformed, size, s.Offset)
+	}
+	// Readers knowing how much is left, such as those of files held in memory, fail before
+	// allocating the payload.
+	if left, ok := r.r.(interface{ Len() int }); ok && size-2 > left.Len() {
+		return Segment{}, fmt.Errorf("%w in segment at offset %d: its payload of %d bytes exceeds the %d bytes left", ErrTruncated, s.Offset, size-2, left.Len())
+	}
+	if r.raw != nil {
+		end := r.offset + int64(size-2)
+		s.Payload = r.raw[r.offset:end:end]
+		if _, err := r.r.(*bytes.Reader).Seek(end, io.SeekStart); err != nil {
+			return Segment{}, err
+		}
+		r.offset = end
+	} else {
+		s.Payload = make([]byte, size-2)
+		if _, err := io.ReadFull(r, s.Payload); err != nil {
+			return Segment{}, r.unexpected(err, fmt.Sprintf("in segment at offset %d", s.Offset))
+		}
+	}
+	if s.Marker == SOS {
+		r.done = true
+	}
+	return s, nil
+}
+
+// CopyRest copies what follows the last segment read to w: the entropy coded data and what
+// follows it, such as trailing data, after the SOS segment. It returns the number of bytes
+// copied.
+func (r *Reader) CopyRest(w io.Writer) (int64, error) {
+	return io.Copy(w, r)
+}
+
+// Read reads what follows the last segment read, as CopyRest does.
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+// readByte reads a single byte.
+func (r *Reader) readByte() (byte, error) {
+	c, err := r.r.ReadByte()
+	if err == nil {
+		r.offset++
+	}
+	return c, err
+}
+
+// unexpected turns the end of file in the middle of the headers into an error saying where.
+func (r *Reader) unexpected(err error, where string) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w %s", ErrTruncated, where)
+	}
+	return err
+}
+
+// WriteSegment writes the segment s to w: its marker, and unless it is standalone, its length
+// and payload.
+func WriteSegment(w io.Writer, s Segment) error {
+	if IsStandalone(s.Marker) {
+		_, err := w.Write([]byte{0xFF, s.Marker})
+		return err
+	}
+	if len(s.Payload) > MaxPayload {
+		return fmt.Errorf("the payload of %d bytes of the segment of marker 0x%02X exceeds %d bytes", len(s.Payload), s.Marker, MaxPayload)
+	}
+	header := []byte{0xFF, s.Marker, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(s.Payload)+2))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(s.Payload)
+	return err
+}
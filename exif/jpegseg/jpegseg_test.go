@@ -0,0 +1,211 @@
+package jpegseg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// scan is a start of scan segment followed by entropy coded data holding a stuffed 0xFF byte and
+// a restart marker, the end of image marker and trailing data.
+var scan = []byte{0xFF, SOS, 0x00, 0x03, 0x01, 0x12, 0xFF, 0x00, 0x34, 0xFF, 0xD0, 0x56, 0xFF, EOI, 't', 'a', 'i', 'l'}
+
+// readAll returns the segments read by reader and the data following them.
+func readAll(t *testing.T, reader *Reader) ([]Segment, []byte, error) {
+	t.Helper()
+	var segments []Segment
+	for {
+		s, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return segments, nil, err
+		}
+		segments = append(segments, s)
+	}
+	rest := new(bytes.Buffer)
+	if _, err := reader.CopyRest(rest); err != nil {
+		t.Fatalf("unexpected error copying the rest: %v", err)
+	}
+	return segments, rest.Bytes(), nil
+}
+
+func TestReader(t *testing.T) {
+	var raw []byte
+	raw = append(raw, 0xFF, SOI)
+	raw = append(raw, 0xFF, APP0, 0x00, 0x04, 'J', 'F')
+	raw = append(raw, 0xFF, 0xFF, 0xFF, APP1, 0x00, 0x02) // Fill bytes and an empty payload.
+	raw = append(raw, 0xFF, 0x01)                         // TEM, standalone.
+	raw = append(raw, 0xFF, COM, 0x00, 0x05, 0xFF, 0xD9, 0x00)
+	raw = append(raw, scan...)
+
+	expected := []Segment{
+		{Marker: SOI, Offset: 0},
+		{Marker: APP0, Payload: []byte("JF"), Offset: 2},
+		{Marker: APP1, Payload: []byte{}, Offset: 10},
+		{Marker: 0x01, Offset: 14},
+		{Marker: COM, Payload: []byte{0xFF, 0xD9, 0x00}, Offset: 16},
+		{Marker: SOS, Payload: []byte{0x01}, Offset: 23},
+	}
+
+	for name, r := range map[string]*Reader{
+		"bytes":     NewReader(bytes.NewReader(raw)),
+		"one byte":  NewReader(iotest.OneByteReader(bytes.NewReader(raw))),
+		"half":      NewReader(iotest.HalfReader(bytes.NewReader(raw))),
+		"in memory": NewBytesReader(raw),
+	} {
+		t.Run(name, func(t *testing.T) {
+			segments, rest, err := readAll(t, r)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(segments) != len(expected) {
+				t.Fatalf("expected %d segments, got %+v", len(expected), segments)
+			}
+			for i, s := range segments {
+				if s.Marker != expected[i].Marker || !bytes.Equal(s.Payload, expected[i].Payload) || s.Offset != expected[i].Offset {
+					t.Errorf("expected segment %d to be %+v, got %+v", i, expected[i], s)
+				}
+				if (s.Payload == nil) != IsStandalone(s.Marker) {
+					t.Errorf("expected only standalone segments to have no payload, got %+v", s)
+				}
+			}
+			if !bytes.Equal(rest, scan[5:]) {
+				t.Errorf("expected the image data and trailer to follow, got %x", rest)
+			}
+
+			// Writing the segments back gives the file without its fill bytes.
+			out := new(bytes.Buffer)
+			for _, s := range segments {
+				if err := WriteSegment(out, s); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			out.Write(rest)
+			withoutFill := append(append([]byte{}, raw[:8]...), raw[10:]...)
+			if !bytes.Equal(out.Bytes(), withoutFill) {
+				t.Errorf("expected the file to be written back, got %x", out.Bytes())
+			}
+		})
+	}
+}
+
+func TestReaderWithoutImageData(t *testing.T) {
+	raw := []byte{0xFF, SOI, 0xFF, COM, 0x00, 0x03, 'x', 0xFF, EOI, 'j', 'u', 'n', 'k'}
+	segments, rest, err := readAll(t, NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(segments) != 3 || segments[2].Marker != EOI || segments[2].Offset != 7 {
+		t.Errorf("expected the segments to end at the end of image marker, got %+v", segments)
+	}
+	if string(rest) != "junk" {
+		t.Errorf("expected the trailing data to follow, got %q", rest)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	testTable := []struct {
+		name  string
+		raw   []byte
+		error string
+		kind  error
+	}{
+		{"empty", nil, "missing start of image marker", nil},
+		{"PNG", []byte("\x89PNG\r\n\x1a\n"), "missing start of image marker", nil},
+		{"APP0 first", []byte{0xFF, APP0, 0x00, 0x02}, "missing start of image marker", nil},
+		{"no scan", []byte{0xFF, SOI, 0xFF, APP0, 0x00, 0x02}, "unexpected end of file before the start of scan", ErrTruncated},
+		{"only fill bytes", []byte{0xFF, SOI, 0xFF, 0xFF}, "unexpected end of file before the start of scan", ErrTruncated},
+		{"garbage", []byte{0xFF, SOI, 0x12, 0x34}, "expected a marker at offset 2", ErrMalformed},
+		{"second SOI", []byte{0xFF, SOI, 0xFF, SOI}, "unexpected start of image marker at offset 2", ErrMalformed},
+		{"truncated length", []byte{0xFF, SOI, 0xFF, APP1, 0x00}, "unexpected end of file in segment at offset 2", ErrTruncated},
+		{"truncated payload", []byte{0xFF, SOI, 0xFF, APP1, 0x00, 0x10, 'E', 'x'}, "unexpected end of file in segment at offset 2", ErrTruncated},
+		{"length past the end", []byte{0xFF, SOI, 0xFF, APP1, 0xFF, 0xFF, 'E', 'x'}, "payload of 65533 bytes exceeds the 2 bytes left", ErrTruncated},
+		{"short length", []byte{0xFF, SOI, 0xFF, APP1, 0x00, 0x01}, "invalid length 1 of the segment at offset 2", ErrMalformed},
+	}
+	for _, test := range testTable {
+		t.Run(test.name, func(t *testing.T) {
+			for _, reader := range []*Reader{NewReader(bytes.NewReader(test.raw)), NewBytesReader(test.raw)} {
+				_, _, err := readAll(t, reader)
+				if err == nil || !strings.Contains(err.Error(), test.error) {
+					t.Errorf("expected an error containing %q, got %v", test.error, err)
+				}
+				if test.kind != nil && !errors.Is(err, test.kind) {
+					t.Errorf("expected an error wrapping %v, got %v", test.kind, err)
+				}
+			}
+		})
+	}
+
+	// Readers not knowing how much is left fail while reading the payload.
+	_, _, err := readAll(t, NewReader(iotest.OneByteReader(bytes.NewReader([]byte{0xFF, SOI, 0xFF, APP1, 0xFF, 0xFF, 'E', 'x'}))))
+	if !errors.Is(err, ErrTruncated) {
+		t.Errorf("expected an error wrapping ErrTruncated, got %v", err)
+	}
+
+	reader := NewReader(iotest.ErrReader(io.ErrClosedPipe))
+	if _, err := reader.Next(); err == nil {
+		t.Errorf("expected the error of the underlying reader")
+	}
+}
+
+func TestWriteSegment(t *testing.T) {
+	out := new(bytes.Buffer)
+	if err := WriteSegment(out, Segment{Marker: APP1, Payload: make([]byte, MaxPayload)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.Len() != 4+MaxPayload || !bytes.HasPrefix(out.Bytes(), []byte{0xFF, APP1, 0xFF, 0xFF}) {
+		t.Errorf("expected a segment of the largest length, got a header of %x", out.Bytes()[:4])
+	}
+	if err := WriteSegment(out, Segment{Marker: APP1, Payload: make([]byte, MaxPayload+1)}); err == nil {
+		t.Errorf("expected an error for a payload too large")
+	}
+
+	out.Reset()
+	if err := WriteSegment(out, Segment{Marker: 0xD3, Payload: []byte("ignored")}); err != nil || !bytes.Equal(out.Bytes(), []byte{0xFF, 0xD3}) {
+		t.Errorf("expected a restart marker without payload, got %x, %v", out.Bytes(), err)
+	}
+	if s := (Segment{Marker: COM, Payload: []byte("hi")}); s.Size() != 6 {
+		t.Errorf("expected the comment to take 6 bytes, got %d", s.Size())
+	}
+}
+
+// TestBytesReader verifies that the payloads read from files held in memory are not copied.
+func TestBytesReader(t *testing.T) {
+	raw := append([]byte{0xFF, SOI, 0xFF, APP1, 0x00, 0x06, 'E', 'x', 'i', 'f'}, scan...)
+	reader := NewBytesReader(raw)
+	if _, err := reader.Next(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	app1, err := reader.Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if &app1.Payload[0] != &raw[6] || cap(app1.Payload) != 4 {
+		t.Errorf("expected the payload to be the slice of raw at offset 6, got %q", app1.Payload)
+	}
+
+	// The allocations do not grow with the segments.
+	allocs := func(raw []byte) float64 {
+		return testing.AllocsPerRun(100, func() {
+			reader := NewBytesReader(raw)
+			for {
+				if _, err := reader.Next(); err != nil {
+					break
+				}
+			}
+		})
+	}
+	many := []byte{0xFF, SOI}
+	for i := 0; i < 20; i++ {
+		many = append(many, raw[2:10]...)
+	}
+	many = append(many, scan...)
+	if one, twenty := allocs(raw), allocs(many); twenty != one {
+		t.Errorf("expected the allocations not to grow with the segments, got %v for one and %v for twenty", one, twenty)
+	}
+}
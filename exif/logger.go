@@ -0,0 +1,21 @@
+package exif
+
+// Logger receives the diagnostics of Sanitize, such as the offsets of the segments it finds and
+// removes, which help debugging unusual files. *log.Logger implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// WithLogger makes Sanitize write its diagnostics to l. They are discarded by default.
+func WithLogger(l Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// logf writes a diagnostic to the logger of the options, if any.
+func (o *options) logf(format string, v ...interface{}) {
+	if o.logger != nil {
+		o.logger.Printf(format, v...)
+	}
+}
@@ -0,0 +1,94 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"regexp"
+)
+
+// The identifier of APP1 segments holding an XMP packet.
+var xmpIdent = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+// samsungMotionPhotoMarker precedes the video in the trailer of Samsung motion photos.
+var samsungMotionPhotoMarker = []byte("MotionPhoto_Data")
+
+var (
+	// motionPhotoProperty matches the XMP properties declaring a Google or Samsung motion photo
+	// and where its video is: GCamera:MotionPhoto, GCamera:MicroVideo and their variants.
+	motionPhotoProperty = regexp.MustCompile(`GCamera:(?:MotionPhoto|MicroVideo)\w*`)
+
+	// motionPhotoAttribute matches those properties written as attributes, and motionPhotoElement
+	// as elements.
+	motionPhotoAttribute = regexp.MustCompile(`\s+GCamera:(?:MotionPhoto|MicroVideo)\w*="[^"]*"`)
+	motionPhotoElement   = regexp.MustCompile(`(?s)\s*<GCamera:(?:MotionPhoto|MicroVideo)\w*>[^<]*</GCamera:(?:MotionPhoto|MicroVideo)\w*>`)
+
+	// containerDirectory matches the directory of the items appended to the image, the primary
+	// image and the video, of the motion photo format.
+	containerDirectory = regexp.MustCompile(`(?s)\s*<Container:Directory\b.*?</Container:Directory>`)
+)
+
+// isXMP reports whether s is an APP1 segment holding an XMP packet.
+func isXMP(raw []byte, s segment) bool {
+	return s.marker == appMarker && bytes.HasPrefix(s.payload(raw), xmpIdent)
+}
+
+// removeMotionPhoto returns the XMP packet without the properties declaring a motion photo.
+func removeMotionPhoto(packet []byte) []byte {
+	packet = containerDirectory.ReplaceAll(packet, nil)
+	packet = motionPhotoElement.ReplaceAll(packet, nil)
+	return motionPhotoAttribute.ReplaceAll(packet, nil)
+}
+
+// xmpSegmentOf returns an APP1 segment holding the XMP packet.
+func xmpSegmentOf(packet []byte) []byte {
+	segment := []byte{markerPrefix, appMarker, 0x00, 0x00}
+	segment = append(segment, xmpIdent...)
+	segment = append(segment, packet...)
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(segment)-2))
+	return segment
+}
+
+// motionPhotoVideo returns the MP4 video held by the trailer of a motion photo, starting at its
+// file type box, or nil if there is none.
+func motionPhotoVideo(trailer []byte) []byte {
+	if i := bytes.Index(trailer, samsungMotionPhotoMarker); i >= 0 {
+		trailer = trailer[i+len(samsungMotionPhotoMarker):]
+	}
+	i := bytes.Index(trailer, []byte("ftyp"))
+	if i < 4 || !isMP4(trailer[i-4:]) {
+		return nil
+	}
+	return trailer[i-4:]
+}
+
+// findMotionPhoto records in the report whether the JPEG image raw is a motion photo: an image
+// followed by a video, declared in its XMP packet or, for older Samsung phones, only marked in
+// the trailer. If the trailer is removed, the XMP packet is replaced with one without the
+// declaration, so that viewers do not look for the missing video, unless an action is set for its
+// segments.
+func findMotionPhoto(raw []byte, segments []segment, replace map[int][]byte, o *options, report *Report) {
+	if report.TrailerSize == 0 {
+		return
+	}
+	trailer := raw[len(raw)-report.TrailerSize:]
+
+	var declaration *segment
+	for i, s := range segments {
+		if isXMP(raw, s) && motionPhotoProperty.Match(s.payload(raw)) {
+			declaration = &segments[i]
+			break
+		}
+	}
+	if declaration == nil && !bytes.Contains(trailer, samsungMotionPhotoMarker) {
+		return
+	}
+	report.MotionPhoto = true
+	report.MotionPhotoVideo = motionPhotoVideo(trailer)
+
+	if declaration != nil && report.TrailerRemoved && o.segmentAction(declaration.marker) == SegmentDefault {
+		packet := declaration.payload(raw)[len(xmpIdent):]
+		replacement := xmpSegmentOf(removeMotionPhoto(packet))
+		replace[declaration.start] = replacement
+		report.BytesRemoved += declaration.end - declaration.start - len(replacement)
+	}
+}
@@ -0,0 +1,283 @@
+package exif
+
+import (
+	"encoding/binary"
+	"strings"
+	"time"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif/bmff"
+)
+
+// The start of the epoch of the creation and modification times of MP4 and QuickTime files.
+var mp4Epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// The keys of QuickTime metadata items read or removed by Sanitize.
+const (
+	quickTimeLocationPrefix = "com.apple.quicktime.location"
+	quickTimeCreationDate   = "com.apple.quicktime.creationdate"
+	quickTimeMake           = "com.apple.quicktime.make"
+	quickTimeModel          = "com.apple.quicktime.model"
+
+	// quickTimeContentIdentifier pairs the video of a Live Photo with its photo.
+	quickTimeContentIdentifier = "com.apple.quicktime.content.identifier"
+)
+
+// The layout of com.apple.quicktime.creationdate values, such as "2024-03-02T13:45:30+0100".
+const quickTimeDateLayout = "2006-01-02T15:04:05-0700"
+
+// mp4Containers are the boxes holding the boxes Sanitize looks into.
+var mp4Containers = map[string]bool{"moov": true, "trak": true, "mdia": true, "udta": true}
+
+// isMP4 reports whether raw is an ISO base media file, such as an MP4 or QuickTime video.
+func isMP4(raw []byte) bool {
+	return len(raw) >= 12 && string(raw[4:8]) == "ftyp"
+}
+
+// isMP4Location reports whether a box type holds the location a video was recorded at: the
+// QuickTime ©xyz user data written by iOS and Android, and the 3GPP loci box.
+func isMP4Location(typ string) bool {
+	return typ == "\xa9xyz" || typ == "loci"
+}
+
+// mp4Sanitizer removes metadata from an ISO base media file in place. Removed boxes are turned
+// into free boxes of the same size rather than cut out, so that the offsets of the media data
+// held by the sample tables stay valid. The file is read from raw and edited through edits, so
+// that the media data, which makes up most of it, is written without being copied.
+type mp4Sanitizer struct {
+	raw    []byte
+	edits  *splice
+	report *Report
+
+	// keepLocation is true when the EXIF data of images is kept, whose location is kept too.
+	keepLocation  bool
+	timestamps    TimestampPolicy
+	removePairing bool
+
+	// opts are the options applied to the EXIF data of HEIF images.
+	opts *options
+
+	// logf writes diagnostics to the logger of the options.
+	logf func(format string, v ...interface{})
+}
+
+// sanitizeMP4 removes the location from the MP4 or QuickTime video raw and removes or rounds its
+// creation and modification times, as Sanitize does for images: unless the options keep the
+// EXIF data, the location is removed and the times are zeroed. The Live Photo content identifier
+// is only removed if requested. HEIF images and image sequences, which are ISO base media files
+// too, have the EXIF data and XMP packets of all their items handled as well.
+func sanitizeMP4(raw []byte, o *options) ([][]byte, *Report, error) {
+	m := newMP4Sanitizer(raw, o)
+	if err := m.walk(0, len(raw)); err != nil {
+		return nil, nil, err
+	}
+	return m.edits.parts(), m.report, nil
+}
+
+// newMP4Sanitizer returns a sanitizer of the ISO base media file raw, whose format is told by the
+// brand of its ftyp box, at its start.
+func newMP4Sanitizer(raw []byte, o *options) *mp4Sanitizer {
+	m := &mp4Sanitizer{
+		raw:           raw,
+		edits:         &splice{raw: raw},
+		report:        &Report{Format: "mp4"},
+		timestamps:    TimestampsRemove,
+		removePairing: o.removePairing,
+		opts:          o,
+		logf:          o.logf,
+	}
+	if string(raw[8:12]) == "qt  " {
+		m.report.Format = "mov"
+	}
+	if format := heifFormat(raw); format != "" {
+		m.report.Format = format
+	}
+	if len(o.edits) > 0 {
+		m.keepLocation = true
+		m.timestamps = o.timestamps
+	}
+	return m
+}
+
+func (m *mp4Sanitizer) summary() *Summary {
+	if m.report.Summary == nil {
+		m.report.Summary = &Summary{}
+	}
+	return m.report.Summary
+}
+
+// free turns b into a free box, blanking its payload.
+func (m *mp4Sanitizer) free(b bmff.Box) {
+	m.logf("Removing the %q box at offset %d", b.Type, b.Start)
+	box := m.edits.writable(b.Start, b.End)
+	bmff.MakeFree(box, bmff.Box{Type: b.Type, Start: 0, Payload: b.Payload - b.Start, End: b.End - b.Start})
+	m.report.MetadataRemoved = true
+	m.report.BytesRemoved += b.Size()
+}
+
+func (m *mp4Sanitizer) walk(start, end int) error {
+	boxes, err := bmff.ReadBoxes(m.raw, start, end)
+	if err != nil {
+		return err
+	}
+	for _, b := range boxes {
+		switch {
+		case mp4Containers[b.Type]:
+			err = m.walk(b.Payload, b.End)
+		case b.Type == "meta":
+			// QuickTime meta boxes hold their children directly, while ISO ones, found in the
+			// user data of MP4 files, start with a version and flags like full boxes.
+			children := b.Payload
+			if b.End-b.Payload >= 8 && string(m.raw[b.Payload+4:b.Payload+8]) != "hdlr" {
+				children += 4
+			}
+			err = m.meta(children, b.End)
+		case isMP4Location(b.Type):
+			m.summary().GPS = true
+			if !m.keepLocation {
+				m.free(b)
+			}
+		case b.Type == "mvhd" || b.Type == "tkhd" || b.Type == "mdhd":
+			m.times(b)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// meta handles the children of a meta box between start and end: the metadata items of the
+// ilst box, whose types are either the 1-based index of their key in the keys box, or, in the
+// iTunes style, the key itself, and the Exif and XMP items of HEIF images.
+func (m *mp4Sanitizer) meta(start, end int) error {
+	boxes, err := bmff.ReadBoxes(m.raw, start, end)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]string)
+	for _, b := range boxes {
+		if b.Type != "keys" || b.End-b.Payload < 8 {
+			continue
+		}
+		count := int(binary.BigEndian.Uint32(m.raw[b.Payload+4:]))
+		offset := b.Payload + 8
+		for i := 1; i <= count && offset+8 <= b.End; i++ {
+			size := int(binary.BigEndian.Uint32(m.raw[offset:]))
+			if size < 8 || offset+size > b.End {
+				break
+			}
+			index := string(binary.BigEndian.AppendUint32(nil, uint32(i)))
+			keys[index] = string(m.raw[offset+8 : offset+size])
+			offset += size
+		}
+	}
+
+	for _, b := range boxes {
+		if b.Type != "ilst" {
+			continue
+		}
+		items, err := bmff.ReadBoxes(m.raw, b.Payload, b.End)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			key, ok := keys[item.Type]
+			if !ok {
+				key = item.Type
+			}
+			m.item(item, key)
+		}
+	}
+	return m.heifItems(boxes)
+}
+
+// item handles the metadata item with the given key.
+func (m *mp4Sanitizer) item(item bmff.Box, key string) {
+	// The value is held by a data box, following its type indicator and locale.
+	var value []byte
+	valueStart := 0
+	if children, err := bmff.ReadBoxes(m.raw, item.Payload, item.End); err == nil {
+		for _, child := range children {
+			if child.Type == "data" && child.End-child.Payload >= 8 {
+				valueStart = child.Payload + 8
+				value = m.raw[valueStart:child.End]
+				break
+			}
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(key, quickTimeLocationPrefix) || isMP4Location(key):
+		m.summary().GPS = true
+		if !m.keepLocation {
+			m.free(item)
+		}
+	case key == quickTimeContentIdentifier:
+		m.report.LivePhoto = true
+		if m.removePairing {
+			m.free(item)
+			m.report.PairingRemoved = true
+		}
+	case key == quickTimeMake:
+		m.summary().Make = string(value)
+	case key == quickTimeModel:
+		m.summary().Model = string(value)
+	case key == quickTimeCreationDate:
+		if taken, err := time.Parse(quickTimeDateLayout, string(value)); err == nil {
+			m.summary().Taken = taken
+		}
+		switch m.timestamps {
+		case TimestampsRemove:
+			m.free(item)
+		case TimestampsRoundToDay:
+			if len(value) >= 19 && value[10] == 'T' {
+				copy(m.edits.writable(valueStart+11, valueStart+19), "00:00:00")
+			}
+		}
+	}
+}
+
+// times handles the creation and modification times of a movie, track or media header box,
+// which follow its version and flags, as 32 bit values in version 0 and 64 bit values in
+// version 1.
+func (m *mp4Sanitizer) times(b bmff.Box) {
+	payload := m.raw[b.Payload:b.End]
+	size := 4
+	if len(payload) > 0 && payload[0] == 1 {
+		size = 8
+	}
+	if len(payload) < 4+2*size {
+		return
+	}
+
+	for i, at := range []int{b.Payload + 4, b.Payload + 4 + size} {
+		field := m.raw[at : at+size]
+		var seconds uint64
+		if size == 4 {
+			seconds = uint64(binary.BigEndian.Uint32(field))
+		} else {
+			seconds = binary.BigEndian.Uint64(field)
+		}
+		if seconds == 0 {
+			continue
+		}
+		if b.Type == "mvhd" && i == 0 && m.summary().Taken.IsZero() {
+			m.summary().Taken = mp4Epoch.Add(time.Duration(seconds) * time.Second)
+		}
+
+		switch m.timestamps {
+		case TimestampsRemove:
+			zero(m.edits.writable(at, at+size))
+			m.report.MetadataRemoved = true
+		case TimestampsRoundToDay:
+			// The epoch starts at midnight, so whole days since it end at midnight too.
+			seconds -= seconds % 86400
+			if size == 4 {
+				binary.BigEndian.PutUint32(m.edits.writable(at, at+size), uint32(seconds))
+			} else {
+				binary.BigEndian.PutUint64(m.edits.writable(at, at+size), seconds)
+			}
+		}
+	}
+}
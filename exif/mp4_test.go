@@ -0,0 +1,195 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif/bmff"
+)
+
+func mp4BoxOf(typ string, children ...[]byte) []byte {
+	var payload []byte
+	for _, child := range children {
+		payload = append(payload, child...)
+	}
+	return append(append(binary.BigEndian.AppendUint32(nil, uint32(8+len(payload))), typ...), payload...)
+}
+
+// mp4Header returns a version 0 movie, track or media header box with the given creation and
+// modification times.
+func mp4Header(typ string, seconds uint32) []byte {
+	payload := []byte{0, 0, 0, 0}
+	payload = binary.BigEndian.AppendUint32(payload, seconds)
+	payload = binary.BigEndian.AppendUint32(payload, seconds)
+	return mp4BoxOf(typ, append(payload, make([]byte, 16)...))
+}
+
+// quickTimeMeta returns a QuickTime meta box holding the given keys and values, as iPhones write.
+func quickTimeMeta(keys ...string) []byte {
+	entries := binary.BigEndian.AppendUint32([]byte{0, 0, 0, 0}, uint32(len(keys)/2))
+	var items [][]byte
+	for i := 0; i < len(keys); i += 2 {
+		entries = binary.BigEndian.AppendUint32(entries, uint32(8+len(keys[i])))
+		entries = append(append(entries, "mdta"...), keys[i]...)
+		data := mp4BoxOf("data", append([]byte{0, 0, 0, 1, 0, 0, 0, 0}, keys[i+1]...))
+		items = append(items, mp4BoxOf(string(binary.BigEndian.AppendUint32(nil, uint32(i/2+1))), data))
+	}
+	return mp4BoxOf("meta", mp4BoxOf("hdlr", make([]byte, 24)), mp4BoxOf("keys", entries), mp4BoxOf("ilst", items...))
+}
+
+// 2024-03-02 13:45:30 UTC, in seconds since 1904.
+const mp4Time = 3792231930
+
+func TestSanitizeMP4(t *testing.T) {
+	mdat := mp4BoxOf("mdat", []byte("frames"))
+	iphone := append(mp4BoxOf("ftyp", []byte("qt  \x00\x00\x00\x00qt  ")), mp4BoxOf("moov",
+		mp4Header("mvhd", mp4Time),
+		mp4BoxOf("trak", mp4Header("tkhd", mp4Time), mp4BoxOf("mdia", mp4Header("mdhd", mp4Time))),
+		quickTimeMeta(
+			"com.apple.quicktime.location.ISO6709", "+52.3700+004.8900+001.000/",
+			"com.apple.quicktime.make", "Apple",
+			"com.apple.quicktime.model", "iPhone 15 Pro",
+			"com.apple.quicktime.creationdate", "2024-03-02T14:45:30+0100",
+		),
+	)...)
+	iphone = append(iphone, mdat...)
+	android := append(mp4BoxOf("ftyp", []byte("isom\x00\x00\x00\x00isommp42")), mp4BoxOf("moov",
+		mp4Header("mvhd", mp4Time),
+		mp4BoxOf("udta", mp4BoxOf("\xa9xyz", []byte("\x00\x12\x15\xc7+52.3700+004.8900/"))),
+	)...)
+	android = append(android, mdat...)
+
+	testTable := []struct {
+		Name    string
+		Input   []byte
+		Options []Option
+		Format  string
+		Summary string
+		Removed []string
+		Kept    []string
+	}{
+		{
+			Name:    "iphone",
+			Input:   iphone,
+			Format:  "mov",
+			Summary: "iPhone 15 Pro, GPS: yes, taken 2024-03-02",
+			Removed: []string{"+52.3700", "2024-03-02T", "\xe2\x08\xdd\xfa"},
+			Kept:    []string{"iPhone 15 Pro", "frames"},
+		},
+		{
+			Name:    "iphone round to day",
+			Input:   iphone,
+			Options: []Option{WithTimestampPolicy(TimestampsRoundToDay)},
+			Format:  "mov",
+			Summary: "iPhone 15 Pro, GPS: yes, taken 2024-03-02",
+			Removed: []string{"14:45:30"},
+			Kept:    []string{"+52.3700", "2024-03-02T00:00:00+0100"},
+		},
+		{
+			Name:    "android",
+			Input:   android,
+			Format:  "mp4",
+			Summary: "GPS: yes, taken 2024-03-02",
+			Removed: []string{"+52.3700"},
+			Kept:    []string{"frames"},
+		},
+	}
+
+	for _, test := range testTable {
+		output := new(bytes.Buffer)
+		report, err := Sanitize(bytes.NewReader(test.Input), output, test.Options...)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if output.Len() != len(test.Input) {
+			t.Errorf("%s: expected the size to be unchanged, got %d bytes instead of %d", test.Name, output.Len(), len(test.Input))
+		}
+		if report.Format != test.Format || report.MetadataRemoved != (test.Options == nil) {
+			t.Errorf("%s: unexpected report: %+v", test.Name, report)
+		}
+		if report.Summary == nil || report.Summary.String() != test.Summary {
+			t.Errorf("%s: expected summary %q, got %v", test.Name, test.Summary, report.Summary)
+		}
+		for _, value := range test.Removed {
+			if bytes.Contains(output.Bytes(), []byte(value)) {
+				t.Errorf("%s: expected %q to be removed", test.Name, value)
+			}
+		}
+		for _, value := range test.Kept {
+			if !bytes.Contains(output.Bytes(), []byte(value)) {
+				t.Errorf("%s: expected %q to be kept", test.Name, value)
+			}
+		}
+		if _, err := bmff.ReadBoxes(output.Bytes(), 0, output.Len()); err != nil {
+			t.Errorf("%s: the output does not parse: %v", test.Name, err)
+		}
+	}
+
+	// Rounded creation times fall on midnight.
+	output := new(bytes.Buffer)
+	if _, err := Sanitize(bytes.NewReader(android), output, WithTimestampPolicy(TimestampsRoundToDay)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mvhd := bytes.Index(output.Bytes(), []byte("mvhd"))
+	created := mp4Epoch.Add(time.Duration(binary.BigEndian.Uint32(output.Bytes()[mvhd+8:])) * time.Second)
+	if !created.Equal(time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the creation time to be rounded to the day, got %v", created)
+	}
+}
+
+func TestSanitizeLivePhoto(t *testing.T) {
+	const identifier = "6D0F9C3A-1B2C-4D5E-8F90-A1B2C3D4E5F6"
+	video := append(mp4BoxOf("ftyp", []byte("qt  \x00\x00\x00\x00qt  ")), mp4BoxOf("moov",
+		quickTimeMeta("com.apple.quicktime.content.identifier", identifier),
+	)...)
+
+	// The Apple maker note holds the identifier in an IFD of its own.
+	note := append([]byte("Apple iOS\x00\x00\x01MM"), 0x00, 0x01)
+	note = append(note, 0x00, 0x11, 0x00, 0x02, 0x00, 0x00, 0x00, 0x25, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x00)
+	note = append(note, identifier+"\x00"...)
+	photo := jpegOf(exifSegmentOf(
+		[]testTag{asciiTag(tagMake, "Apple")},
+		[]testTag{{Tag: tagMakerNote, Type: 7, Value: note}},
+		nil,
+	))
+
+	testTable := []struct {
+		Name    string
+		Input   []byte
+		Options []Option
+		Removed bool
+	}{
+		{Name: "video", Input: video},
+		{Name: "video pairing removed", Input: video, Options: []Option{WithLivePhotoPairingRemoval()}, Removed: true},
+		{Name: "photo exif removed", Input: photo, Removed: true},
+		{Name: "photo exif kept", Input: photo, Options: []Option{WithDeviceFingerprintRemoval()}, Removed: true},
+		{Name: "photo timestamps removed", Input: photo, Options: []Option{WithTimestampPolicy(TimestampsRemove)}},
+		{
+			Name:    "photo timestamps and pairing removed",
+			Input:   photo,
+			Options: []Option{WithTimestampPolicy(TimestampsRemove), WithLivePhotoPairingRemoval()},
+			Removed: true,
+		},
+	}
+
+	for _, test := range testTable {
+		output := new(bytes.Buffer)
+		report, err := Sanitize(bytes.NewReader(test.Input), output, test.Options...)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if !report.LivePhoto {
+			t.Errorf("%s: expected a Live Photo to be detected, got %+v", test.Name, report)
+		}
+		if kept := bytes.Contains(output.Bytes(), []byte(identifier)); kept == test.Removed {
+			t.Errorf("%s: expected the identifier to be removed: %v, got kept: %v", test.Name, test.Removed, kept)
+		}
+		if report.PairingRemoved != test.Removed {
+			t.Errorf("%s: unexpected report: %+v", test.Name, report)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package exif
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+)
+
+var (
+	// pdfObject matches the header of an indirect object, such as "12 0 obj".
+	pdfObject = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+	// pdfInfoRef matches the reference to the document information dictionary in trailers and
+	// cross-reference streams.
+	pdfInfoRef = regexp.MustCompile(`/Info\s*(\d+)\s+(\d+)\s+R`)
+
+	// pdfMetadataType matches the type and subtype of XMP metadata streams, in either order.
+	pdfMetadataType = regexp.MustCompile(`/Type\s*/Metadata\b`)
+	pdfXMLSubtype   = regexp.MustCompile(`/Subtype\s*/XML\b`)
+
+	// pdfLength matches a direct stream length.
+	pdfLength = regexp.MustCompile(`/Length\s+(\d+)(\s+\d+\s+R)?`)
+
+	// pdfRefTail matches the generation number and keyword following the object number of an
+	// indirect reference, such as the " 0 R" of "12 0 R".
+	pdfRefTail = regexp.MustCompile(`^\s+\d+\s+R\b`)
+
+	// pdfStreamStart matches the keyword starting the data of a stream, and the end of line
+	// following it.
+	pdfStreamStart = regexp.MustCompile(`^\s*stream\r?\n`)
+)
+
+// isPDF reports whether raw is a PDF document.
+func isPDF(raw []byte) bool {
+	return bytes.HasPrefix(raw, []byte("%PDF-"))
+}
+
+// pdfObjectDict is the dictionary of an indirect object: where it starts, at its "<<", and where
+// it ends, after its ">>".
+type pdfObjectDict struct {
+	id         string
+	start, end int
+}
+
+// sanitizePDF removes the document information dictionary, which records the author, title,
+// creator tool and creation dates of the PDF document raw, and its XMP metadata streams. Both are
+// blanked with spaces rather than removed, so that the offsets of the cross-reference tables stay
+// valid: the information dictionary is left empty, and the data of metadata streams is left as
+// whitespace and their filters, which cannot decode whitespace, are dropped. Objects inside
+// compressed object streams cannot be reached and are kept. Only the regions blanked are copied.
+// The document is read in a single pass: unterminated dictionaries and streams are skipped up to
+// where their scan stopped, so that crafted documents cannot make it slow.
+func sanitizePDF(raw []byte, o *options) ([][]byte, *Report, error) {
+	edits := &splice{raw: raw}
+	report := &Report{Format: "pdf"}
+
+	infos := make(map[string]bool)
+	for _, m := range pdfInfoRef.FindAllSubmatch(raw, -1) {
+		infos[string(m[1])+" "+string(m[2])] = true
+	}
+
+	for offset := 0; offset < len(raw); {
+		loc := pdfObject.FindSubmatchIndex(raw[offset:])
+		if loc == nil {
+			break
+		}
+		dict := pdfObjectDict{
+			id:    string(raw[offset+loc[2]:offset+loc[3]]) + " " + string(raw[offset+loc[4]:offset+loc[5]]),
+			start: skipPDFSpace(raw, offset+loc[1]),
+		}
+		offset += loc[1]
+		if !bytes.HasPrefix(raw[dict.start:], []byte("<<")) {
+			continue
+		}
+		end, stop := pdfDictEnd(raw, dict.start)
+		if end < 0 {
+			// Not an object, but bytes looking like one, such as in compressed data, or a
+			// malformed one: none of the bytes scanned can start a dictionary either.
+			offset = stop
+			continue
+		}
+		dict.end = end
+		offset = dict.end
+
+		body := raw[dict.start:dict.end]
+		dataStart, dataEnd, stream := pdfStreamData(raw, dict)
+		switch {
+		case infos[dict.id]:
+			o.logf("Removing the PDF document information dictionary %s", dict.id)
+			blankPDF(edits.writable(dict.start+2, dict.end-2), report)
+		case stream && pdfMetadataType.Match(body) && pdfXMLSubtype.Match(body):
+			o.logf("Removing the PDF metadata stream %s", dict.id)
+			for _, key := range []string{"/Filter", "/DecodeParms"} {
+				if i := bytes.Index(body, []byte(key)); i >= 0 {
+					keyStart := dict.start + i
+					blankPDF(edits.writable(keyStart, pdfValueEnd(raw[:dict.end], keyStart+len(key))), report)
+				}
+			}
+			blankPDF(edits.writable(dataStart, dataEnd), report)
+		}
+		if dataEnd > 0 {
+			offset = dataEnd
+		}
+	}
+	return edits.parts(), report, nil
+}
+
+// pdfStreamData returns where the data of the stream whose dictionary is dict starts and ends,
+// and false if the object is not a stream. A stream whose data has no end is not one, but the
+// end of the document is returned as the end of its data, as nothing past it can be read.
+func pdfStreamData(raw []byte, dict pdfObjectDict) (int, int, bool) {
+	start := pdfStreamStart.FindIndex(raw[dict.end:])
+	if start == nil {
+		return 0, 0, false
+	}
+	dataStart := dict.end + start[1]
+
+	if m := pdfLength.FindSubmatch(raw[dict.start:dict.end]); m != nil && m[2] == nil {
+		if n, err := strconv.Atoi(string(m[1])); err == nil && dataStart+n <= len(raw) {
+			return dataStart, dataStart + n, true
+		}
+	}
+	// The length is indirect: the data ends before the endstream keyword.
+	i := bytes.Index(raw[dataStart:], []byte("endstream"))
+	if i < 0 {
+		return 0, len(raw), false
+	}
+	return dataStart, dataStart + i, true
+}
+
+// blankPDF overwrites b with spaces, and counts the bytes that were not whitespace already as
+// removed.
+func blankPDF(b []byte, report *Report) {
+	for i, c := range b {
+		if !isPDFSpace(c) {
+			report.BytesRemoved++
+			report.MetadataRemoved = true
+		}
+		b[i] = ' '
+	}
+}
+
+// isPDFSpace reports whether c is a PDF whitespace character.
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+// isPDFDelimiter reports whether c ends a name or number.
+func isPDFDelimiter(c byte) bool {
+	return isPDFSpace(c) || bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+// skipPDFSpace returns the offset of the first character from offset that is not whitespace.
+func skipPDFSpace(raw []byte, offset int) int {
+	for offset < len(raw) && isPDFSpace(raw[offset]) {
+		offset++
+	}
+	return offset
+}
+
+// pdfDictEnd returns the offset following the ">>" closing the dictionary starting at offset, or
+// -1 and the offset where the scan stopped if it is unterminated: at the endobj keyword ending
+// the object, or at the end of raw. Strings and comments may hold unbalanced delimiters and
+// keywords, and are skipped.
+func pdfDictEnd(raw []byte, offset int) (int, int) {
+	depth := 0
+	for i := offset; i < len(raw); i++ {
+		switch raw[i] {
+		case '(':
+			i = pdfStringEnd(raw, i) - 1
+			if i < 0 {
+				return -1, len(raw)
+			}
+		case '%':
+			for i < len(raw) && raw[i] != '\r' && raw[i] != '\n' {
+				i++
+			}
+		case '<':
+			if i+1 < len(raw) && raw[i+1] == '<' {
+				depth++
+				i++
+				continue
+			}
+			// A hexadecimal string.
+			end := bytes.IndexByte(raw[i:], '>')
+			if end < 0 {
+				return -1, len(raw)
+			}
+			i += end
+		case '>':
+			if i+1 < len(raw) && raw[i+1] == '>' {
+				depth--
+				i++
+				if depth == 0 {
+					return i + 1, i + 1
+				}
+			}
+		case 'e':
+			if bytes.HasPrefix(raw[i:], []byte("endobj")) {
+				return -1, i
+			}
+		}
+	}
+	return -1, len(raw)
+}
+
+// pdfStringEnd returns the offset following the ")" closing the literal string starting at
+// offset, or 0 if it is unterminated. Literal strings may hold balanced parentheses and escaped
+// ones.
+func pdfStringEnd(raw []byte, offset int) int {
+	depth := 0
+	for i := offset; i < len(raw); i++ {
+		switch raw[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+// pdfValueEnd returns the offset following the value of a dictionary entry starting at offset:
+// a dictionary, an array, a name, null, or an indirect reference.
+func pdfValueEnd(raw []byte, offset int) int {
+	offset = skipPDFSpace(raw, offset)
+	switch {
+	case offset >= len(raw):
+		return len(raw)
+	case bytes.HasPrefix(raw[offset:], []byte("<<")):
+		if end, _ := pdfDictEnd(raw, offset); end >= 0 {
+			return end
+		}
+		return offset
+	case raw[offset] == '[':
+		depth := 0
+		for i := offset; i < len(raw); i++ {
+			switch raw[i] {
+			case '[':
+				depth++
+			case ']':
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+		}
+		return offset
+	case raw[offset] == '/':
+		offset++
+	}
+	end := offset
+	for end < len(raw) && !isPDFDelimiter(raw[end]) {
+		end++
+	}
+	if ref := pdfRefTail.FindIndex(raw[end:]); ref != nil {
+		end += ref[1]
+	}
+	return end
+}
@@ -0,0 +1,112 @@
+package exif
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pdfOf returns a PDF document made of the given objects, numbered from 1, with a valid
+// cross-reference table and a trailer referring to the catalog, object 1, and to the document
+// information dictionary, the last object.
+func pdfOf(objects ...string) []byte {
+	buffer := bytes.NewBufferString("%PDF-1.7\n")
+	var offsets []int
+	for i, object := range objects {
+		offsets = append(offsets, buffer.Len())
+		fmt.Fprintf(buffer, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buffer.Len()
+	fmt.Fprintf(buffer, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(buffer, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(buffer, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, len(objects), xref)
+	return buffer.Bytes()
+}
+
+func TestSanitizePDF(t *testing.T) {
+	xmp := `<?xpacket begin=""?><x:xmpmeta xmlns:x="adobe:ns:meta/"><dc:creator>Jane</dc:creator></x:xmpmeta><?xpacket end="w"?>`
+	compressedXMP := string(compressed([]byte(xmp)))
+	content := string(compressed([]byte("BT /F1 12 Tf (Hello) Tj ET")))
+	input := pdfOf(
+		"<< /Type /Catalog /Pages 2 0 R /Metadata 4 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", len(content), content),
+		fmt.Sprintf("<< /Type /Metadata /Subtype /XML /Length %d >>\nstream\n%s\nendstream", len(xmp), xmp),
+		"<< /Type /Metadata /Subtype /XML /Length 6 0 R /Filter [/FlateDecode] /DecodeParms << /Predictor 1 >> >>\nstream\n"+compressedXMP+"\nendstream",
+		"<< /Author (Jane \\(Doe\\)) /Creator (Writer) /CreationDate (D:20240302134530+01'00') /Title <4869> >>",
+	)
+
+	output := new(bytes.Buffer)
+	report, err := Sanitize(bytes.NewReader(input), output)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Format != "pdf" || !report.MetadataRemoved || report.BytesRemoved == 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if output.Len() != len(input) {
+		t.Fatalf("expected the document to keep its size of %d bytes, got %d", len(input), output.Len())
+	}
+
+	sanitized := output.String()
+	for _, removed := range []string{"Jane", "Writer", "D:2024", "/DecodeParms", "/Filter [/FlateDecode]"} {
+		if strings.Contains(sanitized, removed) {
+			t.Errorf("expected %q to be removed, got:\n%s", removed, sanitized)
+		}
+	}
+	for _, kept := range []string{"/Type /Catalog /Pages 2 0 R /Metadata 4 0 R", fmt.Sprintf("/Length %d /Filter /FlateDecode >>\nstream\n%s", len(content), content), "/Type /Metadata /Subtype /XML", "6 0 obj\n<<", "/Info 6 0 R"} {
+		if !strings.Contains(sanitized, kept) {
+			t.Errorf("expected %q to be kept, got:\n%s", kept, sanitized)
+		}
+	}
+}
+
+func TestSanitizePDFWithoutMetadata(t *testing.T) {
+	input := pdfOf(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		"<< /Length 16 >>\nstream\n7 0 obj << /Type\nendstream",
+		"<< /Producer (Writer) >>",
+	)
+	// Drop the information dictionary from the trailer.
+	input = bytes.Replace(input, []byte("/Info 4 0 R"), []byte("           "), 1)
+
+	output := new(bytes.Buffer)
+	report, err := Sanitize(bytes.NewReader(input), output)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.MetadataRemoved || report.BytesRemoved != 0 || !bytes.Equal(input, output.Bytes()) {
+		t.Errorf("expected the document to be copied unchanged, got %+v", report)
+	}
+}
+
+// TestSanitizePDFUnterminated verifies that documents made of unterminated dictionaries and
+// streams are read in a single pass rather than scanned again from each of them.
+func TestSanitizePDFUnterminated(t *testing.T) {
+	testTable := []struct {
+		name   string
+		object string
+	}{
+		{"dictionaries", "1 0 obj <<\n"},
+		{"dictionaries ending with their objects", "1 0 obj << /A (x) endobj\n"},
+		{"strings", "1 0 obj << /A (\n"},
+		{"streams", "1 0 obj << /Length 2 0 R >>\nstream\n"},
+		{"metadata filters", "1 0 obj << /Type /Metadata /Subtype /XML /Filter [ /Length 2 0 R >>\nstream\n"},
+	}
+	for _, test := range testTable {
+		input := append([]byte("%PDF-1.7\n"), bytes.Repeat([]byte(test.object), 1<<20/len(test.object))...)
+		start := time.Now()
+		if _, err := Sanitize(bytes.NewReader(input), io.Discard); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s: expected 1MB to be read in a single pass, took %v", test.name, elapsed)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package exif
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"reflect"
+)
+
+// ErrPixelsChanged is returned by ComparePixels when the pixels of a sanitized copy differ from
+// those of the original image.
+var ErrPixelsChanged = errors.New("the pixels of the image changed")
+
+// ErrNotDecodable is returned by ComparePixels when the original image cannot be decoded, such as
+// images of formats other than JPEG, PNG and GIF.
+var ErrNotDecodable = errors.New("the image cannot be decoded")
+
+// ComparePixels decodes an image and its sanitized copy, and returns an error wrapping
+// ErrPixelsChanged if their pixels differ, or the copy cannot be decoded. Sanitize only removes
+// metadata, so it never changes the pixels of an image, whatever the options: ComparePixels
+// verifies it did not. JPEG, PNG and GIF images are decoded with the standard library, the first
+// frame only of GIF animations; the others return an error wrapping ErrNotDecodable. Decoding
+// takes memory and time proportional to the number of pixels.
+func ComparePixels(original, sanitized []byte) error {
+	want, err := decodePixels(original)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotDecodable, err)
+	}
+	got, err := decodePixels(sanitized)
+	if err != nil {
+		return fmt.Errorf("%w: the sanitized copy cannot be decoded: %v", ErrPixelsChanged, err)
+	}
+	if want.Bounds() != got.Bounds() {
+		return fmt.Errorf("%w: the bounds %v became %v", ErrPixelsChanged, want.Bounds(), got.Bounds())
+	}
+	if reflect.TypeOf(want) != reflect.TypeOf(got) {
+		return fmt.Errorf("%w: the %T image became a %T image", ErrPixelsChanged, want, got)
+	}
+	if !samePixels(want, got) {
+		return fmt.Errorf("%w: the %T pixel buffers differ", ErrPixelsChanged, want)
+	}
+	return nil
+}
+
+// decodePixels decodes a JPEG, PNG or GIF image. Unlike image.Decode, it does not depend on the
+// decoders registered by the program.
+func decodePixels(raw []byte) (image.Image, error) {
+	switch Detect(raw) {
+	case "jpeg":
+		return jpeg.Decode(bytes.NewReader(raw))
+	case "png":
+		return png.Decode(bytes.NewReader(raw))
+	case "gif":
+		return gif.Decode(bytes.NewReader(raw))
+	}
+	return nil, fmt.Errorf("unsupported image format %q", Detect(raw))
+}
+
+// samePixels reports whether images a and b, of the same type and bounds, have identical pixel
+// buffers. Images of types without a known buffer are compared color by color.
+func samePixels(a, b image.Image) bool {
+	switch a := a.(type) {
+	case *image.YCbCr:
+		b := b.(*image.YCbCr)
+		return a.SubsampleRatio == b.SubsampleRatio && bytes.Equal(a.Y, b.Y) && bytes.Equal(a.Cb, b.Cb) && bytes.Equal(a.Cr, b.Cr)
+	case *image.Gray:
+		return bytes.Equal(a.Pix, b.(*image.Gray).Pix)
+	case *image.Gray16:
+		return bytes.Equal(a.Pix, b.(*image.Gray16).Pix)
+	case *image.CMYK:
+		return bytes.Equal(a.Pix, b.(*image.CMYK).Pix)
+	case *image.RGBA:
+		return bytes.Equal(a.Pix, b.(*image.RGBA).Pix)
+	case *image.NRGBA:
+		return bytes.Equal(a.Pix, b.(*image.NRGBA).Pix)
+	case *image.RGBA64:
+		return bytes.Equal(a.Pix, b.(*image.RGBA64).Pix)
+	case *image.NRGBA64:
+		return bytes.Equal(a.Pix, b.(*image.NRGBA64).Pix)
+	case *image.Paletted:
+		b := b.(*image.Paletted)
+		return bytes.Equal(a.Pix, b.Pix) && reflect.DeepEqual(a.Palette, b.Palette)
+	}
+
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if a.At(x, y) != b.At(x, y) {
+				return false
+			}
+		}
+	}
+	return true
+}
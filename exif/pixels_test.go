@@ -0,0 +1,114 @@
+package exif
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"testing"
+)
+
+// assertSamePixels fails the test if the pixels of the sanitized copy output of input differ from
+// those of input, as a regression touching the scan data or image data would make them.
+func assertSamePixels(tb testing.TB, name string, input, output []byte) {
+	tb.Helper()
+	if err := ComparePixels(input, output); err != nil {
+		tb.Errorf("%s: %v", name, err)
+	}
+}
+
+// encodedJPEG returns a JPEG image of a 16x16 gradient, with the given segments following its
+// start of image marker.
+func encodedJPEG(tb testing.TB, segments ...[]byte) []byte {
+	gradient := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			gradient.Set(x, y, color.RGBA{R: uint8(16 * x), G: uint8(16 * y), B: 128, A: 255})
+		}
+	}
+	buffer := new(bytes.Buffer)
+	if err := jpeg.Encode(buffer, gradient, nil); err != nil {
+		tb.Fatalf("failed to encode the image: %v", err)
+	}
+	raw := append([]byte{}, buffer.Bytes()[:2]...)
+	for _, segment := range segments {
+		raw = append(raw, segment...)
+	}
+	return append(raw, buffer.Bytes()[2:]...)
+}
+
+// commentedGIF returns a GIF animation of two frames, with a comment after its global color
+// table.
+func commentedGIF(tb testing.TB) []byte {
+	animation := &gif.GIF{Delay: []int{10, 10}}
+	for i := 0; i < 2; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 4, 2), color.Palette{color.Black, color.White})
+		frame.SetColorIndex(i, 1, 1)
+		animation.Image = append(animation.Image, frame)
+	}
+	buffer := new(bytes.Buffer)
+	if err := gif.EncodeAll(buffer, animation); err != nil {
+		tb.Fatalf("failed to encode the animation: %v", err)
+	}
+	start := 13 + gifColorTableSize(buffer.Bytes()[10])
+	raw := append(append([]byte{}, buffer.Bytes()[:start]...), 0x21, 0xFE, 0x05, 'h', 'e', 'l', 'l', 'o', 0x00)
+	return append(raw, buffer.Bytes()[start:]...)
+}
+
+func TestSanitizeKeepsPixels(t *testing.T) {
+	tiff := exifSegment[4+len(exifIdent):]
+	testTable := []struct {
+		Name    string
+		Input   []byte
+		Options []Option
+	}{
+		{Name: "jpeg", Input: encodedJPEG(t, exifSegment)},
+		{Name: "jpeg with xmp and icc", Input: encodedJPEG(t, xmpSegment, exifSegment, iccSegment(1, 1, []byte("profile"))), Options: []Option{WithICCPolicy(ICCReplaceWithSRGB)}},
+		{Name: "jpeg with c2pa", Input: encodedJPEG(t, app11Segment(1, 1, c2paManifest), exifSegment), Options: []Option{WithC2PAPolicy(C2PAStrip), WithJFIFRegeneration(true)}},
+		{Name: "jpeg with a trailer", Input: append(encodedJPEG(t, exifSegment), "MotionPhoto_Data"...), Options: []Option{WithTrailerRemoval(true)}},
+		{Name: "jpeg with edited timestamps", Input: encodedJPEG(t, exifSegmentOf([]testTag{asciiTag(0x0132, "2024:01:02 03:04:05")}, nil, nil)), Options: []Option{WithTimestampPolicy(TimestampsRemove)}},
+		{Name: "jpeg with removed segments", Input: encodedJPEG(t, xmpSegment, exifSegment), Options: []Option{WithSegmentAction(appMarker, SegmentRemove)}},
+		{Name: "cmyk jpeg", Input: cmykJPEG(exifSegment, adobeSegment(2))},
+		{Name: "png", Input: stillPNG(t, pngChunk("eXIf", tiff), pngChunk("tEXt", []byte("Comment\x00secret")))},
+		{Name: "gif", Input: commentedGIF(t)},
+	}
+
+	for _, test := range testTable {
+		output := new(bytes.Buffer)
+		if _, err := Sanitize(bytes.NewReader(test.Input), output, test.Options...); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if bytes.Equal(test.Input, output.Bytes()) {
+			t.Errorf("%s: expected metadata to be removed", test.Name)
+		}
+		assertSamePixels(t, test.Name, test.Input, output.Bytes())
+	}
+}
+
+func TestComparePixelsErrors(t *testing.T) {
+	input := encodedJPEG(t, exifSegment)
+	// The end of the scan data replaced, keeping the end of image marker.
+	changed := append(append([]byte{}, input[:len(input)-40]...), bytes.Repeat([]byte{0x55}, 38)...)
+	changed = append(changed, 0xFF, 0xD9)
+
+	testTable := []struct {
+		Name      string
+		Original  []byte
+		Sanitized []byte
+		Err       error
+	}{
+		{Name: "changed scan data", Original: input, Sanitized: changed, Err: ErrPixelsChanged},
+		{Name: "truncated", Original: input, Sanitized: input[:len(input)/2], Err: ErrPixelsChanged},
+		{Name: "other image", Original: input, Sanitized: stillPNG(t), Err: ErrPixelsChanged},
+		{Name: "no pixels", Original: jpegOf(exifSegment), Sanitized: jpegOf(), Err: ErrNotDecodable},
+		{Name: "webp", Original: webpOf(webpChunk("VP8L", []byte{0x2F, 0x02, 0x40, 0x00, 0x00})), Sanitized: input, Err: ErrNotDecodable},
+	}
+	for _, test := range testTable {
+		if err := ComparePixels(test.Original, test.Sanitized); !errors.Is(err, test.Err) {
+			t.Errorf("%s: expected an error wrapping %v, got %v", test.Name, test.Err, err)
+		}
+	}
+}
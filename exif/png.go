@@ -0,0 +1,150 @@
+package exif
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"time"
+)
+
+// pngSignature starts every PNG image.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngTextChunks are the chunks holding text: uncompressed, compressed and international text,
+// which hold comments, XMP packets, raw EXIF profiles and other properties.
+var pngTextChunks = map[string]bool{"tEXt": true, "zTXt": true, "iTXt": true}
+
+// pngSRGBChunk declares the image to be in the sRGB color space with the perceptual rendering
+// intent. It takes the place of iCCP chunks replaced with ICCReplaceWithSRGB.
+var pngSRGBChunk = pngChunk("sRGB", []byte{0x00})
+
+// pngChunk returns a PNG chunk of the given type and data.
+func pngChunk(typ string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, typ...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// sanitizePNG removes the eXIf chunk, unless the options edit the EXIF data, the text and time
+// chunks and the ancillary chunks it does not know from the PNG image raw, and applies the ICC
+// policy to its iCCP chunk. The chunks of APNG animations are kept, and so are critical chunks,
+// whatever the actions set for chunk types.
+func sanitizePNG(raw []byte, o *options) ([][]byte, *Report, error) {
+	report := &Report{Format: "png"}
+	parts := [][]byte{}
+	kept := 0
+	animated := false
+	var xmp *Summary
+	for offset := len(pngSignature); ; {
+		if offset+12 > len(raw) {
+			return nil, nil, fmt.Errorf("the PNG image is missing its IEND chunk")
+		}
+		length := int(binary.BigEndian.Uint32(raw[offset:]))
+		typ := string(raw[offset+4 : offset+8])
+		end := offset + 12 + length
+		if length < 0 || end > len(raw) {
+			return nil, nil, fmt.Errorf("the PNG %s chunk at offset %d is truncated", typ, offset)
+		}
+		data := raw[offset+8 : offset+8+length]
+		action := o.chunkAction(typ)
+		if action == SegmentReject {
+			return nil, nil, &ChunkRejectedError{Type: typ, Offset: offset}
+		}
+
+		var replacement []byte
+		remove := false
+		switch {
+		case typ == "IHDR" && length >= 8:
+			report.Width = int(binary.BigEndian.Uint32(data))
+			report.Height = int(binary.BigEndian.Uint32(data[4:]))
+		case typ == "acTL":
+			animated = true
+		case typ == "fcTL" && length >= 26:
+			report.Frames++
+			numerator, denominator := binary.BigEndian.Uint16(data[20:]), binary.BigEndian.Uint16(data[22:])
+			if denominator == 0 {
+				denominator = 100
+			}
+			report.Duration += time.Duration(numerator) * time.Second / time.Duration(denominator)
+		case action == SegmentKeep:
+			o.logf("Keeping the %s chunk at offset %d", typ, offset)
+		case typ == "eXIf":
+			exifOptions := o
+			if action == SegmentRemove {
+				// The EXIF data is removed rather than edited.
+				exifOptions = &options{}
+			}
+			if edited := sanitizeTIFF(data, exifOptions, report); edited != nil {
+				replacement = pngChunk(typ, edited)
+			} else {
+				remove = true
+			}
+		case pngTextChunks[typ]:
+			remove = true
+			report.MetadataRemoved = true
+
+			// Text chunks may hide EXIF data in raw profiles, compressed or not.
+			keyword, text, err := pngText(typ, data)
+			if err != nil {
+				o.logf("Removing the %s chunk as it could not be read: %v", typ, err)
+			} else if keyword == pngXMPKeyword {
+				// Lightroom and Photoshop exports carry the location and the places the image
+				// shows there, even when they hold no EXIF data.
+				o.logf("Found an XMP packet in the %s chunk %q", typ, keyword)
+				xmp = summarizeXMP(text)
+			} else if tiff := rawProfileEXIF(keyword, text); tiff != nil {
+				o.logf("Found EXIF data in the %s chunk %q", typ, keyword)
+				if report.Summary == nil {
+					report.Summary = summarizeTIFF(tiff)
+				}
+				report.ExifRemoved = true
+			}
+		case typ == "tIME":
+			remove = true
+			report.MetadataRemoved = true
+		case typ == "iCCP" && (o.icc != ICCPreserve || action == SegmentRemove):
+			report.ICCRemoved = true
+			if o.icc == ICCReplaceWithSRGB && action != SegmentRemove {
+				replacement = pngSRGBChunk
+				report.SRGBAdded = true
+			} else {
+				remove = true
+			}
+		case typ == "IEND":
+			// The EXIF data, if any, is summarized rather than the XMP packet.
+			if report.Summary == nil {
+				report.Summary = xmp
+			} else if xmp != nil && xmp.GPS {
+				report.Summary.GPS = true
+			}
+			end = trailer(raw, end, o, report)
+			parts = append(parts, raw[kept:end])
+			if !animated {
+				report.Frames, report.Duration = 0, 0
+			}
+			return parts, report, nil
+		case typ == "iCCP":
+		case !isCriticalChunk(typ) && !pngDisplayChunks[typ]:
+			o.logf("Removing the unknown %s chunk at offset %d", typ, offset)
+			remove = true
+			report.MetadataRemoved = true
+		}
+		if action == SegmentRemove && !remove {
+			o.logf("Removing the %s chunk at offset %d", typ, offset)
+			remove, replacement = true, nil
+			report.MetadataRemoved = true
+		}
+
+		if remove || replacement != nil {
+			parts = append(parts, raw[kept:offset])
+			if replacement != nil {
+				parts = append(parts, replacement)
+			} else {
+				report.BytesRemoved += end - offset
+			}
+			kept = end
+		}
+		offset = end
+	}
+}
@@ -0,0 +1,129 @@
+package exif
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pngXMPKeyword is the keyword of the text chunks holding XMP packets, as written by Adobe
+// applications such as Lightroom and Photoshop, usually in an iTXt chunk, compressed or not.
+const pngXMPKeyword = "XML:com.adobe.xmp"
+
+var (
+	// xmpLocationProperty matches the XMP properties recording where an image was taken or what
+	// place it shows: the GPS coordinates of the EXIF schema, and the city, state, country and
+	// locations of the Photoshop and IPTC schemas, which Lightroom fills from the coordinates.
+	xmpLocationProperty = regexp.MustCompile(`\b(?:exif:GPS(?:Latitude|Longitude)|photoshop:(?:City|State|Country)|Iptc4xmpCore:Location|Iptc4xmpExt:Location(?:Created|Shown))\b`)
+
+	// xmpMake and xmpModel match the camera make and model of the TIFF schema, written as
+	// attributes or as elements.
+	xmpMake  = regexp.MustCompile(`tiff:Make(?:="([^"]*)"|>([^<]*)<)`)
+	xmpModel = regexp.MustCompile(`tiff:Model(?:="([^"]*)"|>([^<]*)<)`)
+)
+
+// maxDecompressedSize bounds the size of the compressed text chunks Sanitize decompresses, so
+// that a small chunk cannot expand to exhaust memory.
+const maxDecompressedSize = 8 << 20
+
+// decompress inflates the zlib stream data, failing if it expands past maxDecompressedSize.
+func decompress(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	inflated, err := ioutil.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(inflated) > maxDecompressedSize {
+		return nil, fmt.Errorf("the compressed data exceeds %d bytes", maxDecompressedSize)
+	}
+	return inflated, nil
+}
+
+// pngText returns the keyword and text of a tEXt, zTXt or iTXt chunk, decompressing the text of
+// compressed chunks.
+func pngText(typ string, data []byte) (string, []byte, error) {
+	separator := bytes.IndexByte(data, 0x00)
+	if separator < 0 {
+		return "", nil, fmt.Errorf("the %s chunk has no keyword", typ)
+	}
+	keyword, rest := string(data[:separator]), data[separator+1:]
+
+	switch typ {
+	case "tEXt":
+		return keyword, rest, nil
+	case "zTXt":
+		// A compression method byte precedes the zlib stream.
+		if len(rest) < 1 {
+			return "", nil, fmt.Errorf("the zTXt chunk %q is truncated", keyword)
+		}
+		text, err := decompress(rest[1:])
+		return keyword, text, err
+	case "iTXt":
+		// The compression flag and method precede the language tag and translated keyword.
+		if len(rest) < 2 {
+			return "", nil, fmt.Errorf("the iTXt chunk %q is truncated", keyword)
+		}
+		compressed := rest[0] == 1
+		rest = rest[2:]
+		for i := 0; i < 2; i++ {
+			end := bytes.IndexByte(rest, 0x00)
+			if end < 0 {
+				return "", nil, fmt.Errorf("the iTXt chunk %q is truncated", keyword)
+			}
+			rest = rest[end+1:]
+		}
+		if !compressed {
+			return keyword, rest, nil
+		}
+		text, err := decompress(rest)
+		return keyword, text, err
+	}
+	return "", nil, fmt.Errorf("%s is not a text chunk", typ)
+}
+
+// rawProfileEXIF returns the EXIF data, as a bare TIFF structure, held by a text chunk in the
+// raw profile format written by ImageMagick and exiftool: a newline, the profile name, its
+// length and the profile in hexadecimal. It returns nil if the chunk holds no EXIF data.
+func rawProfileEXIF(keyword string, text []byte) []byte {
+	if keyword != "Raw profile type exif" && keyword != "Raw profile type APP1" {
+		return nil
+	}
+	fields := strings.Fields(string(text))
+	if len(fields) < 3 {
+		return nil
+	}
+	length, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil
+	}
+	profile, err := hex.DecodeString(strings.Join(fields[2:], ""))
+	if err != nil || len(profile) != length {
+		return nil
+	}
+	return bytes.TrimPrefix(profile, exifIdent)
+}
+
+// summarizeXMP returns a summary of the camera and location recorded in an XMP packet.
+func summarizeXMP(packet []byte) *Summary {
+	summary := &Summary{GPS: xmpLocationProperty.Match(packet)}
+	for _, property := range []struct {
+		pattern *regexp.Regexp
+		value   *string
+	}{{xmpMake, &summary.Make}, {xmpModel, &summary.Model}} {
+		if m := property.pattern.FindSubmatch(packet); m != nil {
+			*property.value = strings.TrimSpace(string(m[1]) + string(m[2]))
+		}
+	}
+	return summary
+}
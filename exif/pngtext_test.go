@@ -0,0 +1,148 @@
+package exif
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func compressed(data []byte) []byte {
+	buffer := new(bytes.Buffer)
+	w := zlib.NewWriter(buffer)
+	w.Write(data)
+	w.Close()
+	return buffer.Bytes()
+}
+
+// stillPNG returns a 2x2 PNG image with the given chunks inserted after its IHDR chunk.
+func stillPNG(t testing.TB, chunks ...[]byte) []byte {
+	buffer := new(bytes.Buffer)
+	if err := png.Encode(buffer, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatalf("failed to encode the image: %v", err)
+	}
+	ihdrEnd := len(pngSignature) + 12 + 13
+	raw := append([]byte{}, buffer.Bytes()[:ihdrEnd]...)
+	for _, chunk := range chunks {
+		raw = append(raw, chunk...)
+	}
+	return append(raw, buffer.Bytes()[ihdrEnd:]...)
+}
+
+func TestSanitizePNGText(t *testing.T) {
+	tiff := exifSegmentOf([]testTag{asciiTag(tagMake, "Apple"), asciiTag(tagModel, "iPhone 15")}, nil, nil)[4+len(exifIdent):]
+	profile := fmt.Sprintf("\nexif\n%8d\n%s\n", len(exifIdent)+len(tiff), hex.EncodeToString(append(append([]byte{}, exifIdent...), tiff...)))
+	xmp := []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><exif:GPSLatitude>52,22.5N</exif:GPSLatitude></x:xmpmeta>`)
+	bomb := compressed(make([]byte, maxDecompressedSize+1))
+
+	testTable := []struct {
+		Name    string
+		Chunk   []byte
+		Summary string
+	}{
+		{Name: "compressed xmp", Chunk: pngChunk("zTXt", append([]byte("XML:com.adobe.xmp\x00\x00"), compressed(xmp)...))},
+		{Name: "compressed international xmp", Chunk: pngChunk("iTXt", append([]byte("XML:com.adobe.xmp\x00\x01\x00\x00\x00"), compressed(xmp)...))},
+		{Name: "uncompressed international xmp", Chunk: pngChunk("iTXt", append([]byte("XML:com.adobe.xmp\x00\x00\x00en\x00\x00"), xmp...))},
+		{Name: "compressed raw exif", Chunk: pngChunk("zTXt", append([]byte("Raw profile type exif\x00\x00"), compressed([]byte(profile))...)), Summary: "iPhone 15, GPS: no"},
+		{Name: "raw exif", Chunk: pngChunk("tEXt", append([]byte("Raw profile type APP1\x00"), profile...)), Summary: "iPhone 15, GPS: no"},
+		{Name: "zip bomb", Chunk: pngChunk("zTXt", append([]byte("Comment\x00\x00"), bomb...))},
+		{Name: "corrupt", Chunk: pngChunk("zTXt", []byte("Comment\x00\x00not zlib"))},
+	}
+
+	for _, test := range testTable {
+		output := new(bytes.Buffer)
+		report, err := Sanitize(bytes.NewReader(stillPNG(t, test.Chunk)), output)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if !bytes.Equal(stillPNG(t), output.Bytes()) {
+			t.Errorf("%s: expected the chunk to be removed, got chunks %v", test.Name, pngChunksOf(output.Bytes()))
+		}
+		if !report.MetadataRemoved || report.ExifRemoved != (test.Summary != "") {
+			t.Errorf("%s: unexpected report: %+v", test.Name, report)
+		}
+		if test.Summary != "" && (report.Summary == nil || report.Summary.String() != test.Summary) {
+			t.Errorf("%s: expected summary %q, got %v", test.Name, test.Summary, report.Summary)
+		}
+	}
+}
+
+func TestSanitizePNGXMP(t *testing.T) {
+	xmp := []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:Description tiff:Make="Canon" tiff:Model="Canon EOS R5">` +
+		`<photoshop:City>Amsterdam</photoshop:City></rdf:Description></x:xmpmeta>`)
+	tiff := exifSegmentOf([]testTag{asciiTag(tagModel, "iPhone 15")}, nil, nil)[4+len(exifIdent):]
+
+	testTable := []struct {
+		Name    string
+		Chunks  [][]byte
+		Summary string
+	}{
+		{
+			Name:    "uncompressed",
+			Chunks:  [][]byte{pngChunk("iTXt", append([]byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"), xmp...))},
+			Summary: "Canon EOS R5, GPS: yes",
+		},
+		{
+			Name:    "compressed",
+			Chunks:  [][]byte{pngChunk("iTXt", append([]byte("XML:com.adobe.xmp\x00\x01\x00\x00\x00"), compressed(xmp)...))},
+			Summary: "Canon EOS R5, GPS: yes",
+		},
+		{
+			Name:    "after exif",
+			Chunks:  [][]byte{pngChunk("eXIf", tiff), pngChunk("iTXt", append([]byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"), xmp...))},
+			Summary: "iPhone 15, GPS: yes",
+		},
+	}
+
+	for _, test := range testTable {
+		output := new(bytes.Buffer)
+		report, err := Sanitize(bytes.NewReader(stillPNG(t, test.Chunks...)), output)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if !bytes.Equal(stillPNG(t), output.Bytes()) {
+			t.Errorf("%s: expected the chunks to be removed, got chunks %v", test.Name, pngChunksOf(output.Bytes()))
+		}
+		if report.Summary == nil || report.Summary.String() != test.Summary {
+			t.Errorf("%s: expected summary %q, got %v", test.Name, test.Summary, report.Summary)
+		}
+	}
+}
+
+func TestSanitizePNGICC(t *testing.T) {
+	iccp := pngChunk("iCCP", append([]byte("Display P3\x00\x00"), compressed([]byte("profile"))...))
+	input := stillPNG(t, iccp)
+
+	testTable := []struct {
+		Name   string
+		Policy ICCPolicy
+		Output []byte
+	}{
+		{Name: "preserve", Policy: ICCPreserve, Output: input},
+		{Name: "strip", Policy: ICCStrip, Output: stillPNG(t)},
+		{Name: "replace", Policy: ICCReplaceWithSRGB, Output: stillPNG(t, pngSRGBChunk)},
+	}
+
+	for _, test := range testTable {
+		output := new(bytes.Buffer)
+		report, err := Sanitize(bytes.NewReader(input), output, WithICCPolicy(test.Policy))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if !bytes.Equal(test.Output, output.Bytes()) {
+			t.Errorf("%s: expected chunks %v, got %v", test.Name, pngChunksOf(test.Output), pngChunksOf(output.Bytes()))
+		}
+		if report.ICCRemoved != (test.Policy != ICCPreserve) || report.SRGBAdded != (test.Policy == ICCReplaceWithSRGB) {
+			t.Errorf("%s: unexpected report: %+v", test.Name, report)
+		}
+		if _, err := png.Decode(bytes.NewReader(output.Bytes())); err != nil {
+			t.Errorf("%s: failed to decode the output: %v", test.Name, err)
+		}
+	}
+}
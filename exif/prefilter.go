@@ -0,0 +1,101 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif/jpegseg"
+)
+
+// PrefilterSize is how far into a file NoMetadata looks for the start of the image data.
+const PrefilterSize = 2 << 10
+
+// jfifIdent opens the payload of JFIF APP0 segments.
+var jfifIdent = []byte("JFIF\x00")
+
+// NoMetadata reports whether data is a JPEG or PNG image that definitely carries no metadata, such
+// as a plain screenshot, so that Sanitize would return it unchanged unless its options remove
+// trailing data or set actions for segments or chunks. It is a cheap check for skipping both the
+// parse and the copy of the most common clean uploads: it only reads the headers of the image,
+// which must reach its image data within the first PrefilterSize bytes, and returns false whenever
+// that is not enough to tell, leaving the file to Sanitize.
+//
+// JPEG images qualify if the segments before their start of scan are only tables, frame headers and
+// JFIF APP0 segments: Sanitize never reads past the start of scan. PNG images qualify if their
+// chunks up to IEND are only critical chunks and the ancillary chunks Sanitize keeps, other than
+// iCCP. As text and eXIf chunks may follow the image data, the headers of the chunks after it are
+// read too, skipping over their data.
+func NoMetadata(data []byte) bool {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, jpegseg.SOI}):
+		return jpegHasNoMetadata(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return pngHasNoMetadata(data)
+	}
+	return false
+}
+
+// jpegHasNoMetadata reports whether the segments of the JPEG image raw up to its start of scan,
+// which must start within the first PrefilterSize bytes, hold no metadata.
+func jpegHasNoMetadata(raw []byte) bool {
+	head := raw
+	if len(head) > PrefilterSize {
+		head = head[:PrefilterSize]
+	}
+	for offset := 2; offset+4 <= len(head); {
+		if head[offset] != 0xFF {
+			return false
+		}
+		marker := head[offset+1]
+		if marker == jpegseg.SOS {
+			return true
+		}
+		end := offset + 2 + int(binary.BigEndian.Uint16(head[offset+2:]))
+		if end > len(raw) {
+			return false
+		}
+		switch {
+		case marker == app0Marker:
+			if !bytes.HasPrefix(raw[offset+4:end], jfifIdent) {
+				return false
+			}
+		case marker == 0xDB, marker == 0xC4, marker == 0xDD, marker == 0xCC:
+			// Quantization, Huffman and arithmetic coding tables, and the restart interval.
+		case marker >= 0xC0 && marker <= 0xCF && marker != 0xC8:
+			// Frame headers.
+		default:
+			return false
+		}
+		offset = end
+	}
+	return false
+}
+
+// pngHasNoMetadata reports whether the chunks of the PNG image raw, whose first IDAT chunk must
+// start within the first PrefilterSize bytes, hold no metadata.
+func pngHasNoMetadata(raw []byte) bool {
+	imageData := false
+	for offset := len(pngSignature); offset+12 <= len(raw); {
+		if !imageData && offset >= PrefilterSize {
+			return false
+		}
+		length := int64(binary.BigEndian.Uint32(raw[offset:]))
+		typ := string(raw[offset+4 : offset+8])
+		end := int64(offset) + 12 + length
+		if end > int64(len(raw)) {
+			return false
+		}
+		switch {
+		case typ == "IEND":
+			return imageData
+		case typ == "IDAT":
+			imageData = true
+		case !isPNGChunkType(typ):
+			return false
+		case !isCriticalChunk(typ) && !pngDisplayChunks[typ]:
+			return false
+		}
+		offset = int(end)
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package exif
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNoMetadata(t *testing.T) {
+	jfif := append([]byte{}, jfifSegment...)
+	largeTable := append([]byte{0xFF, 0xDB, 0x08, 0x02}, make([]byte, 0x0800)...)
+	comment := append([]byte{0xFF, 0xFE, 0x00, 0x07}, "hello"...)
+	text := pngChunk("tEXt", []byte("Comment\x00hello"))
+	plainPNG := stillPNG(t, pngChunk("pHYs", make([]byte, 9)))
+	iend := len(plainPNG) - 12
+
+	testTable := []struct {
+		Name  string
+		Input []byte
+		Clean bool
+	}{
+		{Name: "plain jpeg", Input: encodedJPEG(t), Clean: true},
+		{Name: "jfif jpeg", Input: encodedJPEG(t, jfif), Clean: true},
+		{Name: "jpeg with exif", Input: encodedJPEG(t, exifSegment)},
+		{Name: "jpeg with xmp", Input: encodedJPEG(t, xmpSegment)},
+		{Name: "jpeg with a comment", Input: encodedJPEG(t, comment)},
+		{Name: "jpeg with an adobe segment", Input: encodedJPEG(t, adobeSegment(1))},
+		{Name: "jpeg with an icc profile", Input: encodedJPEG(t, iccSegment(1, 1, []byte("profile")))},
+		{Name: "jpeg with headers past the prefilter size", Input: encodedJPEG(t, largeTable)},
+		{Name: "truncated jpeg", Input: []byte{0xFF, 0xD8, 0xFF, 0xDB, 0x00, 0x43}},
+		{Name: "plain png", Input: plainPNG, Clean: true},
+		{Name: "png with text before the image data", Input: stillPNG(t, text)},
+		{Name: "png with text after the image data", Input: append(append(append([]byte{}, plainPNG[:iend]...), text...), plainPNG[iend:]...)},
+		{Name: "png with a time chunk", Input: stillPNG(t, pngChunk("tIME", make([]byte, 7)))},
+		{Name: "png with an exif chunk", Input: stillPNG(t, pngChunk("eXIf", exifSegment[10:]))},
+		{Name: "png with an icc profile", Input: stillPNG(t, pngChunk("iCCP", []byte("icc\x00\x00")))},
+		{Name: "png with a private chunk", Input: stillPNG(t, pngChunk("prVt", nil))},
+		{Name: "truncated png", Input: plainPNG[:iend]},
+		{Name: "gif", Input: []byte("GIF89a")},
+		{Name: "empty", Input: nil},
+	}
+
+	for _, test := range testTable {
+		clean := NoMetadata(test.Input)
+		if clean != test.Clean {
+			t.Errorf("%s: expected %v, got %v", test.Name, test.Clean, clean)
+			continue
+		}
+		if !clean {
+			continue
+		}
+		output := new(bytes.Buffer)
+		if _, err := Sanitize(bytes.NewReader(test.Input), output); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+		} else if !bytes.Equal(output.Bytes(), test.Input) {
+			t.Errorf("%s: expected Sanitize to return the image unchanged", test.Name)
+		}
+	}
+}
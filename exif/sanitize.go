@@ -0,0 +1,416 @@
+package exif
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// Report describes the metadata Sanitize found in an image and what it removed.
+type Report struct {
+	// ExifRemoved is true if an EXIF segment was removed.
+	ExifRemoved bool
+
+	// ExifEdited is true if the EXIF data was kept but edited, as requested by options such as
+	// WithTimestampPolicy, and TagsEdited is the number of tags removed or changed.
+	ExifEdited bool
+	TagsEdited int
+
+	// C2PAFound is true if the image carries a C2PA manifest store, and C2PARemoved is true if
+	// it was removed according to the C2PAPolicy in use.
+	C2PAFound   bool
+	C2PARemoved bool
+
+	// C2PAManifest is the removed manifest store when the C2PAStripAndReport policy is used.
+	C2PAManifest []byte
+
+	// TrailerSize is the size of the data following the end of image marker, such as the
+	// videos of motion photos, and TrailerRemoved is true if it was removed. Trailing data is
+	// only looked for with WithTrailerRemoval or WithTrailerDetection.
+	TrailerSize    int
+	TrailerRemoved bool
+
+	// MotionPhoto is true if the image is a Google or Samsung motion photo, whose video follows
+	// the image as trailing data, and MotionPhotoVideo is that video, if it could be found, which
+	// also needs WithTrailerRemoval or WithTrailerDetection. When
+	// the trailing data is removed, the XMP properties declaring the video are removed too.
+	MotionPhoto      bool
+	MotionPhotoVideo []byte
+
+	// LivePhoto is true if the file carries an identifier pairing an Apple Live Photo with its
+	// video, and PairingRemoved is true if it was removed.
+	LivePhoto      bool
+	PairingRemoved bool
+
+	// ScriptsRemoved is true if scripts were removed from an SVG image, as requested by
+	// WithSVGScriptRemoval.
+	ScriptsRemoved bool
+
+	// JFIFAdded is true if a JFIF APP0 segment was added in place of the removed headers.
+	JFIFAdded bool
+
+	// ICCRemoved is true if an ICC profile was removed, and SRGBAdded is true if a minimal sRGB
+	// profile was embedded in its place.
+	ICCRemoved bool
+	SRGBAdded  bool
+
+	// Summary describes the camera and capture recorded in the EXIF data, if it could be read.
+	Summary *Summary
+
+	// Width and Height are the dimensions of the sanitized image as viewers display it, taking
+	// the orientation recorded in any EXIF data kept into account, or zeros if unknown.
+	Width  int
+	Height int
+
+	// Format is the format of the file: jpeg, png, gif, webp, heic, avif, heif, jp2, jpx, tiff,
+	// bmp, ico, ppm, pgm or svg for images, mp4 or mov for videos, and pdf for documents.
+	Format string
+
+	// MetadataRemoved is true if metadata other than EXIF data was removed from a PNG, GIF, WebP,
+	// JPEG 2000, TIFF or SVG image, such as XMP packets, comments and text chunks, from a video or
+	// PDF document, or from a JPEG image by the actions set with WithSegmentAction.
+	MetadataRemoved bool
+
+	// Frames and Duration are the number of frames of an animated image and the time it takes
+	// to play them once. Both are zero for still images.
+	Frames   int
+	Duration time.Duration
+
+	// BytesRemoved is the total size of the removed segments and trailing data.
+	BytesRemoved int
+}
+
+// Option configures Sanitize.
+type Option func(*options)
+
+type options struct {
+	c2pa           C2PAPolicy
+	icc            ICCPolicy
+	removeTrailer  bool
+	detectTrailer  bool
+	regenerateJFIF bool
+
+	// edits are applied to the EXIF data in place of removing it, if there are any.
+	edits []exifEdit
+
+	// removePairing removes the identifiers pairing Live Photos with their videos.
+	removePairing bool
+
+	// removeScripts removes the scripts of SVG images.
+	removeScripts bool
+
+	// timestamps is the timestamp policy in use, if any, which also applies to the creation
+	// times of videos.
+	timestamps TimestampPolicy
+
+	// logger receives the diagnostics, if any.
+	logger Logger
+
+	// segments are the actions set for the segments of JPEG markers, if any.
+	segments map[byte]SegmentAction
+
+	// chunks are the actions set for the chunks of PNG chunk types, if any.
+	chunks map[string]SegmentAction
+}
+
+// WithC2PAPolicy sets what Sanitize does with C2PA manifests. They are preserved by default.
+func WithC2PAPolicy(policy C2PAPolicy) Option {
+	return func(o *options) {
+		o.c2pa = policy
+	}
+}
+
+// WithTrailerRemoval sets whether Sanitize removes data following the end of image marker.
+// Phones append motion photo videos and other payloads there, which may be large and private.
+// Trailing data is kept by default.
+func WithTrailerRemoval(remove bool) Option {
+	return func(o *options) {
+		o.removeTrailer = remove
+	}
+}
+
+// WithTrailerDetection sets whether Sanitize looks for data following the end of image marker to
+// report it, as the TrailerSize and motion photo fields of the Report do, even if it is kept.
+// Finding it means searching the whole image data for the marker, so that Sanitize only does so
+// if this or WithTrailerRemoval is set, and otherwise copies the image data as it is.
+func WithTrailerDetection(detect bool) Option {
+	return func(o *options) {
+		o.detectTrailer = detect
+	}
+}
+
+// WithJFIFRegeneration sets whether Sanitize adds a minimal JFIF APP0 segment to images left
+// without any APP0 or APP1 header once sanitized, as some viewers and printers rely on one.
+func WithJFIFRegeneration(regenerate bool) Option {
+	return func(o *options) {
+		o.regenerateJFIF = regenerate
+	}
+}
+
+// Sanitize writes to output a copy of the image read from file without its EXIF data, and
+// returns a report of what it found and removed. Unlike Discard, images without EXIF data are
+// copied unchanged rather than rejected. JPEG, PNG, GIF, WebP, HEIF, AVIF, JPEG 2000, TIFF and SVG
+// images are supported, and so are BMP, ICO, PPM and PGM images, which are copied unchanged
+// unless they embed metadata; the frames and timing of animated images are kept. The location and
+// creation times of MP4 and QuickTime videos are removed too, and so are the document information
+// and XMP metadata of PDF documents. The whole file is read into memory; SanitizeSeeker copies the
+// media data of videos straight from the file instead.
+func Sanitize(file io.Reader, output io.Writer, opts ...Option) (*Report, error) {
+	raw, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	return SanitizeBytes(raw, output, opts...)
+}
+
+// SanitizeBytes does the same as Sanitize for callers already holding the image in memory, without
+// copying it: the parts of raw left unchanged are written straight to output. Unlike
+// DiscardBytes, raw is left unchanged, and may be used afterwards. Nothing is written to output
+// until the whole image has been parsed.
+func SanitizeBytes(raw []byte, output io.Writer, opts ...Option) (*Report, error) {
+	parts, report, err := sanitize(raw, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeParts(output, parts); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// sanitize returns the parts of the sanitized image, in order, and a report of what was removed.
+// The parts are slices of raw, except for segments synthesized in place of removed ones.
+func sanitize(raw []byte, opts []Option) ([][]byte, *Report, error) {
+	o := newOptions(opts)
+	switch {
+	case bytes.HasPrefix(raw, pngSignature):
+		return sanitizePNG(raw, o)
+	case isGIF(raw):
+		return sanitizeGIF(raw, o)
+	case isWebP(raw):
+		return sanitizeWebP(raw, o)
+	case isMP4(raw):
+		return sanitizeMP4(raw, o)
+	case isJP2(raw):
+		return sanitizeJP2(raw, o)
+	case isTIFF(raw):
+		return sanitizeTIFFImage(raw, o)
+	case isBMP(raw):
+		return sanitizeBMP(raw, o)
+	case isICO(raw):
+		return sanitizeICO(raw, o)
+	case isNetpbm(raw):
+		return sanitizeNetpbm(raw, o)
+	case isPDF(raw):
+		return sanitizePDF(raw, o)
+	case isSVG(raw):
+		return sanitizeSVG(raw, o)
+	}
+	return sanitizeJPEG(raw, o)
+}
+
+// newOptions returns the options configured by opts.
+func newOptions(opts []Option) *options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.removePairing && len(o.edits) > 0 {
+		o.edits = append(o.edits, removeTags(exifIFD, tagMakerNote))
+	}
+	return &o
+}
+
+// sanitizeJPEG sanitizes the JPEG image raw, which sanitize does for images of no other format.
+func sanitizeJPEG(raw []byte, o *options) ([][]byte, *Report, error) {
+	segments, err := readSegments(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, s := range segments {
+		if o.segmentAction(s.marker) == SegmentReject {
+			return nil, nil, &SegmentRejectedError{Marker: s.marker, Offset: s.start}
+		}
+	}
+
+	report := &Report{Format: "jpeg"}
+	report.Width, report.Height = frameSize(raw, segments)
+	drop := make(map[int]bool)
+	replace := make(map[int][]byte)
+	for _, s := range segments {
+		if s.marker != appMarker || !bytes.HasPrefix(s.payload(raw), exifIdent) {
+			continue
+		}
+		o.logf("Found EXIF segment at offsets %d-%d", s.start, s.end)
+		exifOptions := o
+		switch o.segmentAction(s.marker) {
+		case SegmentKeep:
+			continue
+		case SegmentRemove:
+			// The EXIF data is removed rather than edited.
+			exifOptions = &options{}
+		}
+		header := s.start + 4 + len(exifIdent)
+		if edited := sanitizeTIFF(raw[header:s.end], exifOptions, report); edited != nil {
+			replace[s.start] = append(append([]byte{}, raw[s.start:header]...), edited...)
+			continue
+		}
+		drop[s.start] = true
+	}
+
+	c2paSegments, manifest := findC2PA(raw, segments)
+	report.C2PAFound = len(c2paSegments) > 0
+	c2paAction := o.segmentAction(app11Marker)
+	if report.C2PAFound && c2paAction != SegmentKeep && (o.c2pa != C2PAPreserve || c2paAction == SegmentRemove) {
+		o.logf("Found C2PA manifest store in %d segments", len(c2paSegments))
+		for _, s := range c2paSegments {
+			drop[s.start] = true
+		}
+		report.C2PARemoved = true
+		if o.c2pa == C2PAStripAndReport {
+			report.C2PAManifest = manifest
+		}
+	}
+
+	iccAction := o.segmentAction(app2Marker)
+	if iccAction != SegmentKeep && (o.icc != ICCPreserve || iccAction == SegmentRemove) {
+		for _, s := range segments {
+			if !isICCProfile(raw, s) {
+				continue
+			}
+			// All chunks of the profile are removed, and the first one replaced if requested.
+			if o.icc == ICCReplaceWithSRGB && iccAction != SegmentRemove && !report.SRGBAdded {
+				o.logf("Replacing the ICC profile with a minimal sRGB profile")
+				replace[s.start] = srgbSegment
+				report.SRGBAdded = true
+			} else {
+				drop[s.start] = true
+			}
+			report.ICCRemoved = true
+		}
+	}
+
+	// The actions set for markers override the decisions above.
+	for _, s := range segments {
+		switch o.segmentAction(s.marker) {
+		case SegmentKeep:
+			delete(drop, s.start)
+			delete(replace, s.start)
+		case SegmentRemove:
+			report.MetadataRemoved = report.MetadataRemoved || !drop[s.start]
+			drop[s.start] = true
+			delete(replace, s.start)
+		}
+	}
+
+	// Whatever the options, never remove the Adobe color transform.
+	for _, s := range segments {
+		if isAdobeTransform(raw, s) {
+			delete(drop, s.start)
+		}
+	}
+
+	// The image data follows the last segment read, up to the end of image marker, and is copied
+	// as it is unless the data following that marker is to be removed or reported.
+	end := len(raw)
+	dataStart := 2
+	if len(segments) > 0 {
+		dataStart = segments[len(segments)-1].end
+	}
+	if o.removeTrailer || o.detectTrailer {
+		if eoi := imageEnd(raw, dataStart); eoi > 0 {
+			end = trailer(raw, eoi, o, report)
+		}
+		findMotionPhoto(raw, segments, replace, o, report)
+	}
+
+	// Keep everything but the dropped and replaced segments, including the image data after the
+	// last one.
+	parts := [][]byte{raw[:2]}
+	offset := 2
+	if o.regenerateJFIF && needsJFIF(raw, segments, drop) {
+		o.logf("Adding a JFIF APP0 segment in place of the removed headers")
+		parts = append(parts, jfifSegment)
+		report.JFIFAdded = true
+	}
+	for _, s := range segments {
+		replacement, replaced := replace[s.start]
+		switch {
+		case replaced:
+			o.logf("Replacing the %s segment at offsets %d-%d", markerName(s.marker), s.start, s.end)
+		case drop[s.start]:
+			o.logf("Removing the %s segment at offsets %d-%d", markerName(s.marker), s.start, s.end)
+		default:
+			o.logf("Keeping the %s segment at offsets %d-%d", markerName(s.marker), s.start, s.end)
+			continue
+		}
+		if offset < s.start {
+			parts = append(parts, raw[offset:s.start])
+		}
+		if replaced {
+			parts = append(parts, replacement)
+		} else {
+			report.BytesRemoved += s.end - s.start
+		}
+		offset = s.end
+	}
+	parts = append(parts, raw[offset:end])
+
+	return parts, report, nil
+}
+
+// trailer records the data following the end of the image at offset end in the report, and
+// returns where the sanitized image ends: after the trailer, unless it is removed.
+func trailer(raw []byte, end int, o *options, report *Report) int {
+	if end >= len(raw) {
+		return len(raw)
+	}
+	report.TrailerSize = len(raw) - end
+	o.logf("Found %d bytes of trailing data after offset %d", report.TrailerSize, end)
+	if !o.removeTrailer {
+		return len(raw)
+	}
+	report.TrailerRemoved = true
+	report.BytesRemoved += report.TrailerSize
+	return end
+}
+
+// sanitizeTIFF applies the options to EXIF data stored as a bare TIFF structure, as in PNG and
+// WebP images, and records what it did in the report. It returns the edited data, or nil if the
+// EXIF data is to be removed.
+func sanitizeTIFF(data []byte, o *options, report *Report) []byte {
+	if report.Summary == nil {
+		report.Summary = summarizeTIFF(data)
+	}
+	livePhoto := hasContentIdentifier(data)
+	report.LivePhoto = report.LivePhoto || livePhoto
+	if len(o.edits) > 0 {
+		edited, n, err := editTIFF(data, o.edits)
+		if err == nil {
+			if !report.ExifEdited && orientation(edited) >= 5 {
+				report.Width, report.Height = report.Height, report.Width
+			}
+			report.ExifEdited = true
+			report.TagsEdited += n
+			report.PairingRemoved = report.PairingRemoved || (livePhoto && !hasContentIdentifier(edited))
+			return edited
+		}
+		o.logf("Removing the EXIF data as it could not be edited: %v", err)
+	}
+	report.ExifRemoved = true
+	report.PairingRemoved = report.PairingRemoved || livePhoto
+	return nil
+}
+
+// writeParts writes the given parts of an image to output.
+func writeParts(output io.Writer, parts [][]byte) error {
+	for _, part := range parts {
+		if _, err := output.Write(part); err != nil {
+			return fmt.Errorf("an error occurred while writing the image: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif/bmff"
+	"github.com/nimrodshn/mattermost-exif-plugin/exif/jpegseg"
+)
+
+// DiscardSeeker writes to w a copy of the image read from rs without its EXIF data, as Discard
+// does, but without reading JPEG images into memory: it reads the headers of their segments,
+// seeking over their payloads, and then copies the regions between the EXIF segments directly from
+// rs to w. Images of other formats are read into memory and handled by Discard. The image starts
+// at the current offset of rs.
+func DiscardSeeker(rs io.ReadSeeker, w io.Writer) error {
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	var signature [3]byte
+	n, err := io.ReadFull(rs, signature[:])
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	if !bytes.Equal(signature[:n], []byte{markerPrefix, soiMarker, markerPrefix}) {
+		return Discard(rs, w)
+	}
+
+	drops, err := seekEXIFSegments(rs, start)
+	if err != nil {
+		return err
+	}
+	if len(drops) == 0 {
+		return ErrNoExif
+	}
+
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	offset := start
+	for _, drop := range drops {
+		if _, err := io.CopyN(w, rs, drop[0]-offset); err != nil {
+			return unexpectedEOF(err)
+		}
+		if offset, err = rs.Seek(drop[1], io.SeekStart); err != nil {
+			return err
+		}
+	}
+	_, err = io.Copy(w, rs)
+	return err
+}
+
+// seekEXIFSegments reads the headers of the segments of the JPEG image starting at offset start
+// of rs, up to its start of scan segment, and returns where its EXIF segments start and end. Only
+// the identifiers of APP1 segments are read; the other payloads are skipped by seeking, once their
+// length has been checked against the size of rs.
+func seekEXIFSegments(rs io.ReadSeeker, start int64) ([][2]int64, error) {
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := rs.Seek(start+2, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	var drops [][2]int64
+	buf := make([]byte, len(exifIdent))
+	for {
+		if _, err := io.ReadFull(rs, buf[:2]); err != nil {
+			return nil, fmt.Errorf("%w before the start of scan", ErrTruncated)
+		}
+		if buf[0] != markerPrefix {
+			return nil, fmt.Errorf("%w: expected a marker at offset %d", ErrMalformed, offset-start)
+		}
+		// Markers may be preceded by any number of fill bytes.
+		marker := buf[1]
+		for marker == markerPrefix {
+			offset++
+			if _, err := io.ReadFull(rs, buf[1:2]); err != nil {
+				return nil, fmt.Errorf("%w before the start of scan", ErrTruncated)
+			}
+			marker = buf[1]
+		}
+		switch {
+		case marker == jpegseg.SOS || marker == jpegseg.EOI:
+			return drops, nil
+		case marker == jpegseg.SOI:
+			return nil, fmt.Errorf("%w: unexpected start of image marker at offset %d", ErrMalformed, offset-start)
+		case jpegseg.IsStandalone(marker):
+			offset += 2
+			continue
+		}
+
+		if _, err := io.ReadFull(rs, buf[:2]); err != nil {
+			return nil, fmt.Errorf("%w in segment at offset %d", ErrTruncated, offset-start)
+		}
+		length := int64(binary.BigEndian.Uint16(buf))
+		if length < 2 {
+			return nil, fmt.Errorf("%w: invalid length %d of the segment at offset %d", ErrMalformed, length, offset-start)
+		}
+		end := offset + 2 + length
+		if end > size {
+			return nil, fmt.Errorf("%w in segment at offset %d: its payload of %d bytes exceeds the %d bytes left", ErrTruncated, offset-start, length-2, size-offset-4)
+		}
+		if marker == jpegseg.APP1 && length-2 >= int64(len(exifIdent)) {
+			if _, err := io.ReadFull(rs, buf); err != nil {
+				return nil, fmt.Errorf("%w in segment at offset %d", ErrTruncated, offset-start)
+			}
+			if bytes.Equal(buf, exifIdent) {
+				drops = append(drops, [2]int64{offset, end})
+			}
+		}
+		if offset, err = rs.Seek(end, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// maxSeekerBoxes bounds the top-level boxes of the videos SanitizeSeeker reads, so that crafted
+// files made of many small boxes cannot exhaust the memory.
+const maxSeekerBoxes = 10000
+
+// mp4PassThrough are the top-level boxes of videos SanitizeSeeker copies without reading them: the
+// media data, and free space.
+var mp4PassThrough = map[string]bool{"mdat": true, "free": true, "skip": true, "wide": true}
+
+// SanitizeSeeker writes to output a copy of the file read from rs without its metadata, as
+// Sanitize does, but without reading the media data of MP4 and QuickTime videos into memory: it
+// reads the headers of their top-level boxes, seeking over their payloads, sanitizes the boxes
+// other than the media data and free space, such as the movie box, and then copies the media data
+// straight from rs to output. Files of other formats, including HEIF and AVIF images, whose items
+// are located in the media data, are read into memory and handled by Sanitize. The file starts at
+// the current offset of rs. Nothing is written to output until the boxes have been sanitized.
+func SanitizeSeeker(rs io.ReadSeeker, output io.Writer, opts ...Option) (*Report, error) {
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, 12)
+	n, err := io.ReadFull(rs, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if !isMP4(head[:n]) || heifFormat(head) != "" {
+		return Sanitize(rs, output, opts...)
+	}
+
+	boxes, err := seekBoxes(rs, start)
+	if err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
+	m := newMP4Sanitizer(head, o)
+	// parts holds the sanitized copy of each box read, and nil for those copied as they are.
+	parts := make([][][]byte, len(boxes))
+	for i, b := range boxes {
+		if mp4PassThrough[b.Type] {
+			continue
+		}
+		box := make([]byte, b.Size())
+		if _, err := rs.Seek(start+int64(b.Start), io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(rs, box); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		// The box is sanitized on its own, from offset 0.
+		m.raw, m.edits = box, &splice{raw: box}
+		if err := m.walk(0, len(box)); err != nil {
+			return nil, fmt.Errorf("the %q box at offset %d: %w", b.Type, b.Start, err)
+		}
+		parts[i] = m.edits.parts()
+	}
+
+	for i, b := range boxes {
+		if parts[i] != nil {
+			if err := writeParts(output, parts[i]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		o.logf("Copying the %q box of %d bytes at offset %d", b.Type, b.Size(), b.Start)
+		if _, err := rs.Seek(start+int64(b.Start), io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.CopyN(output, rs, int64(b.Size())); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	}
+	return m.report, nil
+}
+
+// seekBoxes reads the headers of the top-level boxes of the ISO base media file starting at
+// offset start of rs, seeking over their payloads, and returns them, with offsets from start.
+// Boxes of size 0 extend to the end of rs, and boxes of size 1 have a 64 bit size following their
+// type, as bmff.ReadBoxes reads them.
+func seekBoxes(rs io.ReadSeeker, start int64) ([]bmff.Box, error) {
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	size := end - start
+	var boxes []bmff.Box
+	header := make([]byte, 16)
+	for offset := int64(0); offset < size; {
+		if len(boxes) == maxSeekerBoxes {
+			return nil, malformed("the file has more than %d boxes", maxSeekerBoxes)
+		}
+		if _, err := rs.Seek(start+offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if offset+8 > size {
+			return nil, fmt.Errorf("%w: the box at offset %d is truncated", ErrTruncated, offset)
+		}
+		if _, err := io.ReadFull(rs, header[:8]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header))
+		b := bmff.Box{Type: string(header[4:8]), Start: int(offset), Payload: int(offset) + 8}
+		switch boxSize {
+		case 0:
+			boxSize = size - offset
+		case 1:
+			if offset+16 > size {
+				return nil, fmt.Errorf("%w: the %q box at offset %d is truncated", ErrTruncated, b.Type, offset)
+			}
+			if _, err := io.ReadFull(rs, header[8:16]); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			large := binary.BigEndian.Uint64(header[8:])
+			if large > uint64(size-offset) {
+				return nil, malformed("the %q box at offset %d has invalid size %d", b.Type, offset, large)
+			}
+			boxSize = int64(large)
+			b.Payload += 8
+		}
+		if boxSize < int64(b.Payload-b.Start) || boxSize > size-offset {
+			return nil, malformed("the %q box at offset %d has invalid size %d", b.Type, offset, boxSize)
+		}
+		b.End = int(offset + boxSize)
+		boxes = append(boxes, b)
+		offset += boxSize
+	}
+	return boxes, nil
+}
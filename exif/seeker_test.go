@@ -0,0 +1,177 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestDiscardSeeker(t *testing.T) {
+	filled := jpegOf(xmpSegment, exifSegment)
+	// Fill bytes before the marker of the EXIF segment.
+	filled = append(append(append([]byte{}, filled[:2+len(xmpSegment)]...), 0xFF, 0xFF), filled[2+len(xmpSegment):]...)
+	trailing := append(jpegOf(exifSegment, jfifSegment, exifSegment), "MotionPhoto_Data"...)
+
+	testTable := []struct {
+		name  string
+		input []byte
+	}{
+		{"exif only", jpegOf(exifSegment)},
+		{"xmp before exif", jpegOf(xmpSegment, exifSegment)},
+		{"fill bytes", filled},
+		{"several segments and trailer", trailing},
+		{"png", stillPNG(t, pngChunk("eXIf", exifSegment[4+len(exifIdent):]))},
+	}
+	for _, test := range testTable {
+		expected := new(bytes.Buffer)
+		if err := Discard(bytes.NewReader(test.input), expected); err != nil {
+			t.Fatalf("%s: unexpected error from Discard: %v", test.name, err)
+		}
+
+		// The image starts at the current offset of the reader.
+		r := bytes.NewReader(append([]byte("prefix"), test.input...))
+		r.Seek(int64(len("prefix")), io.SeekStart)
+		output := new(bytes.Buffer)
+		if err := DiscardSeeker(r, output); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(expected.Bytes(), output.Bytes()) {
+			t.Errorf("%s: expected %x, got %x", test.name, expected.Bytes(), output.Bytes())
+		}
+	}
+}
+
+func TestDiscardSeekerErrors(t *testing.T) {
+	// An APP2 segment declaring more bytes than the file holds, followed by the EXIF segment.
+	pastEnd := jpegOf([]byte{0xFF, 0xE2, 0xFF, 0xFF, 'I', 'C', 'C'}, exifSegment)
+
+	testTable := []struct {
+		name  string
+		input []byte
+		kind  error
+	}{
+		{"no exif", jpegOf(xmpSegment), ErrNoExif},
+		{"truncated segment", jpegOf(exifSegment)[:20], ErrTruncated},
+		{"length past the end", pastEnd, ErrTruncated},
+		{"missing marker", append(jpegOf(exifSegment)[:len(exifSegment)+2], 0x00, 0x01), ErrMalformed},
+		{"not an image", []byte("hello"), nil},
+	}
+	for _, test := range testTable {
+		output := new(bytes.Buffer)
+		err := DiscardSeeker(bytes.NewReader(test.input), output)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		if test.kind != nil && !errors.Is(err, test.kind) {
+			t.Errorf("%s: expected an error wrapping %v, got %v", test.name, test.kind, err)
+		}
+		if output.Len() != 0 {
+			t.Errorf("%s: expected nothing to be written, got %x", test.name, output.Bytes())
+		}
+	}
+}
+
+// readRecorder is a ReadSeeker recording the largest read from it.
+type readRecorder struct {
+	*bytes.Reader
+	largest int
+}
+
+func (r *readRecorder) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.largest = max(r.largest, n)
+	return n, err
+}
+
+func TestSanitizeSeeker(t *testing.T) {
+	frames := bytes.Repeat([]byte("frames"), 50000)
+	moov := mp4BoxOf("moov",
+		mp4Header("mvhd", mp4Time),
+		mp4BoxOf("trak", mp4Header("tkhd", mp4Time), mp4BoxOf("mdia", mp4Header("mdhd", mp4Time))),
+		quickTimeMeta(
+			"com.apple.quicktime.location.ISO6709", "+52.3700+004.8900+001.000/",
+			"com.apple.quicktime.creationdate", "2024-03-02T14:45:30+0100",
+		),
+	)
+	iphone := append(mp4BoxOf("ftyp", []byte("qt  \x00\x00\x00\x00qt  ")), mp4BoxOf("mdat", frames)...)
+	iphone = append(append(iphone, moov...), mp4BoxOf("free", make([]byte, 16))...)
+	// The media data box has a 64 bit size and extends to the end of the file.
+	large := append(mp4BoxOf("ftyp", []byte("isom\x00\x00\x00\x00isom")), moov...)
+	large = append(append(large, 0, 0, 0, 1, 'm', 'd', 'a', 't'), binary.BigEndian.AppendUint64(nil, uint64(16+len(frames)))...)
+	large = append(large, frames...)
+	toEnd := append(append(mp4BoxOf("ftyp", []byte("isom\x00\x00\x00\x00isom")), moov...), 0, 0, 0, 0, 'm', 'd', 'a', 't')
+	toEnd = append(toEnd, frames...)
+
+	testTable := []struct {
+		name   string
+		input  []byte
+		frames bool // Whether the input holds frames SanitizeSeeker must not read at once.
+	}{
+		{"quicktime", iphone, true},
+		{"64 bit size", large, true},
+		{"media data to the end", toEnd, true},
+		{"jpeg", jpegOf(xmpSegment, exifSegment), false},
+		{"png", stillPNG(t, pngChunk("eXIf", exifSegment[4+len(exifIdent):])), false},
+	}
+	for _, test := range testTable {
+		expected := new(bytes.Buffer)
+		expectedReport, err := Sanitize(bytes.NewReader(test.input), expected)
+		if err != nil {
+			t.Fatalf("%s: unexpected error from Sanitize: %v", test.name, err)
+		}
+
+		// The file starts at the current offset of the reader.
+		input := append([]byte("prefix"), test.input...)
+		r := &readRecorder{Reader: bytes.NewReader(input)}
+		r.Seek(int64(len("prefix")), io.SeekStart)
+		output := new(bytes.Buffer)
+		report, err := SanitizeSeeker(r, output)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(expected.Bytes(), output.Bytes()) {
+			t.Errorf("%s: expected %x, got %x", test.name, expected.Bytes(), output.Bytes())
+		}
+		if !reflect.DeepEqual(expectedReport, report) {
+			t.Errorf("%s: expected report %+v, got %+v", test.name, expectedReport, report)
+		}
+		// The frames are copied through the buffer of io.CopyN rather than read at once.
+		if test.frames && r.largest >= len(frames) {
+			t.Errorf("%s: expected the frames to be copied, got a read of %d bytes", test.name, r.largest)
+		}
+	}
+}
+
+func TestSanitizeSeekerErrors(t *testing.T) {
+	ftyp := mp4BoxOf("ftyp", []byte("isom\x00\x00\x00\x00isom"))
+	many := append([]byte{}, ftyp...)
+	for i := 0; i < maxSeekerBoxes; i++ {
+		many = append(many, mp4BoxOf("free")...)
+	}
+
+	testTable := []struct {
+		name  string
+		input []byte
+		kind  error
+	}{
+		{"truncated header", append(append([]byte{}, ftyp...), 0, 0, 0), ErrTruncated},
+		{"size past the end", append(append([]byte{}, ftyp...), 0, 0, 1, 0, 'm', 'd', 'a', 't'), ErrMalformed},
+		{"size below the header", append(append([]byte{}, ftyp...), 0, 0, 0, 4, 'm', 'd', 'a', 't'), ErrMalformed},
+		{"too many boxes", many, ErrMalformed},
+	}
+	for _, test := range testTable {
+		output := new(bytes.Buffer)
+		_, err := SanitizeSeeker(bytes.NewReader(test.input), output)
+		if !errors.Is(err, test.kind) {
+			t.Errorf("%s: expected an error wrapping %v, got %v", test.name, test.kind, err)
+		}
+		if output.Len() != 0 {
+			t.Errorf("%s: expected nothing to be written, got %x", test.name, output.Bytes())
+		}
+	}
+}
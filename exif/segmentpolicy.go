@@ -0,0 +1,133 @@
+package exif
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SegmentAction is what Sanitize does with the APPn or COM segments of a marker of JPEG images,
+// whatever they hold, for uses with unusual requirements, such as keeping the ICC profiles of
+// APP2 segments and removing every other application segment.
+type SegmentAction int
+
+const (
+	// SegmentDefault leaves the segments to the other options. It is the default.
+	SegmentDefault SegmentAction = iota
+
+	// SegmentKeep keeps the segments, even those holding EXIF data, C2PA manifests or ICC
+	// profiles the other options would remove.
+	SegmentKeep
+
+	// SegmentRemove removes the segments.
+	SegmentRemove
+
+	// SegmentReject makes Sanitize fail with a *SegmentRejectedError for images carrying one.
+	SegmentReject
+)
+
+// String returns the name of the action as used in configuration files and flags.
+func (a SegmentAction) String() string {
+	switch a {
+	case SegmentDefault:
+		return "default"
+	case SegmentKeep:
+		return "keep"
+	case SegmentRemove:
+		return "remove"
+	case SegmentReject:
+		return "reject"
+	}
+	return "unknown"
+}
+
+// ParseSegmentAction returns the action with the given name: default, keep, remove or reject.
+func ParseSegmentAction(name string) (SegmentAction, bool) {
+	for _, action := range []SegmentAction{SegmentDefault, SegmentKeep, SegmentRemove, SegmentReject} {
+		if action.String() == name {
+			return action, true
+		}
+	}
+	return SegmentDefault, false
+}
+
+// WithSegmentAction sets what Sanitize does with the segments of a marker of JPEG images: one of
+// the APP0 to APP15 markers, 0xE0 to 0xEF, or the COM marker, 0xFE. Other markers are ignored,
+// as images cannot be decoded without their segments, and so is the Adobe color transform of
+// APP14 segments. The action overrides the other options for these segments.
+func WithSegmentAction(marker byte, action SegmentAction) Option {
+	return func(o *options) {
+		if !isPolicyMarker(marker) {
+			return
+		}
+		if o.segments == nil {
+			o.segments = make(map[byte]SegmentAction)
+		}
+		o.segments[marker] = action
+	}
+}
+
+// ParseSegmentPolicy returns the options applying a policy written as a comma separated list of
+// markers and actions, such as "APP2=keep, APP13=remove, COM=reject". Markers are APP0 to APP15
+// or COM, and actions default, keep, remove or reject, as ParseSegmentAction accepts.
+func ParseSegmentPolicy(policy string) ([]Option, error) {
+	var opts []Option
+	for _, rule := range strings.Split(policy, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		name, actionName, found := strings.Cut(rule, "=")
+		if !found {
+			return nil, fmt.Errorf("expected marker=action, got %q", rule)
+		}
+		marker, ok := parseMarkerName(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown marker %q, expected APP0 to APP15 or COM", strings.TrimSpace(name))
+		}
+		action, ok := ParseSegmentAction(strings.ToLower(strings.TrimSpace(actionName)))
+		if !ok {
+			return nil, fmt.Errorf("unknown action %q for %s, expected default, keep, remove or reject", strings.TrimSpace(actionName), markerName(marker))
+		}
+		opts = append(opts, WithSegmentAction(marker, action))
+	}
+	return opts, nil
+}
+
+// parseMarkerName returns the marker named APP0 to APP15 or COM, in any case.
+func parseMarkerName(name string) (byte, bool) {
+	name = strings.ToUpper(name)
+	if name == "COM" {
+		return comMarker, true
+	}
+	if !strings.HasPrefix(name, "APP") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(name[3:])
+	if err != nil || n < 0 || n > 15 || name[3:] != strconv.Itoa(n) {
+		return 0, false
+	}
+	return byte(0xE0 + n), true
+}
+
+// isPolicyMarker reports whether marker is one whose segments a SegmentAction applies to.
+func isPolicyMarker(marker byte) bool {
+	return (marker >= 0xE0 && marker <= 0xEF) || marker == comMarker
+}
+
+// segmentAction returns the action set for the segments of marker.
+func (o *options) segmentAction(marker byte) SegmentAction {
+	return o.segments[marker]
+}
+
+// SegmentRejectedError is the error of Sanitize for a JPEG image carrying a segment whose marker
+// is set to SegmentReject.
+type SegmentRejectedError struct {
+	// Marker is the marker of the segment, and Offset where it starts in the image.
+	Marker byte
+	Offset int
+}
+
+func (e *SegmentRejectedError) Error() string {
+	return fmt.Sprintf("the %s segment at offset %d is not allowed", markerName(e.Marker), e.Offset)
+}
@@ -0,0 +1,113 @@
+package exif
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSanitizeSegmentPolicy(t *testing.T) {
+	profile := iccSegment(1, 1, []byte("Display P3"))
+	comment := append([]byte{0xFF, 0xFE, 0x00, 0x07}, []byte("hello")...)
+	photoshop := append([]byte{0xFF, 0xED, 0x00, 0x06}, []byte("8BIM")...)
+	input := jpegOf(exifSegment, profile, photoshop, comment)
+
+	testTable := []struct {
+		Name     string
+		Policy   string
+		Output   []byte
+		Exif     bool
+		ICC      bool
+		Metadata bool
+	}{
+		{
+			Name:   "default",
+			Output: jpegOf(profile, photoshop, comment),
+			Exif:   true,
+		},
+		{
+			Name:     "keep APP2 and drop everything else",
+			Policy:   "APP1=remove, APP2=keep, APP13=remove, COM=remove",
+			Output:   jpegOf(profile),
+			Exif:     true,
+			Metadata: true,
+		},
+		{
+			Name:   "keep EXIF",
+			Policy: "app1=keep",
+			Output: input,
+		},
+		{
+			Name:   "remove profile",
+			Policy: "APP2=remove",
+			Output: jpegOf(photoshop, comment),
+			Exif:   true,
+			ICC:    true,
+		},
+	}
+
+	for _, test := range testTable {
+		opts, err := ParseSegmentPolicy(test.Policy)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		output := new(bytes.Buffer)
+		report, err := Sanitize(bytes.NewReader(input), output, opts...)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if !bytes.Equal(test.Output, output.Bytes()) {
+			t.Errorf("%s: expected result to be: %x instead got: %x", test.Name, test.Output, output.Bytes())
+		}
+		if report.ExifRemoved != test.Exif || report.ICCRemoved != test.ICC || report.MetadataRemoved != test.Metadata {
+			t.Errorf("%s: unexpected report: %+v", test.Name, report)
+		}
+		if report.BytesRemoved != len(input)-output.Len() {
+			t.Errorf("%s: expected %d bytes removed, got %d", test.Name, len(input)-output.Len(), report.BytesRemoved)
+		}
+	}
+}
+
+func TestSanitizeSegmentRejected(t *testing.T) {
+	comment := append([]byte{0xFF, 0xFE, 0x00, 0x07}, []byte("hello")...)
+	_, err := Sanitize(bytes.NewReader(jpegOf(exifSegment, comment)), new(bytes.Buffer), WithSegmentAction(comMarker, SegmentReject))
+	var rejected *SegmentRejectedError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("expected the image to be rejected, got %v", err)
+	}
+	if rejected.Marker != comMarker || rejected.Offset != 2+len(exifSegment) {
+		t.Errorf("unexpected error: %+v", rejected)
+	}
+	if err.Error() != "the COM segment at offset 38 is not allowed" {
+		t.Errorf("unexpected message: %v", err)
+	}
+
+	// The SOF, DQT and other segments needed to decode images cannot be rejected.
+	if _, err := Sanitize(bytes.NewReader(jpegOf(exifSegment)), new(bytes.Buffer), WithSegmentAction(sosMarker, SegmentReject)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestParseSegmentPolicy(t *testing.T) {
+	testTable := []struct {
+		Policy string
+		Error  bool
+	}{
+		{Policy: ""},
+		{Policy: "APP0=keep,APP15=reject, com = remove,"},
+		{Policy: "APP2", Error: true},
+		{Policy: "APP16=keep", Error: true},
+		{Policy: "APP02=keep", Error: true},
+		{Policy: "SOS=remove", Error: true},
+		{Policy: "APP2=drop", Error: true},
+	}
+
+	for _, test := range testTable {
+		_, err := ParseSegmentPolicy(test.Policy)
+		if (err != nil) != test.Error {
+			t.Errorf("%q: unexpected error: %v", test.Policy, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package exif
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif/jpegseg"
+)
+
+const (
+	// Start of image marker.
+	soiMarker = 0xD8
+
+	// End of image marker.
+	eoiMarker = 0xD9
+
+	// Start of scan marker. The entropy coded image data follows its segment.
+	sosMarker = 0xDA
+
+	// APP11 marker, used by JPEG XT and JUMBF boxes such as C2PA manifests.
+	app11Marker = 0xEB
+
+	// Comment marker.
+	comMarker = 0xFE
+)
+
+// segment is a marker segment of a JPEG file, from its marker up to the end of its payload.
+type segment struct {
+	marker     byte
+	start, end int
+}
+
+// payload returns the data of the segment following its marker and length field.
+func (s segment) payload(raw []byte) []byte {
+	if s.end-s.start < 4 {
+		return nil
+	}
+	return raw[s.start+4 : s.end]
+}
+
+// readSegments returns the marker segments of the JPEG file raw, from the start of image up to
+// and including the start of scan segment. The image data following it is not parsed.
+func readSegments(raw []byte) ([]segment, error) {
+	r := jpegseg.NewBytesReader(raw)
+	var segments []segment
+	for {
+		s, err := r.Next()
+		if err == io.EOF {
+			return segments, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if s.Marker == jpegseg.SOI || s.Marker == jpegseg.EOI {
+			continue
+		}
+		start := int(s.Offset)
+		segments = append(segments, segment{marker: s.Marker, start: start, end: start + s.Size()})
+	}
+}
+
+// imageEnd returns the offset following the end of image marker, searching the entropy coded
+// data from offset onwards. It returns -1 if the image data is not terminated.
+func imageEnd(raw []byte, offset int) int {
+	for offset+1 < len(raw) {
+		if raw[offset] != markerPrefix {
+			offset++
+			continue
+		}
+
+		marker := raw[offset+1]
+		switch {
+		case marker == markerPrefix:
+			// A fill byte.
+			offset++
+		case marker == 0x00 || isStandaloneMarker(marker):
+			// A stuffed 0xFF data byte or a restart marker.
+			offset += 2
+		case marker == eoiMarker:
+			return offset + 2
+		default:
+			// A segment between scans, such as the tables and scans of progressive images.
+			if offset+4 > len(raw) {
+				return -1
+			}
+			offset += 2 + int(binary.BigEndian.Uint16(raw[offset+2:]))
+		}
+	}
+	return -1
+}
+
+// isStandaloneMarker reports whether marker has no length field or payload, except for the start
+// and end of image markers.
+func isStandaloneMarker(marker byte) bool {
+	return marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7)
+}
+
+// markerName returns the name of a marker as the JPEG standard spells it, such as APP1 or DQT, for
+// diagnostics.
+func markerName(marker byte) string {
+	switch {
+	case marker >= 0xE0 && marker <= 0xEF:
+		return fmt.Sprintf("APP%d", marker-0xE0)
+	case marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC:
+		return fmt.Sprintf("SOF%d", marker-0xC0)
+	}
+	switch marker {
+	case 0xC4:
+		return "DHT"
+	case 0xCC:
+		return "DAC"
+	case sosMarker:
+		return "SOS"
+	case 0xDB:
+		return "DQT"
+	case 0xDD:
+		return "DRI"
+	case comMarker:
+		return "COM"
+	}
+	return fmt.Sprintf("0x%02X", marker)
+}
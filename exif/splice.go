@@ -0,0 +1,62 @@
+package exif
+
+import "sort"
+
+// splice edits a file held in memory without copying it: the regions edited are copied on first
+// write, and the rest of the file is left to be written straight from raw, as the parts returned
+// by Sanitize. Reads through raw keep seeing the original content of the regions edited.
+type splice struct {
+	raw   []byte
+	spans []spliceSpan
+}
+
+// spliceSpan is a region of the file being edited, from start to start+len(data).
+type spliceSpan struct {
+	start int
+	data  []byte
+}
+
+// writable returns a copy of the region of raw between start and end to edit, which replaces it in
+// the parts. A region overlapping regions already edited is merged with them, keeping their edits,
+// and the slices returned for them must no longer be written to; a region within one is a slice of
+// it. Callers editing several regions at once request them all first, and then again to write to
+// them.
+func (s *splice) writable(start, end int) []byte {
+	i := sort.Search(len(s.spans), func(i int) bool {
+		return s.spans[i].start+len(s.spans[i].data) > start
+	})
+	j := i
+	for j < len(s.spans) && s.spans[j].start < end {
+		j++
+	}
+	if j == i+1 && s.spans[i].start <= start && end <= s.spans[i].start+len(s.spans[i].data) {
+		span := s.spans[i]
+		return span.data[start-span.start : end-span.start]
+	}
+
+	merged := spliceSpan{start: start}
+	stop := end
+	if i < j {
+		merged.start = min(start, s.spans[i].start)
+		last := s.spans[j-1]
+		stop = max(end, last.start+len(last.data))
+	}
+	merged.data = append([]byte{}, s.raw[merged.start:stop]...)
+	for _, span := range s.spans[i:j] {
+		copy(merged.data[span.start-merged.start:], span.data)
+	}
+	s.spans = append(s.spans[:i], append([]spliceSpan{merged}, s.spans[j:]...)...)
+	return merged.data[start-merged.start : end-merged.start]
+}
+
+// parts returns the edited file as the parts written by writeParts: the regions left unchanged,
+// as slices of raw, and the copies of the regions edited, in order.
+func (s *splice) parts() [][]byte {
+	parts := make([][]byte, 0, 2*len(s.spans)+1)
+	offset := 0
+	for _, span := range s.spans {
+		parts = append(parts, s.raw[offset:span.start], span.data)
+		offset = span.start + len(span.data)
+	}
+	return append(parts, s.raw[offset:])
+}
@@ -0,0 +1,58 @@
+package exif
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplice(t *testing.T) {
+	raw := []byte("0123456789abcdef")
+	original := append([]byte{}, raw...)
+	s := &splice{raw: raw}
+
+	copy(s.writable(2, 4), "XY")
+	copy(s.writable(8, 10), "ZW")
+	// Within an edited region.
+	s.writable(8, 10)[1] = 'V'
+	// Overlapping both edited regions, which are merged keeping their edits.
+	overlap := s.writable(3, 9)
+	if string(overlap) != "Y4567Z" {
+		t.Errorf("expected the edits to be kept in the merged region, got %q", overlap)
+	}
+	overlap[1] = '-'
+	copy(s.writable(15, 16), "!")
+
+	if got := bytes.Join(s.parts(), nil); string(got) != "01XY-567ZVabcde!" {
+		t.Errorf("unexpected spliced file %q", got)
+	}
+	if !bytes.Equal(raw, original) {
+		t.Errorf("expected raw to be left unchanged, got %q", raw)
+	}
+	// The regions left unchanged are slices of raw rather than copies.
+	if parts := s.parts(); &parts[0][0] != &raw[0] || &parts[2][0] != &raw[10] {
+		t.Errorf("expected the regions left unchanged to be slices of raw")
+	}
+}
+
+func TestSanitizePDFCopiesEditsOnly(t *testing.T) {
+	content := string(bytes.Repeat([]byte("BT (Hello) Tj ET "), 1000))
+	input := pdfOf(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		"<< /Length 17000 >>\nstream\n"+content+"\nendstream",
+		"<< /Author (Jane) >>",
+	)
+	parts, _, err := sanitize(input, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	copied := 0
+	for _, part := range parts {
+		if offset := cap(input) - cap(part); len(part) > 0 && (offset < 0 || offset >= len(input) || &input[offset] != &part[0]) {
+			copied += len(part)
+		}
+	}
+	if copied > 64 {
+		t.Errorf("expected only the information dictionary to be copied, %d bytes were", copied)
+	}
+}
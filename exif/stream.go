@@ -0,0 +1,146 @@
+package exif
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif/jpegseg"
+)
+
+// streamChunkSize is the size of the chunks of image data the parsing stage of DiscardStream
+// hands over once it reached the start of scan.
+const streamChunkSize = 32 << 10
+
+// streamDepth is how many segments or chunks the parsing stage of DiscardStream may read ahead of
+// the filtering stage.
+const streamDepth = 16
+
+// streamItem is what the parsing stage of DiscardStream hands over to the filtering stage: a
+// segment, a chunk of the data following the segments, or the error that stopped it.
+type streamItem struct {
+	segment jpegseg.Segment
+	data    []byte
+	err     error
+}
+
+// DiscardStream writes to w a copy of the image read from r without its EXIF data, as Discard
+// does, but without waiting for the whole of JPEG images to be read: parsing their segments,
+// filtering out the EXIF segments and writing the copy run as stages of a pipeline, so that the
+// segments preceding the EXIF data are written while the rest is still being read, and the image
+// data is copied as it arrives. This cuts the time to the first byte written, and the memory
+// held, for large images read from slow storage. Images of other formats are read into memory and
+// handled by Discard.
+//
+// As with Discard, ErrNoExif is returned for images without EXIF data, but only once their copy,
+// identical to the image, has been written. Errors found past the start of the copy leave it
+// partly written, as Discard does when writing fails.
+func DiscardStream(r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+	signature, _ := br.Peek(3)
+	if !bytes.Equal(signature, []byte{markerPrefix, soiMarker, markerPrefix}) {
+		return Discard(br, w)
+	}
+
+	items := make(chan streamItem, streamDepth)
+	done := make(chan struct{})
+	defer close(done)
+	go parseStream(br, items, done)
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(filterStream(items, pw))
+	}()
+	_, err := io.Copy(w, pr)
+	// The filtering stage stops at the first write failing once the pipe is closed.
+	pr.CloseWithError(err)
+	return err
+}
+
+// parseStream is the parsing stage of DiscardStream: it reads the segments of the JPEG image read
+// from r, up to the start of scan, and then the data following them in chunks, and sends them to
+// items, followed by the error that stopped it, until done is closed.
+func parseStream(r io.Reader, items chan<- streamItem, done <-chan struct{}) {
+	send := func(item streamItem) bool {
+		select {
+		case items <- item:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	segments := jpegseg.NewReader(r)
+	for {
+		s, err := segments.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			send(streamItem{err: err})
+			return
+		}
+		if !send(streamItem{segment: s}) {
+			return
+		}
+	}
+	for {
+		chunk := make([]byte, streamChunkSize)
+		n, err := segments.Read(chunk)
+		if n > 0 && !send(streamItem{data: chunk[:n]}) {
+			return
+		}
+		if err == io.EOF {
+			send(streamItem{err: io.EOF})
+			return
+		}
+		if err != nil {
+			send(streamItem{err: err})
+			return
+		}
+	}
+}
+
+// filterStream is the filtering stage of DiscardStream: it writes the segments received from items
+// to w, except for the EXIF segments, and then the data following them. The fill bytes preceding
+// markers are kept, as Discard does. It returns ErrNoExif if there was no EXIF segment to filter
+// out.
+func filterStream(items <-chan streamItem, w io.Writer) error {
+	removed := false
+	var end int64
+	for item := range items {
+		switch {
+		case item.err == io.EOF:
+			if !removed {
+				return ErrNoExif
+			}
+			return nil
+		case item.err != nil:
+			return item.err
+		case item.data != nil:
+			if _, err := w.Write(item.data); err != nil {
+				return err
+			}
+			continue
+		}
+
+		s := item.segment
+		if fill := s.Offset - end; fill > 0 {
+			if _, err := w.Write(bytes.Repeat([]byte{markerPrefix}, int(fill))); err != nil {
+				return err
+			}
+		}
+		end = s.Offset + 2
+		if !jpegseg.IsStandalone(s.Marker) {
+			end += 2 + int64(len(s.Payload))
+		}
+		if s.Marker == appMarker && bytes.HasPrefix(s.Payload, exifIdent) {
+			removed = true
+			continue
+		}
+		if err := jpegseg.WriteSegment(w, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
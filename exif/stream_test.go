@@ -0,0 +1,147 @@
+package exif
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestDiscardStream(t *testing.T) {
+	filled := jpegOf(xmpSegment, exifSegment)
+	// Fill bytes before the marker of the EXIF segment.
+	filled = append(append(append([]byte{}, filled[:2+len(xmpSegment)]...), 0xFF, 0xFF), filled[2+len(xmpSegment):]...)
+	trailing := append(jpegOf(exifSegment, jfifSegment, exifSegment), "MotionPhoto_Data"...)
+	// Image data longer than the chunks handed over by the parsing stage.
+	large := append(jpegOf(exifSegment), bytes.Repeat([]byte{0x12, 0x34}, streamChunkSize)...)
+
+	testTable := []struct {
+		name  string
+		input []byte
+	}{
+		{"exif only", jpegOf(exifSegment)},
+		{"xmp before exif", jpegOf(xmpSegment, exifSegment)},
+		{"fill bytes", filled},
+		{"several segments and trailer", trailing},
+		{"large image data", large},
+		{"png", stillPNG(t, pngChunk("eXIf", exifSegment[4+len(exifIdent):]))},
+	}
+	for _, test := range testTable {
+		expected := new(bytes.Buffer)
+		if err := Discard(bytes.NewReader(test.input), expected); err != nil {
+			t.Fatalf("%s: unexpected error from Discard: %v", test.name, err)
+		}
+
+		output := new(bytes.Buffer)
+		if err := DiscardStream(bytes.NewReader(test.input), output); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(expected.Bytes(), output.Bytes()) {
+			t.Errorf("%s: expected %x, got %x", test.name, expected.Bytes(), output.Bytes())
+		}
+	}
+}
+
+func TestDiscardStreamErrors(t *testing.T) {
+	testTable := []struct {
+		name  string
+		input []byte
+		kind  error
+	}{
+		{"no exif", jpegOf(xmpSegment), ErrNoExif},
+		{"truncated segment", jpegOf(exifSegment)[:20], ErrTruncated},
+		{"missing marker", append(jpegOf(exifSegment)[:len(exifSegment)+2], 0x00, 0x01), ErrMalformed},
+		{"not an image", []byte("hello"), nil},
+	}
+	for _, test := range testTable {
+		err := DiscardStream(bytes.NewReader(test.input), io.Discard)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		if test.kind != nil && !errors.Is(err, test.kind) {
+			t.Errorf("%s: expected an error wrapping %v, got %v", test.name, test.kind, err)
+		}
+	}
+
+	// Images without EXIF data are copied whole before ErrNoExif is returned.
+	input := jpegOf(xmpSegment)
+	output := new(bytes.Buffer)
+	if err := DiscardStream(bytes.NewReader(input), output); !errors.Is(err, ErrNoExif) {
+		t.Fatalf("expected ErrNoExif, got %v", err)
+	}
+	if !bytes.Equal(input, output.Bytes()) {
+		t.Errorf("expected the image to be copied, got %x", output.Bytes())
+	}
+}
+
+func TestDiscardStreamWriteError(t *testing.T) {
+	failing := errors.New("disk full")
+	input := append(jpegOf(exifSegment), bytes.Repeat([]byte{0x12}, 4*streamChunkSize)...)
+	done := make(chan error, 1)
+	go func() {
+		done <- DiscardStream(bytes.NewReader(input), failingAfter{err: failing})
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, failing) {
+			t.Errorf("expected the write error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stages kept running after writing failed")
+	}
+}
+
+// failingAfter is a writer failing with err.
+type failingAfter struct {
+	err error
+}
+
+func (f failingAfter) Write(p []byte) (int, error) {
+	return 0, f.err
+}
+
+// TestDiscardStreamWritesEarly verifies that the segments preceding the EXIF data are written
+// before the rest of the image is read.
+func TestDiscardStreamWritesEarly(t *testing.T) {
+	input := jpegOf(xmpSegment, exifSegment)
+	head := 2 + len(xmpSegment)
+
+	source, feed := io.Pipe()
+	written := make(chan []byte, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- DiscardStream(source, chanWriter(written))
+	}()
+
+	if _, err := feed.Write(input[:head+len(exifSegment)]); err != nil {
+		t.Fatal(err)
+	}
+	got := []byte{}
+	for len(got) < head {
+		select {
+		case p := <-written:
+			got = append(got, p...)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected the first %d bytes to be written before the image is read, got %x", head, got)
+		}
+	}
+	if !bytes.Equal(got, input[:head]) {
+		t.Errorf("expected %x to be written first, got %x", input[:head], got)
+	}
+
+	feed.Write(input[head+len(exifSegment):])
+	feed.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// chanWriter sends copies of what is written to it to a channel.
+type chanWriter chan []byte
+
+func (c chanWriter) Write(p []byte) (int, error) {
+	c <- append([]byte{}, p...)
+	return len(p), nil
+}
@@ -0,0 +1,127 @@
+package exif
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Tags describing the camera and the capture.
+const (
+	tagMake         = 0x010F
+	tagModel        = 0x0110
+	tagLensModel    = 0xA434
+	tagGPSLatitude  = 0x0002
+	tagGPSLongitude = 0x0004
+)
+
+// The format of EXIF DateTime values.
+const dateTimeLayout = "2006:01:02 15:04:05"
+
+// Summary is a short digest of the EXIF data of an image, for telling users what was found.
+type Summary struct {
+	// Make and Model are the camera manufacturer and model, and Lens the lens model.
+	Make  string
+	Model string
+	Lens  string
+
+	// Exposure is the exposure time, aperture and ISO speed the image was taken with, such as
+	// "1/250s f/2.8 ISO 100", or empty if none is recorded.
+	Exposure string
+
+	// GPS is true if the image records where it was taken, and Location is that place, if its
+	// coordinates could be read.
+	GPS      bool
+	Location *Location
+
+	// Taken is when the image was taken, or the zero time if unknown.
+	Taken time.Time
+}
+
+// String returns the summary as a short human-readable sentence, such as
+// "iPhone 14 Pro, 1/120s f/1.8 ISO 50, GPS: yes, taken 2024-03-02".
+func (s *Summary) String() string {
+	var parts []string
+	switch {
+	case s.Model != "":
+		parts = append(parts, s.Model)
+	case s.Make != "":
+		parts = append(parts, s.Make)
+	}
+	if s.Lens != "" {
+		parts = append(parts, "lens "+s.Lens)
+	}
+	if s.Exposure != "" {
+		parts = append(parts, s.Exposure)
+	}
+	if s.GPS {
+		parts = append(parts, "GPS: yes")
+	} else {
+		parts = append(parts, "GPS: no")
+	}
+	if !s.Taken.IsZero() {
+		parts = append(parts, fmt.Sprintf("taken %s", s.Taken.Format("2006-01-02")))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// summarizeTIFF returns a summary of EXIF data stored as a bare TIFF structure, or nil if it
+// cannot be parsed.
+func summarizeTIFF(data []byte) *Summary {
+	t, err := parseTIFF(data)
+	if err != nil {
+		return nil
+	}
+	dirs, err := t.ifds()
+	if err != nil {
+		return nil
+	}
+
+	summary := &Summary{}
+	var dateTime, dateTimeOriginal string
+	exposure := make(map[uint16]string)
+	gps := make(map[uint16]Tag)
+	for _, dir := range dirs {
+		for _, entry := range dir.entries {
+			switch {
+			case dir.kind == ifd0 && entry.tag == tagMake:
+				summary.Make, _ = t.ascii(entry)
+			case dir.kind == ifd0 && entry.tag == tagModel:
+				summary.Model, _ = t.ascii(entry)
+			case dir.kind == ifd0 && entry.tag == tagDateTime:
+				dateTime, _ = t.ascii(entry)
+			case dir.kind == exifIFD && entry.tag == tagLensModel:
+				summary.Lens, _ = t.ascii(entry)
+			case dir.kind == exifIFD && entry.tag == tagDateTimeOriginal:
+				dateTimeOriginal, _ = t.ascii(entry)
+			case dir.kind == exifIFD && (entry.tag == tagExposureTime || entry.tag == tagFNumber || entry.tag == tagISOSpeed):
+				if s, ok := formatExposure(t.tag(entry)); ok {
+					exposure[entry.tag] = s
+				}
+			case dir.kind == gpsIFD:
+				gps[entry.tag] = t.tag(entry)
+				if entry.tag == tagGPSLatitude || entry.tag == tagGPSLongitude {
+					summary.GPS = true
+				}
+			}
+		}
+	}
+
+	var settings []string
+	for _, tag := range []uint16{tagExposureTime, tagFNumber, tagISOSpeed} {
+		if s, ok := exposure[tag]; ok {
+			settings = append(settings, s)
+		}
+	}
+	summary.Exposure = strings.Join(settings, " ")
+	summary.Location = locationOf(gps)
+
+	// Prefer the time the picture was taken over the time the file was last changed.
+	for _, value := range []string{dateTimeOriginal, dateTime} {
+		if taken, err := time.Parse(dateTimeLayout, value); err == nil {
+			summary.Taken = taken
+			break
+		}
+	}
+	return summary
+}
@@ -0,0 +1,481 @@
+package exif
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// svgEditorNamespaces are the namespaces of the private data design tools write into the SVG
+// images they export, such as the path the file was saved to, and of the RDF, Dublin Core and
+// Creative Commons properties of metadata elements, which record authors.
+var svgEditorNamespaces = map[string]bool{
+	"http://www.inkscape.org/namespaces/inkscape":        true,
+	"http://sodipodi.sourceforge.net/DTD/sodipodi-0.dtd": true,
+	"http://ns.adobe.com/AdobeIllustrator/10.0/":         true,
+	"http://ns.adobe.com/AdobeSVGViewerExtensions/3.0/":  true,
+	"http://ns.adobe.com/Extensibility/1.0/":             true,
+	"http://ns.adobe.com/Flows/1.0/":                     true,
+	"http://ns.adobe.com/GenericCustomNamespace/1.0/":    true,
+	"http://ns.adobe.com/ImageReplacement/1.0/":          true,
+	"http://ns.adobe.com/SaveForWeb/1.0/":                true,
+	"http://ns.adobe.com/Variables/1.0/":                 true,
+	"http://ns.adobe.com/XPath/1.0/":                     true,
+	"http://www.bohemiancoding.com/sketch/ns":            true,
+	"http://www.serif.com/":                              true,
+	"http://www.w3.org/1999/02/22-rdf-syntax-ns#":        true,
+	"http://purl.org/dc/elements/1.1/":                   true,
+	"http://creativecommons.org/ns#":                     true,
+	"http://web.resource.org/cc/":                        true,
+}
+
+// Namespaces of the elements and attributes that may run scripts.
+const (
+	svgNamespace   = "http://www.w3.org/2000/svg"
+	xhtmlNamespace = "http://www.w3.org/1999/xhtml"
+	xlinkNamespace = "http://www.w3.org/1999/xlink"
+)
+
+// svgLinkAttributes are the local names of the attributes holding links, which may hold
+// javascript: links, in SVG images and the XHTML elements they embed.
+var svgLinkAttributes = map[string]bool{
+	"href":       true,
+	"src":        true,
+	"action":     true,
+	"formaction": true,
+	"data":       true,
+}
+
+// svgEntities are the named character references of XML and HTML that may hide the scheme of a
+// link, such as "javascript&colon;".
+var svgEntities = map[string]string{
+	"amp":     "&",
+	"lt":      "<",
+	"gt":      ">",
+	"quot":    `"`,
+	"apos":    "'",
+	"colon":   ":",
+	"Tab":     "\t",
+	"NewLine": "\n",
+}
+
+// svgEntity matches character references, such as "&#106;", "&#x6A;" and "&colon;".
+var svgEntity = regexp.MustCompile(`&(#[0-9]+|#[xX][0-9a-fA-F]+|[A-Za-z][A-Za-z0-9]*);?`)
+
+// WithSVGScriptRemoval makes Sanitize remove the scripts of SVG images too: the script elements
+// of SVG and of the XHTML it embeds, event handler attributes such as onload, javascript: links,
+// however their scheme is encoded, and the animations setting links or event handlers.
+func WithSVGScriptRemoval() Option {
+	return func(o *options) {
+		o.removeScripts = true
+	}
+}
+
+// isSVG reports whether raw is an SVG image: an XML document, possibly starting with a byte
+// order mark, a declaration, comments and a doctype, whose root element is svg.
+func isSVG(raw []byte) bool {
+	head := raw
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	head = bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if !bytes.HasPrefix(head, []byte("<")) {
+		return false
+	}
+	for len(head) > 0 {
+		head = bytes.TrimLeft(head, " \t\r\n")
+		switch {
+		case bytes.HasPrefix(head, []byte("<svg")):
+			// The root element is svg, and not one of another name starting the same, such as a
+			// svg:script element.
+			return len(head) > 4 && (isXMLSpace(head[4]) || head[4] == '>' || head[4] == '/')
+		case bytes.HasPrefix(head, []byte("<?")):
+			head = skipPast(head, "?>")
+		case bytes.HasPrefix(head, []byte("<!--")):
+			head = skipPast(head, "-->")
+		case bytes.HasPrefix(head, []byte("<!")):
+			head = head[svgDeclarationEnd(head, 0):]
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// skipPast returns what follows the first occurrence of end in b, or nothing if there is none.
+func skipPast(b []byte, end string) []byte {
+	i := bytes.Index(b, []byte(end))
+	if i < 0 {
+		return nil
+	}
+	return b[i+len(end):]
+}
+
+// svgAttribute is an attribute of a start tag: its name, its value without quotes, and where it
+// starts, including the whitespace preceding it, and ends.
+type svgAttribute struct {
+	name, value string
+	start, end  int
+}
+
+// svgSanitizer removes metadata from an SVG image.
+type svgSanitizer struct {
+	raw    []byte
+	report *Report
+
+	// scopes are the namespace declarations of the elements open, from the root, mapping their
+	// prefixes, or "" for the default namespace, to namespaces.
+	scopes []map[string]string
+
+	removeScripts bool
+
+	// logf writes diagnostics to the logger of the options.
+	logf func(format string, v ...interface{})
+}
+
+// sanitizeSVG removes the metadata elements, comments, XMP packets and the elements and
+// attributes of editor namespaces from the SVG image raw, along with the declarations of those
+// namespaces, and its scripts if the options ask for it. The rest of the document is copied as is.
+// Elements and attributes are told apart by their namespaces, whatever the prefixes bound to them.
+func sanitizeSVG(raw []byte, o *options) ([][]byte, *Report, error) {
+	s := &svgSanitizer{
+		raw:           raw,
+		report:        &Report{Format: "svg"},
+		removeScripts: o.removeScripts,
+		logf:          o.logf,
+	}
+
+	var parts [][]byte
+	kept := 0
+	drop := func(start, end int, replacement []byte) {
+		parts = append(parts, raw[kept:start])
+		if replacement != nil {
+			parts = append(parts, replacement)
+		}
+		s.report.BytesRemoved += end - start - len(replacement)
+		s.report.MetadataRemoved = true
+		kept = end
+	}
+
+	// depth is the number of elements open, and skipDepth the depth of the element being
+	// removed with its content, which starts at skipStart, or zero if none is.
+	depth, skipDepth, skipStart := 0, 0, 0
+	for offset := 0; offset < len(raw); {
+		start := bytes.IndexByte(raw[offset:], '<')
+		if start < 0 {
+			break
+		}
+		start += offset
+
+		var end int
+		switch {
+		case bytes.HasPrefix(raw[start:], []byte("<!--")):
+			end = indexPast(raw, start, "-->")
+			if end < 0 {
+				return nil, nil, fmt.Errorf("the SVG comment at offset %d is unterminated", start)
+			}
+			if skipDepth == 0 {
+				drop(start, end, nil)
+			}
+		case bytes.HasPrefix(raw[start:], []byte("<![CDATA[")):
+			end = indexPast(raw, start, "]]>")
+			if end < 0 {
+				return nil, nil, fmt.Errorf("the SVG CDATA section at offset %d is unterminated", start)
+			}
+		case bytes.HasPrefix(raw[start:], []byte("<?")):
+			end = indexPast(raw, start, "?>")
+			if end < 0 {
+				return nil, nil, fmt.Errorf("the SVG processing instruction at offset %d is unterminated", start)
+			}
+			if skipDepth == 0 && bytes.HasPrefix(raw[start:], []byte("<?xpacket")) {
+				drop(start, end, nil)
+			}
+		case bytes.HasPrefix(raw[start:], []byte("<!")):
+			end = svgDeclarationEnd(raw, start)
+		case bytes.HasPrefix(raw[start:], []byte("</")):
+			end = indexPast(raw, start, ">")
+			if end < 0 {
+				return nil, nil, fmt.Errorf("the SVG end tag at offset %d is unterminated", start)
+			}
+			if skipDepth > 0 && depth == skipDepth {
+				drop(skipStart, end, nil)
+				skipDepth = 0
+			}
+			if depth > 0 {
+				s.scopes = s.scopes[:depth-1]
+			}
+			depth--
+		default:
+			name, attrs, selfClosing, tagEnd, err := s.readStartTag(start)
+			if err != nil {
+				return nil, nil, err
+			}
+			end = tagEnd
+			// The root element is kept, whatever its namespace, so that the image stays one.
+			root := depth == 0
+			s.scopes = append(s.scopes, svgDeclarations(attrs))
+			if !selfClosing {
+				depth++
+			}
+			switch {
+			case skipDepth > 0:
+			case !root && s.removesElement(name, attrs):
+				s.logf("Removing the SVG %s element at offset %d", name, start)
+				if selfClosing {
+					drop(start, end, nil)
+				} else {
+					skipDepth, skipStart = depth, start
+				}
+			default:
+				if tag := s.sanitizeStartTag(start, end, attrs); tag != nil {
+					drop(start, end, tag)
+				}
+			}
+			if selfClosing {
+				s.scopes = s.scopes[:len(s.scopes)-1]
+			}
+		}
+		offset = end
+	}
+	if depth != 0 {
+		return nil, nil, fmt.Errorf("the SVG image has %d unclosed elements", depth)
+	}
+	parts = append(parts, raw[kept:])
+	return parts, s.report, nil
+}
+
+// removesElement returns whether the element of the given name and attributes is removed with
+// its content: elements of editor namespaces, metadata elements and, if scripts are removed,
+// script elements of SVG and XHTML, and the animations setting links, which may set javascript:
+// links.
+func (s *svgSanitizer) removesElement(name string, attrs []svgAttribute) bool {
+	namespace, local := s.resolve(name, true)
+	svg := namespace == "" || namespace == svgNamespace
+	switch {
+	case svgEditorNamespaces[namespace]:
+		return true
+	case svg && local == "metadata":
+		return true
+	case !s.removeScripts:
+		return false
+	case (svg || namespace == xhtmlNamespace) && strings.EqualFold(local, "script"):
+		s.report.ScriptsRemoved = true
+		return true
+	case svg && (local == "set" || local == "animate"):
+		for _, attr := range attrs {
+			if attr.name != "attributeName" {
+				continue
+			}
+			_, target := s.resolve(strings.TrimSpace(attr.value), false)
+			if target = strings.ToLower(target); svgLinkAttributes[target] || strings.HasPrefix(target, "on") {
+				s.report.ScriptsRemoved = true
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sanitizeStartTag returns the start tag between start and end without its attributes of editor
+// namespaces, the declarations of those namespaces and, if scripts are removed, its event handlers
+// and javascript: links. It returns nil if the tag is kept as is.
+func (s *svgSanitizer) sanitizeStartTag(start, end int, attrs []svgAttribute) []byte {
+	var tag []byte
+	kept := start
+	for _, attr := range attrs {
+		namespace, local := s.resolve(attr.name, false)
+		declaration := attr.name == "xmlns" || strings.HasPrefix(attr.name, "xmlns:")
+		remove := svgEditorNamespaces[namespace] || (declaration && svgEditorNamespaces[attr.value])
+		if s.removeScripts && !remove && !declaration {
+			lower := strings.ToLower(local)
+			link := svgLinkAttributes[lower] && (namespace == "" || namespace == xlinkNamespace)
+			if strings.HasPrefix(lower, "on") || (link && isJavaScriptLink(attr.value)) {
+				s.report.ScriptsRemoved = true
+				remove = true
+			}
+		}
+		if remove {
+			tag = append(tag, s.raw[kept:attr.start]...)
+			kept = attr.end
+		}
+	}
+	if tag == nil && kept == start {
+		return nil
+	}
+	return append(tag, s.raw[kept:end]...)
+}
+
+// resolve returns the namespace and local name of the qualified name of an element, or of an
+// attribute, which is in no namespace unless prefixed. Prefixes not declared are in no namespace.
+func (s *svgSanitizer) resolve(name string, element bool) (string, string) {
+	prefix, local := "", name
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		prefix, local = name[:i], name[i+1:]
+	} else if !element {
+		return "", name
+	}
+	for i := len(s.scopes) - 1; i >= 0; i-- {
+		if namespace, ok := s.scopes[i][prefix]; ok {
+			return namespace, local
+		}
+	}
+	return "", local
+}
+
+// svgDeclarations returns the namespaces declared by the attributes of a start tag, by prefix, or
+// "" for the default namespace, or nil if there are none.
+func svgDeclarations(attrs []svgAttribute) map[string]string {
+	var declarations map[string]string
+	for _, attr := range attrs {
+		prefix, ok := "", attr.name == "xmlns"
+		if strings.HasPrefix(attr.name, "xmlns:") {
+			prefix, ok = attr.name[len("xmlns:"):], true
+		}
+		if !ok {
+			continue
+		}
+		if declarations == nil {
+			declarations = make(map[string]string)
+		}
+		declarations[prefix] = attr.value
+	}
+	return declarations
+}
+
+// isJavaScriptLink reports whether the value of a link attribute is a javascript: link, as
+// browsers read it: once its character references are decoded, and without the whitespace and
+// control characters they ignore. Values referring to entities declared by the document itself,
+// which could spell the scheme, are treated as javascript: links too.
+func isJavaScriptLink(value string) bool {
+	unknown := false
+	decoded := svgEntity.ReplaceAllStringFunc(value, func(ref string) string {
+		name := strings.TrimSuffix(ref[1:], ";")
+		if !strings.HasPrefix(name, "#") {
+			if !strings.HasSuffix(ref, ";") {
+				// Not a reference, such as the parameters of a query string.
+				return ref
+			}
+			if v, ok := svgEntities[name]; ok {
+				return v
+			}
+			unknown = true
+			return ref
+		}
+		var n uint64
+		var err error
+		if name[1] == 'x' || name[1] == 'X' {
+			n, err = strconv.ParseUint(name[2:], 16, 32)
+		} else {
+			n, err = strconv.ParseUint(name[1:], 10, 32)
+		}
+		if err != nil || n > unicode.MaxRune {
+			return ref
+		}
+		return string(rune(n))
+	})
+	if unknown {
+		return true
+	}
+	scheme := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7F {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, decoded)
+	return strings.HasPrefix(scheme, "javascript:")
+}
+
+// readStartTag reads the start tag at offset, and returns the name of the element, its
+// attributes, whether it is self-closing and where the tag ends.
+func (s *svgSanitizer) readStartTag(offset int) (string, []svgAttribute, bool, int, error) {
+	raw := s.raw
+	i := offset + 1
+	for i < len(raw) && !isXMLSpace(raw[i]) && raw[i] != '>' && raw[i] != '/' {
+		i++
+	}
+	name := string(raw[offset+1 : i])
+	if name == "" {
+		return "", nil, false, 0, fmt.Errorf("the SVG tag at offset %d has no name", offset)
+	}
+
+	var attrs []svgAttribute
+	for {
+		attrStart := i
+		for i < len(raw) && isXMLSpace(raw[i]) {
+			i++
+		}
+		switch {
+		case i >= len(raw):
+			return "", nil, false, 0, fmt.Errorf("the SVG %s tag at offset %d is unterminated", name, offset)
+		case raw[i] == '>':
+			return name, attrs, false, i + 1, nil
+		case bytes.HasPrefix(raw[i:], []byte("/>")):
+			return name, attrs, true, i + 2, nil
+		}
+
+		nameStart := i
+		for i < len(raw) && !isXMLSpace(raw[i]) && raw[i] != '=' && raw[i] != '>' && raw[i] != '/' {
+			i++
+		}
+		attr := svgAttribute{name: string(raw[nameStart:i]), start: attrStart}
+		for i < len(raw) && isXMLSpace(raw[i]) {
+			i++
+		}
+		if i >= len(raw) || raw[i] != '=' || nameStart == i {
+			return "", nil, false, 0, fmt.Errorf("the SVG %s tag at offset %d has a malformed attribute", name, offset)
+		}
+		i++
+		for i < len(raw) && isXMLSpace(raw[i]) {
+			i++
+		}
+		if i >= len(raw) || (raw[i] != '"' && raw[i] != '\'') {
+			return "", nil, false, 0, fmt.Errorf("the SVG %s tag at offset %d has an unquoted attribute", name, offset)
+		}
+		quote := raw[i]
+		valueEnd := bytes.IndexByte(raw[i+1:], quote)
+		if valueEnd < 0 {
+			return "", nil, false, 0, fmt.Errorf("the SVG %s tag at offset %d is unterminated", name, offset)
+		}
+		attr.value = string(raw[i+1 : i+1+valueEnd])
+		i += valueEnd + 2
+		attr.end = i
+		attrs = append(attrs, attr)
+	}
+}
+
+// svgDeclarationEnd returns the offset following the declaration at offset, such as a doctype
+// whose internal subset, between brackets, may hold declarations of its own.
+func svgDeclarationEnd(raw []byte, offset int) int {
+	depth := 0
+	for i := offset; i < len(raw); i++ {
+		switch raw[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '>':
+			if depth <= 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(raw)
+}
+
+// indexPast returns the offset following the first occurrence of end from offset in raw, or -1
+// if there is none.
+func indexPast(raw []byte, offset int, end string) int {
+	i := bytes.Index(raw[offset:], []byte(end))
+	if i < 0 {
+		return -1
+	}
+	return offset + i + len(end)
+}
+
+// isXMLSpace reports whether c is XML whitespace.
+func isXMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
@@ -0,0 +1,136 @@
+package exif
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// inkscapeSVG is an SVG image as saved by Inkscape, with a metadata element, editor namespaces
+// recording the path it was saved to, and a script.
+const inkscapeSVG = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<!-- Created with Inkscape (http://www.inkscape.org/) -->
+<svg
+   width="10"
+   height="10"
+   xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape"
+   xmlns:sodipodi="http://sodipodi.sourceforge.net/DTD/sodipodi-0.dtd"
+   xmlns="http://www.w3.org/2000/svg"
+   xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+   xmlns:dc="http://purl.org/dc/elements/1.1/"
+   sodipodi:docname="logo.svg"
+   inkscape:export-filename="/home/jane/logo.png"
+   onload="track()">
+  <sodipodi:namedview id="view" inkscape:zoom="1" />
+  <metadata><rdf:RDF><dc:creator>Jane Doe</dc:creator><!-- note --></rdf:RDF></metadata>
+  <script><![CDATA[function track() { if (1 < 2) {} }]]></script>
+  <a href="javascript:track()"><rect width="10" height="10" inkscape:label="Layer 1"/></a>
+  <style><![CDATA[rect { fill: red; }]]></style>
+</svg>
+`
+
+func TestSanitizeSVG(t *testing.T) {
+	output := new(bytes.Buffer)
+	report, err := Sanitize(strings.NewReader(inkscapeSVG), output)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+
+<svg
+   width="10"
+   height="10"
+   xmlns="http://www.w3.org/2000/svg"
+   onload="track()">
+  
+  
+  <script><![CDATA[function track() { if (1 < 2) {} }]]></script>
+  <a href="javascript:track()"><rect width="10" height="10"/></a>
+  <style><![CDATA[rect { fill: red; }]]></style>
+</svg>
+`
+	if output.String() != expected {
+		t.Errorf("unexpected output:\n%s", output)
+	}
+	if report.Format != "svg" || !report.MetadataRemoved || report.ScriptsRemoved || report.BytesRemoved != len(inkscapeSVG)-len(expected) {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	output.Reset()
+	report, err = Sanitize(strings.NewReader(inkscapeSVG), output, WithSVGScriptRemoval())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, script := range []string{"onload", "<script", "javascript:"} {
+		if strings.Contains(output.String(), script) {
+			t.Errorf("expected %q to be removed, got:\n%s", script, output)
+		}
+	}
+	if !report.ScriptsRemoved || !strings.Contains(output.String(), `<a><rect width="10" height="10"/></a>`) {
+		t.Errorf("unexpected output:\n%s", output)
+	}
+}
+
+func TestSanitizeSVGWithoutMetadata(t *testing.T) {
+	input := "\xef\xbb\xbf<!DOCTYPE svg [<!ENTITY w \"10\">]>\n<svg xmlns=\"http://www.w3.org/2000/svg\"><rect width=\"&w;\" height='10'/></svg>"
+	output := new(bytes.Buffer)
+	report, err := Sanitize(strings.NewReader(input), output)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output.String() != input || report.MetadataRemoved || report.BytesRemoved != 0 {
+		t.Errorf("expected the image to be copied unchanged, got %+v:\n%s", report, output)
+	}
+
+	if _, err := Sanitize(strings.NewReader(`<svg><g><rect/></svg>`), output); err == nil {
+		t.Errorf("expected an error for unbalanced elements")
+	}
+}
+
+func TestSanitizeSVGScriptBypasses(t *testing.T) {
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">%s</svg>`
+	testTable := []struct {
+		name   string
+		input  string
+		absent string
+	}{
+		{"html prefix", `<foreignObject xmlns:html="http://www.w3.org/1999/xhtml"><html:script>alert(1)</html:script></foreignObject>`, "alert"},
+		{"other prefix", `<x:script xmlns:x="http://www.w3.org/1999/xhtml">alert(1)</x:script>`, "alert"},
+		{"default xhtml namespace", `<foreignObject><body xmlns="http://www.w3.org/1999/xhtml"><script>alert(1)</script></body></foreignObject>`, "alert"},
+		{"svg under another prefix", `<s:script xmlns:s="http://www.w3.org/2000/svg">alert(1)</s:script>`, "alert"},
+		{"decimal reference", `<a href="&#106;avascript:alert(1)"><rect/></a>`, "alert"},
+		{"hexadecimal reference", `<a xlink:href="&#x6A;&#x61;vascript:alert(1)"><rect/></a>`, "alert"},
+		{"named reference", `<a href="javascript&colon;alert(1)"><rect/></a>`, "alert"},
+		{"declared entity", `<a href="&js;:alert(1)"><rect/></a>`, "alert"},
+		{"tab", "<a href=\"java\tscript:alert(1)\"><rect/></a>", "alert"},
+		{"newline", "<a href=\"  java\nscript:alert(1)\"><rect/></a>", "alert"},
+		{"other xlink prefix", `<a xmlns:l="http://www.w3.org/1999/xlink" l:href="javascript:alert(1)"><rect/></a>`, "alert"},
+		{"set", `<a><set attributeName="href" to="javascript:alert(1)"/><rect/></a>`, "alert"},
+		{"animate", `<a><animate attributeName="xlink:href" values="javascript:alert(1)"/><rect/></a>`, "alert"},
+		{"animate content", `<a><animate attributeName="href" to="javascript:alert(1)"></animate><rect/></a>`, "alert"},
+	}
+	for _, test := range testTable {
+		input := fmt.Sprintf(svg, test.input)
+		output := new(bytes.Buffer)
+		report, err := Sanitize(strings.NewReader(input), output, WithSVGScriptRemoval())
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if strings.Contains(output.String(), test.absent) || !report.ScriptsRemoved {
+			t.Errorf("%s: expected the script to be removed, got %+v:\n%s", test.name, report, output)
+		}
+	}
+
+	// Links that are not scripts, and elements of other namespaces named script, are kept.
+	input := fmt.Sprintf(svg, `<a href="https://example.com/?a=1&amp;b=2"><set attributeName="fill" to="red"/><rect/></a><x:script xmlns:x="urn:example">data</x:script>`)
+	output := new(bytes.Buffer)
+	report, err := Sanitize(strings.NewReader(input), output, WithSVGScriptRemoval())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output.String() != input || report.ScriptsRemoved {
+		t.Errorf("expected the image to be copied unchanged, got %+v:\n%s", report, output)
+	}
+}
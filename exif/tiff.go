@@ -0,0 +1,459 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Tags of TIFF images locating their image data, and the reduced resolution images of a page.
+const (
+	tagStripOffsets       = 0x0111
+	tagStripByteCounts    = 0x0117
+	tagTileOffsets        = 0x0144
+	tagTileByteCounts     = 0x0145
+	tagSubIFDs            = 0x014A
+	tagJPEGInterchange    = 0x0201
+	tagJPEGInterchangeLen = 0x0202
+	tagICCProfile         = 0x8773
+)
+
+const (
+	// maxTIFFPages bounds the pages of a TIFF image, and maxTIFFDepth the nesting of its reduced
+	// resolution images, so that crafted files cannot exhaust the memory.
+	maxTIFFPages = 10000
+	maxTIFFDepth = 4
+
+	// tiffIFDType is the type of the values of tags pointing to IFDs, as LONG values.
+	tiffIFDType = 13
+)
+
+// tiffImageTags are the tags of TIFF images describing how their pages are stored and displayed,
+// which are kept. All other tags are metadata, such as the camera, software, author, dates, EXIF
+// and GPS IFDs and XMP and IPTC packets, and are removed.
+var tiffImageTags = map[uint16]bool{
+	0x00FE: true, // NewSubfileType
+	0x00FF: true, // SubfileType
+	0x0100: true, // ImageWidth
+	0x0101: true, // ImageLength
+	0x0102: true, // BitsPerSample
+	0x0103: true, // Compression
+	0x0106: true, // PhotometricInterpretation
+	0x0107: true, // Threshholding
+	0x0108: true, // CellWidth
+	0x0109: true, // CellLength
+	0x010A: true, // FillOrder
+	0x0111: true, // StripOffsets
+	0x0112: true, // Orientation
+	0x0115: true, // SamplesPerPixel
+	0x0116: true, // RowsPerStrip
+	0x0117: true, // StripByteCounts
+	0x0118: true, // MinSampleValue
+	0x0119: true, // MaxSampleValue
+	0x011A: true, // XResolution
+	0x011B: true, // YResolution
+	0x011C: true, // PlanarConfiguration
+	0x011E: true, // XPosition
+	0x011F: true, // YPosition
+	0x0122: true, // GrayResponseUnit
+	0x0123: true, // GrayResponseCurve
+	0x0124: true, // T4Options
+	0x0125: true, // T6Options
+	0x0128: true, // ResolutionUnit
+	0x0129: true, // PageNumber
+	0x012D: true, // TransferFunction
+	0x013D: true, // Predictor
+	0x013E: true, // WhitePoint
+	0x013F: true, // PrimaryChromaticities
+	0x0140: true, // ColorMap
+	0x0141: true, // HalftoneHints
+	0x0142: true, // TileWidth
+	0x0143: true, // TileLength
+	0x0144: true, // TileOffsets
+	0x0145: true, // TileByteCounts
+	0x0146: true, // BadFaxLines
+	0x0147: true, // CleanFaxData
+	0x0148: true, // ConsecutiveBadFaxLines
+	0x014A: true, // SubIFDs
+	0x014C: true, // InkSet
+	0x014D: true, // InkNames
+	0x014E: true, // NumberOfInks
+	0x0150: true, // DotRange
+	0x0152: true, // ExtraSamples
+	0x0153: true, // SampleFormat
+	0x0154: true, // SMinSampleValue
+	0x0155: true, // SMaxSampleValue
+	0x0156: true, // TransferRange
+	0x015B: true, // JPEGTables
+	0x0200: true, // JPEGProc
+	0x0201: true, // JPEGInterchangeFormat
+	0x0202: true, // JPEGInterchangeFormatLength
+	0x0211: true, // YCbCrCoefficients
+	0x0212: true, // YCbCrSubSampling
+	0x0213: true, // YCbCrPositioning
+	0x0214: true, // ReferenceBlackWhite
+	0x8773: true, // InterColorProfile
+}
+
+// tiffDataTags pairs the tags holding the offsets of the image data of a page with those holding
+// its sizes.
+var tiffDataTags = map[uint16]uint16{
+	tagStripOffsets:    tagStripByteCounts,
+	tagTileOffsets:     tagTileByteCounts,
+	tagJPEGInterchange: tagJPEGInterchangeLen,
+}
+
+func isTIFF(raw []byte) bool {
+	return len(raw) >= 8 && (bytes.HasPrefix(raw, []byte("II*\x00")) || bytes.HasPrefix(raw, []byte("MM\x00*")))
+}
+
+// tiffEntry is an entry of an IFD being rewritten, with its value in the byte order of the image.
+type tiffEntry struct {
+	tag, typ uint16
+	count    uint32
+	value    []byte
+
+	// at is where the value is written when it does not fit in the entry.
+	at int
+}
+
+// tiffDir is an IFD of a TIFF image being rewritten: the entries kept, the image data their
+// offsets point to, and the IFDs of its reduced resolution images.
+type tiffDir struct {
+	entries []*tiffEntry
+	offset  int
+
+	// data holds the strips or tiles of the image for each entry holding their offsets, and at
+	// where they are written.
+	data map[*tiffEntry][][]byte
+	at   map[*tiffEntry][]int
+
+	subIFDs     []*tiffDir
+	subIFDEntry *tiffEntry
+}
+
+// tiffRewriter rewrites a TIFF image, page by page, without its metadata tags.
+type tiffRewriter struct {
+	t      *tiffData
+	o      *options
+	report *Report
+
+	// visited are the offsets of the IFDs already read, so that loops are not followed.
+	visited map[int]bool
+
+	// chunks are the ranges of the strips and tiles of every page, and chunkSize their sum, so
+	// that crafted images repeating the same data cannot make their copy larger than they are.
+	chunks    []tiffRange
+	chunkSize uint64
+}
+
+// tiffRange is a range of the bytes of a TIFF image.
+type tiffRange struct {
+	start, end uint64
+}
+
+// sanitizeTIFFImage removes the metadata tags from every page of the TIFF image raw, such as
+// the multi-page images of scanners and faxes, keeping only the tags describing how the pages are
+// stored and displayed, and applies the ICC policy to their color profiles. The EXIF and GPS IFDs
+// are removed, whatever the options editing EXIF data. As the values of removed tags may be
+// anywhere in the file, the image is rewritten rather than edited in place: each page is written
+// with its values and image data, followed by its reduced resolution images, and the offsets
+// pointing to them are updated. Pages keep their order.
+func sanitizeTIFFImage(raw []byte, o *options) ([][]byte, *Report, error) {
+	t, err := parseTIFF(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := &tiffRewriter{t: t, o: o, report: &Report{Format: "tiff"}, visited: make(map[int]bool)}
+	r.report.Summary = summarizeTIFF(raw)
+
+	var pages []*tiffDir
+	for offset := int(t.order.Uint32(raw[4:])); offset != 0; {
+		if len(pages) == maxTIFFPages {
+			return nil, nil, malformed("the TIFF image has more than %d pages", maxTIFFPages)
+		}
+		page, next, err := r.readDir(offset, 0)
+		if err != nil {
+			return nil, nil, fmt.Errorf("page %d: %w", len(pages)+1, err)
+		}
+		if len(pages) == 0 {
+			r.report.Width, r.report.Height = page.size(t.order)
+		}
+		pages = append(pages, page)
+		offset = next
+	}
+	if len(pages) == 0 {
+		return nil, nil, fmt.Errorf("the TIFF image has no pages")
+	}
+	if err := r.checkChunks(); err != nil {
+		return nil, nil, err
+	}
+	o.logf("Rewriting the %d pages of the TIFF image", len(pages))
+
+	end := 8
+	for _, page := range pages {
+		end = page.layout(end)
+	}
+	header := append([]byte{}, raw[:4]...)
+	header = appendUint32(t.order, header, uint32(pages[0].offset))
+	parts := [][]byte{header}
+	written := len(header)
+	for i, page := range pages {
+		next := 0
+		if i+1 < len(pages) {
+			next = pages[i+1].offset
+		}
+		parts, written = page.encode(parts, written, next, t.order)
+	}
+	r.report.BytesRemoved = len(raw) - written
+	return parts, r.report, nil
+}
+
+// readDir reads the IFD at offset, and the reduced resolution images it points to, keeping the
+// tags of tiffImageTags. It returns the IFD with the offset of the next one.
+func (r *tiffRewriter) readDir(offset, depth int) (*tiffDir, int, error) {
+	if r.visited[offset] {
+		return nil, 0, malformed("the IFD at offset %d is used twice", offset)
+	}
+	r.visited[offset] = true
+	d, next, err := r.t.readIFD(ifd0, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	dir := &tiffDir{data: make(map[*tiffEntry][][]byte), at: make(map[*tiffEntry][]int)}
+	values := make(map[uint16]*tiffEntry)
+	for _, entry := range d.entries {
+		if !tiffImageTags[entry.tag] {
+			r.o.logf("Removing the %s tag of the TIFF image", tiffTagName(entry.tag))
+			if entry.tag == exifIFDPointer || entry.tag == gpsIFDPointer {
+				r.report.ExifRemoved = true
+			} else {
+				r.report.MetadataRemoved = true
+			}
+			continue
+		}
+		lookup := entry
+		if lookup.typ == tiffIFDType {
+			lookup.typ = 4
+		}
+		value, err := r.t.value(lookup)
+		if err != nil {
+			return nil, 0, err
+		}
+		e := &tiffEntry{tag: entry.tag, typ: entry.typ, count: entry.count, value: append([]byte{}, value...)}
+		if e.tag == tagICCProfile {
+			switch r.o.icc {
+			case ICCStrip:
+				r.report.ICCRemoved = true
+				continue
+			case ICCReplaceWithSRGB:
+				e.typ, e.value = 7, srgbProfile()
+				e.count = uint32(len(e.value))
+				r.report.ICCRemoved, r.report.SRGBAdded = true, true
+			}
+		}
+		values[e.tag] = e
+		dir.entries = append(dir.entries, e)
+	}
+	sort.SliceStable(dir.entries, func(i, j int) bool { return dir.entries[i].tag < dir.entries[j].tag })
+
+	for offsetsTag, countsTag := range tiffDataTags {
+		offsets, ok := values[offsetsTag]
+		if !ok {
+			continue
+		}
+		counts, ok := values[countsTag]
+		if !ok {
+			return nil, 0, fmt.Errorf("the %s tag is missing", tiffTagName(countsTag))
+		}
+		starts, sizes := r.numbers(offsets), r.numbers(counts)
+		if starts == nil || sizes == nil || len(starts) != len(sizes) {
+			return nil, 0, fmt.Errorf("the %s and %s tags do not match", tiffTagName(offsetsTag), tiffTagName(countsTag))
+		}
+		chunks := make([][]byte, len(starts))
+		for i := range starts {
+			if starts[i]+sizes[i] > uint64(len(r.t.data)) {
+				return nil, 0, fmt.Errorf("the image data at offset %d is truncated", starts[i])
+			}
+			r.chunkSize += sizes[i]
+			if r.chunkSize > uint64(len(r.t.data)) {
+				return nil, 0, malformed("the image data is larger than the image")
+			}
+			if sizes[i] > 0 {
+				r.chunks = append(r.chunks, tiffRange{starts[i], starts[i] + sizes[i]})
+			}
+			chunks[i] = r.t.data[starts[i] : starts[i]+sizes[i]]
+		}
+		// The offsets are rewritten as LONG values, as SHORT values may not reach them.
+		offsets.typ, offsets.value = 4, make([]byte, 4*len(starts))
+		dir.data[offsets] = chunks
+	}
+
+	if e, ok := values[tagSubIFDs]; ok {
+		if depth == maxTIFFDepth {
+			return nil, 0, malformed("the reduced resolution images are nested too deeply")
+		}
+		subOffsets := r.numbers(&tiffEntry{typ: 4, count: e.count, value: e.value})
+		for _, subOffset := range subOffsets {
+			sub, _, err := r.readDir(int(subOffset), depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			dir.subIFDs = append(dir.subIFDs, sub)
+		}
+		dir.subIFDEntry = e
+	}
+	return dir, next, nil
+}
+
+// checkChunks returns an error if the strips or tiles of the pages overlap, as each of them is
+// written with its page.
+func (r *tiffRewriter) checkChunks() error {
+	sort.Slice(r.chunks, func(i, j int) bool { return r.chunks[i].start < r.chunks[j].start })
+	for i := 1; i < len(r.chunks); i++ {
+		if r.chunks[i].start < r.chunks[i-1].end {
+			return malformed("the image data at offsets %d and %d overlaps", r.chunks[i-1].start, r.chunks[i].start)
+		}
+	}
+	return nil
+}
+
+// numbers returns the values of an entry of the SHORT or LONG type, or nil for other types.
+func (r *tiffRewriter) numbers(e *tiffEntry) []uint64 {
+	var numbers []uint64
+	switch e.typ {
+	case 3:
+		for i := 0; i+2 <= len(e.value); i += 2 {
+			numbers = append(numbers, uint64(r.t.order.Uint16(e.value[i:])))
+		}
+	case 4:
+		for i := 0; i+4 <= len(e.value); i += 4 {
+			numbers = append(numbers, uint64(r.t.order.Uint32(e.value[i:])))
+		}
+	default:
+		return nil
+	}
+	return numbers
+}
+
+// size returns the width and height of the page, as viewers display it according to its
+// orientation, or zeros if unknown.
+func (d *tiffDir) size(order binary.ByteOrder) (int, int) {
+	var width, height, orientation int
+	for _, e := range d.entries {
+		var v int
+		switch {
+		case e.typ == 3 && len(e.value) >= 2:
+			v = int(order.Uint16(e.value))
+		case e.typ == 4 && len(e.value) >= 4:
+			v = int(order.Uint32(e.value))
+		}
+		switch e.tag {
+		case 0x0100:
+			width = v
+		case 0x0101:
+			height = v
+		case tagOrientation:
+			orientation = v
+		}
+	}
+	if orientation >= 5 {
+		return height, width
+	}
+	return width, height
+}
+
+// layout assigns offsets to the IFD, the values that do not fit in its entries, its image data
+// and its reduced resolution images, starting at offset, and returns where they end. IFDs and
+// values start on a word boundary, as TIFF requires.
+func (d *tiffDir) layout(offset int) int {
+	d.offset = offset + offset%2
+	end := d.offset + tagCountLenSize + len(d.entries)*tagSize + ifdOffsetSize
+	for _, e := range d.entries {
+		if len(e.value) > ifdOffsetSize {
+			e.at = end
+			end += len(e.value) + len(e.value)%2
+		}
+	}
+	for _, e := range d.entries {
+		for _, chunk := range d.data[e] {
+			d.at[e] = append(d.at[e], end)
+			end += len(chunk)
+		}
+	}
+	for _, sub := range d.subIFDs {
+		end = sub.layout(end)
+	}
+	return end
+}
+
+// encode appends the IFD, pointing to the IFD at next, its values, image data and reduced
+// resolution images to parts, which hold the first written bytes of the image, as laid out.
+func (d *tiffDir) encode(parts [][]byte, written, next int, order binary.ByteOrder) ([][]byte, int) {
+	for e, at := range d.at {
+		for i, offset := range at {
+			order.PutUint32(e.value[4*i:], uint32(offset))
+		}
+	}
+	if d.subIFDEntry != nil {
+		for i, sub := range d.subIFDs {
+			order.PutUint32(d.subIFDEntry.value[4*i:], uint32(sub.offset))
+		}
+	}
+
+	ifd := make([]byte, d.offset-written)
+	ifd = appendUint16(order, ifd, uint16(len(d.entries)))
+	for _, e := range d.entries {
+		ifd = appendUint16(order, ifd, e.tag)
+		ifd = appendUint16(order, ifd, e.typ)
+		ifd = appendUint32(order, ifd, e.count)
+		if len(e.value) > ifdOffsetSize {
+			ifd = appendUint32(order, ifd, uint32(e.at))
+		} else {
+			ifd = append(ifd, e.value...)
+			ifd = append(ifd, make([]byte, ifdOffsetSize-len(e.value))...)
+		}
+	}
+	ifd = appendUint32(order, ifd, uint32(next))
+	for _, e := range d.entries {
+		if len(e.value) > ifdOffsetSize {
+			ifd = append(ifd, e.value...)
+			ifd = append(ifd, make([]byte, len(e.value)%2)...)
+		}
+	}
+	parts = append(parts, ifd)
+	written += len(ifd)
+
+	for _, e := range d.entries {
+		for _, chunk := range d.data[e] {
+			parts = append(parts, chunk)
+			written += len(chunk)
+		}
+	}
+	for _, sub := range d.subIFDs {
+		parts, written = sub.encode(parts, written, 0, order)
+	}
+	return parts, written
+}
+
+func appendUint16(order binary.ByteOrder, b []byte, v uint16) []byte {
+	b = append(b, 0, 0)
+	order.PutUint16(b[len(b)-2:], v)
+	return b
+}
+
+func appendUint32(order binary.ByteOrder, b []byte, v uint32) []byte {
+	b = append(b, 0, 0, 0, 0)
+	order.PutUint32(b[len(b)-4:], v)
+	return b
+}
+
+// tiffTagName returns the name of a tag of IFD0, or its number in hexadecimal.
+func tiffTagName(tag uint16) string {
+	if name, ok := tagNames["IFD0"][tag]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04X", tag)
+}
@@ -0,0 +1,289 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tiffTestEntry is a tag of a page of a test TIFF image. Its count is derived from its value.
+type tiffTestEntry struct {
+	Tag   uint16
+	Type  uint16
+	Value []byte
+}
+
+// tiffTestPage is a page of a test TIFF image: its tags, and its image data, stored in strips
+// whose offsets and sizes are added to the tags.
+type tiffTestPage struct {
+	Entries []tiffTestEntry
+	Strips  [][]byte
+}
+
+func shortValue(v uint16) []byte { return binary.LittleEndian.AppendUint16(nil, v) }
+
+// tiffEntryAt returns the entry of the given tag of the little endian IFD at offset in raw.
+func tiffEntryAt(raw []byte, offset int, tag uint16) []byte {
+	for i := 0; i < int(binary.LittleEndian.Uint16(raw[offset:])); i++ {
+		entry := raw[offset+2+12*i:]
+		if binary.LittleEndian.Uint16(entry) == tag {
+			return entry[:12]
+		}
+	}
+	return nil
+}
+
+// tiffOf returns a little endian TIFF image of the given pages. Each page is written as its IFD,
+// its values that do not fit in their entries, and its strips.
+func tiffOf(pages ...tiffTestPage) []byte {
+	raw := []byte("II*\x00\x08\x00\x00\x00")
+	for i, page := range pages {
+		offsets, counts := []byte{}, []byte{}
+		for _, strip := range page.Strips {
+			offsets = binary.LittleEndian.AppendUint32(offsets, 0)
+			counts = binary.LittleEndian.AppendUint32(counts, uint32(len(strip)))
+		}
+		entries := append([]tiffTestEntry{}, page.Entries...)
+		entries = append(entries, tiffTestEntry{tagStripOffsets, 4, offsets}, tiffTestEntry{tagStripByteCounts, 4, counts})
+		for i := 1; i < len(entries); i++ {
+			for j := i; j > 0 && entries[j].Tag < entries[j-1].Tag; j-- {
+				entries[j], entries[j-1] = entries[j-1], entries[j]
+			}
+		}
+
+		start := len(raw)
+		valuesAt := start + 2 + 12*len(entries) + 4
+		at := valuesAt
+		for _, e := range entries {
+			if len(e.Value) > 4 {
+				at += len(e.Value) + len(e.Value)%2
+			}
+		}
+		for j := range page.Strips {
+			binary.LittleEndian.PutUint32(offsets[4*j:], uint32(at))
+			at += len(page.Strips[j])
+		}
+
+		raw = binary.LittleEndian.AppendUint16(raw, uint16(len(entries)))
+		var values []byte
+		for _, e := range entries {
+			raw = binary.LittleEndian.AppendUint16(raw, e.Tag)
+			raw = binary.LittleEndian.AppendUint16(raw, e.Type)
+			raw = binary.LittleEndian.AppendUint32(raw, uint32(len(e.Value)/typeSizes[e.Type]))
+			if len(e.Value) > 4 {
+				raw = binary.LittleEndian.AppendUint32(raw, uint32(valuesAt+len(values)))
+				values = append(values, e.Value...)
+				values = append(values, make([]byte, len(e.Value)%2)...)
+			} else {
+				raw = append(raw, e.Value...)
+				raw = append(raw, make([]byte, 4-len(e.Value))...)
+			}
+		}
+		next := 0
+		if i+1 < len(pages) {
+			next = at
+		}
+		raw = binary.LittleEndian.AppendUint32(raw, uint32(next))
+		raw = append(raw, values...)
+		for _, strip := range page.Strips {
+			raw = append(raw, strip...)
+		}
+	}
+	return raw
+}
+
+// readTIFFPages returns the tags and strips of the pages of the TIFF image raw.
+func readTIFFPages(t *testing.T, raw []byte) []tiffTestPage {
+	data, err := parseTIFF(raw)
+	if err != nil {
+		t.Fatalf("failed to parse the TIFF image: %v", err)
+	}
+	var pages []tiffTestPage
+	for offset := int(data.order.Uint32(raw[4:])); offset != 0; {
+		dir, next, err := data.readIFD(ifd0, offset)
+		if err != nil {
+			t.Fatalf("failed to read page %d: %v", len(pages)+1, err)
+		}
+		var page tiffTestPage
+		values := make(map[uint16][]byte)
+		for _, entry := range dir.entries {
+			value, err := data.value(entry)
+			if err != nil {
+				t.Fatalf("failed to read tag 0x%04X of page %d: %v", entry.tag, len(pages)+1, err)
+			}
+			values[entry.tag] = value
+			if entry.tag != tagStripOffsets && entry.tag != tagStripByteCounts {
+				page.Entries = append(page.Entries, tiffTestEntry{entry.tag, entry.typ, value})
+			}
+		}
+		for i := 0; i+4 <= len(values[tagStripOffsets]); i += 4 {
+			start := data.order.Uint32(values[tagStripOffsets][i:])
+			size := data.order.Uint32(values[tagStripByteCounts][i:])
+			page.Strips = append(page.Strips, raw[start:start+size])
+		}
+		pages = append(pages, page)
+		offset = next
+	}
+	return pages
+}
+
+func TestSanitizeTIFFImage(t *testing.T) {
+	width := tiffTestEntry{0x0100, 3, shortValue(8)}
+	height := tiffTestEntry{0x0101, 3, shortValue(2)}
+	compression := tiffTestEntry{0x0103, 3, shortValue(4)}
+	resolution := tiffTestEntry{0x011A, 5, []byte{200, 0, 0, 0, 1, 0, 0, 0}}
+	pageNumber := tiffTestEntry{0x0129, 3, []byte{0, 0, 2, 0}}
+	maker := tiffTestEntry{tagMake, 2, []byte("Scanner Co\x00")}
+	software := tiffTestEntry{0x0131, 2, []byte("ScanApp 1.0\x00")}
+	dateTime := tiffTestEntry{tagDateTime, 2, []byte("2024:03:02 13:45:30\x00")}
+	xmp := tiffTestEntry{0x02BC, 1, []byte("<x:xmpmeta>Secret</x:xmpmeta>")}
+	profile := tiffTestEntry{tagICCProfile, 7, []byte("Display P3 profile")}
+
+	input := tiffOf(
+		tiffTestPage{
+			Entries: []tiffTestEntry{width, height, compression, maker, resolution, pageNumber, software, dateTime, xmp, profile},
+			Strips:  [][]byte{[]byte("first strip"), []byte("second strip")},
+		},
+		tiffTestPage{
+			Entries: []tiffTestEntry{width, height, compression, resolution, {0x0129, 3, []byte{1, 0, 2, 0}}, dateTime},
+			Strips:  [][]byte{[]byte("page two")},
+		},
+	)
+	expected := []tiffTestPage{
+		{
+			Entries: []tiffTestEntry{width, height, compression, resolution, pageNumber, profile},
+			Strips:  [][]byte{[]byte("first strip"), []byte("second strip")},
+		},
+		{
+			Entries: []tiffTestEntry{width, height, compression, resolution, {0x0129, 3, []byte{1, 0, 2, 0}}},
+			Strips:  [][]byte{[]byte("page two")},
+		},
+	}
+
+	output := new(bytes.Buffer)
+	report, err := Sanitize(bytes.NewReader(input), output)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pages := readTIFFPages(t, output.Bytes()); !reflect.DeepEqual(expected, pages) {
+		t.Errorf("expected pages %+v, got %+v", expected, pages)
+	}
+	for _, removed := range []string{"Scanner Co", "ScanApp", "2024:03:02", "Secret"} {
+		if strings.Contains(output.String(), removed) {
+			t.Errorf("expected %q to be removed", removed)
+		}
+	}
+	if report.Format != "tiff" || !report.MetadataRemoved || report.Width != 8 || report.Height != 2 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if report.Summary == nil || report.Summary.Make != "Scanner Co" {
+		t.Errorf("unexpected summary: %+v", report.Summary)
+	}
+	if report.BytesRemoved != len(input)-output.Len() {
+		t.Errorf("expected %d bytes removed, got %d", len(input)-output.Len(), report.BytesRemoved)
+	}
+	if Detect(input) != "tiff" {
+		t.Errorf("expected tiff to be detected, got %q", Detect(input))
+	}
+
+	// The color profiles follow the ICC policy.
+	output.Reset()
+	report, err = Sanitize(bytes.NewReader(input), output, WithICCPolicy(ICCStrip))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !report.ICCRemoved || strings.Contains(output.String(), "Display P3") {
+		t.Errorf("expected the color profile to be removed: %+v", report)
+	}
+}
+
+func TestSanitizeTIFFImageSubIFDs(t *testing.T) {
+	// A page with a reduced resolution image, whose IFD and strip follow the page.
+	page := tiffOf(tiffTestPage{
+		Entries: []tiffTestEntry{{0x0100, 3, shortValue(8)}, {0x0101, 3, shortValue(2)}, {tagSubIFDs, 4, make([]byte, 4)}, {0x0131, 2, []byte("ScanApp 1.0\x00")}},
+		Strips:  [][]byte{[]byte("full")},
+	})
+	subIFD := len(page)
+	binary.LittleEndian.PutUint32(tiffEntryAt(page, 8, tagSubIFDs)[8:], uint32(subIFD))
+	input := append(page, tiffOf(tiffTestPage{
+		Entries: []tiffTestEntry{{0x00FE, 4, []byte{1, 0, 0, 0}}, {0x0100, 3, shortValue(4)}, {0x0131, 2, []byte("ScanApp 1.0\x00")}},
+		Strips:  [][]byte{[]byte("reduced")},
+	})[8:]...)
+	// Move the offsets of the reduced resolution image after the page.
+	for _, tag := range []uint16{tagStripOffsets, 0x0131} {
+		entry := tiffEntryAt(input, subIFD, tag)
+		binary.LittleEndian.PutUint32(entry[8:], binary.LittleEndian.Uint32(entry[8:])+uint32(subIFD-8))
+	}
+
+	output := new(bytes.Buffer)
+	if _, err := Sanitize(bytes.NewReader(input), output); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(output.String(), "ScanApp") {
+		t.Errorf("expected the software of both images to be removed")
+	}
+	data, _ := parseTIFF(output.Bytes())
+	dirs, err := data.ifds()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var subOffset uint32
+	for _, entry := range dirs[0].entries {
+		if entry.tag == tagSubIFDs {
+			subOffset = data.order.Uint32(data.data[entry.offset+8:])
+		}
+	}
+	reduced, _, err := data.readIFD(ifd0, int(subOffset))
+	if err != nil {
+		t.Fatalf("failed to read the reduced resolution image: %v", err)
+	}
+	for _, entry := range reduced.entries {
+		if entry.tag == tagStripOffsets {
+			start := data.order.Uint32(data.data[entry.offset+8:])
+			if string(output.Bytes()[start:start+7]) != "reduced" {
+				t.Errorf("the strip of the reduced resolution image was not moved along")
+			}
+		}
+	}
+}
+
+func TestSanitizeTIFFImageErrors(t *testing.T) {
+	valid := tiffOf(tiffTestPage{Entries: []tiffTestEntry{{0x0100, 3, shortValue(8)}}, Strips: [][]byte{[]byte("strip")}})
+	loop := append([]byte{}, valid...)
+	// Point the page to itself as the next one.
+	binary.LittleEndian.PutUint32(loop[8+2+12*3:], 8)
+	truncated := valid[:len(valid)-2]
+	// Point the second strip to the first one, as crafted images repeating their data do.
+	repeated := tiffOf(tiffTestPage{Strips: [][]byte{[]byte("strip"), []byte("strip")}})
+	offsets := tiffEntryAt(repeated, 8, tagStripOffsets)
+	at := binary.LittleEndian.Uint32(offsets[8:])
+	copy(repeated[at+4:at+8], repeated[at:at+4])
+	overlapping := append([]byte{}, repeated...)
+	binary.LittleEndian.PutUint32(overlapping[at+4:], binary.LittleEndian.Uint32(overlapping[at:])+2)
+
+	testTable := []struct {
+		Name      string
+		Input     []byte
+		Malformed bool
+	}{
+		{Name: "no pages", Input: []byte("II*\x00\x00\x00\x00\x00")},
+		{Name: "loop", Input: loop, Malformed: true},
+		{Name: "truncated strip", Input: truncated},
+		{Name: "repeated strip", Input: repeated, Malformed: true},
+		{Name: "overlapping strips", Input: overlapping, Malformed: true},
+		{Name: "missing byte counts", Input: []byte("II*\x00\x08\x00\x00\x00\x01\x00\x11\x01\x04\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")},
+	}
+
+	for _, test := range testTable {
+		_, err := Sanitize(bytes.NewReader(test.Input), new(bytes.Buffer))
+		if err == nil {
+			t.Errorf("%s: expected an error", test.Name)
+		}
+		if test.Malformed && !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: expected an error wrapping ErrMalformed, got %v", test.Name, err)
+		}
+	}
+}
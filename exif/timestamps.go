@@ -0,0 +1,107 @@
+package exif
+
+// TimestampPolicy selects how Sanitize anonymizes the capture timestamps of images when given
+// WithTimestampPolicy, for hiding exact capture times without losing chronology.
+type TimestampPolicy int
+
+const (
+	// TimestampsRemove removes the timestamps.
+	TimestampsRemove TimestampPolicy = iota + 1
+
+	// TimestampsRoundToDay keeps the dates and sets the times of day to midnight. Sub-second
+	// times are removed.
+	TimestampsRoundToDay
+)
+
+// String returns the name of the policy as used in configuration files and flags.
+func (p TimestampPolicy) String() string {
+	switch p {
+	case TimestampsRemove:
+		return "remove"
+	case TimestampsRoundToDay:
+		return "round-to-day"
+	}
+	return "unknown"
+}
+
+// ParseTimestampPolicy returns the policy with the given name: remove or round-to-day.
+func ParseTimestampPolicy(name string) (TimestampPolicy, bool) {
+	for _, policy := range []TimestampPolicy{TimestampsRemove, TimestampsRoundToDay} {
+		if policy.String() == name {
+			return policy, true
+		}
+	}
+	return 0, false
+}
+
+// WithTimestampPolicy makes Sanitize keep the EXIF data and only anonymize its timestamps, rather
+// than remove it entirely. Other tags, including GPS coordinates, are kept.
+func WithTimestampPolicy(policy TimestampPolicy) Option {
+	return func(o *options) {
+		o.timestamps = policy
+		switch policy {
+		case TimestampsRemove:
+			o.edits = append(o.edits,
+				removeTags(ifd0, tagDateTime),
+				removeTags(exifIFD, tagDateTimeOriginal, tagDateTimeDigitized, tagOffsetTime, tagOffsetTimeOriginal,
+					tagOffsetTimeDigitized, tagSubSecTime, tagSubSecTimeOriginal, tagSubSecTimeDigitized),
+				removeTags(gpsIFD, tagGPSTimeStamp, tagGPSDateStamp),
+			)
+		case TimestampsRoundToDay:
+			o.edits = append(o.edits,
+				roundTimestamps,
+				removeTags(exifIFD, tagSubSecTime, tagSubSecTimeOriginal, tagSubSecTimeDigitized),
+			)
+		}
+	}
+}
+
+// Timestamp tags.
+const (
+	tagDateTime            = 0x0132
+	tagDateTimeOriginal    = 0x9003
+	tagDateTimeDigitized   = 0x9004
+	tagOffsetTime          = 0x9010
+	tagOffsetTimeOriginal  = 0x9011
+	tagOffsetTimeDigitized = 0x9012
+	tagSubSecTime          = 0x9290
+	tagSubSecTimeOriginal  = 0x9291
+	tagSubSecTimeDigitized = 0x9292
+	tagGPSTimeStamp        = 0x0007
+	tagGPSDateStamp        = 0x001D
+)
+
+// roundTimestamps sets the time of day of the DateTime tags, formatted as "YYYY:MM:DD HH:MM:SS",
+// to midnight, and zeroes the GPS time stamp, which holds the hours, minutes and seconds as three
+// rationals.
+func roundTimestamps(t *tiffData, dirs []*ifd) int {
+	rounded := 0
+	for _, dir := range dirs {
+		for _, entry := range dir.entries {
+			isDateTime := (dir.kind == ifd0 && entry.tag == tagDateTime) ||
+				(dir.kind == exifIFD && (entry.tag == tagDateTimeOriginal || entry.tag == tagDateTimeDigitized))
+			isGPSTime := dir.kind == gpsIFD && entry.tag == tagGPSTimeStamp
+			if !isDateTime && !isGPSTime {
+				continue
+			}
+
+			value, err := t.value(entry)
+			if err != nil {
+				continue
+			}
+			switch {
+			case isDateTime && len(value) >= 19:
+				copy(value[11:19], "00:00:00")
+			case isGPSTime && len(value) == 24:
+				// Keep the denominators, so that the rationals stay valid.
+				for i := 0; i < len(value); i += 8 {
+					zero(value[i : i+4])
+				}
+			default:
+				continue
+			}
+			rounded++
+		}
+	}
+	return rounded
+}
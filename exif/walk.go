@@ -0,0 +1,246 @@
+package exif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif/jpegseg"
+)
+
+// SkipAll is returned by the function passed to Walk to stop the walk without error, such as once
+// it has found the tag it looks for.
+var SkipAll = errors.New("skip all remaining tags")
+
+// ifdNames are the names of the IFDs reported by Walk.
+var ifdNames = map[ifdKind]string{
+	ifd0:       "IFD0",
+	ifd1:       "IFD1",
+	exifIFD:    "Exif",
+	gpsIFD:     "GPS",
+	interopIFD: "Interop",
+}
+
+// IFDInfo describes the image file directory holding a tag visited by Walk.
+type IFDInfo struct {
+	// Name is IFD0 for the main image, IFD1 for the thumbnail, and Exif, GPS or Interop for the
+	// sub-IFDs they point to.
+	Name string
+
+	// Offset is where the IFD starts, from the start of the TIFF header of the EXIF data.
+	Offset int
+}
+
+// Tag is an entry of an IFD visited by Walk.
+type Tag struct {
+	// ID is the number of the tag, which is only unique within its IFD, and Type the TIFF type
+	// of its values, such as 2 for ASCII strings, 129 for the UTF-8 strings of EXIF 3.0, or 5 for
+	// rationals.
+	ID    uint16
+	Type  uint16
+	Count uint32
+
+	// Value is the raw value of the tag, in ByteOrder, or nil if the type is unknown or the value
+	// lies outside the EXIF data.
+	Value     []byte
+	ByteOrder binary.ByteOrder
+}
+
+// Walk calls fn for each tag of the EXIF data of the image read from r, IFD by IFD: IFD0 and
+// IFD1 first, then the EXIF, GPS and interoperability IFDs they point to. Unlike Sanitize, it
+// only reads the image up to its EXIF data and does not keep a parsed copy of it, which suits
+// quick checks such as whether an image records a location. JPEG, PNG and WebP images and bare
+// TIFF structures are supported; images without EXIF data are walked without calling fn.
+//
+// If fn returns an error, Walk stops and returns it, unless it is SkipAll, which stops the walk
+// without error. EXIF data whose IFDs cannot be followed, such as IFDs pointing back to
+// themselves, makes Walk fail with an error wrapping ErrMalformed.
+func Walk(r io.Reader, fn func(ifd IFDInfo, tag Tag) error) error {
+	data, err := readEXIF(bufio.NewReader(r))
+	if err != nil || data == nil {
+		return err
+	}
+	if err := walkTIFF(data, fn); !errors.Is(err, SkipAll) {
+		return err
+	}
+	return nil
+}
+
+// readEXIF reads the EXIF data of the image read from r, as a bare TIFF structure, or nil if it
+// has none.
+func readEXIF(r *bufio.Reader) ([]byte, error) {
+	header, err := r.Peek(12)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(header, []byte{markerPrefix, soiMarker}):
+		return readJPEGEXIF(r)
+	case bytes.HasPrefix(header, pngSignature):
+		return readPNGEXIF(r)
+	case isWebP(header):
+		return readWebPEXIF(r)
+	case bytes.HasPrefix(header, []byte("II*\x00")) || bytes.HasPrefix(header, []byte("MM\x00*")):
+		return ioutil.ReadAll(r)
+	}
+	return nil, fmt.Errorf("unsupported image format: expected a JPEG, PNG or WebP image or TIFF data")
+}
+
+// readJPEGEXIF reads the segments of the JPEG image read from r up to its EXIF segment, and
+// returns the EXIF data, or nil if it has none before its image data.
+func readJPEGEXIF(r *bufio.Reader) ([]byte, error) {
+	segments := jpegseg.NewReader(r)
+	for {
+		s, err := segments.Next()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if s.Marker == jpegseg.APP1 && bytes.HasPrefix(s.Payload, exifIdent) {
+			return s.Payload[len(exifIdent):], nil
+		}
+	}
+}
+
+// readPNGEXIF reads the chunks of the PNG image read from r up to its eXIf chunk, and returns the
+// EXIF data, or nil if it has none.
+func readPNGEXIF(r *bufio.Reader) ([]byte, error) {
+	if _, err := r.Discard(len(pngSignature)); err != nil {
+		return nil, err
+	}
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		length := int(binary.BigEndian.Uint32(header))
+		switch string(header[4:]) {
+		case "eXIf":
+			return readChunkData(r, length)
+		case "IEND":
+			return nil, nil
+		}
+		// Skip the data and the CRC.
+		if _, err := r.Discard(length + 4); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	}
+}
+
+// readWebPEXIF reads the chunks of the WebP image read from r up to its EXIF chunk, and returns
+// the EXIF data, or nil if it has none.
+func readWebPEXIF(r *bufio.Reader) ([]byte, error) {
+	if _, err := r.Discard(12); err != nil {
+		return nil, err
+	}
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return nil, nil
+			}
+			return nil, unexpectedEOF(err)
+		}
+		length := int(binary.LittleEndian.Uint32(header[4:]))
+		if string(header[:4]) == "EXIF" {
+			data, err := readChunkData(r, length)
+			if err != nil {
+				return nil, err
+			}
+			// Some writers keep the APP1 identifier of JPEG images before the TIFF structure.
+			return bytes.TrimPrefix(data, exifIdent), nil
+		}
+		if _, err := r.Discard(length + length%2); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	}
+}
+
+// readChunkData reads the data of a chunk of the given length from r. The data is read as it
+// comes rather than allocated upfront, so that chunks declaring lengths far beyond the end of the
+// image cannot make it allocate that much.
+func readChunkData(r io.Reader, length int) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(length)))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < length {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
+}
+
+// unexpectedEOF turns the end of file in the middle of an image into an error.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// walkTIFF calls fn for each tag of the EXIF data stored as a bare TIFF structure, in the order
+// of ifds, reading one IFD at a time.
+func walkTIFF(data []byte, fn func(ifd IFDInfo, tag Tag) error) error {
+	t, err := parseTIFF(data)
+	if err != nil {
+		return err
+	}
+
+	type pending struct {
+		kind   ifdKind
+		offset int
+	}
+	queue := []pending{{ifd0, int(t.order.Uint32(data[4:]))}}
+	pointers := map[uint16]ifdKind{exifIFDPointer: exifIFD, gpsIFDPointer: gpsIFD, interopIFDPointer: interopIFD}
+	visited := map[int]bool{queue[0].offset: true}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		dir, nextOffset, err := t.readIFD(next.kind, next.offset)
+		if err != nil {
+			return err
+		}
+		if dir.kind == ifd0 && nextOffset != 0 {
+			if visited[nextOffset] {
+				return malformed("the next IFD offset of IFD0 points back to it")
+			}
+			visited[nextOffset] = true
+			queue = append([]pending{{ifd1, nextOffset}}, queue...)
+		}
+
+		info := IFDInfo{Name: ifdNames[dir.kind], Offset: dir.offset}
+		for _, entry := range dir.entries {
+			if err := fn(info, t.tag(entry)); err != nil {
+				return err
+			}
+
+			// The interoperability IFD hangs off the EXIF IFD, the others off IFD0.
+			kind, ok := pointers[entry.tag]
+			if !ok || (kind == interopIFD) != (dir.kind == exifIFD) {
+				continue
+			}
+			offset := int(t.order.Uint32(data[entry.offset+8:]))
+			if visited[offset] {
+				continue
+			}
+			if len(visited) == maxIFDs {
+				return malformed("the EXIF data points to more than %d IFDs", maxIFDs)
+			}
+			visited[offset] = true
+			queue = append(queue, pending{kind, offset})
+		}
+	}
+	return nil
+}
+
+// tag returns the entry as a Tag, with a nil value if it cannot be read.
+func (t *tiffData) tag(entry ifdEntry) Tag {
+	value, _ := t.value(entry)
+	return Tag{ID: entry.tag, Type: entry.typ, Count: entry.count, Value: value, ByteOrder: t.order}
+}
@@ -0,0 +1,176 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	segment := exifSegmentOf(
+		[]testTag{asciiTag(tagMake, "Apple"), asciiTag(tagModel, "iPhone 14 Pro")},
+		[]testTag{asciiTag(tagLensModel, "iPhone 14 Pro back camera")},
+		[]testTag{{Tag: tagGPSLatitude, Type: 5, Value: make([]byte, 24)}},
+	)
+	tiff := segment[4+len(exifIdent):]
+	riff := append([]byte("WEBP"), webpChunk("VP8X", make([]byte, 10))...)
+	riff = append(riff, webpChunk("EXIF", append(append([]byte{}, exifIdent...), tiff...))...)
+	webp := append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(riff)))...), riff...)
+
+	testTable := []struct {
+		name  string
+		image []byte
+	}{
+		{"JPEG", jpegOf(jfifSegment, segment)},
+		{"PNG", stillPNG(t, pngChunk("eXIf", tiff))},
+		{"WebP", webp},
+		{"TIFF", tiff},
+	}
+	expected := []string{
+		"IFD0 0x010f Apple",
+		"IFD0 0x0110 iPhone 14 Pro",
+		"IFD0 0x8769",
+		"IFD0 0x8825",
+		"Exif 0xa434 iPhone 14 Pro back camera",
+		"GPS 0x0002",
+	}
+	for _, test := range testTable {
+		t.Run(test.name, func(t *testing.T) {
+			var visited []string
+			err := Walk(bytes.NewReader(test.image), func(ifd IFDInfo, tag Tag) error {
+				line := fmt.Sprintf("%s 0x%04x", ifd.Name, tag.ID)
+				if tag.Type == 2 {
+					line += " " + string(bytes.TrimRight(tag.Value, "\x00"))
+				}
+				if tag.ByteOrder != binary.BigEndian || len(tag.Value) != int(tag.Count)*typeSizes[tag.Type] {
+					t.Errorf("unexpected value of tag %s: %x", line, tag.Value)
+				}
+				visited = append(visited, line)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fmt.Sprint(visited) != fmt.Sprint(expected) {
+				t.Errorf("expected tags %q, got %q", expected, visited)
+			}
+		})
+	}
+}
+
+func TestWalkStops(t *testing.T) {
+	image := jpegOf(exifSegmentOf(
+		[]testTag{asciiTag(tagMake, "Apple")}, nil,
+		[]testTag{{Tag: tagGPSLatitude, Type: 5, Value: make([]byte, 24)}},
+	))
+
+	// A location check stops at the first GPS tag.
+	gps := false
+	err := Walk(bytes.NewReader(image), func(ifd IFDInfo, tag Tag) error {
+		if ifd.Name == "GPS" {
+			gps = true
+			return SkipAll
+		}
+		return nil
+	})
+	if err != nil || !gps {
+		t.Errorf("expected the walk to stop at the GPS IFD without error, got %v", err)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = Walk(bytes.NewReader(image), func(ifd IFDInfo, tag Tag) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("expected the error of the first call, got %v after %d calls", err, calls)
+	}
+}
+
+func TestWalkMalformed(t *testing.T) {
+	// IFD0 holding a single tag, followed by the offset of the next IFD.
+	header := []byte{'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08}
+	selfReferencing := append(append([]byte{}, header...), 0x00, 0x01, 0x01, 0x0F, 0x00, 0x02, 0x00, 0x00, 0x00, 0x04, 'A', 'b', 'c', 0x00, 0x00, 0x00, 0x00, 0x08)
+
+	// IFD0 pointing to many empty EXIF IFDs, following it.
+	const pointers = 20
+	manyIFDs := binary.BigEndian.AppendUint16(append([]byte{}, header...), pointers)
+	for i := 0; i < pointers; i++ {
+		manyIFDs = binary.BigEndian.AppendUint16(manyIFDs, exifIFDPointer)
+		manyIFDs = binary.BigEndian.AppendUint16(manyIFDs, 4)
+		manyIFDs = binary.BigEndian.AppendUint32(manyIFDs, 1)
+		manyIFDs = binary.BigEndian.AppendUint32(manyIFDs, uint32(8+2+12*pointers+4+6*i))
+	}
+	manyIFDs = append(manyIFDs, make([]byte, 4+6*pointers)...)
+
+	for name, tiff := range map[string][]byte{"self referencing": selfReferencing, "many IFDs": manyIFDs} {
+		calls := 0
+		err := Walk(bytes.NewReader(tiff), func(IFDInfo, Tag) error {
+			calls++
+			return nil
+		})
+		if !errors.Is(err, ErrMalformed) || calls > maxIFDs*pointers {
+			t.Errorf("%s: expected an error wrapping ErrMalformed, got %v after %d calls", name, err, calls)
+		}
+		if _, err := parseAndReadIFDs(tiff); !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: expected an error wrapping ErrMalformed, got %v", name, err)
+		}
+	}
+}
+
+func TestWalkTagCountPastSegment(t *testing.T) {
+	// IFD0 claims 200 tags, which run past its APP1 segment into the XMP segment following it.
+	segment := exifSegmentOf([]testTag{asciiTag(tagMake, "Pixel")}, nil, nil)
+	binary.BigEndian.PutUint16(segment[4+len(exifIdent)+8:], 200)
+	image := jpegOf(segment, xmpSegment, bytes.Repeat(app11Segment(1, 1, make([]byte, 1000)), 3))
+
+	err := Walk(bytes.NewReader(image), func(IFDInfo, Tag) error {
+		t.Errorf("unexpected tag")
+		return nil
+	})
+	if !errors.Is(err, ErrMalformed) {
+		t.Errorf("expected an error wrapping ErrMalformed, got %v", err)
+	}
+
+	output := new(bytes.Buffer)
+	report, err := Sanitize(bytes.NewReader(image), output, WithSegmentAction(app11Marker, SegmentKeep))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := jpegOf(xmpSegment, bytes.Repeat(app11Segment(1, 1, make([]byte, 1000)), 3))
+	if !report.ExifRemoved || !bytes.Equal(expected, output.Bytes()) {
+		t.Errorf("expected the EXIF segment alone to be removed, got %q", output.Bytes())
+	}
+}
+
+// parseAndReadIFDs returns the IFDs of the bare TIFF structure tiff.
+func parseAndReadIFDs(tiff []byte) ([]*ifd, error) {
+	t, err := parseTIFF(tiff)
+	if err != nil {
+		return nil, err
+	}
+	return t.ifds()
+}
+
+func TestWalkWithoutEXIF(t *testing.T) {
+	for _, image := range [][]byte{jpegOf(xmpSegment), stillPNG(t)} {
+		err := Walk(bytes.NewReader(image), func(ifd IFDInfo, tag Tag) error {
+			t.Errorf("unexpected tag 0x%04x", tag.ID)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+
+	if err := Walk(bytes.NewReader([]byte("GIF89a")), func(IFDInfo, Tag) error { return nil }); err == nil {
+		t.Errorf("expected an error for unsupported formats")
+	}
+	truncated := jpegOf(exifSegment)[:20]
+	if err := Walk(bytes.NewReader(truncated), func(IFDInfo, Tag) error { return nil }); err == nil {
+		t.Errorf("expected an error for truncated images")
+	}
+}
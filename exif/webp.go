@@ -0,0 +1,149 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Flags of the VP8X chunk announcing the optional chunks of extended WebP images.
+const (
+	webpICCFlag       = 0x20
+	webpEXIFFlag      = 0x08
+	webpXMPFlag       = 0x04
+	webpAnimationFlag = 0x02
+)
+
+// webpMetadataFlags are the flags of the VP8X chunk announcing the optional chunks Sanitize may
+// remove or replace, by FourCC.
+var webpMetadataFlags = map[string]byte{"ICCP": webpICCFlag, "EXIF": webpEXIFFlag, "XMP ": webpXMPFlag}
+
+func isWebP(raw []byte) bool {
+	return len(raw) >= 12 && string(raw[:4]) == "RIFF" && string(raw[8:12]) == "WEBP"
+}
+
+// webpChunk returns a RIFF chunk of the given FourCC and data, padded to an even size.
+func webpChunk(fourCC string, data []byte) []byte {
+	chunk := append([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0x00)
+	}
+	return chunk
+}
+
+// webpSize returns the canvas size recorded in the VP8X, VP8 or VP8L chunk of the given FourCC
+// and data, or zeros if it cannot be read.
+func webpSize(fourCC string, data []byte) (int, int) {
+	switch {
+	case fourCC == "VP8X" && len(data) >= 10:
+		width := int(data[4]) | int(data[5])<<8 | int(data[6])<<16
+		height := int(data[7]) | int(data[8])<<8 | int(data[9])<<16
+		return width + 1, height + 1
+	case fourCC == "VP8 " && len(data) >= 10:
+		return int(binary.LittleEndian.Uint16(data[6:]) & 0x3FFF), int(binary.LittleEndian.Uint16(data[8:]) & 0x3FFF)
+	case fourCC == "VP8L" && len(data) >= 5 && data[0] == 0x2F:
+		bits := binary.LittleEndian.Uint32(data[1:])
+		return int(bits&0x3FFF) + 1, int(bits>>14&0x3FFF) + 1
+	}
+	return 0, 0
+}
+
+// sanitizeWebP removes the EXIF chunk, unless the options edit the EXIF data, and the XMP chunk
+// from the WebP image raw, and applies the ICC policy to its ICCP chunk. The ANIM and ANMF chunks
+// of animations, which hold the loop count and the frames with their timing, are kept. The flags
+// of the VP8X chunk of extended images are set to announce the optional chunks left, as decoders
+// may refuse images announcing missing chunks.
+func sanitizeWebP(raw []byte, o *options) ([][]byte, *Report, error) {
+	report := &Report{Format: "webp"}
+	size := int(binary.LittleEndian.Uint32(raw[4:]))
+	if size%2 == 1 || size < 4 || 8+size > len(raw) {
+		return nil, nil, fmt.Errorf("the WebP RIFF size %d does not match the file size %d", size, len(raw))
+	}
+	end := trailer(raw, 8+size, o, report)
+
+	var chunks [][]byte
+	vp8x := -1
+	var flags byte
+	for offset := 12; offset < 8+size; {
+		if offset+8 > 8+size {
+			return nil, nil, fmt.Errorf("the WebP chunk at offset %d is truncated", offset)
+		}
+		fourCC := string(raw[offset : offset+4])
+		length := int(binary.LittleEndian.Uint32(raw[offset+4:]))
+		chunkEnd := offset + 8 + length + length%2
+		if length < 0 || chunkEnd > 8+size {
+			return nil, nil, fmt.Errorf("the WebP %s chunk at offset %d is truncated", fourCC, offset)
+		}
+		data := raw[offset+8 : offset+8+length]
+		chunk := raw[offset:chunkEnd]
+		offset = chunkEnd
+
+		if report.Width == 0 {
+			report.Width, report.Height = webpSize(fourCC, data)
+		}
+		switch fourCC {
+		case "VP8X":
+			if length < 10 {
+				return nil, nil, fmt.Errorf("the WebP VP8X chunk is truncated")
+			}
+			vp8x = len(chunks)
+			flags = data[0]
+		case "ANMF":
+			if length >= 16 {
+				report.Frames++
+				milliseconds := int(data[12]) | int(data[13])<<8 | int(data[14])<<16
+				report.Duration += time.Duration(milliseconds) * time.Millisecond
+			}
+		case "EXIF":
+			// Some writers keep the APP1 identifier of JPEG images before the TIFF structure.
+			header := []byte{}
+			if bytes.HasPrefix(data, exifIdent) {
+				header = exifIdent
+			}
+			edited := sanitizeTIFF(data[len(header):], o, report)
+			if edited == nil {
+				report.BytesRemoved += len(chunk)
+				continue
+			}
+			chunk = webpChunk(fourCC, append(append([]byte{}, header...), edited...))
+		case "XMP ":
+			report.MetadataRemoved = true
+			report.BytesRemoved += len(chunk)
+			continue
+		case "ICCP":
+			switch o.icc {
+			case ICCStrip:
+				report.ICCRemoved = true
+				report.BytesRemoved += len(chunk)
+				continue
+			case ICCReplaceWithSRGB:
+				chunk = webpChunk(fourCC, srgbProfile())
+				report.ICCRemoved = true
+				report.SRGBAdded = true
+			}
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	if vp8x >= 0 {
+		header := append([]byte{}, chunks[vp8x]...)
+		header[8] = flags &^ (webpICCFlag | webpEXIFFlag | webpXMPFlag)
+		for _, chunk := range chunks {
+			header[8] |= webpMetadataFlags[string(chunk[:4])]
+		}
+		chunks[vp8x] = header
+	}
+	if flags&webpAnimationFlag == 0 {
+		report.Frames, report.Duration = 0, 0
+	}
+
+	total := 4
+	for _, chunk := range chunks {
+		total += len(chunk)
+	}
+	parts := [][]byte{append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(total))...), raw[8:12]}
+	parts = append(parts, chunks...)
+	return append(parts, raw[8+size:end]), report, nil
+}
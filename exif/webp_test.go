@@ -0,0 +1,86 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// webpOf returns a WebP image of the given chunks, the first of which is its VP8X chunk if any.
+func webpOf(chunks ...[]byte) []byte {
+	riff := append([]byte("WEBP"), bytes.Join(chunks, nil)...)
+	return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(riff)))...), riff...)
+}
+
+// vp8xOf returns a VP8X chunk of the given flags, for a 3x2 canvas.
+func vp8xOf(flags byte) []byte {
+	return webpChunk("VP8X", []byte{flags, 0, 0, 0, 2, 0, 0, 1, 0, 0})
+}
+
+func TestSanitizeWebP(t *testing.T) {
+	lossy := webpChunk("VP8 ", []byte{0x30, 0x01, 0x00, 0x9D, 0x01, 0x2A, 3, 0, 2, 0})
+	lossless := webpChunk("VP8L", []byte{0x2F, 0x02, 0x40, 0x00, 0x00})
+	tiff := exifSegmentOf([]testTag{asciiTag(tagMake, "Pixel")}, nil, nil)[4+len(exifIdent):]
+	iccp := webpChunk("ICCP", []byte("Display P3"))
+	exifChunk := webpChunk("EXIF", tiff)
+	xmp := webpChunk("XMP ", []byte("<x:xmpmeta>Secret</x:xmpmeta>"))
+	srgb := webpChunk("ICCP", srgbProfile())
+
+	testTable := []struct {
+		Name   string
+		Input  []byte
+		Output []byte
+		Policy ICCPolicy
+	}{
+		{
+			Name:   "lossy",
+			Input:  webpOf(vp8xOf(webpICCFlag|webpEXIFFlag|webpXMPFlag), iccp, lossy, exifChunk, xmp),
+			Output: webpOf(vp8xOf(webpICCFlag), iccp, lossy),
+		},
+		{
+			Name:   "lossless with alpha",
+			Input:  webpOf(vp8xOf(0x10|webpEXIFFlag|webpXMPFlag), lossless, exifChunk, xmp),
+			Output: webpOf(vp8xOf(0x10), lossless),
+		},
+		{
+			Name:   "profile stripped",
+			Input:  webpOf(vp8xOf(webpICCFlag|webpXMPFlag), iccp, lossless, xmp),
+			Output: webpOf(vp8xOf(0), lossless),
+			Policy: ICCStrip,
+		},
+		{
+			Name:   "profile replaced without its flag",
+			Input:  webpOf(vp8xOf(0), iccp, lossy, xmp),
+			Output: webpOf(vp8xOf(webpICCFlag), srgb, lossy),
+			Policy: ICCReplaceWithSRGB,
+		},
+		{
+			Name:   "flags of missing chunks",
+			Input:  webpOf(vp8xOf(webpICCFlag|webpEXIFFlag|webpXMPFlag), lossy),
+			Output: webpOf(vp8xOf(0), lossy),
+		},
+		{
+			Name:   "simple format",
+			Input:  webpOf(lossy),
+			Output: webpOf(lossy),
+		},
+	}
+
+	for _, test := range testTable {
+		output := new(bytes.Buffer)
+		report, err := Sanitize(bytes.NewReader(test.Input), output, WithICCPolicy(test.Policy))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+			continue
+		}
+		if !bytes.Equal(test.Output, output.Bytes()) {
+			t.Errorf("%s: expected result to be: %q instead got: %q", test.Name, test.Output, output.Bytes())
+		}
+		if report.Format != "webp" || report.Width != 3 || report.Height != 2 {
+			t.Errorf("%s: unexpected report: %+v", test.Name, report)
+		}
+		if report.BytesRemoved != len(test.Input)-output.Len() && test.Policy != ICCReplaceWithSRGB {
+			t.Errorf("%s: expected %d bytes removed, got %d", test.Name, len(test.Input)-output.Len(), report.BytesRemoved)
+		}
+	}
+}
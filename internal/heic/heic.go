@@ -0,0 +1,94 @@
+// Package heic converts HEIF/HEIC images to JPEG with the external tools installed, as Go has no
+// HEVC decoder, for the commands and the plugin transcoding them.
+package heic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// ErrNoConverter is returned by ToJPEG when none of the converters it tries is installed.
+var ErrNoConverter = errors.New("converting HEIC requires heif-convert (libheif) or ImageMagick to be installed")
+
+// heicBrands are the ISO BMFF major brands identifying HEIF/HEIC images.
+var heicBrands = map[string]bool{
+	"heic": true, "heix": true, "heim": true, "heis": true,
+	"hevc": true, "hevx": true, "hevm": true, "hevs": true,
+	"mif1": true, "msf1": true,
+}
+
+// converters are the external tools tried, in order, to decode HEIC images. Each receives the
+// input and output paths as its last two arguments.
+var converters = [][]string{
+	{"heif-convert", "-q", "95"},
+	{"magick"},
+	{"convert"},
+}
+
+// Is reports whether the file starting with header is a HEIF/HEIC image.
+func Is(header []byte) bool {
+	return len(header) >= 12 &&
+		string(header[4:8]) == "ftyp" &&
+		heicBrands[string(header[8:12])]
+}
+
+// Available reports whether any of the converters ToJPEG tries is installed.
+func Available() bool {
+	for _, converter := range converters {
+		if _, err := exec.LookPath(converter[0]); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ToJPEG returns the HEIF/HEIC image read from input converted to JPEG by the first converter
+// installed, or ErrNoConverter if there is none. The converters also decode the AVIF images of
+// the libheif and ImageMagick builds supporting them.
+func ToJPEG(input io.Reader) ([]byte, error) {
+	dir, err := ioutil.TempDir("", "exif-remover")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "input.heic")
+	dst := filepath.Join(dir, "output.jpg")
+	f, err := os.Create(src)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(f, input)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := runConverter(src, dst); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(dst)
+}
+
+func runConverter(src, dst string) error {
+	for _, converter := range converters {
+		path, err := exec.LookPath(converter[0])
+		if err != nil {
+			continue
+		}
+
+		args := append(append([]string{}, converter[1:]...), src, dst)
+		out, err := exec.Command(path, args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s failed: %v: %s", converter[0], err, bytes.TrimSpace(out))
+		}
+		return nil
+	}
+	return ErrNoConverter
+}
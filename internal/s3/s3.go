@@ -0,0 +1,180 @@
+// Package s3 is a minimal S3 client, getting and putting objects with requests signed with AWS
+// Signature Version 4, shared by the commands reading and writing S3 and MinIO buckets.
+package s3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Client is a minimal S3 client supporting object GET and PUT, signed with AWS Signature
+// Version 4. Credentials, region and endpoint are read from the standard AWS environment
+// variables, and requests are sent anonymously when no credentials are set.
+type Client struct {
+	endpoint     string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// NewClient returns a client configured from the standard AWS environment variables.
+func NewClient() *Client {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	// AWS_ENDPOINT_URL allows pointing the client at S3-compatible stores such as MinIO.
+	endpoint := os.Getenv("AWS_ENDPOINT_URL")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+
+	return &Client{
+		endpoint:     strings.TrimSuffix(endpoint, "/"),
+		region:       region,
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// Get returns the body of the object stored at bucket/key.
+func (c *Client) Get(bucket, key string) (io.ReadCloser, error) {
+	resp, err := c.do(http.MethodGet, bucket, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, s3Error(resp)
+	}
+	return resp.Body, nil
+}
+
+// Put stores body as the object at bucket/key.
+func (c *Client) Put(bucket, key string, body []byte) error {
+	resp, err := c.do(http.MethodPut, bucket, key, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (c *Client) do(method, bucket, key string, body []byte) (*http.Response, error) {
+	// Use path-style addressing so bucket names with dots and custom endpoints work alike.
+	u, err := url.Parse(c.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	segments := append([]string{bucket}, strings.Split(key, "/")...)
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = s3Escape(segment)
+	}
+	u.RawPath = u.EscapedPath() + "/" + strings.Join(escaped, "/")
+	u.Path += "/" + strings.Join(segments, "/")
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+
+	if c.accessKey != "" && c.secretKey != "" {
+		c.sign(req, body, time.Now().UTC())
+	}
+
+	return http.DefaultClient.Do(req)
+}
+
+// sign adds AWS Signature Version 4 headers to req.
+// See https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html for details.
+func (c *Client) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+		signedHeaders += ";x-amz-security-token"
+		canonicalHeaders += "x-amz-security-token:" + c.sessionToken + "\n"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), date)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, signature))
+}
+
+// s3Escape percent-encodes every byte of a path segment but the unreserved characters of RFC
+// 3986, as the canonical requests of Signature Version 4 require. url.PathEscape leaves others,
+// such as + and =, which S3 would escape before checking the signature.
+func s3Escape(segment string) string {
+	var b strings.Builder
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func s3Error(resp *http.Response) error {
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 request failed with status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+	"github.com/pkg/errors"
+)
+
+const (
+	// auditKey is the key of the audit log in the plugin's key value store.
+	auditKey = "audit"
+
+	// maxAuditEvents is how many recent GPS detections and failures the audit log keeps.
+	maxAuditEvents = 20
+
+	// maxAuditAttempts bounds the retries of updates racing with other servers of a cluster.
+	maxAuditAttempts = 5
+
+	// auditRecordsPrefix is the prefix of the keys of the audit records, which is followed by the
+	// UTC date of the record and an ID unique to it, so that records are added without reading or
+	// racing with others. Records are kept for auditRecordRetention. Keys without an ID hold the
+	// array of the records of a day, as earlier versions stored them.
+	auditRecordsPrefix   = "audit_records_"
+	auditRecordRetention = 400 * 24 * time.Hour
+
+	// auditQueueSize bounds the audit writes waiting for the background writer. Writes are dropped
+	// beyond it rather than holding up uploads.
+	auditQueueSize = 1000
+
+	// noMetadataPossible is the detail of the records of uploads let through unchanged as their
+	// format cannot carry metadata, such as BMP images.
+	noMetadataPossible = "no metadata possible"
+
+	// noMetadataFound is the detail of the records of uploads let through unchanged as
+	// exif.NoMetadata found them free of metadata, without sanitizing them.
+	noMetadataFound = "no metadata found"
+
+	// spooledExif is the detail of the records of uploads exceeding the memory budget whose EXIF
+	// data was removed without being read.
+	spooledExif = "EXIF data of a spooled upload"
+)
+
+// auditLog is what the admin console dashboard shows: counts of the uploads processed, of those
+// let through by the pre-filter, and the bytes of metadata removed from them, and the most recent
+// uploads carrying a location and failures, newest first.
+type auditLog struct {
+	Processed      int64            `json:"processed"`
+	Prefiltered    int64            `json:"prefiltered"`
+	ByFormat       map[string]int64 `json:"by_format"`
+	BytesSaved     int64            `json:"bytes_saved"`
+	GPSDetected    int64            `json:"gps_detected"`
+	Failures       int64            `json:"failures"`
+	RecentGPS      []auditEvent     `json:"recent_gps"`
+	RecentFailures []auditEvent     `json:"recent_failures"`
+}
+
+// auditEvent is an upload recorded in the audit log.
+type auditEvent struct {
+	Time     int64  `json:"time"`
+	FileName string `json:"file_name"`
+	UserID   string `json:"user_id"`
+	Detail   string `json:"detail"`
+}
+
+// auditRecord is the record of an upload kept for exports, for handing to auditors. Unlike
+// events, every upload is recorded.
+type auditRecord struct {
+	Time         int64  `json:"time"`
+	FileName     string `json:"file_name"`
+	UserID       string `json:"user_id"`
+	Format       string `json:"format"`
+	Failed       bool   `json:"failed"`
+	GPS          bool   `json:"gps"`
+	BytesRemoved int    `json:"bytes_removed"`
+	Detail       string `json:"detail"`
+}
+
+// prependEvent adds event to the front of events, dropping the oldest beyond maxAuditEvents.
+func prependEvent(events []auditEvent, event auditEvent) []auditEvent {
+	events = append([]auditEvent{event}, events...)
+	if len(events) > maxAuditEvents {
+		events = events[:maxAuditEvents]
+	}
+	return events
+}
+
+// getAuditLog returns the audit log with its stored value, which is nil if there is none yet.
+func (p *Plugin) getAuditLog() (*auditLog, []byte, error) {
+	data, appErr := p.API.KVGet(auditKey)
+	if appErr != nil {
+		return nil, nil, errors.Wrap(appErr, "failed to read the audit log")
+	}
+	audit := &auditLog{}
+	if data != nil {
+		if err := json.Unmarshal(data, audit); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to decode the audit log")
+		}
+	}
+	if audit.ByFormat == nil {
+		audit.ByFormat = make(map[string]int64)
+	}
+	return audit, data, nil
+}
+
+// updateAuditLog applies update to the audit log, retrying if another server of the cluster
+// updates it concurrently.
+func (p *Plugin) updateAuditLog(update func(*auditLog)) error {
+	for attempt := 0; attempt < maxAuditAttempts; attempt++ {
+		audit, old, err := p.getAuditLog()
+		if err != nil {
+			return err
+		}
+		update(audit)
+
+		data, err := json.Marshal(audit)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode the audit log")
+		}
+		ok, appErr := p.API.KVCompareAndSet(auditKey, old, data)
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to write the audit log")
+		}
+		if ok {
+			return nil
+		}
+	}
+	return errors.New("the audit log kept changing while being updated")
+}
+
+// addAuditRecord stores record under a key of its own.
+func (p *Plugin) addAuditRecord(record auditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode the audit record")
+	}
+	key := auditRecordsPrefix + time.UnixMilli(record.Time).UTC().Format(dateLayout) + "_" + model.NewId()
+	_, appErr := p.API.KVSetWithOptions(key, data, model.PluginKVSetOptions{
+		ExpireInSeconds: int64(auditRecordRetention / time.Second),
+	})
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to write the audit record")
+	}
+	return nil
+}
+
+// auditRecords returns the records of the uploads of the UTC days from from to to, inclusive,
+// oldest first.
+func (p *Plugin) auditRecords(from, to time.Time) ([]auditRecord, error) {
+	first, last := from.UTC().Format(dateLayout), to.UTC().Format(dateLayout)
+	const perPage = 100
+	var keys []string
+	for page := 0; ; page++ {
+		list, appErr := p.API.KVList(page, perPage)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "failed to list the audit records")
+		}
+		for _, key := range list {
+			date := strings.TrimPrefix(key, auditRecordsPrefix)
+			if len(date) < len(dateLayout) || date == key {
+				continue
+			}
+			if date = date[:len(dateLayout)]; date >= first && date <= last {
+				keys = append(keys, key)
+			}
+		}
+		if len(list) < perPage {
+			break
+		}
+	}
+
+	var records []auditRecord
+	for _, key := range keys {
+		data, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "failed to read the audit records")
+		}
+		if data == nil {
+			continue
+		}
+		if len(key) == len(auditRecordsPrefix)+len(dateLayout) {
+			var daily []auditRecord
+			if err := json.Unmarshal(data, &daily); err != nil {
+				return nil, errors.Wrap(err, "failed to decode the audit records")
+			}
+			records = append(records, daily...)
+			continue
+		}
+		var record auditRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, errors.Wrap(err, "failed to decode the audit record")
+		}
+		records = append(records, record)
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time < records[j].Time })
+	return records, nil
+}
+
+// queueAudit has write done by the background writer started by OnActivate, so that uploads do
+// not wait for the audit log and records to be written, or right away if it is not running.
+// Writes are dropped, and counted in the warning logged, while auditQueueSize of them are waiting.
+func (p *Plugin) queueAudit(write func()) {
+	if p.auditQueue == nil {
+		write()
+		return
+	}
+	select {
+	case p.auditQueue <- write:
+	default:
+		dropped := p.auditDropped.Add(1)
+		p.API.LogWarn("Dropped an audit write, as too many are waiting to be written", "dropped", dropped)
+	}
+}
+
+// runAuditWriter does the writes queued by queueAudit until stop is closed, and then those still
+// queued.
+func (p *Plugin) runAuditWriter(queue <-chan func(), stop <-chan struct{}) {
+	for {
+		select {
+		case write := <-queue:
+			write()
+		case <-stop:
+			for {
+				select {
+				case write := <-queue:
+					write()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// auditUpload records in the audit log an upload sanitized with the given report.
+func (p *Plugin) auditUpload(info *model.FileInfo, report *exif.Report) {
+	p.auditUploadDetail(info, report, summarize(report))
+}
+
+// auditUploadDetail records in the audit log an upload sanitized with the given report, with the
+// given description of what was removed.
+func (p *Plugin) auditUploadDetail(info *model.FileInfo, report *exif.Report, detail string) {
+	now := model.GetMillis()
+	p.queueAudit(func() { p.writeAuditUpload(now, info.Name, info.CreatorId, report, detail) })
+}
+
+// writeAuditUpload writes the audit record and updates the audit log of an upload sanitized at
+// the time now, in milliseconds, by the given user.
+func (p *Plugin) writeAuditUpload(now int64, fileName, userID string, report *exif.Report, detail string) {
+	if err := p.addAuditRecord(auditRecord{
+		Time:         now,
+		FileName:     fileName,
+		UserID:       userID,
+		Format:       report.Format,
+		GPS:          report.Summary != nil && report.Summary.GPS,
+		BytesRemoved: report.BytesRemoved,
+		Detail:       detail,
+	}); err != nil {
+		p.API.LogWarn("Failed to record upload in the audit records", "err", err.Error())
+	}
+
+	err := p.updateAuditLog(func(audit *auditLog) {
+		audit.Processed++
+		if detail == noMetadataFound {
+			audit.Prefiltered++
+		}
+		audit.ByFormat[report.Format]++
+		audit.BytesSaved += int64(report.BytesRemoved)
+		if report.Summary != nil && report.Summary.GPS {
+			audit.GPSDetected++
+			audit.RecentGPS = prependEvent(audit.RecentGPS, auditEvent{
+				Time:     now,
+				FileName: fileName,
+				UserID:   userID,
+				Detail:   detail,
+			})
+		}
+	})
+	if err != nil {
+		p.API.LogWarn("Failed to record upload in the audit log", "err", err.Error())
+	}
+}
+
+// auditPassThrough records in the audit records an upload let through unchanged as its format
+// cannot carry metadata. It is not counted in the audit log, as nothing was sanitized.
+func (p *Plugin) auditPassThrough(info *model.FileInfo, format string) {
+	record := auditRecord{
+		Time:     model.GetMillis(),
+		FileName: info.Name,
+		UserID:   info.CreatorId,
+		Format:   format,
+		Detail:   noMetadataPossible,
+	}
+	p.queueAudit(func() {
+		if err := p.addAuditRecord(record); err != nil {
+			p.API.LogWarn("Failed to record upload in the audit records", "err", err.Error())
+		}
+	})
+}
+
+// auditFailure records in the audit log an upload that could not be sanitized.
+func (p *Plugin) auditFailure(info *model.FileInfo, failure error) {
+	record := auditRecord{
+		Time:     model.GetMillis(),
+		FileName: info.Name,
+		UserID:   info.CreatorId,
+		Failed:   true,
+		Detail:   failure.Error(),
+	}
+	p.queueAudit(func() {
+		if err := p.addAuditRecord(record); err != nil {
+			p.API.LogWarn("Failed to record failure in the audit records", "err", err.Error())
+		}
+
+		err := p.updateAuditLog(func(audit *auditLog) {
+			audit.Failures++
+			audit.RecentFailures = prependEvent(audit.RecentFailures, auditEvent{
+				Time:     record.Time,
+				FileName: record.FileName,
+				UserID:   record.UserID,
+				Detail:   record.Detail,
+			})
+		})
+		if err != nil {
+			p.API.LogWarn("Failed to record failure in the audit log", "err", err.Error())
+		}
+	})
+}
+
+// handleStats serves the audit log to the users allowed to view it, for the admin console
+// dashboard.
+func (p *Plugin) handleStats(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+	if !p.canViewStats(userID) {
+		http.Error(w, "You do not have permission to view the audit log", http.StatusForbidden)
+		return
+	}
+
+	audit, _, err := p.getAuditLog()
+	if err != nil {
+		p.API.LogError("Failed to read the audit log", "err", err.Error())
+		http.Error(w, "Failed to read the audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(audit)
+}
+
+// executeStats replies with the counts of the audit log, for the users allowed to view the
+// dashboard.
+func (p *Plugin) executeStats(args *model.CommandArgs) *model.CommandResponse {
+	if !p.canViewStats(args.UserId) {
+		return ephemeralResponse("You do not have permission to view the audit log.")
+	}
+	audit, _, err := p.getAuditLog()
+	if err != nil {
+		p.API.LogError("Failed to read the audit log", "err", err.Error())
+		return ephemeralResponse("Failed to read the audit log.")
+	}
+
+	formats := make([]string, 0, len(audit.ByFormat))
+	for format := range audit.ByFormat {
+		formats = append(formats, format)
+	}
+	sort.Slice(formats, func(i, j int) bool {
+		if audit.ByFormat[formats[i]] != audit.ByFormat[formats[j]] {
+			return audit.ByFormat[formats[i]] > audit.ByFormat[formats[j]]
+		}
+		return formats[i] < formats[j]
+	})
+	for i, format := range formats {
+		formats[i] = fmt.Sprintf("%s %d", strings.ToUpper(format), audit.ByFormat[format])
+	}
+
+	sanitized := strconv.FormatInt(audit.Processed, 10)
+	if len(formats) > 0 {
+		sanitized += " (" + strings.Join(formats, ", ") + ")"
+	}
+	prefiltered := strconv.FormatInt(audit.Prefiltered, 10)
+	if audit.Processed > 0 {
+		prefiltered += fmt.Sprintf(" (%.1f%%)", 100*float64(audit.Prefiltered)/float64(audit.Processed))
+	}
+	return ephemeralResponse(fmt.Sprintf("Uploads sanitized: %s\nFound free of metadata by the pre-filter: %s\nWith a location: %d\nFailed: %d\nStorage saved: %s",
+		sanitized, prefiltered, audit.GPSDetected, audit.Failures, formatBytes(audit.BytesSaved)))
+}
+
+// formatBytes formats a number of bytes with the largest binary unit it holds at least one of,
+// such as 1.5 MiB.
+func formatBytes(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d bytes", n)
+	}
+	value, unit := float64(n)/1024, 0
+	for value >= 1024 && unit < 3 {
+		value, unit = value/1024, unit+1
+	}
+	return fmt.Sprintf("%.1f %s", value, []string{"KiB", "MiB", "GiB", "TiB"}[unit])
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// isAuditRecordsKey matches the keys of the audit records.
+func isAuditRecordsKey(key string) bool {
+	return strings.HasPrefix(key, auditRecordsPrefix)
+}
+
+func TestAuditUpload(t *testing.T) {
+	assert := assert.New(t)
+	stored, _ := json.Marshal(&auditLog{Processed: 1, ByFormat: map[string]int64{"jpeg": 1}})
+
+	api := &plugintest.API{}
+	var written, record []byte
+	api.On("KVGet", auditKey).Return(stored, nil)
+	api.On("KVSetWithOptions", mock.MatchedBy(isAuditRecordsKey), mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		record = args.Get(1).([]byte)
+	}).Return(true, nil)
+	// The first write loses a race with another server, and is retried.
+	api.On("KVCompareAndSet", auditKey, stored, mock.Anything).Return(false, nil).Once()
+	api.On("KVCompareAndSet", auditKey, stored, mock.Anything).Run(func(args mock.Arguments) {
+		written = args.Get(2).([]byte)
+	}).Return(true, nil).Once()
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	p.auditUpload(&model.FileInfo{Name: "beach.jpg", CreatorId: "user"}, &exif.Report{
+		Format:       "jpeg",
+		Summary:      &exif.Summary{Model: "iPhone 14 Pro", GPS: true},
+		BytesRemoved: 2048,
+	})
+
+	var audit auditLog
+	assert.Nil(json.Unmarshal(written, &audit))
+	assert.Equal(int64(2), audit.Processed)
+	assert.Equal(int64(2), audit.ByFormat["jpeg"])
+	assert.Equal(int64(1), audit.GPSDetected)
+	assert.Equal(int64(2048), audit.BytesSaved)
+	if assert.Len(audit.RecentGPS, 1) {
+		assert.Equal("beach.jpg", audit.RecentGPS[0].FileName)
+		assert.Equal("iPhone 14 Pro, GPS: yes", audit.RecentGPS[0].Detail)
+	}
+
+	var added auditRecord
+	assert.Nil(json.Unmarshal(record, &added))
+	assert.Equal("beach.jpg", added.FileName)
+	assert.Equal("jpeg", added.Format)
+	assert.True(added.GPS)
+	assert.False(added.Failed)
+	api.AssertExpectations(t)
+}
+
+func TestAddAuditRecordKeys(t *testing.T) {
+	assert := assert.New(t)
+	api := &plugintest.API{}
+	var keys []string
+	api.On("KVSetWithOptions", mock.MatchedBy(isAuditRecordsKey), mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		keys = append(keys, args.String(0))
+	}).Return(true, nil)
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	now := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC).UnixMilli()
+	assert.Nil(p.addAuditRecord(auditRecord{Time: now, FileName: "beach.jpg"}))
+	assert.Nil(p.addAuditRecord(auditRecord{Time: now, FileName: "beach.jpg"}))
+	if assert.Len(keys, 2) {
+		assert.True(strings.HasPrefix(keys[0], auditRecordsPrefix+"2024-03-01_"))
+		assert.NotEqual(keys[0], keys[1])
+	}
+}
+
+func TestQueueAuditDropsWhenFull(t *testing.T) {
+	assert := assert.New(t)
+	api := &plugintest.API{}
+	api.On("LogWarn", "Dropped an audit write, as too many are waiting to be written", "dropped", int64(1)).Once()
+	p := &Plugin{auditQueue: make(chan func(), 1)}
+	p.SetAPI(api)
+
+	var written int
+	p.queueAudit(func() { written++ })
+	p.queueAudit(func() { written++ })
+	assert.Equal(int64(1), p.auditDropped.Load())
+	assert.Zero(written)
+
+	stop := make(chan struct{})
+	close(stop)
+	p.runAuditWriter(p.auditQueue, stop)
+	assert.Equal(1, written)
+	api.AssertExpectations(t)
+}
+
+func TestAuditFailureKeepsRecentEvents(t *testing.T) {
+	assert := assert.New(t)
+	audit := &auditLog{}
+	for i := 0; i < maxAuditEvents; i++ {
+		audit.RecentFailures = append(audit.RecentFailures, auditEvent{FileName: "old.jpg"})
+	}
+	stored, _ := json.Marshal(audit)
+
+	api := &plugintest.API{}
+	var written []byte
+	api.On("KVGet", auditKey).Return(stored, nil)
+	api.On("KVSetWithOptions", mock.MatchedBy(isAuditRecordsKey), mock.Anything, mock.Anything).Return(true, nil)
+	api.On("KVCompareAndSet", auditKey, stored, mock.Anything).Run(func(args mock.Arguments) {
+		written = args.Get(2).([]byte)
+	}).Return(true, nil)
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	p.auditFailure(&model.FileInfo{Name: "broken.jpg"}, errors.New("not a JPEG image"))
+
+	var updated auditLog
+	assert.Nil(json.Unmarshal(written, &updated))
+	assert.Equal(int64(1), updated.Failures)
+	assert.Len(updated.RecentFailures, maxAuditEvents)
+	assert.Equal("broken.jpg", updated.RecentFailures[0].FileName)
+	assert.Equal("not a JPEG image", updated.RecentFailures[0].Detail)
+}
+
+func TestHandleStats(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+	api.On("HasPermissionTo", "user", model.PermissionManageSystem).Return(false)
+	api.On("KVGet", auditKey).Return(nil, nil)
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	testTable := []struct {
+		Name   string
+		UserID string
+		Status int
+	}{
+		{Name: "anonymous", UserID: "", Status: http.StatusUnauthorized},
+		{Name: "user", UserID: "user", Status: http.StatusForbidden},
+		{Name: "admin", UserID: "admin", Status: http.StatusOK},
+	}
+
+	for _, test := range testTable {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/v1/stats", nil)
+		if test.UserID != "" {
+			r.Header.Set("Mattermost-User-Id", test.UserID)
+		}
+		p.ServeHTTP(nil, w, r)
+		assert.Equal(t, test.Status, w.Code, test.Name)
+	}
+}
+
+func TestExecuteStats(t *testing.T) {
+	assert := assert.New(t)
+	stored, _ := json.Marshal(&auditLog{
+		Processed:   12,
+		Prefiltered: 3,
+		ByFormat:    map[string]int64{"jpeg": 9, "png": 3},
+		GPSDetected: 4,
+		Failures:    1,
+		BytesSaved:  3 << 20,
+	})
+
+	api := &plugintest.API{}
+	api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+	api.On("HasPermissionTo", "user", model.PermissionManageSystem).Return(false)
+	api.On("KVGet", auditKey).Return(stored, nil)
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	response := p.executeStats(&model.CommandArgs{UserId: "admin"})
+	assert.Equal("Uploads sanitized: 12 (JPEG 9, PNG 3)\nFound free of metadata by the pre-filter: 3 (25.0%)\nWith a location: 4\nFailed: 1\nStorage saved: 3.0 MiB", response.Text)
+
+	response = p.executeStats(&model.CommandArgs{UserId: "user"})
+	assert.Equal("You do not have permission to view the audit log.", response.Text)
+}
+
+func TestFormatBytes(t *testing.T) {
+	testTable := []struct {
+		Bytes int64
+		Text  string
+	}{
+		{0, "0 bytes"},
+		{1023, "1023 bytes"},
+		{1536, "1.5 KiB"},
+		{5 << 30, "5.0 GiB"},
+		{2048 << 40, "2048.0 TiB"},
+	}
+
+	for _, test := range testTable {
+		assert.Equal(t, test.Text, formatBytes(test.Bytes))
+	}
+}
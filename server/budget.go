@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// The OversizedUploads settings, for the uploads exceeding the memory budget: spool them to a
+// temporary file and sanitize videos, and JPEG images if only their EXIF data is to be removed,
+// from there, which is the default, let them through unchanged, or reject them.
+const (
+	oversizedSpool       = "spool"
+	oversizedPassThrough = "pass-through"
+	oversizedReject      = "reject"
+)
+
+// memoryBudget returns the size in bytes of the largest upload read into memory, according to
+// the MemoryBudget setting, in megabytes, or 0 if there is no limit.
+func (c *configuration) memoryBudget() int64 {
+	if c.MemoryBudget <= 0 {
+		return 0
+	}
+	return int64(c.MemoryBudget) << 20
+}
+
+// readUpload reads an upload into memory, unless it exceeds the memory budget. An upload exceeding
+// it is read no further, and returned as the reader to read it from in place of file, with nil
+// data.
+func readUpload(file io.Reader, config *configuration) ([]byte, io.Reader, error) {
+	budget := config.memoryBudget()
+	if budget == 0 {
+		data, err := ioutil.ReadAll(file)
+		return data, nil, err
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(file, budget+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(data)) <= budget {
+		return data, nil, nil
+	}
+	return nil, io.MultiReader(bytes.NewReader(data), file), nil
+}
+
+// oversizedUpload handles an upload exceeding the memory budget, read from file, according to the
+// OversizedUploads setting.
+func (p *Plugin) oversizedUpload(info *model.FileInfo, file io.Reader, output io.Writer, config *configuration) (*model.FileInfo, string) {
+	switch config.OversizedUploads {
+	case oversizedPassThrough:
+		p.API.LogWarn("Passing through upload exceeding the memory budget", "name", info.Name, "user_id", info.CreatorId, "size", info.Size)
+		return nil, ""
+	case oversizedReject:
+		p.API.LogInfo("Rejected upload exceeding the memory budget", "name", info.Name, "user_id", info.CreatorId, "size", info.Size)
+		return nil, reject(codeTooLarge, "Files larger than %d MB are not allowed on this server.", config.MemoryBudget)
+	}
+	return p.spoolUpload(info, file, output, config)
+}
+
+// spoolUpload copies an upload to a temporary file and sanitizes it from there, without reading it
+// into memory. MP4 and QuickTime videos are sanitized with the same options as the uploads within
+// the memory budget, their media data being copied straight from the file. The EXIF data of JPEG
+// images is removed by seeking over their other segments, which does nothing else, so they are
+// only spooled if the settings ask for nothing more, such as the removal of their trailing data.
+// Uploads of other formats cannot be sanitized without being read into memory, and are rejected.
+func (p *Plugin) spoolUpload(info *model.FileInfo, file io.Reader, output io.Writer, config *configuration) (*model.FileInfo, string) {
+	spool, err := ioutil.TempFile("", "exif-upload-")
+	if err != nil {
+		return nil, reject(codeProcessingFailed, "An error occurred while trying to spool the uploaded file: %v", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+	size, err := io.Copy(spool, file)
+	if err != nil {
+		return nil, reject(codeProcessingFailed, "An error occurred while trying to spool the uploaded file: %v", err)
+	}
+
+	header := make([]byte, sniffLength)
+	n, _ := spool.ReadAt(header, 0)
+	format := exif.Detect(header[:n])
+	spoolsJPEG := config.exifOnly()
+	if format != "mp4" && format != "mov" && (format != "jpeg" || !spoolsJPEG) {
+		p.API.LogInfo("Rejected upload exceeding the memory budget", "name", info.Name, "user_id", info.CreatorId, "size", size, "format", format)
+		if spoolsJPEG {
+			return nil, reject(codeTooLarge, "Files larger than %d MB are only allowed on this server if they are JPEG images or videos.", config.MemoryBudget)
+		}
+		return nil, reject(codeTooLarge, "Files larger than %d MB are only allowed on this server if they are videos.", config.MemoryBudget)
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, reject(codeProcessingFailed, "An error occurred while trying to spool the uploaded file: %v", err)
+	}
+
+	p.API.LogDebug("Spooled upload exceeding the memory budget", "name", info.Name, "user_id", info.CreatorId, "size", size, "format", format)
+	counter := &countingWriter{w: output}
+	if format != "jpeg" {
+		report, err := exif.SanitizeSeeker(spool, counter, p.sanitizeOptions(config, format)...)
+		if err != nil {
+			p.auditFailure(info, err)
+			return nil, reject(codeProcessingFailed, "An error occurred while trying to discard exif data: %v", err)
+		}
+		updateFileInfo(info, counter.n, report.Format, report.Width, report.Height)
+		p.auditUpload(info, report)
+		if report.ExifRemoved || report.ExifEdited || report.MetadataRemoved {
+			p.API.LogInfo("Removed metadata from upload", "name", info.Name, "user_id", info.CreatorId, "summary", summarize(report))
+		}
+		return info, ""
+	}
+
+	err = exif.DiscardSeeker(spool, counter)
+	if errors.Is(err, exif.ErrNoExif) {
+		return nil, ""
+	}
+	if err != nil {
+		p.auditFailure(info, err)
+		return nil, reject(codeProcessingFailed, "An error occurred while trying to discard exif data: %v", err)
+	}
+
+	report := &exif.Report{Format: "jpeg", ExifRemoved: true, BytesRemoved: int(size - counter.n)}
+	updateFileInfo(info, counter.n, report.Format, 0, 0)
+	p.auditUploadDetail(info, report, spooledExif)
+	p.API.LogInfo("Removed metadata from upload", "name", info.Name, "user_id", info.CreatorId, "summary", spooledExif)
+	return info, ""
+}
+
+// exifOnly reports whether the settings ask for nothing more than the removal of the EXIF data of
+// JPEG images, which is all that exif.DiscardSeeker does: they keep their trailing data, C2PA
+// manifests, ICC profiles and other segments, and the whole EXIF data is removed.
+func (c *configuration) exifOnly() bool {
+	c2pa, _ := exif.ParseC2PAPolicy(c.C2PAPolicy)
+	icc, _ := exif.ParseICCPolicy(c.ICCPolicy)
+	return c2pa == exif.C2PAPreserve && icc == exif.ICCPreserve && !c.RemoveTrailingData && !c.RegenerateJFIF &&
+		strings.TrimSpace(c.SegmentPolicy) == "" && (c.MetadataProfile == "" || c.MetadataProfile == "strip-all")
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// oversizedJPEG is exifJPEG followed by enough trailing data to exceed a memory budget of 1 MB.
+var oversizedJPEG = append(append([]byte{}, exifJPEG...), make([]byte, 1<<20)...)
+
+func TestReadUpload(t *testing.T) {
+	// Without a budget, every upload is read into memory.
+	data, rest, err := readUpload(bytes.NewReader(oversizedJPEG), &configuration{})
+	assert.NoError(t, err)
+	assert.Nil(t, rest)
+	assert.Equal(t, oversizedJPEG, data)
+
+	data, rest, err = readUpload(bytes.NewReader(exifJPEG), &configuration{MemoryBudget: 1})
+	assert.NoError(t, err)
+	assert.Nil(t, rest)
+	assert.Equal(t, exifJPEG, data)
+
+	// An upload exceeding the budget is read in full from the reader returned.
+	data, rest, err = readUpload(bytes.NewReader(oversizedJPEG), &configuration{MemoryBudget: 1})
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+	if assert.NotNil(t, rest) {
+		read := new(bytes.Buffer)
+		_, err := read.ReadFrom(rest)
+		assert.NoError(t, err)
+		assert.Equal(t, oversizedJPEG, read.Bytes())
+	}
+}
+
+func TestFileWillBeUploadedOversized(t *testing.T) {
+	oversizedPNG := append(append([]byte{}, exifPNG...), make([]byte, 1<<20)...)
+
+	testTable := []struct {
+		Name      string
+		Policy    string
+		Input     []byte
+		Sanitized bool
+		Rejection string
+	}{
+		{Name: "spooled jpeg", Policy: oversizedSpool, Input: oversizedJPEG, Sanitized: true},
+		{Name: "default policy", Policy: "", Input: oversizedJPEG, Sanitized: true},
+		{Name: "spooled png", Policy: oversizedSpool, Input: oversizedPNG, Rejection: "EXIF002: Files larger than 1 MB are only allowed on this server if they are JPEG images or videos."},
+		{Name: "passed through", Policy: oversizedPassThrough, Input: oversizedJPEG},
+		{Name: "rejected", Policy: oversizedReject, Input: oversizedJPEG, Rejection: "EXIF002: Files larger than 1 MB are not allowed on this server."},
+	}
+
+	for _, test := range testTable {
+		p, _ := newUploadTestPlugin(&configuration{MemoryBudget: 1, OversizedUploads: test.Policy})
+		fileInfo := &model.FileInfo{Name: "photo.jpg", Extension: "jpg", MimeType: "image/jpeg", CreatorId: "user", Size: int64(len(test.Input))}
+		output := new(bytes.Buffer)
+		info, rejection := p.FileWillBeUploaded(nil, fileInfo, bytes.NewReader(test.Input), output)
+		assert.Equal(t, test.Rejection, rejection, test.Name)
+		if !test.Sanitized {
+			assert.Nil(t, info, test.Name)
+			continue
+		}
+		if assert.NotNil(t, info, test.Name) {
+			assert.Equal(t, int64(output.Len()), info.Size, test.Name)
+			assert.Equal(t, len(test.Input)-36, output.Len(), test.Name)
+			assert.NotContains(t, output.String(), "ACM", test.Name)
+		}
+	}
+}
+
+func TestFileWillBeUploadedOversizedWithoutExif(t *testing.T) {
+	// The EXIF segment of exifJPEG spans its bytes 2 to 38.
+	input := append(append([]byte{}, exifJPEG[:2]...), oversizedJPEG[38:]...)
+	p, _ := newUploadTestPlugin(&configuration{MemoryBudget: 1})
+	info, rejection := p.FileWillBeUploaded(nil, &model.FileInfo{Name: "photo.jpg", CreatorId: "user"}, bytes.NewReader(input), new(bytes.Buffer))
+	assert.Nil(t, info)
+	assert.Empty(t, rejection)
+
+	// A spooled upload that cannot be sanitized is rejected.
+	p, _ = newUploadTestPlugin(&configuration{MemoryBudget: 1})
+	truncated := append(append([]byte{}, exifJPEG[:20]...), make([]byte, 1<<20)...)
+	info, rejection = p.FileWillBeUploaded(nil, &model.FileInfo{Name: "photo.jpg", CreatorId: "user"}, bytes.NewReader(truncated), new(bytes.Buffer))
+	assert.Nil(t, info)
+	assert.True(t, strings.HasPrefix(rejection, "EXIF010: An error occurred while trying to discard exif data: "), rejection)
+}
+
+func TestFileWillBeUploadedOversizedOptions(t *testing.T) {
+	// A video whose location is recorded in its movie box, with media data exceeding the budget.
+	box := func(typ string, payload ...byte) []byte {
+		return append(append(binary.BigEndian.AppendUint32(nil, uint32(8+len(payload))), typ...), payload...)
+	}
+	location := box("\xa9xyz", []byte("\x00\x12\x15\xc7+52.3700+004.8900/")...)
+	video := append(box("ftyp", []byte("isom\x00\x00\x00\x00isom")...), box("moov", box("udta", location...)...)...)
+	video = append(video, box("mdat", make([]byte, 1<<20)...)...)
+
+	testTable := []struct {
+		Name      string
+		Config    configuration
+		Input     []byte
+		Rejection string
+	}{
+		{Name: "video", Input: video},
+		{Name: "video with trailing data removal", Config: configuration{RemoveTrailingData: true}, Input: video},
+		{
+			Name:      "jpeg with trailing data removal",
+			Config:    configuration{RemoveTrailingData: true},
+			Input:     oversizedJPEG,
+			Rejection: "EXIF002: Files larger than 1 MB are only allowed on this server if they are videos.",
+		},
+		{
+			Name:      "jpeg with a segment policy",
+			Config:    configuration{SegmentPolicy: "APP13=reject"},
+			Input:     oversizedJPEG,
+			Rejection: "EXIF002: Files larger than 1 MB are only allowed on this server if they are videos.",
+		},
+		{
+			Name:      "jpeg keeping exif data",
+			Config:    configuration{MetadataProfile: "remove-device-ids"},
+			Input:     oversizedJPEG,
+			Rejection: "EXIF002: Files larger than 1 MB are only allowed on this server if they are videos.",
+		},
+		{
+			Name:      "png",
+			Input:     append(append([]byte{}, exifPNG...), make([]byte, 1<<20)...),
+			Rejection: "EXIF002: Files larger than 1 MB are only allowed on this server if they are JPEG images or videos.",
+		},
+	}
+
+	for _, test := range testTable {
+		config := test.Config
+		config.MemoryBudget = 1
+		p, _ := newUploadTestPlugin(&config)
+		fileInfo := &model.FileInfo{Name: "clip.mp4", Extension: "mp4", MimeType: "video/mp4", CreatorId: "user", Size: int64(len(test.Input))}
+		output := new(bytes.Buffer)
+		info, rejection := p.FileWillBeUploaded(nil, fileInfo, bytes.NewReader(test.Input), output)
+		assert.Equal(t, test.Rejection, rejection, test.Name)
+		if test.Rejection != "" {
+			assert.Nil(t, info, test.Name)
+			continue
+		}
+		if assert.NotNil(t, info, test.Name) {
+			assert.Equal(t, len(test.Input), output.Len(), test.Name)
+			assert.Equal(t, "video/mp4", info.MimeType, test.Name)
+			assert.NotContains(t, output.String(), "+52.3700", test.Name)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// The codes of the causes of rejected uploads. They start the rejections uploaders see, and are
+// logged with them, so that helpdesk staff can tell the cause of a rejection from a screenshot of
+// it. Codes are stable: they are never renumbered or reused, and new causes get new codes.
+const (
+	// codeUnsupportedFormat rejects files that are not of a supported format.
+	codeUnsupportedFormat = "EXIF001"
+
+	// codeTooLarge rejects files over the memory budget.
+	codeTooLarge = "EXIF002"
+
+	// codeCorrupt rejects files that are empty, truncated or cannot be parsed.
+	codeCorrupt = "EXIF003"
+
+	// codeTimeout rejects files taking longer than the processing timeout.
+	codeTimeout = "EXIF004"
+
+	// codeSegmentRejected and codeChunkRejected reject images carrying JPEG segments or PNG
+	// chunks the segment or chunk policy rejects.
+	codeSegmentRejected = "EXIF005"
+	codeChunkRejected   = "EXIF006"
+
+	// codeEmbeddedMetadata rejects files of other types holding images carrying metadata, when
+	// deep inspection rejects them.
+	codeEmbeddedMetadata = "EXIF007"
+
+	// codeUploaderRejected rejects the uploads of bots or plugins, when they are not allowed.
+	codeUploaderRejected = "EXIF008"
+
+	// codePixelsChanged rejects images whose pixels sanitizing them would alter.
+	codePixelsChanged = "EXIF009"
+
+	// codeProcessingFailed rejects files that could not be read, spooled, sanitized or re-encoded.
+	codeProcessingFailed = "EXIF010"
+
+	// codePanic rejects files the plugin failed on unexpectedly.
+	codePanic = "EXIF011"
+
+	// codeTypeRejected rejects files of the types the TypeActions setting rejects.
+	codeTypeRejected = "EXIF012"
+)
+
+// reject returns the rejection of an upload for the cause of code, such as "EXIF002: Files larger
+// than 10 MB are not allowed on this server.".
+func reject(code, format string, args ...interface{}) string {
+	return code + ": " + fmt.Sprintf(format, args...)
+}
+
+// logRejection logs the rejection of the upload of info, if it was rejected, with its code.
+// Deferred by FileWillBeUploaded, it logs every rejection, including those of recoverUpload.
+func (p *Plugin) logRejection(info *model.FileInfo, rejection *string) {
+	if *rejection == "" {
+		return
+	}
+	code, _, _ := strings.Cut(*rejection, ":")
+	p.API.LogInfo("Rejected upload", "name", info.Name, "user_id", info.CreatorId, "code", code, "rejection", *rejection)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+)
+
+func TestLogRejection(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("LogInfo", "Rejected upload", "name", "beach.jpg", "user_id", "user", "code", "EXIF002", "rejection", "EXIF002: Files larger than 10 MB are not allowed on this server.").Once()
+	p := &Plugin{}
+	p.SetAPI(api)
+	info := &model.FileInfo{Name: "beach.jpg", CreatorId: "user"}
+
+	rejection := reject(codeTooLarge, "Files larger than %d MB are not allowed on this server.", 10)
+	p.logRejection(info, &rejection)
+
+	// Uploads let through are not logged.
+	allowed := ""
+	p.logRejection(info, &allowed)
+	api.AssertExpectations(t)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+// commandTrigger is the trigger of the plugin's slash command.
+const commandTrigger = "exif"
+
+// command returns the plugin's slash command, which lets users choose how they are told about
+// the metadata removed from their uploads, remove metadata from files already posted, view and
+// export the audit log, and tell which build of the plugin is running.
+func command() *model.Command {
+	notifications := model.NewAutocompleteData("notifications", "[per-upload|digest|off]", "Choose how you are told about the metadata removed from your uploads")
+	notifications.AddStaticListArgument("", false, []model.AutocompleteListItem{
+		{Item: notifyPerUpload, HelpText: "A notice only you can see for each upload"},
+		{Item: notifyDigest, HelpText: "A daily direct message"},
+		{Item: notifyOff, HelpText: "No notifications"},
+	})
+
+	strip := model.NewAutocompleteData("strip", "<post permalink or file link>", "Remove metadata from the attachments of a post, or from one file")
+	strip.AddTextArgument("Permalink of the post, or link to the file", "<post permalink or file link>", "")
+
+	stats := model.NewAutocompleteData("stats", "", "Show how many uploads were sanitized, and how much storage removing their metadata saved")
+	stats.RoleID = model.SystemAdminRoleId
+
+	exportAudit := model.NewAutocompleteData("export-audit", "[--from YYYY-MM-DD] [--to YYYY-MM-DD] [--format csv|json]", "Download the records of the uploads sanitized, for auditors")
+	exportAudit.RoleID = model.SystemAdminRoleId
+
+	version := model.NewAutocompleteData("version", "", "Show the version and build of the plugin")
+
+	autocomplete := model.NewAutocompleteData(commandTrigger, "[command]", "Available commands: notifications, strip, stats, export-audit, version")
+	autocomplete.AddCommand(notifications)
+	autocomplete.AddCommand(strip)
+	autocomplete.AddCommand(stats)
+	autocomplete.AddCommand(exportAudit)
+	autocomplete.AddCommand(version)
+
+	return &model.Command{
+		Trigger:          commandTrigger,
+		DisplayName:      "EXIF Remover",
+		Description:      "Manage the EXIF Remover plugin.",
+		AutoComplete:     true,
+		AutoCompleteDesc: "Available commands: notifications, strip, stats, export-audit, version",
+		AutoCompleteHint: "[command]",
+		AutocompleteData: autocomplete,
+	}
+}
+
+// commandUsage describes the subcommands of the /exif command.
+const commandUsage = "Usage:\n" +
+	"- `/exif notifications [per-upload|digest|off]`: show or choose how you are told about the metadata removed from your uploads\n" +
+	"- `/exif strip <post permalink or file link>`: remove metadata from the attachments of a post, or from one file\n" +
+	"- `/exif stats`: show how many uploads were sanitized, and how much storage removing their metadata saved\n" +
+	"- `/exif export-audit [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--format csv|json]`: download the records of the uploads sanitized\n" +
+	"- `/exif version`: show the version and build of the plugin"
+
+// ExecuteCommand executes the /exif command.
+func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	fields := strings.Fields(args.Command)
+	if len(fields) < 2 {
+		return ephemeralResponse(commandUsage), nil
+	}
+
+	switch fields[1] {
+	case "notifications":
+		return p.executeNotifications(args, fields[2:]), nil
+	case "strip":
+		return p.executeStrip(args, fields[2:]), nil
+	case "stats":
+		return p.executeStats(args), nil
+	case "export-audit":
+		return p.executeExportAudit(args, fields[2:]), nil
+	case "version":
+		return p.executeVersion(), nil
+	}
+	return ephemeralResponse(commandUsage), nil
+}
+
+// executeNotifications shows the notification preference of the user, or changes it to the
+// given one.
+func (p *Plugin) executeNotifications(args *model.CommandArgs, params []string) *model.CommandResponse {
+	if len(params) == 0 {
+		return ephemeralResponse(fmt.Sprintf("Your notifications are set to `%s`.", p.notificationPreference(args.UserId)))
+	}
+
+	value := params[0]
+	valid := false
+	for _, preference := range notificationPreferences {
+		valid = valid || value == preference
+	}
+	if !valid {
+		return ephemeralResponse(fmt.Sprintf("Unknown notification preference `%s`. Choose one of `per-upload`, `digest` or `off`.", value))
+	}
+
+	if err := p.setNotificationPreference(args.UserId, value); err != nil {
+		p.API.LogError("Failed to set notification preference", "user_id", args.UserId, "err", err.Error())
+		return ephemeralResponse("Failed to save your notification preference.")
+	}
+	return ephemeralResponse(fmt.Sprintf("Your notifications are now set to `%s`.", value))
+}
+
+// ephemeralResponse returns a command response only visible to the user who ran the command.
+func ephemeralResponse(text string) *model.CommandResponse {
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeEphemeral,
+		Text:         text,
+	}
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"reflect"
+	"strings"
 
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
 	"github.com/pkg/errors"
 )
 
@@ -18,6 +21,137 @@ import (
 // If you add non-reference types to your configuration struct, be sure to rewrite Clone as a deep
 // copy appropriate for your types.
 type configuration struct {
+	// C2PAPolicy is what to do with C2PA manifests (Content Credentials) in uploaded images:
+	// preserve, strip or strip-and-report.
+	C2PAPolicy string
+
+	// ICCPolicy is what to do with ICC color profiles in uploaded images: preserve, strip or
+	// replace-with-srgb.
+	ICCPolicy string
+
+	// SegmentPolicy is a comma separated list of JPEG markers and what to do with their segments
+	// whatever the other settings, such as APP2=keep,APP13=remove,COM=reject, as parsed by
+	// exif.ParseSegmentPolicy. Empty leaves all segments to the other settings.
+	SegmentPolicy string
+
+	// PNGChunkPolicy is a comma separated list of PNG chunk types and what to do with their chunks
+	// whatever the other settings, such as tIME=keep,pHYs=remove,iDOT=reject, as parsed by
+	// exif.ParseChunkPolicy. Empty leaves all chunks to the other settings, which remove the
+	// ancillary chunks the plugin does not know.
+	PNGChunkPolicy string
+
+	// RemoveTrailingData removes data appended after the end of JPEG images, such as the videos
+	// of motion photos.
+	RemoveTrailingData bool
+
+	// RegenerateJFIF adds a minimal JFIF header to images left without any once their EXIF
+	// data is removed, for compatibility with picky viewers and printers.
+	RegenerateJFIF bool
+
+	// MetadataProfile selects which EXIF data is removed: strip-all removes all of it, while
+	// remove-timestamps and round-timestamps keep the EXIF data and only anonymize timestamps,
+	// and remove-device-ids only removes the tags identifying the device and its owner.
+	MetadataProfile string
+
+	// RemoveLivePhotoPairing removes the identifiers pairing Apple Live Photos with their videos,
+	// which link both files to the library of the device they were taken with.
+	RemoveLivePhotoPairing bool
+
+	// RemovePDFMetadata removes the document information, such as the author, creator tool and
+	// creation date, and the XMP metadata of uploaded PDF documents, which are otherwise let
+	// through unchanged whatever ProcessedTypes lists.
+	RemovePDFMetadata bool
+
+	// RemoveSVGScripts removes the scripts of SVG images along with their metadata, comments and
+	// editor data.
+	RemoveSVGScripts bool
+
+	// AnonymizeFilenames renames the uploads named by cameras and phones by default, such as
+	// IMG_1234.JPG, to generated names, as their sequence numbers can fingerprint uploaders.
+	AnonymizeFilenames bool
+
+	// ProcessedTypes is a comma separated list of the MIME types, such as image/jpeg or image/*,
+	// and extensions, such as .jpg, of the uploads processed. Empty processes all the formats
+	// supported, listed in defaultProcessedTypes.
+	ProcessedTypes string
+
+	// TypeActions is a comma separated list of the types of uploads and what to do with them,
+	// such as heic=transcode,raw=reject,mp4=pass-through, as parsed by parseTypeActions. The
+	// uploads of the types it does not list are stripped of their metadata.
+	TypeActions string
+
+	// DeepInspection is what to do with the uploads of other types: off, sanitize or reject. See
+	// inspectUpload.
+	DeepInspection string
+
+	// MemoryBudget is the size, in megabytes, of the largest upload read into memory to be
+	// processed, or 0 for no limit. OversizedUploads is what to do with larger uploads: spool,
+	// pass-through or reject. See oversizedUpload.
+	MemoryBudget     int
+	OversizedUploads string
+
+	// ProcessingTimeout is how long, in seconds, sanitizing an upload may take, or 0 for no
+	// limit. TimeoutFallback is what to do with the uploads taking longer: pass-through, reject
+	// or re-encode. See timedOutUpload.
+	ProcessingTimeout int
+	TimeoutFallback   string
+
+	// VerifyPixels decodes JPEG, PNG and GIF uploads and their sanitized copies, and rejects the
+	// uploads whose pixels changed. See verifyPixels.
+	VerifyPixels bool
+
+	// CorruptUploads is what to do with the uploads that cannot be parsed, such as empty,
+	// truncated or random files: reject or pass-through. See corruptUpload.
+	CorruptUploads string
+
+	// PanicPolicy is what to do with the uploads the plugin panics on, such as through a parser
+	// bug: fail-closed or fail-open. See recoverUpload.
+	PanicPolicy string
+
+	// BotUploads and PluginUploads are what to do with the files uploaded by bots and plugins,
+	// which are often machine generated: sanitize, skip or reject.
+	BotUploads    string
+	PluginUploads string
+
+	// StripPermission is who may remove metadata from the attachments of existing posts:
+	// authors, channel-admins, team-admins or system-admins. StatsPermission is who may view the
+	// dashboard: system-admins or system-console-readers.
+	StripPermission string
+	StatsPermission string
+
+	// ScanSchedule is a cron expression scheduling recurring scans of recent uploads, or empty to
+	// disable them. ScanTeams is a comma separated list of the names of the teams scanned, or
+	// empty for all teams, and ScanChannel the team-name/channel-name of the channel the findings
+	// are posted to.
+	ScanSchedule string
+	ScanTeams    string
+	ScanChannel  string
+
+	// EnableTelemetry sends anonymous aggregate usage counts to TelemetryEndpoint once a day:
+	// the files processed per format, the error rate and the plugin and server versions. There is
+	// no default endpoint, so nothing is sent until one is set.
+	EnableTelemetry   bool
+	TelemetryEndpoint string
+
+	// GeocodingURL is the reverse endpoint of a Nominatim compatible geocoding service naming the
+	// places uploads were taken at in notices and scan findings, or empty to name none.
+	GeocodingURL string
+
+	// NotifyUploader sends uploaders a direct message summarizing the metadata removed from their
+	// images, such as the camera model and whether they carried a location.
+	NotifyUploader bool
+
+	// DebugFormats is a comma separated list of the formats, as named by exif.Detect, whose
+	// diagnostics are logged at info level, or empty to log those of every format at debug level.
+	DebugFormats string
+
+	// options are the options of exif.Sanitize matching the settings, debugFormats the formats of
+	// the DebugFormats setting and typeActions the actions of the TypeActions setting, parsed once
+	// by compile when the configuration is loaded rather than for every upload. Like the settings,
+	// they are never modified once the configuration is set.
+	options      []exif.Option
+	debugFormats map[string]bool
+	typeActions  map[string]string
 }
 
 // Clone shallow copies the configuration. Your implementation may require a deep copy if
@@ -27,6 +161,135 @@ func (c *configuration) Clone() *configuration {
 	return &clone
 }
 
+// compile parses the settings into the values derived from them, before the configuration is
+// set, so that uploads read a snapshot holding both.
+func (c *configuration) compile() {
+	c.options = c.parseOptions()
+	c.debugFormats = c.parseDebugFormats()
+	// The valid entries of TypeActions apply even if others are invalid, which are reported by
+	// validate.
+	c.typeActions, _ = parseTypeActions(c.TypeActions)
+}
+
+// sanitizeOptions returns the options of exif.Sanitize matching the configuration. Callers may
+// append to them: the full slice expression makes appending copy them.
+func (c *configuration) sanitizeOptions() []exif.Option {
+	if c.options == nil {
+		return c.parseOptions()
+	}
+	return c.options[:len(c.options):len(c.options)]
+}
+
+// parseOptions returns the options of exif.Sanitize matching the settings.
+func (c *configuration) parseOptions() []exif.Option {
+	policy, _ := exif.ParseC2PAPolicy(c.C2PAPolicy)
+	iccPolicy, _ := exif.ParseICCPolicy(c.ICCPolicy)
+	opts := []exif.Option{
+		exif.WithC2PAPolicy(policy),
+		exif.WithICCPolicy(iccPolicy),
+		exif.WithTrailerRemoval(c.RemoveTrailingData),
+		exif.WithJFIFRegeneration(c.RegenerateJFIF),
+	}
+
+	if c.RemoveLivePhotoPairing {
+		opts = append(opts, exif.WithLivePhotoPairingRemoval())
+	}
+	if c.RemoveSVGScripts {
+		opts = append(opts, exif.WithSVGScriptRemoval())
+	}
+	if segmentOpts, err := exif.ParseSegmentPolicy(c.SegmentPolicy); err == nil {
+		opts = append(opts, segmentOpts...)
+	}
+	if chunkOpts, err := exif.ParseChunkPolicy(c.PNGChunkPolicy); err == nil {
+		opts = append(opts, chunkOpts...)
+	}
+
+	switch c.MetadataProfile {
+	case "remove-timestamps":
+		opts = append(opts, exif.WithTimestampPolicy(exif.TimestampsRemove))
+	case "round-timestamps":
+		opts = append(opts, exif.WithTimestampPolicy(exif.TimestampsRoundToDay))
+	case "remove-device-ids":
+		opts = append(opts, exif.WithDeviceFingerprintRemoval())
+	}
+	return opts
+}
+
+// prefilters reports whether uploads exif.NoMetadata finds free of metadata can be let through
+// without sanitizing them, which holds unless the settings remove trailing data or set actions for
+// JPEG segments or PNG chunks: these may change files carrying no metadata.
+func (c *configuration) prefilters() bool {
+	return !c.RemoveTrailingData && strings.TrimSpace(c.SegmentPolicy) == "" && strings.TrimSpace(c.PNGChunkPolicy) == ""
+}
+
+// tracedFormats returns the formats of the DebugFormats setting, or nil if it is empty.
+func (c *configuration) tracedFormats() map[string]bool {
+	if c.debugFormats == nil {
+		return c.parseDebugFormats()
+	}
+	return c.debugFormats
+}
+
+// parseDebugFormats returns the formats of the DebugFormats setting, in lower case, or nil if it
+// is empty.
+func (c *configuration) parseDebugFormats() map[string]bool {
+	var formats map[string]bool
+	for _, format := range strings.Split(c.DebugFormats, ",") {
+		format = strings.ToLower(strings.TrimSpace(format))
+		if format == "" {
+			continue
+		}
+		if formats == nil {
+			formats = map[string]bool{}
+		}
+		formats[format] = true
+	}
+	return formats
+}
+
+// defaultProcessedTypes are the MIME types processed when the ProcessedTypes setting is empty.
+const defaultProcessedTypes = "image/jpeg,image/png,image/gif,image/webp,image/heic,image/avif,image/heif,image/jp2,image/jpx,image/tiff,image/svg+xml,video/mp4,video/quicktime"
+
+// processes returns whether uploads of the type of info are processed, according to the
+// ProcessedTypes setting, the RemovePDFMetadata setting for PDF documents, or the TypeActions
+// setting for raw images, which it lists by name. Other uploads are let through unchanged.
+func (c *configuration) processes(info *model.FileInfo) bool {
+	if _, listed := c.actionsByType()[rawType]; listed && isRawUpload(info) {
+		return true
+	}
+
+	types := c.ProcessedTypes
+	if strings.TrimSpace(types) == "" {
+		types = defaultProcessedTypes
+	}
+
+	mimeType := strings.ToLower(info.MimeType)
+	if i := strings.IndexByte(mimeType, ';'); i >= 0 {
+		mimeType = strings.TrimSpace(mimeType[:i])
+	}
+	extension := strings.ToLower(strings.TrimPrefix(info.Extension, "."))
+	if mimeType == "application/pdf" || extension == "pdf" {
+		return c.RemovePDFMetadata
+	}
+	for _, t := range strings.Split(types, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		switch {
+		case t == "":
+		case strings.HasPrefix(t, "."):
+			if extension != "" && t[1:] == extension {
+				return true
+			}
+		case strings.HasSuffix(t, "/*"):
+			if strings.HasPrefix(mimeType, t[:len(t)-1]) {
+				return true
+			}
+		case t == mimeType:
+			return true
+		}
+	}
+	return false
+}
+
 // getConfiguration retrieves the active configuration under lock, making it safe to use
 // concurrently. The active configuration may change underneath the client of this method, but
 // the struct returned by this API call is considered immutable.
@@ -77,7 +340,22 @@ func (p *Plugin) OnConfigurationChange() error {
 		return errors.Wrap(err, "failed to load plugin configuration")
 	}
 
+	// Invalid settings are ignored rather than failing activation, but logged, as the settings of
+	// servers older than 8.0, or edited outside the System Console, are not validated on save.
+	if err := configuration.validate(); err != nil {
+		p.API.LogError("Ignoring invalid plugin settings", "err", err.Error())
+	}
+	configuration.compile()
+	if configuration.EnableTelemetry && configuration.TelemetryEndpoint == "" {
+		p.API.LogWarn("Usage statistics are enabled but will not be sent, as no endpoint is set")
+	}
+
 	p.setConfiguration(configuration)
 
+	// The scan is scheduled on activation, once the bot account posting its findings exists.
+	if p.botID != "" {
+		p.scheduleScan()
+	}
+
 	return nil
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestProcesses(t *testing.T) {
+	testTable := []struct {
+		Types     string
+		PDF       bool
+		MimeType  string
+		Extension string
+		Processed bool
+	}{
+		{MimeType: "image/jpeg", Extension: "jpg", Processed: true},
+		{MimeType: "video/quicktime", Extension: "mov", Processed: true},
+		{MimeType: "image/svg+xml", Extension: "svg", Processed: true},
+		{MimeType: "application/pdf", Extension: "pdf"},
+		{MimeType: "text/plain", Extension: "txt"},
+		{Types: "image/jpeg, image/png", MimeType: "video/mp4", Extension: "mp4"},
+		{Types: "image/jpeg, image/png", MimeType: "image/PNG", Extension: "png", Processed: true},
+		{Types: "image/*", MimeType: "image/webp", Extension: "webp", Processed: true},
+		{Types: "image/*", MimeType: "video/mp4", Extension: "mp4"},
+		{Types: ".jpg,.JPEG", MimeType: "application/octet-stream", Extension: "jpeg", Processed: true},
+		{Types: ".jpg", MimeType: "image/jpeg", Extension: "jpe"},
+		{Types: "image/jpeg", MimeType: "image/jpeg; charset=binary", Processed: true},
+		{PDF: true, MimeType: "application/pdf", Extension: "pdf", Processed: true},
+		{PDF: true, MimeType: "application/octet-stream", Extension: "PDF", Processed: true},
+		{Types: "application/*", MimeType: "application/pdf", Extension: "pdf"},
+	}
+
+	for _, test := range testTable {
+		config := &configuration{ProcessedTypes: test.Types, RemovePDFMetadata: test.PDF}
+		info := &model.FileInfo{MimeType: test.MimeType, Extension: test.Extension}
+		assert.Equal(t, test.Processed, config.processes(info), test.Types+" "+test.MimeType)
+	}
+}
+
+func TestFileWillBeUploadedSkipsUnprocessedTypes(t *testing.T) {
+	p := &Plugin{}
+	p.setConfiguration(&configuration{ProcessedTypes: "image/png"})
+	info, rejection := p.FileWillBeUploaded(nil, &model.FileInfo{MimeType: "image/jpeg", Extension: "jpg"}, nil, nil)
+	assert.Nil(t, info)
+	assert.Equal(t, "", rejection)
+}
+
+func TestOnConfigurationChangeWarnsWithoutTelemetryEndpoint(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("LoadPluginConfiguration", mock.Anything).Run(func(args mock.Arguments) {
+		args.Get(0).(*configuration).EnableTelemetry = true
+	}).Return(nil)
+	api.On("LogWarn", "Usage statistics are enabled but will not be sent, as no endpoint is set").Once()
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	assert.Nil(t, p.OnConfigurationChange())
+	api.AssertExpectations(t)
+}
+
+func TestSanitizeOptionsSnapshot(t *testing.T) {
+	config := &configuration{SegmentPolicy: "APP1=reject", MetadataProfile: "remove-timestamps"}
+	config.compile()
+	compiled := len(config.options)
+	assert.Equal(t, len(config.parseOptions()), compiled)
+
+	// Options appended by one upload are not seen by others sharing the configuration.
+	first := append(config.sanitizeOptions(), exif.WithLogger(nil))
+	second := append(config.sanitizeOptions(), exif.WithTrailerRemoval(true))
+	assert.Len(t, first, compiled+1)
+	assert.Len(t, second, compiled+1)
+	assert.Len(t, config.options, compiled)
+	assert.NotSame(t, &first[compiled], &second[compiled])
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// The CorruptUploads settings, for the uploads that cannot be parsed, such as empty, truncated or
+// random files: reject them with a message saying what is wrong, which is the default, or let
+// them through unchanged.
+const (
+	corruptReject      = "reject"
+	corruptPassThrough = "pass-through"
+)
+
+// corruptUpload handles an upload the plugin failed to parse with the given error, according to
+// the CorruptUploads setting. The failure is recorded in the audit log whatever the setting, and
+// the uploader told what is wrong with the file rather than shown the error of the parser.
+func (p *Plugin) corruptUpload(info *model.FileInfo, data []byte, failure error, config *configuration) (*model.FileInfo, string) {
+	p.auditFailure(info, failure)
+	if config.CorruptUploads == corruptPassThrough {
+		p.API.LogWarn("Passing through upload that could not be parsed", "name", info.Name, "user_id", info.CreatorId, "err", failure.Error())
+		return nil, ""
+	}
+	p.API.LogInfo("Rejected upload that could not be parsed", "name", info.Name, "user_id", info.CreatorId, "err", failure.Error())
+
+	switch {
+	case len(data) == 0:
+		return nil, reject(codeCorrupt, "The file is empty.")
+	case errors.Is(failure, exif.ErrTruncated):
+		return nil, reject(codeCorrupt, "The file is truncated, and cannot be processed.")
+	case exif.Detect(data) == "":
+		return nil, reject(codeUnsupportedFormat, "The file is not an image or video of a supported format, or is corrupt.")
+	}
+	return nil, reject(codeCorrupt, "The file is corrupt, and cannot be processed.")
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestFileWillBeUploadedWriteFailure(t *testing.T) {
+	// A failure to write the sanitized copy is not blamed on the upload, whatever the policy.
+	p, _ := newUploadTestPlugin(&configuration{CorruptUploads: corruptPassThrough})
+	info := &model.FileInfo{Name: "photo.jpg", Extension: "jpg", MimeType: "image/jpeg", CreatorId: "user"}
+	replacement, rejection := p.FileWillBeUploaded(nil, info, strings.NewReader(string(exifJPEG)), failingWriter{})
+	assert.Nil(t, replacement)
+	assert.Equal(t, "EXIF010: An error occurred while trying to discard exif data: an error occurred while writing the image: disk full", rejection)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
+	"github.com/pkg/errors"
+)
+
+// cronDescriptors are the shorthands accepted in place of five field cron expressions.
+var cronDescriptors = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// cronSchedule is a parsed cron expression. Each field holds the set of values it matches.
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays uint64
+
+	// anyDay and anyWeekday are true if the day of month or day of week field is a wildcard. As
+	// in cron, if both are restricted a time matching either of them matches.
+	anyDay, anyWeekday bool
+}
+
+// parseCron parses a cron expression of five fields: minute, hour, day of month, month and day
+// of week, where Sunday is 0 or 7. Fields are wildcards, values, ranges such as 1-5, steps such as
+// */15 or 0-30/10, or comma separated lists of those. The descriptors @hourly, @daily, @weekly and
+// @monthly are accepted too.
+func parseCron(expr string) (*cronSchedule, error) {
+	if descriptor, ok := cronDescriptors[strings.TrimSpace(expr)]; ok {
+		expr = descriptor
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, errors.Errorf("expected 5 fields in cron expression %q, got %d", expr, len(fields))
+	}
+
+	s := &cronSchedule{
+		anyDay:     strings.HasPrefix(fields[2], "*"),
+		anyWeekday: strings.HasPrefix(fields[4], "*"),
+	}
+	bounds := []struct {
+		set      *uint64
+		min, max int
+	}{
+		{&s.minutes, 0, 59},
+		{&s.hours, 0, 23},
+		{&s.days, 1, 31},
+		{&s.months, 1, 12},
+		{&s.weekdays, 0, 7},
+	}
+	for i, b := range bounds {
+		set, err := parseCronField(fields[i], b.min, b.max)
+		if err != nil {
+			return nil, err
+		}
+		*b.set = set
+	}
+	// Sunday may be written as 7.
+	if s.weekdays&(1<<7) != 0 {
+		s.weekdays |= 1
+	}
+	return s, nil
+}
+
+// parseCronField returns the set of values between min and max matched by a cron field.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, errors.Errorf("invalid step in cron field %q", field)
+			}
+			rng, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, errors.Errorf("invalid value in cron field %q", field)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, errors.Errorf("invalid range in cron field %q", field)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, errors.Errorf("cron field %q is out of range %d-%d", field, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// matchesDay returns whether the day of t matches the schedule.
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+	if s.anyDay || s.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// next returns the first time matching the schedule strictly after t, or the zero time if none
+// does within five years, as for February 30th.
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// waitForSchedule returns the wait interval of a cluster job running on the schedule. A job that
+// never ran waits for the next time matching the schedule, and a job that missed runs, such as
+// while the servers were down, runs once right away.
+func waitForSchedule(s *cronSchedule) cluster.NextWaitInterval {
+	return func(now time.Time, metadata cluster.JobMetadata) time.Duration {
+		last := metadata.LastFinished
+		if last.IsZero() {
+			// Waking up on the minute the job is due must still run it.
+			last = now.Add(-time.Minute)
+		}
+		next := s.next(last)
+		if next.IsZero() {
+			return 24 * time.Hour
+		}
+		if next.Before(now) {
+			return 0
+		}
+		return next.Sub(now)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := parseCron(expr)
+		assert.NotNil(t, err, expr)
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// Saturday, March 2nd 2024.
+	from := time.Date(2024, 3, 2, 10, 30, 15, 0, time.UTC)
+
+	testTable := []struct {
+		Expr string
+		Next time.Time
+	}{
+		{Expr: "* * * * *", Next: time.Date(2024, 3, 2, 10, 31, 0, 0, time.UTC)},
+		{Expr: "*/15 * * * *", Next: time.Date(2024, 3, 2, 10, 45, 0, 0, time.UTC)},
+		{Expr: "@hourly", Next: time.Date(2024, 3, 2, 11, 0, 0, 0, time.UTC)},
+		{Expr: "@daily", Next: time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{Expr: "0 6 * * 1", Next: time.Date(2024, 3, 4, 6, 0, 0, 0, time.UTC)},
+		{Expr: "0 6 * * 1-5", Next: time.Date(2024, 3, 4, 6, 0, 0, 0, time.UTC)},
+		{Expr: "0 9 * * 7", Next: time.Date(2024, 3, 3, 9, 0, 0, 0, time.UTC)},
+		{Expr: "30 10 2 * *", Next: time.Date(2024, 4, 2, 10, 30, 0, 0, time.UTC)},
+		{Expr: "0 0 29 2 *", Next: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// When both days are restricted, either matches.
+		{Expr: "0 0 15 * 1", Next: time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{Expr: "0 0,12 * * *", Next: time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)},
+		{Expr: "0 0 30 2 *", Next: time.Time{}},
+	}
+
+	for _, test := range testTable {
+		schedule, err := parseCron(test.Expr)
+		if assert.Nil(t, err, test.Expr) {
+			assert.Equal(t, test.Next, schedule.next(from), test.Expr)
+		}
+	}
+}
+
+func TestWaitForSchedule(t *testing.T) {
+	schedule, _ := parseCron("0 6 * * *")
+	wait := waitForSchedule(schedule)
+	now := time.Date(2024, 3, 2, 5, 0, 0, 0, time.UTC)
+
+	// A job that never ran waits for the next time due, and runs on it.
+	assert.Equal(t, time.Hour, wait(now, cluster.JobMetadata{}))
+	assert.Equal(t, time.Duration(0), wait(now.Add(time.Hour), cluster.JobMetadata{}))
+
+	// A job that ran waits for the next day, and a job that missed a run runs right away.
+	ran := time.Date(2024, 3, 2, 6, 0, 30, 0, time.UTC)
+	assert.Equal(t, 24*time.Hour-30*time.Second, wait(ran, cluster.JobMetadata{LastFinished: ran}))
+	assert.Equal(t, time.Duration(0), wait(now, cluster.JobMetadata{LastFinished: now.AddDate(0, 0, -2)}))
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"image"
+	"image/gif"
 	"image/jpeg"
 	"io"
+	"strings"
 
-	"github.com/mattermost/mattermost-server/model"
-	"github.com/mattermost/mattermost-server/plugin"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
 	"github.com/nimrodshn/mattermost-exif-plugin/exif"
 )
 
@@ -20,31 +26,309 @@ import (
 //
 // Note that this method will be called for files uploaded by plugins, including the plugin that uploaded the post.
 // FileInfo.Size will be automatically set properly if you modify the file.
-func (p *Plugin) FileWillBeUploaded(c *plugin.Context, info *model.FileInfo, file io.Reader, output io.Writer) (*model.FileInfo, string) {
-	return p.DiscardExif(info, file, output)
+func (p *Plugin) FileWillBeUploaded(c *plugin.Context, info *model.FileInfo, file io.Reader, output io.Writer) (replacement *model.FileInfo, rejection string) {
+	// The whole upload is handled with the settings current when it started, even if they change
+	// while it is processed.
+	config := p.getConfiguration()
+	written := &countingWriter{w: output}
+	output = written
+	defer p.logRejection(info, &rejection)
+	defer p.recoverUpload(info, written, config, &replacement, &rejection)
+
+	processed := config.processes(info)
+	if !processed && !config.inspects() {
+		processed, file = config.sniffUntyped(info, file)
+	}
+	renamed := config.AnonymizeFilenames && isCameraFilename(info.Name)
+	if !processed && !config.inspects() && !renamed {
+		return nil, ""
+	}
+	if sanitize, rejection := p.filterUpload(info, config); !sanitize {
+		return nil, rejection
+	}
+	if renamed {
+		anonymizeFilename(info)
+	}
+
+	switch {
+	case processed:
+		replacement, rejection = p.discardExif(info, file, output, config)
+	case config.inspects():
+		replacement, rejection = p.inspectUpload(info, file, output, config)
+	}
+	// A renamed file is replaced even if its content is left unchanged.
+	if replacement == nil && rejection == "" && renamed {
+		return info, ""
+	}
+	return replacement, rejection
 }
 
 // naiveDiscardExif attempts to decode an image file and the encode it back - by that removing the exif metdata.
+// GIF animations are decoded and encoded frame by frame, so that they are not flattened.
 func (p *Plugin) naiveDiscardExif(info *model.FileInfo, file io.Reader, output io.Writer) (*model.FileInfo, string) {
-	im, _, err := image.Decode(file)
+	buffered := bufio.NewReader(file)
+	counter := &countingWriter{w: output}
+	if header, _ := buffered.Peek(6); string(header) == "GIF87a" || string(header) == "GIF89a" {
+		animation, err := gif.DecodeAll(buffered)
+		if err != nil {
+			p.API.LogError("An error occurred while trying to decoding the uploaded file")
+			return nil, reject(codeProcessingFailed, "An error occurred while trying to decode the uploaded file: %v", err)
+		}
+		if err := gif.EncodeAll(counter, animation); err != nil {
+			p.API.LogError("An error occurred while trying to encode the uploaded file")
+			return nil, reject(codeProcessingFailed, "An error occurred while trying to encode the uploaded file: %v", err)
+		}
+		p.API.LogInfo("Processed a new image.")
+		updateFileInfo(info, counter.n, "gif", animation.Config.Width, animation.Config.Height)
+		return info, ""
+	}
+
+	im, _, err := image.Decode(buffered)
 	if err != nil {
 		p.API.LogError("An error occurred while trying to decoding the uploaded file")
-		return nil, fmt.Sprintf("An error occurred while trying to decode the uploaded file: %v", err)
+		return nil, reject(codeProcessingFailed, "An error occurred while trying to decode the uploaded file: %v", err)
 	}
-	err = jpeg.Encode(output, im, nil)
+	err = jpeg.Encode(counter, im, nil)
 	if err != nil {
 		p.API.LogError("An error occurred while trying to encode the uploaded file")
-		return nil, fmt.Sprintf("An error occurred while trying to encode the uploaded file: %v", err)
+		return nil, reject(codeProcessingFailed, "An error occurred while trying to encode the uploaded file: %v", err)
 	}
 	p.API.LogInfo("Processed a new image.")
+
+	bounds := im.Bounds()
+	updateFileInfo(info, counter.n, "jpeg", bounds.Dx(), bounds.Dy())
 	return info, ""
 }
 
-// discardExif attempts to remove the exif IFD's from an image file.
+// DiscardExif attempts to remove the exif IFD's from an image file, with the current settings.
 func (p *Plugin) DiscardExif(info *model.FileInfo, file io.Reader, output io.Writer) (*model.FileInfo, string) {
-	err := exif.Discard(file, output)
+	return p.discardExif(info, file, output, p.getConfiguration())
+}
+
+// discardExif attempts to remove the exif IFD's from an image file, with the given settings.
+// Files the plugin already sanitized with them are left unchanged, and the types of files the
+// TypeActions setting lists are handled as it says.
+func (p *Plugin) discardExif(info *model.FileInfo, file io.Reader, output io.Writer, config *configuration) (*model.FileInfo, string) {
+	// Raw images are told apart by name, and the other types from the first bytes of the upload.
+	typ := rawType
+	if !isRawUpload(info) {
+		buffered := bufio.NewReaderSize(file, sniffLength)
+		header, _ := buffered.Peek(sniffLength)
+		typ, file = exif.Detect(header), buffered
+	}
+	if handled, rejection := p.applyTypeAction(info, typ, config); handled {
+		return nil, rejection
+	}
+	transcode := config.typeAction(typ) == typeTranscode
+
+	data, oversized, err := readUpload(file, config)
+	if err != nil {
+		return nil, reject(codeProcessingFailed, "An error occurred while trying to read the uploaded file: %v", err)
+	}
+	if oversized != nil && transcode {
+		return p.oversizedTranscode(info, oversized, output, config)
+	}
+	if oversized != nil {
+		return p.oversizedUpload(info, oversized, output, config)
+	}
+	if transcode {
+		if handled, replacement, rejection := p.transcodeUpload(info, data, output, typ, config); handled {
+			return replacement, rejection
+		}
+	}
+	if p.alreadySanitized(data, config) {
+		p.API.LogDebug("Skipping upload already sanitized", "name", info.Name, "user_id", info.CreatorId)
+		return nil, ""
+	}
+	if exif.MetadataFree(data) {
+		// Files of these formats are let through unchanged rather than failing as broken JPEGs.
+		p.API.LogDebug("Passing through upload that cannot carry metadata", "name", info.Name, "user_id", info.CreatorId)
+		p.auditPassThrough(info, exif.Detect(data))
+		return nil, ""
+	}
+	if config.prefilters() && exif.NoMetadata(data) {
+		// Plain screenshots and the like are let through without parsing or copying them.
+		p.API.LogDebug("Passing through upload without metadata", "name", info.Name, "user_id", info.CreatorId)
+		p.auditUploadDetail(info, &exif.Report{Format: exif.Detect(data)}, noMetadataFound)
+		return nil, ""
+	}
+
+	sum := sha256.New()
+	writers := []io.Writer{output, sum}
+	var sanitized *bytes.Buffer
+	if config.VerifyPixels {
+		sanitized = new(bytes.Buffer)
+		writers = append(writers, sanitized)
+	}
+	counter := &countingWriter{w: io.MultiWriter(writers...)}
+	report, err := p.sanitizeWithinTimeout(data, counter, config)
+	if errors.Is(err, errTimeout) {
+		return p.timedOutUpload(info, data, output, config, err)
+	}
+	var rejected *exif.SegmentRejectedError
+	if errors.As(err, &rejected) {
+		p.auditFailure(info, err)
+		return nil, reject(codeSegmentRejected, "The image carries metadata segments that are not allowed on this server.")
+	}
+	var rejectedChunk *exif.ChunkRejectedError
+	if errors.As(err, &rejectedChunk) {
+		p.auditFailure(info, err)
+		return nil, reject(codeChunkRejected, "The image carries metadata chunks that are not allowed on this server.")
+	}
+	if err != nil && counter.err == nil {
+		return p.corruptUpload(info, data, err, config)
+	}
 	if err != nil {
-		return nil, fmt.Sprintf("An error occurred while trying to discard exif data: %v", err)
+		p.auditFailure(info, err)
+		return nil, reject(codeProcessingFailed, "An error occurred while trying to discard exif data: %v", err)
+	}
+	if sanitized != nil {
+		if rejection := p.verifyPixels(info, data, sanitized.Bytes()); rejection != "" {
+			return nil, rejection
+		}
+	}
+	updateFileInfo(info, counter.n, report.Format, report.Width, report.Height)
+	p.markSanitized(sum, config)
+	p.auditUpload(info, report)
+
+	if report.ExifRemoved || report.ExifEdited || report.MetadataRemoved {
+		p.API.LogInfo("Removed metadata from upload", "name", info.Name, "user_id", info.CreatorId, "summary", summarize(report))
+	}
+	if report.TrailerRemoved {
+		p.API.LogInfo("Removed trailing data from upload", "name", info.Name, "user_id", info.CreatorId, "trailer_size", report.TrailerSize)
+	}
+	if report.PairingRemoved {
+		p.API.LogInfo("Removed Live Photo pairing identifier from upload", "name", info.Name, "user_id", info.CreatorId)
+	}
+	if report.C2PAManifest != nil {
+		p.API.LogInfo("Removed C2PA manifest from upload", "name", info.Name, "user_id", info.CreatorId, "manifest_size", len(report.C2PAManifest))
+	}
+
+	if (config.NotifyUploader && (report.ExifRemoved || report.ExifEdited)) || report.C2PAManifest != nil {
+		p.notifyUploader(info, report, config)
 	}
 	return info, ""
 }
+
+// mimeTypes maps the formats reported by exif.Sanitize to their MIME types.
+var mimeTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+	"heic": "image/heic",
+	"avif": "image/avif",
+	"heif": "image/heif",
+	"jp2":  "image/jp2",
+	"jpx":  "image/jpx",
+	"tiff": "image/tiff",
+	"bmp":  "image/bmp",
+	"ico":  "image/vnd.microsoft.icon",
+	"ppm":  "image/x-portable-pixmap",
+	"pgm":  "image/x-portable-graymap",
+	"svg":  "image/svg+xml",
+	"mp4":  "video/mp4",
+	"mov":  "video/quicktime",
+	"pdf":  "application/pdf",
+}
+
+// updateFileInfo records the size, format and dimensions of the processed image in info, so that
+// Mattermost generates previews and thumbnails matching the file stored. Removing the EXIF
+// orientation of rotated photos swaps their dimensions. Unknown dimensions are left unchanged.
+func updateFileInfo(info *model.FileInfo, size int64, format string, width, height int) {
+	info.Size = size
+	if mimeType, ok := mimeTypes[format]; ok {
+		info.MimeType = mimeType
+	}
+	if width > 0 && height > 0 {
+		info.Width = width
+		info.Height = height
+	}
+}
+
+// countingWriter counts the bytes written through it, and keeps the first error writing them, so
+// that failures to write are told apart from failures to parse.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	if c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
+
+// debugLogger adapts the plugin API to the exif.Logger interface, logging the diagnostics of the
+// exif package at debug level, so that they only show up in the server log when debugging.
+type debugLogger struct {
+	api plugin.API
+}
+
+func (d debugLogger) Printf(format string, v ...interface{}) {
+	d.api.LogDebug(fmt.Sprintf(format, v...))
+}
+
+// formatLogger adapts the plugin API to the exif.Logger interface, logging the diagnostics of the
+// exif package at info level with the format of the file, for the formats of the DebugFormats
+// setting, so that they show up in the server log without debugging enabled for everything else.
+type formatLogger struct {
+	api    plugin.API
+	format string
+}
+
+func (f formatLogger) Printf(format string, v ...interface{}) {
+	f.api.LogInfo(fmt.Sprintf(format, v...), "format", f.format)
+}
+
+// sanitizeOptions returns the options of exif.Sanitize matching the configuration, for a file of
+// the given format, as named by exif.Detect. The diagnostics of the exif package are logged at
+// debug level, or, if the DebugFormats setting is set, only for the formats it lists, at info
+// level.
+func (p *Plugin) sanitizeOptions(config *configuration, format string) []exif.Option {
+	var logger exif.Logger = debugLogger{p.API}
+	if traced := config.tracedFormats(); traced != nil {
+		if !traced[format] {
+			return config.sanitizeOptions()
+		}
+		logger = formatLogger{api: p.API, format: format}
+	}
+	return append(config.sanitizeOptions(), exif.WithLogger(logger))
+}
+
+// summarize describes what the EXIF data removed from an upload revealed.
+func summarize(report *exif.Report) string {
+	switch report.Format {
+	case "pdf":
+		return "document properties"
+	case "svg":
+		return "editor data"
+	}
+	if report.Summary == nil && !report.ExifRemoved {
+		return "no EXIF data"
+	}
+	if report.Summary == nil {
+		return "unreadable EXIF data"
+	}
+	return report.Summary.String()
+}
+
+// notifyUploader tells the uploader of a file what metadata was removed from it, as their
+// notification preference asks.
+func (p *Plugin) notifyUploader(info *model.FileInfo, report *exif.Report, config *configuration) {
+	var lines []string
+	if report.ExifRemoved || report.ExifEdited {
+		lines = append(lines, fmt.Sprintf("Removed metadata from `%s` (%s).", info.Name, p.describe(report, config)))
+	}
+	if report.C2PAManifest != nil {
+		lines = append(lines, fmt.Sprintf("Content Credentials (C2PA provenance data, %d bytes) were removed from `%s`.", len(report.C2PAManifest), info.Name))
+	}
+
+	if err := p.notify(info, strings.Join(lines, "\n")); err != nil {
+		p.API.LogWarn("Failed to notify uploader", "user_id", info.CreatorId, "err", err.Error())
+	}
+}
@@ -2,50 +2,70 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"strings"
 	"testing"
 
-	"github.com/mattermost/mattermost-server/model"
-	"github.com/mattermost/mattermost-server/plugin"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+	"github.com/stretchr/testify/mock"
 )
 
+// exifJPEG is a minimal JPEG image with an EXIF segment recording the camera make.
+var exifJPEG = []byte{
+	0xFF, 0xD8, // Start of image.
+	0xFF, 0xE1, // Markers
+	0x00, 0x22, // Length of the segment, including the length field.
+	'E', 'x', 'i', 'f', 0x00, 0x00, // EXIF identifier.
+	0x4d, 0x4d, // "MM" - Big Endian.
+	0x00, 0x2A, // Fixed 2-bytes.
+	0x00, 0x00, 0x00, 0x08, // Offset eight to first IFD.
+	0x00, 0x01, // One tag.
+	0x01, 0x0F, // Make.
+	0x00, 0x02, // ASCII.
+	0x00, 0x00, 0x00, 0x04, // Four characters.
+	'A', 'C', 'M', 0x00, // The value fits in the offset field.
+	0x00, 0x00, 0x00, 0x00, // No next IFD.
+	0xFF, 0xDA, // Start of scan.
+	0x00, 0x02,
+	0x00, 0x00,
+	0xFF, 0xD9, // End of image.
+}
+
+// isMarkerKey matches the keys of the markers of sanitized files.
+func isMarkerKey(key string) bool {
+	return strings.HasPrefix(key, markerPrefix)
+}
+
 func TestDiscardExif(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("LogDebug", mock.AnythingOfType("string")).Maybe()
+	api.On("LogInfo", "Removed metadata from upload", "name", mock.Anything, "user_id", mock.Anything, "summary", "ACM, GPS: no")
+	api.On("KVGet", auditKey).Return(nil, nil)
+	api.On("KVCompareAndSet", auditKey, []byte(nil), mock.Anything).Return(true, nil)
+	api.On("KVSetWithOptions", mock.MatchedBy(isAuditRecordsKey), mock.Anything, mock.Anything).Return(true, nil)
+	api.On("KVGet", mock.MatchedBy(isMarkerKey)).Return(nil, nil)
+	api.On("KVSetWithExpiry", mock.MatchedBy(isMarkerKey), []byte((&configuration{}).fingerprint()), int64(30*24*60*60)).Return(nil)
 	p := &Plugin{
 		MattermostPlugin: plugin.MattermostPlugin{},
 	}
+	p.SetAPI(api)
 
 	testTable := []struct {
 		Input  []byte
 		Output []byte
 	}{
 		{
-			Input: []byte{
-				0x00, 0x00,
-				0xFF, 0xE1, // Markers
-				0x00, 0x0F,
-				'E', 'x', 'i', 'f', 0x00, 0x00, // EXIF identifier.
-				0x4d, 0x4d, // "MM" - Big Endian.
-				0x00, 0x2A, // Fixed 2-bytes.
-				0x00, 0x00, 0x00, 0x14, // Offset twenty to first IFD.
-				0x00, 0x01, // One tag.
-				0x00, 0x00, // Remove bytes from this part onwards.
-				0x00, 0x00,
-				0x00, 0x00,
-				0x00, 0x00,
-				0x00, 0x00,
-				0x00, 0x00,
-				0x00, 0x00,
-				0x00, 0x00,
-				0xFF, 0xFF,
-			},
+			Input: exifJPEG,
 			Output: []byte{
+				0xFF, 0xD8, // Start of image.
+				0xFF, 0xDA, // Start of scan.
+				0x00, 0x02,
 				0x00, 0x00,
-				0xFF, 0xE1, // Markers
-				0x00, 0x0F,
-				'E', 'x', 'i', 'f', 0x00, 0x00, // EXIF identifier.
-				0x4d, 0x4d, // "II" - Litte Endian.
-				0x00, 0x2A, // Fixed 2-bytes.
-				0x00, 0x00, 0x00, 0x14,
-				0xFF, 0xFF,
+				0xFF, 0xD9, // End of image.
 			},
 		},
 	}
@@ -55,14 +75,221 @@ func TestDiscardExif(t *testing.T) {
 		result := make([]byte, 0)
 		resultWriter := bytes.NewBuffer(result)
 
-		_, str := p.DiscardExif(&model.FileInfo{}, buff, resultWriter)
+		info, str := p.DiscardExif(&model.FileInfo{Size: int64(len(test.Input))}, buff, resultWriter)
 
 		if str != "" {
 			t.Errorf("Expected string to be empty instead recieved: %s", str)
 		}
+		if info.Size != int64(len(test.Output)) || info.MimeType != "image/jpeg" {
+			t.Errorf("Expected the file info to match the output, got size %d and type %q", info.Size, info.MimeType)
+		}
 
 		if !bytes.Equal(test.Output, resultWriter.Bytes()) {
 			t.Errorf("Expected result to be: %s instead got: %s", string(test.Output), string(resultWriter.Bytes()))
 		}
 	}
+
+	api.AssertExpectations(t)
+}
+
+func TestDiscardExifSkipsSanitizedFiles(t *testing.T) {
+	sum := sha256.Sum256(exifJPEG)
+	api := &plugintest.API{}
+	api.On("KVGet", markerKey(sum[:])).Return([]byte((&configuration{}).fingerprint()), nil)
+	api.On("LogDebug", "Skipping upload already sanitized", "name", "beach.jpg", "user_id", "user")
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	output := new(bytes.Buffer)
+	info, str := p.DiscardExif(&model.FileInfo{Name: "beach.jpg", CreatorId: "user"}, bytes.NewReader(exifJPEG), output)
+	if info != nil || str != "" || output.Len() != 0 {
+		t.Errorf("Expected the sanitized file to be left unchanged")
+	}
+
+	// Files sanitized with other settings are sanitized again.
+	p.setConfiguration(&configuration{MetadataProfile: "remove-timestamps"})
+	if p.alreadySanitized(exifJPEG, p.getConfiguration()) {
+		t.Errorf("Expected the file to be sanitized again with other settings")
+	}
+	api.AssertExpectations(t)
+}
+
+func TestDiscardExifPrefiltersCleanUploads(t *testing.T) {
+	clean := []byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02, 0x00, 0x00, 0xFF, 0xD9}
+	api := &plugintest.API{}
+	api.On("LogDebug", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+	api.On("KVGet", mock.Anything).Return(nil, nil)
+	api.On("KVCompareAndSet", auditKey, []byte(nil), mock.Anything).Return(true, nil)
+	api.On("KVSetWithOptions", mock.MatchedBy(isAuditRecordsKey), mock.Anything, mock.Anything).Return(true, nil)
+	api.On("KVSetWithExpiry", mock.MatchedBy(isMarkerKey), mock.Anything, mock.Anything).Return(nil)
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	output := new(bytes.Buffer)
+	info, str := p.DiscardExif(&model.FileInfo{Name: "screenshot.jpg", CreatorId: "user"}, bytes.NewReader(clean), output)
+	if info != nil || str != "" || output.Len() != 0 {
+		t.Errorf("Expected the clean upload to be let through unchanged")
+	}
+	api.AssertCalled(t, "KVCompareAndSet", auditKey, []byte(nil), mock.MatchedBy(func(data []byte) bool {
+		var audit auditLog
+		return json.Unmarshal(data, &audit) == nil && audit.Processed == 1 && audit.Prefiltered == 1
+	}))
+
+	// Removing trailing data may change files without metadata, which are sanitized then.
+	p.setConfiguration(&configuration{RemoveTrailingData: true})
+	info, str = p.DiscardExif(&model.FileInfo{Name: "screenshot.jpg", CreatorId: "user"}, bytes.NewReader(clean), output)
+	if info == nil || str != "" || !bytes.Equal(output.Bytes(), clean) {
+		t.Errorf("Expected the upload to be sanitized, got %+v and %q", info, str)
+	}
+}
+
+func TestDiscardExifRejectsSegments(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("LogDebug", mock.AnythingOfType("string")).Maybe()
+	api.On("KVGet", mock.Anything).Return(nil, nil)
+	api.On("KVCompareAndSet", auditKey, []byte(nil), mock.Anything).Return(true, nil)
+	api.On("KVSetWithOptions", mock.MatchedBy(isAuditRecordsKey), mock.Anything, mock.Anything).Return(true, nil)
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.setConfiguration(&configuration{SegmentPolicy: "APP1=reject"})
+
+	output := new(bytes.Buffer)
+	info, str := p.DiscardExif(&model.FileInfo{Name: "beach.jpg", CreatorId: "user"}, bytes.NewReader(exifJPEG), output)
+	if info != nil || str != "EXIF005: The image carries metadata segments that are not allowed on this server." {
+		t.Errorf("Expected the upload to be rejected, got %+v and %q", info, str)
+	}
+	api.AssertExpectations(t)
+}
+
+// TestFileWillBeUploadedSources checks that the uploads of every client reach the same policy,
+// with the file infos Mattermost creates for them.
+func TestFileWillBeUploadedSources(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("LogDebug", mock.AnythingOfType("string")).Maybe()
+	api.On("LogDebug", "Skipping upload by policy", "name", mock.Anything, "uploader", mock.Anything).Maybe()
+	api.On("LogInfo", "Rejected upload by policy", "name", mock.Anything, "uploader", mock.Anything, "user_id", mock.Anything).Maybe()
+	api.On("LogInfo", "Rejected upload", "name", "beach.jpg", "user_id", "bot", "code", codeUploaderRejected, "rejection", mock.Anything).Maybe()
+	api.On("LogInfo", "Removed metadata from upload", "name", mock.Anything, "user_id", mock.Anything, "summary", "ACM, GPS: no").Maybe()
+	api.On("GetUser", "bot").Return(&model.User{Id: "bot", IsBot: true}, nil)
+	api.On("GetUser", "user").Return(&model.User{Id: "user"}, nil)
+	api.On("KVGet", mock.Anything).Return(nil, nil)
+	api.On("KVCompareAndSet", auditKey, []byte(nil), mock.Anything).Return(true, nil)
+	api.On("KVSetWithOptions", mock.MatchedBy(isAuditRecordsKey), mock.Anything, mock.Anything).Return(true, nil)
+	api.On("KVSetWithExpiry", mock.MatchedBy(isMarkerKey), mock.Anything, mock.Anything).Return(nil)
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.setConfiguration(&configuration{BotUploads: uploadsReject, PluginUploads: uploadsSkip})
+
+	testTable := []struct {
+		Name      string
+		Info      *model.FileInfo
+		Input     []byte
+		Sanitized bool
+		Rejection string
+	}{
+		{
+			Name:      "web app or REST API",
+			Info:      &model.FileInfo{Name: "beach.jpg", Extension: "jpg", MimeType: "image/jpeg", CreatorId: "user", ChannelId: "channel"},
+			Input:     exifJPEG,
+			Sanitized: true,
+		},
+		{
+			Name:      "REST API with a bot access token",
+			Info:      &model.FileInfo{Name: "beach.jpg", Extension: "jpg", MimeType: "image/jpeg", CreatorId: "bot", ChannelId: "channel"},
+			Input:     exifJPEG,
+			Rejection: "EXIF008: Uploads from bots are not allowed on this server.",
+		},
+		{
+			Name:      "mobile background upload",
+			Info:      &model.FileInfo{Name: "IMG_0001.JPG", Extension: "JPG", MimeType: "image/jpeg", CreatorId: "user", ChannelId: "channel"},
+			Input:     exifJPEG,
+			Sanitized: true,
+		},
+		{
+			Name:      "mobile share without an extension",
+			Info:      &model.FileInfo{Name: "image", MimeType: "application/octet-stream", CreatorId: "user", ChannelId: "channel"},
+			Input:     exifJPEG,
+			Sanitized: true,
+		},
+		{
+			Name:  "untyped text",
+			Info:  &model.FileInfo{Name: "notes", CreatorId: "user", ChannelId: "channel"},
+			Input: []byte("notes"),
+		},
+		{
+			Name:  "plugin API",
+			Info:  &model.FileInfo{Name: "chart.jpg", Extension: "jpg", MimeType: "image/jpeg", CreatorId: pluginCreatorID, ChannelId: "channel"},
+			Input: exifJPEG,
+		},
+	}
+
+	for _, test := range testTable {
+		output := new(bytes.Buffer)
+		info, str := p.FileWillBeUploaded(nil, test.Info, bytes.NewReader(test.Input), output)
+		if str != test.Rejection {
+			t.Errorf("%s: expected rejection %q, got %q", test.Name, test.Rejection, str)
+		}
+		if !test.Sanitized {
+			if info != nil || output.Len() != 0 {
+				t.Errorf("%s: expected the upload to be left unchanged", test.Name)
+			}
+			continue
+		}
+		if info == nil || info.MimeType != "image/jpeg" || output.Len() == 0 || bytes.Contains(output.Bytes(), []byte("Exif")) {
+			t.Errorf("%s: expected the upload to be sanitized, got %+v", test.Name, info)
+		}
+	}
+}
+
+func TestFileWillBeUploadedRemovesPDFMetadata(t *testing.T) {
+	document := []byte("%PDF-1.7\n1 0 obj\n<< /Author (Jane) /Creator (Writer) >>\nendobj\ntrailer\n<< /Info 1 0 R >>\n%%EOF\n")
+	api := &plugintest.API{}
+	api.On("LogDebug", mock.AnythingOfType("string")).Maybe()
+	api.On("LogInfo", "Removed metadata from upload", "name", "report.pdf", "user_id", "user", "summary", "document properties")
+	api.On("KVGet", mock.Anything).Return(nil, nil)
+	api.On("KVCompareAndSet", auditKey, []byte(nil), mock.Anything).Return(true, nil)
+	api.On("KVSetWithOptions", mock.MatchedBy(isAuditRecordsKey), mock.Anything, mock.Anything).Return(true, nil)
+	api.On("KVSetWithExpiry", mock.MatchedBy(isMarkerKey), mock.Anything, mock.Anything).Return(nil)
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	// PDF documents are let through unless their metadata is removed.
+	p.setConfiguration(&configuration{})
+	output := new(bytes.Buffer)
+	info, str := p.FileWillBeUploaded(nil, &model.FileInfo{Name: "report.pdf", CreatorId: "user", MimeType: "application/pdf", Extension: "pdf"}, bytes.NewReader(document), output)
+	if info != nil || str != "" || output.Len() != 0 {
+		t.Errorf("Expected the document to be let through unchanged")
+	}
+
+	p.setConfiguration(&configuration{RemovePDFMetadata: true})
+	info, str = p.FileWillBeUploaded(nil, &model.FileInfo{Name: "report.pdf", CreatorId: "user", MimeType: "application/pdf", Extension: "pdf"}, bytes.NewReader(document), output)
+	if str != "" || info == nil || info.MimeType != "application/pdf" || info.Size != int64(len(document)) {
+		t.Fatalf("Expected the document to be sanitized, got %+v and %q", info, str)
+	}
+	if bytes.Contains(output.Bytes(), []byte("Jane")) || !bytes.Contains(output.Bytes(), []byte("/Info 1 0 R")) {
+		t.Errorf("Expected the document information to be blanked, got %s", output.Bytes())
+	}
+	api.AssertExpectations(t)
+}
+
+func TestSanitizeOptionsDebugFormats(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("LogInfo", mock.AnythingOfType("string"), "format", "jpeg")
+	p := &Plugin{}
+	p.SetAPI(api)
+	config := &configuration{DebugFormats: "jpeg, heic"}
+	config.compile()
+
+	// The diagnostics of the listed formats are logged at info level, and the others not at all.
+	if _, err := exif.SanitizeBytes(exifJPEG, new(bytes.Buffer), p.sanitizeOptions(config, "jpeg")...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	api.AssertCalled(t, "LogInfo", mock.AnythingOfType("string"), "format", "jpeg")
+	calls := len(api.Calls)
+	if _, err := exif.SanitizeBytes(exifJPEG, new(bytes.Buffer), p.sanitizeOptions(config, "png")...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(api.Calls) != calls {
+		t.Errorf("Expected the diagnostics of other formats not to be logged")
+	}
 }
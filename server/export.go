@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// dateLayout is the layout of the dates of export ranges and of the daily audit records.
+	dateLayout = "2006-01-02"
+
+	// defaultExportDays is the length of the export range when its start is not given, and
+	// maxExportDays the longest range exported at once.
+	defaultExportDays = 30
+	maxExportDays     = 366
+)
+
+// exportHeader is the header row of CSV exports.
+var exportHeader = []string{"time", "file_name", "user_id", "format", "outcome", "gps", "bytes_removed", "detail"}
+
+// parseExportRange parses the UTC dates of an export range, inclusive. The range ends today if to
+// is empty, and starts defaultExportDays before its end if from is empty.
+func parseExportRange(from, to string, now time.Time) (time.Time, time.Time, error) {
+	end := now.UTC().Truncate(24 * time.Hour)
+	if to != "" {
+		var err error
+		if end, err = time.Parse(dateLayout, to); err != nil {
+			return time.Time{}, time.Time{}, errors.Errorf("invalid end date %q, expected YYYY-MM-DD", to)
+		}
+	}
+	start := end.AddDate(0, 0, -defaultExportDays+1)
+	if from != "" {
+		var err error
+		if start, err = time.Parse(dateLayout, from); err != nil {
+			return time.Time{}, time.Time{}, errors.Errorf("invalid start date %q, expected YYYY-MM-DD", from)
+		}
+	}
+
+	if start.After(end) {
+		return time.Time{}, time.Time{}, errors.New("the start date is after the end date")
+	}
+	if end.Sub(start) >= maxExportDays*24*time.Hour {
+		return time.Time{}, time.Time{}, errors.Errorf("the range is longer than %d days", maxExportDays)
+	}
+	return start, end, nil
+}
+
+// writeExport writes records to w as CSV, or as a JSON array if format is json.
+func writeExport(w io.Writer, records []auditRecord, format string) error {
+	if format == "json" {
+		if records == nil {
+			records = []auditRecord{}
+		}
+		return json.NewEncoder(w).Encode(records)
+	}
+
+	out := csv.NewWriter(w)
+	out.Write(exportHeader)
+	for _, record := range records {
+		outcome := "sanitized"
+		if record.Failed {
+			outcome = "failed"
+		}
+		out.Write([]string{
+			time.UnixMilli(record.Time).UTC().Format(time.RFC3339),
+			record.FileName,
+			record.UserID,
+			record.Format,
+			outcome,
+			strconv.FormatBool(record.GPS),
+			strconv.Itoa(record.BytesRemoved),
+			record.Detail,
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// handleExportAudit serves the audit records of a date range as a CSV or JSON download to the
+// users allowed to view the audit log, for handing to auditors. The from and to query parameters
+// are UTC dates, and the format parameter is csv, the default, or json.
+func (p *Plugin) handleExportAudit(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+	if !p.canViewStats(userID) {
+		http.Error(w, "You do not have permission to export the audit log", http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		http.Error(w, "The format must be csv or json", http.StatusBadRequest)
+		return
+	}
+	from, to, err := parseExportRange(query.Get("from"), query.Get("to"), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	records, err := p.auditRecords(from, to)
+	if err != nil {
+		p.API.LogError("Failed to read the audit records", "err", err.Error())
+		http.Error(w, "Failed to read the audit records", http.StatusInternalServerError)
+		return
+	}
+
+	contentType := "text/csv"
+	if format == "json" {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=exif-audit-%s-%s.%s", from.Format(dateLayout), to.Format(dateLayout), format))
+	if err := writeExport(w, records, format); err != nil {
+		p.API.LogWarn("Failed to write the audit export", "err", err.Error())
+	}
+}
+
+// executeExportAudit replies with a link to download the audit records of a date range, given
+// as `--from YYYY-MM-DD --to YYYY-MM-DD --format csv|json`. The download itself checks the
+// permissions of the user.
+func (p *Plugin) executeExportAudit(args *model.CommandArgs, params []string) *model.CommandResponse {
+	usage := "Usage: `/exif export-audit [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--format csv|json]`"
+	if !p.canViewStats(args.UserId) {
+		return ephemeralResponse("You do not have permission to export the audit log.")
+	}
+
+	flags := map[string]string{"from": "", "to": "", "format": "csv"}
+	for i := 0; i < len(params); i++ {
+		name, value, found := strings.Cut(strings.TrimPrefix(params[i], "--"), "=")
+		if _, ok := flags[name]; !ok || !strings.HasPrefix(params[i], "--") {
+			return ephemeralResponse(usage)
+		}
+		if !found {
+			if i+1 == len(params) {
+				return ephemeralResponse(usage)
+			}
+			i++
+			value = params[i]
+		}
+		flags[name] = value
+	}
+	if flags["format"] != "csv" && flags["format"] != "json" {
+		return ephemeralResponse(usage)
+	}
+	from, to, err := parseExportRange(flags["from"], flags["to"], time.Now())
+	if err != nil {
+		return ephemeralResponse(fmt.Sprintf("Invalid date range: %s.", err.Error()))
+	}
+
+	query := url.Values{}
+	query.Set("from", from.Format(dateLayout))
+	query.Set("to", to.Format(dateLayout))
+	query.Set("format", flags["format"])
+	siteURL := ""
+	if config := p.API.GetConfig(); config != nil && config.ServiceSettings.SiteURL != nil {
+		siteURL = strings.TrimSuffix(*config.ServiceSettings.SiteURL, "/")
+	}
+	link := fmt.Sprintf("%s/plugins/%s/api/v1/audit/export?%s", siteURL, manifest.Id, query.Encode())
+	return ephemeralResponse(fmt.Sprintf("[Download the audit records from %s to %s](%s) (%s).",
+		from.Format(dateLayout), to.Format(dateLayout), link, strings.ToUpper(flags["format"])))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExportRange(t *testing.T) {
+	now := time.Date(2024, 3, 31, 15, 0, 0, 0, time.UTC)
+	day := func(month time.Month, d int) time.Time { return time.Date(2024, month, d, 0, 0, 0, 0, time.UTC) }
+
+	testTable := []struct {
+		From, To   string
+		Start, End time.Time
+		Error      bool
+	}{
+		{Start: day(3, 2), End: day(3, 31)},
+		{From: "2024-03-01", To: "2024-03-15", Start: day(3, 1), End: day(3, 15)},
+		{To: "2024-02-29", Start: day(1, 31), End: day(2, 29)},
+		{From: "2024-03-15", To: "2024-03-01", Error: true},
+		{From: "2023-01-01", To: "2024-03-01", Error: true},
+		{From: "03/01/2024", Error: true},
+	}
+
+	for _, test := range testTable {
+		start, end, err := parseExportRange(test.From, test.To, now)
+		if test.Error {
+			assert.NotNil(t, err, test.From+" "+test.To)
+			continue
+		}
+		assert.Nil(t, err, test.From+" "+test.To)
+		assert.Equal(t, test.Start, start, test.From+" "+test.To)
+		assert.Equal(t, test.End, end, test.From+" "+test.To)
+	}
+}
+
+func TestHandleExportAudit(t *testing.T) {
+	assert := assert.New(t)
+	first, _ := json.Marshal([]auditRecord{
+		{Time: time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC).UnixMilli(), FileName: "beach.jpg", UserID: "user", Format: "jpeg", GPS: true, BytesRemoved: 1024, Detail: "iPhone 14 Pro, GPS: yes"},
+	})
+	third, _ := json.Marshal(auditRecord{
+		Time: time.Date(2024, 3, 3, 18, 0, 0, 0, time.UTC).UnixMilli(), FileName: "broken.jpg", UserID: "user", Failed: true, Detail: "not a JPEG image",
+	})
+
+	api := &plugintest.API{}
+	api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+	api.On("HasPermissionTo", "user", model.PermissionManageSystem).Return(false)
+	// The records of 2024-03-01 are stored as a daily array, as by earlier versions.
+	api.On("KVList", 0, 100).Return([]string{
+		auditKey,
+		auditRecordsPrefix + "2024-02-29_" + model.NewId(),
+		auditRecordsPrefix + "2024-03-01",
+		auditRecordsPrefix + "2024-03-03_record",
+		auditRecordsPrefix + "2024-03-04_" + model.NewId(),
+	}, nil)
+	api.On("KVGet", auditRecordsPrefix+"2024-03-01").Return(first, nil)
+	api.On("KVGet", auditRecordsPrefix+"2024-03-03_record").Return(third, nil)
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	testTable := []struct {
+		Name   string
+		UserID string
+		Query  string
+		Status int
+		Body   string
+	}{
+		{Name: "not allowed", UserID: "user", Query: "from=2024-03-01&to=2024-03-03", Status: http.StatusForbidden},
+		{Name: "invalid format", UserID: "admin", Query: "from=2024-03-01&to=2024-03-03&format=xml", Status: http.StatusBadRequest},
+		{Name: "invalid range", UserID: "admin", Query: "from=2024-03-03&to=2024-03-01", Status: http.StatusBadRequest},
+		{
+			Name:   "csv",
+			UserID: "admin",
+			Query:  "from=2024-03-01&to=2024-03-03",
+			Status: http.StatusOK,
+			Body: "time,file_name,user_id,format,outcome,gps,bytes_removed,detail\n" +
+				"2024-03-01T09:30:00Z,beach.jpg,user,jpeg,sanitized,true,1024,\"iPhone 14 Pro, GPS: yes\"\n" +
+				"2024-03-03T18:00:00Z,broken.jpg,user,,failed,false,0,not a JPEG image\n",
+		},
+		{
+			Name:   "empty json",
+			UserID: "admin",
+			Query:  "from=2024-03-02&to=2024-03-02&format=json",
+			Status: http.StatusOK,
+			Body:   "[]\n",
+		},
+	}
+
+	for _, test := range testTable {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/v1/audit/export?"+test.Query, nil)
+		r.Header.Set("Mattermost-User-Id", test.UserID)
+		p.ServeHTTP(nil, w, r)
+		assert.Equal(test.Status, w.Code, test.Name)
+		if test.Body != "" {
+			assert.Equal(test.Body, w.Body.String(), test.Name)
+		}
+	}
+}
+
+func TestExecuteExportAudit(t *testing.T) {
+	siteURL := "https://chat.example.com/"
+	config := &model.Config{}
+	config.ServiceSettings.SiteURL = &siteURL
+	api := &plugintest.API{}
+	api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+	api.On("HasPermissionTo", "user", model.PermissionManageSystem).Return(false)
+	api.On("GetConfig").Return(config)
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	usage := "Usage: `/exif export-audit [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--format csv|json]`"
+	testTable := []struct {
+		Command string
+		UserID  string
+		Text    string
+	}{
+		{Command: "/exif export-audit", UserID: "user", Text: "You do not have permission to export the audit log."},
+		{Command: "/exif export-audit --since 2024-03-01", UserID: "admin", Text: usage},
+		{Command: "/exif export-audit --from", UserID: "admin", Text: usage},
+		{Command: "/exif export-audit --format xml", UserID: "admin", Text: usage},
+		{Command: "/exif export-audit --from 2024-03-15 --to 2024-03-01", UserID: "admin", Text: "Invalid date range: the start date is after the end date."},
+		{
+			Command: "/exif export-audit --from 2024-03-01 --to=2024-03-15 --format json",
+			UserID:  "admin",
+			Text:    "[Download the audit records from 2024-03-01 to 2024-03-15](https://chat.example.com/plugins/mattermost-exif-plugin/api/v1/audit/export?format=json&from=2024-03-01&to=2024-03-15) (JSON).",
+		},
+	}
+
+	for _, test := range testTable {
+		response, appErr := p.ExecuteCommand(nil, &model.CommandArgs{Command: test.Command, UserId: test.UserID})
+		assert.Nil(t, appErr, test.Command)
+		assert.Equal(t, test.Text, response.Text, test.Command)
+	}
+}
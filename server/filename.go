@@ -0,0 +1,37 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// cameraFilenamePattern matches the names, without their extension, that cameras, phones and
+// messaging apps give files by default, such as IMG_1234, DSC_0042, PXL_20240302_101500123 or
+// 20240302_101500, optionally followed by the copy number browsers add, such as " (1)". Their
+// sequence numbers and timestamps can tie uploads to a device and to each other.
+var cameraFilenamePattern = regexp.MustCompile(`(?i)^(` +
+	`IMG_E?\d{4}|(MV)?IMG_\d{8}_\d{6}(_\d+)?|IMG-\d{8}-WA\d{4}|VID_\d{8}_\d{6}|MOV_\d{4}|` +
+	`_?DSC[NF_]?\d{4,5}|P\d{7}|PXL_\d{8}_\d{9}(\.[A-Z_]+)?|GOPR\d{4}|G[HX]\d{6}|DJI_\d{4}|` +
+	`\d{8}_\d{6}` +
+	`)( \(\d+\))?$`)
+
+// isCameraFilename reports whether name is one a camera or phone gives files by default.
+func isCameraFilename(name string) bool {
+	return cameraFilenamePattern.MatchString(strings.TrimSuffix(name, filepath.Ext(name)))
+}
+
+// anonymizeFilename renames the file of info to a generated name, such as
+// image-3wbqfzu5gjn.jpg, keeping its extension.
+func anonymizeFilename(info *model.FileInfo) {
+	prefix := "file"
+	switch {
+	case strings.HasPrefix(info.MimeType, "image/"):
+		prefix = "image"
+	case strings.HasPrefix(info.MimeType, "video/"):
+		prefix = "video"
+	}
+	info.Name = prefix + "-" + model.NewId()[:11] + filepath.Ext(info.Name)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestIsCameraFilename(t *testing.T) {
+	testTable := []struct {
+		Name   string
+		Camera bool
+	}{
+		{"IMG_1234.JPG", true},
+		{"img_1234.heic", true},
+		{"IMG_E1234.JPG", true},
+		{"IMG_20240302_101500.jpg", true},
+		{"MVIMG_20240302_101500.jpg", true},
+		{"IMG-20240302-WA0001.jpg", true},
+		{"DSC_0042.NEF", true},
+		{"_DSC0042.ARW", true},
+		{"DSCF1234.RAF", true},
+		{"P1000123.JPG", true},
+		{"PXL_20240302_101500123.jpg", true},
+		{"PXL_20240302_101500123.MP.jpg", true},
+		{"GOPR0001.MP4", true},
+		{"DJI_0001.JPG", true},
+		{"20240302_101500.jpg", true},
+		{"IMG_1234 (1).JPG", true},
+		{"beach.jpg", false},
+		{"IMG_1234_edited.jpg", false},
+		{"my IMG_1234.jpg", false},
+		{"report.pdf", false},
+	}
+
+	for _, test := range testTable {
+		assert.Equal(t, test.Camera, isCameraFilename(test.Name), test.Name)
+	}
+}
+
+func TestFileWillBeUploadedAnonymizesFilenames(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("LogDebug", mock.AnythingOfType("string")).Maybe()
+	api.On("LogInfo", "Removed metadata from upload", "name", mock.AnythingOfType("string"), "user_id", "user", "summary", "ACM, GPS: no")
+	api.On("KVGet", mock.Anything).Return(nil, nil)
+	api.On("KVCompareAndSet", auditKey, []byte(nil), mock.Anything).Return(true, nil)
+	api.On("KVSetWithOptions", mock.MatchedBy(isAuditRecordsKey), mock.Anything, mock.Anything).Return(true, nil)
+	api.On("KVSetWithExpiry", mock.MatchedBy(isMarkerKey), mock.Anything, mock.Anything).Return(nil)
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.setConfiguration(&configuration{AnonymizeFilenames: true})
+
+	// Images are renamed as they are sanitized.
+	info, str := p.FileWillBeUploaded(nil, &model.FileInfo{Name: "IMG_1234.JPG", CreatorId: "user", MimeType: "image/jpeg", Extension: "jpg"}, bytes.NewReader(exifJPEG), new(bytes.Buffer))
+	if assert.NotNil(t, info) {
+		assert.Empty(t, str)
+		assert.Regexp(t, regexp.MustCompile(`^image-[a-z0-9]{11}\.JPG$`), info.Name)
+	}
+
+	// Files of other types are renamed too, and left unchanged.
+	output := new(bytes.Buffer)
+	info, str = p.FileWillBeUploaded(nil, &model.FileInfo{Name: "DSC_0042.NEF", CreatorId: "user", MimeType: "image/x-nikon-nef", Extension: "nef"}, bytes.NewReader([]byte("raw")), output)
+	if assert.NotNil(t, info) {
+		assert.Empty(t, str)
+		assert.Zero(t, output.Len())
+		assert.Regexp(t, regexp.MustCompile(`^image-[a-z0-9]{11}\.NEF$`), info.Name)
+	}
+
+	// Names chosen by users are kept.
+	info, _ = p.FileWillBeUploaded(nil, &model.FileInfo{Name: "notes.txt", CreatorId: "user", MimeType: "text/plain", Extension: "txt"}, bytes.NewReader([]byte("notes")), output)
+	assert.Nil(t, info)
+}
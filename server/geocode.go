@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+	"github.com/nimrodshn/mattermost-exif-plugin/exif/geocode"
+)
+
+// geocodeTimeout bounds how long naming the place of an upload may delay its notice, as uploads
+// are notified while they are being saved.
+const geocodeTimeout = 3 * time.Second
+
+// geocoder returns the resolver naming the places uploads were taken at: one querying the
+// GeocodingURL setting, or geocode.Nop if it is empty, so that coordinates are never sent
+// anywhere unless an admin chooses a service.
+func (c *configuration) geocoder() geocode.Resolver {
+	if c.GeocodingURL == "" {
+		return geocode.Nop{}
+	}
+	return &geocode.HTTPResolver{
+		URL:       c.GeocodingURL,
+		UserAgent: manifest.Id + "/" + manifest.Version,
+	}
+}
+
+// describe is summarize, followed by the place the image was taken at if the geocoder names it,
+// such as "iPhone 14 Pro, GPS: yes, taken 2024-03-02, near Berlin, DE". Failures to name the
+// place are logged, and the summary returned without it.
+func (p *Plugin) describe(report *exif.Report, config *configuration) string {
+	description := summarize(report)
+	if report.Summary == nil || report.Summary.Location == nil {
+		return description
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), geocodeTimeout)
+	defer cancel()
+	place, err := geocode.Place(ctx, config.geocoder(), report.Summary.Location)
+	if err != nil {
+		p.API.LogWarn("Failed to name the place an upload was taken at", "err", err.Error())
+		return description
+	}
+	if place == "" {
+		return description
+	}
+	return description + ", near " + place
+}
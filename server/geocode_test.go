@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDescribe(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Query().Get("lat") == "0.000000" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"address": {"city": "Berlin", "country_code": "de"}}`))
+	}))
+	defer server.Close()
+
+	located := &exif.Report{ExifRemoved: true, Summary: &exif.Summary{
+		Model:    "iPhone 14 Pro",
+		GPS:      true,
+		Location: &exif.Location{Latitude: 52.52, Longitude: 13.405},
+	}}
+	unlocated := &exif.Report{ExifRemoved: true, Summary: &exif.Summary{Model: "iPhone 14 Pro"}}
+
+	api := &plugintest.API{}
+	api.On("LogWarn", "Failed to name the place an upload was taken at", "err", mock.Anything).Once()
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	assert.Equal("iPhone 14 Pro, GPS: yes", p.describe(located, &configuration{}))
+	assert.Equal(0, requests, "coordinates must not be sent without a geocoding URL")
+
+	config := &configuration{GeocodingURL: server.URL + "/reverse"}
+	assert.Equal("iPhone 14 Pro, GPS: yes, near Berlin, DE", p.describe(located, config))
+	assert.Equal("iPhone 14 Pro, GPS: no", p.describe(unlocated, config))
+	assert.Equal(1, requests)
+
+	failing := &exif.Report{ExifRemoved: true, Summary: &exif.Summary{GPS: true, Location: &exif.Location{}}}
+	assert.Equal("GPS: yes", p.describe(failing, config))
+	api.AssertExpectations(t)
+}
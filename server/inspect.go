@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// The DeepInspection settings: off lets the uploads of other types than those processed through
+// unchanged, sanitize sniffs their content and sanitizes the images and videos among them, and
+// reject also refuses the files carrying images with metadata embedded in them.
+const (
+	inspectOff      = "off"
+	inspectSanitize = "sanitize"
+	inspectReject   = "reject"
+)
+
+// inspects returns whether the content of the uploads of other types than those processed is
+// inspected.
+func (c *configuration) inspects() bool {
+	return c.DeepInspection == inspectSanitize || c.DeepInspection == inspectReject
+}
+
+// sniffLength is how much of an upload of unknown type is read to tell its format.
+const sniffLength = 512
+
+// sniffUntyped returns whether an upload whose type Mattermost could not tell, such as a file
+// without an extension shared from a mobile app, is an image or a video of a processed format,
+// and the reader to read the upload from in place of file. Only the start of the upload is read,
+// so that untyped uploads are recognized whatever the DeepInspection setting.
+func (c *configuration) sniffUntyped(info *model.FileInfo, file io.Reader) (bool, io.Reader) {
+	mimeType := strings.ToLower(strings.TrimSpace(strings.SplitN(info.MimeType, ";", 2)[0]))
+	if mimeType != "" && mimeType != "application/octet-stream" {
+		return false, file
+	}
+	buffered := bufio.NewReaderSize(file, sniffLength)
+	header, _ := buffered.Peek(sniffLength)
+	format := exif.Detect(header)
+	return format != "" && c.processes(&model.FileInfo{MimeType: mimeTypes[format]}), buffered
+}
+
+// inspectUpload sniffs the content of an upload of a type not processed, whatever its name and
+// MIME type. A file that is an image or a video of a processed format, such as a photo renamed to
+// a .txt file, is sanitized. Other files are searched for embedded images carrying metadata,
+// which are logged, and rejected if the DeepInspection setting is reject.
+func (p *Plugin) inspectUpload(info *model.FileInfo, file io.Reader, output io.Writer, config *configuration) (*model.FileInfo, string) {
+	data, oversized, err := readUpload(file, config)
+	if err != nil {
+		return nil, reject(codeProcessingFailed, "An error occurred while trying to read the uploaded file: %v", err)
+	}
+	if oversized != nil {
+		// Files of other types cannot be searched for embedded images without being read into
+		// memory, so they are let through unless oversized uploads are rejected.
+		if config.OversizedUploads == oversizedReject {
+			return p.oversizedUpload(info, oversized, output, config)
+		}
+		p.API.LogDebug("Skipping inspection of upload exceeding the memory budget", "name", info.Name, "user_id", info.CreatorId)
+		return nil, ""
+	}
+
+	if format := exif.Detect(data); format != "" {
+		if config.processes(&model.FileInfo{MimeType: mimeTypes[format]}) {
+			p.API.LogInfo("Sanitizing upload whose content does not match its type", "name", info.Name, "user_id", info.CreatorId, "mime_type", info.MimeType, "format", format)
+			return p.discardExif(info, bytes.NewReader(data), output, config)
+		}
+		if format != "pdf" {
+			// The images and videos of the formats left out of ProcessedTypes are let through,
+			// but PDF documents may still embed images.
+			return nil, ""
+		}
+	}
+
+	carrying := 0
+	for _, embedded := range exif.FindEmbedded(data) {
+		if embedded.Metadata {
+			carrying++
+		}
+	}
+	if carrying == 0 {
+		return nil, ""
+	}
+	p.API.LogWarn("Found embedded images carrying metadata in upload", "name", info.Name, "user_id", info.CreatorId, "mime_type", info.MimeType, "images", carrying)
+	if config.DeepInspection != inspectReject {
+		return nil, ""
+	}
+	return nil, reject(codeEmbeddedMetadata, "The file contains images carrying metadata, such as the camera model or location they were taken at, and is not allowed on this server.")
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestInspectUploadSanitizesMisnamedImages(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("LogDebug", mock.AnythingOfType("string")).Maybe()
+	api.On("LogInfo", "Sanitizing upload whose content does not match its type", "name", "notes.txt", "user_id", "user", "mime_type", "text/plain", "format", "jpeg")
+	api.On("LogInfo", "Removed metadata from upload", "name", "notes.txt", "user_id", "user", "summary", "ACM, GPS: no")
+	api.On("KVGet", mock.Anything).Return(nil, nil)
+	api.On("KVCompareAndSet", auditKey, []byte(nil), mock.Anything).Return(true, nil)
+	api.On("KVSetWithOptions", mock.MatchedBy(isAuditRecordsKey), mock.Anything, mock.Anything).Return(true, nil)
+	api.On("KVSetWithExpiry", mock.MatchedBy(isMarkerKey), mock.Anything, mock.Anything).Return(nil)
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.setConfiguration(&configuration{DeepInspection: inspectSanitize})
+
+	output := new(bytes.Buffer)
+	info, rejection := p.FileWillBeUploaded(nil, &model.FileInfo{Name: "notes.txt", CreatorId: "user", MimeType: "text/plain", Extension: "txt"}, bytes.NewReader(exifJPEG), output)
+	assert.Equal(t, "", rejection)
+	if assert.NotNil(t, info) {
+		assert.Equal(t, "image/jpeg", info.MimeType)
+	}
+	assert.Equal(t, []byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02, 0x00, 0x00, 0xFF, 0xD9}, output.Bytes())
+}
+
+func TestInspectUploadEmbeddedImages(t *testing.T) {
+	document := append(append([]byte("%PDF-1.7\nstream\n"), exifJPEG...), "\nendstream\n"...)
+
+	testTable := []struct {
+		Mode     string
+		Data     []byte
+		Rejected bool
+	}{
+		{Mode: inspectSanitize, Data: document},
+		{Mode: inspectReject, Data: document, Rejected: true},
+		{Mode: inspectReject, Data: []byte("%PDF-1.7\nno images\n")},
+	}
+
+	for _, test := range testTable {
+		api := &plugintest.API{}
+		api.On("LogWarn", "Found embedded images carrying metadata in upload", "name", "report.pdf", "user_id", "user", "mime_type", "application/pdf", "images", 1)
+		if test.Rejected {
+			api.On("LogInfo", "Rejected upload", "name", "report.pdf", "user_id", "user", "code", codeEmbeddedMetadata, "rejection", mock.Anything).Once()
+		}
+		p := &Plugin{}
+		p.SetAPI(api)
+		p.setConfiguration(&configuration{DeepInspection: test.Mode})
+
+		output := new(bytes.Buffer)
+		info, rejection := p.FileWillBeUploaded(nil, &model.FileInfo{Name: "report.pdf", CreatorId: "user", MimeType: "application/pdf", Extension: "pdf"}, bytes.NewReader(test.Data), output)
+		assert.Nil(t, info)
+		assert.Equal(t, test.Rejected, rejection != "", test.Mode)
+		assert.Empty(t, output.Bytes())
+	}
+}
+
+func TestInspectUploadRespectsProcessedTypes(t *testing.T) {
+	p := &Plugin{}
+	p.setConfiguration(&configuration{ProcessedTypes: "image/png", DeepInspection: inspectReject})
+
+	output := new(bytes.Buffer)
+	info, rejection := p.FileWillBeUploaded(nil, &model.FileInfo{Name: "notes.txt", MimeType: "text/plain", Extension: "txt"}, bytes.NewReader(exifJPEG), output)
+	assert.Nil(t, info)
+	assert.Equal(t, "", rejection)
+	assert.Empty(t, output.Bytes())
+}
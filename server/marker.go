@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"time"
+)
+
+const (
+	// markerPrefix is the prefix of the keys of the markers of sanitized files in the plugin's
+	// key value store, which is followed by the SHA-256 of the file. The value of a marker is
+	// the fingerprint of the settings the file was sanitized with.
+	markerPrefix = "sanitized_"
+
+	// markerRetention is how long markers are kept.
+	markerRetention = 30 * 24 * time.Hour
+)
+
+// fingerprint returns a digest of the settings changing what is removed from files, so that
+// files sanitized with other settings are sanitized again.
+func (c *configuration) fingerprint() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%q %q %q %q %q %t %t %t %t",
+		c.MetadataProfile, c.C2PAPolicy, c.ICCPolicy, c.SegmentPolicy, c.PNGChunkPolicy, c.RemoveTrailingData, c.RegenerateJFIF, c.RemoveLivePhotoPairing, c.RemoveSVGScripts)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// markerKey returns the key of the marker of the file of the given SHA-256.
+func markerKey(sum []byte) string {
+	return markerPrefix + hex.EncodeToString(sum)
+}
+
+// alreadySanitized returns whether data is a file the plugin produced with the current settings,
+// such as a file uploaded again by another plugin, a retried upload or a file scanned again.
+func (p *Plugin) alreadySanitized(data []byte, config *configuration) bool {
+	sum := sha256.Sum256(data)
+	marker, appErr := p.API.KVGet(markerKey(sum[:]))
+	return appErr == nil && string(marker) == config.fingerprint()
+}
+
+// markSanitized records that the plugin produced the file of the SHA-256 computed by h with the
+// current settings.
+func (p *Plugin) markSanitized(h hash.Hash, config *configuration) {
+	if appErr := p.API.KVSetWithExpiry(markerKey(h.Sum(nil)), []byte(config.fingerprint()), int64(markerRetention/time.Second)); appErr != nil {
+		p.API.LogWarn("Failed to mark the file as sanitized", "err", appErr.Error())
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// preferenceCategory and preferenceNotifications identify the notification preference of
+	// users in the preferences API.
+	preferenceCategory      = "pp_mattermost-exif-plugin"
+	preferenceNotifications = "notifications"
+
+	// The notification preferences: a notice visible only to the uploader for each upload, a
+	// daily direct message, or none. Users without a preference get per-upload notices.
+	notifyPerUpload = "per-upload"
+	notifyDigest    = "digest"
+	notifyOff       = "off"
+
+	// digestKeyPrefix is the prefix of the keys of pending digests in the plugin's key value
+	// store, which is followed by the user id.
+	digestKeyPrefix = "digest_"
+
+	// digestInterval is how long notices are collected before a digest is sent, and
+	// maxDigestNotices is how many notices a digest lists.
+	digestInterval   = 24 * time.Hour
+	maxDigestNotices = 50
+)
+
+// notificationPreferences are the valid notification preferences.
+var notificationPreferences = []string{notifyPerUpload, notifyDigest, notifyOff}
+
+// digest is the notices pending for a user until they are sent in a daily direct message.
+type digest struct {
+	// Since is when the first notice of the digest was added, in milliseconds.
+	Since   int64    `json:"since"`
+	Notices []string `json:"notices"`
+
+	// Omitted is how many notices were not kept beyond maxDigestNotices.
+	Omitted int `json:"omitted"`
+}
+
+// sendDirectMessage posts message to userID in the direct channel with the plugin's bot.
+func (p *Plugin) sendDirectMessage(userID, message string) error {
+	channel, appErr := p.API.GetDirectChannel(userID, p.botID)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to get direct channel")
+	}
+
+	if _, appErr := p.API.CreatePost(&model.Post{
+		UserId:    p.botID,
+		ChannelId: channel.Id,
+		Message:   message,
+	}); appErr != nil {
+		return errors.Wrap(appErr, "failed to create post")
+	}
+	return nil
+}
+
+// notificationPreference returns the notification preference of userID.
+func (p *Plugin) notificationPreference(userID string) string {
+	preference, appErr := p.API.GetPreferenceForUser(userID, preferenceCategory, preferenceNotifications)
+	if appErr != nil || preference.Value == "" {
+		return notifyPerUpload
+	}
+	return preference.Value
+}
+
+// setNotificationPreference stores the notification preference of userID.
+func (p *Plugin) setNotificationPreference(userID, value string) error {
+	if appErr := p.API.UpdatePreferencesForUser(userID, []model.Preference{{
+		UserId:   userID,
+		Category: preferenceCategory,
+		Name:     preferenceNotifications,
+		Value:    value,
+	}}); appErr != nil {
+		return errors.Wrap(appErr, "failed to update preference")
+	}
+	return nil
+}
+
+// notify tells the uploader of a file about it, as their notification preference asks: with a
+// notice in the channel the file was uploaded to, only visible to them, in their next digest,
+// or not at all.
+func (p *Plugin) notify(info *model.FileInfo, message string) error {
+	switch p.notificationPreference(info.CreatorId) {
+	case notifyOff:
+		return nil
+	case notifyDigest:
+		return p.addToDigest(info.CreatorId, message, time.Now())
+	}
+
+	// Files uploaded outside of a channel can only be reported in a direct message.
+	if info.ChannelId == "" {
+		return p.sendDirectMessage(info.CreatorId, message)
+	}
+	p.API.SendEphemeralPost(info.CreatorId, &model.Post{
+		UserId:    p.botID,
+		ChannelId: info.ChannelId,
+		Message:   message,
+	})
+	return nil
+}
+
+// addToDigest adds message to the pending digest of userID, retrying if another server of the
+// cluster updates it concurrently.
+func (p *Plugin) addToDigest(userID, message string, now time.Time) error {
+	key := digestKeyPrefix + userID
+	for attempt := 0; attempt < maxAuditAttempts; attempt++ {
+		old, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to read the digest")
+		}
+		pending := &digest{Since: now.UnixMilli()}
+		if old != nil {
+			if err := json.Unmarshal(old, pending); err != nil {
+				return errors.Wrap(err, "failed to decode the digest")
+			}
+		}
+		if len(pending.Notices) < maxDigestNotices {
+			pending.Notices = append(pending.Notices, message)
+		} else {
+			pending.Omitted++
+		}
+
+		data, err := json.Marshal(pending)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode the digest")
+		}
+		ok, appErr := p.API.KVCompareAndSet(key, old, data)
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to write the digest")
+		}
+		if ok {
+			return nil
+		}
+	}
+	return errors.New("the digest kept changing while being updated")
+}
+
+// sendDigests sends the pending digests collected for at least digestInterval.
+func (p *Plugin) sendDigests(now time.Time) error {
+	const perPage = 100
+	var keys []string
+	for page := 0; ; page++ {
+		list, appErr := p.API.KVList(page, perPage)
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to list the digests")
+		}
+		for _, key := range list {
+			if strings.HasPrefix(key, digestKeyPrefix) {
+				keys = append(keys, key)
+			}
+		}
+		if len(list) < perPage {
+			break
+		}
+	}
+
+	for _, key := range keys {
+		if err := p.sendDigest(key, now); err != nil {
+			p.API.LogWarn("Failed to send digest", "key", key, "err", err.Error())
+		}
+	}
+	return nil
+}
+
+// sendDigest sends the digest stored at key if it is due. It is deleted first, so that only one
+// server of the cluster sends it.
+func (p *Plugin) sendDigest(key string, now time.Time) error {
+	data, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to read the digest")
+	}
+	if data == nil {
+		return nil
+	}
+	var pending digest
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return errors.Wrap(err, "failed to decode the digest")
+	}
+	if now.Sub(time.UnixMilli(pending.Since)) < digestInterval {
+		return nil
+	}
+
+	ok, appErr := p.API.KVCompareAndDelete(key, data)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to delete the digest")
+	}
+	if !ok {
+		return nil
+	}
+
+	lines := []string{"Metadata removed from your uploads since yesterday:"}
+	for _, notice := range pending.Notices {
+		lines = append(lines, "- "+notice)
+	}
+	if pending.Omitted > 0 {
+		lines = append(lines, fmt.Sprintf("- and %d more.", pending.Omitted))
+	}
+	return p.sendDirectMessage(strings.TrimPrefix(key, digestKeyPrefix), strings.Join(lines, "\n"))
+}
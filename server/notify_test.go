@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNotify(t *testing.T) {
+	testTable := []struct {
+		Name       string
+		Preference string
+		ChannelID  string
+		Expect     func(api *plugintest.API)
+	}{
+		{
+			Name:      "default",
+			ChannelID: "channel",
+			Expect: func(api *plugintest.API) {
+				api.On("SendEphemeralPost", "user", mock.MatchedBy(func(post *model.Post) bool {
+					return post.ChannelId == "channel" && post.Message == "notice"
+				})).Return(nil).Once()
+			},
+		},
+		{
+			Name:       "per-upload without channel",
+			Preference: notifyPerUpload,
+			Expect: func(api *plugintest.API) {
+				api.On("GetDirectChannel", "user", "bot").Return(&model.Channel{Id: "dm"}, nil)
+				api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+					return post.ChannelId == "dm" && post.Message == "notice"
+				})).Return(nil, nil).Once()
+			},
+		},
+		{
+			Name:       "digest",
+			Preference: notifyDigest,
+			ChannelID:  "channel",
+			Expect: func(api *plugintest.API) {
+				api.On("KVGet", digestKeyPrefix+"user").Return(nil, nil)
+				api.On("KVCompareAndSet", digestKeyPrefix+"user", []byte(nil), mock.MatchedBy(func(data []byte) bool {
+					var pending digest
+					return json.Unmarshal(data, &pending) == nil && len(pending.Notices) == 1 && pending.Notices[0] == "notice"
+				})).Return(true, nil).Once()
+			},
+		},
+		{Name: "off", Preference: notifyOff, ChannelID: "channel", Expect: func(api *plugintest.API) {}},
+	}
+
+	for _, test := range testTable {
+		api := &plugintest.API{}
+		if test.Preference == "" {
+			api.On("GetPreferenceForUser", "user", preferenceCategory, preferenceNotifications).
+				Return(model.Preference{}, model.NewAppError("GetPreferenceForUser", "not_found", nil, "", 404))
+		} else {
+			api.On("GetPreferenceForUser", "user", preferenceCategory, preferenceNotifications).
+				Return(model.Preference{Value: test.Preference}, nil)
+		}
+		test.Expect(api)
+		p := &Plugin{botID: "bot"}
+		p.SetAPI(api)
+
+		assert.Nil(t, p.notify(&model.FileInfo{CreatorId: "user", ChannelId: test.ChannelID}, "notice"), test.Name)
+		api.AssertExpectations(t)
+	}
+}
+
+func TestAddToDigestKeepsRecentNotices(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+	full := &digest{Since: now.Add(-time.Hour).UnixMilli()}
+	for i := 0; i < maxDigestNotices; i++ {
+		full.Notices = append(full.Notices, "old")
+	}
+	stored, _ := json.Marshal(full)
+
+	api := &plugintest.API{}
+	var written []byte
+	api.On("KVGet", digestKeyPrefix+"user").Return(stored, nil)
+	api.On("KVCompareAndSet", digestKeyPrefix+"user", stored, mock.Anything).Run(func(args mock.Arguments) {
+		written = args.Get(2).([]byte)
+	}).Return(true, nil)
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	assert.Nil(p.addToDigest("user", "new", now))
+
+	var pending digest
+	assert.Nil(json.Unmarshal(written, &pending))
+	assert.Equal(full.Since, pending.Since)
+	assert.Len(pending.Notices, maxDigestNotices)
+	assert.Equal(1, pending.Omitted)
+}
+
+func TestSendDigests(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+	due, _ := json.Marshal(&digest{Since: now.Add(-digestInterval).UnixMilli(), Notices: []string{"first", "second"}, Omitted: 3})
+	recent, _ := json.Marshal(&digest{Since: now.Add(-time.Hour).UnixMilli(), Notices: []string{"third"}})
+
+	api := &plugintest.API{}
+	api.On("KVList", 0, 100).Return([]string{auditKey, digestKeyPrefix + "due", digestKeyPrefix + "recent"}, nil)
+	api.On("KVGet", digestKeyPrefix+"due").Return(due, nil)
+	api.On("KVGet", digestKeyPrefix+"recent").Return(recent, nil)
+	api.On("KVCompareAndDelete", digestKeyPrefix+"due", due).Return(true, nil).Once()
+	api.On("GetDirectChannel", "due", "bot").Return(&model.Channel{Id: "dm"}, nil)
+	var message string
+	api.On("CreatePost", mock.Anything).Run(func(args mock.Arguments) {
+		message = args.Get(0).(*model.Post).Message
+	}).Return(nil, nil).Once()
+	p := &Plugin{botID: "bot"}
+	p.SetAPI(api)
+
+	assert.Nil(p.sendDigests(now))
+	assert.True(strings.Contains(message, "- first\n- second\n- and 3 more."), message)
+	api.AssertExpectations(t)
+	api.AssertNotCalled(t, "KVCompareAndDelete", digestKeyPrefix+"recent", mock.Anything)
+}
+
+func TestExecuteCommand(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("GetPreferenceForUser", "user", preferenceCategory, preferenceNotifications).Return(model.Preference{Value: notifyOff}, nil)
+	api.On("UpdatePreferencesForUser", "user", []model.Preference{{
+		UserId:   "user",
+		Category: preferenceCategory,
+		Name:     preferenceNotifications,
+		Value:    notifyDigest,
+	}}).Return(nil).Once()
+	api.On("UpdatePreferencesForUser", "broken", mock.Anything).Return(model.NewAppError("UpdatePreferencesForUser", "failed", nil, "", 500))
+	api.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	testTable := []struct {
+		Command string
+		UserID  string
+		Text    string
+	}{
+		{Command: "/exif", UserID: "user", Text: commandUsage},
+		{Command: "/exif notifications", UserID: "user", Text: "Your notifications are set to `off`."},
+		{Command: "/exif notifications digest", UserID: "user", Text: "Your notifications are now set to `digest`."},
+		{Command: "/exif notifications loud", UserID: "user", Text: "Unknown notification preference `loud`. Choose one of `per-upload`, `digest` or `off`."},
+		{Command: "/exif notifications off", UserID: "broken", Text: "Failed to save your notification preference."},
+	}
+
+	for _, test := range testTable {
+		response, appErr := p.ExecuteCommand(nil, &model.CommandArgs{Command: test.Command, UserId: test.UserID})
+		assert.Nil(t, appErr, test.Command)
+		assert.Equal(t, model.CommandResponseTypeEphemeral, response.ResponseType, test.Command)
+		assert.Equal(t, test.Text, response.Text, test.Command)
+	}
+	api.AssertExpectations(t)
+}
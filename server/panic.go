@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// The PanicPolicy settings, for the uploads the plugin panics on: reject them, which is the
+// default, or let them through unchanged.
+const (
+	panicFailClosed = "fail-closed"
+	panicFailOpen   = "fail-open"
+)
+
+// panicError is a panic recovered while processing an upload, with the stack it was raised from.
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
+// recoverUpload recovers from a panic processing the upload of info, deferred by
+// FileWillBeUploaded, so that a parser bug fails a single upload rather than the plugin. The panic
+// is logged with its stack and recorded in the audit log as a failure, and the upload handled
+// according to the PanicPolicy setting of config, through the results of the hook. An upload whose
+// sanitized copy was partly written to output is rejected whatever the policy, as the partial
+// copy would be stored in its place.
+func (p *Plugin) recoverUpload(info *model.FileInfo, output *countingWriter, config *configuration, replacement **model.FileInfo, rejection *string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	recovered, ok := r.(*panicError)
+	if !ok {
+		recovered = &panicError{value: r, stack: debug.Stack()}
+	}
+	p.API.LogError("Recovered from a panic while processing an upload", "name", info.Name, "user_id", info.CreatorId, "err", recovered.Error(), "stack", string(recovered.stack))
+	p.auditFailure(info, recovered)
+
+	*replacement = nil
+	if config.PanicPolicy == panicFailOpen && output.n == 0 {
+		*rejection = ""
+		return
+	}
+	*rejection = reject(codePanic, "An unexpected error occurred while processing the uploaded file.")
+}
+
+// recoverTo recovers from a panic in a goroutine, deferred by it, and sends it to done as a
+// *panicError, for the goroutine waiting for it to panic again with.
+func recoverTo(done chan<- error) {
+	if r := recover(); r != nil {
+		done <- &panicError{value: r, stack: debug.Stack()}
+	}
+}
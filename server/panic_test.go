@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestFileWillBeUploadedPanic(t *testing.T) {
+	testTable := []struct {
+		Name      string
+		Policy    string
+		Rejection string
+	}{
+		{Name: "default policy", Policy: "", Rejection: "EXIF011: An unexpected error occurred while processing the uploaded file."},
+		{Name: "fail closed", Policy: panicFailClosed, Rejection: "EXIF011: An unexpected error occurred while processing the uploaded file."},
+		{Name: "fail open", Policy: panicFailOpen},
+	}
+
+	for _, test := range testTable {
+		// Looking up the uploader panics, as a parser bug would.
+		p, api := newUploadTestPlugin(&configuration{BotUploads: uploadsSkip, PanicPolicy: test.Policy})
+		api.On("GetUser", "crash").Run(func(mock.Arguments) { panic("parser bug") }).Return(nil, nil)
+		info := &model.FileInfo{Name: "photo.jpg", Extension: "jpg", MimeType: "image/jpeg", CreatorId: "crash"}
+		output := new(bytes.Buffer)
+		replacement, rejection := p.FileWillBeUploaded(nil, info, bytes.NewReader(exifJPEG), output)
+		assert.Nil(t, replacement, test.Name)
+		assert.Equal(t, test.Rejection, rejection, test.Name)
+		assert.Zero(t, output.Len(), test.Name)
+		api.AssertCalled(t, "KVCompareAndSet", auditKey, []byte(nil), mock.Anything)
+		api.AssertCalled(t, "LogError", "Recovered from a panic while processing an upload", "name", "photo.jpg", "user_id", "crash", "err", "panic: parser bug", "stack", mock.Anything)
+	}
+}
+
+func TestRecoverUploadPartialOutput(t *testing.T) {
+	p, _ := newUploadTestPlugin(&configuration{PanicPolicy: panicFailOpen})
+	info := &model.FileInfo{Name: "photo.jpg", CreatorId: "user"}
+	output := &countingWriter{w: new(bytes.Buffer)}
+	replacement, rejection := func() (replacement *model.FileInfo, rejection string) {
+		defer p.recoverUpload(info, output, p.getConfiguration(), &replacement, &rejection)
+		output.Write(exifJPEG[:2])
+		panic("parser bug")
+	}()
+	// The partial copy would be stored in place of the upload, so it is rejected.
+	assert.Nil(t, replacement)
+	assert.Equal(t, "EXIF011: An unexpected error occurred while processing the uploaded file.", rejection)
+}
+
+func TestWithinTimeoutPanic(t *testing.T) {
+	defer func() {
+		recovered, ok := recover().(*panicError)
+		if assert.True(t, ok, "expected the panic of the work to be raised again") {
+			assert.Equal(t, "panic: parser bug", recovered.Error())
+			assert.Contains(t, string(recovered.stack), "TestWithinTimeoutPanic")
+		}
+	}()
+	withinTimeout(time.Second, func() error { panic("parser bug") }, nil)
+}
+
+func TestWithinTimeoutPanicAfterTimeout(t *testing.T) {
+	release := make(chan struct{})
+	err := withinTimeout(10*time.Millisecond, func() error {
+		<-release
+		panic("parser bug")
+	}, nil)
+	assert.True(t, errors.Is(err, errTimeout), err)
+	// The panic of the abandoned work does not crash the plugin.
+	close(release)
+	time.Sleep(10 * time.Millisecond)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// The permission levels of the plugin's commands and endpoints, from the configuration. Each
+// level includes the ones above it: system admins, for instance, can do anything team admins can.
+const (
+	// permissionAuthors lets the author of a post act on it, as well as users allowed to edit
+	// others' posts in its channel.
+	permissionAuthors = "authors"
+
+	// permissionChannelAdmins and permissionTeamAdmins require managing the channel of the post,
+	// or its team. Direct and group messages have no team, and only system admins manage them.
+	permissionChannelAdmins = "channel-admins"
+	permissionTeamAdmins    = "team-admins"
+
+	// permissionConsoleReaders lets users allowed to read the plugins section of the System
+	// Console, such as system managers and read-only admins, view the dashboard.
+	permissionConsoleReaders = "system-console-readers"
+
+	permissionSystemAdmins = "system-admins"
+)
+
+// canStrip returns whether userID may remove metadata from the attachments of post, according
+// to the StripPermission setting. Authors and users allowed to edit others' posts can by default.
+func (p *Plugin) canStrip(userID string, post *model.Post) bool {
+	switch p.getConfiguration().StripPermission {
+	case permissionSystemAdmins:
+		return p.API.HasPermissionTo(userID, model.PermissionManageSystem)
+	case permissionTeamAdmins:
+		channel, appErr := p.API.GetChannel(post.ChannelId)
+		if appErr != nil {
+			return false
+		}
+		if channel.TeamId == "" {
+			return p.API.HasPermissionTo(userID, model.PermissionManageSystem)
+		}
+		return p.API.HasPermissionToTeam(userID, channel.TeamId, model.PermissionManageTeam)
+	case permissionChannelAdmins:
+		return p.API.HasPermissionToChannel(userID, post.ChannelId, model.PermissionManageChannelRoles)
+	}
+	return post.UserId == userID || p.API.HasPermissionToChannel(userID, post.ChannelId, model.PermissionEditOthersPosts)
+}
+
+// canViewStats returns whether userID may view the audit log, according to the StatsPermission
+// setting. Only system admins can by default.
+func (p *Plugin) canViewStats(userID string) bool {
+	if p.getConfiguration().StatsPermission == permissionConsoleReaders {
+		return p.API.HasPermissionTo(userID, model.PermissionSysconsoleReadPlugins)
+	}
+	return p.API.HasPermissionTo(userID, model.PermissionManageSystem)
+}
+
+// canReadFile returns whether userID may read the stored file of info, as Mattermost allows
+// downloading it: system admins may read any file, and other users the files posted in channels
+// whose content they may read. Files not posted in any channel can only be read by system admins.
+func (p *Plugin) canReadFile(userID string, info *model.FileInfo) bool {
+	if p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+		return true
+	}
+	return info.ChannelId != "" && p.API.HasPermissionToChannel(userID, info.ChannelId, model.PermissionReadChannelContent)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanStrip(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("GetChannel", "channel").Return(&model.Channel{Id: "channel", TeamId: "team"}, nil)
+	api.On("GetChannel", "dm").Return(&model.Channel{Id: "dm"}, nil)
+	for _, userID := range []string{"author", "editor", "channel-admin", "team-admin", "admin"} {
+		api.On("HasPermissionTo", userID, model.PermissionManageSystem).Return(userID == "admin")
+		api.On("HasPermissionToTeam", userID, "team", model.PermissionManageTeam).Return(userID == "team-admin" || userID == "admin")
+		for _, channelID := range []string{"channel", "dm"} {
+			api.On("HasPermissionToChannel", userID, channelID, model.PermissionManageChannelRoles).Return(userID == "channel-admin" || userID == "team-admin" || userID == "admin")
+			api.On("HasPermissionToChannel", userID, channelID, model.PermissionEditOthersPosts).Return(userID != "author")
+		}
+	}
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	testTable := []struct {
+		Permission string
+		ChannelID  string
+		Allowed    []string
+	}{
+		{Permission: "", ChannelID: "channel", Allowed: []string{"author", "editor", "channel-admin", "team-admin", "admin"}},
+		{Permission: permissionChannelAdmins, ChannelID: "channel", Allowed: []string{"channel-admin", "team-admin", "admin"}},
+		{Permission: permissionTeamAdmins, ChannelID: "channel", Allowed: []string{"team-admin", "admin"}},
+		{Permission: permissionTeamAdmins, ChannelID: "dm", Allowed: []string{"admin"}},
+		{Permission: permissionSystemAdmins, ChannelID: "channel", Allowed: []string{"admin"}},
+	}
+
+	for _, test := range testTable {
+		p.setConfiguration(&configuration{StripPermission: test.Permission})
+		post := &model.Post{UserId: "author", ChannelId: test.ChannelID}
+		var allowed []string
+		for _, userID := range []string{"author", "editor", "channel-admin", "team-admin", "admin"} {
+			if p.canStrip(userID, post) {
+				allowed = append(allowed, userID)
+			}
+		}
+		assert.Equal(t, test.Allowed, allowed, test.Permission+" in "+test.ChannelID)
+	}
+}
+
+func TestCanViewStats(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("HasPermissionTo", "manager", model.PermissionManageSystem).Return(false)
+	api.On("HasPermissionTo", "manager", model.PermissionSysconsoleReadPlugins).Return(true)
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	assert.False(t, p.canViewStats("manager"))
+	p.setConfiguration(&configuration{StatsPermission: permissionConsoleReaders})
+	assert.True(t, p.canViewStats("manager"))
+}
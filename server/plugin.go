@@ -1,13 +1,20 @@
 package main
 
 import (
-	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/mattermost/mattermost-server/plugin"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
+	"github.com/pkg/errors"
 )
 
+// jobInterval is how often the background jobs check whether there is work due.
+const jobInterval = time.Hour
+
 type Plugin struct {
 	plugin.MattermostPlugin
 
@@ -17,10 +24,104 @@ type Plugin struct {
 	// configuration is the active plugin configuration. Consult getConfiguration and
 	// setConfiguration for usage.
 	configuration *configuration
+
+	// botID is the user id of the plugin's bot account, used to post messages from the plugin.
+	botID string
+
+	// router serves the plugin's HTTP endpoints. It is built on first use by ServeHTTP.
+	router     *http.ServeMux
+	routerOnce sync.Once
+
+	// stopJobs stops the background jobs started by OnActivate.
+	stopJobs chan struct{}
+
+	// auditQueue holds the audit writes waiting for the background writer started by OnActivate,
+	// and auditDropped counts those dropped as the queue was full.
+	auditQueue   chan func()
+	auditDropped atomic.Int64
+
+	// scanJob is the scheduled scan, if any. It is rescheduled when the configuration changes.
+	scanJob     *cluster.Job
+	scanJobLock sync.Mutex
+}
+
+// OnActivate is invoked when the plugin is activated. It ensures the plugin's bot account exists,
+// registers the /exif command and starts the background jobs sending digests and telemetry,
+// writing the audit log, and the scheduled scan, and logs the build of the plugin.
+func (p *Plugin) OnActivate() error {
+	botID, err := p.API.EnsureBotUser(&model.Bot{
+		Username:    "exif",
+		DisplayName: "EXIF Remover",
+		Description: "Removes EXIF metadata from uploaded images.",
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to ensure bot account")
+	}
+	p.botID = botID
+
+	if err := p.API.RegisterCommand(command()); err != nil {
+		return errors.Wrap(err, "failed to register command")
+	}
+
+	p.stopJobs = make(chan struct{})
+	go p.runJobs(p.stopJobs)
+	p.auditQueue = make(chan func(), auditQueueSize)
+	go p.runAuditWriter(p.auditQueue, p.stopJobs)
+	p.scheduleScan()
+
+	version := buildVersion()
+	p.API.LogInfo("Activated EXIF Remover", "version", version.Version, "commit", version.Commit, "build_date", version.BuildDate)
+	return nil
+}
+
+// OnDeactivate is invoked when the plugin is deactivated. It stops the background jobs.
+func (p *Plugin) OnDeactivate() error {
+	if p.stopJobs != nil {
+		close(p.stopJobs)
+	}
+
+	p.scanJobLock.Lock()
+	defer p.scanJobLock.Unlock()
+	if p.scanJob != nil {
+		p.scanJob.Close()
+		p.scanJob = nil
+	}
+	return nil
+}
+
+// runJobs checks every jobInterval whether digests or telemetry are due, until stop is closed.
+func (p *Plugin) runJobs(stop <-chan struct{}) {
+	ticker := time.NewTicker(jobInterval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		if err := p.sendDigests(now); err != nil {
+			p.API.LogWarn("Failed to send digests", "err", err.Error())
+		}
+		if err := p.sendTelemetry(now); err != nil {
+			p.API.LogWarn("Failed to send telemetry", "err", err.Error())
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
 }
 
 func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "Hello, world!")
+	p.routerOnce.Do(p.initRouter)
+	p.router.ServeHTTP(w, r)
+}
+
+func (p *Plugin) initRouter() {
+	p.router = http.NewServeMux()
+	p.router.HandleFunc("POST /api/v1/posts/{post_id}/strip", p.handleStripPost)
+	p.router.HandleFunc("GET /api/v1/stats", p.handleStats)
+	p.router.HandleFunc("GET /api/v1/audit/export", p.handleExportAudit)
+	p.router.HandleFunc("GET /api/v1/files/{file_id}/trace", p.handleTrace)
+	p.router.HandleFunc("POST /api/v1/profile", p.handleProfile)
+	p.router.HandleFunc("GET /api/v1/health", p.handleHealth)
 }
 
 // See https://developers.mattermost.com/extend/plugins/server/reference/
@@ -1,26 +1,55 @@
 package main
 
 import (
-	"io/ioutil"
+	"encoding/json"
+	"net/http"
 	"net/http/httptest"
+	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestServeHTTP(t *testing.T) {
-	assert := assert.New(t)
+	testTable := []struct {
+		Method string
+		Path   string
+		Status int
+	}{
+		{Method: "GET", Path: "/", Status: http.StatusNotFound},
+		{Method: "GET", Path: "/api/v1/unknown", Status: http.StatusNotFound},
+		{Method: "POST", Path: "/api/v1/stats", Status: http.StatusMethodNotAllowed},
+	}
+
+	for _, test := range testTable {
+		plugin := Plugin{}
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(test.Method, test.Path, nil)
+
+		plugin.ServeHTTP(nil, w, r)
+
+		assert.Equal(t, test.Status, w.Code, test.Method+" "+test.Path)
+	}
+}
+
+func TestHandleHealth(t *testing.T) {
 	plugin := Plugin{}
 	w := httptest.NewRecorder()
-	r := httptest.NewRequest("GET", "/", nil)
+	plugin.ServeHTTP(nil, w, httptest.NewRequest("GET", "/api/v1/health", nil))
 
-	plugin.ServeHTTP(nil, w, r)
+	var health map[string]string
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &health))
+	assert.Equal(t, "ok", health["status"])
+	assert.Equal(t, manifest.Version, health["version"])
+	assert.NotEmpty(t, health["commit"])
+	assert.NotEmpty(t, health["build_date"])
+}
 
-	result := w.Result()
-	assert.NotNil(result)
-	bodyBytes, err := ioutil.ReadAll(result.Body)
-	assert.Nil(err)
-	bodyString := string(bodyBytes)
+func TestBuildVersion(t *testing.T) {
+	defer func(commit, date string) { buildCommit, buildDate = commit, date }(buildCommit, buildDate)
+	buildCommit, buildDate = "1a2b3c4", "2024-03-01T12:00:00Z"
 
-	assert.Equal("Hello, world!", bodyString)
+	version := buildVersion()
+	assert.Equal(t, manifest.Version+" (commit 1a2b3c4, built 2024-03-01T12:00:00Z, "+runtime.Version()+")", version.String())
 }
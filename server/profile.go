@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+const (
+	// defaultProfileIterations is how many times the profile endpoint sanitizes the sample unless
+	// told otherwise, and maxProfileIterations how many times it may.
+	defaultProfileIterations = 100
+	maxProfileIterations     = 10000
+
+	// maxProfileSample is the size of the largest sample the profile endpoint accepts.
+	maxProfileSample = 100 << 20
+)
+
+// handleProfile sanitizes the sample posted as the request body as many times as the iterations
+// parameter asks, with the current settings, and replies with a CPU profile of the run, or a heap
+// profile with profile=heap, for go tool pprof. The number of iterations and the time they took
+// are returned in the X-Sanitize-Iterations and X-Sanitize-Duration headers, so that operators
+// can size their servers before enabling the plugin widely. Only system admins may run it, as it
+// keeps a CPU busy.
+func (p *Plugin) handleProfile(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+	if !p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+		http.Error(w, "You do not have permission to profile the plugin", http.StatusForbidden)
+		return
+	}
+
+	iterations := defaultProfileIterations
+	if value := r.URL.Query().Get("iterations"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxProfileIterations {
+			http.Error(w, fmt.Sprintf("The iterations must be a number from 1 to %d", maxProfileIterations), http.StatusBadRequest)
+			return
+		}
+		iterations = n
+	}
+	kind := r.URL.Query().Get("profile")
+	if kind == "" {
+		kind = "cpu"
+	}
+	if kind != "cpu" && kind != "heap" {
+		http.Error(w, "The profile must be cpu or heap", http.StatusBadRequest)
+		return
+	}
+
+	sample, err := ioutil.ReadAll(io.LimitReader(r.Body, maxProfileSample+1))
+	if err != nil {
+		http.Error(w, "Failed to read the sample", http.StatusBadRequest)
+		return
+	}
+	if len(sample) == 0 || len(sample) > maxProfileSample {
+		http.Error(w, fmt.Sprintf("Post a sample file of at most %d bytes", maxProfileSample), http.StatusBadRequest)
+		return
+	}
+
+	profile := new(bytes.Buffer)
+	if kind == "cpu" {
+		if err := pprof.StartCPUProfile(profile); err != nil {
+			http.Error(w, "Another CPU profile is running", http.StatusConflict)
+			return
+		}
+	}
+	duration, err := sanitizeRepeatedly(sample, iterations, p.getConfiguration().sanitizeOptions())
+	if kind == "cpu" {
+		pprof.StopCPUProfile()
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to sanitize the sample: %v", err), http.StatusBadRequest)
+		return
+	}
+	if kind == "heap" {
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(profile); err != nil {
+			http.Error(w, "Failed to write the heap profile", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	p.API.LogInfo("Profiled the sanitizer", "user_id", userID, "profile", kind, "iterations", iterations, "sample_size", len(sample), "duration", duration.String())
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=exif-%s.pprof", kind))
+	w.Header().Set("X-Sanitize-Iterations", strconv.Itoa(iterations))
+	w.Header().Set("X-Sanitize-Duration", duration.String())
+	w.Write(profile.Bytes())
+}
+
+// sanitizeRepeatedly sanitizes sample the given number of times with opts, and returns how long
+// it took.
+func sanitizeRepeatedly(sample []byte, iterations int, opts []exif.Option) (time.Duration, error) {
+	start := time.Now()
+	for i := 0; i < iterations; i++ {
+		if _, err := exif.Sanitize(bytes.NewReader(sample), ioutil.Discard, opts...); err != nil {
+			return 0, err
+		}
+	}
+	return time.Since(start), nil
+}
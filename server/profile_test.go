@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHandleProfile(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+	api.On("HasPermissionTo", "user", model.PermissionManageSystem).Return(false)
+	api.On("LogInfo", "Profiled the sanitizer", "user_id", "admin", "profile", mock.Anything, "iterations", 5, "sample_size", len(exifJPEG), "duration", mock.Anything)
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.setConfiguration(&configuration{})
+
+	testTable := []struct {
+		Name   string
+		UserID string
+		Query  string
+		Sample []byte
+		Status int
+	}{
+		{Name: "anonymous", UserID: "", Sample: exifJPEG, Status: http.StatusUnauthorized},
+		{Name: "user", UserID: "user", Sample: exifJPEG, Status: http.StatusForbidden},
+		{Name: "no sample", UserID: "admin", Status: http.StatusBadRequest},
+		{Name: "too many iterations", UserID: "admin", Query: "?iterations=100000", Sample: exifJPEG, Status: http.StatusBadRequest},
+		{Name: "unknown profile", UserID: "admin", Query: "?profile=mutex", Sample: exifJPEG, Status: http.StatusBadRequest},
+		{Name: "invalid sample", UserID: "admin", Query: "?iterations=5", Sample: []byte("not an image"), Status: http.StatusBadRequest},
+		{Name: "cpu", UserID: "admin", Query: "?iterations=5", Sample: exifJPEG, Status: http.StatusOK},
+		{Name: "heap", UserID: "admin", Query: "?iterations=5&profile=heap", Sample: exifJPEG, Status: http.StatusOK},
+	}
+
+	for _, test := range testTable {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/v1/profile"+test.Query, bytes.NewReader(test.Sample))
+		if test.UserID != "" {
+			r.Header.Set("Mattermost-User-Id", test.UserID)
+		}
+		p.ServeHTTP(nil, w, r)
+		assert.Equal(t, test.Status, w.Code, test.Name)
+		if test.Status == http.StatusOK {
+			assert.Equal(t, "5", w.Header().Get("X-Sanitize-Iterations"), test.Name)
+			assert.NotEmpty(t, w.Header().Get("X-Sanitize-Duration"), test.Name)
+			// Profiles are gzipped protocol buffers.
+			assert.True(t, bytes.HasPrefix(w.Body.Bytes(), []byte{0x1F, 0x8B}), test.Name)
+		}
+	}
+}
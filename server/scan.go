@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+	"github.com/pkg/errors"
+)
+
+const (
+	// scanJobKey is the key of the scheduled scan in the cluster job scheduler, and scanKey the
+	// key of the time the last scan started, in milliseconds, in the plugin's key value store.
+	scanJobKey = "scan"
+	scanKey    = "scan_last"
+
+	// defaultScanWindow is how far back the first scan looks.
+	defaultScanWindow = 24 * time.Hour
+
+	// maxScanFindings is how many findings the report of a scan lists.
+	maxScanFindings = 50
+
+	// scanBatchSize is how many files a scan lists at once, and defaultScanPause how long it
+	// pauses between batches unless the data retention settings say otherwise, so that scans
+	// coexist with the data retention jobs without thrashing the file store.
+	scanBatchSize    = 100
+	defaultScanPause = time.Second
+
+	// retentionMargin is how long before the data retention horizon files are skipped, so that
+	// scans do not read files about to be deleted.
+	retentionMargin = 24 * time.Hour
+)
+
+// scanResult is the outcome of a scan of the files uploaded since a given time.
+type scanResult struct {
+	Since    time.Time
+	Scanned  int
+	Findings []string
+
+	// Skipped is how many files were skipped as past the data retention horizon.
+	Skipped int
+
+	// Omitted is how many findings were not kept beyond maxScanFindings.
+	Omitted int
+}
+
+// scheduleScan schedules the recurring scan according to the ScanSchedule setting, replacing
+// any scheduled before. An empty schedule disables it.
+func (p *Plugin) scheduleScan() {
+	p.scanJobLock.Lock()
+	defer p.scanJobLock.Unlock()
+
+	if p.scanJob != nil {
+		p.scanJob.Close()
+		p.scanJob = nil
+	}
+
+	expr := p.getConfiguration().ScanSchedule
+	if strings.TrimSpace(expr) == "" {
+		return
+	}
+	schedule, err := parseCron(expr)
+	if err != nil {
+		p.API.LogError("Invalid scan schedule, scheduled scans are disabled", "schedule", expr, "err", err.Error())
+		return
+	}
+	job, err := cluster.Schedule(p.API, scanJobKey, waitForSchedule(schedule), p.runScan)
+	if err != nil {
+		p.API.LogError("Failed to schedule scans", "err", err.Error())
+		return
+	}
+	p.scanJob = job
+}
+
+// runScan scans the files uploaded since the previous scan and posts the findings to the
+// channel of the ScanChannel setting. It is run by one server of the cluster at a time.
+func (p *Plugin) runScan() {
+	now := time.Now()
+	since := now.Add(-defaultScanWindow)
+	if data, appErr := p.API.KVGet(scanKey); appErr == nil && data != nil {
+		if millis, err := strconv.ParseInt(string(data), 10, 64); err == nil {
+			since = time.UnixMilli(millis)
+		}
+	}
+
+	// The scan and its findings follow the settings current when it started.
+	config := p.getConfiguration()
+	result, err := p.scan(since, now, config)
+	if err != nil {
+		p.API.LogError("Failed to scan recent uploads", "err", err.Error())
+		return
+	}
+	if appErr := p.API.KVSet(scanKey, []byte(strconv.FormatInt(now.UnixMilli(), 10))); appErr != nil {
+		p.API.LogWarn("Failed to record the time of the scan", "err", appErr.Error())
+	}
+	if err := p.postScanResult(result, config); err != nil {
+		p.API.LogError("Failed to post the scan findings", "err", err.Error())
+	}
+}
+
+// retentionHorizon returns the time before which files are deleted by the data retention
+// settings of the server, along with the posts they are attached to, or the zero time if none
+// are. It also returns the pause between batches of the data retention jobs.
+func (p *Plugin) retentionHorizon(now time.Time) (time.Time, time.Duration) {
+	config := p.API.GetConfig()
+	if config == nil {
+		return time.Time{}, defaultScanPause
+	}
+	settings := config.DataRetentionSettings
+
+	pause := defaultScanPause
+	if settings.TimeBetweenBatchesMilliseconds != nil && *settings.TimeBetweenBatchesMilliseconds > 0 {
+		pause = time.Duration(*settings.TimeBetweenBatchesMilliseconds) * time.Millisecond
+	}
+
+	var retention time.Duration
+	shortest := func(enabled *bool, hours, days *int) {
+		if enabled == nil || !*enabled {
+			return
+		}
+		var d time.Duration
+		if hours != nil && *hours > 0 {
+			d = time.Duration(*hours) * time.Hour
+		} else if days != nil && *days > 0 {
+			d = time.Duration(*days) * 24 * time.Hour
+		}
+		if d > 0 && (retention == 0 || d < retention) {
+			retention = d
+		}
+	}
+	shortest(settings.EnableFileDeletion, settings.FileRetentionHours, settings.FileRetentionDays)
+	shortest(settings.EnableMessageDeletion, settings.MessageRetentionHours, settings.MessageRetentionDays)
+	if retention == 0 {
+		return time.Time{}, pause
+	}
+	return now.Add(-retention), pause
+}
+
+// scan checks the images and videos uploaded since the given time to the teams of the ScanTeams
+// setting, or all teams, and finds those carrying metadata the current settings remove, such as
+// files uploaded before the plugin was enabled. Files close to the data retention horizon are
+// skipped, and files are listed in batches paced like the data retention jobs.
+func (p *Plugin) scan(since, now time.Time, config *configuration) (*scanResult, error) {
+	horizon, pause := p.retentionHorizon(now)
+	if !horizon.IsZero() {
+		horizon = horizon.Add(retentionMargin)
+	}
+	teams := make(map[string]bool)
+	for _, name := range strings.Split(config.ScanTeams, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		team, appErr := p.API.GetTeamByName(name)
+		if appErr != nil {
+			return nil, errors.Wrapf(appErr, "failed to get team %s", name)
+		}
+		teams[team.Id] = true
+	}
+
+	result := &scanResult{Since: since}
+	channelTeams := make(map[string]string)
+	for page := 0; ; page++ {
+		if page > 0 {
+			time.Sleep(pause)
+		}
+		infos, appErr := p.API.GetFileInfos(page, scanBatchSize, &model.GetFileInfosOptions{Since: since.UnixMilli()})
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "failed to list files")
+		}
+		for _, info := range infos {
+			if !config.processes(info) {
+				continue
+			}
+			if info.CreateAt < horizon.UnixMilli() {
+				result.Skipped++
+				continue
+			}
+			if len(teams) > 0 {
+				teamID, ok := channelTeams[info.ChannelId]
+				if !ok {
+					if channel, appErr := p.API.GetChannel(info.ChannelId); appErr == nil {
+						teamID = channel.TeamId
+					}
+					channelTeams[info.ChannelId] = teamID
+				}
+				if !teams[teamID] {
+					continue
+				}
+			}
+
+			finding, err := p.scanFile(info, config)
+			if err != nil {
+				p.API.LogWarn("Skipping file that could not be scanned", "file_id", info.Id, "err", err.Error())
+				continue
+			}
+			result.Scanned++
+			if finding == "" {
+				continue
+			}
+			if len(result.Findings) < maxScanFindings {
+				result.Findings = append(result.Findings, finding)
+			} else {
+				result.Omitted++
+			}
+		}
+		if len(infos) < scanBatchSize {
+			break
+		}
+	}
+	if result.Skipped > 0 {
+		p.API.LogInfo("Skipped files past the data retention horizon", "skipped", result.Skipped, "horizon", horizon.String())
+	}
+	return result, nil
+}
+
+// scanFile returns a description of the metadata the current settings would remove from the
+// file, or an empty string if there is none.
+func (p *Plugin) scanFile(info *model.FileInfo, config *configuration) (string, error) {
+	data, appErr := p.API.GetFile(info.Id)
+	if appErr != nil {
+		return "", errors.Wrap(appErr, "failed to read file")
+	}
+	if p.alreadySanitized(data, config) {
+		return "", nil
+	}
+	report, err := exif.SanitizeBytes(data, ioutil.Discard, p.sanitizeOptions(config, exif.Detect(data))...)
+	if err != nil {
+		return "", err
+	}
+	if report.BytesRemoved == 0 && !report.ExifEdited {
+		return "", nil
+	}
+
+	uploader := info.CreatorId
+	if user, appErr := p.API.GetUser(info.CreatorId); appErr == nil {
+		uploader = "@" + user.Username
+	}
+	return fmt.Sprintf("`%s` uploaded by %s: %s", info.Name, uploader, p.describe(report, config)), nil
+}
+
+// postScanResult posts the findings of a scan to the channel of the ScanChannel setting, given as
+// team-name/channel-name.
+func (p *Plugin) postScanResult(result *scanResult, config *configuration) error {
+	target := config.ScanChannel
+	parts := strings.SplitN(target, "/", 2)
+	if len(parts) != 2 {
+		return errors.Errorf("invalid scan channel %q, expected team-name/channel-name", target)
+	}
+	channel, appErr := p.API.GetChannelByNameForTeamName(parts[0], parts[1], false)
+	if appErr != nil {
+		return errors.Wrapf(appErr, "failed to get channel %s", target)
+	}
+
+	found := len(result.Findings) + result.Omitted
+	lines := []string{fmt.Sprintf("Scheduled scan: %d of the %d files uploaded since %s still carry metadata.",
+		found, result.Scanned, result.Since.UTC().Format("2006-01-02 15:04 MST"))}
+	for _, finding := range result.Findings {
+		lines = append(lines, "- "+finding)
+	}
+	if result.Omitted > 0 {
+		lines = append(lines, fmt.Sprintf("- and %d more.", result.Omitted))
+	}
+	if result.Skipped > 0 {
+		lines = append(lines, fmt.Sprintf("Skipped %d older files about to be deleted by the data retention policy.", result.Skipped))
+	}
+
+	if _, appErr := p.API.CreatePost(&model.Post{
+		UserId:    p.botID,
+		ChannelId: channel.Id,
+		Message:   strings.Join(lines, "\n"),
+	}); appErr != nil {
+		return errors.Wrap(appErr, "failed to create post")
+	}
+	return nil
+}
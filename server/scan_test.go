@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRunScan(t *testing.T) {
+	assert := assert.New(t)
+	since := time.Date(2024, 3, 1, 6, 0, 0, 0, time.UTC)
+	clean := []byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02, 0x00, 0x00, 0xFF, 0xD9}
+	recent := time.Now().Add(-time.Hour).UnixMilli()
+	expired := time.Now().Add(-30*24*time.Hour - time.Hour).UnixMilli()
+	config := &model.Config{}
+	config.SetDefaults()
+	*config.DataRetentionSettings.EnableFileDeletion = true
+	*config.DataRetentionSettings.FileRetentionHours = 31 * 24
+
+	api := &plugintest.API{}
+	api.On("LogDebug", mock.AnythingOfType("string")).Maybe()
+	api.On("KVGet", scanKey).Return([]byte("1709272800000"), nil)
+	api.On("KVSet", scanKey, mock.Anything).Return(nil)
+	api.On("GetConfig").Return(config)
+	api.On("LogInfo", "Skipped files past the data retention horizon", "skipped", 1, "horizon", mock.Anything).Once()
+	api.On("GetTeamByName", "design").Return(&model.Team{Id: "design"}, nil)
+	api.On("GetFileInfos", 0, 100, &model.GetFileInfosOptions{Since: since.UnixMilli()}).Return([]*model.FileInfo{
+		// Files within a day of the retention horizon are skipped too.
+		{Id: "expired", Name: "old.jpg", MimeType: "image/jpeg", ChannelId: "design-channel", CreatorId: "user", CreateAt: expired},
+		{Id: "beach", Name: "beach.jpg", MimeType: "image/jpeg", ChannelId: "design-channel", CreatorId: "user", CreateAt: recent},
+		{Id: "clean", Name: "clean.jpg", MimeType: "image/jpeg", ChannelId: "design-channel", CreatorId: "user", CreateAt: recent},
+		{Id: "notes", Name: "notes.txt", MimeType: "text/plain", ChannelId: "design-channel", CreatorId: "user", CreateAt: recent},
+		{Id: "other", Name: "other.jpg", MimeType: "image/jpeg", ChannelId: "sales-channel", CreatorId: "user", CreateAt: recent},
+	}, nil)
+	api.On("GetChannel", "design-channel").Return(&model.Channel{Id: "design-channel", TeamId: "design"}, nil).Once()
+	api.On("GetChannel", "sales-channel").Return(&model.Channel{Id: "sales-channel", TeamId: "sales"}, nil).Once()
+	api.On("KVGet", mock.MatchedBy(isMarkerKey)).Return(nil, nil)
+	api.On("GetFile", "beach").Return(exifJPEG, nil)
+	api.On("GetFile", "clean").Return(clean, nil)
+	api.On("GetUser", "user").Return(&model.User{Username: "jane"}, nil)
+	api.On("GetChannelByNameForTeamName", "admins", "town-square", false).Return(&model.Channel{Id: "admins-channel"}, nil)
+	var message string
+	api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.ChannelId == "admins-channel" && post.UserId == "bot"
+	})).Run(func(args mock.Arguments) {
+		message = args.Get(0).(*model.Post).Message
+	}).Return(nil, nil).Once()
+	p := &Plugin{botID: "bot"}
+	p.SetAPI(api)
+	p.setConfiguration(&configuration{ScanTeams: " design ", ScanChannel: "admins/town-square"})
+
+	p.runScan()
+
+	assert.Equal(strings.Join([]string{
+		"Scheduled scan: 1 of the 2 files uploaded since 2024-03-01 06:00 UTC still carry metadata.",
+		"- `beach.jpg` uploaded by @jane: ACM, GPS: no",
+		"Skipped 1 older files about to be deleted by the data retention policy.",
+	}, "\n"), message)
+	api.AssertExpectations(t)
+	api.AssertNotCalled(t, "GetFile", "other")
+	api.AssertNotCalled(t, "GetFile", "expired")
+}
+
+func TestRetentionHorizon(t *testing.T) {
+	now := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+	config := &model.Config{}
+	config.SetDefaults()
+	api := &plugintest.API{}
+	api.On("GetConfig").Return(config)
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	horizon, pause := p.retentionHorizon(now)
+	assert.True(t, horizon.IsZero())
+	assert.Equal(t, time.Duration(*config.DataRetentionSettings.TimeBetweenBatchesMilliseconds)*time.Millisecond, pause)
+
+	// The shortest retention of files and messages applies, as files go with their posts.
+	*config.DataRetentionSettings.EnableFileDeletion = true
+	*config.DataRetentionSettings.FileRetentionHours = 0
+	*config.DataRetentionSettings.FileRetentionDays = 90
+	*config.DataRetentionSettings.EnableMessageDeletion = true
+	*config.DataRetentionSettings.MessageRetentionHours = 30 * 24
+	horizon, _ = p.retentionHorizon(now)
+	assert.Equal(t, now.AddDate(0, 0, -30), horizon)
+}
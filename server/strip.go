@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+// stripResult is the response of the strip post endpoint.
+type stripResult struct {
+	Stripped int `json:"stripped"`
+}
+
+// handleStripPost removes metadata from the attachments of an existing post, for cleaning up
+// files posted before the plugin was enabled. It is invoked from the post menu action.
+func (p *Plugin) handleStripPost(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	post, appErr := p.API.GetPost(r.PathValue("post_id"))
+	if appErr != nil {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+
+	if !p.canStrip(userID, post) {
+		http.Error(w, "You do not have permission to remove metadata from this post", http.StatusForbidden)
+		return
+	}
+
+	stripped, err := p.stripPost(post, "")
+	if err != nil {
+		p.API.LogError("Failed to remove metadata from post attachments", "post_id", post.Id, "err", err.Error())
+		http.Error(w, "Failed to remove metadata from attachments", http.StatusInternalServerError)
+		return
+	}
+
+	p.API.SendEphemeralPost(userID, &model.Post{
+		UserId:    p.botID,
+		ChannelId: post.ChannelId,
+		RootId:    post.RootId,
+		Message:   fmt.Sprintf("Removed metadata from %d of %d attachments.", stripped, len(post.FileIds)),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stripResult{Stripped: stripped})
+}
+
+// stripPost replaces every attachment of post carrying metadata with a sanitized copy and returns
+// how many were replaced. If only is not empty, only that attachment is considered. Attachments
+// are sanitized as uploads are, by DiscardExif, so that the same types are processed with the same
+// settings; those it leaves unchanged or rejects are skipped. The plugin API cannot overwrite or
+// delete stored files, so the sanitized copies are uploaded as new files and the originals are
+// detached from the post.
+func (p *Plugin) stripPost(post *model.Post, only string) (int, error) {
+	config := p.getConfiguration()
+	fileIDs := make([]string, len(post.FileIds))
+	stripped := 0
+	for i, fileID := range post.FileIds {
+		fileIDs[i] = fileID
+		if only != "" && fileID != only {
+			continue
+		}
+
+		info, appErr := p.API.GetFileInfo(fileID)
+		if appErr != nil {
+			return 0, errors.Wrapf(appErr, "failed to get file info for %s", fileID)
+		}
+		if !config.processes(info) {
+			continue
+		}
+
+		data, appErr := p.API.GetFile(fileID)
+		if appErr != nil {
+			return 0, errors.Wrapf(appErr, "failed to read file %s", fileID)
+		}
+
+		output := new(bytes.Buffer)
+		replacement, rejection := p.discardExif(info, bytes.NewReader(data), output, config)
+		if rejection != "" {
+			p.API.LogWarn("Skipping attachment that could not be sanitized", "file_id", fileID, "rejection", rejection)
+			continue
+		}
+		if replacement == nil || bytes.Equal(output.Bytes(), data) {
+			continue
+		}
+
+		sanitized, appErr := p.API.UploadFile(output.Bytes(), post.ChannelId, info.Name)
+		if appErr != nil {
+			return 0, errors.Wrapf(appErr, "failed to upload sanitized copy of %s", fileID)
+		}
+		fileIDs[i] = sanitized.Id
+		stripped++
+	}
+
+	if stripped == 0 {
+		return 0, nil
+	}
+
+	post.FileIds = fileIDs
+	if _, appErr := p.API.UpdatePost(post); appErr != nil {
+		return 0, errors.Wrap(appErr, "failed to update post")
+	}
+
+	return stripped, nil
+}
+
+var (
+	// permalinkPattern matches post permalinks, such as https://chat.example.com/team/pl/<post id>.
+	permalinkPattern = regexp.MustCompile(`/pl/([a-z0-9]{26})\b`)
+
+	// fileLinkPattern matches links to files, such as the public links
+	// https://chat.example.com/files/<file id>/public?h=... and the API paths
+	// /api/v4/files/<file id>/preview.
+	fileLinkPattern = regexp.MustCompile(`/files/([a-z0-9]{26})\b`)
+)
+
+// executeStrip removes metadata from the attachments of the post whose permalink is given, or
+// from the single file linked to, if the user is allowed to.
+func (p *Plugin) executeStrip(args *model.CommandArgs, params []string) *model.CommandResponse {
+	if len(params) != 1 {
+		return ephemeralResponse("Usage: `/exif strip <post permalink or file link>`")
+	}
+
+	var postID, fileID string
+	if match := permalinkPattern.FindStringSubmatch(params[0]); match != nil {
+		postID = match[1]
+	} else if match := fileLinkPattern.FindStringSubmatch(params[0]); match != nil {
+		fileID = match[1]
+		info, appErr := p.API.GetFileInfo(fileID)
+		if appErr != nil || info.PostId == "" {
+			return ephemeralResponse("The file was not found in any post.")
+		}
+		postID = info.PostId
+	} else {
+		return ephemeralResponse("Give the permalink of a post, or a link to one of its files.")
+	}
+
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil {
+		return ephemeralResponse("The post was not found.")
+	}
+	if !p.canStrip(args.UserId, post) {
+		return ephemeralResponse("You do not have permission to remove metadata from this post.")
+	}
+
+	stripped, err := p.stripPost(post, fileID)
+	if err != nil {
+		p.API.LogError("Failed to remove metadata from post attachments", "post_id", post.Id, "err", err.Error())
+		return ephemeralResponse("Failed to remove metadata from the attachments.")
+	}
+	if fileID != "" {
+		if stripped == 0 {
+			return ephemeralResponse("No metadata was found to remove from the file.")
+		}
+		return ephemeralResponse("Removed metadata from the file. The post now links to a sanitized copy.")
+	}
+	return ephemeralResponse(fmt.Sprintf("Removed metadata from %d of %d attachments.", stripped, len(post.FileIds)))
+}
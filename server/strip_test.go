@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestExecuteStrip(t *testing.T) {
+	postID := strings.Repeat("p", 26)
+	photoID := strings.Repeat("f", 26)
+	screenshotID := strings.Repeat("s", 26)
+	otherID := strings.Repeat("o", 26)
+	post := func() *model.Post {
+		return &model.Post{Id: postID, UserId: "author", ChannelId: "channel", FileIds: []string{photoID, screenshotID, otherID}}
+	}
+
+	// Attachments are sanitized as uploads are, with the same settings and formats.
+	p, api := newUploadTestPlugin(&configuration{})
+	// Each command gets a fresh copy, as stripping updates the attachments of the post.
+	api.On("GetPost", postID).Return(func(string) *model.Post { return post() }, nil)
+	api.On("GetPost", mock.Anything).Return(nil, model.NewAppError("GetPost", "not_found", nil, "", 404))
+	api.On("GetFileInfo", photoID).Return(&model.FileInfo{Id: photoID, PostId: postID, Name: "beach.jpg", MimeType: "image/jpeg"}, nil)
+	api.On("GetFileInfo", screenshotID).Return(&model.FileInfo{Id: screenshotID, PostId: postID, Name: "screen.png", MimeType: "image/png"}, nil)
+	api.On("GetFileInfo", otherID).Return(&model.FileInfo{Id: otherID, PostId: postID, Name: "notes.txt", MimeType: "text/plain"}, nil)
+	api.On("GetFile", photoID).Return(exifJPEG, nil)
+	api.On("GetFile", screenshotID).Return(exifPNG, nil)
+	api.On("UploadFile", mock.Anything, "channel", "beach.jpg").Return(&model.FileInfo{Id: "sanitized"}, nil)
+	api.On("UploadFile", mock.Anything, "channel", "screen.png").Return(&model.FileInfo{Id: "sanitized screenshot"}, nil)
+	api.On("UpdatePost", mock.Anything).Return(nil, nil)
+	api.On("HasPermissionToChannel", "moderator", "channel", model.PermissionEditOthersPosts).Return(true)
+	api.On("HasPermissionToChannel", "user", "channel", model.PermissionEditOthersPosts).Return(false)
+
+	testTable := []struct {
+		Name    string
+		UserID  string
+		Command string
+		Text    string
+	}{
+		{Name: "no link", UserID: "author", Command: "/exif strip", Text: "Usage: `/exif strip <post permalink or file link>`"},
+		{Name: "unknown link", UserID: "author", Command: "/exif strip https://example.com/", Text: "Give the permalink of a post, or a link to one of its files."},
+		{Name: "unknown post", UserID: "author", Command: "/exif strip https://chat.example.com/team/pl/" + strings.Repeat("x", 26), Text: "The post was not found."},
+		{Name: "not allowed", UserID: "user", Command: "/exif strip https://chat.example.com/team/pl/" + postID, Text: "You do not have permission to remove metadata from this post."},
+		{Name: "author", UserID: "author", Command: "/exif strip https://chat.example.com/team/pl/" + postID, Text: "Removed metadata from 2 of 3 attachments."},
+		{Name: "moderator", UserID: "moderator", Command: "/exif strip https://chat.example.com/files/" + photoID + "/public?h=hash", Text: "Removed metadata from the file. The post now links to a sanitized copy."},
+		{Name: "file without metadata", UserID: "author", Command: "/exif strip https://chat.example.com/api/v4/files/" + otherID + "/preview", Text: "No metadata was found to remove from the file."},
+	}
+
+	for _, test := range testTable {
+		response, appErr := p.ExecuteCommand(nil, &model.CommandArgs{Command: test.Command, UserId: test.UserID})
+		assert.Nil(t, appErr, test.Name)
+		assert.Equal(t, model.CommandResponseTypeEphemeral, response.ResponseType, test.Name)
+		assert.Equal(t, test.Text, response.Text, test.Name)
+	}
+
+	api.AssertCalled(t, "UpdatePost", mock.MatchedBy(func(updated *model.Post) bool {
+		return updated.FileIds[0] == "sanitized" && updated.FileIds[1] == "sanitized screenshot" && updated.FileIds[2] == otherID
+	}))
+	api.AssertCalled(t, "UploadFile", mock.MatchedBy(func(data []byte) bool {
+		return bytes.HasPrefix(data, []byte("\x89PNG")) && !bytes.Contains(data, []byte("Secret"))
+	}), "channel", "screen.png")
+	api.AssertNumberOfCalls(t, "UploadFile", 3)
+}
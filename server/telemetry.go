@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// telemetryKey is the key of the time telemetry was last sent, in milliseconds, in the
+	// plugin's key value store. It is shared by the servers of a cluster, so that only one of
+	// them sends each report.
+	telemetryKey = "telemetry_last_sent"
+
+	// telemetryInterval is how often telemetry is sent.
+	telemetryInterval = 24 * time.Hour
+)
+
+// telemetryClient sends telemetry reports.
+var telemetryClient = &http.Client{Timeout: 10 * time.Second}
+
+// telemetryReport is the anonymous usage report sent when telemetry is enabled. It only holds
+// aggregate counts and versions: never file contents, names, users or metadata values.
+type telemetryReport struct {
+	PluginVersion string           `json:"plugin_version"`
+	ServerVersion string           `json:"server_version"`
+	Processed     int64            `json:"processed"`
+	ByFormat      map[string]int64 `json:"by_format"`
+	Failures      int64            `json:"failures"`
+	ErrorRate     float64          `json:"error_rate"`
+}
+
+// newTelemetryReport returns the usage report of the counts of the audit log.
+func (p *Plugin) newTelemetryReport() (*telemetryReport, error) {
+	audit, _, err := p.getAuditLog()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &telemetryReport{
+		PluginVersion: manifest.Version,
+		ServerVersion: p.API.GetServerVersion(),
+		Processed:     audit.Processed,
+		ByFormat:      audit.ByFormat,
+		Failures:      audit.Failures,
+	}
+	if total := audit.Processed + audit.Failures; total > 0 {
+		report.ErrorRate = float64(audit.Failures) / float64(total)
+	}
+	return report, nil
+}
+
+// sendTelemetry sends the usage report if telemetry is enabled and no server of the cluster
+// sent one in the last telemetryInterval.
+func (p *Plugin) sendTelemetry(now time.Time) error {
+	config := p.getConfiguration()
+	if !config.EnableTelemetry || config.TelemetryEndpoint == "" {
+		return nil
+	}
+
+	last, appErr := p.API.KVGet(telemetryKey)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to read the time telemetry was last sent")
+	}
+	if last != nil {
+		millis, err := strconv.ParseInt(string(last), 10, 64)
+		if err == nil && now.Sub(time.UnixMilli(millis)) < telemetryInterval {
+			return nil
+		}
+	}
+	// Claim this report, unless another server of the cluster just did.
+	ok, appErr := p.API.KVCompareAndSet(telemetryKey, last, []byte(strconv.FormatInt(now.UnixMilli(), 10)))
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to record the time telemetry was sent")
+	}
+	if !ok {
+		return nil
+	}
+
+	report, err := p.newTelemetryReport()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode the telemetry report")
+	}
+	resp, err := telemetryClient.Post(config.TelemetryEndpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to send the telemetry report")
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.Errorf("the telemetry endpoint responded with %s", resp.Status)
+	}
+	return nil
+}
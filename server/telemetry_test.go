@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSendTelemetry(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+	stored, _ := json.Marshal(&auditLog{
+		Processed:   3,
+		ByFormat:    map[string]int64{"jpeg": 2, "png": 1},
+		GPSDetected: 1,
+		Failures:    1,
+		RecentGPS:   []auditEvent{{FileName: "beach.jpg", UserID: "user", Detail: "iPhone 14 Pro, GPS: yes"}},
+	})
+
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	testTable := []struct {
+		Name     string
+		Config   *configuration
+		LastSent []byte
+		Sent     bool
+	}{
+		{Name: "disabled", Config: &configuration{TelemetryEndpoint: server.URL}},
+		{Name: "no endpoint", Config: &configuration{EnableTelemetry: true}},
+		{
+			Name:     "sent recently",
+			Config:   &configuration{EnableTelemetry: true, TelemetryEndpoint: server.URL},
+			LastSent: []byte(strconv.FormatInt(now.Add(-time.Hour).UnixMilli(), 10)),
+		},
+		{Name: "first", Config: &configuration{EnableTelemetry: true, TelemetryEndpoint: server.URL}, Sent: true},
+		{
+			Name:     "due",
+			Config:   &configuration{EnableTelemetry: true, TelemetryEndpoint: server.URL},
+			LastSent: []byte(strconv.FormatInt(now.Add(-telemetryInterval).UnixMilli(), 10)),
+			Sent:     true,
+		},
+	}
+
+	for _, test := range testTable {
+		body = nil
+		api := &plugintest.API{}
+		api.On("KVGet", telemetryKey).Return(test.LastSent, nil)
+		api.On("KVCompareAndSet", telemetryKey, test.LastSent, mock.Anything).Return(true, nil)
+		api.On("KVGet", auditKey).Return(stored, nil)
+		api.On("GetServerVersion").Return("9.5.0")
+		p := &Plugin{}
+		p.SetAPI(api)
+		p.setConfiguration(test.Config)
+
+		assert.Nil(p.sendTelemetry(now), test.Name)
+		if !test.Sent {
+			assert.Nil(body, test.Name)
+			api.AssertNotCalled(t, "KVCompareAndSet", telemetryKey, test.LastSent, mock.Anything)
+			continue
+		}
+
+		var report map[string]interface{}
+		assert.Nil(json.Unmarshal(body, &report), test.Name)
+		assert.Equal(map[string]interface{}{
+			"plugin_version": manifest.Version,
+			"server_version": "9.5.0",
+			"processed":      float64(3),
+			"by_format":      map[string]interface{}{"jpeg": float64(2), "png": float64(1)},
+			"failures":       float64(1),
+			"error_rate":     0.25,
+		}, report, test.Name)
+		assert.NotContains(string(body), "beach.jpg", test.Name)
+	}
+}
+
+func TestSendTelemetryOnce(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer server.Close()
+
+	// Another server of the cluster sends the report first.
+	api := &plugintest.API{}
+	api.On("KVGet", telemetryKey).Return(nil, nil)
+	api.On("KVCompareAndSet", telemetryKey, []byte(nil), mock.Anything).Return(false, nil)
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.setConfiguration(&configuration{EnableTelemetry: true, TelemetryEndpoint: server.URL})
+
+	assert.Nil(t, p.sendTelemetry(time.Now()))
+	assert.Equal(t, 0, calls)
+}
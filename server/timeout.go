@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	// PNG images are decoded to be re-encoded, along with JPEG and GIF images.
+	_ "image/png"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+	"github.com/pkg/errors"
+)
+
+// The TimeoutFallback settings, for the uploads whose sanitization exceeds the processing
+// timeout: let them through unchanged, reject them, which is the default, or decode and encode
+// them again with naiveDiscardExif.
+const (
+	timeoutPassThrough = "pass-through"
+	timeoutReject      = "reject"
+	timeoutReencode    = "re-encode"
+)
+
+// errTimeout is returned by withinTimeout when the work it waits for exceeds the timeout.
+var errTimeout = errors.New("processing timed out")
+
+// errTimeoutWriting is returned by withinTimeout in place of errTimeout when the work already
+// wrote part of its output once the timeout elapsed.
+var errTimeoutWriting = fmt.Errorf("%w while writing", errTimeout)
+
+// processingTimeout returns how long sanitizing an upload may take, according to the
+// ProcessingTimeout setting, in seconds, or 0 if there is no limit.
+func (c *configuration) processingTimeout() time.Duration {
+	if c.ProcessingTimeout <= 0 {
+		return 0
+	}
+	return time.Duration(c.ProcessingTimeout) * time.Second
+}
+
+// withinTimeout runs work, and returns its error, or errTimeout if it is still running once
+// timeout elapsed. The work cannot be interrupted: it carries on in the background, and its
+// outcome is ignored. If abandon is not nil, it is called once the timeout elapsed to keep the
+// work from writing anything more to what the caller keeps using, and reports whether nothing was
+// written; errTimeoutWriting is returned if something was. A panic of the work is raised again by
+// withinTimeout if it occurs while it is waited for.
+func withinTimeout(timeout time.Duration, work func() error, abandon func() bool) error {
+	if timeout <= 0 {
+		return work()
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer recoverTo(done)
+		done <- work()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return raisePanic(err)
+	case <-timer.C:
+		if abandon != nil && !abandon() {
+			return errors.Wrapf(errTimeoutWriting, "still sanitizing after %s", timeout)
+		}
+		return errors.Wrapf(errTimeout, "still sanitizing after %s", timeout)
+	}
+}
+
+// raisePanic panics again with err if it is a panic recovered by recoverTo, for the hook to
+// recover from, and returns it otherwise.
+func raisePanic(err error) error {
+	if recovered, ok := err.(*panicError); ok {
+		panic(recovered)
+	}
+	return err
+}
+
+// deadlineWriter writes to w until the sanitization writing through it is abandoned by
+// withinTimeout, and fails with errTimeout from then on.
+type deadlineWriter struct {
+	w io.Writer
+
+	mu        sync.Mutex
+	started   bool
+	abandoned bool
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.abandoned {
+		return 0, errTimeout
+	}
+	d.started = true
+	return d.w.Write(p)
+}
+
+// abandon keeps anything from being written to w from now on, once the write in progress if any
+// returned, and reports whether nothing was written.
+func (d *deadlineWriter) abandon() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.abandoned = true
+	return !d.started
+}
+
+// sanitizeWithinTimeout sanitizes data to output, like exif.SanitizeBytes, unless it exceeds the
+// processing timeout, in which case errTimeout is returned. The upload is held in memory once, as
+// data, and the sanitized copy is written straight to output rather than buffered a second time.
+// The timeout bounds the writing too: errTimeoutWriting is returned if it elapses once part of the
+// copy was written, and nothing more is written to output.
+func (p *Plugin) sanitizeWithinTimeout(data []byte, output io.Writer, config *configuration) (*exif.Report, error) {
+	timeout := config.processingTimeout()
+	if timeout == 0 {
+		return exif.SanitizeBytes(data, output, p.sanitizeOptions(config, exif.Detect(data))...)
+	}
+
+	var report *exif.Report
+	writer := &deadlineWriter{w: output}
+	err := withinTimeout(timeout, func() error {
+		var err error
+		report, err = exif.SanitizeBytes(data, writer, p.sanitizeOptions(config, exif.Detect(data))...)
+		return err
+	}, writer.abandon)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// timedOutUpload handles an upload whose sanitization exceeded the processing timeout, according to
+// the TimeoutFallback setting, or rejects it if part of its copy was already written. The timeout
+// is recorded in the audit log as a failure, whatever the fallback.
+func (p *Plugin) timedOutUpload(info *model.FileInfo, data []byte, output io.Writer, config *configuration, timeout error) (*model.FileInfo, string) {
+	p.auditFailure(info, timeout)
+	if errors.Is(timeout, errTimeoutWriting) {
+		// Part of the copy was written to output, so that the upload can only be rejected.
+		p.API.LogWarn("Rejected upload whose processing timed out while writing", "name", info.Name, "user_id", info.CreatorId, "err", timeout.Error())
+		return nil, reject(codeTimeout, "The file took longer than %d seconds to process, and is not allowed on this server.", config.ProcessingTimeout)
+	}
+	switch config.TimeoutFallback {
+	case timeoutPassThrough:
+		p.API.LogWarn("Passing through upload whose processing timed out", "name", info.Name, "user_id", info.CreatorId, "err", timeout.Error())
+		return nil, ""
+	case timeoutReencode:
+		p.API.LogWarn("Re-encoding upload whose processing timed out", "name", info.Name, "user_id", info.CreatorId, "err", timeout.Error())
+		return p.naiveDiscardExif(info, bytes.NewReader(data), output)
+	}
+	p.API.LogWarn("Rejected upload whose processing timed out", "name", info.Name, "user_id", info.CreatorId, "err", timeout.Error())
+	return nil, reject(codeTimeout, "The file took longer than %d seconds to process, and is not allowed on this server.", config.ProcessingTimeout)
+}
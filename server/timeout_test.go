@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestWithinTimeout(t *testing.T) {
+	failure := errors.New("failure")
+	assert.Equal(t, failure, withinTimeout(time.Second, func() error { return failure }, nil))
+	assert.NoError(t, withinTimeout(0, func() error { return nil }, nil))
+
+	release := make(chan struct{})
+	defer close(release)
+	err := withinTimeout(10*time.Millisecond, func() error {
+		<-release
+		return nil
+	}, nil)
+	assert.True(t, errors.Is(err, errTimeout), err)
+}
+
+func TestTimedOutUpload(t *testing.T) {
+	testTable := []struct {
+		Name      string
+		Fallback  string
+		Input     []byte
+		MimeType  string
+		Rejection string
+	}{
+		{Name: "default fallback", Fallback: "", Input: exifPNG, Rejection: "EXIF004: The file took longer than 5 seconds to process, and is not allowed on this server."},
+		{Name: "rejected", Fallback: timeoutReject, Input: exifPNG, Rejection: "EXIF004: The file took longer than 5 seconds to process, and is not allowed on this server."},
+		{Name: "passed through", Fallback: timeoutPassThrough, Input: exifPNG},
+		{Name: "re-encoded", Fallback: timeoutReencode, Input: exifPNG, MimeType: "image/jpeg"},
+	}
+
+	for _, test := range testTable {
+		config := &configuration{ProcessingTimeout: 5, TimeoutFallback: test.Fallback}
+		p, api := newUploadTestPlugin(config)
+		info := &model.FileInfo{Name: "photo.png", Extension: "png", MimeType: "image/png", CreatorId: "user"}
+		output := new(bytes.Buffer)
+		replacement, rejection := p.timedOutUpload(info, test.Input, output, config, errTimeout)
+		assert.Equal(t, test.Rejection, rejection, test.Name)
+		// The timeout is recorded in the audit log whatever the fallback.
+		api.AssertCalled(t, "KVCompareAndSet", auditKey, []byte(nil), mock.Anything)
+		if test.MimeType == "" {
+			assert.Nil(t, replacement, test.Name)
+			assert.Zero(t, output.Len(), test.Name)
+			continue
+		}
+		if assert.NotNil(t, replacement, test.Name) {
+			assert.Equal(t, test.MimeType, replacement.MimeType, test.Name)
+			assert.Equal(t, int64(output.Len()), replacement.Size, test.Name)
+			assert.NotContains(t, output.String(), "Secret", test.Name)
+		}
+	}
+}
+
+func TestFileWillBeUploadedWithinTimeout(t *testing.T) {
+	p, _ := newUploadTestPlugin(&configuration{ProcessingTimeout: 10})
+	output := new(bytes.Buffer)
+	info, rejection := p.FileWillBeUploaded(nil, &model.FileInfo{Name: "photo.jpg", Extension: "jpg", MimeType: "image/jpeg", CreatorId: "user"}, bytes.NewReader(exifJPEG), output)
+	assert.Empty(t, rejection)
+	if assert.NotNil(t, info) {
+		assert.Equal(t, int64(output.Len()), info.Size)
+		assert.NotContains(t, output.String(), "ACM")
+	}
+}
+
+func TestWithinTimeoutWriting(t *testing.T) {
+	// Work that started writing is kept from writing anything more once the timeout elapsed.
+	output := new(bytes.Buffer)
+	writer := &deadlineWriter{w: output}
+	written := make(chan error)
+	err := withinTimeout(10*time.Millisecond, func() error {
+		writer.Write([]byte("sanitized"))
+		time.Sleep(50 * time.Millisecond)
+		_, err := writer.Write([]byte(" copy"))
+		written <- err
+		return err
+	}, writer.abandon)
+	assert.True(t, errors.Is(err, errTimeoutWriting), err)
+	assert.True(t, errors.Is(err, errTimeout), err)
+	assert.True(t, errors.Is(<-written, errTimeout))
+	assert.Equal(t, "sanitized", output.String())
+
+	// Work that did not is abandoned, and cannot write anymore.
+	output.Reset()
+	writer = &deadlineWriter{w: output}
+	err = withinTimeout(10*time.Millisecond, func() error {
+		time.Sleep(50 * time.Millisecond)
+		_, err := writer.Write([]byte("sanitized copy"))
+		written <- err
+		return err
+	}, writer.abandon)
+	assert.True(t, errors.Is(err, errTimeout), err)
+	assert.False(t, errors.Is(err, errTimeoutWriting), err)
+	assert.True(t, errors.Is(<-written, errTimeout))
+	assert.Zero(t, output.Len())
+}
+
+func TestTimedOutUploadWriting(t *testing.T) {
+	// An upload whose copy was partly written is rejected, whatever the fallback.
+	for _, fallback := range []string{timeoutPassThrough, timeoutReencode} {
+		config := &configuration{ProcessingTimeout: 5, TimeoutFallback: fallback}
+		p, _ := newUploadTestPlugin(config)
+		info := &model.FileInfo{Name: "photo.png", Extension: "png", MimeType: "image/png", CreatorId: "user"}
+		replacement, rejection := p.timedOutUpload(info, exifPNG, new(bytes.Buffer), config, errTimeoutWriting)
+		assert.Nil(t, replacement, fallback)
+		assert.Equal(t, "EXIF004: The file took longer than 5 seconds to process, and is not allowed on this server.", rejection, fallback)
+	}
+}
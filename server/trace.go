@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// traceLogger records the diagnostics of the exif package, and the decisions of the plugin, for
+// a trace.
+type traceLogger struct {
+	lines []string
+}
+
+func (t *traceLogger) Printf(format string, v ...interface{}) {
+	t.lines = append(t.lines, fmt.Sprintf(format, v...))
+}
+
+// handleTrace replies with a trace of what the plugin does with a stored file with the current
+// settings, to the users allowed to view the dashboard who may also read the file: the decisions
+// taken before sanitizing it, and the segments found and removed or kept. It troubleshoots files that were not sanitized as
+// expected. The file is only read; the sanitized copy is discarded.
+func (p *Plugin) handleTrace(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+	if !p.canViewStats(userID) {
+		http.Error(w, "You do not have permission to trace files", http.StatusForbidden)
+		return
+	}
+
+	info, appErr := p.API.GetFileInfo(r.PathValue("file_id"))
+	if appErr != nil || !p.canReadFile(userID, info) {
+		// Files the user may not read are not told apart from missing ones.
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	data, appErr := p.API.GetFile(info.Id)
+	if appErr != nil {
+		p.API.LogError("Failed to read file to trace", "file_id", info.Id, "err", appErr.Error())
+		http.Error(w, "Failed to read the file", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, strings.Join(p.traceFile(info, data, p.getConfiguration()), "\n"))
+}
+
+// traceFile returns the trace of what the plugin does with the file of the given info and content
+// with the given settings, following the decisions of FileWillBeUploaded.
+func (p *Plugin) traceFile(info *model.FileInfo, data []byte, config *configuration) []string {
+	trace := &traceLogger{}
+	trace.Printf("File %q, %s, %d bytes, uploaded by %s", info.Name, info.MimeType, len(data), info.CreatorId)
+
+	if config.AnonymizeFilenames && isCameraFilename(info.Name) {
+		trace.Printf("The name is a camera default, and is anonymized unless uploads from the uploader are skipped")
+	}
+
+	processed := config.processes(info)
+	sniffed := false
+	if !processed && !config.inspects() {
+		sniffed, _ = config.sniffUntyped(info, bytes.NewReader(data))
+	}
+	switch {
+	case processed:
+		trace.Printf("Uploads of this type are processed")
+	case sniffed:
+		processed = true
+		trace.Printf("The type of the upload is unknown, and its content is of a processed format")
+	case config.inspects():
+		trace.Printf("Uploads of this type are not processed, but their content is inspected, as DeepInspection is %s", config.DeepInspection)
+	default:
+		trace.Printf("Uploads of this type are not processed, and let through unchanged")
+		return trace.lines
+	}
+
+	kind, policy := p.uploadPolicy(info, config)
+	trace.Printf("Uploads from %ss are set to %s", kind, policy)
+	if policy != uploadsSanitize {
+		return trace.lines
+	}
+
+	format := exif.Detect(data)
+	if format == "" {
+		trace.Printf("The content is not in a supported format")
+	} else {
+		trace.Printf("The content is in the %s format", format)
+	}
+	if !processed && (format == "" || !config.processes(&model.FileInfo{MimeType: mimeTypes[format]})) {
+		if format == "" || format == "pdf" {
+			trace.Printf("The content is only searched for embedded images carrying metadata")
+		} else {
+			trace.Printf("Files of this format are not processed, and let through unchanged")
+		}
+		return trace.lines
+	}
+	typ := format
+	if isRawUpload(info) {
+		typ = rawType
+	}
+	if action := config.typeAction(typ); action != typeStrip {
+		trace.Printf("Uploads of the %s type are set to %s", typ, action)
+		return trace.lines
+	}
+	if p.alreadySanitized(data, config) {
+		trace.Printf("The file was already sanitized with the current settings, and is left unchanged")
+		return trace.lines
+	}
+	if exif.MetadataFree(data) {
+		trace.Printf("Files of this format cannot carry metadata, and are let through unchanged")
+		return trace.lines
+	}
+	if config.prefilters() && exif.NoMetadata(data) {
+		trace.Printf("The pre-filter found no metadata in the file, which is let through unchanged")
+		return trace.lines
+	}
+
+	report, err := exif.SanitizeBytes(data, ioutil.Discard, append(config.sanitizeOptions(), exif.WithLogger(trace))...)
+	if err != nil {
+		trace.Printf("Sanitizing failed, and the upload would be rejected: %v", err)
+		return trace.lines
+	}
+	trace.Printf("Sanitized: %s, %d bytes removed", summarize(report), report.BytesRemoved)
+	return trace.lines
+}
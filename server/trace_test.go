@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHandleTrace(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+	api.On("HasPermissionTo", "user", model.PermissionManageSystem).Return(false)
+	api.On("HasPermissionTo", "admin", model.PermissionSysconsoleReadPlugins).Return(true)
+	api.On("HasPermissionTo", "user", model.PermissionSysconsoleReadPlugins).Return(false)
+	// A console reader, allowed to view the dashboard, who is only a member of the channel of the
+	// photo.
+	api.On("HasPermissionTo", "reader", model.PermissionSysconsoleReadPlugins).Return(true)
+	api.On("HasPermissionTo", "reader", model.PermissionManageSystem).Return(false)
+	api.On("HasPermissionToChannel", "reader", "channel", model.PermissionReadChannelContent).Return(true)
+	api.On("HasPermissionToChannel", "reader", "private", model.PermissionReadChannelContent).Return(false)
+	api.On("GetFileInfo", "photo").Return(&model.FileInfo{Id: "photo", ChannelId: "channel", Name: "beach.jpg", MimeType: "image/jpeg", CreatorId: "user"}, nil)
+	api.On("GetFileInfo", "private").Return(&model.FileInfo{Id: "private", ChannelId: "private", Name: "beach.jpg", MimeType: "image/jpeg", CreatorId: "user"}, nil)
+	api.On("GetFileInfo", "unposted").Return(&model.FileInfo{Id: "unposted", Name: "beach.jpg", MimeType: "image/jpeg", CreatorId: "user"}, nil)
+	api.On("GetFileInfo", "missing").Return(nil, model.NewAppError("GetFileInfo", "not_found", nil, "", http.StatusNotFound))
+	api.On("GetFile", "photo").Return(exifJPEG, nil)
+	api.On("KVGet", mock.MatchedBy(isMarkerKey)).Return(nil, nil)
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.setConfiguration(&configuration{StatsPermission: permissionConsoleReaders})
+
+	testTable := []struct {
+		Name   string
+		UserID string
+		FileID string
+		Status int
+	}{
+		{Name: "anonymous", UserID: "", FileID: "photo", Status: http.StatusUnauthorized},
+		{Name: "user", UserID: "user", FileID: "photo", Status: http.StatusForbidden},
+		{Name: "missing", UserID: "admin", FileID: "missing", Status: http.StatusNotFound},
+		{Name: "admin", UserID: "admin", FileID: "photo", Status: http.StatusOK},
+		{Name: "channel member", UserID: "reader", FileID: "photo", Status: http.StatusOK},
+		{Name: "private channel", UserID: "reader", FileID: "private", Status: http.StatusNotFound},
+		{Name: "file not posted", UserID: "reader", FileID: "unposted", Status: http.StatusNotFound},
+	}
+
+	for _, test := range testTable {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/v1/files/"+test.FileID+"/trace", nil)
+		if test.UserID != "" {
+			r.Header.Set("Mattermost-User-Id", test.UserID)
+		}
+		p.ServeHTTP(nil, w, r)
+		assert.Equal(t, test.Status, w.Code, test.Name)
+		if test.Status == http.StatusOK {
+			for _, line := range []string{
+				"Uploads of this type are processed",
+				"The content is in the jpeg format",
+				"Removing the APP1 segment at offsets 2-38",
+				"Sanitized: ACM, GPS: no, 36 bytes removed",
+			} {
+				assert.Contains(t, w.Body.String(), line, test.Name)
+			}
+		}
+	}
+}
+
+func TestTraceFile(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("GetUser", "bot").Return(&model.User{Id: "bot", IsBot: true}, nil)
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	testTable := []struct {
+		Name   string
+		Config *configuration
+		Info   *model.FileInfo
+		Last   string
+	}{
+		{
+			Name:   "type not processed",
+			Config: &configuration{ProcessedTypes: "image/png"},
+			Info:   &model.FileInfo{Name: "beach.jpg", MimeType: "image/jpeg"},
+			Last:   "Uploads of this type are not processed, and let through unchanged",
+		},
+		{
+			Name:   "inspected",
+			Config: &configuration{ProcessedTypes: "image/png", DeepInspection: inspectSanitize},
+			Info:   &model.FileInfo{Name: "notes.txt", MimeType: "text/plain"},
+			Last:   "Files of this format are not processed, and let through unchanged",
+		},
+		{
+			Name:   "rejected uploader",
+			Config: &configuration{BotUploads: uploadsReject},
+			Info:   &model.FileInfo{Name: "beach.jpg", MimeType: "image/jpeg", CreatorId: "bot"},
+			Last:   "Uploads from bots are set to reject",
+		},
+		{
+			Name:   "type action",
+			Config: &configuration{TypeActions: "raw=reject"},
+			Info:   &model.FileInfo{Name: "DSC_0042.NEF", Extension: "nef", MimeType: "image/x-nikon-nef", CreatorId: "user"},
+			Last:   "Uploads of the raw type are set to reject",
+		},
+	}
+
+	for _, test := range testTable {
+		lines := p.traceFile(test.Info, exifJPEG, test.Config)
+		assert.Equal(t, test.Last, lines[len(lines)-1], test.Name)
+		assert.True(t, strings.HasPrefix(lines[0], "File "), test.Name)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+	"github.com/nimrodshn/mattermost-exif-plugin/internal/heic"
+	"github.com/pkg/errors"
+)
+
+// The actions of the TypeActions setting, for the uploads of a type: remove their metadata as the
+// other settings say, which is the default, decode them and encode them again as JPEG, reject
+// them, or let them through unchanged.
+const (
+	typeStrip       = "strip"
+	typeTranscode   = "transcode"
+	typeReject      = "reject"
+	typePassThrough = "pass-through"
+)
+
+// rawType is the type of TypeActions matching the raw images of cameras, whatever their format.
+const rawType = "raw"
+
+// rawExtensions are the extensions of the raw image formats of cameras. They are told apart by
+// name, as many of them are TIFF files to exif.Detect.
+var rawExtensions = map[string]bool{
+	"3fr": true, "ari": true, "arw": true, "cr2": true, "cr3": true, "crw": true, "dcr": true,
+	"dng": true, "erf": true, "fff": true, "iiq": true, "k25": true, "kdc": true, "mef": true,
+	"mos": true, "mrw": true, "nef": true, "nrw": true, "orf": true, "pef": true, "raf": true,
+	"raw": true, "rw2": true, "rwl": true, "sr2": true, "srf": true, "srw": true, "x3f": true,
+}
+
+// transcodable are the formats the transcode action supports: those the image package decodes,
+// and those the HEIC converters decode.
+var transcodable = map[string]bool{
+	"jpeg": true, "png": true, "gif": true,
+	"heic": true, "heif": true, "avif": true,
+}
+
+// isRawUpload reports whether info names a raw image of a camera.
+func isRawUpload(info *model.FileInfo) bool {
+	extension := info.Extension
+	if extension == "" {
+		extension = filepath.Ext(info.Name)
+	}
+	return rawExtensions[strings.ToLower(strings.TrimPrefix(extension, "."))]
+}
+
+// parseTypeActions parses the TypeActions setting, a comma separated list of types and actions
+// such as heic=transcode,raw=reject,mp4=pass-through. The types are the formats named by
+// exif.Detect and raw. Invalid entries are reported in the error and skipped, while the valid
+// ones are returned all the same, so that a mistake in one entry does not let through the types
+// the others reject.
+func parseTypeActions(setting string) (map[string]string, error) {
+	actions := map[string]string{}
+	var problems []string
+	for _, entry := range strings.Split(setting, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		typ, action, err := parseTypeAction(entry)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		actions[typ] = action
+	}
+	if len(problems) > 0 {
+		return actions, errors.New(strings.Join(problems, "; "))
+	}
+	return actions, nil
+}
+
+// parseTypeAction parses an entry of the TypeActions setting into its type and action.
+func parseTypeAction(entry string) (string, string, error) {
+	parts := strings.SplitN(entry, "=", 2)
+	if len(parts) != 2 {
+		return "", "", errors.Errorf("%q is not of the form type=action", entry)
+	}
+	typ, action := strings.ToLower(strings.TrimSpace(parts[0])), strings.TrimSpace(parts[1])
+	if _, ok := mimeTypes[typ]; !ok && typ != rawType {
+		return "", "", errors.Errorf("unknown type %q, expected one of %s", typ, strings.Join(actionTypes(), ", "))
+	}
+	switch action {
+	case typeStrip, typeReject, typePassThrough:
+	case typeTranscode:
+		if !transcodable[typ] {
+			return "", "", errors.Errorf("%s files cannot be transcoded, only jpeg, png, gif, heic, heif and avif files", typ)
+		}
+	default:
+		return "", "", errors.Errorf("unknown action %q for %s, expected strip, transcode, reject or pass-through", action, typ)
+	}
+	return typ, action, nil
+}
+
+// actionTypes returns the types TypeActions accepts, sorted.
+func actionTypes() []string {
+	types := []string{rawType}
+	for format := range mimeTypes {
+		types = append(types, format)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// actionsByType returns the actions of the TypeActions setting by type, as compiled, or parsed
+// again if the configuration was not compiled.
+func (c *configuration) actionsByType() map[string]string {
+	if c.typeActions == nil {
+		actions, _ := parseTypeActions(c.TypeActions)
+		return actions
+	}
+	return c.typeActions
+}
+
+// typeAction returns the action of the TypeActions setting for the uploads of the type typ, which
+// is strip unless the setting lists another.
+func (c *configuration) typeAction(typ string) string {
+	if action, ok := c.actionsByType()[typ]; ok {
+		return action
+	}
+	return typeStrip
+}
+
+// applyTypeAction applies the reject and pass-through actions of the TypeActions setting for the
+// uploads of the type typ to the upload of info. It returns whether the upload was handled, and
+// the rejection if any. Both are applied before the upload is read, from its name or the first
+// bytes of its content, so that they hold for the uploads exceeding the memory budget too.
+func (p *Plugin) applyTypeAction(info *model.FileInfo, typ string, config *configuration) (bool, string) {
+	switch config.typeAction(typ) {
+	case typeReject:
+		return true, reject(codeTypeRejected, "%s files are not allowed on this server.", strings.ToUpper(typ))
+	case typePassThrough:
+		p.API.LogDebug("Passing through upload by type", "name", info.Name, "user_id", info.CreatorId, "type", typ)
+		return true, ""
+	}
+	return false, ""
+}
+
+// oversizedTranscode handles an upload exceeding the memory budget, read from file, whose type is
+// to be transcoded, which needs it decoded in memory. It is let through unchanged if the
+// OversizedUploads setting says so, and rejected otherwise rather than having its metadata
+// removed in place of being transcoded.
+func (p *Plugin) oversizedTranscode(info *model.FileInfo, file io.Reader, output io.Writer, config *configuration) (*model.FileInfo, string) {
+	if config.OversizedUploads == oversizedPassThrough {
+		return p.oversizedUpload(info, file, output, config)
+	}
+	p.API.LogInfo("Rejected upload to transcode exceeding the memory budget", "name", info.Name, "user_id", info.CreatorId, "size", info.Size)
+	return nil, reject(codeTooLarge, "Files larger than %d MB cannot be transcoded on this server.", config.MemoryBudget)
+}
+
+// transcodeUpload decodes the image of info, of the given format, read into data, and encodes it
+// again, which drops all its metadata: as JPEG, except for GIF animations, which stay GIF. HEIF,
+// HEIC and AVIF images are converted by the external converters of the heic package, and their
+// metadata removed as usual if none is installed. Transcoding is bounded by the processing
+// timeout like sanitizing, and its result marked as sanitized. It returns whether the upload was
+// handled.
+func (p *Plugin) transcodeUpload(info *model.FileInfo, data []byte, output io.Writer, format string, config *configuration) (bool, *model.FileInfo, string) {
+	// The work may outlive the timeout, so that it updates a copy of info, and writes through a
+	// writer it can be cut off from.
+	transcoded := *info
+	sum := sha256.New()
+	writer := &deadlineWriter{w: io.MultiWriter(output, sum)}
+	var replacement *model.FileInfo
+	var rejection string
+	noConverter := false
+	err := withinTimeout(config.processingTimeout(), func() error {
+		image := data
+		if format == "heic" || format == "heif" || format == "avif" {
+			converted, err := heic.ToJPEG(bytes.NewReader(data))
+			if errors.Is(err, heic.ErrNoConverter) {
+				noConverter = true
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			image = converted
+		}
+		replacement, rejection = p.naiveDiscardExif(&transcoded, bytes.NewReader(image), writer)
+		return nil
+	}, writer.abandon)
+	if errors.Is(err, errTimeout) {
+		replacement, rejection := p.timedOutUpload(info, data, output, config, err)
+		return true, replacement, rejection
+	}
+	if err != nil {
+		p.auditFailure(info, err)
+		return true, nil, reject(codeProcessingFailed, "An error occurred while trying to transcode the uploaded file: %v", err)
+	}
+	if noConverter {
+		p.API.LogWarn("Sanitizing upload that cannot be transcoded on this server", "name", info.Name, "user_id", info.CreatorId, "err", heic.ErrNoConverter.Error())
+		return false, nil, ""
+	}
+	if rejection != "" {
+		return true, nil, rejection
+	}
+
+	*info = *replacement
+	if info.MimeType == "image/jpeg" && format != "jpeg" {
+		info.Name = strings.TrimSuffix(info.Name, filepath.Ext(info.Name)) + ".jpg"
+		info.Extension = "jpg"
+	}
+	p.markSanitized(sum, config)
+	p.auditUploadDetail(info, &exif.Report{Format: format}, "transcoded")
+	return true, info, ""
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseTypeActions(t *testing.T) {
+	testTable := []struct {
+		Setting string
+		Actions map[string]string
+		Error   string
+	}{
+		{Setting: "", Actions: map[string]string{}},
+		{Setting: "JPEG=strip, heic=transcode,raw=reject, mp4=pass-through", Actions: map[string]string{"jpeg": "strip", "heic": "transcode", "raw": "reject", "mp4": "pass-through"}},
+		{Setting: "heic", Actions: map[string]string{}, Error: `"heic" is not of the form type=action`},
+		{Setting: "jpg=strip", Actions: map[string]string{}, Error: `unknown type "jpg", expected one of avif, bmp, gif, heic, heif, ico, jp2, jpeg, jpx, mov, mp4, pdf, pgm, png, ppm, raw, svg, tiff, webp`},
+		{Setting: "heic=convert", Actions: map[string]string{}, Error: `unknown action "convert" for heic, expected strip, transcode, reject or pass-through`},
+		// The valid entries are kept along with the error, so that raw images stay rejected.
+		{Setting: "raw=reject,heic=convert", Actions: map[string]string{"raw": "reject"}, Error: `unknown action "convert" for heic, expected strip, transcode, reject or pass-through`},
+		{Setting: "heic,jpg=strip", Actions: map[string]string{}, Error: `"heic" is not of the form type=action; unknown type "jpg", expected one of avif, bmp, gif, heic, heif, ico, jp2, jpeg, jpx, mov, mp4, pdf, pgm, png, ppm, raw, svg, tiff, webp`},
+		{Setting: "raw=transcode", Actions: map[string]string{}, Error: "raw files cannot be transcoded, only jpeg, png, gif, heic, heif and avif files"},
+	}
+
+	for _, test := range testTable {
+		actions, err := parseTypeActions(test.Setting)
+		if test.Error != "" {
+			assert.EqualError(t, err, test.Error, test.Setting)
+		} else {
+			assert.NoError(t, err, test.Setting)
+		}
+		assert.Equal(t, test.Actions, actions, test.Setting)
+	}
+}
+
+func TestFileWillBeUploadedTypeActions(t *testing.T) {
+	testTable := []struct {
+		Name      string
+		Actions   string
+		Timeout   int
+		Info      model.FileInfo
+		Input     []byte
+		Rejection string
+		Replaced  string
+		Unchanged bool
+	}{
+		{
+			Name:     "not listed",
+			Actions:  "png=reject",
+			Info:     model.FileInfo{Name: "photo.jpg", Extension: "jpg", MimeType: "image/jpeg"},
+			Input:    exifJPEG,
+			Replaced: "photo.jpg",
+		},
+		{
+			Name:      "rejected",
+			Actions:   "jpeg=reject",
+			Info:      model.FileInfo{Name: "photo.jpg", Extension: "jpg", MimeType: "image/jpeg"},
+			Input:     exifJPEG,
+			Rejection: "EXIF012: JPEG files are not allowed on this server.",
+		},
+		{
+			// Types are detected from the content of uploads, whatever their name.
+			Name:      "rejected by content",
+			Actions:   "jpeg=reject",
+			Info:      model.FileInfo{Name: "photo.png", Extension: "png", MimeType: "image/png"},
+			Input:     exifJPEG,
+			Rejection: "EXIF012: JPEG files are not allowed on this server.",
+		},
+		{
+			Name:      "passed through",
+			Actions:   "jpeg=pass-through",
+			Info:      model.FileInfo{Name: "photo.jpg", Extension: "jpg", MimeType: "image/jpeg"},
+			Input:     exifJPEG,
+			Unchanged: true,
+		},
+		{
+			Name:     "transcoded",
+			Actions:  "png=transcode",
+			Info:     model.FileInfo{Name: "photo.png", Extension: "png", MimeType: "image/png"},
+			Input:    exifPNG,
+			Replaced: "photo.jpg",
+		},
+		{
+			Name:     "transcoded within the timeout",
+			Actions:  "png=transcode",
+			Timeout:  60,
+			Info:     model.FileInfo{Name: "photo.png", Extension: "png", MimeType: "image/png"},
+			Input:    exifPNG,
+			Replaced: "photo.jpg",
+		},
+		{
+			Name:      "raw rejected",
+			Actions:   "raw=reject",
+			Info:      model.FileInfo{Name: "DSC_0042.NEF", Extension: "nef", MimeType: "image/x-nikon-nef"},
+			Input:     exifJPEG,
+			Rejection: "EXIF012: RAW files are not allowed on this server.",
+		},
+		{
+			// An invalid entry leaves the others in force.
+			Name:      "raw rejected despite an invalid entry",
+			Actions:   "raw=reject,heic=convert",
+			Info:      model.FileInfo{Name: "DSC_0042.NEF", Extension: "nef", MimeType: "image/x-nikon-nef"},
+			Input:     exifJPEG,
+			Rejection: "EXIF012: RAW files are not allowed on this server.",
+		},
+		{
+			// Raw images are only processed when the setting lists them.
+			Name:      "raw not listed",
+			Actions:   "heic=transcode",
+			Info:      model.FileInfo{Name: "DSC_0042.NEF", Extension: "nef", MimeType: "image/x-nikon-nef"},
+			Input:     exifJPEG,
+			Unchanged: true,
+		},
+	}
+
+	for _, test := range testTable {
+		config := &configuration{TypeActions: test.Actions, ProcessingTimeout: test.Timeout}
+		config.compile()
+		p, api := newUploadTestPlugin(config)
+		info := test.Info
+		info.CreatorId = "user"
+		output := new(bytes.Buffer)
+
+		replacement, rejection := p.FileWillBeUploaded(nil, &info, bytes.NewReader(test.Input), output)
+		assert.Equal(t, test.Rejection, rejection, test.Name)
+		if test.Rejection != "" || test.Unchanged {
+			assert.Nil(t, replacement, test.Name)
+			assert.Zero(t, output.Len(), test.Name)
+			continue
+		}
+		if assert.NotNil(t, replacement, test.Name) {
+			assert.Equal(t, test.Replaced, replacement.Name, test.Name)
+			assert.Equal(t, int64(output.Len()), replacement.Size, test.Name)
+			assert.NotContains(t, output.String(), "Secret", test.Name)
+			assert.NotContains(t, output.String(), "ACM", test.Name)
+			// Transcoded uploads are marked as sanitized like the others.
+			sum := sha256.Sum256(output.Bytes())
+			api.AssertCalled(t, "KVSetWithExpiry", markerKey(sum[:]), mock.Anything, mock.Anything)
+		}
+	}
+}
+
+func TestFileWillBeUploadedOversizedTypeActions(t *testing.T) {
+	testTable := []struct {
+		Name      string
+		Actions   string
+		Policy    string
+		Rejection string
+	}{
+		{Name: "rejected", Actions: "jpeg=reject", Rejection: "EXIF012: JPEG files are not allowed on this server."},
+		{Name: "passed through", Actions: "jpeg=pass-through"},
+		{Name: "transcode rejected", Actions: "jpeg=transcode", Rejection: "EXIF002: Files larger than 1 MB cannot be transcoded on this server."},
+		{Name: "transcode passed through", Actions: "jpeg=transcode", Policy: oversizedPassThrough},
+	}
+
+	for _, test := range testTable {
+		config := &configuration{TypeActions: test.Actions, MemoryBudget: 1, OversizedUploads: test.Policy}
+		config.compile()
+		p, _ := newUploadTestPlugin(config)
+		info := &model.FileInfo{Name: "photo.jpg", Extension: "jpg", MimeType: "image/jpeg", CreatorId: "user", Size: int64(len(oversizedJPEG))}
+		output := new(bytes.Buffer)
+
+		// The uploads exceeding the memory budget are handled as their type says rather than
+		// spooled and sanitized.
+		replacement, rejection := p.FileWillBeUploaded(nil, info, bytes.NewReader(oversizedJPEG), output)
+		assert.Equal(t, test.Rejection, rejection, test.Name)
+		assert.Nil(t, replacement, test.Name)
+		assert.Zero(t, output.Len(), test.Name)
+	}
+}
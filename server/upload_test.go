@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newUploadTestPlugin returns a plugin with the given configuration whose API mock accepts every
+// call FileWillBeUploaded may make: logs, the uploaders bot and user, the markers of sanitized
+// files and the audit log, which is reported as written.
+func newUploadTestPlugin(config *configuration) (*Plugin, *plugintest.API) {
+	api := &plugintest.API{}
+	for _, level := range []string{"LogDebug", "LogInfo", "LogWarn", "LogError"} {
+		// The log methods are variadic, so each number of key value pairs is mocked separately.
+		args := []interface{}{mock.AnythingOfType("string")}
+		for pairs := 0; pairs <= 5; pairs++ {
+			api.On(level, args...).Maybe()
+			args = append(args, mock.Anything, mock.Anything)
+		}
+	}
+	api.On("GetUser", "bot").Return(&model.User{Id: "bot", IsBot: true}, nil).Maybe()
+	api.On("GetUser", "user").Return(&model.User{Id: "user"}, nil).Maybe()
+	api.On("KVGet", mock.Anything).Return(nil, nil).Maybe()
+	api.On("KVCompareAndSet", auditKey, []byte(nil), mock.Anything).Return(true, nil).Maybe()
+	api.On("KVSetWithOptions", mock.MatchedBy(isAuditRecordsKey), mock.Anything, mock.Anything).Return(true, nil).Maybe()
+	api.On("KVSetWithExpiry", mock.MatchedBy(isMarkerKey), mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.setConfiguration(config)
+	return p, api
+}
+
+// pngChunkOf returns a PNG chunk of the given type and data, with its CRC.
+func pngChunkOf(typ string, data []byte) []byte {
+	chunk := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	chunk = append(append(chunk, typ...), data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// Sample uploads of each format, carrying metadata recording the word "Secret".
+var (
+	exifPNG = bytes.Join([][]byte{
+		[]byte("\x89PNG\r\n\x1a\n"),
+		pngChunkOf("IHDR", []byte{0, 0, 0, 1, 0, 0, 0, 1, 8, 0, 0, 0, 0}),
+		pngChunkOf("tEXt", []byte("Author\x00Secret")),
+		pngChunkOf("eXIf", exifJPEG[12:38]),
+		pngChunkOf("IDAT", []byte{0x78, 0x9C, 0x63, 0x60, 0x00, 0x00, 0x00, 0x02, 0x00, 0x01}),
+		pngChunkOf("IEND", nil),
+	}, nil)
+
+	commentGIF = []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00" +
+		"\x21\xFE\x06Secret\x00" + // Comment extension.
+		"\x2C\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02\x44\x01\x00" + // One pixel frame.
+		"\x3B")
+
+	metadataSVG = []byte(`<svg xmlns="http://www.w3.org/2000/svg"><metadata>Secret</metadata><!-- Secret --><rect width="1" height="1"/></svg>`)
+
+	xmlJP2 = []byte("\x00\x00\x00\x0CjP  \r\n\x87\n" +
+		"\x00\x00\x00\x14ftypjp2 \x00\x00\x00\x00jp2 " +
+		"\x00\x00\x00\x2Djp2h\x00\x00\x00\x16ihdr\x00\x00\x00\x01\x00\x00\x00\x01\x00\x03\x07\x07\x00\x00" +
+		"\x00\x00\x00\x0Fcolr\x01\x00\x00\x00\x00\x00\x10" +
+		"\x00\x00\x00\x1Fxml <author>Secret</author>" +
+		"\x00\x00\x00\x0Cjp2c\xFF\x4F\xFF\xD9")
+
+	authorPDF = []byte("%PDF-1.7\n1 0 obj\n<< /Author (Secret) >>\nendobj\ntrailer\n<< /Info 1 0 R >>\n%%EOF\n")
+)
+
+func TestFileWillBeUploadedFormats(t *testing.T) {
+	testTable := []struct {
+		Name     string
+		Info     *model.FileInfo
+		Input    []byte
+		MimeType string
+	}{
+		{Name: "jpeg", Info: &model.FileInfo{Name: "photo.jpg", Extension: "jpg", MimeType: "image/jpeg"}, Input: exifJPEG, MimeType: "image/jpeg"},
+		{Name: "png", Info: &model.FileInfo{Name: "photo.png", Extension: "png", MimeType: "image/png"}, Input: exifPNG, MimeType: "image/png"},
+		{Name: "gif", Info: &model.FileInfo{Name: "clip.gif", Extension: "gif", MimeType: "image/gif"}, Input: commentGIF, MimeType: "image/gif"},
+		{Name: "jp2", Info: &model.FileInfo{Name: "scan.jp2", Extension: "jp2", MimeType: "image/jp2"}, Input: xmlJP2, MimeType: "image/jp2"},
+		{Name: "svg", Info: &model.FileInfo{Name: "logo.svg", Extension: "svg", MimeType: "image/svg+xml"}, Input: metadataSVG, MimeType: "image/svg+xml"},
+		{Name: "pdf", Info: &model.FileInfo{Name: "report.pdf", Extension: "pdf", MimeType: "application/pdf"}, Input: authorPDF, MimeType: "application/pdf"},
+	}
+
+	for _, test := range testTable {
+		p, _ := newUploadTestPlugin(&configuration{RemovePDFMetadata: true})
+		test.Info.CreatorId = "user"
+		output := new(bytes.Buffer)
+		info, rejection := p.FileWillBeUploaded(nil, test.Info, bytes.NewReader(test.Input), output)
+		assert.Empty(t, rejection, test.Name)
+		if !assert.NotNil(t, info, test.Name) {
+			continue
+		}
+		assert.Equal(t, test.MimeType, info.MimeType, test.Name)
+		assert.Equal(t, int64(output.Len()), info.Size, test.Name)
+		assert.NotContains(t, output.String(), "Secret", test.Name)
+		assert.NotContains(t, output.String(), "ACM", test.Name)
+	}
+}
+
+func TestFileWillBeUploadedErrors(t *testing.T) {
+	random := make([]byte, 256)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	testTable := []struct {
+		Name      string
+		Info      *model.FileInfo
+		Input     []byte
+		Rejection string
+	}{
+		{
+			Name:      "empty",
+			Info:      &model.FileInfo{Name: "photo.jpg", Extension: "jpg", MimeType: "image/jpeg"},
+			Input:     []byte{},
+			Rejection: "EXIF003: The file is empty.",
+		},
+		{
+			Name:      "start of image only",
+			Info:      &model.FileInfo{Name: "photo.jpg", Extension: "jpg", MimeType: "image/jpeg"},
+			Input:     exifJPEG[:2],
+			Rejection: "EXIF003: The file is truncated, and cannot be processed.",
+		},
+		{
+			Name:      "truncated jpeg",
+			Info:      &model.FileInfo{Name: "photo.jpg", Extension: "jpg", MimeType: "image/jpeg"},
+			Input:     exifJPEG[:20],
+			Rejection: "EXIF003: The file is truncated, and cannot be processed.",
+		},
+		{
+			Name:      "not a jpeg",
+			Info:      &model.FileInfo{Name: "photo.jpg", Extension: "jpg", MimeType: "image/jpeg"},
+			Input:     []byte("not an image"),
+			Rejection: "EXIF001: The file is not an image or video of a supported format, or is corrupt.",
+		},
+		{
+			Name:      "random",
+			Info:      &model.FileInfo{Name: "photo.png", Extension: "png", MimeType: "image/png"},
+			Input:     random,
+			Rejection: "EXIF001: The file is not an image or video of a supported format, or is corrupt.",
+		},
+		{
+			Name:      "truncated gif",
+			Info:      &model.FileInfo{Name: "clip.gif", Extension: "gif", MimeType: "image/gif"},
+			Input:     commentGIF[:20],
+			Rejection: "EXIF003: The file is corrupt, and cannot be processed.",
+		},
+	}
+
+	for _, test := range testTable {
+		for _, policy := range []string{"", corruptReject, corruptPassThrough} {
+			p, api := newUploadTestPlugin(&configuration{CorruptUploads: policy})
+			info := *test.Info
+			info.CreatorId = "user"
+			output := new(bytes.Buffer)
+			replacement, rejection := p.FileWillBeUploaded(nil, &info, bytes.NewReader(test.Input), output)
+			assert.Nil(t, replacement, test.Name)
+			assert.Zero(t, output.Len(), test.Name)
+			if policy == corruptPassThrough {
+				assert.Empty(t, rejection, test.Name)
+			} else {
+				assert.Equal(t, test.Rejection, rejection, test.Name)
+			}
+			// The failure is recorded in the audit log whatever the policy.
+			api.AssertCalled(t, "KVCompareAndSet", auditKey, []byte(nil), mock.Anything)
+		}
+	}
+}
+
+func TestFileWillBeUploadedSettings(t *testing.T) {
+	jpegInfo := func() *model.FileInfo {
+		return &model.FileInfo{Name: "photo.jpg", Extension: "jpg", MimeType: "image/jpeg", CreatorId: "user"}
+	}
+
+	testTable := []struct {
+		Name      string
+		Config    *configuration
+		Unchanged bool
+		Kept      string
+	}{
+		{Name: "defaults", Config: &configuration{}},
+		{Name: "type not processed", Config: &configuration{ProcessedTypes: "image/png"}, Unchanged: true},
+		{Name: "type processed by extension", Config: &configuration{ProcessedTypes: ".jpg"}},
+		{Name: "type processed by wildcard", Config: &configuration{ProcessedTypes: "image/*"}},
+		{Name: "timestamps removed", Config: &configuration{MetadataProfile: "remove-timestamps"}, Kept: "ACM"},
+		{Name: "device ids removed", Config: &configuration{MetadataProfile: "remove-device-ids"}, Kept: "ACM"},
+		{Name: "exif segments kept", Config: &configuration{SegmentPolicy: "APP1=keep"}, Kept: "ACM"},
+		{Name: "invalid segment policy", Config: &configuration{SegmentPolicy: "APP1=maybe"}},
+		{Name: "bots skipped", Config: &configuration{BotUploads: uploadsSkip}},
+	}
+
+	for _, test := range testTable {
+		p, _ := newUploadTestPlugin(test.Config)
+		output := new(bytes.Buffer)
+		info, rejection := p.FileWillBeUploaded(nil, jpegInfo(), bytes.NewReader(exifJPEG), output)
+		assert.Empty(t, rejection, test.Name)
+		if test.Unchanged {
+			assert.Nil(t, info, test.Name)
+			assert.Zero(t, output.Len(), test.Name)
+			continue
+		}
+		if !assert.NotNil(t, info, test.Name) {
+			continue
+		}
+		if test.Kept != "" {
+			assert.Contains(t, output.String(), test.Kept, test.Name)
+		} else {
+			assert.NotContains(t, output.String(), "ACM", test.Name)
+		}
+	}
+}
+
+func TestFileWillBeUploadedRejections(t *testing.T) {
+	document := append(append([]byte("PK\x03\x04archive"), exifJPEG...), "end"...)
+
+	testTable := []struct {
+		Name      string
+		Config    *configuration
+		Info      *model.FileInfo
+		Input     []byte
+		Rejection string
+	}{
+		{
+			Name:      "bot uploads",
+			Config:    &configuration{BotUploads: uploadsReject},
+			Info:      &model.FileInfo{Name: "chart.jpg", Extension: "jpg", MimeType: "image/jpeg", CreatorId: "bot"},
+			Input:     exifJPEG,
+			Rejection: "EXIF008: Uploads from bots are not allowed on this server.",
+		},
+		{
+			Name:      "plugin uploads",
+			Config:    &configuration{PluginUploads: uploadsReject},
+			Info:      &model.FileInfo{Name: "chart.jpg", Extension: "jpg", MimeType: "image/jpeg", CreatorId: pluginCreatorID},
+			Input:     exifJPEG,
+			Rejection: "EXIF008: Uploads from plugins are not allowed on this server.",
+		},
+		{
+			Name:      "segment policy",
+			Config:    &configuration{SegmentPolicy: "APP1=reject"},
+			Info:      &model.FileInfo{Name: "photo.jpg", Extension: "jpg", MimeType: "image/jpeg", CreatorId: "user"},
+			Input:     exifJPEG,
+			Rejection: "EXIF005: The image carries metadata segments that are not allowed on this server.",
+		},
+		{
+			Name:      "chunk policy",
+			Config:    &configuration{PNGChunkPolicy: "tEXt=reject"},
+			Info:      &model.FileInfo{Name: "photo.png", Extension: "png", MimeType: "image/png", CreatorId: "user"},
+			Input:     exifPNG,
+			Rejection: "EXIF006: The image carries metadata chunks that are not allowed on this server.",
+		},
+		{
+			Name:      "embedded images",
+			Config:    &configuration{DeepInspection: inspectReject},
+			Info:      &model.FileInfo{Name: "photos.zip", Extension: "zip", MimeType: "application/zip", CreatorId: "user"},
+			Input:     document,
+			Rejection: "EXIF007: The file contains images carrying metadata, such as the camera model or location they were taken at, and is not allowed on this server.",
+		},
+	}
+
+	for _, test := range testTable {
+		p, _ := newUploadTestPlugin(test.Config)
+		output := new(bytes.Buffer)
+		info, rejection := p.FileWillBeUploaded(nil, test.Info, bytes.NewReader(test.Input), output)
+		assert.Nil(t, info, test.Name)
+		assert.Equal(t, test.Rejection, rejection, test.Name)
+		assert.Zero(t, output.Len(), test.Name)
+	}
+}
+
+func TestFileWillBeUploadedPassThrough(t *testing.T) {
+	bmp := append([]byte("BM\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x28\x00\x00\x00\x01\x00\x00\x00\x01\x00\x00\x00"), make([]byte, 32)...)
+	testTable := []struct {
+		Name  string
+		Info  *model.FileInfo
+		Input []byte
+	}{
+		{Name: "bmp", Info: &model.FileInfo{Name: "scan.bmp", Extension: "bmp", MimeType: "image/bmp"}, Input: bmp},
+		{Name: "ppm", Info: &model.FileInfo{Name: "scan.ppm", Extension: "ppm", MimeType: "image/x-portable-pixmap"}, Input: []byte("P6 1 1 255\n\x00\x00\x00")},
+	}
+
+	for _, test := range testTable {
+		p, api := newUploadTestPlugin(&configuration{ProcessedTypes: "image/*"})
+		test.Info.CreatorId = "user"
+		output := new(bytes.Buffer)
+		info, rejection := p.FileWillBeUploaded(nil, test.Info, bytes.NewReader(test.Input), output)
+		assert.Nil(t, info, test.Name)
+		assert.Empty(t, rejection, test.Name)
+		assert.Zero(t, output.Len(), test.Name)
+		api.AssertCalled(t, "KVSetWithOptions", mock.MatchedBy(isAuditRecordsKey), mock.MatchedBy(func(data []byte) bool {
+			return strings.Contains(string(data), `"format":"`+test.Name+`"`) && strings.Contains(string(data), noMetadataPossible)
+		}), mock.Anything)
+		// Nothing was sanitized, so the dashboard counts are left unchanged.
+		api.AssertNotCalled(t, "KVCompareAndSet", auditKey, mock.Anything, mock.Anything)
+	}
+}
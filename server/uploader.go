@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// The kinds of uploaders, as the files of plugins and bots, such as charts posted by
+// integrations, are machine generated and may be handled differently.
+const (
+	uploaderUser   = "user"
+	uploaderBot    = "bot"
+	uploaderPlugin = "plugin"
+)
+
+// The policies for the uploads of bots and plugins: sanitize them like any other upload, which is
+// the default, let them through unchanged, or reject them.
+const (
+	uploadsSanitize = "sanitize"
+	uploadsSkip     = "skip"
+	uploadsReject   = "reject"
+)
+
+// pluginCreatorID is the creator of the files plugins upload through the plugin API.
+const pluginCreatorID = "nouser"
+
+// uploaderKind returns the kind of the uploader of a file.
+func (p *Plugin) uploaderKind(info *model.FileInfo) string {
+	if info.CreatorId == "" || info.CreatorId == pluginCreatorID {
+		return uploaderPlugin
+	}
+	if user, appErr := p.API.GetUser(info.CreatorId); appErr == nil && user.IsBot {
+		return uploaderBot
+	}
+	return uploaderUser
+}
+
+// uploadPolicy returns the policy for the uploads of the uploader of a file, according to the
+// BotUploads and PluginUploads settings. The uploader is only looked up if one of them is set.
+func (p *Plugin) uploadPolicy(info *model.FileInfo, config *configuration) (string, string) {
+	if (config.BotUploads == "" || config.BotUploads == uploadsSanitize) &&
+		(config.PluginUploads == "" || config.PluginUploads == uploadsSanitize) {
+		return uploaderUser, uploadsSanitize
+	}
+
+	switch kind := p.uploaderKind(info); kind {
+	case uploaderBot:
+		return kind, config.BotUploads
+	case uploaderPlugin:
+		return kind, config.PluginUploads
+	}
+	return uploaderUser, uploadsSanitize
+}
+
+// filterUpload applies the policy for the uploader of a file before it is sanitized. It returns
+// whether the file is to be sanitized and, if the upload is rejected, why.
+func (p *Plugin) filterUpload(info *model.FileInfo, config *configuration) (bool, string) {
+	kind, policy := p.uploadPolicy(info, config)
+	switch policy {
+	case uploadsSkip:
+		p.API.LogDebug("Skipping upload by policy", "name", info.Name, "uploader", kind)
+		return false, ""
+	case uploadsReject:
+		p.API.LogInfo("Rejected upload by policy", "name", info.Name, "uploader", kind, "user_id", info.CreatorId)
+		return false, reject(codeUploaderRejected, "Uploads from %ss are not allowed on this server.", kind)
+	}
+	return true, ""
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestFilterUpload(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("GetUser", "bot").Return(&model.User{Id: "bot", IsBot: true}, nil)
+	api.On("GetUser", "user").Return(&model.User{Id: "user"}, nil)
+	api.On("LogDebug", "Skipping upload by policy", "name", mock.Anything, "uploader", mock.Anything)
+	api.On("LogInfo", "Rejected upload by policy", "name", mock.Anything, "uploader", mock.Anything, "user_id", mock.Anything)
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	testTable := []struct {
+		Name      string
+		Config    *configuration
+		CreatorID string
+		Sanitize  bool
+		Rejection string
+	}{
+		{Name: "default bot", Config: &configuration{}, CreatorID: "bot", Sanitize: true},
+		{Name: "default plugin", Config: &configuration{}, CreatorID: pluginCreatorID, Sanitize: true},
+		{Name: "skipped bot", Config: &configuration{BotUploads: uploadsSkip}, CreatorID: "bot"},
+		{Name: "user with skipped bots", Config: &configuration{BotUploads: uploadsSkip}, CreatorID: "user", Sanitize: true},
+		{Name: "plugin with skipped bots", Config: &configuration{BotUploads: uploadsSkip}, CreatorID: pluginCreatorID, Sanitize: true},
+		{Name: "rejected plugin", Config: &configuration{PluginUploads: uploadsReject}, CreatorID: pluginCreatorID, Rejection: "EXIF008: Uploads from plugins are not allowed on this server."},
+		{Name: "rejected bot", Config: &configuration{BotUploads: uploadsReject}, CreatorID: "bot", Rejection: "EXIF008: Uploads from bots are not allowed on this server."},
+	}
+
+	for _, test := range testTable {
+		p.setConfiguration(test.Config)
+		sanitize, rejection := p.filterUpload(&model.FileInfo{Name: "chart.png", CreatorId: test.CreatorID}, test.Config)
+		assert.Equal(t, test.Sanitize, sanitize, test.Name)
+		assert.Equal(t, test.Rejection, rejection, test.Name)
+	}
+
+	// The uploader is only looked up when bots or plugins are handled differently.
+	api.AssertNumberOfCalls(t, "GetUser", 3)
+}
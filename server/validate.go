@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+	"github.com/pkg/errors"
+)
+
+// settingChoices are the values allowed for the settings chosen from a list in the System
+// Console, which config.json and mmctl can set to anything. Empty selects the default.
+var settingChoices = []struct {
+	name   string
+	value  func(c *configuration) string
+	values []string
+}{
+	{"Metadata removal", func(c *configuration) string { return c.MetadataProfile }, []string{"strip-all", "remove-timestamps", "round-timestamps", "remove-device-ids"}},
+	{"Content Credentials (C2PA)", func(c *configuration) string { return c.C2PAPolicy }, []string{"preserve", "strip", "strip-and-report"}},
+	{"Color profiles (ICC)", func(c *configuration) string { return c.ICCPolicy }, []string{"preserve", "strip", "replace-with-srgb"}},
+	{"Deep content inspection", func(c *configuration) string { return c.DeepInspection }, []string{"off", "sanitize", "reject"}},
+	{"Uploads over the memory budget", func(c *configuration) string { return c.OversizedUploads }, []string{"spool", "pass-through", "reject"}},
+	{"Uploads over the processing timeout", func(c *configuration) string { return c.TimeoutFallback }, []string{"pass-through", "reject", "re-encode"}},
+	{"Corrupt uploads", func(c *configuration) string { return c.CorruptUploads }, []string{"reject", "pass-through"}},
+	{"Uploads the plugin fails on unexpectedly", func(c *configuration) string { return c.PanicPolicy }, []string{"fail-closed", "fail-open"}},
+	{"Uploads from bots", func(c *configuration) string { return c.BotUploads }, []string{"sanitize", "skip", "reject"}},
+	{"Uploads from plugins", func(c *configuration) string { return c.PluginUploads }, []string{"sanitize", "skip", "reject"}},
+	{"Who can remove metadata from posted files", func(c *configuration) string { return c.StripPermission }, []string{"authors", "channel-admins", "team-admins", "system-admins"}},
+	{"Who can view the dashboard", func(c *configuration) string { return c.StatsPermission }, []string{"system-admins", "system-console-readers"}},
+}
+
+// validate checks the settings, returning an error naming each invalid one and why, as the
+// System Console shows them, or nil if they are all valid. Invalid settings are otherwise
+// ignored or fall back to their defaults, which would only show at upload time.
+func (c *configuration) validate() error {
+	var problems []string
+	invalid := func(name, format string, args ...interface{}) {
+		problems = append(problems, name+": "+fmt.Sprintf(format, args...))
+	}
+
+	if _, err := exif.ParseSegmentPolicy(c.SegmentPolicy); err != nil {
+		invalid("JPEG segment policy", "%v", err)
+	}
+	if _, err := exif.ParseChunkPolicy(c.PNGChunkPolicy); err != nil {
+		invalid("PNG chunk policy", "%v", err)
+	}
+	for _, setting := range settingChoices {
+		value := setting.value(c)
+		if value == "" {
+			continue
+		}
+		known := false
+		for _, v := range setting.values {
+			known = known || value == v
+		}
+		if !known {
+			invalid(setting.name, "unknown value %q, expected one of %s", value, strings.Join(setting.values, ", "))
+		}
+	}
+
+	for _, format := range strings.Split(c.DebugFormats, ",") {
+		format = strings.ToLower(strings.TrimSpace(format))
+		if _, ok := mimeTypes[format]; format != "" && !ok {
+			invalid("Diagnostics for formats", "unknown format %q", format)
+		}
+	}
+
+	for _, t := range strings.Split(c.ProcessedTypes, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		slash := strings.IndexByte(t, '/')
+		if !(len(t) > 1 && t[0] == '.' && slash < 0) && !(slash > 0 && slash < len(t)-1) {
+			invalid("File types processed", "%q is neither a MIME type, such as image/jpeg or image/*, nor an extension, such as .jpg", t)
+		}
+	}
+	if _, err := parseTypeActions(c.TypeActions); err != nil {
+		invalid("Actions by file type", "%v", err)
+	}
+	if c.MemoryBudget < 0 {
+		invalid("Memory budget per upload", "%d MB is negative, use 0 for no limit", c.MemoryBudget)
+	}
+	if c.ProcessingTimeout < 0 {
+		invalid("Processing timeout", "%d seconds is negative, use 0 for no limit", c.ProcessingTimeout)
+	}
+
+	if strings.TrimSpace(c.ScanSchedule) != "" {
+		if _, err := parseCron(c.ScanSchedule); err != nil {
+			invalid("Scheduled scan", "%v", err)
+		}
+		if parts := strings.SplitN(c.ScanChannel, "/", 2); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			invalid("Scan findings channel", "%q is not of the form team-name/channel-name, which scheduled scans need", c.ScanChannel)
+		}
+	}
+	if err := validateURL(c.TelemetryEndpoint); err != nil {
+		invalid("Usage statistics endpoint", "%v", err)
+	}
+	if err := validateURL(c.GeocodingURL); err != nil {
+		invalid("Reverse geocoding URL", "%v", err)
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid plugin settings: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validateURL checks that the URL of an optional endpoint, if set, is an absolute HTTP or HTTPS
+// URL.
+func validateURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Errorf("%q is not an absolute http or https URL", raw)
+	}
+	return nil
+}
+
+// ConfigurationWillBeSaved is invoked before the server configuration is saved, such as from the
+// System Console. It rejects invalid plugin settings, so that the System Console shows why.
+func (p *Plugin) ConfigurationWillBeSaved(newCfg *model.Config) (*model.Config, error) {
+	settings, ok := newCfg.PluginSettings.Plugins[manifest.Id]
+	if !ok {
+		return nil, nil
+	}
+
+	// The settings are decoded as LoadPluginConfiguration does, through JSON.
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode plugin settings")
+	}
+	configuration := new(configuration)
+	if err := json.Unmarshal(raw, configuration); err != nil {
+		return nil, errors.Wrap(err, "invalid plugin settings")
+	}
+	return nil, configuration.validate()
+}
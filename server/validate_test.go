@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	testTable := []struct {
+		Name   string
+		Config configuration
+		Error  string
+	}{
+		{Name: "defaults", Config: configuration{}},
+		{Name: "valid", Config: configuration{
+			C2PAPolicy:        "strip",
+			SegmentPolicy:     "APP2=keep, COM=reject",
+			ProcessedTypes:    "image/*, .jpg, video/mp4",
+			MemoryBudget:      64,
+			ScanSchedule:      "0 3 * * *",
+			ScanChannel:       "team/town-square",
+			TelemetryEndpoint: "https://telemetry.example.com/v1",
+		}},
+		{
+			Name:   "segment policy",
+			Config: configuration{SegmentPolicy: "APP99=keep"},
+			Error:  `invalid plugin settings: JPEG segment policy: unknown marker "APP99", expected APP0 to APP15 or COM`,
+		},
+		{
+			Name:   "choice",
+			Config: configuration{OversizedUploads: "drop"},
+			Error:  `invalid plugin settings: Uploads over the memory budget: unknown value "drop", expected one of spool, pass-through, reject`,
+		},
+		{
+			Name:   "processed types",
+			Config: configuration{ProcessedTypes: "image/jpeg, jpg, image/"},
+			Error: `invalid plugin settings: File types processed: "jpg" is neither a MIME type, such as image/jpeg or image/*, nor an extension, such as .jpg; ` +
+				`File types processed: "image/" is neither a MIME type, such as image/jpeg or image/*, nor an extension, such as .jpg`,
+		},
+		{
+			Name:   "thresholds",
+			Config: configuration{MemoryBudget: -1, ProcessingTimeout: -5},
+			Error:  "invalid plugin settings: Memory budget per upload: -1 MB is negative, use 0 for no limit; Processing timeout: -5 seconds is negative, use 0 for no limit",
+		},
+		{
+			Name:   "scan channel",
+			Config: configuration{ScanSchedule: "0 3 * * *", ScanChannel: "town-square"},
+			Error:  `invalid plugin settings: Scan findings channel: "town-square" is not of the form team-name/channel-name, which scheduled scans need`,
+		},
+		{
+			Name:   "debug formats",
+			Config: configuration{DebugFormats: "HEIC, jpg"},
+			Error:  `invalid plugin settings: Diagnostics for formats: unknown format "jpg"`,
+		},
+		{
+			Name:   "type actions",
+			Config: configuration{TypeActions: "heic=transcode, mp4=transcode"},
+			Error:  `invalid plugin settings: Actions by file type: mp4 files cannot be transcoded, only jpeg, png, gif, heic, heif and avif files`,
+		},
+		{
+			Name:   "url",
+			Config: configuration{GeocodingURL: "nominatim.example.com/reverse"},
+			Error:  `invalid plugin settings: Reverse geocoding URL: "nominatim.example.com/reverse" is not an absolute http or https URL`,
+		},
+	}
+
+	for _, test := range testTable {
+		err := test.Config.validate()
+		if test.Error == "" {
+			assert.NoError(t, err, test.Name)
+		} else if assert.Error(t, err, test.Name) {
+			assert.Equal(t, test.Error, err.Error(), test.Name)
+		}
+	}
+}
+
+func TestConfigurationWillBeSaved(t *testing.T) {
+	p := &Plugin{}
+	config := &model.Config{}
+	config.PluginSettings.Plugins = map[string]map[string]interface{}{
+		manifest.Id: {"memorybudget": float64(64), "timeoutfallback": "re-encode"},
+	}
+	replacement, err := p.ConfigurationWillBeSaved(config)
+	assert.Nil(t, replacement)
+	assert.NoError(t, err)
+
+	config.PluginSettings.Plugins[manifest.Id]["timeoutfallback"] = "retry"
+	_, err = p.ConfigurationWillBeSaved(config)
+	assert.EqualError(t, err, `invalid plugin settings: Uploads over the processing timeout: unknown value "retry", expected one of pass-through, reject, re-encode`)
+}
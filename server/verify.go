@@ -0,0 +1,25 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/nimrodshn/mattermost-exif-plugin/exif"
+)
+
+// verifyPixels compares the pixels of an upload and of its sanitized copy, for the VerifyPixels
+// setting, and returns why the upload is rejected if they differ, which is recorded in the audit
+// log as a failure. Uploads of formats that cannot be decoded are let through unverified.
+func (p *Plugin) verifyPixels(info *model.FileInfo, original, sanitized []byte) string {
+	err := exif.ComparePixels(original, sanitized)
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, exif.ErrNotDecodable) {
+		p.API.LogDebug("Skipping pixel verification of upload that cannot be decoded", "name", info.Name, "user_id", info.CreatorId, "err", err.Error())
+		return ""
+	}
+	p.API.LogError("The pixels of a sanitized upload changed", "name", info.Name, "user_id", info.CreatorId, "err", err.Error())
+	p.auditFailure(info, err)
+	return reject(codePixelsChanged, "The image could not be sanitized without altering it, and is not allowed on this server.")
+}
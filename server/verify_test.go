@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// encodedJPEG returns a JPEG image of a single gray square carrying the EXIF segment of exifJPEG.
+func encodedJPEG(t *testing.T, gray uint8) []byte {
+	square := image.NewGray(image.Rect(0, 0, 8, 8))
+	for i := range square.Pix {
+		square.Pix[i] = gray
+	}
+	buffer := new(bytes.Buffer)
+	if err := jpeg.Encode(buffer, square, nil); err != nil {
+		t.Fatalf("failed to encode the image: %v", err)
+	}
+	return append(append(append([]byte{}, buffer.Bytes()[:2]...), exifJPEG[2:38]...), buffer.Bytes()[2:]...)
+}
+
+func TestFileWillBeUploadedVerifyPixels(t *testing.T) {
+	for name, input := range map[string][]byte{"jpeg": encodedJPEG(t, 0x80), "png": exifPNG, "pdf": authorPDF} {
+		p, _ := newUploadTestPlugin(&configuration{VerifyPixels: true, RemovePDFMetadata: true})
+		info := &model.FileInfo{Name: "upload", CreatorId: "user"}
+		output := new(bytes.Buffer)
+		replacement, rejection := p.FileWillBeUploaded(nil, info, bytes.NewReader(input), output)
+		assert.Empty(t, rejection, name)
+		if assert.NotNil(t, replacement, name) {
+			assert.Equal(t, int64(output.Len()), replacement.Size, name)
+			assert.NotContains(t, output.String(), "ACM", name)
+		}
+	}
+}
+
+func TestVerifyPixels(t *testing.T) {
+	p, api := newUploadTestPlugin(&configuration{VerifyPixels: true})
+	info := &model.FileInfo{Name: "photo.jpg", CreatorId: "user"}
+	assert.Empty(t, p.verifyPixels(info, encodedJPEG(t, 0x80), encodedJPEG(t, 0x80)))
+	// Formats that cannot be decoded are let through.
+	assert.Empty(t, p.verifyPixels(info, authorPDF, authorPDF))
+	api.AssertNotCalled(t, "KVCompareAndSet", auditKey, []byte(nil), mock.Anything)
+
+	rejection := p.verifyPixels(info, encodedJPEG(t, 0x80), encodedJPEG(t, 0x40))
+	assert.Equal(t, "EXIF009: The image could not be sanitized without altering it, and is not allowed on this server.", rejection)
+	api.AssertCalled(t, "KVCompareAndSet", auditKey, []byte(nil), mock.Anything)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// The commit and date of the build, set at link time by the Makefile with
+// -ldflags "-X main.buildCommit=... -X main.buildDate=...". Builds without them, such as those of
+// go build, fall back to the version control information the Go toolchain embeds, if any.
+var (
+	buildCommit string
+	buildDate   string
+)
+
+// versionInfo identifies the build of the plugin, so that support can tell which build behaved
+// as reported.
+type versionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// buildVersion returns the version of the plugin and the commit and date it was built from, which
+// are "unknown" if neither the linker nor the Go toolchain recorded them.
+func buildVersion() versionInfo {
+	info := versionInfo{
+		Version:   manifest.Version,
+		Commit:    buildCommit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+	return info
+}
+
+// String describes the build in a line, such as "0.0.1 (commit 1a2b3c4, built 2024-03-01T12:00:00Z,
+// go1.22.1)".
+func (v versionInfo) String() string {
+	return fmt.Sprintf("%s (commit %s, built %s, %s)", v.Version, v.Commit, v.BuildDate, v.GoVersion)
+}
+
+// executeVersion replies with the version and build of the plugin.
+func (p *Plugin) executeVersion() *model.CommandResponse {
+	return ephemeralResponse("EXIF Remover " + buildVersion().String())
+}
+
+// handleHealth replies that the plugin is running, with its version and build, for monitoring and
+// support.
+func (p *Plugin) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Status string `json:"status"`
+		versionInfo
+	}{Status: "ok", versionInfo: buildVersion()})
+}
@@ -0,0 +1,115 @@
+import React from 'react';
+import {Client4} from 'mattermost-redux/client';
+
+import {id as pluginId} from '../manifest';
+
+const h = React.createElement;
+
+const sectionStyle = {marginBottom: '24px'};
+const cellStyle = {padding: '4px 12px 4px 0', verticalAlign: 'top'};
+
+// formatBytes formats a number of bytes with the largest binary unit it holds at least one of.
+function formatBytes(n) {
+    if (!n || n < 1024) {
+        return `${n || 0} bytes`;
+    }
+    const units = ['KiB', 'MiB', 'GiB', 'TiB'];
+    let value = n / 1024;
+    let unit = 0;
+    while (value >= 1024 && unit < units.length - 1) {
+        value /= 1024;
+        unit++;
+    }
+    return `${value.toFixed(1)} ${units[unit]}`;
+}
+
+// prefilterRate formats the uploads the pre-filter found free of metadata, with their share of
+// the uploads processed.
+function prefilterRate(stats) {
+    const prefiltered = stats.prefiltered || 0;
+    if (!stats.processed) {
+        return `${prefiltered}`;
+    }
+    return `${prefiltered} (${(100 * prefiltered / stats.processed).toFixed(1)}%)`;
+}
+
+// eventTable renders recent audit log events, newest first.
+function eventTable(title, events, empty) {
+    if (!events || !events.length) {
+        return h('div', {style: sectionStyle}, h('h4', null, title), h('p', null, empty));
+    }
+    return h('div', {style: sectionStyle},
+        h('h4', null, title),
+        h('table', null,
+            h('thead', null, h('tr', null,
+                h('th', {style: cellStyle}, 'Time'),
+                h('th', {style: cellStyle}, 'File'),
+                h('th', {style: cellStyle}, 'User'),
+                h('th', {style: cellStyle}, 'Details'),
+            )),
+            h('tbody', null, events.map((event, i) => h('tr', {key: i},
+                h('td', {style: cellStyle}, new Date(event.time).toLocaleString()),
+                h('td', {style: cellStyle}, event.file_name),
+                h('td', {style: cellStyle}, event.user_id),
+                h('td', {style: cellStyle}, event.detail),
+            ))),
+        ),
+    );
+}
+
+// Dashboard is the admin console section showing the plugin's audit log: how many uploads were
+// sanitized by format, the storage removing their metadata saved, and the recent uploads carrying
+// a location and the recent failures.
+export default class Dashboard extends React.Component {
+    constructor(props) {
+        super(props);
+        this.state = {stats: null, error: null};
+    }
+
+    componentDidMount() {
+        this.load();
+    }
+
+    async load() {
+        try {
+            const response = await fetch(`${window.basename || ''}/plugins/${pluginId}/api/v1/stats`, Client4.getOptions({method: 'get'}));
+            if (!response.ok) {
+                throw new Error(await response.text());
+            }
+            this.setState({stats: await response.json(), error: null});
+        } catch (err) {
+            this.setState({error: err.message});
+        }
+    }
+
+    render() {
+        const {stats, error} = this.state;
+        if (error) {
+            return h('div', {className: 'alert alert-danger'}, `Failed to load the audit log: ${error}`);
+        }
+        if (!stats) {
+            return h('p', null, 'Loading...');
+        }
+
+        const formats = Object.entries(stats.by_format || {}).sort((a, b) => b[1] - a[1]);
+        return h('div', null,
+            h('div', {style: sectionStyle},
+                h('h4', null, 'Uploads'),
+                h('table', null, h('tbody', null,
+                    h('tr', null, h('td', {style: cellStyle}, 'Sanitized'), h('td', {style: cellStyle}, stats.processed)),
+                    h('tr', null, h('td', {style: cellStyle}, 'Found free of metadata by the pre-filter'), h('td', {style: cellStyle}, prefilterRate(stats))),
+                    h('tr', null, h('td', {style: cellStyle}, 'With a location'), h('td', {style: cellStyle}, stats.gps_detected)),
+                    h('tr', null, h('td', {style: cellStyle}, 'Failed'), h('td', {style: cellStyle}, stats.failures)),
+                    h('tr', null, h('td', {style: cellStyle}, 'Storage saved'), h('td', {style: cellStyle}, formatBytes(stats.bytes_saved))),
+                    formats.map(([format, count]) => h('tr', {key: format},
+                        h('td', {style: cellStyle}, format.toUpperCase()),
+                        h('td', {style: cellStyle}, count),
+                    )),
+                )),
+            ),
+            eventTable('Recent uploads with a location', stats.recent_gps, 'No uploads with a location yet.'),
+            eventTable('Recent failures', stats.recent_failures, 'No failures.'),
+            h('button', {className: 'btn btn-default', onClick: () => this.load()}, 'Refresh'),
+        );
+    }
+}
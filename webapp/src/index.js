@@ -0,0 +1,32 @@
+import {Client4} from 'mattermost-redux/client';
+import {getConfig} from 'mattermost-redux/selectors/entities/general';
+import {getPost} from 'mattermost-redux/selectors/entities/posts';
+
+import Dashboard from './components/dashboard';
+import {id as pluginId} from './manifest';
+
+// stripPost asks the server to remove metadata from the attachments of an existing post. The
+// server reports the result to the user as an ephemeral post.
+async function stripPost(store, postId) {
+    const siteURL = getConfig(store.getState()).SiteURL || '';
+    const response = await fetch(`${siteURL}/plugins/${pluginId}/api/v1/posts/${postId}/strip`, Client4.getOptions({method: 'post'}));
+    if (!response.ok) {
+        console.error(`Failed to remove metadata from attachments: ${await response.text()}`); // eslint-disable-line no-console
+    }
+}
+
+class Plugin {
+    initialize(registry, store) {
+        registry.registerPostDropdownMenuAction(
+            'Remove metadata from attachments',
+            (postId) => stripPost(store, postId),
+            (postId) => {
+                const post = getPost(store.getState(), postId);
+                return Boolean(post && post.file_ids && post.file_ids.length);
+            },
+        );
+        registry.registerAdminConsoleCustomSetting('Dashboard', Dashboard, {showTitle: true});
+    }
+}
+
+window.registerPlugin(pluginId, new Plugin());
@@ -0,0 +1,2 @@
+export const id = 'mattermost-exif-plugin';
+export const version = '0.0.1';
@@ -0,0 +1,35 @@
+const path = require('path');
+
+module.exports = {
+    entry: [
+        './src/index.js',
+    ],
+    resolve: {
+        modules: [
+            'src',
+            'node_modules',
+        ],
+        extensions: ['*', '.js'],
+    },
+    module: {
+        rules: [
+            {
+                test: /\.js$/,
+                exclude: /node_modules/,
+                use: {
+                    loader: 'babel-loader',
+                },
+            },
+        ],
+    },
+    externals: {
+        react: 'React',
+        redux: 'Redux',
+        'react-redux': 'ReactRedux',
+    },
+    output: {
+        path: path.join(__dirname, '/dist'),
+        publicPath: '/',
+        filename: 'main.js',
+    },
+};